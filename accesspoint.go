@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+// accessPoint is an S3 Access Point or Multi-Region Access Point given as the bucket, so that
+// objects are accessed through the access point's policy instead of the bucket's.
+type accessPoint struct {
+	arn  arn.ARN
+	name string
+}
+
+// isAccessPointARN reports whether a bucket is given as an ARN, which only access points are.
+func isAccessPointARN(bucket string) bool {
+	return strings.HasPrefix(bucket, "arn:")
+}
+
+// parseAccessPointARN parses the ARN of an access point, like
+// `arn:aws:s3:us-east-1:123456789012:accesspoint/deploy`. Multi-Region Access Points have no
+// region in their ARN, and their alias as their name.
+func parseAccessPointARN(value string) (accessPoint, error) {
+	invalid := fmt.Errorf("unsupported ARN %q: expected an S3 access point ARN, e.g. 'arn:aws:s3:us-east-1:123456789012:accesspoint/deploy'", value)
+
+	parsed, err := arn.Parse(value)
+	if err != nil || parsed.Service != "s3" || parsed.AccountID == "" {
+		return accessPoint{}, invalid
+	}
+
+	kind, name, _ := strings.Cut(parsed.Resource, "/")
+	if kind != "accesspoint" || name == "" || strings.Contains(name, "/") {
+		return accessPoint{}, invalid
+	}
+
+	return accessPoint{arn: parsed, name: name}, nil
+}
+
+// multiRegion reports whether the access point is a Multi-Region Access Point, whose requests are
+// routed to the closest bucket and signed with SigV4A.
+func (a accessPoint) multiRegion() bool {
+	return a.arn.Region == ""
+}
+
+// url returns the URL the access point serves objects from.
+func (a accessPoint) url() string {
+	if a.multiRegion() {
+		return fmt.Sprintf("https://%s.accesspoint.s3-global.amazonaws.com/", a.name)
+	}
+
+	suffix := "amazonaws.com"
+	if a.arn.Partition == "aws-cn" {
+		suffix = "amazonaws.com.cn"
+	}
+
+	return fmt.Sprintf("https://%s-%s.s3-accesspoint.%s.%s/", a.name, a.arn.AccountID, a.arn.Region, suffix)
+}
+
+// applyAccessPoint validates a bucket given as an access point ARN, which is only reachable
+// through AWS's own endpoints.
+func (c *commonFlags) applyAccessPoint() error {
+	scheme, bucket, _ := parseBucketURL(c.bucket, "")
+	if scheme != defaultBackend || !isAccessPointARN(bucket) {
+		return nil
+	}
+
+	ap, err := parseAccessPointARN(bucket)
+	if err != nil {
+		return err
+	}
+
+	for _, setting := range []struct {
+		name  string
+		given bool
+	}{
+		{name: "dev", given: c.dev},
+		{name: "provider", given: c.provider != ""},
+		{name: "endpoint", given: c.endpoint != ""},
+		{name: "force-path-style", given: c.pathStyle},
+		{name: "accelerate", given: c.endpoints.accelerate},
+	} {
+		if setting.given {
+			return fmt.Errorf("the '-%s' flag can't be used together with an access point ARN", setting.name)
+		}
+	}
+
+	if ap.multiRegion() && (c.endpoints.fips || c.endpoints.dualStack) {
+		return errors.New("multi-region access points don't support the '-fips' and '-dualstack' flags")
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	testAccessPoint = "arn:aws:s3:us-west-2:123456789012:accesspoint/deploy"
+	testMultiRegion = "arn:aws:s3::123456789012:accesspoint/mfzwi23gnjvgw.mrap"
+)
+
+// authRecorder is a hostRecorder that also records the signing algorithm of the requests.
+type authRecorder struct {
+	hostRecorder
+	algorithms []string
+}
+
+func (r *authRecorder) Do(req *http.Request) (*http.Response, error) {
+	algorithm, _, _ := strings.Cut(req.Header.Get("Authorization"), " ")
+	r.algorithms = append(r.algorithms, algorithm)
+
+	return r.hostRecorder.Do(req)
+}
+
+func Test_parseAccessPointARN(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		value   string
+		wantURL string
+		wantErr bool
+	}{
+		{desc: "access point", value: testAccessPoint, wantURL: "https://deploy-123456789012.s3-accesspoint.us-west-2.amazonaws.com/"},
+		{desc: "china", value: "arn:aws-cn:s3:cn-north-1:123456789012:accesspoint/deploy", wantURL: "https://deploy-123456789012.s3-accesspoint.cn-north-1.amazonaws.com.cn/"},
+		{desc: "multi-region access point", value: testMultiRegion, wantURL: "https://mfzwi23gnjvgw.mrap.accesspoint.s3-global.amazonaws.com/"},
+		{desc: "not an ARN", value: "arn:deploy", wantErr: true},
+		{desc: "other service", value: "arn:aws:iam::123456789012:role/deploy", wantErr: true},
+		{desc: "bucket ARN", value: "arn:aws:s3:::my-site", wantErr: true},
+		{desc: "object ARN", value: testAccessPoint + "/object/index.html", wantErr: true},
+		{desc: "missing account", value: "arn:aws:s3:us-west-2::accesspoint/deploy", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := parseAccessPointARN(tC.value)
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if err == nil && got.url() != tC.wantURL {
+				t.Errorf("Expected URL %s; got %s", tC.wantURL, got.url())
+			}
+		})
+	}
+}
+
+func Test_commonFlags_applyAccessPoint(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		flags   commonFlags
+		wantErr bool
+	}{
+		{desc: "bucket", flags: commonFlags{bucket: "my-site", pathStyle: true}},
+		{desc: "access point", flags: commonFlags{bucket: testAccessPoint, endpoints: endpointSettings{fips: true, dualStack: true}}},
+		{desc: "access point with prefix", flags: commonFlags{bucket: testAccessPoint + "/site"}},
+		{desc: "multi-region access point", flags: commonFlags{bucket: testMultiRegion}},
+		{desc: "bucket ARN", flags: commonFlags{bucket: "arn:aws:s3:::my-site"}, wantErr: true},
+		{desc: "endpoint", flags: commonFlags{bucket: testAccessPoint, endpoint: "https://minio.internal:9000"}, wantErr: true},
+		{desc: "dev", flags: commonFlags{bucket: testAccessPoint, dev: true, endpoint: defaultDevEndpoint}, wantErr: true},
+		{desc: "path-style addressing", flags: commonFlags{bucket: testAccessPoint, pathStyle: true}, wantErr: true},
+		{desc: "accelerate", flags: commonFlags{bucket: testAccessPoint, endpoints: endpointSettings{accelerate: true}}, wantErr: true},
+		{desc: "multi-region access point with fips", flags: commonFlags{bucket: testMultiRegion, endpoints: endpointSettings{fips: true}}, wantErr: true},
+		{desc: "multi-region access point with dual-stack", flags: commonFlags{bucket: testMultiRegion, endpoints: endpointSettings{dualStack: true}}, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := tC.flags.applyAccessPoint()
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_commonFlags_newClient_accessPoint(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_CA_BUNDLE", "")
+
+	testCases := []struct {
+		desc          string
+		bucket        string
+		wantHost      string
+		wantAlgorithm string
+	}{
+		{
+			desc:          "access point in another region",
+			bucket:        testAccessPoint,
+			wantHost:      "deploy-123456789012.s3-accesspoint.us-west-2.amazonaws.com",
+			wantAlgorithm: "AWS4-HMAC-SHA256",
+		},
+		{
+			desc:          "multi-region access point",
+			bucket:        testMultiRegion,
+			wantHost:      "mfzwi23gnjvgw.mrap.accesspoint.s3-global.amazonaws.com",
+			wantAlgorithm: "AWS4-ECDSA-P256-SHA256",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			recorder := &authRecorder{}
+			common := commonFlags{region: "eu-west-1", bucket: tC.bucket}
+
+			client, err := common.newClient(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = client.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{Bucket: aws.String(tC.bucket)}, func(o *s3.Options) {
+				o.HTTPClient = recorder
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(recorder.hosts) != 1 || recorder.hosts[0] != tC.wantHost {
+				t.Errorf("Expected a request to %s; got requests to %v", tC.wantHost, recorder.hosts)
+			}
+
+			if len(recorder.algorithms) != 1 || recorder.algorithms[0] != tC.wantAlgorithm {
+				t.Errorf("Expected a request signed with %s; got %v", tC.wantAlgorithm, recorder.algorithms)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// archiveFormat is a format that -archive packs files into.
+type archiveFormat string
+
+const (
+	archiveTarGz archiveFormat = "tar.gz"
+	archiveZip   archiveFormat = "zip"
+)
+
+// parseArchiveFormat validates the format given to -archive. The empty string disables archiving.
+func parseArchiveFormat(value string) (archiveFormat, error) {
+	switch format := archiveFormat(strings.ToLower(value)); format {
+	case "", archiveTarGz, archiveZip:
+		return format, nil
+	case "tgz":
+		return archiveTarGz, nil
+	}
+
+	return "", fmt.Errorf("unknown archive format %q; expected 'tar.gz' or 'zip'", value)
+}
+
+// contentType returns the Content-Type of archives in the format.
+func (f archiveFormat) contentType() string {
+	if f == archiveZip {
+		return "application/zip"
+	}
+
+	return "application/gzip"
+}
+
+// archiveFile is a file to add to an archive.
+type archiveFile struct {
+	// path is the slash-separated path of the local file.
+	path string
+	// name is the path of the file within the archive, which is the key it would have been
+	// uploaded under.
+	name string
+}
+
+// archiveFiles returns the files of the tree that pass the filter, named by the keys the renames
+// give them, in the order they are walked.
+func archiveFiles(walkFiles treeWalker, filter pathFilter, renames hashRenames) ([]archiveFile, error) {
+	var files []archiveFile
+	err := walkFiles(createFilterFunc(filter, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("could not walk %s: %v", name, err)
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		name = filepath.ToSlash(name)
+		files = append(files, archiveFile{path: name, name: renames.Key(name)})
+
+		return nil
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// archiveManifest lists the files of an archive, so that consumers can check what they unpacked
+// without listing the archive itself.
+type archiveManifest struct {
+	GeneratedAt time.Time      `json:"generated_at"`
+	Files       []archiveEntry `json:"files"`
+}
+
+// archiveEntry describes a file within an archive.
+type archiveEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// archiveWriter adds files to an archive written to an underlying writer.
+type archiveWriter interface {
+	// Add adds a file with the given properties, reading its contents from `body`.
+	Add(name string, info fs.FileInfo, body io.Reader) error
+	// Close finishes the archive without closing the underlying writer.
+	Close() error
+}
+
+func newArchiveWriter(w io.Writer, format archiveFormat) archiveWriter {
+	if format == archiveZip {
+		return &zipArchiveWriter{w: zip.NewWriter(w)}
+	}
+
+	compressed := gzip.NewWriter(w)
+	return &tarArchiveWriter{gz: compressed, w: tar.NewWriter(compressed)}
+}
+
+// tarArchiveWriter writes gzip-compressed tarballs.
+type tarArchiveWriter struct {
+	gz *gzip.Writer
+	w  *tar.Writer
+}
+
+func (a *tarArchiveWriter) Add(name string, info fs.FileInfo, body io.Reader) error {
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+
+	// The user and group of the local file mean nothing to whoever unpacks the archive.
+	header.Name = name
+	header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+
+	if err := a.w.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(a.w, body)
+	return err
+}
+
+func (a *tarArchiveWriter) Close() error {
+	if err := a.w.Close(); err != nil {
+		return err
+	}
+
+	return a.gz.Close()
+}
+
+// zipArchiveWriter writes zip archives. Files in formats that are already compressed are stored
+// as they are.
+type zipArchiveWriter struct {
+	w *zip.Writer
+}
+
+func (a *zipArchiveWriter) Add(name string, info fs.FileInfo, body io.Reader) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+
+	header.Name = name
+	header.Method = zip.Deflate
+	if compressedExtensions[strings.ToLower(path.Ext(name))] {
+		header.Method = zip.Store
+	}
+
+	w, err := a.w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, body)
+	return err
+}
+
+func (a *zipArchiveWriter) Close() error {
+	return a.w.Close()
+}
+
+// manifestInfo is the file information of the manifest added to an archive.
+type manifestInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i manifestInfo) Name() string       { return path.Base(i.name) }
+func (i manifestInfo) Size() int64        { return i.size }
+func (i manifestInfo) Mode() fs.FileMode  { return 0o644 }
+func (i manifestInfo) ModTime() time.Time { return i.modTime }
+func (i manifestInfo) IsDir() bool        { return false }
+func (i manifestInfo) Sys() any           { return nil }
+
+// writeArchive packs the files into an archive written to `w`. If `manifestName` is given, a JSON
+// manifest listing every file with its size and SHA-256 hash is added under that name last.
+func writeArchive(w io.Writer, format archiveFormat, fsys fs.FS, files []archiveFile, manifestName string, now time.Time) error {
+	archive := newArchiveWriter(w, format)
+	manifest := archiveManifest{GeneratedAt: now.UTC(), Files: make([]archiveEntry, 0, len(files))}
+
+	for _, file := range files {
+		if file.name == manifestName {
+			return fmt.Errorf("can't add the archive manifest as %s: %s is archived under that name", manifestName, file.path)
+		}
+
+		entry, err := addArchiveFile(archive, fsys, file)
+		if err != nil {
+			return fmt.Errorf("could not archive %s: %w", file.path, err)
+		}
+
+		manifest.Files = append(manifest.Files, entry)
+	}
+
+	if manifestName != "" {
+		body, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		body = append(body, '\n')
+		info := manifestInfo{name: manifestName, size: int64(len(body)), modTime: now}
+		if err := archive.Add(manifestName, info, bytes.NewReader(body)); err != nil {
+			return fmt.Errorf("could not add the archive manifest: %w", err)
+		}
+	}
+
+	return archive.Close()
+}
+
+// addArchiveFile adds a local file to an archive, hashing it on the way for the manifest.
+func addArchiveFile(archive archiveWriter, fsys fs.FS, file archiveFile) (archiveEntry, error) {
+	f, err := fsys.Open(file.path)
+	if err != nil {
+		return archiveEntry{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return archiveEntry{}, err
+	}
+
+	digest := sha256.New()
+	if err := archive.Add(file.name, info, io.TeeReader(f, digest)); err != nil {
+		return archiveEntry{}, err
+	}
+
+	return archiveEntry{Path: file.name, Size: info.Size(), SHA256: hex.EncodeToString(digest.Sum(nil))}, nil
+}
+
+// errArchiveUploadStopped stops packing an archive whose upload ended.
+var errArchiveUploadStopped = errors.New("the upload of the archive stopped")
+
+// uploadArchive streams an archive of the files to a key, relative to the prefix, without
+// writing it to disk, and returns the number of bytes uploaded. Since the archive is packed as
+// it is uploaded, a failed upload can't be retried.
+func uploadArchive(ctx context.Context, client uploader, key string, format archiveFormat, fsys fs.FS, files []archiveFile, manifestName string, now time.Time) (int64, error) {
+	reader, writer := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := writeArchive(writer, format, fsys, files, manifestName, now)
+		writer.CloseWithError(err)
+		done <- err
+	}()
+
+	counter := &countingReader{r: reader, progress: &progress{}}
+	uploadErr := client.Upload(ctx, &uploadObject{Path: key, Body: counter, ContentType: format.contentType()})
+
+	// An upload that failed before reading the whole archive leaves the writer blocked.
+	reader.CloseWithError(errArchiveUploadStopped)
+	if err := <-done; err != nil && (uploadErr == nil || !errors.Is(err, errArchiveUploadStopped)) {
+		return 0, err
+	}
+
+	if uploadErr != nil {
+		return 0, uploadErr
+	}
+
+	return counter.n, nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func Test_parseArchiveFormat(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		value   string
+		want    archiveFormat
+		wantErr bool
+	}{
+		{desc: "none", value: "", want: ""},
+		{desc: "tarball", value: "tar.gz", want: archiveTarGz},
+		{desc: "tgz", value: "tgz", want: archiveTarGz},
+		{desc: "zip", value: "ZIP", want: archiveZip},
+		{desc: "unknown", value: "rar", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := parseArchiveFormat(tC.value)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if got != tC.want {
+				t.Errorf("Expected format %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_archiveFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dist/index.html": {Data: []byte("<html>")},
+		"dist/app.js":     {Data: []byte("alert(1)")},
+		"dist/app.js.map": {Data: []byte("{}")},
+	}
+	walk := func(fn fs.WalkDirFunc) error {
+		return fs.WalkDir(fsys, ".", fn)
+	}
+	filter, _ := newPathFilter(nil, []string{"*.map"})
+
+	files, err := archiveFiles(walk, filter, hashRenames{"dist/app.js": "app.js"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []archiveFile{{path: "dist/app.js", name: "app.js"}, {path: "dist/index.html", name: "dist/index.html"}}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("Expected files %+v; got %+v", want, files)
+	}
+}
+
+// readTarGz returns the contents of the files of a gzip-compressed tarball by name.
+func readTarGz(t *testing.T, body []byte) map[string]string {
+	t.Helper()
+
+	compressed, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents := map[string]string{}
+	archive := tar.NewReader(compressed)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return contents
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := io.ReadAll(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		contents[header.Name] = string(data)
+	}
+}
+
+// readZip returns the contents of the files of a zip archive by name.
+func readZip(t *testing.T, body []byte) map[string]string {
+	t.Helper()
+
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents := map[string]string{}
+	for _, file := range archive.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		contents[file.Name] = string(data)
+	}
+
+	return contents
+}
+
+func Test_writeArchive(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dist/index.html": {Data: []byte("<html>"), Mode: 0o644},
+		"dist/logo.png":   {Data: []byte("PNG"), Mode: 0o644},
+	}
+	files := []archiveFile{{path: "dist/index.html", name: "index.html"}, {path: "dist/logo.png", name: "logo.png"}}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		format archiveFormat
+		read   func(*testing.T, []byte) map[string]string
+	}{
+		{format: archiveTarGz, read: readTarGz},
+		{format: archiveZip, read: readZip},
+	}
+	for _, tC := range testCases {
+		t.Run(string(tC.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeArchive(&buf, tC.format, fsys, files, "MANIFEST.json", now); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			contents := tC.read(t, buf.Bytes())
+			if contents["index.html"] != "<html>" || contents["logo.png"] != "PNG" {
+				t.Errorf("Expected the files under their names; got %v", contents)
+			}
+
+			var manifest archiveManifest
+			if err := json.Unmarshal([]byte(contents["MANIFEST.json"]), &manifest); err != nil {
+				t.Fatalf("Could not decode the manifest: %v", err)
+			}
+
+			want := []archiveEntry{
+				{Path: "index.html", Size: 6, SHA256: fmt.Sprintf("%x", sha256.Sum256([]byte("<html>")))},
+				{Path: "logo.png", Size: 3, SHA256: fmt.Sprintf("%x", sha256.Sum256([]byte("PNG")))},
+			}
+
+			if !reflect.DeepEqual(manifest.Files, want) {
+				t.Errorf("Expected manifest entries %+v; got %+v", want, manifest.Files)
+			}
+
+			if !manifest.GeneratedAt.Equal(now) {
+				t.Errorf("Expected the manifest to be generated at %v; got %v", now, manifest.GeneratedAt)
+			}
+		})
+	}
+}
+
+func Test_writeArchive_manifestConflict(t *testing.T) {
+	fsys := fstest.MapFS{"MANIFEST.json": {Data: []byte("{}")}}
+	files := []archiveFile{{path: "MANIFEST.json", name: "MANIFEST.json"}}
+
+	if err := writeArchive(io.Discard, archiveZip, fsys, files, "MANIFEST.json", time.Now()); err == nil {
+		t.Error("Expected an error for a file named like the manifest")
+	}
+}
+
+func Test_uploadArchive(t *testing.T) {
+	fsys := fstest.MapFS{"index.html": {Data: []byte("<html>")}}
+	files := []archiveFile{{path: "index.html", name: "index.html"}}
+
+	client := &recordingUploader{}
+	size, err := uploadArchive(context.Background(), client, "builds/site.tar.gz", archiveTarGz, fsys, files, "", time.Now())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(client.objects) != 1 || client.objects[0].Path != "builds/site.tar.gz" || client.objects[0].ContentType != "application/gzip" {
+		t.Fatalf("Expected the archive to be uploaded; got %+v", client.objects)
+	}
+
+	if size != int64(len(client.bodies[0])) {
+		t.Errorf("Expected %d bytes; got %d", len(client.bodies[0]), size)
+	}
+
+	if contents := readTarGz(t, []byte(client.bodies[0])); contents["index.html"] != "<html>" {
+		t.Errorf("Expected the file in the archive; got %v", contents)
+	}
+}
+
+func Test_uploadArchive_errors(t *testing.T) {
+	fsys := fstest.MapFS{"index.html": {Data: []byte("<html>")}}
+
+	// The failed upload doesn't read the archive, which mustn't leave the writer blocked.
+	client := &mockUploader{uploadErr: errors.New("access denied")}
+	files := []archiveFile{{path: "index.html", name: "index.html"}}
+	if _, err := uploadArchive(context.Background(), client, "site.zip", archiveZip, fsys, files, "", time.Now()); err == nil || err.Error() != "access denied" {
+		t.Errorf("Expected the upload error; got %v", err)
+	}
+
+	missing := []archiveFile{{path: "missing.html", name: "missing.html"}}
+	if _, err := uploadArchive(context.Background(), &recordingUploader{}, "site.zip", archiveZip, fsys, missing, "", time.Now()); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	// mtimeMetadataHeader stores the modification time of a file with -preserve.
+	mtimeMetadataHeader = "X-Amz-Meta-S3copy-Mtime"
+	// modeMetadataHeader stores the permissions of a file, in octal, with -preserve.
+	modeMetadataHeader = "X-Amz-Meta-S3copy-Mode"
+)
+
+// attributesUploader stores the modification time and permissions of every file in the metadata
+// of its objects, so that downloads can restore them.
+type attributesUploader struct {
+	next uploader
+}
+
+func (u *attributesUploader) Upload(ctx context.Context, object *uploadObject) error {
+	file, ok := object.Body.(fs.File)
+	if !ok {
+		return u.next.Upload(ctx, object)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("could not read the attributes of %s: %v", object.Path, err)
+	}
+
+	if object.Headers == nil {
+		object.Headers = map[string]string{}
+	}
+
+	object.Headers[mtimeMetadataHeader] = info.ModTime().UTC().Format(time.RFC3339Nano)
+	object.Headers[modeMetadataHeader] = fmt.Sprintf("%04o", info.Mode().Perm())
+
+	return u.next.Upload(ctx, object)
+}
+
+// restoreAttributes sets the modification time and permissions of a downloaded file to those
+// stored in the metadata of its object. Attributes that weren't stored are left alone.
+func restoreAttributes(path string, metadata map[string]string) error {
+	metadata = lowerKeys(metadata)
+
+	if value, ok := metadata["s3copy-mode"]; ok {
+		mode, err := strconv.ParseUint(value, 8, 32)
+		if err != nil || mode > uint64(fs.ModePerm) {
+			return fmt.Errorf("invalid permissions %q", value)
+		}
+
+		if err := os.Chmod(path, fs.FileMode(mode)); err != nil {
+			return err
+		}
+	}
+
+	if value, ok := metadata["s3copy-mtime"]; ok {
+		mtime, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return fmt.Errorf("invalid modification time %q", value)
+		}
+
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createRestoreFunc wraps a download callback to restore the attributes stored with each object
+// once it was downloaded into the destination directory.
+func createRestoreFunc(ctx context.Context, dest string, client objectHeader, download fs.WalkDirFunc) fs.WalkDirFunc {
+	return func(key string, entry fs.DirEntry, err error) error {
+		if err := download(key, entry, err); err != nil || entry.IsDir() {
+			return err
+		}
+
+		head, err := client.Head(ctx, key)
+		if err != nil {
+			return fmt.Errorf("could not read the attributes of %s: %v", key, err)
+		}
+
+		if err := restoreAttributes(filepath.Join(dest, filepath.FromSlash(key)), head.Metadata); err != nil {
+			return fmt.Errorf("could not restore the attributes of %s: %v", key, err)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func Test_attributesUploader(t *testing.T) {
+	mtime := time.Date(2024, 3, 1, 8, 30, 0, 500, time.FixedZone("CET", 3600))
+	fsys := fstest.MapFS{"bin/run.sh": {Data: []byte("#!/bin/sh"), Mode: 0o755, ModTime: mtime}}
+
+	file, err := fsys.Open("bin/run.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	client := &mockUploader{}
+	u := &attributesUploader{next: client}
+	if err := u.Upload(context.Background(), &uploadObject{Path: "bin/run.sh", Body: file}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	headers := client.uploadedObject.Headers
+	if want := "2024-03-01T07:30:00.0000005Z"; headers[mtimeMetadataHeader] != want {
+		t.Errorf("Expected modification time %q; got %q", want, headers[mtimeMetadataHeader])
+	}
+
+	if headers[modeMetadataHeader] != "0755" {
+		t.Errorf("Expected mode %q; got %q", "0755", headers[modeMetadataHeader])
+	}
+
+	// Bodies that aren't files, such as standard input, have no attributes.
+	if err := u.Upload(context.Background(), &uploadObject{Path: "stdin", Body: strings.NewReader("x")}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if client.uploadedObject.Headers != nil {
+		t.Errorf("Expected no headers; got %v", client.uploadedObject.Headers)
+	}
+}
+
+func Test_restoreAttributes(t *testing.T) {
+	mtime := time.Date(2024, 3, 1, 7, 30, 0, 0, time.UTC)
+
+	testCases := []struct {
+		desc     string
+		metadata map[string]string
+		wantMode fs.FileMode
+		wantTime time.Time
+		wantErr  bool
+	}{
+		{desc: "both", metadata: map[string]string{"s3copy-mtime": mtime.Format(time.RFC3339Nano), "s3copy-mode": "0600"}, wantMode: 0o600, wantTime: mtime},
+		{desc: "capitalized keys", metadata: map[string]string{"S3copy-Mode": "0640"}, wantMode: 0o640},
+		{desc: "none", metadata: map[string]string{"owner": "web"}, wantMode: 0o644},
+		{desc: "invalid mode", metadata: map[string]string{"s3copy-mode": "rwx"}, wantErr: true},
+		{desc: "mode out of range", metadata: map[string]string{"s3copy-mode": "4755"}, wantErr: true},
+		{desc: "invalid time", metadata: map[string]string{"s3copy-mtime": "yesterday"}, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file.txt")
+			if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := restoreAttributes(path, tC.metadata)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if tC.wantErr {
+				return
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if runtime.GOOS != "windows" && info.Mode().Perm() != tC.wantMode {
+				t.Errorf("Expected mode %v; got %v", tC.wantMode, info.Mode().Perm())
+			}
+
+			if !tC.wantTime.IsZero() && !info.ModTime().Equal(tC.wantTime) {
+				t.Errorf("Expected modification time %v; got %v", tC.wantTime, info.ModTime())
+			}
+		})
+	}
+}
+
+func Test_createRestoreFunc(t *testing.T) {
+	dest := t.TempDir()
+	client := &mockHeader{objects: map[string]objectHead{
+		"docs/a.txt": {Metadata: map[string]string{"s3copy-mode": "0600"}},
+	}}
+
+	download := func(key string, entry fs.DirEntry, err error) error {
+		if key == "broken.txt" {
+			return errors.New("download failed")
+		}
+
+		path := filepath.Join(dest, filepath.FromSlash(key))
+		os.MkdirAll(filepath.Dir(path), 0o755)
+
+		return os.WriteFile(path, []byte("x"), 0o644)
+	}
+
+	restore := createRestoreFunc(context.Background(), dest, client, download)
+
+	if err := restore("docs/a.txt", remoteEntry{object: remoteObject{Key: "docs/a.txt"}}, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if info, err := os.Stat(filepath.Join(dest, "docs", "a.txt")); err != nil || (runtime.GOOS != "windows" && info.Mode().Perm() != 0o600) {
+		t.Errorf("Expected the permissions to be restored; got %v, %v", info, err)
+	}
+
+	if err := restore("broken.txt", remoteEntry{object: remoteObject{Key: "broken.txt"}}, nil); err == nil || err.Error() != "download failed" {
+		t.Errorf("Expected the download error; got %v", err)
+	}
+
+	if err := restore("missing.txt", remoteEntry{object: remoteObject{Key: "missing.txt"}}, nil); err == nil {
+		t.Error("Expected an error for an object that can't be read")
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// defaultBackend is the storage backend used for buckets given without a scheme.
+const defaultBackend = "s3"
+
+// backend is a storage service that files are uploaded to, such as an S3 bucket. Paths are
+// relative to the backend's prefix.
+type backend interface {
+	uploader
+	objectHeader
+	stateStore
+	lockStore
+
+	// List returns every object beneath the prefix, keyed by its path.
+	List(ctx context.Context) (map[string]remoteObject, error)
+	// Delete deletes the objects at the given paths.
+	Delete(ctx context.Context, paths []string) error
+	// Sub returns the backend for the objects in a directory beneath the prefix.
+	Sub(dir string) backend
+	// URL returns the URL that the backend itself serves the objects beneath the prefix from.
+	URL() string
+}
+
+// backendOptions configures how a backend stores objects. Backends that don't support an option
+// report an error if it's set.
+type backendOptions struct {
+	// ACL is the canned ACL applied to every object. If empty, no ACL is sent.
+	ACL types.ObjectCannedACL
+	// Metadata is the user metadata stored with every object.
+	Metadata map[string]string
+	// Tags are the object tags applied to every object.
+	Tags map[string]string
+	// Encryption configures server-side encryption of every object.
+	Encryption serverSideEncryption
+	// ObjectLock protects every object from being deleted or overwritten.
+	ObjectLock objectLock
+	// Checksum is sent with every object so that the backend rejects corrupted uploads.
+	Checksum uploadChecksum
+	// Multipart tunes how large files are split into parts.
+	Multipart multipartSettings
+	// ListConcurrency is the number of top-level directories listed in parallel when listing
+	// the existing objects. Backends that can't list in parallel ignore it.
+	ListConcurrency int
+	// Journal records multipart uploads so that an interrupted run can resume them. If nil,
+	// failed multipart uploads are aborted. Backends that can't resume uploads ignore it.
+	Journal multipartJournal
+	// CreateBucket creates the bucket with these settings if it doesn't exist. If nil, the bucket
+	// must exist.
+	CreateBucket *bucketSettings
+}
+
+// backendFactory creates a backend for the objects beneath the prefix of the given bucket, using
+// the common flags for any connection settings.
+type backendFactory func(ctx context.Context, common *commonFlags, bucket, prefix string, options backendOptions) (backend, error)
+
+// backends are the registered backends, by the scheme that selects them.
+var backends = map[string]backendFactory{}
+
+// registerBackend makes a backend available for buckets given as `<scheme>://<bucket>`.
+func registerBackend(scheme string, factory backendFactory) {
+	backends[scheme] = factory
+}
+
+// parseBucketURL splits a bucket given as `<scheme>://<bucket>/<prefix>` into its parts. A bucket
+// without a scheme uses the default backend. The `-prefix` flag is appended to the prefix of the
+// URL, and the result is normalized.
+func parseBucketURL(bucketURL, prefix string) (string, string, string) {
+	scheme, bucket, ok := strings.Cut(bucketURL, "://")
+	if !ok {
+		scheme, bucket = defaultBackend, bucketURL
+	}
+
+	// The name of an access point given as an ARN follows the slash of the ARN's resource.
+	var name int
+	if isAccessPointARN(bucket) {
+		name = strings.Index(bucket, "/") + 1
+	}
+
+	bucketName, urlPrefix, _ := strings.Cut(bucket[name:], "/")
+	bucket = bucket[:name] + bucketName
+
+	return scheme, bucket, normalizePrefix(urlPrefix) + normalizePrefix(prefix)
+}
+
+// newBackend creates the backend selected by the scheme of the bucket, or S3 if it has none.
+func newBackend(ctx context.Context, common *commonFlags, options backendOptions) (backend, error) {
+	scheme, bucket, prefix := parseBucketURL(common.bucket, common.prefix)
+
+	factory, ok := backends[scheme]
+	if !ok {
+		schemes := make([]string, 0, len(backends))
+		for name := range backends {
+			schemes = append(schemes, name+"://")
+		}
+
+		sort.Strings(schemes)
+
+		return nil, fmt.Errorf("unknown storage backend %q; expected one of: %s", scheme+"://", strings.Join(schemes, ", "))
+	}
+
+	return factory(ctx, common, bucket, prefix, options)
+}
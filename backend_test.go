@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func Test_newBackend(t *testing.T) {
+	var gotBucket, gotPrefix string
+	registerBackend("test", func(ctx context.Context, common *commonFlags, bucket, prefix string, options backendOptions) (backend, error) {
+		gotBucket, gotPrefix = bucket, prefix
+		return nil, errors.New("test backend")
+	})
+	t.Cleanup(func() {
+		delete(backends, "test")
+	})
+
+	testCases := []struct {
+		desc       string
+		bucket     string
+		wantBucket string
+		wantErr    string
+	}{
+		{
+			desc:       "registered scheme",
+			bucket:     "test://my-bucket",
+			wantBucket: "my-bucket",
+			wantErr:    "test backend",
+		},
+		{
+			desc:    "unknown scheme",
+			bucket:  "ftp://my-bucket",
+			wantErr: `unknown storage backend "ftp://"`,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			gotBucket, gotPrefix = "", ""
+
+			_, err := newBackend(context.Background(), &commonFlags{bucket: tC.bucket, prefix: "site"}, backendOptions{})
+			if err == nil || !strings.Contains(err.Error(), tC.wantErr) {
+				t.Fatalf("Expected error %q; got %v", tC.wantErr, err)
+			}
+
+			if gotBucket != tC.wantBucket {
+				t.Errorf("Expected bucket %q; got %q", tC.wantBucket, gotBucket)
+			}
+
+			if tC.wantBucket != "" && gotPrefix != "site/" {
+				t.Errorf("Expected prefix site/; got %q", gotPrefix)
+			}
+		})
+	}
+}
+
+func Test_parseBucketURL(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		bucket     string
+		prefix     string
+		wantScheme string
+		wantBucket string
+		wantPrefix string
+	}{
+		{
+			desc:       "bucket name",
+			bucket:     "my-bucket",
+			prefix:     "/site",
+			wantScheme: "s3",
+			wantBucket: "my-bucket",
+			wantPrefix: "site/",
+		},
+		{
+			desc:       "url",
+			bucket:     "gs://my-bucket",
+			wantScheme: "gs",
+			wantBucket: "my-bucket",
+		},
+		{
+			desc:       "url with prefix",
+			bucket:     "gs://my-bucket/site/",
+			prefix:     "docs",
+			wantScheme: "gs",
+			wantBucket: "my-bucket",
+			wantPrefix: "site/docs/",
+		},
+		{
+			desc:       "access point ARN",
+			bucket:     "arn:aws:s3:us-west-2:123456789012:accesspoint/deploy",
+			wantScheme: "s3",
+			wantBucket: "arn:aws:s3:us-west-2:123456789012:accesspoint/deploy",
+		},
+		{
+			desc:       "access point ARN with prefix",
+			bucket:     "s3://arn:aws:s3:us-west-2:123456789012:accesspoint/deploy/site",
+			prefix:     "docs",
+			wantScheme: "s3",
+			wantBucket: "arn:aws:s3:us-west-2:123456789012:accesspoint/deploy",
+			wantPrefix: "site/docs/",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			scheme, bucket, prefix := parseBucketURL(tC.bucket, tC.prefix)
+			if scheme != tC.wantScheme || bucket != tC.wantBucket || prefix != tC.wantPrefix {
+				t.Errorf("Expected %s, %s, %q; got %s, %s, %q", tC.wantScheme, tC.wantBucket, tC.wantPrefix, scheme, bucket, prefix)
+			}
+		})
+	}
+}
+
+func Test_s3Backend(t *testing.T) {
+	var _ backend = &s3Uploader{}
+
+	if _, ok := backends[defaultBackend]; !ok {
+		t.Errorf("Expected the %s backend to be registered", defaultBackend)
+	}
+}
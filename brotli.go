@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// brotliExtension is appended to the key of an object to name its Brotli-compressed variant.
+const brotliExtension = ".br"
+
+// brotliVariants decides which files are also uploaded as a Brotli-compressed `.br` sibling, for
+// CDNs and servers that serve pre-compressed variants to clients that accept them.
+type brotliVariants struct {
+	patterns []string
+}
+
+// newBrotliVariants creates the variant rules for files matching any of the given glob patterns.
+// Each pattern may be a comma-separated list. If no patterns are given, nil is
+// returned and no variants are created.
+func newBrotliVariants(patterns []string) (*brotliVariants, error) {
+	split := splitPatterns(patterns)
+	if len(split) == 0 {
+		return nil, nil
+	}
+
+	if _, err := newPathFilter(split, nil); err != nil {
+		return nil, fmt.Errorf("invalid brotli pattern: %v", err)
+	}
+
+	return &brotliVariants{patterns: split}, nil
+}
+
+// Match reports whether a variant should be created for the file at the given path. It is safe
+// to call on nil variant rules.
+func (b *brotliVariants) Match(name string) bool {
+	if b == nil || compressedExtensions[strings.ToLower(filepath.Ext(name))] {
+		return false
+	}
+
+	return matchAny(b.patterns, filepath.ToSlash(name))
+}
+
+// SkipFunc wraps the callback for files skipped because they are unchanged, so that unchanged
+// files whose variant is missing from the remote objects are passed to `upload` instead. This
+// creates variants for files uploaded before Brotli variants were enabled.
+func (b *brotliVariants) SkipFunc(remote map[string]remoteObject, upload, skip fs.WalkDirFunc) fs.WalkDirFunc {
+	return func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && b.Match(path) {
+			if _, ok := remote[path+brotliExtension]; !ok {
+				return upload(path, entry, nil)
+			}
+		}
+
+		return skip(path, entry, err)
+	}
+}
+
+// addVariantKeys records the keys of the variants created for the files in `seen`, so that they
+// aren't considered stale when deleting objects that no longer exist locally.
+func addVariantKeys(seen map[string]bool, variants *brotliVariants) {
+	var keys []string
+	for key := range seen {
+		if variants.Match(key) {
+			keys = append(keys, key+brotliExtension)
+		}
+	}
+
+	for _, key := range keys {
+		seen[key] = true
+	}
+}
+
+// brotliUploader uploads a Brotli-compressed variant next to every matching object. The variant
+// keeps the original's Content-Type and headers, and is marked with `Content-Encoding: br`.
+type brotliUploader struct {
+	variants *brotliVariants
+	next     uploader
+}
+
+func (u *brotliUploader) Upload(ctx context.Context, object *uploadObject) error {
+	if !u.variants.Match(object.Path) {
+		return u.next.Upload(ctx, object)
+	}
+
+	// The body is needed twice, so it's buffered in memory rather than read from the file again.
+	contents, err := io.ReadAll(object.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", object.Path, err)
+	}
+
+	var compressed bytes.Buffer
+	writer := brotli.NewWriterLevel(&compressed, brotli.BestCompression)
+	if _, err := writer.Write(contents); err != nil {
+		return fmt.Errorf("failed to compress %s: %v", object.Path, err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to compress %s: %v", object.Path, err)
+	}
+
+	headers := map[string]string{}
+	for header, value := range object.Headers {
+		headers[header] = value
+	}
+
+	headers["Content-Encoding"] = "br"
+
+	variant := &uploadObject{
+		Path:        object.Path + brotliExtension,
+		Body:        bytes.NewReader(compressed.Bytes()),
+		ContentType: object.ContentType,
+		Headers:     headers,
+	}
+
+	object.Body = bytes.NewReader(contents)
+
+	return uploadEach(ctx, u.next, object, variant)
+}
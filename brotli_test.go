@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func Test_brotliUploader(t *testing.T) {
+	variants, _ := newBrotliVariants([]string{"*.js"})
+	next := &recordingUploader{}
+	u := &brotliUploader{variants: variants, next: next}
+
+	err := u.Upload(context.Background(), &uploadObject{
+		Path:        "app.js",
+		Body:        strings.NewReader("console.log('hi')"),
+		ContentType: "text/javascript; charset=utf-8",
+		Headers:     map[string]string{"Cache-Control": "max-age=60"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(next.objects) != 2 {
+		t.Fatalf("Expected 2 uploads; got %d", len(next.objects))
+	}
+
+	if next.bodies[0] != "console.log('hi')" {
+		t.Errorf("Expected original body %q; got %q", "console.log('hi')", next.bodies[0])
+	}
+
+	variant := next.objects[1]
+	if variant.Path != "app.js.br" {
+		t.Errorf("Expected variant path %q; got %q", "app.js.br", variant.Path)
+	}
+
+	if variant.ContentType != "text/javascript; charset=utf-8" {
+		t.Errorf("Expected variant to keep the original Content-Type; got %q", variant.ContentType)
+	}
+
+	if variant.Headers["Content-Encoding"] != "br" || variant.Headers["Cache-Control"] != "max-age=60" {
+		t.Errorf("Expected variant headers to include Content-Encoding and Cache-Control; got %v", variant.Headers)
+	}
+
+	if _, ok := next.objects[0].Headers["Content-Encoding"]; ok {
+		t.Error("Expected the original's headers to be unchanged")
+	}
+
+	decompressed, err := io.ReadAll(brotli.NewReader(strings.NewReader(next.bodies[1])))
+	if err != nil || string(decompressed) != "console.log('hi')" {
+		t.Errorf("Expected variant to decompress to the original body; got %q, %v", decompressed, err)
+	}
+}
+
+func Test_brotliVariants_SkipFunc(t *testing.T) {
+	variants, _ := newBrotliVariants([]string{"*.js"})
+	remote := map[string]remoteObject{
+		"a.js":    {Key: "a.js"},
+		"a.js.br": {Key: "a.js.br"},
+		"b.js":    {Key: "b.js"},
+	}
+
+	var uploaded, skipped []string
+	upload := func(path string, entry fs.DirEntry, err error) error {
+		uploaded = append(uploaded, path)
+		return nil
+	}
+	skip := func(path string, entry fs.DirEntry, err error) error {
+		skipped = append(skipped, path)
+		return nil
+	}
+
+	skipFunc := variants.SkipFunc(remote, upload, skip)
+	for _, path := range []string{"a.js", "b.js", "c.css"} {
+		skipFunc(path, mockFileInfo{name: path}, nil)
+	}
+
+	if strings.Join(uploaded, ",") != "b.js" {
+		t.Errorf("Expected only the file with a missing variant to be uploaded; got %v", uploaded)
+	}
+
+	if strings.Join(skipped, ",") != "a.js,c.css" {
+		t.Errorf("Expected the other files to be skipped; got %v", skipped)
+	}
+}
+
+func Test_addVariantKeys(t *testing.T) {
+	variants, _ := newBrotliVariants([]string{"*.js"})
+	seen := map[string]bool{"app.js": true, "index.html": true}
+
+	addVariantKeys(seen, variants)
+
+	if !seen["app.js.br"] || seen["index.html.br"] || len(seen) != 3 {
+		t.Errorf("Expected only the variant of app.js to be added; got %v", seen)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// bucketSettings configure the buckets created by `-create-bucket`, e.g. the short-lived buckets
+// of preview environments.
+type bucketSettings struct {
+	// versioning enables versioning on the bucket.
+	versioning bool
+	// public lifts the public access block S3 applies to new buckets, so that objects can be
+	// made readable by everyone with ACLs or a bucket policy.
+	public bool
+	// acls enables ACLs on the bucket even without a default ACL, for the ACLs and grants of
+	// header rules.
+	acls bool
+	// objectLock enables Object Lock on the bucket, which also enables versioning.
+	objectLock bool
+}
+
+// publicACLs are the canned ACLs granting access to everyone, which the public access block of
+// new buckets rejects.
+var publicACLs = []types.ObjectCannedACL{types.ObjectCannedACLPublicRead, types.ObjectCannedACLPublicReadWrite}
+
+// createBucket creates the bucket unless it already exists, in the client's region. Buckets that
+// already exist are left unchanged. The public access block and object ownership are only set on
+// AWS, as other services don't support them.
+func createBucket(ctx context.Context, client *s3.Client, bucket string, settings bucketSettings, acl types.ObjectCannedACL) error {
+	if isAccessPointARN(bucket) {
+		return errors.New("access points can't be created with '-create-bucket'")
+	}
+
+	// Buckets that can't be checked, e.g. for lack of permission, are assumed to exist. Uploading
+	// to them reports any other problem.
+	_, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+
+	var respErr *awshttp.ResponseError
+	if err == nil || !errors.As(err, &respErr) || respErr.HTTPStatusCode() != http.StatusNotFound {
+		return nil
+	}
+
+	options := client.Options()
+	onAWS := options.BaseEndpoint == nil
+
+	if onAWS && !settings.public && slices.Contains(publicACLs, acl) {
+		return fmt.Errorf("the public access block of a new bucket would reject files uploaded with the %s ACL; use '-public-bucket' to allow public access, or '-acl none'", acl)
+	}
+
+	input := &s3.CreateBucketInput{Bucket: aws.String(bucket)}
+	if settings.objectLock {
+		input.ObjectLockEnabledForBucket = aws.Bool(true)
+	}
+
+	if onAWS {
+		// Buckets in us-east-1 are created without a location constraint.
+		if options.Region != "us-east-1" {
+			input.CreateBucketConfiguration = &types.CreateBucketConfiguration{
+				LocationConstraint: types.BucketLocationConstraint(options.Region),
+			}
+		}
+
+		// New buckets have ACLs disabled, which would reject every upload with an ACL.
+		if acl != "" || settings.acls {
+			input.ObjectOwnership = types.ObjectOwnershipObjectWriter
+		}
+	}
+
+	_, err = client.CreateBucket(ctx, input)
+
+	var ownedErr *types.BucketAlreadyOwnedByYou
+	if errors.As(err, &ownedErr) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not create bucket %s: %v", bucket, err)
+	}
+
+	if onAWS && settings.public {
+		_, err := client.PutPublicAccessBlock(ctx, &s3.PutPublicAccessBlockInput{
+			Bucket: aws.String(bucket),
+			PublicAccessBlockConfiguration: &types.PublicAccessBlockConfiguration{
+				BlockPublicAcls:       aws.Bool(false),
+				BlockPublicPolicy:     aws.Bool(false),
+				IgnorePublicAcls:      aws.Bool(false),
+				RestrictPublicBuckets: aws.Bool(false),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("could not allow public access to bucket %s: %v", bucket, err)
+		}
+	}
+
+	if settings.versioning {
+		_, err := client.PutBucketVersioning(ctx, &s3.PutBucketVersioningInput{
+			Bucket:                  aws.String(bucket),
+			VersioningConfiguration: &types.VersioningConfiguration{Status: types.BucketVersioningStatusEnabled},
+		})
+		if err != nil {
+			return fmt.Errorf("could not enable versioning of bucket %s: %v", bucket, err)
+		}
+	}
+
+	log.Printf("Created bucket %s in %s\n", bucket, options.Region)
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func Test_createBucket(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		bucket        string
+		region        string
+		endpoint      string
+		settings      bucketSettings
+		acl           types.ObjectCannedACL
+		head          int
+		create        scriptedResponse
+		wantRequests  []string
+		wantLocation  string
+		wantOwnership string
+		wantLock      bool
+		wantErr       bool
+	}{
+		{
+			desc:         "existing bucket",
+			region:       "eu-west-1",
+			settings:     bucketSettings{versioning: true, public: true},
+			head:         http.StatusOK,
+			wantRequests: []string{"HEAD"},
+		},
+		{
+			desc:         "unreadable bucket",
+			region:       "eu-west-1",
+			head:         http.StatusForbidden,
+			wantRequests: []string{"HEAD"},
+		},
+		{
+			desc:         "private bucket",
+			region:       "eu-west-1",
+			head:         http.StatusNotFound,
+			wantRequests: []string{"HEAD", "PUT"},
+			wantLocation: "eu-west-1",
+		},
+		{
+			desc:          "public versioned bucket",
+			region:        "us-east-1",
+			settings:      bucketSettings{versioning: true, public: true},
+			acl:           types.ObjectCannedACLPublicRead,
+			head:          http.StatusNotFound,
+			wantRequests:  []string{"HEAD", "PUT", "PUT publicAccessBlock", "PUT versioning"},
+			wantOwnership: "ObjectWriter",
+		},
+		{
+			desc:          "private bucket with ACLs",
+			region:        "eu-west-1",
+			acl:           types.ObjectCannedACLBucketOwnerFullControl,
+			head:          http.StatusNotFound,
+			wantRequests:  []string{"HEAD", "PUT"},
+			wantLocation:  "eu-west-1",
+			wantOwnership: "ObjectWriter",
+		},
+		{
+			desc:         "bucket with Object Lock",
+			region:       "eu-west-1",
+			settings:     bucketSettings{objectLock: true},
+			head:         http.StatusNotFound,
+			wantRequests: []string{"HEAD", "PUT"},
+			wantLocation: "eu-west-1",
+			wantLock:     true,
+		},
+		{
+			desc:          "bucket for grants",
+			region:        "eu-west-1",
+			settings:      bucketSettings{acls: true},
+			head:          http.StatusNotFound,
+			wantRequests:  []string{"HEAD", "PUT"},
+			wantLocation:  "eu-west-1",
+			wantOwnership: "ObjectWriter",
+		},
+		{
+			desc:         "public ACL without public access",
+			region:       "eu-west-1",
+			acl:          types.ObjectCannedACLPublicRead,
+			head:         http.StatusNotFound,
+			wantRequests: []string{"HEAD"},
+			wantErr:      true,
+		},
+		{
+			desc:         "custom endpoint",
+			region:       "eu-west-1",
+			endpoint:     "https://minio.internal:9000",
+			settings:     bucketSettings{versioning: true, public: true},
+			acl:          types.ObjectCannedACLPublicRead,
+			head:         http.StatusNotFound,
+			wantRequests: []string{"HEAD", "PUT", "PUT versioning"},
+		},
+		{
+			desc:         "created concurrently",
+			region:       "eu-west-1",
+			settings:     bucketSettings{versioning: true},
+			head:         http.StatusNotFound,
+			create:       scriptedResponse{status: http.StatusConflict, code: "BucketAlreadyOwnedByYou"},
+			wantRequests: []string{"HEAD", "PUT"},
+			wantLocation: "eu-west-1",
+		},
+		{
+			desc:         "name taken",
+			region:       "eu-west-1",
+			head:         http.StatusNotFound,
+			create:       scriptedResponse{status: http.StatusConflict, code: "BucketAlreadyExists"},
+			wantRequests: []string{"HEAD", "PUT"},
+			wantLocation: "eu-west-1",
+			wantErr:      true,
+		},
+		{
+			desc:    "access point",
+			bucket:  testAccessPoint,
+			region:  "us-west-2",
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			create := tC.create
+			if create.status == 0 {
+				create.status = http.StatusOK
+			}
+
+			server := &scriptedS3{responses: map[string]scriptedResponse{
+				http.MethodHead: {status: tC.head},
+				http.MethodPut:  create,
+			}}
+
+			client := s3.New(s3.Options{
+				Region:           tC.region,
+				Credentials:      credentials.NewStaticCredentialsProvider("key", "secret", ""),
+				HTTPClient:       server,
+				RetryMaxAttempts: 1,
+			}, func(o *s3.Options) {
+				if tC.endpoint != "" {
+					o.BaseEndpoint = aws.String(tC.endpoint)
+					o.UsePathStyle = true
+				}
+			})
+
+			bucket := tC.bucket
+			if bucket == "" {
+				bucket = "preview-42"
+			}
+
+			err := createBucket(context.Background(), client, bucket, tC.settings, tC.acl)
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			var requests []string
+			var location, ownership string
+			var locked bool
+			for i, req := range server.requests {
+				request := req.Method
+				if req.URL.RawQuery != "" {
+					request += " " + strings.TrimSuffix(req.URL.RawQuery, "=")
+				}
+
+				requests = append(requests, request)
+
+				if request == "PUT" {
+					ownership = req.Header.Get("X-Amz-Object-Ownership")
+					locked = req.Header.Get("X-Amz-Bucket-Object-Lock-Enabled") == "true"
+					if _, constraint, ok := strings.Cut(server.bodies[i], "<LocationConstraint>"); ok {
+						location, _, _ = strings.Cut(constraint, "<")
+					}
+				}
+			}
+
+			if !reflect.DeepEqual(requests, tC.wantRequests) {
+				t.Errorf("Expected requests %v; got %v", tC.wantRequests, requests)
+			}
+
+			if location != tC.wantLocation {
+				t.Errorf("Expected location constraint %q; got %q", tC.wantLocation, location)
+			}
+
+			if ownership != tC.wantOwnership {
+				t.Errorf("Expected object ownership %q; got %q", tC.wantOwnership, ownership)
+			}
+
+			if locked != tC.wantLock {
+				t.Errorf("Expected Object Lock enabled: %v; got %v", tC.wantLock, locked)
+			}
+		})
+	}
+}
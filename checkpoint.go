@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sync"
+)
+
+// defaultCheckpointPath is where `-resume` records the progress of a run by default.
+const defaultCheckpointPath = ".s3-copy-checkpoint"
+
+// reasonCompleted is the reason files uploaded by an interrupted run are skipped when resuming.
+const reasonCompleted = "completed by an interrupted run"
+
+// checkpointHeader starts a checkpoint file, so that a checkpoint is only resumed by runs to the
+// same destination.
+type checkpointHeader struct {
+	Destination string `json:"destination"`
+}
+
+// checkpointLine is a line of a checkpoint after the header: either a file that was uploaded, or
+// a multipart upload that was started.
+type checkpointLine struct {
+	deployedFile
+	Key      string `json:"key,omitempty"`
+	UploadID string `json:"upload_id,omitempty"`
+}
+
+// startedUpload is a multipart upload started by a run, recorded so that it can be resumed.
+type startedUpload struct {
+	Key      string `json:"key"`
+	Size     int64  `json:"size"`
+	UploadID string `json:"upload_id"`
+}
+
+// checkpoint records the files a run uploaded, with their hashes, in a local file. A run that was
+// interrupted can then be resumed without uploading those files again, unless they changed since.
+//
+// The file holds a line of JSON for each file, after the header. Lines are appended as soon as a
+// file was uploaded, so that a run that crashed loses at most the line it was writing. The IDs of
+// the multipart uploads of large files are recorded the same way as soon as they are started, so
+// that their stored parts aren't uploaded again either.
+type checkpoint struct {
+	path        string
+	destination string
+	// completed are the files recorded by an interrupted run, by path.
+	completed map[string]deployedFile
+	// uploads are the multipart uploads started by an interrupted run, by bucket and key.
+	uploads map[string]startedUpload
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// readCheckpoint reads the checkpoint at the given path. Files recorded for other destinations
+// are ignored, as is a checkpoint that doesn't exist.
+func readCheckpoint(path, destination string) (*checkpoint, error) {
+	c := &checkpoint{path: path, destination: destination, completed: map[string]deployedFile{}, uploads: map[string]startedUpload{}}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not read checkpoint: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return c, scanner.Err()
+	}
+
+	var header checkpointHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Destination != destination {
+		log.Printf("Ignoring the checkpoint in %s, which is for another destination\n", path)
+		return c, nil
+	}
+
+	for scanner.Scan() {
+		var line checkpointLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			// The last line is incomplete if the run crashed while writing it.
+			break
+		}
+
+		if line.UploadID != "" {
+			c.uploads[line.Key] = startedUpload{Key: line.Key, Size: line.Size, UploadID: line.UploadID}
+			continue
+		}
+
+		c.completed[line.Path] = line.deployedFile
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read checkpoint: %v", err)
+	}
+
+	return c, nil
+}
+
+// SkipCompleted changes the files of the plan that an interrupted run already uploaded to be
+// skipped, as long as their contents are the same. It returns the number of files skipped.
+func (c *checkpoint) SkipCompleted(fsys fs.FS, plan *runPlan) (int, error) {
+	var skipped int
+	for i, step := range plan.steps {
+		recorded, ok := c.completed[step.Path]
+		if !ok || step.Action != actionPut || step.entry == nil || step.Size != recorded.Size {
+			continue
+		}
+
+		current, err := hashFile(fsys, step.Path)
+		if err != nil {
+			return skipped, err
+		}
+
+		if current.SHA256 == recorded.SHA256 {
+			plan.change(i, actionSkip, reasonCompleted)
+			skipped++
+		}
+	}
+
+	return skipped, nil
+}
+
+// Start opens the checkpoint file for recording. The files recorded by an interrupted run to the
+// same destination are kept, and any other checkpoint is replaced.
+func (c *checkpoint) Start() error {
+	resumed := len(c.completed) > 0 || len(c.uploads) > 0
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if !resumed {
+		flags |= os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(c.path, flags, 0o644)
+	if err != nil {
+		return fmt.Errorf("could not write checkpoint: %v", err)
+	}
+
+	c.file = file
+	if !resumed {
+		return c.write(checkpointHeader{Destination: c.destination})
+	}
+
+	return nil
+}
+
+func (c *checkpoint) write(value any) error {
+	line, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("could not write checkpoint: %v", err)
+	}
+
+	return nil
+}
+
+// RecordFunc wraps an upload callback so that every file it uploaded successfully is recorded.
+func (c *checkpoint) RecordFunc(fsys fs.FS, upload fs.WalkDirFunc) fs.WalkDirFunc {
+	return func(path string, entry fs.DirEntry, err error) error {
+		if err := upload(path, entry, err); err != nil || entry == nil || entry.IsDir() {
+			return err
+		}
+
+		file, err := hashFile(fsys, path)
+		if err != nil {
+			return err
+		}
+
+		return c.write(file)
+	}
+}
+
+// UploadID returns the ID of the multipart upload of the object that an interrupted run started,
+// if the object has the same size.
+func (c *checkpoint) UploadID(bucket, key string, size int64) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	upload, ok := c.uploads[bucket+"/"+key]
+	if !ok || upload.Size != size {
+		return ""
+	}
+
+	return upload.UploadID
+}
+
+// Started records the ID of a multipart upload, so that a run resuming this one can continue it.
+func (c *checkpoint) Started(bucket, key string, size int64, uploadID string) error {
+	upload := startedUpload{Key: bucket + "/" + key, Size: size, UploadID: uploadID}
+
+	c.mu.Lock()
+	c.uploads[upload.Key] = upload
+	c.mu.Unlock()
+
+	return c.write(upload)
+}
+
+// Remove deletes the checkpoint once the run completed, so that the next run starts over. It is
+// safe to call on a nil checkpoint.
+func (c *checkpoint) Remove() error {
+	if c == nil {
+		return nil
+	}
+
+	if c.file != nil {
+		c.file.Close()
+	}
+
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not remove checkpoint: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// someBodyHash is the SHA-256 digest of "some body".
+const someBodyHash = "5f483264496cf1440c6ef569cc4fb9785d3bed896efdadfc998e9cb1badcec81"
+
+func Test_readCheckpoint(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		contents string
+		want     []string
+	}{
+		{desc: "no checkpoint"},
+		{
+			desc:     "same destination",
+			contents: `{"destination":"s3://my-site/"}` + "\n" + `{"path":"a.txt","size":9,"sha256":"abc"}` + "\n",
+			want:     []string{"a.txt"},
+		},
+		{
+			desc:     "incomplete last line",
+			contents: `{"destination":"s3://my-site/"}` + "\n" + `{"path":"a.txt","size":9,"sha256":"abc"}` + "\n" + `{"path":"b.t`,
+			want:     []string{"a.txt"},
+		},
+		{
+			desc:     "other destination",
+			contents: `{"destination":"s3://other/"}` + "\n" + `{"path":"a.txt","size":9,"sha256":"abc"}` + "\n",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), defaultCheckpointPath)
+			if tC.contents != "" {
+				if err := os.WriteFile(path, []byte(tC.contents), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			c, err := readCheckpoint(path, "s3://my-site/")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var got []string
+			for path := range c.completed {
+				got = append(got, path)
+			}
+
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("Expected completed files %v; got %v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_checkpoint_SkipCompleted(t *testing.T) {
+	fsys := fstest.MapFS{
+		"same.txt":    {Data: []byte("some body")},
+		"changed.txt": {Data: []byte("some BODY")},
+		"grown.txt":   {Data: []byte("some body!")},
+		"new.txt":     {Data: []byte("some body")},
+	}
+
+	c := &checkpoint{completed: map[string]deployedFile{
+		"same.txt":    {Path: "same.txt", Size: 9, SHA256: someBodyHash},
+		"changed.txt": {Path: "changed.txt", Size: 9, SHA256: someBodyHash},
+		"grown.txt":   {Path: "grown.txt", Size: 9, SHA256: someBodyHash},
+	}}
+
+	plan := &runPlan{}
+	put := plan.PutFunc(func(string) string { return reasonNotCompared })
+	for _, path := range []string{"changed.txt", "grown.txt", "new.txt", "same.txt"} {
+		info, _ := fs.Stat(fsys, path)
+		if err := put(path, fs.FileInfoToDirEntry(info), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	skipped, err := c.SkipCompleted(fsys, plan)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if skipped != 1 {
+		t.Errorf("Expected 1 file to be skipped; got %d", skipped)
+	}
+
+	if got := plan.Keys(actionSkip); !reflect.DeepEqual(got, []string{"same.txt"}) {
+		t.Errorf("Expected same.txt to be skipped; got %v", got)
+	}
+}
+
+func Test_checkpoint_RecordFunc(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt": {Data: []byte("some body")},
+		"b.txt": {Data: []byte("other body")},
+	}
+
+	path := filepath.Join(t.TempDir(), defaultCheckpointPath)
+	c, err := readCheckpoint(path, "s3://my-site/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	record := c.RecordFunc(fsys, func(path string, entry fs.DirEntry, err error) error {
+		if path == "b.txt" {
+			return errors.New("upload failed")
+		}
+
+		return err
+	})
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		info, _ := fs.Stat(fsys, name)
+		record(name, fs.FileInfoToDirEntry(info), nil)
+	}
+
+	resumed, err := readCheckpoint(path, "s3://my-site/")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := map[string]deployedFile{"a.txt": {Path: "a.txt", Size: 9, SHA256: someBodyHash}}
+	if !reflect.DeepEqual(resumed.completed, want) {
+		t.Errorf("Expected recorded files %v; got %v", want, resumed.completed)
+	}
+
+	if err := c.Remove(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected the checkpoint to be removed; got %v", err)
+	}
+}
+
+func Test_checkpoint_Started(t *testing.T) {
+	path := filepath.Join(t.TempDir(), defaultCheckpointPath)
+	c, err := readCheckpoint(path, "s3://my-site/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := c.Started("my-site", "big.bin", 42, "upload-1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	resumed, err := readCheckpoint(path, "s3://my-site/")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(resumed.completed) != 0 {
+		t.Errorf("Expected no completed files; got %v", resumed.completed)
+	}
+
+	testCases := []struct {
+		desc string
+		key  string
+		size int64
+		want string
+	}{
+		{desc: "same file", key: "big.bin", size: 42, want: "upload-1"},
+		{desc: "changed size", key: "big.bin", size: 43},
+		{desc: "other file", key: "other.bin", size: 42},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := resumed.UploadID("my-site", tC.key, tC.size); got != tC.want {
+				t.Errorf("Expected upload ID %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// checksumMD5 selects the Content-MD5 header rather than one of the additional checksums.
+const checksumMD5 = "md5"
+
+// uploadChecksum is the checksum sent with every upload, so that S3 rejects objects that were
+// corrupted in transit. The zero value leaves the choice to the SDK.
+type uploadChecksum struct {
+	md5       bool
+	algorithm types.ChecksumAlgorithm
+}
+
+// parseChecksum parses the value of the `-checksum` flag.
+func parseChecksum(value string) (uploadChecksum, error) {
+	if value == "" {
+		return uploadChecksum{}, nil
+	}
+
+	if strings.EqualFold(value, checksumMD5) {
+		return uploadChecksum{md5: true}, nil
+	}
+
+	for _, algorithm := range []types.ChecksumAlgorithm{
+		types.ChecksumAlgorithmCrc32,
+		types.ChecksumAlgorithmCrc32c,
+		types.ChecksumAlgorithmCrc64nvme,
+		types.ChecksumAlgorithmSha1,
+		types.ChecksumAlgorithmSha256,
+	} {
+		if strings.EqualFold(value, string(algorithm)) {
+			return uploadChecksum{algorithm: algorithm}, nil
+		}
+	}
+
+	return uploadChecksum{}, fmt.Errorf("unknown checksum %q; expected one of: md5, crc32, crc32c, crc64nvme, sha1, sha256", value)
+}
+
+// apply sets the checksum of an upload. The SDK computes additional checksums itself, for each
+// part of multipart uploads. The Content-MD5 header is computed here, which requires reading the
+// body before it is uploaded. The upload manager drops it from multipart uploads.
+func (c uploadChecksum) apply(input *s3.PutObjectInput) error {
+	if c.algorithm != "" {
+		input.ChecksumAlgorithm = c.algorithm
+	}
+
+	if !c.md5 {
+		return nil
+	}
+
+	// Bodies that can't be rewound can't be read twice, so they are sent without a digest.
+	body, ok := input.Body.(io.ReadSeeker)
+	if !ok {
+		return nil
+	}
+
+	digest := md5.New()
+	if _, err := io.Copy(digest, body); err != nil {
+		return fmt.Errorf("could not compute MD5 digest: %v", err)
+	}
+
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("could not rewind body after computing MD5 digest: %v", err)
+	}
+
+	input.ContentMD5 = aws.String(base64.StdEncoding.EncodeToString(digest.Sum(nil)))
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func Test_parseChecksum(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		value   string
+		want    uploadChecksum
+		wantErr bool
+	}{
+		{desc: "default", value: ""},
+		{desc: "MD5", value: "md5", want: uploadChecksum{md5: true}},
+		{desc: "CRC32C", value: "crc32c", want: uploadChecksum{algorithm: types.ChecksumAlgorithmCrc32c}},
+		{desc: "SHA-256 in upper case", value: "SHA256", want: uploadChecksum{algorithm: types.ChecksumAlgorithmSha256}},
+		{desc: "unknown", value: "sha512", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := parseChecksum(tC.value)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if got != tC.want {
+				t.Errorf("Expected %+v; got %+v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_uploadChecksum_apply(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		checksum      uploadChecksum
+		body          io.Reader
+		wantMD5       string
+		wantAlgorithm types.ChecksumAlgorithm
+	}{
+		{desc: "default", body: strings.NewReader("some body")},
+		{
+			desc:     "MD5",
+			checksum: uploadChecksum{md5: true},
+			body:     strings.NewReader("some body"),
+			wantMD5:  "Moww+uYc0RnNF3wGHRrBHw==",
+		},
+		{
+			desc:     "MD5 of unseekable body",
+			checksum: uploadChecksum{md5: true},
+			body:     io.MultiReader(strings.NewReader("some body")),
+		},
+		{
+			desc:          "additional checksum",
+			checksum:      uploadChecksum{algorithm: types.ChecksumAlgorithmCrc32c},
+			body:          strings.NewReader("some body"),
+			wantAlgorithm: types.ChecksumAlgorithmCrc32c,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			input := &s3.PutObjectInput{Body: tC.body}
+			if err := tC.checksum.apply(input); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got := aws.ToString(input.ContentMD5); got != tC.wantMD5 {
+				t.Errorf("Expected Content-MD5 %q; got %q", tC.wantMD5, got)
+			}
+
+			if input.ChecksumAlgorithm != tC.wantAlgorithm {
+				t.Errorf("Expected checksum algorithm %q; got %q", tC.wantAlgorithm, input.ChecksumAlgorithm)
+			}
+
+			body, err := io.ReadAll(input.Body)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if string(body) != "some body" {
+				t.Errorf("Expected the body to be rewound; got %q", body)
+			}
+		})
+	}
+}
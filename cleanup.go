@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// multipartLister lists incomplete multipart uploads and aborts them.
+type multipartLister interface {
+	s3.ListMultipartUploadsAPIClient
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+}
+
+// staleMultipartUploads returns the incomplete multipart uploads beneath the prefix that were
+// started before the given time.
+func staleMultipartUploads(ctx context.Context, client multipartLister, bucket, prefix string, before time.Time) ([]types.MultipartUpload, error) {
+	var stale []types.MultipartUpload
+	paginator := s3.NewListMultipartUploadsPaginator(client, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, upload := range page.Uploads {
+			if aws.ToTime(upload.Initiated).Before(before) {
+				stale = append(stale, upload)
+			}
+		}
+	}
+
+	return stale, nil
+}
+
+// abortMultipartUploads aborts the given multipart uploads, deleting their parts. It returns the
+// number of uploads aborted, and stops at the first failure.
+func abortMultipartUploads(ctx context.Context, client multipartLister, bucket string, uploads []types.MultipartUpload) (int, error) {
+	for i, upload := range uploads {
+		_, err := client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      upload.Key,
+			UploadId: upload.UploadId,
+		})
+		if err != nil {
+			return i, fmt.Errorf("failed to abort the upload of %s: %v", aws.ToString(upload.Key), err)
+		}
+
+		log.Printf("Aborted the upload of %s started %s\n", aws.ToString(upload.Key), aws.ToTime(upload.Initiated).Format(time.RFC3339))
+	}
+
+	return len(uploads), nil
+}
+
+// runCleanupMultipart implements the `cleanup-multipart` command, which aborts the incomplete
+// multipart uploads under a prefix whose parts are stored, and charged for, until then.
+func runCleanupMultipart(cmd command, args []string) {
+	var common commonFlags
+	var dryRunMode bool
+	var olderThan time.Duration
+
+	flags := newFlagSet(cmd, "[flags]")
+	common.register(flags)
+	flags.BoolVar(&dryRunMode, "dry-run", false, "Print the uploads that would be aborted without aborting them")
+	flags.DurationVar(&olderThan, "older-than", 24*time.Hour, "Only abort uploads started at least this long ago, so that running uploads and those kept for -resume are left alone")
+	flags.Parse(args)
+
+	if _, err := common.applyConfig(flags); err != nil {
+		log.Fatal(err)
+	}
+
+	if olderThan < 0 {
+		log.Fatal("The '-older-than' flag must not be negative.")
+	}
+
+	ctx, stop := newSignalContext()
+	defer stop()
+
+	client, err := common.newClient(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, bucket, prefix := parseBucketURL(common.bucket, common.prefix)
+	stale, err := staleMultipartUploads(ctx, client, bucket, prefix, time.Now().Add(-olderThan))
+	if err != nil {
+		log.Fatal("Could not list multipart uploads: ", err)
+	}
+
+	if len(stale) == 0 {
+		log.Printf("No incomplete multipart uploads under %s/%s older than %s\n", bucket, prefix, olderThan)
+		return
+	}
+
+	if dryRunMode {
+		for _, upload := range stale {
+			fmt.Printf("%s (started %s)\n", aws.ToString(upload.Key), aws.ToTime(upload.Initiated).Format(time.RFC3339))
+		}
+
+		return
+	}
+
+	aborted, err := abortMultipartUploads(ctx, client, bucket, stale)
+	if err != nil {
+		log.Fatalf("Aborted %d of %d upload(s): %v", aborted, len(stale), err)
+	}
+
+	log.Printf("Aborted %d incomplete multipart upload(s)\n", aborted)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// mockMultipartLister lists a fixed set of multipart uploads, recording the ones aborted.
+type mockMultipartLister struct {
+	uploads []types.MultipartUpload
+	aborted []string
+}
+
+func (m *mockMultipartLister) ListMultipartUploads(ctx context.Context, params *s3.ListMultipartUploadsInput, optFns ...func(*s3.Options)) (*s3.ListMultipartUploadsOutput, error) {
+	return &s3.ListMultipartUploadsOutput{Uploads: m.uploads}, nil
+}
+
+func (m *mockMultipartLister) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	m.aborted = append(m.aborted, aws.ToString(params.UploadId))
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func Test_staleMultipartUploads(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	client := &mockMultipartLister{uploads: []types.MultipartUpload{
+		{Key: aws.String("site/old.bin"), UploadId: aws.String("old"), Initiated: aws.Time(now.Add(-48 * time.Hour))},
+		{Key: aws.String("site/running.bin"), UploadId: aws.String("running"), Initiated: aws.Time(now.Add(-time.Hour))},
+	}}
+
+	stale, err := staleMultipartUploads(context.Background(), client, "my-bucket", "site/", now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(stale) != 1 || aws.ToString(stale[0].UploadId) != "old" {
+		t.Fatalf("Expected only the old upload to be stale; got %+v", stale)
+	}
+
+	aborted, err := abortMultipartUploads(context.Background(), client, "my-bucket", stale)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if aborted != 1 || !reflect.DeepEqual(client.aborted, []string{"old"}) {
+		t.Errorf("Expected the old upload to be aborted; got %v", client.aborted)
+	}
+}
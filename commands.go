@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/processcreds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// command is a subcommand of the CLI, such as `upload`.
+type command struct {
+	name    string
+	summary string
+	// run parses the command's arguments and executes it, exiting the process on failure.
+	run func(cmd command, args []string)
+}
+
+// commands lists the available subcommands, in the order they are shown in the usage.
+var commands = []command{
+	{name: "upload", summary: "Upload the files in the working directory to a bucket.", run: runUpload},
+	{name: "sync", summary: "Upload only the files that changed, optionally deleting objects that no longer exist locally.", run: runUpload},
+	{name: "put", summary: "Upload standard input or a single file to a key, e.g. a database dump piped from another command.", run: runPut},
+	{name: "fetch", summary: "Stream the contents of a list of URLs into a bucket, e.g. to mirror third-party assets.", run: runFetch},
+	{name: "download", summary: "Download the objects under a prefix to a local directory.", run: runDownload},
+	{name: "restore", summary: "Restore archived objects under a prefix from S3 Glacier storage classes.", run: runRestore},
+	{name: "copy", summary: "Copy the objects under a prefix to another bucket or prefix without downloading them.", run: runCopy},
+	{name: "ls", summary: "List the objects under a prefix.", run: runList},
+	{name: "rm", summary: "Delete the objects under a prefix.", run: runRemove},
+	{name: "diff", summary: "Compare the files in the working directory with the objects in a bucket.", run: runDiff},
+	{name: "verify", summary: "Check that every file in the working directory was uploaded intact.", run: runVerify},
+	{name: "verify-replica", summary: "Compare the objects under a prefix with those of a replica, e.g. in another region.", run: runVerifyReplica},
+	{name: "rollback", summary: "Switch the current versioned deploy to a previous version, or list the versions.", run: runRollback},
+	{name: "history", summary: "List the recorded deploys, or show the files of one of them.", run: runHistory},
+	{name: "cleanup-multipart", summary: "Abort incomplete multipart uploads under a prefix, whose parts accrue storage charges.", run: runCleanupMultipart},
+	{name: "lifecycle", summary: "Install lifecycle rules expiring the objects tagged by tag rules, e.g. 'ttl=7d'.", run: runLifecycle},
+}
+
+// findCommand returns the subcommand with the given name.
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+
+	return command{}, false
+}
+
+// printUsage writes the list of subcommands.
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: s3-copy <command> [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-17s %s\n", cmd.name, cmd.summary)
+	}
+
+	fmt.Fprintf(w, "\nRun 's3-copy <command> -h' for the flags of a command.\n")
+}
+
+// newFlagSet creates the flag set of a subcommand, with a usage message describing it.
+func newFlagSet(cmd command, arguments string) *flag.FlagSet {
+	flags := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: s3-copy %s %s\n\n%s\n\nFlags:\n", cmd.name, arguments, cmd.summary)
+		flags.PrintDefaults()
+	}
+
+	return flags
+}
+
+// parseInterspersed parses flags given before, between, and after the arguments, so that flags
+// can follow an argument, as in `upload 'build/*.tar.gz' -key releases/{name}`, and returns the
+// arguments. Everything following `--` is an argument.
+func parseInterspersed(flags *flag.FlagSet, args []string) []string {
+	var arguments []string
+	for {
+		flags.Parse(args)
+		rest := flags.Args()
+		if len(rest) == 0 {
+			return arguments
+		}
+
+		// Parse stops at `--` after consuming it, which leaves the rest as arguments.
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(arguments, rest...)
+		}
+
+		arguments = append(arguments, rest[0])
+		args = rest[1:]
+	}
+}
+
+// defaultRegion is the AWS region used if none is given.
+const defaultRegion = "us-east-1"
+
+// commonFlags are the flags shared by every command that accesses a bucket.
+type commonFlags struct {
+	accountID  string
+	bucket     string
+	configPath string
+	// credentialProcess is a command printing the credentials to use, instead of the default
+	// chain's.
+	credentialProcess string
+	endpoint          string
+	env               string
+	prefix            string
+	profile           string
+	provider          string
+	region            string
+
+	// dev targets a local MinIO server instead of the configured endpoint.
+	dev bool
+	// pathStyle addresses buckets in the path of the URL instead of the host name.
+	pathStyle bool
+	// preset is the S3-compatible service selected by `-provider`, if any.
+	preset providerPreset
+	// role is the IAM role to assume for accessing the bucket, if any.
+	role roleSettings
+	// network configures the proxy and TLS settings of connections to S3.
+	network networkSettings
+	// endpoints selects the FIPS, dual-stack, or accelerate variants of the AWS endpoints.
+	endpoints endpointSettings
+	// requestPayer is sent with every request to access Requester Pays buckets, if set.
+	requestPayer string
+	// requestRate is the number of requests per second given with `-rps`, and requests the
+	// limiter enforcing it, if any. Copies of the flags share the limiter.
+	requestRate float64
+	requests    *requestLimiter
+
+	// sshKey and sshKnownHosts configure the connection to SFTP servers.
+	sshKey        string
+	sshKnownHosts string
+}
+
+// register adds the common flags to a command's flag set.
+func (c *commonFlags) register(flags *flag.FlagSet) {
+	flags.BoolVar(&c.endpoints.accelerate, "accelerate", false, "Use the bucket's S3 Transfer Acceleration endpoint, e.g. for uploads from far-away CI runners")
+	flags.StringVar(&c.accountID, "account-id", "", "Account ID for providers whose endpoint includes it, such as Cloudflare R2")
+	flags.StringVar(&c.bucket, "bucket", "", "Bucket name, or the ARN of an S3 access point or Multi-Region Access Point")
+	flags.StringVar(&c.network.caBundle, "ca-bundle", "", "PEM file of certificate authorities to trust instead of the system's, e.g. for endpoints with self-signed certificates")
+	flags.StringVar(&c.network.clientCert, "client-cert", "", "PEM certificate file to authenticate to the endpoint with mutual TLS (requires -client-key)")
+	flags.StringVar(&c.network.clientKey, "client-key", "", "PEM private key file of the certificate given with -client-cert")
+	flags.StringVar(&c.configPath, "config", defaultConfigPath, "YAML file with default settings and per-path rules; flags take precedence over its values")
+	flags.StringVar(&c.credentialProcess, "credential-process", "", "Command printing AWS credentials as JSON, like 'credential_process' in the AWS config files, e.g. to get them from Vault or 1Password")
+	flags.BoolVar(&c.dev, "dev", false, "Use a local MinIO server at S3COPY_DEV_ENDPOINT or http://localhost:9000 instead, starting it with Docker and creating the bucket if needed")
+	flags.BoolVar(&c.endpoints.dualStack, "dualstack", false, "Use the dual-stack AWS endpoints, which are also reachable over IPv6")
+	flags.StringVar(&c.endpoint, "endpoint", "", "AWS endpoint")
+	flags.StringVar(&c.env, "env", "", "Named environment from the config file to deploy to")
+	flags.StringVar(&c.role.externalID, "external-id", "", "External ID to pass when assuming the role given with -role-arn, as required by roles in other accounts")
+	flags.BoolVar(&c.endpoints.fips, "fips", false, "Use the FIPS AWS endpoints, as required in GovCloud and other compliance environments")
+	flags.BoolVar(&c.pathStyle, "force-path-style", false, "Address buckets in the path of the URL instead of the host name, as MinIO and other self-hosted endpoints require")
+	flags.BoolVar(&c.role.githubOIDC, "github-oidc", false, "Assume the role given with -role-arn with the OIDC token of the GitHub Actions job, which needs the 'id-token: write' permission")
+	flags.StringVar(&c.prefix, "prefix", "", "Key prefix of the objects in the bucket, e.g. 'site/'")
+	flags.StringVar(&c.profile, "profile", "", "Named profile from the shared AWS config files to use for credentials")
+	flags.StringVar(&c.network.proxy, "proxy", "", "URL of an HTTP(S) or SOCKS5 proxy to connect to S3 through, instead of the one in HTTPS_PROXY")
+	flags.StringVar(&c.provider, "provider", "", "S3-compatible service to configure the endpoint and supported features for: 'b2', 'r2', or 'spaces'")
+	flags.StringVar(&c.region, "region", defaultRegion, "AWS region")
+	flags.StringVar(&c.requestPayer, "request-payer", "", "Set to 'requester' to access Requester Pays buckets, paying for the requests and data transfer")
+	flags.StringVar(&c.role.arn, "role-arn", "", "ARN of an IAM role to assume with STS before accessing the bucket, e.g. to deploy into another account")
+	flags.Float64Var(&c.requestRate, "rps", 0, "Maximum number of requests per second to send to S3, including listing, reading, and uploading objects, for providers and proxies that throttle on the number of requests")
+	flags.StringVar(&c.role.sessionName, "session-name", "", "Session name of the assumed role, as recorded in CloudTrail (default \"s3-copy\")")
+	flags.Var(&c.role.tagPairs, "session-tag", "Session tag to pass when assuming the role, as '<key>=<value>' (repeatable)")
+	flags.StringVar(&c.sshKey, "ssh-key", "", "Private key file to authenticate to sftp:// servers with, instead of ssh-agent")
+	flags.StringVar(&c.sshKnownHosts, "ssh-known-hosts", "", "known_hosts file to verify the host keys of sftp:// servers against, instead of ~/.ssh/known_hosts")
+	flags.StringVar(&c.network.tlsMinVersion, "tls-min-version", "", "Minimum TLS version to connect with: '1.2' or '1.3'")
+	flags.StringVar(&c.role.tokenFile, "web-identity-token-file", "", "File containing an OIDC token to assume the role given with -role-arn with, instead of the default credentials")
+}
+
+// applyConfig reads the config file and uses its values for the flags that weren't given on the
+// command line. Settings for flags the command doesn't have are ignored.
+func (c *commonFlags) applyConfig(flags *flag.FlagSet) (*configFile, error) {
+	explicit := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	settings, err := loadConfig(c.configPath, explicit["config"])
+	if err != nil {
+		return nil, err
+	}
+
+	if c.env != "" {
+		if err := settings.selectEnvironment(c.env); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, setting := range settings.flagValues() {
+		if explicit[setting.name] || flags.Lookup(setting.name) == nil {
+			continue
+		}
+
+		if err := flags.Set(setting.name, setting.value); err != nil {
+			return nil, fmt.Errorf("invalid %s in config file: %v", setting.name, err)
+		}
+	}
+
+	if err := c.applyDev(); err != nil {
+		return nil, err
+	}
+
+	if err := c.applyProvider(flagGiven(flags, "region")); err != nil {
+		return nil, err
+	}
+
+	if err := c.applyAccessPoint(); err != nil {
+		return nil, err
+	}
+
+	if err := c.applyEndpoints(); err != nil {
+		return nil, err
+	}
+
+	if err := c.applyRequestPayer(); err != nil {
+		return nil, err
+	}
+
+	if err := c.applyRequestRate(); err != nil {
+		return nil, err
+	}
+
+	if err := c.applyRole(); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// newClient creates an S3 client for the configured region and endpoint.
+func (c *commonFlags) newClient(ctx context.Context) (*s3.Client, error) {
+	configOptions := []func(*config.LoadOptions) error{
+		config.WithRegion(c.region),
+		config.WithCredentialsCacheOptions(refreshEarly),
+	}
+	if c.profile != "" {
+		configOptions = append(configOptions, config.WithSharedConfigProfile(c.profile))
+	}
+
+	if c.credentialProcess != "" {
+		configOptions = append(configOptions, config.WithCredentialsProvider(processcreds.NewProvider(c.credentialProcess)))
+	}
+
+	networkOptions, err := c.network.configOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	configOptions = append(configOptions, networkOptions...)
+	configOptions = append(configOptions, c.endpoints.configOptions()...)
+
+	if c.dev {
+		user, password := devCredentials()
+		configOptions = append(configOptions, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(user, password, "")))
+	}
+
+	if c.endpoint != "" {
+		// Many S3-compatible services reject the checksum headers the SDK sends by default, so
+		// they're only sent to custom endpoints when an operation requires them.
+		configOptions = append(
+			configOptions,
+			config.WithRequestChecksumCalculation(aws.RequestChecksumCalculationWhenRequired),
+			config.WithResponseChecksumValidation(aws.ResponseChecksumValidationWhenRequired),
+		)
+	}
+
+	// Credentials are resolved using the default AWS chain: environment variables, the shared
+	// credentials and config files (including SSO), and finally ECS task or EC2 instance roles.
+	awsConfig, err := config.LoadDefaultConfig(ctx, configOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("could not load AWS configuration: %v", err)
+	}
+
+	if c.role.arn != "" {
+		c.role.assumeRole(&awsConfig)
+	}
+
+	if err := checkCredentials(ctx, awsConfig.Credentials, c.profile); err != nil {
+		return nil, err
+	}
+
+	client := s3.NewFromConfig(awsConfig, func(o *s3.Options) {
+		if c.endpoint != "" {
+			o.BaseEndpoint = aws.String(normalizeEndpoint(c.endpoint))
+		}
+
+		o.UsePathStyle = c.pathStyle
+		o.UseAccelerate = c.endpoints.accelerate
+		// Access points given as ARNs are reached in their own region, which may differ from
+		// `-region`.
+		o.UseARNRegion = true
+
+		if c.requestPayer != "" {
+			o.APIOptions = append(o.APIOptions, withRequestPayer(c.requestPayer))
+		}
+
+		if c.requests != nil {
+			o.APIOptions = append(o.APIOptions, withRequestLimit(c.requests))
+		}
+	})
+
+	if c.endpoints.accelerate {
+		_, bucket, _ := parseBucketURL(c.bucket, "")
+		if err := checkAccelerate(ctx, client, bucket); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.dev {
+		if err := c.prepareDev(ctx, client); err != nil {
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
+
+// newSignalContext returns a context that is cancelled on SIGINT or SIGTERM. Once cancelled, the
+// default signal behaviour is restored so that a second interrupt exits immediately.
+func newSignalContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	return ctx, stop
+}
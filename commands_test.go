@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func Test_commonFlags_applyConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "s3copy.yaml")
+	os.WriteFile(configPath, []byte(`
+bucket: file-bucket
+region: eu-west-1
+exclude:
+  - "*.map"
+environments:
+  production:
+    bucket: production-bucket
+`), 0o644)
+
+	testCases := []struct {
+		desc        string
+		args        []string
+		wantBucket  string
+		wantRegion  string
+		wantExclude int
+		wantErr     bool
+	}{
+		{
+			desc:        "values from file",
+			args:        []string{"-config", configPath},
+			wantBucket:  "file-bucket",
+			wantRegion:  "eu-west-1",
+			wantExclude: 1,
+		},
+		{
+			desc:        "flags take precedence",
+			args:        []string{"-config", configPath, "-bucket", "flag-bucket", "-exclude", "*.txt", "-exclude", "*.md"},
+			wantBucket:  "flag-bucket",
+			wantRegion:  "eu-west-1",
+			wantExclude: 2,
+		},
+		{
+			desc:        "environment",
+			args:        []string{"-config", configPath, "-env", "production"},
+			wantBucket:  "production-bucket",
+			wantRegion:  "eu-west-1",
+			wantExclude: 1,
+		},
+		{
+			desc:    "unknown environment",
+			args:    []string{"-config", configPath, "-env", "qa"},
+			wantErr: true,
+		},
+		{
+			desc:    "missing explicit config",
+			args:    []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")},
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var common commonFlags
+			var exclude stringList
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+			common.register(flags)
+			flags.Var(&exclude, "exclude", "")
+			if err := flags.Parse(tC.args); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			_, err := common.applyConfig(flags)
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if common.bucket != tC.wantBucket {
+				t.Errorf("Expected bucket %q; got %q", tC.wantBucket, common.bucket)
+			}
+
+			if common.region != tC.wantRegion {
+				t.Errorf("Expected region %q; got %q", tC.wantRegion, common.region)
+			}
+
+			if len(exclude) != tC.wantExclude {
+				t.Errorf("Expected %d exclude patterns; got %v", tC.wantExclude, exclude)
+			}
+		})
+	}
+}
+
+func Test_commonFlags_newClient_credentialProcess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The credential processes are shell scripts")
+	}
+
+	// The shared config files mustn't provide other credentials.
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+
+	testCases := []struct {
+		desc    string
+		command string
+		wantErr bool
+	}{
+		{
+			desc:    "credentials",
+			command: `echo '{"Version": 1, "AccessKeyId": "AKIDEXAMPLE", "SecretAccessKey": "secret", "SessionToken": "token", "Expiration": "2999-01-01T00:00:00Z"}'`,
+		},
+		{desc: "failing command", command: "echo 'vault: permission denied' >&2; exit 1", wantErr: true},
+		{desc: "invalid output", command: "echo 'not json'", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			common := commonFlags{region: "us-east-1", credentialProcess: tC.command}
+
+			_, err := common.newClient(context.Background())
+			if (err == nil) == tC.wantErr {
+				t.Errorf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_parseInterspersed(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		args     []string
+		wantArgs []string
+		wantKey  string
+	}{
+		{desc: "flags first", args: []string{"-key", "releases/{name}", "app.tar.gz"}, wantArgs: []string{"app.tar.gz"}, wantKey: "releases/{name}"},
+		{desc: "flags after arguments", args: []string{"build/*.tar.gz", "-key", "releases/{name}", "CHANGELOG.md"}, wantArgs: []string{"build/*.tar.gz", "CHANGELOG.md"}, wantKey: "releases/{name}"},
+		{desc: "after terminator", args: []string{"app.tar.gz", "--", "-key"}, wantArgs: []string{"app.tar.gz", "-key"}},
+		{desc: "no arguments", args: []string{"-key", "latest"}, wantKey: "latest"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var key string
+			flags := flag.NewFlagSet("upload", flag.ContinueOnError)
+			flags.StringVar(&key, "key", "", "")
+
+			got := parseInterspersed(flags, tC.args)
+			if !reflect.DeepEqual(got, tC.wantArgs) {
+				t.Errorf("Expected arguments %v; got %v", tC.wantArgs, got)
+			}
+
+			if key != tC.wantKey {
+				t.Errorf("Expected key %q; got %q", tC.wantKey, key)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// compareMode is how -sync decides whether a file matches its existing object, trading accuracy
+// against the cost of reading files and objects.
+type compareMode string
+
+const (
+	// compareETag compares the size and the MD5-based ETag S3 computes, which means hashing
+	// every file whose size matches.
+	compareETag compareMode = "etag"
+	// compareSize only compares the size.
+	compareSize compareMode = "size"
+	// compareMtime compares the size and whether the file was modified after its object was
+	// uploaded, without reading the file.
+	compareMtime compareMode = "mtime"
+	// compareChecksum compares the SHA-256 digest of the file with the one stored in the
+	// metadata of its object, which doesn't depend on encryption or how the object was split into
+	// parts.
+	compareChecksum compareMode = "checksum"
+)
+
+// checksumMetadataHeader stores the SHA-256 digest of the file an object was uploaded from, for
+// '-compare checksum'.
+const checksumMetadataHeader = "X-Amz-Meta-S3copy-Sha256"
+
+// parseCompareMode validates the mode given to -compare.
+func parseCompareMode(value string) (compareMode, error) {
+	switch mode := compareMode(strings.ToLower(value)); mode {
+	case compareETag, compareSize, compareMtime, compareChecksum:
+		return mode, nil
+	}
+
+	return "", fmt.Errorf("unknown comparison %q; expected 'etag', 'size', 'mtime', or 'checksum'", value)
+}
+
+// A fileComparison reports whether the local file at `path` matches an existing remote object.
+type fileComparison func(path string, entry fs.DirEntry, existing remoteObject) (bool, error)
+
+// newFileComparison returns the comparison for a mode. Files matched by the compressor are
+// compared in their compressed form where their size is compared, as that is what would be
+// uploaded. The hash cache is only used by the ETag comparison, and the client only by the
+// checksum comparison, which reads the digests stored with objects.
+func newFileComparison(ctx context.Context, mode compareMode, fsys fs.FS, comp *compressor, hashes *hashCache, client objectHeader) fileComparison {
+	switch mode {
+	case compareSize:
+		return func(path string, entry fs.DirEntry, existing remoteObject) (bool, error) {
+			size, err := uploadSize(fsys, path, entry, comp)
+			if err != nil {
+				return false, err
+			}
+
+			return size == existing.Size, nil
+		}
+	case compareMtime:
+		return func(path string, entry fs.DirEntry, existing remoteObject) (bool, error) {
+			info, err := entry.Info()
+			if err != nil {
+				return false, fmt.Errorf("could not stat %s: %v", path, err)
+			}
+
+			// The compressed size isn't known without compressing the file.
+			if !comp.Match(path) && info.Size() != existing.Size {
+				return false, nil
+			}
+
+			return !info.ModTime().After(existing.LastModified), nil
+		}
+	case compareChecksum:
+		return func(path string, entry fs.DirEntry, existing remoteObject) (bool, error) {
+			head, err := client.Head(ctx, existing.Key)
+			if err != nil {
+				return false, fmt.Errorf("could not read the checksum of %s: %v", existing.Key, err)
+			}
+
+			stored, ok := lowerKeys(head.Metadata)["s3copy-sha256"]
+			if !ok {
+				return false, nil
+			}
+
+			digest, err := fileDigest(fsys, path)
+			if err != nil {
+				return false, err
+			}
+
+			return digest == stored, nil
+		}
+	}
+
+	return func(path string, entry fs.DirEntry, existing remoteObject) (bool, error) {
+		return isUnchanged(fsys, path, entry, existing, comp, hashes)
+	}
+}
+
+// uploadSize returns the size the file at `path` is uploaded with, compressing it first if it's
+// matched by the compressor.
+func uploadSize(fsys fs.FS, path string, entry fs.DirEntry, comp *compressor) (int64, error) {
+	if !comp.Match(path) {
+		info, err := entry.Info()
+		if err != nil {
+			return 0, fmt.Errorf("could not stat %s: %v", path, err)
+		}
+
+		return info.Size(), nil
+	}
+
+	file, err := fsys.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("could not open %s for reading: %v", path, err)
+	}
+	defer file.Close()
+
+	compressed, err := comp.Encode(file)
+	if err != nil {
+		return 0, fmt.Errorf("could not compress %s: %v", path, err)
+	}
+
+	return compressed.Size(), nil
+}
+
+// fileDigest returns the hex-encoded SHA-256 digest of the file at `path`.
+func fileDigest(fsys fs.FS, path string) (string, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("could not open %s for reading: %v", path, err)
+	}
+	defer file.Close()
+
+	digest := sha256.New()
+	if _, err := io.Copy(digest, file); err != nil {
+		return "", fmt.Errorf("could not hash %s: %v", path, err)
+	}
+
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+// checksumUploader stores the SHA-256 digest of every file in the metadata of its objects, for
+// '-compare checksum' to compare them with.
+type checksumUploader struct {
+	next uploader
+}
+
+func (u *checksumUploader) Upload(ctx context.Context, object *uploadObject) error {
+	body, ok := object.Body.(io.ReadSeeker)
+	if !ok {
+		return u.next.Upload(ctx, object)
+	}
+
+	digest := sha256.New()
+	if _, err := io.Copy(digest, body); err != nil {
+		return fmt.Errorf("could not hash %s: %v", object.Path, err)
+	}
+
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("could not hash %s: %v", object.Path, err)
+	}
+
+	if object.Headers == nil {
+		object.Headers = map[string]string{}
+	}
+
+	object.Headers[checksumMetadataHeader] = hex.EncodeToString(digest.Sum(nil))
+
+	return u.next.Upload(ctx, object)
+}
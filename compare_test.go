@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func Test_parseCompareMode(t *testing.T) {
+	testCases := []struct {
+		value   string
+		want    compareMode
+		wantErr bool
+	}{
+		{value: "etag", want: compareETag},
+		{value: "size", want: compareSize},
+		{value: "MTIME", want: compareMtime},
+		{value: "checksum", want: compareChecksum},
+		{value: "", wantErr: true},
+		{value: "md5", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.value, func(t *testing.T) {
+			got, err := parseCompareMode(tC.value)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if got != tC.want {
+				t.Errorf("Expected mode %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_newFileComparison(t *testing.T) {
+	uploaded := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	digest := fmt.Sprintf("%x", sha256.Sum256([]byte("some body")))
+	fsys := fstest.MapFS{
+		"old.txt": {Data: []byte("some body"), ModTime: uploaded.Add(-time.Hour)},
+		"new.txt": {Data: []byte("some body"), ModTime: uploaded.Add(time.Hour)},
+	}
+	client := &mockHeader{objects: map[string]objectHead{
+		"old.txt":     {Metadata: map[string]string{"s3copy-sha256": digest}},
+		"new.txt":     {Metadata: map[string]string{"s3copy-sha256": "0000"}},
+		"missing.txt": {},
+	}}
+
+	testCases := []struct {
+		desc     string
+		mode     compareMode
+		path     string
+		existing remoteObject
+		want     bool
+	}{
+		{desc: "etag matches", mode: compareETag, path: "new.txt", existing: remoteObject{Key: "new.txt", Size: 9, ETag: "328c30fae61cd119cd177c061d1ac11f"}, want: true},
+		{desc: "etag differs", mode: compareETag, path: "new.txt", existing: remoteObject{Key: "new.txt", Size: 9, ETag: "d41d8cd98f00b204e9800998ecf8427e"}},
+		{desc: "size matches", mode: compareSize, path: "new.txt", existing: remoteObject{Key: "new.txt", Size: 9, ETag: "d41d8cd98f00b204e9800998ecf8427e"}, want: true},
+		{desc: "size differs", mode: compareSize, path: "new.txt", existing: remoteObject{Key: "new.txt", Size: 4}},
+		{desc: "not modified since upload", mode: compareMtime, path: "old.txt", existing: remoteObject{Key: "old.txt", Size: 9, LastModified: uploaded}, want: true},
+		{desc: "modified since upload", mode: compareMtime, path: "new.txt", existing: remoteObject{Key: "new.txt", Size: 9, LastModified: uploaded}},
+		{desc: "not modified but size differs", mode: compareMtime, path: "old.txt", existing: remoteObject{Key: "old.txt", Size: 4, LastModified: uploaded}},
+		{desc: "checksum matches", mode: compareChecksum, path: "old.txt", existing: remoteObject{Key: "old.txt"}, want: true},
+		{desc: "checksum differs", mode: compareChecksum, path: "new.txt", existing: remoteObject{Key: "new.txt"}},
+		{desc: "no stored checksum", mode: compareChecksum, path: "old.txt", existing: remoteObject{Key: "missing.txt"}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			info, err := fs.Stat(fsys, tC.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			compare := newFileComparison(context.Background(), tC.mode, fsys, nil, nil, client)
+			got, err := compare(tC.path, fs.FileInfoToDirEntry(info), tC.existing)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got != tC.want {
+				t.Errorf("Expected unchanged %v; got %v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_newFileComparison_compressed(t *testing.T) {
+	comp, _ := newCompressor([]string{"*.txt"})
+	compressed, _ := compress(strings.NewReader("some body"))
+	fsys := fstest.MapFS{"foo.txt": {Data: []byte("some body")}}
+	info, _ := fs.Stat(fsys, "foo.txt")
+
+	// The size of compressed files is that of their compressed form.
+	compare := newFileComparison(context.Background(), compareSize, fsys, comp, nil, nil)
+	unchanged, err := compare("foo.txt", fs.FileInfoToDirEntry(info), remoteObject{Key: "foo.txt", Size: compressed.Size()})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !unchanged {
+		t.Error("Expected the compressed file to match the size of its object")
+	}
+}
+
+func Test_newFileComparison_headError(t *testing.T) {
+	fsys := fstest.MapFS{"foo.txt": {Data: []byte("some body")}}
+	info, _ := fs.Stat(fsys, "foo.txt")
+
+	compare := newFileComparison(context.Background(), compareChecksum, fsys, nil, nil, &mockHeader{})
+	if _, err := compare("foo.txt", fs.FileInfoToDirEntry(info), remoteObject{Key: "foo.txt"}); err == nil {
+		t.Error("Expected an error for an object that can't be read")
+	}
+}
+
+func Test_checksumUploader(t *testing.T) {
+	client := &recordingUploader{}
+	u := &checksumUploader{next: client}
+	if err := u.Upload(context.Background(), &uploadObject{Path: "foo.txt", Body: strings.NewReader("some body")}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if want := fmt.Sprintf("%x", sha256.Sum256([]byte("some body"))); client.objects[0].Headers[checksumMetadataHeader] != want {
+		t.Errorf("Expected digest %q; got %q", want, client.objects[0].Headers[checksumMetadataHeader])
+	}
+
+	if client.bodies[0] != "some body" {
+		t.Errorf("Expected the full body to be uploaded after hashing; got %q", client.bodies[0])
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// compressedExtensions lists the extensions of formats that are already compressed, which gain
+// nothing from being compressed again.
+var compressedExtensions = map[string]bool{
+	".7z":    true,
+	".avif":  true,
+	".br":    true,
+	".bz2":   true,
+	".gif":   true,
+	".gz":    true,
+	".jpeg":  true,
+	".jpg":   true,
+	".mp3":   true,
+	".mp4":   true,
+	".png":   true,
+	".webm":  true,
+	".webp":  true,
+	".woff":  true,
+	".woff2": true,
+	".xz":    true,
+	".zip":   true,
+	".zst":   true,
+}
+
+// compressor decides which files are gzip compressed before they're uploaded.
+type compressor struct {
+	patterns []string
+}
+
+// newCompressor creates a compressor for files matching any of the given glob patterns. Each
+// pattern may itself be a comma-separated list, e.g. `*.js,*.css`. If no patterns are given, nil
+// is returned and no files are compressed.
+func newCompressor(patterns []string) (*compressor, error) {
+	split := splitPatterns(patterns)
+	if len(split) == 0 {
+		return nil, nil
+	}
+
+	if _, err := newPathFilter(split, nil); err != nil {
+		return nil, fmt.Errorf("invalid gzip pattern: %v", err)
+	}
+
+	return &compressor{patterns: split}, nil
+}
+
+// Match reports whether the file at the given path should be compressed. It is safe to call on a
+// nil compressor.
+func (c *compressor) Match(name string) bool {
+	if c == nil || compressedExtensions[strings.ToLower(path.Ext(name))] {
+		return false
+	}
+
+	return matchAny(c.patterns, filepath.ToSlash(name))
+}
+
+// compress gzips the contents of `r`. The gzip header is left empty so that compressing the same
+
+// Encode compresses the contents of a file matched by the compressor, so that the compressor can
+// be used to compare files with remote objects.
+func (c *compressor) Encode(r io.Reader) (*bytes.Reader, error) {
+	return compress(r)
+}
+
+// contents always produces the same bytes, which keeps the ETags of compressed objects stable.
+func compress(r io.Reader) (*bytes.Reader, error) {
+	var buf bytes.Buffer
+	writer, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(writer, r); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(buf.Bytes()), nil
+}
+
+// gzipUploader compresses the bodies of matching objects and marks them with a
+// `Content-Encoding: gzip` header before passing them on to another uploader. Objects that
+// already have a Content-Encoding are passed on unchanged.
+type gzipUploader struct {
+	compressor *compressor
+	next       uploader
+}
+
+func (u *gzipUploader) Upload(ctx context.Context, object *uploadObject) error {
+	if _, ok := object.Headers["Content-Encoding"]; ok || !u.compressor.Match(object.Path) {
+		return u.next.Upload(ctx, object)
+	}
+
+	// The compressed body is buffered in memory so that it can be rewound if the upload is
+	// retried.
+	body, err := compress(object.Body)
+	if err != nil {
+		return fmt.Errorf("failed to compress %s: %v", object.Path, err)
+	}
+
+	if object.Headers == nil {
+		object.Headers = map[string]string{}
+	}
+
+	object.Body = body
+	object.Headers["Content-Encoding"] = "gzip"
+
+	return u.next.Upload(ctx, object)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	syncplan "github.com/Zeroed-Books/s3-copy/pkg/sync"
+)
+
+func Test_compressor_Match(t *testing.T) {
+	comp, err := newCompressor([]string{"*.js,*.css", "*.png", "docs/**"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	testCases := []struct {
+		desc string
+		comp *compressor
+		path string
+		want bool
+	}{
+		{desc: "matching extension", comp: comp, path: "js/app.js", want: true},
+		{desc: "second pattern in list", comp: comp, path: "style.css", want: true},
+		{desc: "path pattern", comp: comp, path: "docs/index.html", want: true},
+		{desc: "not matching", comp: comp, path: "index.html", want: false},
+		{desc: "already compressed", comp: comp, path: "logo.png", want: false},
+		{desc: "already compressed in matching directory", comp: comp, path: "docs/archive.GZ", want: false},
+		{desc: "nil compressor", comp: nil, path: "js/app.js", want: false},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := tC.comp.Match(tC.path); got != tC.want {
+				t.Errorf("Expected match %v; got %v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_newCompressor(t *testing.T) {
+	comp, err := newCompressor([]string{" , "})
+	if err != nil || comp != nil {
+		t.Errorf("Expected no compressor for empty patterns; got %v, %v", comp, err)
+	}
+
+	if _, err := newCompressor([]string{"[*.js"}); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+}
+
+func Test_gzipUploader(t *testing.T) {
+	comp, _ := newCompressor([]string{"*.js"})
+
+	testCases := []struct {
+		desc         string
+		object       uploadObject
+		wantEncoding string
+	}{
+		{
+			desc:         "matching file",
+			object:       uploadObject{Path: "app.js", Body: strings.NewReader("console.log('hi')")},
+			wantEncoding: "gzip",
+		},
+		{
+			desc:   "other file",
+			object: uploadObject{Path: "index.html", Body: strings.NewReader("console.log('hi')")},
+		},
+		{
+			desc: "already encoded",
+			object: uploadObject{
+				Path:    "app.js",
+				Body:    strings.NewReader("console.log('hi')"),
+				Headers: map[string]string{"Content-Encoding": "identity"},
+			},
+			wantEncoding: "identity",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			next := &mockUploader{}
+			u := &gzipUploader{compressor: comp, next: next}
+			if err := u.Upload(context.Background(), &tC.object); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got := next.uploadedObject.Headers["Content-Encoding"]; got != tC.wantEncoding {
+				t.Errorf("Expected Content-Encoding %q; got %q", tC.wantEncoding, got)
+			}
+
+			body := next.uploadedObject.Body
+			if tC.wantEncoding == "gzip" {
+				reader, err := gzip.NewReader(body)
+				if err != nil {
+					t.Fatalf("Expected a gzip body: %v", err)
+				}
+
+				body = reader
+			}
+
+			contents, _ := io.ReadAll(body)
+			if string(contents) != "console.log('hi')" {
+				t.Errorf("Expected body %q; got %q", "console.log('hi')", contents)
+			}
+		})
+	}
+}
+
+func Test_compress_deterministic(t *testing.T) {
+	first, _ := compress(strings.NewReader("some body"))
+	second, _ := compress(strings.NewReader("some body"))
+
+	firstETag, _ := syncplan.LocalETag(first, 0)
+	secondETag, _ := syncplan.LocalETag(second, 0)
+	if firstETag != secondETag {
+		t.Errorf("Expected compressing the same body twice to produce the same ETag; got %q and %q", firstETag, secondETag)
+	}
+}
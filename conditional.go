@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"maps"
+	"strings"
+	"time"
+
+	syncplan "github.com/Zeroed-Books/s3-copy/pkg/sync"
+)
+
+// conditionalUploader reads every object before uploading it, skips objects that already match,
+// and makes the upload conditional on the object not having changed in between, so that two runs
+// racing each other fail instead of overwriting each other's objects. Skipped objects are
+// reported with errObjectSkipped.
+type conditionalUploader struct {
+	client objectHeader
+	// checkETag is unset for objects whose ETag isn't the MD5 digest of their contents, which
+	// can't be compared with the body.
+	checkETag bool
+	// keepNewer keeps objects modified after this time, e.g. the start of the run, instead of
+	// overwriting them. If zero, objects are overwritten regardless of when they were modified.
+	keepNewer time.Time
+	next      uploader
+}
+
+func (u *conditionalUploader) Upload(ctx context.Context, object *uploadObject) error {
+	head, err := u.client.Head(ctx, object.Path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not read %s before uploading it: %v", object.Path, err)
+	}
+
+	// The headers may be shared between uploads, e.g. those of website aliases, so they're
+	// copied before being modified.
+	headers := maps.Clone(object.Headers)
+	if headers == nil {
+		headers = map[string]string{}
+	}
+
+	if err != nil {
+		headers["If-None-Match"] = "*"
+	} else {
+		if !u.keepNewer.IsZero() && head.LastModified.After(u.keepNewer) {
+			log.Printf("Kept %s: the object was modified after the run started\n", object.Path)
+			return errObjectSkipped
+		}
+
+		if body, ok := object.Body.(io.ReadSeeker); ok && u.checkETag {
+			matches, err := matchesObject(body, head)
+			if err != nil {
+				return fmt.Errorf("could not hash %s: %v", object.Path, err)
+			}
+
+			if matches {
+				return errObjectSkipped
+			}
+		}
+
+		headers["If-Match"] = `"` + head.ETag + `"`
+	}
+
+	conditional := *object
+	conditional.Headers = headers
+
+	err = u.next.Upload(ctx, &conditional)
+	if isPreconditionFailed(err) {
+		return fmt.Errorf("%s was changed by another upload while uploading it", object.Path)
+	}
+
+	return err
+}
+
+// matchesObject reports whether a body has the contents of an existing object, by comparing the
+// ETag S3 would compute for it, and rewinds the body afterwards.
+func matchesObject(body io.ReadSeeker, head objectHead) (bool, error) {
+	size, ok := bodySize(body)
+	if !ok || size != head.Size {
+		return false, nil
+	}
+
+	// Objects uploaded in multiple parts have an ETag of the form `<digest>-<part count>`.
+	var partSize int64
+	if strings.Contains(head.ETag, "-") {
+		partSize = syncplan.ETagPartSize(remoteObject{Size: head.Size, ETag: head.ETag})
+	}
+
+	etag, err := syncplan.LocalETag(body, partSize)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+
+	return etag == head.ETag, nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/aws/smithy-go"
+)
+
+func Test_conditionalUploader(t *testing.T) {
+	started := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// "some body" has the MD5 digest 328c30fae61cd119cd177c061d1ac11f.
+	matching := objectHead{Size: 9, ETag: "328c30fae61cd119cd177c061d1ac11f", LastModified: started.Add(-time.Hour)}
+	changed := objectHead{Size: 9, ETag: "d41d8cd98f00b204e9800998ecf8427e", LastModified: started.Add(-time.Hour)}
+	newer := objectHead{Size: 9, ETag: "d41d8cd98f00b204e9800998ecf8427e", LastModified: started.Add(time.Hour)}
+
+	testCases := []struct {
+		desc        string
+		stored      map[string]objectHead
+		checkETag   bool
+		keepNewer   time.Time
+		wantUpload  bool
+		wantHeaders map[string]string
+	}{
+		{desc: "new object", stored: map[string]objectHead{}, checkETag: true, wantUpload: true, wantHeaders: map[string]string{"If-None-Match": "*"}},
+		{desc: "matching object", stored: map[string]objectHead{"foo.txt": matching}, checkETag: true},
+		{desc: "changed object", stored: map[string]objectHead{"foo.txt": changed}, checkETag: true, wantUpload: true, wantHeaders: map[string]string{"If-Match": `"d41d8cd98f00b204e9800998ecf8427e"`}},
+		{desc: "ETag not comparable", stored: map[string]objectHead{"foo.txt": matching}, wantUpload: true, wantHeaders: map[string]string{"If-Match": `"328c30fae61cd119cd177c061d1ac11f"`}},
+		{desc: "newer object kept", stored: map[string]objectHead{"foo.txt": newer}, checkETag: true, keepNewer: started},
+		{desc: "newer object overwritten", stored: map[string]objectHead{"foo.txt": newer}, checkETag: true, wantUpload: true, wantHeaders: map[string]string{"If-Match": `"d41d8cd98f00b204e9800998ecf8427e"`}},
+		{desc: "older object overwritten", stored: map[string]objectHead{"foo.txt": changed}, checkETag: true, keepNewer: started, wantUpload: true, wantHeaders: map[string]string{"If-Match": `"d41d8cd98f00b204e9800998ecf8427e"`}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &recordingUploader{}
+			u := &conditionalUploader{client: &mockHeader{objects: tC.stored}, checkETag: tC.checkETag, keepNewer: tC.keepNewer, next: client}
+
+			headers := map[string]string{"Cache-Control": "no-cache"}
+			err := u.Upload(context.Background(), &uploadObject{Path: "foo.txt", Body: strings.NewReader("some body"), Headers: headers})
+			if skipped := errors.Is(err, errObjectSkipped); skipped == tC.wantUpload {
+				t.Fatalf("Expected skipped %v; got error %v", !tC.wantUpload, err)
+			}
+
+			if err != nil && !errors.Is(err, errObjectSkipped) {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if uploaded := len(client.objects) > 0; uploaded != tC.wantUpload {
+				t.Fatalf("Expected upload %v; got %v", tC.wantUpload, uploaded)
+			}
+
+			if !tC.wantUpload {
+				return
+			}
+
+			if client.bodies[0] != "some body" {
+				t.Errorf("Expected the full body to be uploaded; got %q", client.bodies[0])
+			}
+
+			for name, want := range tC.wantHeaders {
+				if got := client.objects[0].Headers[name]; got != want {
+					t.Errorf("Expected %s: %s; got %q", name, want, got)
+				}
+			}
+
+			if len(headers) != 1 {
+				t.Errorf("Expected the original headers to be left unchanged; got %v", headers)
+			}
+		})
+	}
+}
+
+func Test_conditionalUploader_errors(t *testing.T) {
+	stored := map[string]objectHead{"foo.txt": {Size: 9, ETag: "d41d8cd98f00b204e9800998ecf8427e"}}
+
+	testCases := []struct {
+		desc      string
+		client    objectHeader
+		uploadErr error
+		wantErr   string
+	}{
+		{desc: "conflict", client: &mockHeader{objects: stored}, uploadErr: fmt.Errorf("failed to upload to S3: %w", &smithy.GenericAPIError{Code: "PreconditionFailed"}), wantErr: "foo.txt was changed by another upload while uploading it"},
+		{desc: "upload failed", client: &mockHeader{objects: stored}, uploadErr: errors.New("denied"), wantErr: "denied"},
+		{desc: "head failed", client: &failingHeader{err: errors.New("access denied")}, wantErr: "could not read foo.txt before uploading it: access denied"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			u := &conditionalUploader{client: tC.client, checkETag: true, next: &mockUploader{uploadErr: tC.uploadErr}}
+
+			err := u.Upload(context.Background(), &uploadObject{Path: "foo.txt", Body: strings.NewReader("some body")})
+			if err == nil || err.Error() != tC.wantErr {
+				t.Errorf("Expected error %q; got %v", tC.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_conditionalUploader_skippedThroughChain(t *testing.T) {
+	fsys := fstest.MapFS{"foo.txt": {Data: []byte("some body")}}
+	stored := map[string]objectHead{"foo.txt": {Size: 9, ETag: "328c30fae61cd119cd177c061d1ac11f"}}
+
+	client := &recordingUploader{}
+	prog := newProgress(1, 9, false)
+	var removed []string
+
+	// The decorators between the uploader and the walk, as runUpload wires them.
+	var chain uploader = &conditionalUploader{client: &mockHeader{objects: stored}, checkETag: true, next: client}
+	chain = &progressUploader{progress: prog, next: chain}
+	recorder := &changeRecorder{next: chain}
+	chain = &moveUploader{next: recorder, remove: func(path string) error {
+		removed = append(removed, path)
+		return nil
+	}}
+
+	var skipped []string
+	skip := prog.SkipFunc(func(path string, entry fs.DirEntry, err error) error {
+		skipped = append(skipped, path)
+		return nil
+	})
+
+	upload := createSkippedFunc(createUploadFunc(context.Background(), fsys, chain), skip)
+	if err := fs.WalkDir(fsys, ".", upload); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(client.objects) != 0 {
+		t.Errorf("Expected nothing to be uploaded; got %d object(s)", len(client.objects))
+	}
+
+	if paths := recorder.Paths(); len(paths) != 0 {
+		t.Errorf("Expected no changes to be recorded; got %v", paths)
+	}
+
+	if len(removed) != 0 {
+		t.Errorf("Expected the local file to be kept; got %v removed", removed)
+	}
+
+	if prog.doneFiles != 1 || prog.doneBytes != 9 {
+		t.Errorf("Expected the file to be counted once; got %d file(s), %d byte(s)", prog.doneFiles, prog.doneBytes)
+	}
+
+	if len(skipped) != 1 || skipped[0] != "foo.txt" {
+		t.Errorf("Expected the file to be reported as skipped; got %v", skipped)
+	}
+}
+
+// failingHeader fails to read every object.
+type failingHeader struct {
+	err error
+}
+
+func (h *failingHeader) Head(ctx context.Context, path string) (objectHead, error) {
+	return objectHead{}, h.err
+}
+
+func Test_matchesObject(t *testing.T) {
+	body := strings.NewReader("some body")
+
+	testCases := []struct {
+		desc string
+		head objectHead
+		want bool
+	}{
+		{desc: "same", head: objectHead{Size: 9, ETag: "328c30fae61cd119cd177c061d1ac11f"}, want: true},
+		{desc: "different contents", head: objectHead{Size: 9, ETag: "d41d8cd98f00b204e9800998ecf8427e"}},
+		{desc: "different size", head: objectHead{Size: 4, ETag: "328c30fae61cd119cd177c061d1ac11f"}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := matchesObject(body, tC.head)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got != tC.want {
+				t.Errorf("Expected match %v; got %v", tC.want, got)
+			}
+
+			if body.Len() != 9 {
+				t.Errorf("Expected the body to be rewound; %d bytes are left", body.Len())
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigPath is the config file that is read, if it exists, when `-config` isn't given.
+const defaultConfigPath = "s3copy.yaml"
+
+// configFile holds the settings read from a YAML config file. Settings given as flags take
+// precedence over the values in the file.
+type configFile struct {
+	// path is the file the config was read from, or empty if there was none.
+	path string
+
+	Bucket   string `yaml:"bucket"`
+	Region   string `yaml:"region"`
+	Endpoint string `yaml:"endpoint"`
+	Prefix   string `yaml:"prefix"`
+	Profile  string `yaml:"profile"`
+	// Provider and AccountID select an S3-compatible service, like `-provider` and `-account-id`.
+	Provider  string `yaml:"provider"`
+	AccountID string `yaml:"account-id"`
+	// RoleARN and ExternalID select an IAM role to assume, like `-role-arn` and `-external-id`.
+	RoleARN    string `yaml:"role-arn"`
+	ExternalID string `yaml:"external-id"`
+	// CredentialProcess is a command printing credentials, like `-credential-process`.
+	CredentialProcess string `yaml:"credential-process"`
+	// ForcePathStyle addresses buckets by path, like `-force-path-style`.
+	ForcePathStyle bool `yaml:"force-path-style"`
+	// FIPS, DualStack, and Accelerate select variants of the AWS endpoints, like `-fips`,
+	// `-dualstack`, and `-accelerate`.
+	FIPS       bool     `yaml:"fips"`
+	DualStack  bool     `yaml:"dualstack"`
+	Accelerate bool     `yaml:"accelerate"`
+	Include    []string `yaml:"include"`
+	Exclude    []string `yaml:"exclude"`
+	// StripPrefix, LowercaseKeys, and RenameRules transform keys, like `-strip-prefix`,
+	// `-lowercase-keys`, and `-rename-rule`.
+	StripPrefix   string   `yaml:"strip-prefix"`
+	LowercaseKeys bool     `yaml:"lowercase-keys"`
+	RenameRules   []string `yaml:"rename-rules"`
+	// MimeTypes maps file extensions to content types, like the file given to `-mime-map`.
+	MimeTypes map[string]string `yaml:"mime-types"`
+	// Rules apply settings to the files matching a glob pattern.
+	Rules []configRule `yaml:"rules"`
+	// Environments are named deployment targets, selected with `-env`.
+	Environments map[string]configEnvironment `yaml:"environments"`
+	// CDN configures purging the changed files from the CDN after a deploy.
+	CDN *cdnConfig `yaml:"cdn"`
+	// Redirects are created in addition to those in the redirects file.
+	Redirects []redirect `yaml:"redirects"`
+}
+
+// configEnvironment holds the settings of a deployment target, which override the top-level
+// settings of the config file when the environment is selected.
+type configEnvironment struct {
+	Bucket     string `yaml:"bucket"`
+	Region     string `yaml:"region"`
+	Endpoint   string `yaml:"endpoint"`
+	Prefix     string `yaml:"prefix"`
+	Profile    string `yaml:"profile"`
+	Provider   string `yaml:"provider"`
+	AccountID  string `yaml:"account-id"`
+	RoleARN    string `yaml:"role-arn"`
+	ExternalID string `yaml:"external-id"`
+	// CredentialProcess replaces the top-level command printing credentials, if given.
+	CredentialProcess string `yaml:"credential-process"`
+	// ForcePathStyle addresses buckets by path if set, even if the top-level setting isn't.
+	ForcePathStyle bool `yaml:"force-path-style"`
+	// FIPS, DualStack, and Accelerate select variants of the AWS endpoints if set, even if the
+	// top-level settings don't.
+	FIPS       bool `yaml:"fips"`
+	DualStack  bool `yaml:"dualstack"`
+	Accelerate bool `yaml:"accelerate"`
+	// CDN replaces the top-level CDN settings, if given.
+	CDN *cdnConfig `yaml:"cdn"`
+}
+
+// configRule applies settings to every file matching a glob pattern. When several rules set the
+// same value for a file, the first matching rule wins.
+type configRule struct {
+	Match        string            `yaml:"match"`
+	CacheControl string            `yaml:"cache-control"`
+	ACL          string            `yaml:"acl"`
+	ContentType  string            `yaml:"content-type"`
+	Metadata     map[string]string `yaml:"metadata"`
+	Tags         map[string]string `yaml:"tags"`
+}
+
+// loadConfig reads the config file at the given path. A missing file results in an empty config,
+// unless the file is required.
+func loadConfig(path string, required bool) (*configFile, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return &configFile{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file: %v", err)
+	}
+	defer file.Close()
+
+	var config configFile
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("could not parse config file %s: %v", path, err)
+	}
+
+	config.path = path
+
+	return &config, nil
+}
+
+// selectEnvironment applies the settings of the named environment on top of the top-level
+// settings.
+func (c *configFile) selectEnvironment(name string) error {
+	env, ok := c.Environments[name]
+	if !ok {
+		var known []string
+		for envName := range c.Environments {
+			known = append(known, envName)
+		}
+
+		sort.Strings(known)
+
+		if len(known) == 0 {
+			return fmt.Errorf("unknown environment %q: the config file doesn't define any environments", name)
+		}
+
+		return fmt.Errorf("unknown environment %q; expected one of: %s", name, strings.Join(known, ", "))
+	}
+
+	for _, setting := range []struct {
+		target *string
+		value  string
+	}{
+		{target: &c.Bucket, value: env.Bucket},
+		{target: &c.Region, value: env.Region},
+		{target: &c.Endpoint, value: env.Endpoint},
+		{target: &c.Prefix, value: env.Prefix},
+		{target: &c.Profile, value: env.Profile},
+		{target: &c.Provider, value: env.Provider},
+		{target: &c.AccountID, value: env.AccountID},
+		{target: &c.RoleARN, value: env.RoleARN},
+		{target: &c.ExternalID, value: env.ExternalID},
+		{target: &c.CredentialProcess, value: env.CredentialProcess},
+	} {
+		if setting.value != "" {
+			*setting.target = setting.value
+		}
+	}
+
+	if env.ForcePathStyle {
+		c.ForcePathStyle = true
+	}
+
+	if env.FIPS {
+		c.FIPS = true
+	}
+
+	if env.DualStack {
+		c.DualStack = true
+	}
+
+	if env.Accelerate {
+		c.Accelerate = true
+	}
+
+	if env.CDN != nil {
+		c.CDN = env.CDN
+	}
+
+	return nil
+}
+
+// flagValue is the value of a command line flag, as it would be passed to `flag.Set`.
+type flagValue struct {
+	name  string
+	value string
+}
+
+// flagValues returns the settings of the config file that correspond to command line flags, in
+// the order they should be set.
+func (c *configFile) flagValues() []flagValue {
+	var values []flagValue
+	for _, setting := range []flagValue{
+		{name: "bucket", value: c.Bucket},
+		{name: "region", value: c.Region},
+		{name: "endpoint", value: c.Endpoint},
+		{name: "prefix", value: c.Prefix},
+		{name: "profile", value: c.Profile},
+		{name: "provider", value: c.Provider},
+		{name: "account-id", value: c.AccountID},
+		{name: "role-arn", value: c.RoleARN},
+		{name: "external-id", value: c.ExternalID},
+		{name: "credential-process", value: c.CredentialProcess},
+		{name: "strip-prefix", value: c.StripPrefix},
+	} {
+		if setting.value != "" {
+			values = append(values, setting)
+		}
+	}
+
+	if c.ForcePathStyle {
+		values = append(values, flagValue{name: "force-path-style", value: "true"})
+	}
+
+	if c.FIPS {
+		values = append(values, flagValue{name: "fips", value: "true"})
+	}
+
+	if c.DualStack {
+		values = append(values, flagValue{name: "dualstack", value: "true"})
+	}
+
+	if c.Accelerate {
+		values = append(values, flagValue{name: "accelerate", value: "true"})
+	}
+
+	for _, pattern := range c.Include {
+		values = append(values, flagValue{name: "include", value: pattern})
+	}
+
+	for _, pattern := range c.Exclude {
+		values = append(values, flagValue{name: "exclude", value: pattern})
+	}
+
+	if c.LowercaseKeys {
+		values = append(values, flagValue{name: "lowercase-keys", value: "true"})
+	}
+
+	for _, rule := range c.RenameRules {
+		values = append(values, flagValue{name: "rename-rule", value: rule})
+	}
+
+	return values
+}
+
+// headerRules converts the rules of the config file into header rules, validating their values.
+func (c *configFile) headerRules() ([]headerRule, error) {
+	var rules []headerRule
+	for i, rule := range c.Rules {
+		if rule.Match == "" {
+			return nil, fmt.Errorf("rule %d: missing 'match' pattern", i+1)
+		}
+
+		if _, err := newPathFilter([]string{rule.Match}, nil); err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i+1, err)
+		}
+
+		add := func(header, value string) {
+			rules = append(rules, headerRule{pattern: rule.Match, header: header, value: value})
+		}
+
+		if rule.CacheControl != "" {
+			add("Cache-Control", rule.CacheControl)
+		}
+
+		if rule.ACL != "" {
+			acl, err := parseACL(rule.ACL)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %v", i+1, err)
+			}
+
+			add("X-Amz-Acl", string(acl))
+		}
+
+		if rule.ContentType != "" {
+			if _, _, err := mime.ParseMediaType(rule.ContentType); err != nil {
+				return nil, fmt.Errorf("rule %d: invalid content type %q: %v", i+1, rule.ContentType, err)
+			}
+
+			add("Content-Type", rule.ContentType)
+		}
+
+		if err := validateMetadata(rule.Metadata); err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i+1, err)
+		}
+
+		keys := make([]string, 0, len(rule.Metadata))
+		for key := range rule.Metadata {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			add(http.CanonicalHeaderKey("X-Amz-Meta-"+key), rule.Metadata[key])
+		}
+
+		if _, err := encodeTags(rule.Tags); err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i+1, err)
+		}
+
+		keys = keys[:0]
+		for key := range rule.Tags {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			add(tagHeaderPrefix+key, rule.Tags[key])
+		}
+	}
+
+	return rules, nil
+}
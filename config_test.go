@@ -0,0 +1,198 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_loadConfig(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.yaml")
+	unknown := filepath.Join(dir, "unknown.yaml")
+	empty := filepath.Join(dir, "empty.yaml")
+	os.WriteFile(valid, []byte(`
+bucket: my-site
+prefix: docs
+exclude:
+  - "*.map"
+rules:
+  - match: "*.html"
+    cache-control: no-cache
+`), 0o644)
+	os.WriteFile(unknown, []byte("buckett: my-site\n"), 0o644)
+	os.WriteFile(empty, nil, 0o644)
+
+	testCases := []struct {
+		desc       string
+		path       string
+		required   bool
+		wantBucket string
+		wantErr    bool
+	}{
+		{desc: "valid", path: valid, wantBucket: "my-site"},
+		{desc: "unknown field", path: unknown, wantErr: true},
+		{desc: "empty file", path: empty},
+		{desc: "missing optional file", path: filepath.Join(dir, "missing.yaml")},
+		{desc: "missing required file", path: filepath.Join(dir, "missing.yaml"), required: true, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := loadConfig(tC.path, tC.required)
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if err == nil && got.Bucket != tC.wantBucket {
+				t.Errorf("Expected bucket %q; got %q", tC.wantBucket, got.Bucket)
+			}
+		})
+	}
+}
+
+func Test_configFile_flagValues(t *testing.T) {
+	config := &configFile{
+		Bucket:            "my-site",
+		Prefix:            "docs",
+		Provider:          "r2",
+		AccountID:         "abc123",
+		RoleARN:           "arn:aws:iam::123456789012:role/deploy",
+		ExternalID:        "customer-42",
+		CredentialProcess: "vault-aws-creds deploy",
+		ForcePathStyle:    true,
+		FIPS:              true,
+		DualStack:         true,
+		Accelerate:        true,
+		Include:           []string{"*.html", "*.css"},
+		StripPrefix:       "dist/",
+		LowercaseKeys:     true,
+		RenameRules:       []string{"^assets/(.*)$=static/$1"},
+	}
+
+	want := []flagValue{
+		{name: "bucket", value: "my-site"},
+		{name: "prefix", value: "docs"},
+		{name: "provider", value: "r2"},
+		{name: "account-id", value: "abc123"},
+		{name: "role-arn", value: "arn:aws:iam::123456789012:role/deploy"},
+		{name: "external-id", value: "customer-42"},
+		{name: "credential-process", value: "vault-aws-creds deploy"},
+		{name: "strip-prefix", value: "dist/"},
+		{name: "force-path-style", value: "true"},
+		{name: "fips", value: "true"},
+		{name: "dualstack", value: "true"},
+		{name: "accelerate", value: "true"},
+		{name: "include", value: "*.html"},
+		{name: "include", value: "*.css"},
+		{name: "lowercase-keys", value: "true"},
+		{name: "rename-rule", value: "^assets/(.*)$=static/$1"},
+	}
+
+	if got := config.flagValues(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected flag values %v; got %v", want, got)
+	}
+}
+
+func Test_configFile_headerRules(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		rules   []configRule
+		want    []headerRule
+		wantErr bool
+	}{
+		{
+			desc: "all settings",
+			rules: []configRule{{
+				Match:        "*.html",
+				CacheControl: "no-cache",
+				ACL:          "private",
+				ContentType:  "text/html; charset=utf-8",
+				Metadata:     map[string]string{"team": "web", "build": "42"},
+				Tags:         map[string]string{"ttl": "7d", "Owner": "web"},
+			}},
+			want: []headerRule{
+				{pattern: "*.html", header: "Cache-Control", value: "no-cache"},
+				{pattern: "*.html", header: "X-Amz-Acl", value: "private"},
+				{pattern: "*.html", header: "Content-Type", value: "text/html; charset=utf-8"},
+				{pattern: "*.html", header: "X-Amz-Meta-Build", value: "42"},
+				{pattern: "*.html", header: "X-Amz-Meta-Team", value: "web"},
+				{pattern: "*.html", header: "X-Amz-Tag-Owner", value: "web"},
+				{pattern: "*.html", header: "X-Amz-Tag-ttl", value: "7d"},
+			},
+		},
+		{
+			desc:  "no ACL",
+			rules: []configRule{{Match: "private/**", ACL: "none"}},
+			want:  []headerRule{{pattern: "private/**", header: "X-Amz-Acl", value: ""}},
+		},
+		{desc: "missing pattern", rules: []configRule{{CacheControl: "no-cache"}}, wantErr: true},
+		{desc: "invalid pattern", rules: []configRule{{Match: "[a-", CacheControl: "no-cache"}}, wantErr: true},
+		{desc: "unknown ACL", rules: []configRule{{Match: "*", ACL: "everyone"}}, wantErr: true},
+		{desc: "invalid content type", rules: []configRule{{Match: "*", ContentType: "not a type"}}, wantErr: true},
+		{desc: "invalid metadata", rules: []configRule{{Match: "*", Metadata: map[string]string{"a b": "c"}}}, wantErr: true},
+		{desc: "invalid tags", rules: []configRule{{Match: "*", Tags: map[string]string{"": "c"}}}, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			config := &configFile{Rules: tC.rules}
+			got, err := config.headerRules()
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("Expected rules %+v; got %+v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_configFile_selectEnvironment(t *testing.T) {
+	newConfig := func() *configFile {
+		return &configFile{
+			Bucket: "default-bucket",
+			Region: "eu-west-1",
+			Prefix: "site",
+			Environments: map[string]configEnvironment{
+				"staging": {Bucket: "staging-bucket"},
+				"production": {
+					Bucket: "production-bucket",
+					Region: "us-east-1",
+					CDN:    &cdnConfig{BaseURL: "https://example.com/"},
+				},
+			},
+			CDN: &cdnConfig{BaseURL: "https://staging.example.com/"},
+		}
+	}
+
+	config := newConfig()
+	if err := config.selectEnvironment("production"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if config.Bucket != "production-bucket" || config.Region != "us-east-1" || config.Prefix != "site" {
+		t.Errorf("Expected environment settings over the top-level ones; got %+v", config)
+	}
+
+	if config.CDN.BaseURL != "https://example.com/" {
+		t.Errorf("Expected the environment's CDN settings; got %+v", config.CDN)
+	}
+
+	config = newConfig()
+	if err := config.selectEnvironment("staging"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if config.CDN.BaseURL != "https://staging.example.com/" {
+		t.Errorf("Expected the top-level CDN settings to be kept; got %+v", config.CDN)
+	}
+
+	if err := newConfig().selectEnvironment("qa"); err == nil {
+		t.Error("Expected an error for an unknown environment")
+	}
+
+	if err := (&configFile{}).selectEnvironment("staging"); err == nil {
+		t.Error("Expected an error when no environments are defined")
+	}
+}
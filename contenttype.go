@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// loadMimeMap reads a JSON file mapping file extensions to content types, such as
+// `{".wasm": "application/wasm"}`. The leading dot of an extension is optional.
+func loadMimeMap(path string) (map[string]string, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read MIME map: %v", err)
+	}
+
+	var types map[string]string
+	if err := json.Unmarshal(contents, &types); err != nil {
+		return nil, fmt.Errorf("could not parse MIME map %s: %v", path, err)
+	}
+
+	return types, nil
+}
+
+// registerMimeTypes overrides the content types the platform's MIME database associates with
+// the given extensions, since databases disagree on types such as `.js` or `.woff2`.
+func registerMimeTypes(types map[string]string) error {
+	for extension, contentType := range types {
+		if !strings.HasPrefix(extension, ".") {
+			extension = "." + extension
+		}
+
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return fmt.Errorf("invalid content type %q for %s: %v", contentType, extension, err)
+		}
+
+		if err := mime.AddExtensionType(extension, contentType); err != nil {
+			return fmt.Errorf("could not register content type for %s: %v", extension, err)
+		}
+	}
+
+	return nil
+}
+
+// sniffLength is the number of bytes `http.DetectContentType` considers.
+const sniffLength = 512
+
+// contentTypeUploader fills in the Content-Type of objects whose extension isn't recognized by
+// sniffing the start of their body. If sniffing is inconclusive, the default content type is used
+// instead, when one is set.
+type contentTypeUploader struct {
+	defaultType string
+	next        uploader
+}
+
+func (u *contentTypeUploader) Upload(ctx context.Context, object *uploadObject) error {
+	if object.ContentType != "" {
+		return u.next.Upload(ctx, object)
+	}
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(object.Body, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return fmt.Errorf("could not read %s: %v", object.Path, err)
+	}
+
+	head = head[:n]
+
+	// Seekable bodies are rewound so that retries still work. Others are reassembled from the
+	// bytes that were read and the remainder of the body.
+	if seeker, ok := object.Body.(io.Seeker); ok {
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("could not rewind %s: %v", object.Path, err)
+		}
+	} else {
+		object.Body = io.MultiReader(bytes.NewReader(head), object.Body)
+	}
+
+	object.ContentType = http.DetectContentType(head)
+	if object.ContentType == "application/octet-stream" && u.defaultType != "" {
+		object.ContentType = u.defaultType
+	}
+
+	return u.next.Upload(ctx, object)
+}
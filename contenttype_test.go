@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_loadMimeMap(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.json")
+	invalid := filepath.Join(dir, "invalid.json")
+	os.WriteFile(valid, []byte(`{".wasm": "application/wasm", "avif": "image/avif"}`), 0o644)
+	os.WriteFile(invalid, []byte(`[".wasm"]`), 0o644)
+
+	types, err := loadMimeMap(valid)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if types[".wasm"] != "application/wasm" || types["avif"] != "image/avif" {
+		t.Errorf("Expected both entries to be loaded; got %v", types)
+	}
+
+	if _, err := loadMimeMap(invalid); err == nil {
+		t.Error("Expected an error for a file that isn't a JSON object")
+	}
+
+	if _, err := loadMimeMap(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func Test_registerMimeTypes(t *testing.T) {
+	err := registerMimeTypes(map[string]string{
+		".s3copy-a": "application/x-s3copy-a",
+		"s3copy-b":  "text/x-s3copy-b; charset=utf-8",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got := mime.TypeByExtension(".s3copy-a"); got != "application/x-s3copy-a" {
+		t.Errorf("Expected registered type for .s3copy-a; got %q", got)
+	}
+
+	if got := mime.TypeByExtension(".s3copy-b"); got != "text/x-s3copy-b; charset=utf-8" {
+		t.Errorf("Expected registered type for extension without a dot; got %q", got)
+	}
+
+	if err := registerMimeTypes(map[string]string{".s3copy-c": "not a type"}); err == nil {
+		t.Error("Expected an error for an invalid content type")
+	}
+}
+
+func Test_contentTypeUploader(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		defaultType string
+		object      uploadObject
+		want        string
+	}{
+		{
+			desc:   "known extension",
+			object: uploadObject{Path: "app.js", Body: strings.NewReader("<html>"), ContentType: "text/javascript"},
+			want:   "text/javascript",
+		},
+		{
+			desc:   "sniffed HTML",
+			object: uploadObject{Path: "about", Body: strings.NewReader("<!DOCTYPE html><html></html>")},
+			want:   "text/html; charset=utf-8",
+		},
+		{
+			desc:   "sniffed text",
+			object: uploadObject{Path: "LICENSE", Body: strings.NewReader("MIT License")},
+			want:   "text/plain; charset=utf-8",
+		},
+		{
+			desc:   "unknown binary",
+			object: uploadObject{Path: "blob", Body: strings.NewReader("\x00\x01\x02")},
+			want:   "application/octet-stream",
+		},
+		{
+			desc:        "unknown binary with default",
+			defaultType: "application/x-custom",
+			object:      uploadObject{Path: "blob", Body: strings.NewReader("\x00\x01\x02")},
+			want:        "application/x-custom",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			want, _ := io.ReadAll(tC.object.Body)
+			tC.object.Body.(io.Seeker).Seek(0, io.SeekStart)
+
+			next := &recordingUploader{}
+			u := &contentTypeUploader{defaultType: tC.defaultType, next: next}
+			if err := u.Upload(context.Background(), &tC.object); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got := next.objects[0].ContentType; got != tC.want {
+				t.Errorf("Expected Content-Type %q; got %q", tC.want, got)
+			}
+
+			if next.bodies[0] != string(want) {
+				t.Errorf("Expected the full body %q to be uploaded; got %q", want, next.bodies[0])
+			}
+		})
+	}
+}
+
+func Test_contentTypeUploader_unseekable(t *testing.T) {
+	body := strings.Repeat("a", sniffLength+10)
+	next := &recordingUploader{}
+	u := &contentTypeUploader{next: next}
+
+	err := u.Upload(context.Background(), &uploadObject{Path: "notes", Body: io.MultiReader(strings.NewReader(body))})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if next.bodies[0] != body {
+		t.Errorf("Expected the full body to be uploaded; got %d bytes", len(next.bodies[0]))
+	}
+}
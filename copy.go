@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// runCopy implements the `copy` command, which copies the objects under a prefix to another
+// bucket or prefix without downloading them, e.g. to promote a staging deploy to production.
+func runCopy(cmd command, args []string) {
+	var common, target commonFlags
+	var acl string
+	var concurrency int
+	var dryRunMode, stream, syncMode bool
+	var include, exclude stringList
+
+	flags := newFlagSet(cmd, "[flags]")
+	common.register(flags)
+	flags.StringVar(&acl, "acl", "public-read", "Canned ACL to apply to copied objects, or 'none' to omit the ACL")
+	flags.IntVar(&concurrency, "concurrency", 4, "Number of objects to copy in parallel")
+	flags.BoolVar(&dryRunMode, "dry-run", false, "Print the objects that would be copied without copying them")
+	flags.Var(&exclude, "exclude", "Glob pattern of objects to skip (repeatable)")
+	flags.Var(&include, "include", "Glob pattern of objects to copy; if given, other objects are skipped (repeatable)")
+	flags.BoolVar(&stream, "stream", false, "Download and re-upload objects instead of copying them server-side, for destinations whose credentials can't read the source")
+	flags.BoolVar(&syncMode, "sync", false, "Only copy objects that differ from the objects already in the destination")
+	flags.StringVar(&target.bucket, "to-bucket", "", "Bucket to copy objects to (defaults to the source bucket)")
+	flags.StringVar(&target.endpoint, "to-endpoint", "", "AWS endpoint of the destination (defaults to the source endpoint)")
+	flags.StringVar(&target.prefix, "to-prefix", "", "Key prefix to copy objects under in the destination")
+	flags.StringVar(&target.profile, "to-profile", "", "Named profile to use for the destination (defaults to the source profile)")
+	flags.StringVar(&target.region, "to-region", "", "AWS region of the destination (defaults to the source region)")
+	flags.Parse(args)
+
+	if _, err := common.applyConfig(flags); err != nil {
+		log.Fatal(err)
+	}
+
+	// Destination settings that weren't given are the same as the source's.
+	for _, setting := range []struct {
+		target *string
+		source string
+	}{
+		{target: &target.bucket, source: common.bucket},
+		{target: &target.credentialProcess, source: common.credentialProcess},
+		{target: &target.endpoint, source: common.endpoint},
+		{target: &target.profile, source: common.profile},
+		{target: &target.region, source: common.region},
+	} {
+		if *setting.target == "" {
+			*setting.target = setting.source
+		}
+	}
+
+	if target.endpoint == common.endpoint {
+		target.dev = common.dev
+		target.pathStyle = common.pathStyle
+		target.endpoints = common.endpoints
+		// Transfer Acceleration is enabled per bucket.
+		target.endpoints.accelerate = target.bucket == common.bucket && common.endpoints.accelerate
+	}
+
+	target.role = common.role
+	target.requestPayer = common.requestPayer
+	target.requests = common.requests
+	target.network = common.network
+
+	sourcePrefix := normalizePrefix(common.prefix)
+	targetPrefix := normalizePrefix(target.prefix)
+	if target.bucket == common.bucket && targetPrefix == sourcePrefix {
+		log.Fatal("The source and destination are the same; use '-to-bucket' or '-to-prefix' to choose a different destination.")
+	}
+
+	fileACL, err := parseACL(common.preset.objectACL(acl, flagGiven(flags, "acl")))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	filter, err := newPathFilter(include, exclude)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := newSignalContext()
+	defer stop()
+
+	sourceClient, err := common.newClient(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	targetClient, err := target.newClient(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	source, err := listObjects(ctx, sourceClient, common.bucket, sourcePrefix)
+	if err != nil {
+		log.Fatal("Could not list source objects: ", err)
+	}
+
+	copier := &s3Copier{
+		source:       sourceClient,
+		target:       targetClient,
+		uploader:     manager.NewUploader(targetClient),
+		sourceBucket: common.bucket,
+		sourcePrefix: sourcePrefix,
+		targetBucket: target.bucket,
+		targetPrefix: targetPrefix,
+		fileACL:      fileACL,
+		stream:       stream,
+	}
+
+	copyFunc := createCopyFunc(ctx, copier)
+	skipFunc := fs.WalkDirFunc(logSkipped)
+
+	var preview *dryRun
+	if dryRunMode {
+		preview = newDryRun(os.Stdout)
+		copyFunc = preview.UploadFunc()
+		skipFunc = preview.SkipFunc()
+	}
+
+	if syncMode {
+		existing, err := listObjects(ctx, targetClient, target.bucket, targetPrefix)
+		if err != nil {
+			log.Fatal("Could not list destination objects: ", err)
+		}
+
+		copyFunc = createCopySyncFunc(source, existing, copyFunc, skipFunc)
+	}
+
+	pool := newUploadPool(ctx, concurrency, false, copyFunc)
+	walkErr := walkRemote(source, createFilterFunc(filter, pool.WalkDirFunc()))
+	poolErr := pool.Wait()
+	if ctx.Err() != nil {
+		log.Fatalf("Interrupted: %d object(s) copied before cancellation.", pool.Completed())
+	}
+
+	if poolErr != nil {
+		log.Fatal("Copy failed: ", poolErr)
+	}
+
+	if walkErr != nil {
+		log.Fatal("Copy failed: ", walkErr)
+	}
+
+	if preview != nil {
+		preview.Summary()
+	}
+}
+
+// createCopySyncFunc wraps a copy callback so that source objects with the same size and ETag as
+// an existing destination object are passed to `skip` instead.
+func createCopySyncFunc(source, existing map[string]remoteObject, copy, skip fs.WalkDirFunc) fs.WalkDirFunc {
+	return func(key string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return copy(key, entry, err)
+		}
+
+		if target, ok := existing[key]; ok {
+			object := source[key]
+			if object.Size == target.Size && object.ETag == target.ETag {
+				return skip(key, entry, nil)
+			}
+		}
+
+		return copy(key, entry, nil)
+	}
+}
+
+// An objectCopier allows for copying an object between remote locations.
+type objectCopier interface {
+	// Copy copies the object with the given key and size to the destination.
+	Copy(ctx context.Context, key string, size int64) error
+}
+
+// createCopyFunc creates a walk callback that copies each remote object.
+func createCopyFunc(ctx context.Context, copier objectCopier) fs.WalkDirFunc {
+	return func(key string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("could not list %s: %v", key, err)
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("could not stat %s: %v", key, err)
+		}
+
+		if err := copier.Copy(ctx, key, info.Size()); err != nil {
+			return fmt.Errorf("failed to copy %s: %v", key, err)
+		}
+
+		log.Printf("Copied %s (%s)\n", key, formatBytes(info.Size()))
+
+		return nil
+	}
+}
+
+const (
+	// maxCopyObjectSize is the largest object S3 can copy with a single CopyObject request.
+	maxCopyObjectSize = 5 * 1024 * 1024 * 1024
+	// minCopyPartSize is the part size used when copying larger objects in multiple parts.
+	minCopyPartSize = 512 * 1024 * 1024
+)
+
+// s3Copier copies objects between S3 buckets or prefixes. Objects are copied server-side using
+// the destination's credentials, which must be able to read the source, unless streaming is
+// enabled.
+type s3Copier struct {
+	// source is the client used to read source objects when streaming
+	source *s3.Client
+	// target is the client used to write to the destination
+	target *s3.Client
+	// uploader is used to write streamed objects to the destination
+	uploader *manager.Uploader
+
+	sourceBucket string
+	sourcePrefix string
+	targetBucket string
+	targetPrefix string
+
+	// fileACL is the ACL to apply to copied objects. If empty, no ACL is sent.
+	fileACL types.ObjectCannedACL
+	// stream copies objects by downloading and re-uploading them.
+	stream bool
+}
+
+func (c *s3Copier) Copy(ctx context.Context, key string, size int64) error {
+	if c.stream {
+		return c.streamCopy(ctx, key)
+	}
+
+	if size > maxCopyObjectSize {
+		return c.multipartCopy(ctx, key, size)
+	}
+
+	_, err := c.target.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(c.targetBucket),
+		Key:        aws.String(c.targetPrefix + key),
+		CopySource: aws.String(copySource(c.sourceBucket, c.sourcePrefix+key)),
+		ACL:        c.fileACL,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy S3 object: %w", err)
+	}
+
+	return nil
+}
+
+// streamCopy copies an object by reading it with the source credentials and writing it with the
+// destination credentials, for copies between accounts that can't access each other's buckets.
+func (c *s3Copier) streamCopy(ctx context.Context, key string) error {
+	object, err := c.source.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(c.sourceBucket),
+		Key:    aws.String(c.sourcePrefix + key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read S3 object: %w", err)
+	}
+	defer object.Body.Close()
+
+	_, err = c.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:             aws.String(c.targetBucket),
+		Key:                aws.String(c.targetPrefix + key),
+		Body:               object.Body,
+		ACL:                c.fileACL,
+		CacheControl:       object.CacheControl,
+		ContentDisposition: object.ContentDisposition,
+		ContentEncoding:    object.ContentEncoding,
+		ContentLanguage:    object.ContentLanguage,
+		ContentType:        object.ContentType,
+		Metadata:           object.Metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write S3 object: %w", err)
+	}
+
+	return nil
+}
+
+// multipartCopy copies an object that is too large for CopyObject in multiple parts. Unlike
+// CopyObject, a multipart upload doesn't copy the object's headers and metadata, so they are read
+// from the source first.
+func (c *s3Copier) multipartCopy(ctx context.Context, key string, size int64) error {
+	head, err := c.target.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(c.sourceBucket),
+		Key:    aws.String(c.sourcePrefix + key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read S3 object: %w", err)
+	}
+
+	upload, err := c.target.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:             aws.String(c.targetBucket),
+		Key:                aws.String(c.targetPrefix + key),
+		ACL:                c.fileACL,
+		CacheControl:       head.CacheControl,
+		ContentDisposition: head.ContentDisposition,
+		ContentEncoding:    head.ContentEncoding,
+		ContentLanguage:    head.ContentLanguage,
+		ContentType:        head.ContentType,
+		Metadata:           head.Metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start multipart copy: %w", err)
+	}
+
+	parts, err := c.copyParts(ctx, key, size, aws.ToString(upload.UploadId))
+	if err == nil {
+		_, err = c.target.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(c.targetBucket),
+			Key:             aws.String(c.targetPrefix + key),
+			UploadId:        upload.UploadId,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+		})
+	}
+
+	if err != nil {
+		abortCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abortTimeout)
+		defer cancel()
+
+		_, abortErr := c.target.AbortMultipartUpload(abortCtx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(c.targetBucket),
+			Key:      aws.String(c.targetPrefix + key),
+			UploadId: upload.UploadId,
+		})
+		if abortErr != nil {
+			log.Printf("Could not abort multipart copy of %s (upload ID %s): %v\n", key, aws.ToString(upload.UploadId), abortErr)
+		}
+
+		return fmt.Errorf("failed multipart copy: %w", err)
+	}
+
+	return nil
+}
+
+// copyParts copies the byte ranges of an object into the parts of a multipart upload.
+func (c *s3Copier) copyParts(ctx context.Context, key string, size int64, uploadID string) ([]types.CompletedPart, error) {
+	partSize := copyPartSize(size)
+
+	var parts []types.CompletedPart
+	for start, number := int64(0), int32(1); start < size; start, number = start+partSize, number+1 {
+		end := min(start+partSize, size) - 1
+
+		output, err := c.target.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
+			Bucket:          aws.String(c.targetBucket),
+			Key:             aws.String(c.targetPrefix + key),
+			UploadId:        aws.String(uploadID),
+			PartNumber:      aws.Int32(number),
+			CopySource:      aws.String(copySource(c.sourceBucket, c.sourcePrefix+key)),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if output.CopyPartResult == nil {
+			return nil, errors.New("missing result for copied part")
+		}
+
+		parts = append(parts, types.CompletedPart{
+			ETag:       output.CopyPartResult.ETag,
+			PartNumber: aws.Int32(number),
+		})
+	}
+
+	return parts, nil
+}
+
+// copyPartSize returns the part size for copying an object of the given size, keeping within
+// the S3 limit on the number of parts.
+func copyPartSize(size int64) int64 {
+	partSize := int64(minCopyPartSize)
+	if size/partSize >= int64(manager.MaxUploadParts) {
+		partSize = size/int64(manager.MaxUploadParts) + 1
+	}
+
+	return partSize
+}
+
+// copySource formats the `x-amz-copy-source` value for an object, URL-encoding its key.
+func copySource(bucket, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(url.PathEscape(segment), "+", "%2B")
+	}
+
+	// Objects copied from access points are given as '<access point ARN>/object/<key>'.
+	if isAccessPointARN(bucket) {
+		bucket += "/object"
+	}
+
+	return bucket + "/" + strings.Join(segments, "/")
+}
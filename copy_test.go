@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+)
+
+// mockCopier records the keys of copied objects.
+type mockCopier struct {
+	copied []string
+	sizes  []int64
+	err    error
+}
+
+func (c *mockCopier) Copy(ctx context.Context, key string, size int64) error {
+	if c.err != nil {
+		return c.err
+	}
+
+	c.copied = append(c.copied, key)
+	c.sizes = append(c.sizes, size)
+
+	return nil
+}
+
+func Test_createCopyFunc(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		object     remoteObject
+		copyErr    error
+		wantCopied []string
+		wantErr    bool
+	}{
+		{desc: "object", object: remoteObject{Key: "index.html", Size: 6}, wantCopied: []string{"index.html"}},
+		{desc: "directory marker", object: remoteObject{Key: "assets/"}},
+		{desc: "copy failure", object: remoteObject{Key: "index.html"}, copyErr: errors.New("denied"), wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			copier := &mockCopier{err: tC.copyErr}
+			err := createCopyFunc(context.Background(), copier)(tC.object.Key, remoteEntry{object: tC.object}, nil)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if !reflect.DeepEqual(copier.copied, tC.wantCopied) {
+				t.Errorf("Expected copied keys %v; got %v", tC.wantCopied, copier.copied)
+			}
+
+			if len(tC.wantCopied) > 0 && copier.sizes[0] != tC.object.Size {
+				t.Errorf("Expected size %d; got %d", tC.object.Size, copier.sizes[0])
+			}
+		})
+	}
+}
+
+func Test_createCopySyncFunc(t *testing.T) {
+	source := map[string]remoteObject{
+		"same.txt":    {Key: "same.txt", Size: 4, ETag: `"a"`},
+		"changed.txt": {Key: "changed.txt", Size: 4, ETag: `"b"`},
+		"new.txt":     {Key: "new.txt", Size: 4, ETag: `"c"`},
+	}
+	existing := map[string]remoteObject{
+		"same.txt":    {Key: "same.txt", Size: 4, ETag: `"a"`},
+		"changed.txt": {Key: "changed.txt", Size: 4, ETag: `"old"`},
+	}
+
+	var copied, skipped []string
+	record := func(keys *[]string) fs.WalkDirFunc {
+		return func(key string, entry fs.DirEntry, err error) error {
+			*keys = append(*keys, key)
+			return nil
+		}
+	}
+
+	err := walkRemote(source, createCopySyncFunc(source, existing, record(&copied), record(&skipped)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if want := []string{"changed.txt", "new.txt"}; !reflect.DeepEqual(copied, want) {
+		t.Errorf("Expected copied keys %v; got %v", want, copied)
+	}
+
+	if want := []string{"same.txt"}; !reflect.DeepEqual(skipped, want) {
+		t.Errorf("Expected skipped keys %v; got %v", want, skipped)
+	}
+}
+
+func Test_copyPartSize(t *testing.T) {
+	testCases := []struct {
+		desc string
+		size int64
+		want int64
+	}{
+		{desc: "just over the copy limit", size: maxCopyObjectSize + 1, want: minCopyPartSize},
+		{desc: "too many parts at the minimum size", size: 10000 * minCopyPartSize, want: minCopyPartSize + 1},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got := copyPartSize(tC.size)
+			if got != tC.want {
+				t.Errorf("Expected part size %d; got %d", tC.want, got)
+			}
+
+			if parts := (tC.size + got - 1) / got; parts > 10000 {
+				t.Errorf("Expected at most 10000 parts; got %d", parts)
+			}
+		})
+	}
+}
+
+func Test_copySource(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		bucket string
+		key    string
+		want   string
+	}{
+		{desc: "plain key", bucket: "site", key: "docs/index.html", want: "site/docs/index.html"},
+		{desc: "spaces", bucket: "site", key: "my file.txt", want: "site/my%20file.txt"},
+		{desc: "plus sign", bucket: "site", key: "a+b.txt", want: "site/a%2Bb.txt"},
+		{desc: "unicode", bucket: "site", key: "café.txt", want: "site/caf%C3%A9.txt"},
+		{
+			desc:   "access point",
+			bucket: "arn:aws:s3:us-west-2:123456789012:accesspoint/deploy",
+			key:    "docs/index.html",
+			want:   "arn:aws:s3:us-west-2:123456789012:accesspoint/deploy/object/docs/index.html",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := copySource(tC.bucket, tC.key); got != tC.want {
+				t.Errorf("Expected %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
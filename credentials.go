@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+)
+
+const (
+	// credentialRefreshWindow is how long before they expire temporary credentials are refreshed,
+	// so that requests signed just before the expiry, like the parts of a large upload, don't
+	// reach S3 with expired credentials.
+	credentialRefreshWindow = 5 * time.Minute
+	// credentialExpiryWarning is how long before they expire a warning is logged for temporary
+	// credentials that can't be refreshed.
+	credentialExpiryWarning = time.Hour
+)
+
+// refreshEarly configures a credentials cache to refresh credentials within the refresh window
+// before they expire, at a random point so that concurrent runs don't refresh all at once.
+func refreshEarly(o *aws.CredentialsCacheOptions) {
+	o.ExpiryWindow = credentialRefreshWindow
+	o.ExpiryWindowJitterFrac = 0.5
+}
+
+// ssoSources are the credential sources of profiles using IAM Identity Center (AWS SSO), whose
+// credentials are obtained with the token cached by `aws sso login`.
+var ssoSources = []aws.CredentialSource{
+	aws.CredentialSourceSSO,
+	aws.CredentialSourceProfileSSO,
+	aws.CredentialSourceSSOLegacy,
+	aws.CredentialSourceProfileSSOLegacy,
+}
+
+// checkCredentials resolves the credentials before the first request, so that missing ones are
+// reported once, with a hint on how to log in if they come from an expired SSO session, instead
+// of failing every request.
+func checkCredentials(ctx context.Context, provider aws.CredentialsProvider, profile string) error {
+	if provider == nil {
+		return errors.New("no AWS credentials were found")
+	}
+
+	creds, err := provider.Retrieve(ctx)
+	if err == nil {
+		return checkExpiry(creds, time.Now())
+	}
+
+	if !isSSOError(provider, err) {
+		return fmt.Errorf("could not load AWS credentials: %v", err)
+	}
+
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+
+	login := "aws sso login"
+	if profile != "" {
+		login += " --profile " + profile
+	}
+
+	return fmt.Errorf("the AWS SSO session has expired or was never started; run '%s' and try again (%v)", login, err)
+}
+
+// isSSOError reports whether the credentials failed to load because of the SSO session.
+func isSSOError(provider aws.CredentialsProvider, err error) bool {
+	var tokenErr *ssocreds.InvalidTokenError
+	if errors.As(err, &tokenErr) {
+		return true
+	}
+
+	source, ok := provider.(aws.CredentialProviderSource)
+	if !ok {
+		return false
+	}
+
+	return slices.ContainsFunc(source.ProviderSources(), func(s aws.CredentialSource) bool {
+		return slices.Contains(ssoSources, s)
+	})
+}
+
+// checkExpiry fails if temporary credentials that can't be refreshed have expired, and warns if
+// they expire soon. That's the case for session tokens given in AWS_SESSION_TOKEN, whose expiry is
+// only known if AWS_CREDENTIAL_EXPIRATION is set too, as done by `aws configure
+// export-credentials`. Credentials the SDK can refresh, like those of roles and SSO profiles,
+// are refreshed before they expire.
+func checkExpiry(creds aws.Credentials, now time.Time) error {
+	if creds.CanExpire || creds.SessionToken == "" || creds.SessionToken != os.Getenv("AWS_SESSION_TOKEN") {
+		return nil
+	}
+
+	value := os.Getenv("AWS_CREDENTIAL_EXPIRATION")
+	if value == "" {
+		return nil
+	}
+
+	expires, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return fmt.Errorf("invalid AWS_CREDENTIAL_EXPIRATION %q: expected an RFC 3339 time", value)
+	}
+
+	if !expires.After(now) {
+		return fmt.Errorf("the AWS session token in AWS_SESSION_TOKEN expired at %s", expires.Local().Format(time.RFC3339))
+	}
+
+	if expires.Sub(now) < credentialExpiryWarning {
+		log.Printf("The AWS session token in AWS_SESSION_TOKEN expires in %v and can't be refreshed; use a profile or '-role-arn' for longer runs\n", expires.Sub(now).Round(time.Minute))
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+)
+
+// mockCredentialsProvider returns an error, and reports the given credential sources.
+type mockCredentialsProvider struct {
+	err     error
+	sources []aws.CredentialSource
+}
+
+func (p mockCredentialsProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	return aws.Credentials{AccessKeyID: "key", SecretAccessKey: "secret"}, p.err
+}
+
+func (p mockCredentialsProvider) ProviderSources() []aws.CredentialSource {
+	return p.sources
+}
+
+func Test_checkCredentials(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		provider aws.CredentialsProvider
+		profile  string
+		env      string
+		wantErr  string
+	}{
+		{desc: "valid", provider: mockCredentialsProvider{}},
+		{desc: "none", wantErr: "no AWS credentials"},
+		{
+			desc:     "missing",
+			provider: mockCredentialsProvider{err: errors.New("failed to refresh cached credentials")},
+			wantErr:  "could not load AWS credentials",
+		},
+		{
+			desc:     "expired SSO token",
+			provider: mockCredentialsProvider{err: &ssocreds.InvalidTokenError{}},
+			profile:  "dev",
+			wantErr:  "run 'aws sso login --profile dev'",
+		},
+		{
+			desc:     "SSO profile from the environment",
+			provider: mockCredentialsProvider{err: errors.New("refresh cached SSO token failed"), sources: []aws.CredentialSource{aws.CredentialSourceProfileSSO}},
+			env:      "staging",
+			wantErr:  "run 'aws sso login --profile staging'",
+		},
+		{
+			desc:     "SSO without profile",
+			provider: mockCredentialsProvider{err: &ssocreds.InvalidTokenError{}},
+			wantErr:  "run 'aws sso login' and",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Setenv("AWS_PROFILE", tC.env)
+
+			err := checkCredentials(context.Background(), tC.provider, tC.profile)
+			if tC.wantErr == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tC.wantErr) {
+				t.Errorf("Expected an error containing %q; got %v", tC.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_checkExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		desc       string
+		creds      aws.Credentials
+		expiration string
+		wantErr    bool
+	}{
+		{desc: "long-lived keys", creds: aws.Credentials{AccessKeyID: "key"}, expiration: "2024-01-02T11:00:00Z"},
+		{desc: "refreshable", creds: aws.Credentials{SessionToken: "token", CanExpire: true, Expires: now.Add(-time.Minute)}, expiration: "2024-01-02T11:00:00Z"},
+		{desc: "session token without expiration", creds: aws.Credentials{SessionToken: "token"}},
+		{desc: "valid session token", creds: aws.Credentials{SessionToken: "token"}, expiration: "2024-01-02T12:30:00Z"},
+		{desc: "expired session token", creds: aws.Credentials{SessionToken: "token"}, expiration: "2024-01-02T11:59:00Z", wantErr: true},
+		{desc: "invalid expiration", creds: aws.Credentials{SessionToken: "token"}, expiration: "tomorrow", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Setenv("AWS_SESSION_TOKEN", "token")
+			t.Setenv("AWS_CREDENTIAL_EXPIRATION", tC.expiration)
+
+			err := checkExpiry(tC.creds, now)
+			if (err == nil) == tC.wantErr {
+				t.Errorf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+		})
+	}
+}
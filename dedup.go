@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"strings"
+	"sync"
+)
+
+// blobMetadataHeader records the key of the blob a pointer object stands in for, relative to the
+// bucket.
+const blobMetadataHeader = "X-Amz-Meta-S3copy-Blob"
+
+// dedupUploader uploads the contents of every object once, under a key derived from their
+// SHA-256 digest beneath a prefix shared between uploads, e.g. by the preview environments of a
+// monorepo. In place of the object, a pointer object without a body is uploaded, which redirects
+// to the blob when the bucket is served as a website.
+type dedupUploader struct {
+	// client reads and blobs uploads the blobs by their key relative to the prefix.
+	client objectHeader
+	blobs  uploader
+	// prefix is the prefix of the blobs relative to the bucket, e.g. `.blobs/`.
+	prefix string
+	next   uploader
+
+	mu sync.Mutex
+	// stored are the blobs known to exist, which aren't read again.
+	stored map[string]bool
+}
+
+func (u *dedupUploader) Upload(ctx context.Context, object *uploadObject) error {
+	body, ok := object.Body.(io.ReadSeeker)
+	if !ok {
+		return u.next.Upload(ctx, object)
+	}
+
+	digest := sha256.New()
+	if _, err := io.Copy(digest, body); err != nil {
+		return fmt.Errorf("could not hash %s: %v", object.Path, err)
+	}
+
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("could not hash %s: %v", object.Path, err)
+	}
+
+	key := hex.EncodeToString(digest.Sum(nil))
+	if err := u.storeBlob(ctx, key, object); err != nil {
+		return err
+	}
+
+	headers := maps.Clone(object.Headers)
+	if headers == nil {
+		headers = map[string]string{}
+	}
+
+	// The pointer has no body to be encoded.
+	delete(headers, "Content-Encoding")
+	headers[redirectHeader] = "/" + u.prefix + key
+	headers[blobMetadataHeader] = u.prefix + key
+
+	return u.next.Upload(ctx, &uploadObject{
+		Path:        object.Path,
+		Body:        bytes.NewReader(nil),
+		ContentType: object.ContentType,
+		Headers:     headers,
+	})
+}
+
+// storeBlob uploads the body of an object as the blob with the given key, unless it's already
+// stored.
+func (u *dedupUploader) storeBlob(ctx context.Context, key string, object *uploadObject) error {
+	u.mu.Lock()
+	stored := u.stored[key]
+	u.mu.Unlock()
+
+	if stored {
+		return nil
+	}
+
+	_, err := u.client.Head(ctx, key)
+	if errors.Is(err, fs.ErrNotExist) {
+		blob := *object
+		blob.Path = key
+		err = u.blobs.Upload(ctx, &blob)
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not store the contents of %s: %v", object.Path, err)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.stored == nil {
+		u.stored = map[string]bool{}
+	}
+
+	u.stored[key] = true
+
+	return nil
+}
+
+// pointerDownloader downloads the blobs of the pointer objects uploaded by -dedup-prefix in their
+// place. Only objects without a body are read to find out whether they're pointers.
+type pointerDownloader struct {
+	remote map[string]remoteObject
+	client objectHeader
+	// blobs downloads objects by their key relative to the bucket.
+	blobs downloader
+	next  downloader
+}
+
+func (d *pointerDownloader) Download(ctx context.Context, key string, w io.WriterAt) error {
+	if object, ok := d.remote[key]; !ok || object.Size > 0 {
+		return d.next.Download(ctx, key, w)
+	}
+
+	head, err := d.client.Head(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	blob, ok := lowerKeys(head.Metadata)["s3copy-blob"]
+	if !ok {
+		return d.next.Download(ctx, key, w)
+	}
+
+	if !fs.ValidPath(blob) || strings.HasSuffix(blob, "/") {
+		return fmt.Errorf("invalid blob %q", blob)
+	}
+
+	return d.blobs.Download(ctx, blob, w)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_dedupUploader(t *testing.T) {
+	key := fmt.Sprintf("%x", sha256.Sum256([]byte("some body")))
+
+	testCases := []struct {
+		desc      string
+		stored    map[string]objectHead
+		wantBlobs int
+	}{
+		{desc: "new contents", stored: map[string]objectHead{}, wantBlobs: 1},
+		{desc: "stored contents", stored: map[string]objectHead{key: {Size: 9}}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			blobs := &recordingUploader{}
+			client := &recordingUploader{}
+			u := &dedupUploader{client: &mockHeader{objects: tC.stored}, blobs: blobs, prefix: ".blobs/", next: client}
+
+			headers := map[string]string{"Cache-Control": "no-cache", "Content-Encoding": "gzip"}
+			for _, path := range []string{"a.txt", "b.txt"} {
+				object := &uploadObject{Path: path, Body: strings.NewReader("some body"), ContentType: "text/plain", Headers: headers}
+				if err := u.Upload(context.Background(), object); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+
+			if len(blobs.objects) != tC.wantBlobs {
+				t.Fatalf("Expected %d blob(s) to be uploaded; got %d", tC.wantBlobs, len(blobs.objects))
+			}
+
+			if tC.wantBlobs > 0 {
+				if blobs.objects[0].Path != key || blobs.bodies[0] != "some body" {
+					t.Errorf("Expected the body to be uploaded as %s; got %q as %s", key, blobs.bodies[0], blobs.objects[0].Path)
+				}
+
+				if blobs.objects[0].Headers["Content-Encoding"] != "gzip" {
+					t.Errorf("Expected the blob to keep its headers; got %v", blobs.objects[0].Headers)
+				}
+			}
+
+			if len(client.objects) != 2 {
+				t.Fatalf("Expected a pointer for each file; got %d", len(client.objects))
+			}
+
+			pointer := client.objects[1]
+			if client.bodies[1] != "" {
+				t.Errorf("Expected an empty pointer; got %q", client.bodies[1])
+			}
+
+			if want := "/.blobs/" + key; pointer.Headers[redirectHeader] != want {
+				t.Errorf("Expected a redirect to %s; got %q", want, pointer.Headers[redirectHeader])
+			}
+
+			if want := ".blobs/" + key; pointer.Headers[blobMetadataHeader] != want {
+				t.Errorf("Expected the blob %s to be recorded; got %q", want, pointer.Headers[blobMetadataHeader])
+			}
+
+			if _, ok := pointer.Headers["Content-Encoding"]; ok || pointer.Headers["Cache-Control"] != "no-cache" {
+				t.Errorf("Expected the headers without Content-Encoding; got %v", pointer.Headers)
+			}
+
+			if len(headers) != 2 {
+				t.Errorf("Expected the original headers to be left unchanged; got %v", headers)
+			}
+		})
+	}
+}
+
+func Test_dedupUploader_headError(t *testing.T) {
+	u := &dedupUploader{client: &failingHeader{err: errors.New("access denied")}, blobs: &recordingUploader{}, next: &recordingUploader{}}
+
+	err := u.Upload(context.Background(), &uploadObject{Path: "foo.txt", Body: strings.NewReader("some body")})
+	if want := "could not store the contents of foo.txt: access denied"; err == nil || err.Error() != want {
+		t.Errorf("Expected error %q; got %v", want, err)
+	}
+}
+
+func Test_pointerDownloader(t *testing.T) {
+	d := &pointerDownloader{
+		remote: map[string]remoteObject{
+			"pointer.txt": {Key: "pointer.txt"},
+			"empty.txt":   {Key: "empty.txt"},
+			"plain.txt":   {Key: "plain.txt", Size: 12},
+		},
+		client: &mockHeader{objects: map[string]objectHead{
+			"pointer.txt": {Metadata: map[string]string{"S3copy-Blob": ".blobs/0123"}},
+			"empty.txt":   {},
+		}},
+		blobs: &mockDownloader{objects: map[string]string{".blobs/0123": "shared notes"}},
+		next:  &mockDownloader{objects: map[string]string{"pointer.txt": "", "empty.txt": "", "plain.txt": "public notes"}},
+	}
+
+	testCases := []struct {
+		key  string
+		want string
+	}{
+		{key: "pointer.txt", want: "shared notes"},
+		{key: "empty.txt", want: ""},
+		{key: "plain.txt", want: "public notes"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.key, func(t *testing.T) {
+			file, err := os.Create(filepath.Join(t.TempDir(), tC.key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			if err := d.Download(context.Background(), tC.key, file); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got, _ := os.ReadFile(file.Name()); string(got) != tC.want {
+				t.Errorf("Expected %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
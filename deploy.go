@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// deploysDir is the directory, beneath the prefix, that versioned deploys are uploaded to.
+const deploysDir = "deploys/"
+
+// currentDeployPath is the pointer object naming the version that is currently live.
+const currentDeployPath = deploysDir + "current.json"
+
+// deployVersionPattern restricts deploy versions to names that are safe to use as a single key
+// segment, such as a release number or a commit hash.
+var deployVersionPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// deployPointer is the contents of the pointer object.
+type deployPointer struct {
+	Version string `json:"version"`
+	// Prefix is the key prefix of the deploy's objects, relative to the bucket's prefix.
+	Prefix     string    `json:"prefix"`
+	DeployedAt time.Time `json:"deployed_at"`
+}
+
+// validateDeployVersion checks that a version can be used as the name of a deploy.
+func validateDeployVersion(version string) error {
+	if !deployVersionPattern.MatchString(version) || deploysDir+version == currentDeployPath {
+		return fmt.Errorf("invalid deploy version %q: use letters, digits, '.', '_', and '-', starting with a letter or digit", version)
+	}
+
+	return nil
+}
+
+// deployPrefix returns the key prefix, relative to the bucket's prefix, of a deploy's objects.
+func deployPrefix(version string) string {
+	return deploysDir + version + "/"
+}
+
+// readDeployPointer returns the deploy that is currently live. If no deploy was made yet, the
+// error wraps `fs.ErrNotExist`.
+func readDeployPointer(ctx context.Context, store stateStore) (deployPointer, error) {
+	body, err := store.ReadState(ctx, currentDeployPath)
+	if err != nil {
+		return deployPointer{}, err
+	}
+
+	var pointer deployPointer
+	if err := json.Unmarshal(body, &pointer); err != nil {
+		return deployPointer{}, fmt.Errorf("could not parse %s: %v", currentDeployPath, err)
+	}
+
+	return pointer, nil
+}
+
+// writeDeployPointer makes the given version the live deploy.
+func writeDeployPointer(ctx context.Context, store stateStore, version string, now time.Time) error {
+	body, err := json.MarshalIndent(deployPointer{
+		Version:    version,
+		Prefix:     deployPrefix(version),
+		DeployedAt: now.UTC(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return store.WriteState(ctx, currentDeployPath, body)
+}
+
+// runRollback implements the `rollback` command, which points the live deploy at a previous
+// version, or lists the versions if none is given.
+func runRollback(cmd command, args []string) {
+	var common commonFlags
+
+	flags := newFlagSet(cmd, "[flags] [version]")
+	common.register(flags)
+	flags.Parse(args)
+
+	if _, err := common.applyConfig(flags); err != nil {
+		log.Fatal(err)
+	}
+
+	if flags.NArg() > 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	version := flags.Arg(0)
+	if version != "" {
+		if err := validateDeployVersion(version); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	ctx, stop := newSignalContext()
+	defer stop()
+
+	client, err := common.newClient(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store := newS3Uploader(client, common.bucket, "")
+	store.Prefix = normalizePrefix(common.prefix)
+
+	_, prefixes, err := listDirectory(ctx, client, common.bucket, store.Prefix+deploysDir, false)
+	if err != nil {
+		log.Fatal("Could not list deploys: ", err)
+	}
+
+	versions := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		versions[i] = strings.TrimSuffix(prefix, "/")
+	}
+
+	current, err := readDeployPointer(ctx, &store)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Fatal("Could not read the current deploy: ", err)
+	}
+
+	if version == "" {
+		printDeployVersions(os.Stdout, versions, current.Version)
+		return
+	}
+
+	if !slices.Contains(versions, version) {
+		log.Fatalf("No deploy named %s under %s/%s%s", version, common.bucket, store.Prefix, deploysDir)
+	}
+
+	if version == current.Version {
+		log.Printf("%s is already the current deploy\n", version)
+		return
+	}
+
+	if err := writeDeployPointer(ctx, &store, version, time.Now()); err != nil {
+		log.Fatal("Could not update the current deploy: ", err)
+	}
+
+	log.Printf("Switched the current deploy from %s to %s\n", current.Version, version)
+}
+
+// printDeployVersions lists the versions of the deploys, marking the current one with `*`.
+func printDeployVersions(w io.Writer, versions []string, current string) {
+	for _, version := range versions {
+		marker := " "
+		if version == current {
+			marker = "*"
+		}
+
+		fmt.Fprintf(w, "%s %s\n", marker, version)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+	"time"
+)
+
+func Test_validateDeployVersion(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		version string
+		wantErr bool
+	}{
+		{desc: "release", version: "v1.2.3"},
+		{desc: "commit hash", version: "3f9c2e1"},
+		{desc: "empty", version: "", wantErr: true},
+		{desc: "nested", version: "v1/v2", wantErr: true},
+		{desc: "parent directory", version: "..", wantErr: true},
+		{desc: "hidden", version: ".s3-copy", wantErr: true},
+		{desc: "pointer object", version: "current.json", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := validateDeployVersion(tC.version)
+			if (err != nil) != tC.wantErr {
+				t.Errorf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_deployPointer(t *testing.T) {
+	store := &mockStateStore{}
+
+	if _, err := readDeployPointer(context.Background(), store); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected a missing pointer to wrap fs.ErrNotExist; got %v", err)
+	}
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := writeDeployPointer(context.Background(), store, "v2", now); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readDeployPointer(context.Background(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := deployPointer{Version: "v2", Prefix: "deploys/v2/", DeployedAt: now}
+	if got != want {
+		t.Errorf("Expected %+v; got %+v", want, got)
+	}
+}
+
+func Test_printDeployVersions(t *testing.T) {
+	var out bytes.Buffer
+	printDeployVersions(&out, []string{"v1", "v2", "v3"}, "v2")
+
+	want := "  v1\n* v2\n  v3\n"
+	if out.String() != want {
+		t.Errorf("Expected %q; got %q", want, out.String())
+	}
+}
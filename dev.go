@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// defaultDevEndpoint is the MinIO server `-dev` targets, unless S3COPY_DEV_ENDPOINT is set.
+	defaultDevEndpoint = "http://localhost:9000"
+	// defaultDevBucket is the bucket `-dev` uploads to if none is given.
+	defaultDevBucket = "s3-copy-dev"
+	// devContainer is the name of the Docker container `-dev` starts MinIO in.
+	devContainer = "s3-copy-minio"
+	// devImage is the Docker image MinIO is started from.
+	devImage = "minio/minio"
+	// devStartTimeout is how long to wait for a newly started MinIO server to become ready.
+	devStartTimeout = 30 * time.Second
+)
+
+// devCredentials returns the access key and secret MinIO was started with, which are MinIO's
+// defaults unless MINIO_ROOT_USER and MINIO_ROOT_PASSWORD are set.
+func devCredentials() (string, string) {
+	user, password := os.Getenv("MINIO_ROOT_USER"), os.Getenv("MINIO_ROOT_PASSWORD")
+	if user == "" {
+		user = "minioadmin"
+	}
+
+	if password == "" {
+		password = "minioadmin"
+	}
+
+	return user, password
+}
+
+// applyDev points the client at the local MinIO server used for development. The endpoint of the
+// config file is deliberately replaced, so that `-dev` never touches a real bucket.
+func (c *commonFlags) applyDev() error {
+	if !c.dev {
+		return nil
+	}
+
+	if c.provider != "" {
+		return errors.New("the '-dev' and '-provider' flags can't be used together")
+	}
+
+	if c.credentialProcess != "" {
+		return errors.New("the '-dev' and '-credential-process' flags can't be used together")
+	}
+
+	if c.bucket == "" {
+		c.bucket = defaultDevBucket
+	}
+
+	if scheme, _, _ := parseBucketURL(c.bucket, ""); scheme != defaultBackend {
+		return fmt.Errorf("the '-dev' flag only supports S3 buckets, not %s://", scheme)
+	}
+
+	c.endpoint = os.Getenv("S3COPY_DEV_ENDPOINT")
+	if c.endpoint == "" {
+		c.endpoint = defaultDevEndpoint
+	}
+
+	c.pathStyle = true
+
+	return nil
+}
+
+// prepareDev makes sure the MinIO server is running, starting it in Docker if it isn't, and that
+// the bucket exists.
+func (c *commonFlags) prepareDev(ctx context.Context, client *s3.Client) error {
+	endpoint := normalizeEndpoint(c.endpoint)
+	if !devServerReady(ctx, endpoint) {
+		if err := startDevServer(ctx, endpoint); err != nil {
+			return err
+		}
+	}
+
+	_, bucket, _ := parseBucketURL(c.bucket, "")
+
+	return ensureBucket(ctx, client, bucket)
+}
+
+// devServerReady reports whether the MinIO server at the given endpoint is up.
+func devServerReady(ctx context.Context, endpoint string) bool {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(endpoint, "/")+"/minio/health/live", nil)
+	if err != nil {
+		return false
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode == http.StatusOK
+}
+
+// startDevServer starts MinIO in a Docker container listening on the port of the endpoint, and
+// waits until it's ready. Only local endpoints are started, since others can't be reached through
+// a local container anyway.
+func startDevServer(ctx context.Context, endpoint string) error {
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid dev endpoint %q: %v", endpoint, err)
+	}
+
+	if host := endpointURL.Hostname(); host != "localhost" && host != "127.0.0.1" {
+		return fmt.Errorf("no MinIO server is running at %s", endpoint)
+	}
+
+	port := endpointURL.Port()
+	if port == "" {
+		port = "80"
+	}
+
+	if _, err := exec.LookPath("docker"); err != nil {
+		return fmt.Errorf("no MinIO server is running at %s, and Docker isn't installed to start one", endpoint)
+	}
+
+	user, password := devCredentials()
+	cmd := exec.CommandContext(ctx, "docker", "run", "--detach", "--rm",
+		"--name", devContainer,
+		"--publish", port+":9000",
+		"--env", "MINIO_ROOT_USER="+user,
+		"--env", "MINIO_ROOT_PASSWORD="+password,
+		devImage, "server", "/data",
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("could not start MinIO: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	log.Printf("Started MinIO at %s in the Docker container %s\n", endpoint, devContainer)
+
+	deadline := time.Now().Add(devStartTimeout)
+	for !devServerReady(ctx, endpoint) {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("MinIO didn't become ready at %s within %s", endpoint, devStartTimeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+
+	return nil
+}
+
+// ensureBucket creates the bucket unless it already exists.
+func ensureBucket(ctx context.Context, client *s3.Client, bucket string) error {
+	_, err := client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String(bucket)})
+
+	var ownedErr *types.BucketAlreadyOwnedByYou
+	if err != nil && !errors.As(err, &ownedErr) {
+		return fmt.Errorf("could not create bucket %s: %v", bucket, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func Test_commonFlags_applyDev(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		flags        commonFlags
+		env          string
+		wantBucket   string
+		wantEndpoint string
+		wantErr      bool
+	}{
+		{
+			desc:         "disabled",
+			flags:        commonFlags{bucket: "my-site", endpoint: "https://example.com"},
+			wantBucket:   "my-site",
+			wantEndpoint: "https://example.com",
+		},
+		{
+			desc:         "default bucket",
+			flags:        commonFlags{dev: true},
+			wantBucket:   defaultDevBucket,
+			wantEndpoint: defaultDevEndpoint,
+		},
+		{
+			desc:         "configured endpoint is replaced",
+			flags:        commonFlags{dev: true, bucket: "my-site", endpoint: "https://s3.example.com"},
+			wantBucket:   "my-site",
+			wantEndpoint: defaultDevEndpoint,
+		},
+		{
+			desc:         "endpoint from the environment",
+			flags:        commonFlags{dev: true},
+			env:          "http://minio:9000",
+			wantBucket:   defaultDevBucket,
+			wantEndpoint: "http://minio:9000",
+		},
+		{
+			desc:    "provider",
+			flags:   commonFlags{dev: true, provider: "r2"},
+			wantErr: true,
+		},
+		{
+			desc:    "credential process",
+			flags:   commonFlags{dev: true, credentialProcess: "vault-aws-creds"},
+			wantErr: true,
+		},
+		{
+			desc:    "other backend",
+			flags:   commonFlags{dev: true, bucket: "gs://my-site"},
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Setenv("S3COPY_DEV_ENDPOINT", tC.env)
+
+			flags := tC.flags
+			err := flags.applyDev()
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if flags.bucket != tC.wantBucket || flags.endpoint != tC.wantEndpoint || flags.pathStyle != flags.dev {
+				t.Errorf("Unexpected settings: %+v", flags)
+			}
+		})
+	}
+}
+
+func Test_devServerReady(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/minio/health/live" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	if !devServerReady(context.Background(), server.URL) {
+		t.Error("Expected the server to be ready")
+	}
+
+	server.Close()
+
+	if devServerReady(context.Background(), server.URL) {
+		t.Error("Expected a stopped server not to be ready")
+	}
+}
+
+func Test_startDevServer_remote(t *testing.T) {
+	if err := startDevServer(context.Background(), "https://minio.example.com"); err == nil {
+		t.Error("Expected an error for a remote endpoint")
+	}
+}
+
+func Test_ensureBucket(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		status  int
+		body    string
+		wantErr bool
+	}{
+		{desc: "created", status: http.StatusOK},
+		{
+			desc:   "already owned",
+			status: http.StatusConflict,
+			body:   `<Error><Code>BucketAlreadyOwnedByYou</Code><Message>Your previous request to create the named bucket succeeded and you already own it.</Message></Error>`,
+		},
+		{
+			desc:    "access denied",
+			status:  http.StatusForbidden,
+			body:    `<Error><Code>AccessDenied</Code><Message>Access Denied.</Message></Error>`,
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var gotPath string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				w.WriteHeader(tC.status)
+				w.Write([]byte(tC.body))
+			}))
+			defer server.Close()
+
+			client := s3.New(s3.Options{
+				BaseEndpoint: aws.String(server.URL),
+				Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+				Region:       "us-east-1",
+				UsePathStyle: true,
+			})
+
+			err := ensureBucket(context.Background(), client, "my-site")
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if gotPath != "/my-site" {
+				t.Errorf("Expected the bucket to be created; got a request for %s", gotPath)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	syncplan "github.com/Zeroed-Books/s3-copy/pkg/sync"
+)
+
+// runDiff implements the `diff` command, which compares the files in the working directory with
+// the objects in a bucket. The command exits with status 1 when they differ, so that CI can
+// assert that a deploy is in sync.
+func runDiff(cmd command, args []string) {
+	var common commonFlags
+	var jsonOutput bool
+	var brotliPatterns, gzipPatterns, include, exclude stringList
+
+	flags := newFlagSet(cmd, "[flags]")
+	common.register(flags)
+	flags.Var(&brotliPatterns, "brotli", "Glob patterns of files uploaded with a Brotli-compressed '.br' variant, e.g. '*.js,*.css' (repeatable)")
+	flags.Var(&exclude, "exclude", "Glob pattern of files to skip (repeatable)")
+	flags.Var(&gzipPatterns, "gzip", "Glob patterns of files uploaded gzip-compressed, e.g. '*.html,*.css' (repeatable)")
+	flags.Var(&include, "include", "Glob pattern of files to compare; if given, other files are skipped (repeatable)")
+	flags.BoolVar(&jsonOutput, "json", false, "Print the differences as JSON")
+	flags.Parse(args)
+
+	settings, err := common.applyConfig(flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if settings.path != "" && filepath.IsLocal(settings.path) {
+		exclude = append(exclude, filepath.ToSlash(filepath.Clean(settings.path)))
+	}
+
+	filter, err := newPathFilter(include, exclude)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	comp, err := newCompressor(gzipPatterns)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	variants, err := newBrotliVariants(brotliPatterns)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := newSignalContext()
+	defer stop()
+
+	client, err := common.newClient(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	remote, err := listObjects(ctx, client, common.bucket, normalizePrefix(common.prefix))
+	if err != nil {
+		log.Fatal("Could not list objects: ", err)
+	}
+
+	diff, err := diffTree(os.DirFS("./"), remote, filter, comp, variants)
+	if err != nil {
+		log.Fatal("Diff failed: ", err)
+	}
+
+	if jsonOutput {
+		err = diff.WriteJSON(os.Stdout)
+	} else {
+		err = diff.WriteText(os.Stdout)
+	}
+
+	if err != nil {
+		log.Fatal("Could not write diff: ", err)
+	}
+
+	if !diff.Empty() {
+		os.Exit(1)
+	}
+}
+
+// treeDiff lists the differences between a local directory and the objects in a bucket.
+type treeDiff struct {
+	// LocalOnly are the files that don't exist in the bucket.
+	LocalOnly []string `json:"local_only"`
+	// RemoteOnly are the objects that don't exist locally.
+	RemoteOnly []string `json:"remote_only"`
+	// Changed are the files whose contents differ from the object in the bucket.
+	Changed []string `json:"changed"`
+}
+
+// diffTree compares the files in `fsys` with the remote objects, in the form they would be
+// uploaded in.
+func diffTree(fsys fs.FS, remote map[string]remoteObject, filter pathFilter, comp *compressor, variants *brotliVariants) (treeDiff, error) {
+	diff := treeDiff{LocalOnly: []string{}, RemoteOnly: []string{}, Changed: []string{}}
+	seen := map[string]bool{}
+
+	err := fs.WalkDir(fsys, ".", createFilterFunc(filter, createRecordFunc(seen, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("could not walk %s: %v", path, err)
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		if variants.Match(path) {
+			if _, ok := remote[path+brotliExtension]; !ok {
+				diff.LocalOnly = append(diff.LocalOnly, path+brotliExtension)
+			}
+		}
+
+		existing, ok := remote[path]
+		if !ok {
+			diff.LocalOnly = append(diff.LocalOnly, path)
+			return nil
+		}
+
+		unchanged, err := syncplan.Unchanged(fsys, path, entry, existing, comp)
+		if err != nil {
+			return err
+		}
+
+		if !unchanged {
+			diff.Changed = append(diff.Changed, path)
+		}
+
+		return nil
+	})))
+	if err != nil {
+		return treeDiff{}, err
+	}
+
+	addVariantKeys(seen, variants)
+	diff.RemoteOnly = append(diff.RemoteOnly, staleKeys(remote, seen, filter)...)
+	sort.Strings(diff.LocalOnly)
+
+	return diff, nil
+}
+
+// Empty reports whether the local files and the remote objects are the same.
+func (d treeDiff) Empty() bool {
+	return len(d.LocalOnly) == 0 && len(d.RemoteOnly) == 0 && len(d.Changed) == 0
+}
+
+// WriteText writes the differences in a human-readable format, marking files that only exist
+// locally with `+`, objects that only exist remotely with `-`, and changed files with `~`.
+func (d treeDiff) WriteText(w io.Writer) error {
+	for _, group := range []struct {
+		marker string
+		paths  []string
+	}{
+		{marker: "+", paths: d.LocalOnly},
+		{marker: "-", paths: d.RemoteOnly},
+		{marker: "~", paths: d.Changed},
+	} {
+		for _, path := range group.paths {
+			if _, err := fmt.Fprintf(w, "%s %s\n", group.marker, path); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := fmt.Fprintf(
+		w,
+		"\n%d only local, %d only remote, %d changed\n",
+		len(d.LocalOnly),
+		len(d.RemoteOnly),
+		len(d.Changed),
+	)
+
+	return err
+}
+
+// WriteJSON writes the differences as a JSON object.
+func (d treeDiff) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(d)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_diffTree(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":    {Data: []byte("some body")},
+		"app.js":        {Data: []byte("changed")},
+		"new.css":       {Data: []byte("body {}")},
+		"drafts/a.html": {Data: []byte("draft")},
+	}
+	remote := map[string]remoteObject{
+		"index.html":    {Key: "index.html", Size: 9, ETag: "328c30fae61cd119cd177c061d1ac11f"},
+		"app.js":        {Key: "app.js", Size: 7, ETag: "d41d8cd98f00b204e9800998ecf8427e"},
+		"app.js.br":     {Key: "app.js.br", Size: 5},
+		"old.html":      {Key: "old.html", Size: 3},
+		"drafts/b.html": {Key: "drafts/b.html", Size: 3},
+	}
+
+	testCases := []struct {
+		desc    string
+		exclude []string
+		brotli  []string
+		want    treeDiff
+	}{
+		{
+			desc: "all files",
+			want: treeDiff{
+				LocalOnly:  []string{"drafts/a.html", "new.css"},
+				RemoteOnly: []string{"app.js.br", "drafts/b.html", "old.html"},
+				Changed:    []string{"app.js"},
+			},
+		},
+		{
+			desc:    "excluded files",
+			exclude: []string{"drafts/**"},
+			want: treeDiff{
+				LocalOnly:  []string{"new.css"},
+				RemoteOnly: []string{"app.js.br", "old.html"},
+				Changed:    []string{"app.js"},
+			},
+		},
+		{
+			desc:   "brotli variants",
+			brotli: []string{"*.js,*.css"},
+			want: treeDiff{
+				LocalOnly:  []string{"drafts/a.html", "new.css", "new.css.br"},
+				RemoteOnly: []string{"drafts/b.html", "old.html"},
+				Changed:    []string{"app.js"},
+			},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			filter, err := newPathFilter(nil, tC.exclude)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			variants, err := newBrotliVariants(tC.brotli)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			got, err := diffTree(fsys, remote, filter, nil, variants)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("Expected %+v; got %+v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_treeDiff_Write(t *testing.T) {
+	diff := treeDiff{
+		LocalOnly:  []string{"new.css"},
+		RemoteOnly: []string{"old.html"},
+		Changed:    []string{"app.js"},
+	}
+
+	testCases := []struct {
+		desc  string
+		write func(treeDiff, *bytes.Buffer) error
+		want  string
+	}{
+		{
+			desc: "text",
+			write: func(d treeDiff, w *bytes.Buffer) error {
+				return d.WriteText(w)
+			},
+			want: "+ new.css\n- old.html\n~ app.js\n\n1 only local, 1 only remote, 1 changed\n",
+		},
+		{
+			desc: "JSON",
+			write: func(d treeDiff, w *bytes.Buffer) error {
+				return d.WriteJSON(w)
+			},
+			want: "{\n  \"local_only\": [\n    \"new.css\"\n  ],\n  \"remote_only\": [\n    \"old.html\"\n  ],\n  \"changed\": [\n    \"app.js\"\n  ]\n}\n",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := tC.write(diff, &out); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if out.String() != tC.want {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tC.want, out.String())
+			}
+		})
+	}
+}
+
+func Test_treeDiff_Empty(t *testing.T) {
+	if !(treeDiff{}).Empty() {
+		t.Error("Expected a diff without entries to be empty")
+	}
+
+	if (treeDiff{Changed: []string{"a"}}).Empty() {
+		t.Error("Expected a diff with a changed file not to be empty")
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	syncplan "github.com/Zeroed-Books/s3-copy/pkg/sync"
+)
+
+// runDownload implements the `download` command, which mirrors the objects under a prefix to a
+// local directory.
+func runDownload(cmd command, args []string) {
+	var common commonFlags
+	var dest, encryptionPassphraseFile string
+	var concurrency int
+	var dryRunMode, preserve, syncMode bool
+	var include, exclude stringList
+
+	flags := newFlagSet(cmd, "[flags]")
+	common.register(flags)
+	flags.IntVar(&concurrency, "concurrency", 4, "Number of files to download in parallel")
+	flags.StringVar(&dest, "dest", ".", "Directory to download files into")
+	flags.BoolVar(&dryRunMode, "dry-run", false, "Print the files that would be downloaded without writing them")
+	flags.StringVar(&encryptionPassphraseFile, "encryption-passphrase-file", "", "File containing the passphrase objects were encrypted with by 'upload -encryption-passphrase-file', to decrypt them as they're downloaded; objects that aren't encrypted fail to download")
+	flags.Var(&exclude, "exclude", "Glob pattern of objects to skip (repeatable)")
+	flags.Var(&include, "include", "Glob pattern of objects to download; if given, other objects are skipped (repeatable)")
+	flags.BoolVar(&preserve, "preserve", false, "Restore the modification time and permissions stored with objects by 'upload -preserve'")
+	flags.BoolVar(&syncMode, "sync", false, "Only download objects that differ from the local files")
+	flags.Parse(args)
+
+	if _, err := common.applyConfig(flags); err != nil {
+		log.Fatal(err)
+	}
+
+	filter, err := newPathFilter(include, exclude)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if encryptionPassphraseFile != "" && syncMode {
+		log.Fatal("The '-encryption-passphrase-file' flag can't be used together with '-sync', since encrypted objects can't be compared with the local files.")
+	}
+
+	passphraseEncryption, err := newClientEncryption(encryptionPassphraseFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := newSignalContext()
+	defer stop()
+
+	client, err := common.newClient(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	prefix := normalizePrefix(common.prefix)
+	remote, err := listObjects(ctx, client, common.bucket, prefix)
+	if err != nil {
+		log.Fatal("Could not list objects: ", err)
+	}
+
+	store := newS3Uploader(client, common.bucket, "")
+	store.Prefix = prefix
+
+	var objectDownloader downloader = newS3Downloader(client, common.bucket, prefix)
+	objectDownloader = &pointerDownloader{remote: remote, client: &store, blobs: newS3Downloader(client, common.bucket, ""), next: objectDownloader}
+	if passphraseEncryption != nil {
+		objectDownloader = &decryptingDownloader{encryption: passphraseEncryption, next: objectDownloader}
+	}
+
+	downloadFunc := createDownloadFunc(ctx, dest, objectDownloader)
+	if preserve {
+		downloadFunc = createRestoreFunc(ctx, dest, &store, downloadFunc)
+	}
+
+	skipFunc := fs.WalkDirFunc(logSkipped)
+
+	var preview *dryRun
+	if dryRunMode {
+		preview = newDryRun(os.Stdout)
+		downloadFunc = preview.UploadFunc()
+		skipFunc = preview.SkipFunc()
+	}
+
+	if syncMode {
+		downloadFunc = createLocalSyncFunc(os.DirFS(dest), remote, downloadFunc, skipFunc)
+	}
+
+	pool := newUploadPool(ctx, concurrency, false, downloadFunc)
+	walkErr := walkRemote(remote, createFilterFunc(filter, pool.WalkDirFunc()))
+	poolErr := pool.Wait()
+	if ctx.Err() != nil {
+		log.Fatalf("Interrupted: %d file(s) completed before cancellation.", pool.Completed())
+	}
+
+	if poolErr != nil {
+		log.Fatal("Download failed: ", poolErr)
+	}
+
+	if walkErr != nil {
+		log.Fatal("Download failed: ", walkErr)
+	}
+
+	if preview != nil {
+		preview.Summary()
+	}
+}
+
+// remoteEntry presents a remote object as a directory entry, so that listed objects can be
+// passed through the same walk callbacks as local files. Keys ending in `/` are treated as
+// directories.
+type remoteEntry struct {
+	object remoteObject
+}
+
+func (e remoteEntry) Name() string {
+	return filepath.Base(filepath.FromSlash(e.object.Key))
+}
+
+func (e remoteEntry) IsDir() bool {
+	return strings.HasSuffix(e.object.Key, "/")
+}
+
+func (e remoteEntry) Type() fs.FileMode {
+	return e.Mode().Type()
+}
+
+func (e remoteEntry) Info() (fs.FileInfo, error) {
+	return e, nil
+}
+
+func (e remoteEntry) Size() int64 {
+	return e.object.Size
+}
+
+func (e remoteEntry) Mode() fs.FileMode {
+	if e.IsDir() {
+		return fs.ModeDir | 0o755
+	}
+
+	return 0o644
+}
+
+func (e remoteEntry) ModTime() time.Time {
+	return e.object.LastModified
+}
+
+func (e remoteEntry) Sys() interface{} {
+	return nil
+}
+
+// walkRemote calls `walk` for each remote object in key order, the way `filepath.WalkDir` would
+// for local files. Returning `fs.SkipDir` from the callback has no effect, since the objects
+// aren't nested, while `fs.SkipAll` stops the walk without an error.
+func walkRemote(objects map[string]remoteObject, walk fs.WalkDirFunc) error {
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		err := walk(key, remoteEntry{object: objects[key]}, nil)
+		if errors.Is(err, fs.SkipAll) {
+			return nil
+		}
+
+		if err != nil && !errors.Is(err, fs.SkipDir) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createLocalSyncFunc wraps a download callback so that objects matching an existing local file
+// are passed to `skip` instead.
+func createLocalSyncFunc(fsys fs.FS, remote map[string]remoteObject, download, skip fs.WalkDirFunc) fs.WalkDirFunc {
+	return func(key string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return download(key, entry, err)
+		}
+
+		info, err := fs.Stat(fsys, key)
+		if errors.Is(err, fs.ErrNotExist) {
+			return download(key, entry, nil)
+		}
+
+		if err != nil {
+			return fmt.Errorf("could not stat %s: %v", key, err)
+		}
+
+		unchanged, err := syncplan.Unchanged(fsys, key, fs.FileInfoToDirEntry(info), remote[key], nil)
+		if err != nil {
+			return err
+		}
+
+		if unchanged {
+			return skip(key, entry, nil)
+		}
+
+		return download(key, entry, nil)
+	}
+}
+
+// A downloader allows for downloading an object from a remote location.
+type downloader interface {
+	// Download writes the contents of the object with the given key to `w`.
+	Download(ctx context.Context, key string, w io.WriterAt) error
+}
+
+// createDownloadFunc creates a walk callback that downloads each remote object into the
+// destination directory. Files are written to a temporary file first, so that an interrupted
+// download never leaves a partial file in place.
+func createDownloadFunc(ctx context.Context, dest string, client downloader) fs.WalkDirFunc {
+	return func(key string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("could not list %s: %v", key, err)
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		relative := filepath.FromSlash(key)
+		if !filepath.IsLocal(relative) {
+			return fmt.Errorf("refusing to download %s outside of %s", key, dest)
+		}
+
+		target := filepath.Join(dest, relative)
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return fmt.Errorf("could not create directory for %s: %v", key, err)
+		}
+
+		file, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*.tmp")
+		if err != nil {
+			return fmt.Errorf("could not create file for %s: %v", key, err)
+		}
+		defer os.Remove(file.Name())
+
+		err = client.Download(ctx, key, file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to download %s: %v", key, err)
+		}
+
+		if err := os.Chmod(file.Name(), 0o644); err != nil {
+			return fmt.Errorf("could not set permissions of %s: %v", key, err)
+		}
+
+		if err := os.Rename(file.Name(), target); err != nil {
+			return fmt.Errorf("could not move %s into place: %v", key, err)
+		}
+
+		if info, err := entry.Info(); err == nil && !info.ModTime().IsZero() {
+			os.Chtimes(target, info.ModTime(), info.ModTime())
+		}
+
+		log.Printf("Downloaded %s\n", key)
+
+		return nil
+	}
+}
+
+// s3Downloader implements downloading objects from an S3-compatible storage backend.
+type s3Downloader struct {
+	// base is the client used to perform the downloads
+	base *manager.Downloader
+	// bucket is the storage bucket to download objects from
+	bucket string
+	// prefix is prepended to keys to form the full object key
+	prefix string
+}
+
+func newS3Downloader(client *s3.Client, bucket, prefix string) *s3Downloader {
+	return &s3Downloader{
+		base:   manager.NewDownloader(client),
+		bucket: bucket,
+		prefix: prefix,
+	}
+}
+
+func (d *s3Downloader) Download(ctx context.Context, key string, w io.WriterAt) error {
+	_, err := d.base.Download(ctx, w, &s3.GetObjectInput{
+		Bucket: aws.String(d.bucket),
+		Key:    aws.String(d.prefix + key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to download from S3: %w", err)
+	}
+
+	return nil
+}
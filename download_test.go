@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockDownloader writes the contents of a map of objects.
+type mockDownloader struct {
+	objects map[string]string
+}
+
+func (d *mockDownloader) Download(ctx context.Context, key string, w io.WriterAt) error {
+	contents, ok := d.objects[key]
+	if !ok {
+		return errors.New("no such key")
+	}
+
+	_, err := w.WriteAt([]byte(contents), 0)
+
+	return err
+}
+
+func Test_walkRemote(t *testing.T) {
+	objects := map[string]remoteObject{
+		"b.txt":      {Key: "b.txt"},
+		"a/":         {Key: "a/"},
+		"a/file.txt": {Key: "a/file.txt"},
+		"c.txt":      {Key: "c.txt"},
+	}
+
+	var visited []string
+	err := walkRemote(objects, func(path string, entry fs.DirEntry, err error) error {
+		visited = append(visited, path)
+		if entry.IsDir() {
+			return fs.SkipDir
+		}
+
+		if path == "b.txt" {
+			return fs.SkipAll
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got := strings.Join(visited, ","); got != "a/,a/file.txt,b.txt" {
+		t.Errorf("Expected objects to be visited in key order until skipped; got %s", got)
+	}
+}
+
+func Test_createDownloadFunc(t *testing.T) {
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	client := &mockDownloader{objects: map[string]string{
+		"index.html":    "<html>",
+		"assets/app.js": "console.log('hi')",
+	}}
+
+	testCases := []struct {
+		desc     string
+		key      string
+		wantBody string
+		wantErr  bool
+	}{
+		{desc: "top-level file", key: "index.html", wantBody: "<html>"},
+		{desc: "nested file", key: "assets/app.js", wantBody: "console.log('hi')"},
+		{desc: "missing object", key: "missing.txt", wantErr: true},
+		{desc: "outside destination", key: "../escape.txt", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			dest := t.TempDir()
+			download := createDownloadFunc(context.Background(), dest, client)
+
+			entry := remoteEntry{object: remoteObject{Key: tC.key, LastModified: modTime}}
+			err := download(tC.key, entry, nil)
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if tC.wantErr {
+				files, _ := os.ReadDir(dest)
+				if len(files) != 0 {
+					t.Errorf("Expected no files to be left behind; got %d", len(files))
+				}
+
+				return
+			}
+
+			target := filepath.Join(dest, filepath.FromSlash(tC.key))
+			body, err := os.ReadFile(target)
+			if err != nil {
+				t.Fatalf("Could not read downloaded file: %v", err)
+			}
+
+			if string(body) != tC.wantBody {
+				t.Errorf("Expected body %q; got %q", tC.wantBody, body)
+			}
+
+			info, _ := os.Stat(target)
+			if !info.ModTime().Equal(modTime) {
+				t.Errorf("Expected modification time %v; got %v", modTime, info.ModTime())
+			}
+		})
+	}
+}
+
+func Test_createLocalSyncFunc(t *testing.T) {
+	fsys := &mockFS{
+		files: map[string]mockFile{
+			"foo.txt": {body: strings.NewReader("some body")},
+		},
+	}
+
+	remote := map[string]remoteObject{
+		"foo.txt": {Key: "foo.txt", Size: 9, ETag: "328c30fae61cd119cd177c061d1ac11f"},
+		"new.txt": {Key: "new.txt", Size: 3},
+	}
+
+	var downloaded, skipped []string
+	download := func(path string, entry fs.DirEntry, err error) error {
+		downloaded = append(downloaded, path)
+		return nil
+	}
+	skip := func(path string, entry fs.DirEntry, err error) error {
+		skipped = append(skipped, path)
+		return nil
+	}
+
+	syncFunc := createLocalSyncFunc(statFS{fsys, map[string]int64{"foo.txt": 9}}, remote, download, skip)
+	if err := walkRemote(remote, syncFunc); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if strings.Join(downloaded, ",") != "new.txt" || strings.Join(skipped, ",") != "foo.txt" {
+		t.Errorf("Expected new.txt to be downloaded and foo.txt skipped; got %v and %v", downloaded, skipped)
+	}
+}
+
+// statFS adds file sizes to a mockFS so that it can be used with `fs.Stat`.
+type statFS struct {
+	*mockFS
+	sizes map[string]int64
+}
+
+func (f statFS) Stat(name string) (fs.FileInfo, error) {
+	size, ok := f.sizes[name]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+
+	return mockFileInfo{name: name, size: size}, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+)
+
+// dryRun reports the changes a run would make, in a diff-like format, without performing them.
+// Uploads are prefixed with `+`, unchanged files with `=`, and deletions with `-`.
+type dryRun struct {
+	out io.Writer
+
+	mu          sync.Mutex
+	uploads     int
+	uploadBytes int64
+	skips       int
+	deletes     int
+	deleteBytes int64
+}
+
+func newDryRun(out io.Writer) *dryRun {
+	return &dryRun{out: out}
+}
+
+// UploadFunc returns a callback that reports each file as an upload.
+func (d *dryRun) UploadFunc() fs.WalkDirFunc {
+	return d.createReportFunc("+", func(size int64) {
+		d.uploads++
+		d.uploadBytes += size
+	})
+}
+
+// SkipFunc returns a callback that reports each file as unchanged.
+func (d *dryRun) SkipFunc() fs.WalkDirFunc {
+	return d.createReportFunc("=", func(int64) {
+		d.skips++
+	})
+}
+
+func (d *dryRun) createReportFunc(marker string, count func(size int64)) fs.WalkDirFunc {
+	return func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("could not walk %s: %v", path, err)
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("could not stat %s: %v", path, err)
+		}
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		count(info.Size())
+		fmt.Fprintf(d.out, "%s %s (%s)\n", marker, path, formatBytes(info.Size()))
+
+		return nil
+	}
+}
+
+// Delete reports each of the given remote objects as a deletion.
+func (d *dryRun) Delete(objects []remoteObject) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, object := range objects {
+		d.deletes++
+		d.deleteBytes += object.Size
+		fmt.Fprintf(d.out, "- %s (%s)\n", object.Key, formatBytes(object.Size))
+	}
+}
+
+// Redirect reports a redirect object as an upload.
+func (d *dryRun) Redirect(r redirect) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.uploads++
+	fmt.Fprintf(d.out, "+ %s -> %s\n", r.Key(), r.To)
+}
+
+// Summary prints the totals of everything reported so far.
+func (d *dryRun) Summary() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	fmt.Fprintf(
+		d.out,
+		"\n%d to upload (%s), %d unchanged, %d to delete (%s)\n",
+		d.uploads,
+		formatBytes(d.uploadBytes),
+		d.skips,
+		d.deletes,
+		formatBytes(d.deleteBytes),
+	)
+}
+
+// formatBytes renders a byte count using binary units, e.g. `1.5 KiB`.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
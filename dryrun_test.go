@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_formatBytes(t *testing.T) {
+	testCases := []struct {
+		desc string
+		n    int64
+		want string
+	}{
+		{desc: "zero", n: 0, want: "0 B"},
+		{desc: "bytes", n: 1023, want: "1023 B"},
+		{desc: "kibibytes", n: 1536, want: "1.5 KiB"},
+		{desc: "mebibytes", n: 5 * 1024 * 1024, want: "5.0 MiB"},
+		{desc: "gibibytes", n: 3 * 1024 * 1024 * 1024, want: "3.0 GiB"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := formatBytes(tC.n); got != tC.want {
+				t.Errorf("Expected %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_dryRun(t *testing.T) {
+	var out bytes.Buffer
+	preview := newDryRun(&out)
+
+	if err := preview.UploadFunc()("new.txt", mockFileInfo{name: "new.txt", size: 2048}, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := preview.SkipFunc()("same.txt", mockFileInfo{name: "same.txt", size: 12}, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	preview.Delete([]remoteObject{{Key: "old.txt", Size: 100}})
+	preview.Summary()
+
+	want := "+ new.txt (2.0 KiB)\n" +
+		"= same.txt (12 B)\n" +
+		"- old.txt (100 B)\n" +
+		"\n1 to upload (2.0 KiB), 1 unchanged, 1 to delete (100 B)\n"
+	if out.String() != want {
+		t.Errorf("Expected output:\n%s\ngot:\n%s", want, out.String())
+	}
+}
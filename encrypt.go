@@ -0,0 +1,443 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	// encryptionScheme names the client-side encryption in the metadata of encrypted objects.
+	encryptionScheme = "aes-256-gcm-pbkdf2"
+	// encryptionMetadataHeader records the scheme of encrypted objects.
+	encryptionMetadataHeader = "X-Amz-Meta-S3copy-Encryption"
+	// encryptionMagic starts every encrypted object, so that they're recognized when downloaded.
+	encryptionMagic = "S3COPY-AESGCM-1\n"
+	// encryptionChunkSize is the size of the chunks bodies are encrypted in, each of which is
+	// authenticated on its own so that bodies can be decrypted as they're read.
+	encryptionChunkSize = 64 * 1024
+	// encryptionSaltSize is the size of the salts of the passphrase and of each object's key.
+	encryptionSaltSize = 16
+	// encryptionIterations is the number of PBKDF2 iterations deriving the key from the
+	// passphrase, as recommended by OWASP for PBKDF2-HMAC-SHA256.
+	encryptionIterations = 600_000
+	// encryptionHeaderSize is the size of the header preceding the chunks: the magic, the number
+	// of iterations, the salt of the passphrase, and the salt of the object's key.
+	encryptionHeaderSize = len(encryptionMagic) + 4 + 2*encryptionSaltSize
+)
+
+// clientEncryption encrypts bodies before they're uploaded, for buckets on providers that
+// shouldn't be able to read them, and decrypts them again when they're downloaded. Bodies are
+// split into chunks sealed with AES-256-GCM, under a key derived for each object from a key
+// derived from the passphrase with PBKDF2.
+type clientEncryption struct {
+	passphrase string
+	// salt and key are the salt of the passphrase used for encrypting, and the key derived with
+	// it, which is derived once per run since that's deliberately slow.
+	salt []byte
+	key  []byte
+
+	mu sync.Mutex
+	// keys caches the keys derived for decrypting objects, by the salt and iterations they were
+	// encrypted with.
+	keys map[string][]byte
+}
+
+// newClientEncryption reads the passphrase from a file, ignoring a trailing newline. If no file
+// is given, nil is returned and bodies are left as they are.
+func newClientEncryption(passphraseFile string) (*clientEncryption, error) {
+	if passphraseFile == "" {
+		return nil, nil
+	}
+
+	contents, err := os.ReadFile(passphraseFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read encryption passphrase: %v", err)
+	}
+
+	passphrase := strings.TrimRight(string(contents), "\r\n")
+	if passphrase == "" {
+		return nil, fmt.Errorf("invalid encryption passphrase: %s is empty", passphraseFile)
+	}
+
+	return &clientEncryption{passphrase: passphrase, keys: map[string][]byte{}}, nil
+}
+
+// derivedKey returns the key derived from the passphrase with the given salt and iterations.
+func (e *clientEncryption) derivedKey(salt []byte, iterations int) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	id := fmt.Sprintf("%x/%d", salt, iterations)
+	if key, ok := e.keys[id]; ok {
+		return key, nil
+	}
+
+	key, err := pbkdf2.Key(sha256.New, e.passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	e.keys[id] = key
+
+	return key, nil
+}
+
+// objectCipher returns the cipher of an object whose key is derived with the given salt.
+func objectCipher(key, salt []byte) (cipher.AEAD, error) {
+	objectKey, err := hkdf.Key(sha256.New, key, salt, "s3-copy object key", 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(objectKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce returns the nonce of the chunk at the given index: the index as a big-endian number,
+// followed by a byte marking the last chunk, so that truncated bodies fail to decrypt.
+func chunkNonce(index int64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], uint64(index))
+	if last {
+		nonce[11] = 1
+	}
+
+	return nonce
+}
+
+// Encrypt returns the encrypted form of a body, which is produced as it's read. Encrypted bodies
+// of seekable bodies are seekable too, so that uploads can be retried.
+func (e *clientEncryption) Encrypt(body io.Reader) (io.Reader, error) {
+	e.mu.Lock()
+	if e.salt == nil {
+		salt := make([]byte, encryptionSaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			e.mu.Unlock()
+			return nil, err
+		}
+
+		e.salt = salt
+	}
+	e.mu.Unlock()
+
+	key, err := e.derivedKey(e.salt, encryptionIterations)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, encryptionHeaderSize)
+	header = append(header, encryptionMagic...)
+	header = binary.BigEndian.AppendUint32(header, encryptionIterations)
+	header = append(header, e.salt...)
+
+	objectSalt := make([]byte, encryptionSaltSize)
+	if _, err := rand.Read(objectSalt); err != nil {
+		return nil, err
+	}
+
+	header = append(header, objectSalt...)
+
+	aead, err := objectCipher(key, objectSalt)
+	if err != nil {
+		return nil, err
+	}
+
+	seeker, ok := body.(io.ReadSeeker)
+	if !ok {
+		return &encryptingStream{pending: header, aead: aead, body: bufio.NewReader(body), plain: make([]byte, encryptionChunkSize)}, nil
+	}
+
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := max((end-start+encryptionChunkSize-1)/encryptionChunkSize, 1)
+
+	return &encryptingReader{
+		header:    header,
+		aead:      aead,
+		body:      seeker,
+		start:     start,
+		plainSize: end - start,
+		size:      int64(len(header)) + end - start + chunks*int64(aead.Overhead()),
+		index:     -1,
+	}, nil
+}
+
+// encryptingReader encrypts a seekable body as it's read, a chunk at a time. Seeking to any
+// offset encrypts the chunk containing it again, which results in the same bytes.
+type encryptingReader struct {
+	header []byte
+	aead   cipher.AEAD
+	body   io.ReadSeeker
+	// start is the offset of the body to encrypt from.
+	start     int64
+	plainSize int64
+	// size is the size of the encrypted body, and pos the offset into it.
+	size int64
+	pos  int64
+	// chunk is the sealed chunk at `index`, or -1 if none was sealed yet.
+	chunk []byte
+	index int64
+}
+
+func (r *encryptingReader) Read(b []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.pos < int64(len(r.header)) {
+		n := copy(b, r.header[r.pos:])
+		r.pos += int64(n)
+
+		return n, nil
+	}
+
+	sealedSize := int64(encryptionChunkSize + r.aead.Overhead())
+	offset := r.pos - int64(len(r.header))
+	if index := offset / sealedSize; index != r.index {
+		if err := r.seal(index); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(b, r.chunk[offset-r.index*sealedSize:])
+	r.pos += int64(n)
+
+	return n, nil
+}
+
+// seal encrypts the chunk at the given index.
+func (r *encryptingReader) seal(index int64) error {
+	offset := index * encryptionChunkSize
+	if _, err := r.body.Seek(r.start+offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	plain := make([]byte, min(encryptionChunkSize, r.plainSize-offset))
+	if _, err := io.ReadFull(r.body, plain); err != nil {
+		return fmt.Errorf("could not read the body to encrypt: %v", err)
+	}
+
+	last := offset+int64(len(plain)) >= r.plainSize
+	r.chunk = r.aead.Seal(r.chunk[:0], chunkNonce(index, last), plain, nil)
+	r.index = index
+
+	return nil
+}
+
+func (r *encryptingReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.size
+	}
+
+	if offset < 0 {
+		return 0, errors.New("seek before the start of the encrypted body")
+	}
+
+	r.pos = offset
+
+	return offset, nil
+}
+
+// encryptingStream encrypts a body that can't seek as it's read, looking ahead to find the last
+// chunk.
+type encryptingStream struct {
+	aead cipher.AEAD
+	body *bufio.Reader
+	// pending is the encrypted output that wasn't read yet.
+	pending []byte
+	plain   []byte
+	index   int64
+	done    bool
+}
+
+func (s *encryptingStream) Read(b []byte) (int, error) {
+	for len(s.pending) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+
+		n, err := io.ReadFull(s.body, s.plain)
+		last := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+		if err != nil && !last {
+			return 0, err
+		}
+
+		if !last {
+			if _, err := s.body.Peek(1); errors.Is(err, io.EOF) {
+				last = true
+			} else if err != nil {
+				return 0, err
+			}
+		}
+
+		s.pending = s.aead.Seal(s.pending[:0], chunkNonce(s.index, last), s.plain[:n], nil)
+		s.index++
+		s.done = last
+	}
+
+	n := copy(b, s.pending)
+	s.pending = s.pending[n:]
+
+	return n, nil
+}
+
+// Decrypt writes the decrypted form of an encrypted body to `w`. It fails if the body was
+// encrypted with another passphrase, or was changed or truncated since.
+func (e *clientEncryption) Decrypt(w io.Writer, body io.Reader) error {
+	header := make([]byte, encryptionHeaderSize)
+	if _, err := io.ReadFull(body, header); err != nil || !bytes.HasPrefix(header, []byte(encryptionMagic)) {
+		return errors.New("not encrypted by s3-copy")
+	}
+
+	fields := header[len(encryptionMagic):]
+	iterations := int(binary.BigEndian.Uint32(fields))
+	salt, objectSalt := fields[4:4+encryptionSaltSize], fields[4+encryptionSaltSize:]
+
+	// The header can't be trusted before the first chunk was authenticated, and deriving the key
+	// with an arbitrary number of iterations could take hours.
+	if iterations != encryptionIterations {
+		return fmt.Errorf("unsupported key derivation: %d PBKDF2 iterations; expected %d", iterations, encryptionIterations)
+	}
+
+	key, err := e.derivedKey(salt, iterations)
+	if err != nil {
+		return err
+	}
+
+	aead, err := objectCipher(key, objectSalt)
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(body)
+	sealed := make([]byte, encryptionChunkSize+aead.Overhead())
+	var plain []byte
+	for index := int64(0); ; index++ {
+		n, err := io.ReadFull(r, sealed)
+		last := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+		if err != nil && !last {
+			return err
+		}
+
+		if !last {
+			if _, err := r.Peek(1); errors.Is(err, io.EOF) {
+				last = true
+			} else if err != nil {
+				return err
+			}
+		}
+
+		plain, err = aead.Open(plain[:0], chunkNonce(index, last), sealed[:n], nil)
+		if err != nil {
+			return errors.New("could not decrypt: wrong passphrase, or the object was changed or truncated")
+		}
+
+		if _, err := w.Write(plain); err != nil {
+			return err
+		}
+
+		if last {
+			return nil
+		}
+	}
+}
+
+// isEncrypted reports whether a body starts like the bodies encrypted by s3-copy.
+func isEncrypted(r io.ReaderAt) bool {
+	magic := make([]byte, len(encryptionMagic))
+	n, _ := r.ReadAt(magic, 0)
+
+	return n == len(magic) && string(magic) == encryptionMagic
+}
+
+// encryptUploader encrypts the bodies of objects before passing them on to another uploader, and
+// records the scheme in their metadata.
+type encryptUploader struct {
+	encryption *clientEncryption
+	next       uploader
+}
+
+func (u *encryptUploader) Upload(ctx context.Context, object *uploadObject) error {
+	body, err := u.encryption.Encrypt(object.Body)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s: %v", object.Path, err)
+	}
+
+	// The headers may be shared between uploads, e.g. those of website aliases, so they're
+	// copied before being modified.
+	headers := maps.Clone(object.Headers)
+	if headers == nil {
+		headers = map[string]string{}
+	}
+
+	headers[encryptionMetadataHeader] = encryptionScheme
+
+	encrypted := *object
+	encrypted.Body = body
+	encrypted.Headers = headers
+
+	return u.next.Upload(ctx, &encrypted)
+}
+
+// decryptingDownloader decrypts the objects encrypted by s3-copy as they're downloaded. Other
+// objects fail to download, since a plaintext object put in place of an encrypted one would
+// otherwise go unnoticed.
+type decryptingDownloader struct {
+	encryption *clientEncryption
+	next       downloader
+}
+
+// Download downloads the object into a temporary file first, since objects are downloaded in
+// parts out of order, but must be decrypted in order.
+func (d *decryptingDownloader) Download(ctx context.Context, key string, w io.WriterAt) error {
+	file, err := os.CreateTemp("", "s3-copy-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if err := d.next.Download(ctx, key, file); err != nil {
+		return err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if !isEncrypted(file) {
+		return fmt.Errorf("object %s is not encrypted", key)
+	}
+
+	return d.encryption.Decrypt(io.NewOffsetWriter(w, 0), file)
+}
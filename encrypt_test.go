@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestEncryption returns the client-side encryption of a passphrase.
+func newTestEncryption(t *testing.T, passphrase string) *clientEncryption {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "passphrase")
+	if err := os.WriteFile(path, []byte(passphrase+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	encryption, err := newClientEncryption(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return encryption
+}
+
+// encryptTestBody returns a body of the given size encrypted as a seekable body or as a stream.
+func encryptTestBody(t *testing.T, encryption *clientEncryption, plain []byte, stream bool) []byte {
+	t.Helper()
+
+	var body io.Reader = bytes.NewReader(plain)
+	if stream {
+		body = struct{ io.Reader }{body}
+	}
+
+	encrypted, err := encryption.Encrypt(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := io.ReadAll(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func Test_newClientEncryption(t *testing.T) {
+	if encryption, err := newClientEncryption(""); encryption != nil || err != nil {
+		t.Errorf("Expected no encryption without a passphrase file; got %v, %v", encryption, err)
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty")
+	os.WriteFile(empty, []byte("\n"), 0o600)
+	if _, err := newClientEncryption(empty); err == nil {
+		t.Error("Expected an error for an empty passphrase")
+	}
+
+	if _, err := newClientEncryption(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Expected an error for a missing passphrase file")
+	}
+}
+
+func Test_clientEncryption_roundTrip(t *testing.T) {
+	encryption := newTestEncryption(t, "correct horse battery staple")
+
+	testCases := []struct {
+		desc string
+		size int
+	}{
+		{desc: "empty", size: 0},
+		{desc: "small", size: 11},
+		{desc: "one chunk", size: encryptionChunkSize},
+		{desc: "one chunk and a byte", size: encryptionChunkSize + 1},
+		{desc: "several chunks", size: 3*encryptionChunkSize - 5},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			plain := bytes.Repeat([]byte("0123456789"), tC.size/10+1)[:tC.size]
+
+			for _, stream := range []bool{false, true} {
+				encrypted := encryptTestBody(t, encryption, plain, stream)
+				if bytes.Contains(encrypted, []byte("0123456789")) {
+					t.Errorf("Expected the body to be encrypted (stream: %v)", stream)
+				}
+
+				var decrypted bytes.Buffer
+				if err := encryption.Decrypt(&decrypted, bytes.NewReader(encrypted)); err != nil {
+					t.Fatalf("Unexpected error (stream: %v): %v", stream, err)
+				}
+
+				if !bytes.Equal(decrypted.Bytes(), plain) {
+					t.Errorf("Expected the decrypted body to match (stream: %v); got %d bytes instead of %d", stream, decrypted.Len(), len(plain))
+				}
+			}
+		})
+	}
+}
+
+func Test_encryptingReader_Seek(t *testing.T) {
+	encryption := newTestEncryption(t, "secret")
+	plain := bytes.Repeat([]byte("abcdefgh"), encryptionChunkSize/4)
+
+	body, err := encryption.Encrypt(bytes.NewReader(plain))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seeker := body.(io.ReadSeeker)
+	size, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := int64(encryptionHeaderSize + len(plain) + 2*16); size != want {
+		t.Errorf("Expected a size of %d; got %d", want, size)
+	}
+
+	seeker.Seek(0, io.SeekStart)
+	whole, err := io.ReadAll(seeker)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if int64(len(whole)) != size {
+		t.Errorf("Expected to read %d bytes; got %d", size, len(whole))
+	}
+
+	// Seeking back into the first chunk encrypts it again, with the same result.
+	offset := int64(encryptionHeaderSize + 100)
+	seeker.Seek(offset, io.SeekStart)
+	rest, err := io.ReadAll(seeker)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(rest, whole[offset:]) {
+		t.Error("Expected the body read after seeking to match")
+	}
+}
+
+func Test_clientEncryption_Decrypt_errors(t *testing.T) {
+	encryption := newTestEncryption(t, "secret")
+	plain := bytes.Repeat([]byte("x"), 2*encryptionChunkSize)
+	encrypted := encryptTestBody(t, encryption, plain, false)
+
+	tampered := bytes.Clone(encrypted)
+	tampered[len(tampered)/2] ^= 1
+
+	testCases := []struct {
+		desc       string
+		encryption *clientEncryption
+		body       []byte
+	}{
+		{desc: "wrong passphrase", encryption: newTestEncryption(t, "guess"), body: encrypted},
+		{desc: "tampered", encryption: encryption, body: tampered},
+		{desc: "truncated", encryption: encryption, body: encrypted[:encryptionHeaderSize+encryptionChunkSize+16]},
+		{desc: "not encrypted", encryption: encryption, body: plain},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if err := tC.encryption.Decrypt(io.Discard, bytes.NewReader(tC.body)); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func Test_clientEncryption_Decrypt_iterations(t *testing.T) {
+	encryption := newTestEncryption(t, "secret")
+	encrypted := encryptTestBody(t, encryption, []byte("secret notes"), false)
+
+	testCases := []struct {
+		desc       string
+		iterations uint32
+	}{
+		{desc: "none", iterations: 0},
+		{desc: "fewer", iterations: 1},
+		{desc: "maximum", iterations: math.MaxUint32},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			tampered := bytes.Clone(encrypted)
+			binary.BigEndian.PutUint32(tampered[len(encryptionMagic):], tC.iterations)
+
+			err := encryption.Decrypt(io.Discard, bytes.NewReader(tampered))
+			if err == nil || !strings.Contains(err.Error(), "unsupported key derivation") {
+				t.Errorf("Expected the iterations to be rejected; got %v", err)
+			}
+		})
+	}
+}
+
+func Test_encryptUploader(t *testing.T) {
+	encryption := newTestEncryption(t, "secret")
+	headers := map[string]string{"Cache-Control": "no-cache"}
+
+	client := &recordingUploader{}
+	u := &encryptUploader{encryption: encryption, next: client}
+	object := &uploadObject{Path: "index.html", Body: strings.NewReader("<html>"), ContentType: "text/html", Headers: headers}
+	if err := u.Upload(context.Background(), object); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	uploaded := client.objects[0]
+	if uploaded.Headers[encryptionMetadataHeader] != encryptionScheme || uploaded.Headers["Cache-Control"] != "no-cache" {
+		t.Errorf("Expected the scheme to be added to the headers; got %v", uploaded.Headers)
+	}
+
+	if _, ok := headers[encryptionMetadataHeader]; ok {
+		t.Error("Expected the original headers to be left unchanged")
+	}
+
+	var decrypted bytes.Buffer
+	if err := encryption.Decrypt(&decrypted, strings.NewReader(client.bodies[0])); err != nil || decrypted.String() != "<html>" {
+		t.Errorf("Expected the uploaded body to decrypt to the file; got %q, %v", decrypted.String(), err)
+	}
+}
+
+func Test_decryptingDownloader(t *testing.T) {
+	encryption := newTestEncryption(t, "secret")
+	encrypted := encryptTestBody(t, encryption, []byte("secret notes"), false)
+
+	d := &decryptingDownloader{
+		encryption: encryption,
+		next:       &mockDownloader{objects: map[string]string{"notes.txt": string(encrypted), "plain.txt": "public notes"}},
+	}
+
+	testCases := []struct {
+		key     string
+		want    string
+		wantErr string
+	}{
+		{key: "notes.txt", want: "secret notes"},
+		{key: "plain.txt", wantErr: "object plain.txt is not encrypted"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.key, func(t *testing.T) {
+			file, err := os.Create(filepath.Join(t.TempDir(), tC.key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			err = d.Download(context.Background(), tC.key, file)
+			if tC.wantErr != "" {
+				if err == nil || err.Error() != tC.wantErr {
+					t.Errorf("Expected error %q; got %v", tC.wantErr, err)
+				}
+
+				if got, _ := os.ReadFile(file.Name()); len(got) > 0 {
+					t.Errorf("Expected nothing to be written; got %q", got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got, _ := os.ReadFile(file.Name()); string(got) != tC.want {
+				t.Errorf("Expected %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// endpointSettings select variants of the AWS endpoints for S3 and STS: FIPS endpoints, which
+// only use FIPS 140 validated cryptography as required in GovCloud and other compliance
+// environments, and dual-stack endpoints, which are also reachable over IPv6.
+type endpointSettings struct {
+	fips      bool
+	dualStack bool
+	// accelerate sends S3 requests through the bucket's Transfer Acceleration endpoint, which
+	// routes them over the AWS network from the nearest edge location.
+	accelerate bool
+}
+
+// applyEndpoints validates the endpoint variants, which only exist for AWS's own endpoints.
+func (c *commonFlags) applyEndpoints() error {
+	for _, setting := range []struct {
+		name  string
+		given bool
+	}{
+		{name: "fips", given: c.endpoints.fips},
+		{name: "dualstack", given: c.endpoints.dualStack},
+		{name: "accelerate", given: c.endpoints.accelerate},
+	} {
+		if !setting.given {
+			continue
+		}
+
+		switch {
+		case c.dev:
+			return fmt.Errorf("the '-dev' and '-%s' flags can't be used together", setting.name)
+		case c.provider != "":
+			return fmt.Errorf("the '-provider' and '-%s' flags can't be used together", setting.name)
+		case c.endpoint != "":
+			return fmt.Errorf("the '-endpoint' and '-%s' flags can't be used together", setting.name)
+		}
+	}
+
+	if !c.endpoints.accelerate {
+		return nil
+	}
+
+	if c.endpoints.fips {
+		return errors.New("the '-fips' and '-accelerate' flags can't be used together")
+	}
+
+	if c.pathStyle {
+		return errors.New("the '-force-path-style' and '-accelerate' flags can't be used together")
+	}
+
+	// The accelerate endpoint addresses buckets by host name, which doesn't work for buckets with
+	// dots in their name.
+	if scheme, bucket, _ := parseBucketURL(c.bucket, ""); scheme == defaultBackend && strings.Contains(bucket, ".") {
+		return fmt.Errorf("transfer acceleration doesn't support bucket %s, whose name contains dots", bucket)
+	}
+
+	return nil
+}
+
+// configOptions returns the options to load the AWS configuration with to select the variants.
+// Without them, the variants are selected by AWS_USE_FIPS_ENDPOINT and AWS_USE_DUALSTACK_ENDPOINT,
+// or the shared config files.
+func (e endpointSettings) configOptions() []func(*config.LoadOptions) error {
+	var options []func(*config.LoadOptions) error
+	if e.fips {
+		options = append(options, config.WithUseFIPSEndpoint(aws.FIPSEndpointStateEnabled))
+	}
+
+	if e.dualStack {
+		options = append(options, config.WithUseDualStackEndpoint(aws.DualStackEndpointStateEnabled))
+	}
+
+	return options
+}
+
+// accelerateConfigurationGetter reads the Transfer Acceleration setting of a bucket.
+type accelerateConfigurationGetter interface {
+	GetBucketAccelerateConfiguration(ctx context.Context, params *s3.GetBucketAccelerateConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketAccelerateConfigurationOutput, error)
+}
+
+// checkAccelerate fails if Transfer Acceleration isn't enabled on the bucket, as every request to
+// its accelerate endpoint would fail. Identities that may not read the setting only get a
+// warning, as they may still be allowed to use the endpoint.
+func checkAccelerate(ctx context.Context, client accelerateConfigurationGetter, bucket string) error {
+	output, err := client.GetBucketAccelerateConfiguration(
+		ctx,
+		&s3.GetBucketAccelerateConfigurationInput{Bucket: aws.String(bucket)},
+		func(o *s3.Options) {
+			o.UseAccelerate = false
+		},
+	)
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "AccessDenied" {
+		log.Printf("Could not check whether transfer acceleration is enabled on bucket %s: %v\n", bucket, err)
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not check whether transfer acceleration is enabled on bucket %s: %v", bucket, err)
+	}
+
+	if output.Status != types.BucketAccelerateStatusEnabled {
+		return fmt.Errorf("transfer acceleration isn't enabled on bucket %s; enable it with 'aws s3api put-bucket-accelerate-configuration --bucket %s --accelerate-configuration Status=Enabled'", bucket, bucket)
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// hostRecorder is an HTTP client recording the host of the requests it receives, to which it
+// responds with an empty object listing.
+type hostRecorder struct {
+	hosts []string
+}
+
+func (r *hostRecorder) Do(req *http.Request) (*http.Response, error) {
+	r.hosts = append(r.hosts, req.URL.Host)
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(listResponse)),
+		Request:    req,
+	}, nil
+}
+
+// mockAccelerateConfigurationGetter returns a fixed acceleration status or error, and records
+// whether requests would have been sent to the accelerate endpoint.
+type mockAccelerateConfigurationGetter struct {
+	status      types.BucketAccelerateStatus
+	err         error
+	accelerated bool
+}
+
+func (m *mockAccelerateConfigurationGetter) GetBucketAccelerateConfiguration(ctx context.Context, params *s3.GetBucketAccelerateConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketAccelerateConfigurationOutput, error) {
+	options := s3.Options{UseAccelerate: true}
+	for _, fn := range optFns {
+		fn(&options)
+	}
+
+	m.accelerated = options.UseAccelerate
+
+	return &s3.GetBucketAccelerateConfigurationOutput{Status: m.status}, m.err
+}
+
+func Test_commonFlags_applyEndpoints(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		flags   commonFlags
+		wantErr bool
+	}{
+		{desc: "none", flags: commonFlags{endpoint: "https://minio.internal:9000"}},
+		{desc: "fips and dual-stack", flags: commonFlags{endpoints: endpointSettings{fips: true, dualStack: true}}},
+		{desc: "fips with endpoint", flags: commonFlags{endpoint: "https://minio.internal:9000", endpoints: endpointSettings{fips: true}}, wantErr: true},
+		{desc: "dual-stack with provider", flags: commonFlags{provider: "r2", endpoint: "https://abc123.r2.cloudflarestorage.com", endpoints: endpointSettings{dualStack: true}}, wantErr: true},
+		{desc: "fips with dev", flags: commonFlags{dev: true, endpoint: defaultDevEndpoint, endpoints: endpointSettings{fips: true}}, wantErr: true},
+		{desc: "accelerate", flags: commonFlags{bucket: "my-site", endpoints: endpointSettings{accelerate: true, dualStack: true}}},
+		{desc: "accelerate with endpoint", flags: commonFlags{bucket: "my-site", endpoint: "https://minio.internal:9000", endpoints: endpointSettings{accelerate: true}}, wantErr: true},
+		{desc: "accelerate with fips", flags: commonFlags{bucket: "my-site", endpoints: endpointSettings{accelerate: true, fips: true}}, wantErr: true},
+		{desc: "accelerate with path-style addressing", flags: commonFlags{bucket: "my-site", pathStyle: true, endpoints: endpointSettings{accelerate: true}}, wantErr: true},
+		{desc: "accelerate with dots in bucket name", flags: commonFlags{bucket: "www.example.com/site", endpoints: endpointSettings{accelerate: true}}, wantErr: true},
+		{desc: "accelerate with other backend", flags: commonFlags{bucket: "gs://www.example.com", endpoints: endpointSettings{accelerate: true}}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := tC.flags.applyEndpoints()
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_endpointSettings_configOptions(t *testing.T) {
+	t.Setenv("AWS_USE_FIPS_ENDPOINT", "")
+	t.Setenv("AWS_USE_DUALSTACK_ENDPOINT", "")
+	t.Setenv("AWS_CA_BUNDLE", "")
+
+	testCases := []struct {
+		desc     string
+		settings endpointSettings
+		region   string
+		want     string
+	}{
+		{desc: "default", region: "us-east-1", want: "my-site.s3.us-east-1.amazonaws.com"},
+		{desc: "fips", settings: endpointSettings{fips: true}, region: "us-gov-west-1", want: "my-site.s3-fips.us-gov-west-1.amazonaws.com"},
+		{desc: "dual-stack", settings: endpointSettings{dualStack: true}, region: "eu-west-1", want: "my-site.s3.dualstack.eu-west-1.amazonaws.com"},
+		{desc: "fips and dual-stack", settings: endpointSettings{fips: true, dualStack: true}, region: "us-east-1", want: "my-site.s3-fips.dualstack.us-east-1.amazonaws.com"},
+		{desc: "accelerate", settings: endpointSettings{accelerate: true}, region: "eu-west-1", want: "my-site.s3-accelerate.amazonaws.com"},
+		{desc: "accelerate and dual-stack", settings: endpointSettings{accelerate: true, dualStack: true}, region: "eu-west-1", want: "my-site.s3-accelerate.dualstack.amazonaws.com"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			recorder := &hostRecorder{}
+			options := append(
+				tC.settings.configOptions(),
+				config.WithRegion(tC.region),
+				config.WithHTTPClient(recorder),
+				config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("key", "secret", "")),
+			)
+
+			awsConfig, err := config.LoadDefaultConfig(context.Background(), options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := s3.NewFromConfig(awsConfig, func(o *s3.Options) {
+				o.UseAccelerate = tC.settings.accelerate
+			})
+
+			_, err = client.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{Bucket: aws.String("my-site")})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(recorder.hosts) != 1 || recorder.hosts[0] != tC.want {
+				t.Errorf("Expected a request to %s; got requests to %v", tC.want, recorder.hosts)
+			}
+		})
+	}
+}
+
+func Test_checkAccelerate(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		client  *mockAccelerateConfigurationGetter
+		wantErr bool
+	}{
+		{desc: "enabled", client: &mockAccelerateConfigurationGetter{status: types.BucketAccelerateStatusEnabled}},
+		{desc: "suspended", client: &mockAccelerateConfigurationGetter{status: types.BucketAccelerateStatusSuspended}, wantErr: true},
+		{desc: "never enabled", client: &mockAccelerateConfigurationGetter{}, wantErr: true},
+		{desc: "access denied", client: &mockAccelerateConfigurationGetter{err: &smithy.GenericAPIError{Code: "AccessDenied"}}},
+		{desc: "missing bucket", client: &mockAccelerateConfigurationGetter{err: &smithy.GenericAPIError{Code: "NoSuchBucket"}}, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := checkAccelerate(context.Background(), tC.client, "my-site")
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if tC.client.accelerated {
+				t.Error("Expected the check to bypass the accelerate endpoint")
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// archiveFS is the contents of an archive given with -from-archive, whose entries are uploaded
+// as if they were the files of the working directory.
+type archiveFS struct {
+	fs.FS
+	walk   treeWalker
+	closer io.Closer
+	// sequential is set for compressed tarballs, whose files are read one at a time, in the order
+	// they're stored in.
+	sequential bool
+}
+
+// Walker returns a tree walker over the entries of the archive.
+func (a *archiveFS) Walker() treeWalker {
+	return a.walk
+}
+
+// Close closes the archive file, if it's still open.
+func (a *archiveFS) Close() error {
+	if a.closer == nil {
+		return nil
+	}
+
+	return a.closer.Close()
+}
+
+// openArchiveFS opens a `.zip`, `.tar.gz`, `.tgz`, or `.tar` archive as a filesystem, without
+// extracting it to disk. Zip archives and uncompressed tarballs are read in place as their entries
+// are opened. Compressed tarballs can only be read in order, so their entries are decompressed as
+// they're reached while walking the archive.
+func openArchiveFS(name string) (*archiveFS, error) {
+	lower := strings.ToLower(name)
+	if strings.HasSuffix(lower, ".zip") {
+		archive, err := zip.OpenReader(name)
+		if err != nil {
+			return nil, fmt.Errorf("could not open %s: %v", name, err)
+		}
+
+		if err := checkZipNames(&archive.Reader); err != nil {
+			archive.Close()
+			return nil, fmt.Errorf("can't upload %s: %v", name, err)
+		}
+
+		walk := func(walk fs.WalkDirFunc) error {
+			return fs.WalkDir(archive, ".", walk)
+		}
+
+		return &archiveFS{FS: archive, walk: walk, closer: archive}, nil
+	}
+
+	var compressed bool
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		compressed = true
+	case strings.HasSuffix(lower, ".tar"):
+	default:
+		return nil, fmt.Errorf("can't upload %s: expected a '.zip', '.tar.gz', '.tgz', or '.tar' archive", name)
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %v", name, err)
+	}
+
+	tarball := &tarFS{file: file, compressed: compressed, files: map[string]*tarEntry{}}
+	if err := tarball.index(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("could not read %s: %v", name, err)
+	}
+
+	return &archiveFS{FS: tarball, walk: tarball.Walker(), closer: file, sequential: compressed}, nil
+}
+
+// archiveEntryName returns the slash-separated path of an archive entry, without a leading `./`.
+// Paths leading outside of the archive are rejected.
+func archiveEntryName(name string) (string, error) {
+	cleaned := path.Clean(strings.TrimPrefix(name, "./"))
+	if !fs.ValidPath(cleaned) || cleaned == "." {
+		return "", fmt.Errorf("invalid path %q in archive", name)
+	}
+
+	return cleaned, nil
+}
+
+// checkZipNames rejects zip archives with entries that would be uploaded outside of the prefix,
+// which the filesystem of the archive would otherwise quietly rename.
+func checkZipNames(archive *zip.Reader) error {
+	for _, file := range archive.File {
+		if _, err := archiveEntryName(strings.TrimSuffix(file.Name, "/")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tarFS is the filesystem of a tarball, whose headers are read once to find its regular files.
+// The files of an uncompressed tarball are read in place. Those of a compressed tarball are read
+// by decompressing it from the start, which is only done again when a file stored before the one
+// opened last is opened, and only one of them can be open at a time.
+type tarFS struct {
+	file       *os.File
+	compressed bool
+	files      map[string]*tarEntry
+	// order are the paths of the files, in the order they're stored in.
+	order []string
+
+	// mu is held while a file of a compressed tarball is open.
+	mu     sync.Mutex
+	stream *tar.Reader
+	// next is the index of the header the stream reads next.
+	next int
+}
+
+// tarEntry is a regular file in a tarball.
+type tarEntry struct {
+	info fs.FileInfo
+	// index is the position of its header, counting every entry of the tarball.
+	index int
+	// offset is the position of its contents in an uncompressed tarball.
+	offset int64
+}
+
+// index reads the headers of the tarball. Links and other special entries are left out, as are
+// sparse files, whose contents aren't stored as they're read.
+func (t *tarFS) index() error {
+	archive, err := t.rewind()
+	if err != nil {
+		return err
+	}
+
+	for index := 0; ; index++ {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		name, err := archiveEntryName(header.Name)
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag != tar.TypeReg || isSparse(header) {
+			log.Printf("Skipping %s: not a regular file\n", name)
+			continue
+		}
+
+		entry := &tarEntry{info: header.FileInfo(), index: index}
+		if !t.compressed {
+			// The reader doesn't buffer, so the file is positioned at the contents of the entry.
+			entry.offset, err = t.file.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return err
+			}
+		}
+
+		// A later entry with the same path replaces the file, as it would when extracted.
+		if _, ok := t.files[name]; !ok {
+			t.order = append(t.order, name)
+		}
+
+		t.files[name] = entry
+	}
+}
+
+// rewind returns a reader of the tarball from its first header.
+func (t *tarFS) rewind() (*tar.Reader, error) {
+	if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	if !t.compressed {
+		return tar.NewReader(t.file), nil
+	}
+
+	gz, err := gzip.NewReader(t.file)
+	if err != nil {
+		return nil, err
+	}
+
+	return tar.NewReader(gz), nil
+}
+
+// Open opens a file of the tarball. A file of a compressed tarball has to be closed before the
+// next one can be opened.
+func (t *tarFS) Open(name string) (fs.File, error) {
+	entry, ok := t.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if !t.compressed {
+		return &tarFile{SectionReader: io.NewSectionReader(t.file, entry.offset, entry.info.Size()), info: entry.info}, nil
+	}
+
+	t.mu.Lock()
+	if err := t.seek(entry.index); err != nil {
+		t.mu.Unlock()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return &tarStreamFile{Reader: t.stream, info: entry.info, release: t.mu.Unlock}, nil
+}
+
+// seek advances the stream of a compressed tarball to the header at `index`, starting over if it
+// already went past it.
+func (t *tarFS) seek(index int) error {
+	if t.stream == nil || t.next > index {
+		stream, err := t.rewind()
+		if err != nil {
+			return err
+		}
+
+		t.stream, t.next = stream, 0
+	}
+
+	for ; t.next <= index; t.next++ {
+		if _, err := t.stream.Next(); err != nil {
+			t.stream = nil
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Walker returns a tree walker over the files of the tarball in the order they're stored in, so
+// that a compressed tarball is read from start to finish once.
+func (t *tarFS) Walker() treeWalker {
+	return func(walk fs.WalkDirFunc) error {
+		for _, name := range t.order {
+			err := walk(name, fs.FileInfoToDirEntry(t.files[name].info), nil)
+			if errors.Is(err, fs.SkipAll) {
+				return nil
+			}
+
+			if err != nil && !errors.Is(err, fs.SkipDir) {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// isSparse reports whether a tarball entry is a sparse file, whose holes aren't stored.
+func isSparse(header *tar.Header) bool {
+	for key := range header.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tarFile is an open file of an uncompressed tarball, which can be read again after a failed
+// upload.
+type tarFile struct {
+	*io.SectionReader
+	info fs.FileInfo
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *tarFile) Close() error {
+	return nil
+}
+
+// tarStreamFile is an open file of a compressed tarball, which lets the next file be opened once
+// it's closed.
+type tarStreamFile struct {
+	io.Reader
+	info    fs.FileInfo
+	release func()
+}
+
+func (f *tarStreamFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *tarStreamFile) Close() error {
+	if f.release != nil {
+		f.release()
+		f.release = nil
+	}
+
+	return nil
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTestTar writes a tarball with the given entries, gzip-compressed if the name ends in
+// `.gz` or `.tgz`, and returns its path.
+func writeTestTar(t *testing.T, name string, headers []tar.Header, contents []string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	archive := tar.NewWriter(&buf)
+	for i, header := range headers {
+		header.Size = int64(len(contents[i]))
+		if header.Mode == 0 {
+			header.Mode = 0o644
+		}
+
+		if err := archive.WriteHeader(&header); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := archive.Write([]byte(contents[i])); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	body := buf.Bytes()
+	if ext := filepath.Ext(name); ext == ".gz" || ext == ".tgz" {
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		gz.Write(body)
+		gz.Close()
+		body = compressed.Bytes()
+	}
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, body, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// writeTestZip writes a zip archive with the given files and returns its path.
+func writeTestZip(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, contents := range files {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w.Write([]byte(contents))
+	}
+
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "bundle.zip")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// readArchiveFS returns the contents of the files walked in an archive by path.
+func readArchiveFS(t *testing.T, bundle *archiveFS) map[string]string {
+	t.Helper()
+
+	contents := map[string]string{}
+	err := bundle.Walker()(func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		data, err := fs.ReadFile(bundle, path)
+		contents[path] = string(data)
+
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return contents
+}
+
+func Test_openArchiveFS(t *testing.T) {
+	headers := []tar.Header{
+		{Name: "./", Typeflag: tar.TypeDir},
+		{Name: "./index.html", Typeflag: tar.TypeReg},
+		{Name: "./assets/app.js", Typeflag: tar.TypeReg},
+		{Name: "./latest", Typeflag: tar.TypeSymlink, Linkname: "index.html"},
+	}
+	contents := []string{"", "<html>", "alert(1)", ""}
+	want := map[string]string{"index.html": "<html>", "assets/app.js": "alert(1)"}
+
+	testCases := []struct {
+		desc string
+		path string
+	}{
+		{desc: "tar.gz", path: writeTestTar(t, "bundle.tar.gz", headers, contents)},
+		{desc: "tgz", path: writeTestTar(t, "bundle.tgz", headers, contents)},
+		{desc: "tar", path: writeTestTar(t, "bundle.tar", headers, contents)},
+		{desc: "zip", path: writeTestZip(t, map[string]string{"index.html": "<html>", "assets/app.js": "alert(1)"})},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			bundle, err := openArchiveFS(tC.path)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer bundle.Close()
+
+			if got := readArchiveFS(t, bundle); !reflect.DeepEqual(got, want) {
+				t.Errorf("Expected files %v; got %v", want, got)
+			}
+		})
+	}
+}
+
+func Test_openArchiveFS_errors(t *testing.T) {
+	testCases := []struct {
+		desc string
+		path string
+	}{
+		{desc: "unknown extension", path: writeTestZip(t, nil) + ".rar"},
+		{desc: "tar outside of archive", path: writeTestTar(t, "bundle.tar", []tar.Header{{Name: "../evil.html", Typeflag: tar.TypeReg}}, []string{"x"})},
+		{desc: "zip outside of archive", path: writeTestZip(t, map[string]string{"../evil.html": "x"})},
+		{desc: "missing", path: filepath.Join(t.TempDir(), "missing.zip")},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if bundle, err := openArchiveFS(tC.path); err == nil {
+				bundle.Close()
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func Test_openArchiveFS_tarOrder(t *testing.T) {
+	headers := []tar.Header{
+		{Name: "z.html", Typeflag: tar.TypeReg},
+		{Name: "a.html", Typeflag: tar.TypeReg},
+		{Name: "z.html", Typeflag: tar.TypeReg},
+	}
+	contents := []string{"old", "a", "new"}
+
+	testCases := []struct {
+		desc     string
+		path     string
+		seekable bool
+	}{
+		{desc: "tar.gz", path: writeTestTar(t, "bundle.tar.gz", headers, contents)},
+		{desc: "tar", path: writeTestTar(t, "bundle.tar", headers, contents), seekable: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			bundle, err := openArchiveFS(tC.path)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer bundle.Close()
+
+			var walked []string
+			bundle.Walker()(func(path string, entry fs.DirEntry, err error) error {
+				walked = append(walked, path)
+				return err
+			})
+
+			if want := []string{"z.html", "a.html"}; !reflect.DeepEqual(walked, want) {
+				t.Errorf("Expected the files in the order they're stored in, %v; got %v", want, walked)
+			}
+
+			// Files stored before the one read last can still be read.
+			for _, read := range []struct{ path, want string }{{"a.html", "a"}, {"z.html", "new"}, {"a.html", "a"}} {
+				file, err := bundle.Open(read.path)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+
+				data, err := io.ReadAll(file)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+
+				if _, ok := file.(io.Seeker); ok != tC.seekable {
+					t.Errorf("Expected %s to be seekable: %v", read.path, tC.seekable)
+				}
+
+				file.Close()
+
+				if string(data) != read.want {
+					t.Errorf("Expected %s to contain %q; got %q", read.path, read.want, data)
+				}
+			}
+
+			if _, err := bundle.Open("missing.html"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Expected a missing file not to exist; got %v", err)
+			}
+		})
+	}
+}
+
+func Test_archiveEntryName(t *testing.T) {
+	testCases := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "index.html", want: "index.html"},
+		{name: "./docs/index.html", want: "docs/index.html"},
+		{name: "docs//guide/../index.html", want: "docs/index.html"},
+		{name: "/etc/passwd", wantErr: true},
+		{name: "../index.html", wantErr: true},
+		{name: "./", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.name, func(t *testing.T) {
+			got, err := archiveEntryName(tC.name)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if got != tC.want {
+				t.Errorf("Expected %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// fanoutAll fails an upload unless it succeeded at every destination.
+	fanoutAll = "all"
+	// fanoutReport stops uploading to a destination once an upload to it failed, continues with
+	// the others, and reports the failed destinations at the end of the run.
+	fanoutReport = "report"
+
+	// fanoutMemoryLimit is the size up to which bodies are buffered in memory to be sent to every
+	// destination. Larger bodies are buffered in a temporary file.
+	fanoutMemoryLimit = 8 * mebibyte
+)
+
+// fanoutStatus counts the uploads to a destination over a whole run.
+type fanoutStatus struct {
+	uploaded atomic.Int64
+	failed   atomic.Int64
+}
+
+// fanoutDestination is one of the backends a fan-out uploads to.
+type fanoutDestination struct {
+	name  string
+	store backend
+	// upload uploads to the store, retrying transient failures on its own so that a slow or
+	// failing destination doesn't cause the others to be uploaded to again.
+	upload uploader
+	status *fanoutStatus
+}
+
+// fanoutBackend uploads to several backends in parallel, e.g. to a bucket and its replicas in
+// other regions or with other providers. The first destination is the primary one: it holds the
+// deploy lock, and the state read by later runs is read from it.
+type fanoutBackend struct {
+	destinations []fanoutDestination
+	// report continues uploading to the other destinations when one fails, instead of failing
+	// the upload.
+	report     bool
+	maxRetries int
+	limiter    *concurrencyLimiter
+}
+
+// newFanoutBackend creates a backend uploading to every one of the named stores, the first of
+// which is the primary one.
+func newFanoutBackend(names []string, stores []backend, policy string, maxRetries int, limiter *concurrencyLimiter) (*fanoutBackend, error) {
+	if policy != fanoutAll && policy != fanoutReport {
+		return nil, fmt.Errorf("unknown fan-out policy %q; expected '%s' or '%s'", policy, fanoutAll, fanoutReport)
+	}
+
+	f := &fanoutBackend{report: policy == fanoutReport, maxRetries: maxRetries, limiter: limiter}
+	for i, store := range stores {
+		f.destinations = append(f.destinations, f.destination(names[i], store, &fanoutStatus{}))
+	}
+
+	return f, nil
+}
+
+func (f *fanoutBackend) destination(name string, store backend, status *fanoutStatus) fanoutDestination {
+	retryClient := newRetryUploader(store, f.maxRetries)
+	retryClient.limiter = f.limiter
+
+	return fanoutDestination{name: name, store: store, upload: retryClient, status: status}
+}
+
+// active returns the destinations that are still uploaded to. With the report policy, those that
+// had a failure are left out.
+func (f *fanoutBackend) active() []fanoutDestination {
+	if !f.report {
+		return f.destinations
+	}
+
+	var active []fanoutDestination
+	for _, d := range f.destinations {
+		if d.status.failed.Load() == 0 {
+			active = append(active, d)
+		}
+	}
+
+	return active
+}
+
+// Upload sends the object to every active destination in parallel. The body is buffered first, so
+// that each destination can read, and retry, it independently.
+func (f *fanoutBackend) Upload(ctx context.Context, object *uploadObject) error {
+	body, size, cleanup, err := spoolBody(object.Body)
+	if err != nil {
+		return fmt.Errorf("could not buffer %s: %v", object.Path, err)
+	}
+	defer cleanup()
+
+	destinations := f.active()
+	if len(destinations) == 0 {
+		return errors.New("every destination failed")
+	}
+
+	errs := make([]error, len(destinations))
+	var wg sync.WaitGroup
+	for i, d := range destinations {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			copied := *object
+			copied.Body = io.NewSectionReader(body, 0, size)
+			errs[i] = d.upload.Upload(ctx, &copied)
+			if errs[i] != nil {
+				d.status.failed.Add(1)
+			} else {
+				d.status.uploaded.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var failures []string
+	for i, err := range errs {
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", destinations[i].name, err))
+		}
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+
+	if f.report && len(failures) < len(destinations) {
+		for _, failure := range failures {
+			log.Printf("Could not upload %s to %s; no more files will be uploaded to it\n", object.Path, failure)
+		}
+
+		return nil
+	}
+
+	// The destinations already retried on their own, so the error isn't wrapped to keep it from
+	// being retried again.
+	return fmt.Errorf("failed to upload %s to %s", object.Path, strings.Join(failures, "; "))
+}
+
+// spoolBody buffers a body so that it can be read by several destinations at once, in memory if
+// it is small and in a temporary file otherwise. The cleanup function removes the file.
+func spoolBody(r io.Reader) (io.ReaderAt, int64, func(), error) {
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, r, fanoutMemoryLimit+1)
+	if err == io.EOF {
+		return bytes.NewReader(buf.Bytes()), n, func() {}, nil
+	}
+
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	file, err := os.CreateTemp("", "s3-copy-fanout")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	cleanup := func() {
+		file.Close()
+		os.Remove(file.Name())
+	}
+
+	size, err := io.Copy(file, io.MultiReader(&buf, r))
+	if err != nil {
+		cleanup()
+		return nil, 0, nil, err
+	}
+
+	return file, size, cleanup, nil
+}
+
+// List returns the objects of every destination. Objects that aren't the same at every destination
+// are listed without an ETag, so that they are uploaded again. Their size is that of the primary
+// destination's object, if it has one.
+func (f *fanoutBackend) List(ctx context.Context) (map[string]remoteObject, error) {
+	destinations := f.active()
+	listings := make([]map[string]remoteObject, len(destinations))
+	for i, d := range destinations {
+		objects, err := d.store.List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", d.name, err)
+		}
+
+		listings[i] = objects
+	}
+
+	merged := map[string]remoteObject{}
+	for _, objects := range listings {
+		for key, object := range objects {
+			if _, ok := merged[key]; ok {
+				continue
+			}
+
+			for _, other := range listings {
+				if found, ok := other[key]; !ok || found.Size != object.Size || found.ETag != object.ETag {
+					object.ETag = ""
+					break
+				}
+			}
+
+			merged[key] = object
+		}
+	}
+
+	return merged, nil
+}
+
+// Head returns the properties of the primary destination's object, after checking that every
+// other destination has an object of the same size.
+func (f *fanoutBackend) Head(ctx context.Context, path string) (objectHead, error) {
+	destinations := f.active()
+	if len(destinations) == 0 {
+		return objectHead{}, errors.New("every destination failed")
+	}
+
+	head, err := destinations[0].store.Head(ctx, path)
+	if err != nil {
+		return objectHead{}, fmt.Errorf("%s: %w", destinations[0].name, err)
+	}
+
+	for _, d := range destinations[1:] {
+		replica, err := d.store.Head(ctx, path)
+		if err != nil {
+			return objectHead{}, fmt.Errorf("%s: %w", d.name, err)
+		}
+
+		if replica.Size != head.Size {
+			return objectHead{}, fmt.Errorf("%s: stored %d bytes instead of %d", d.name, replica.Size, head.Size)
+		}
+	}
+
+	return head, nil
+}
+
+// Delete deletes the objects from every destination. With the report policy, destinations that
+// had a failure are left alone, like a run with failed uploads deletes nothing.
+func (f *fanoutBackend) Delete(ctx context.Context, paths []string) error {
+	for _, d := range f.destinations {
+		if f.report && d.status.failed.Load() > 0 {
+			log.Printf("Not deleting from %s after failed uploads\n", d.name)
+			continue
+		}
+
+		if err := d.store.Delete(ctx, paths); err != nil {
+			if !f.report {
+				return fmt.Errorf("%s: %w", d.name, err)
+			}
+
+			log.Printf("Could not delete from %s: %v\n", d.name, err)
+			d.status.failed.Add(1)
+		}
+	}
+
+	return nil
+}
+
+func (f *fanoutBackend) Sub(dir string) backend {
+	sub := *f
+	sub.destinations = make([]fanoutDestination, len(f.destinations))
+	for i, d := range f.destinations {
+		sub.destinations[i] = f.destination(d.name, d.store.Sub(dir), d.status)
+	}
+
+	return &sub
+}
+
+func (f *fanoutBackend) URL() string {
+	return f.destinations[0].store.URL()
+}
+
+func (f *fanoutBackend) ReadState(ctx context.Context, path string) ([]byte, error) {
+	return f.destinations[0].store.ReadState(ctx, path)
+}
+
+// WriteState writes the state file to every destination, so that e.g. each serves the current
+// deploy version.
+func (f *fanoutBackend) WriteState(ctx context.Context, path string, body []byte) error {
+	for i, d := range f.destinations {
+		if err := d.store.WriteState(ctx, path, body); err != nil {
+			if !f.report || i == 0 {
+				return fmt.Errorf("%s: %w", d.name, err)
+			}
+
+			log.Printf("Could not write %s to %s: %v\n", path, d.name, err)
+			d.status.failed.Add(1)
+		}
+	}
+
+	return nil
+}
+
+func (f *fanoutBackend) CreateState(ctx context.Context, path string, body []byte) (string, error) {
+	return f.destinations[0].store.CreateState(ctx, path, body)
+}
+
+func (f *fanoutBackend) ReadStateETag(ctx context.Context, path string) ([]byte, string, error) {
+	return f.destinations[0].store.ReadStateETag(ctx, path)
+}
+
+func (f *fanoutBackend) DeleteState(ctx context.Context, path, etag string) error {
+	return f.destinations[0].store.DeleteState(ctx, path, etag)
+}
+
+// Summary logs the number of files uploaded to each destination, and returns the number of
+// destinations that had a failure.
+func (f *fanoutBackend) Summary() int {
+	failed := 0
+	for _, d := range f.destinations {
+		uploaded, failures := d.status.uploaded.Load(), d.status.failed.Load()
+		if failures > 0 {
+			failed++
+			log.Printf("Destination %s: %d file(s) uploaded, FAILED\n", d.name, uploaded)
+		} else {
+			log.Printf("Destination %s: %d file(s) uploaded\n", d.name, uploaded)
+		}
+	}
+
+	return failed
+}
+
+// destinationFlags returns the settings for deploying to the named environment of the config file
+// in addition to the main destination. Settings the environment doesn't have are taken from the
+// top level of the config file, or from the environment selected with `-env`, but not from the
+// command line, except for `-dev`, the SSH, proxy, and TLS flags, `-request-payer`, and the session
+// name, session tags, and OIDC token of assumed roles.
+func (c *configFile) destinationFlags(name string, main *commonFlags) (commonFlags, error) {
+	replica := *c
+	if err := replica.selectEnvironment(name); err != nil {
+		return commonFlags{}, err
+	}
+
+	// Without its own bucket, the environment would upload to the main destination again.
+	if c.Environments[name].Bucket == "" {
+		return commonFlags{}, fmt.Errorf("the %s environment doesn't set a bucket", name)
+	}
+
+	flags := commonFlags{
+		accountID:         replica.AccountID,
+		bucket:            replica.Bucket,
+		credentialProcess: replica.CredentialProcess,
+		endpoint:          replica.Endpoint,
+		prefix:            replica.Prefix,
+		profile:           replica.Profile,
+		provider:          replica.Provider,
+		region:            replica.Region,
+		dev:               main.dev,
+		pathStyle:         replica.ForcePathStyle,
+		endpoints:         endpointSettings{fips: replica.FIPS, dualStack: replica.DualStack, accelerate: replica.Accelerate},
+		requestPayer:      main.requestPayer,
+		requests:          main.requests,
+		role: roleSettings{
+			arn:         replica.RoleARN,
+			externalID:  replica.ExternalID,
+			sessionName: main.role.sessionName,
+			tagPairs:    main.role.tagPairs,
+			tokenFile:   main.role.tokenFile,
+			githubOIDC:  main.role.githubOIDC,
+		},
+		network:       main.network,
+		sshKey:        main.sshKey,
+		sshKnownHosts: main.sshKnownHosts,
+	}
+
+	if flags.region == "" {
+		flags.region = defaultRegion
+	}
+
+	if err := flags.applyDev(); err != nil {
+		return commonFlags{}, fmt.Errorf("%s: %v", name, err)
+	}
+
+	if err := flags.applyProvider(replica.Region != ""); err != nil {
+		return commonFlags{}, fmt.Errorf("%s: %v", name, err)
+	}
+
+	if err := flags.applyAccessPoint(); err != nil {
+		return commonFlags{}, fmt.Errorf("%s: %v", name, err)
+	}
+
+	if err := flags.applyEndpoints(); err != nil {
+		return commonFlags{}, fmt.Errorf("%s: %v", name, err)
+	}
+
+	if err := flags.applyRole(); err != nil {
+		return commonFlags{}, fmt.Errorf("%s: %v", name, err)
+	}
+
+	return flags, nil
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// failingBackend is a backend whose uploads always fail.
+type failingBackend struct {
+	backend
+}
+
+func (b failingBackend) Upload(ctx context.Context, object *uploadObject) error {
+	return errors.New("access denied")
+}
+
+func Test_newFanoutBackend(t *testing.T) {
+	stores := []backend{newTestFileBackend(t, t.TempDir(), "")}
+
+	if _, err := newFanoutBackend([]string{"primary"}, stores, "some", 0, nil); err == nil {
+		t.Error("Expected an error for an unknown policy")
+	}
+}
+
+func Test_fanoutBackend_Upload(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		policy       string
+		failReplica  bool
+		wantErr      bool
+		wantUploaded []bool
+		wantFailed   int
+	}{
+		{
+			desc:         "all succeed",
+			policy:       fanoutAll,
+			wantUploaded: []bool{true, true, true},
+		},
+		{
+			desc:         "all with a failure",
+			policy:       fanoutAll,
+			failReplica:  true,
+			wantErr:      true,
+			wantUploaded: []bool{true, false, true},
+			wantFailed:   1,
+		},
+		{
+			desc:         "report with a failure",
+			policy:       fanoutReport,
+			failReplica:  true,
+			wantUploaded: []bool{true, false, true},
+			wantFailed:   1,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			ctx := context.Background()
+			roots := []string{t.TempDir(), t.TempDir(), t.TempDir()}
+
+			var stores []backend
+			for i, root := range roots {
+				var store backend = newTestFileBackend(t, root, "")
+				if i == 1 && tC.failReplica {
+					store = failingBackend{store}
+				}
+
+				stores = append(stores, store)
+			}
+
+			fanout, err := newFanoutBackend([]string{"primary", "replica", "other"}, stores, tC.policy, 0, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, path := range []string{"index.html", "about.html"} {
+				err := fanout.Upload(ctx, &uploadObject{Path: path, Body: strings.NewReader("hello")})
+				if (err == nil) == tC.wantErr {
+					t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+				}
+
+				if err != nil && isRetryable(err) {
+					t.Errorf("Expected the error not to be retried again; got %v", err)
+				}
+			}
+
+			for i, root := range roots {
+				contents, err := os.ReadFile(filepath.Join(root, "about.html"))
+				if uploaded := err == nil && string(contents) == "hello"; uploaded != tC.wantUploaded[i] {
+					t.Errorf("Expected destination %d to have the file %v; got %q, %v", i, tC.wantUploaded[i], contents, err)
+				}
+			}
+
+			if failed := fanout.Summary(); failed != tC.wantFailed {
+				t.Errorf("Expected %d failed destination(s); got %d", tC.wantFailed, failed)
+			}
+		})
+	}
+}
+
+func Test_fanoutBackend_Upload_reportEveryFailure(t *testing.T) {
+	stores := []backend{failingBackend{newTestFileBackend(t, t.TempDir(), "")}, failingBackend{newTestFileBackend(t, t.TempDir(), "")}}
+	fanout, err := newFanoutBackend([]string{"primary", "replica"}, stores, fanoutReport, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fanout.Upload(context.Background(), &uploadObject{Path: "index.html", Body: strings.NewReader("hello")}); err == nil {
+		t.Error("Expected an error when every destination failed")
+	}
+}
+
+func Test_spoolBody(t *testing.T) {
+	testCases := []struct {
+		desc string
+		size int
+	}{
+		{desc: "in memory", size: 5},
+		{desc: "in a file", size: fanoutMemoryLimit + 1},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			body := strings.Repeat("a", tC.size)
+
+			spooled, size, cleanup, err := spoolBody(strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cleanup()
+
+			if size != int64(tC.size) {
+				t.Fatalf("Expected %d bytes; got %d", tC.size, size)
+			}
+
+			last := make([]byte, 1)
+			if _, err := spooled.ReadAt(last, size-1); err != nil || last[0] != 'a' {
+				t.Errorf("Expected the body to be readable; got %q, %v", last, err)
+			}
+		})
+	}
+}
+
+func Test_fanoutBackend_List(t *testing.T) {
+	ctx := context.Background()
+	primary, replica := newTestFileBackend(t, t.TempDir(), ""), newTestFileBackend(t, t.TempDir(), "")
+
+	for _, file := range []struct {
+		store *fileBackend
+		path  string
+		body  string
+	}{
+		{store: primary, path: "same.html", body: "same"},
+		{store: replica, path: "same.html", body: "same"},
+		{store: primary, path: "changed.html", body: "new"},
+		{store: replica, path: "changed.html", body: "old"},
+		{store: primary, path: "missing.html", body: "primary only"},
+	} {
+		if err := file.store.Upload(ctx, &uploadObject{Path: file.path, Body: strings.NewReader(file.body)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fanout, err := newFanoutBackend([]string{"primary", "replica"}, []backend{primary, replica}, fanoutAll, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err := fanout.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(objects) != 3 {
+		t.Fatalf("Expected 3 objects; got %+v", objects)
+	}
+
+	if objects["same.html"].ETag == "" {
+		t.Error("Expected the object that's the same everywhere to keep its ETag")
+	}
+
+	for _, key := range []string{"changed.html", "missing.html"} {
+		if objects[key].ETag != "" {
+			t.Errorf("Expected %s to be listed without an ETag; got %+v", key, objects[key])
+		}
+	}
+
+	if objects["missing.html"].Size != int64(len("primary only")) {
+		t.Errorf("Expected the primary destination's size; got %+v", objects["missing.html"])
+	}
+}
+
+func Test_fanoutBackend_state(t *testing.T) {
+	ctx := context.Background()
+	primary, replica := newTestFileBackend(t, t.TempDir(), ""), newTestFileBackend(t, t.TempDir(), "")
+	fanout, err := newFanoutBackend([]string{"primary", "replica"}, []backend{primary, replica}, fanoutAll, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fanout.WriteState(ctx, "current", []byte("v2")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, store := range []backend{primary, replica} {
+		if body, err := store.ReadState(ctx, "current"); err != nil || string(body) != "v2" {
+			t.Errorf("Expected the state to be written to every destination; got %q, %v", body, err)
+		}
+	}
+
+	if _, err := fanout.CreateState(ctx, "lock", []byte("owner")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := replica.ReadState(ctx, "lock"); err == nil {
+		t.Error("Expected the lock to be created at the primary destination only")
+	}
+}
+
+func Test_configFile_destinationFlags(t *testing.T) {
+	config := &configFile{
+		Region:  "eu-west-1",
+		Profile: "deploy",
+		Environments: map[string]configEnvironment{
+			"replica": {Bucket: "site-replica", Region: "us-west-2"},
+			"r2":      {Bucket: "site", Provider: "r2", AccountID: "abc123"},
+			"empty":   {Prefix: "docs/"},
+		},
+	}
+
+	testCases := []struct {
+		desc         string
+		env          string
+		wantBucket   string
+		wantRegion   string
+		wantEndpoint string
+		wantErr      bool
+	}{
+		{desc: "replica", env: "replica", wantBucket: "site-replica", wantRegion: "us-west-2"},
+		{desc: "provider", env: "r2", wantBucket: "site", wantRegion: "auto", wantEndpoint: "https://abc123.r2.cloudflarestorage.com"},
+		{desc: "without bucket", env: "empty", wantErr: true},
+		{desc: "unknown", env: "staging", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := config.destinationFlags(tC.env, &commonFlags{sshKey: "id_ed25519"})
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if got.bucket != tC.wantBucket || got.region != tC.wantRegion || got.endpoint != tC.wantEndpoint || got.profile != "deploy" || got.sshKey != "id_ed25519" {
+				t.Errorf("Unexpected settings: %+v", got)
+			}
+		})
+	}
+
+	if config.Region != "eu-west-1" {
+		t.Errorf("Expected the config file to be left alone; got region %s", config.Region)
+	}
+}
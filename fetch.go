@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultFetchKey is the key template of fetched URLs if none is given, which mirrors the layout
+// of the sites they are fetched from.
+const defaultFetchKey = "{host}/{path}"
+
+// fetchHeaderTimeout is how long a server may take to start responding to a fetched URL. The body
+// of the response may take longer, as large files are streamed into the bucket.
+const fetchHeaderTimeout = 30 * time.Second
+
+// runFetch implements the `fetch` command, which streams a list of URLs into the bucket without
+// writing them to disk, e.g. to mirror third-party assets next to a site.
+func runFetch(cmd command, args []string) {
+	var common commonFlags
+	var acl, keyTemplate string
+	var concurrency int
+
+	flags := newFlagSet(cmd, "[flags] <URL list or ->")
+	common.register(flags)
+	flags.StringVar(&acl, "acl", "public-read", "Canned ACL to apply to fetched objects, or 'none' to omit the ACL")
+	flags.IntVar(&concurrency, "concurrency", 4, "Number of URLs to fetch in parallel")
+	flags.StringVar(&keyTemplate, "key", defaultFetchKey, "Key to upload each URL under, relative to the prefix, with '{host}' for its host, '{path}' for its path, and '{name}' for the last element of its path")
+	sources := parseInterspersed(flags, args)
+
+	if _, err := common.applyConfig(flags); err != nil {
+		log.Fatal(err)
+	}
+
+	if len(sources) != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if concurrency < 1 {
+		log.Fatal("The '-concurrency' flag must be at least 1.")
+	}
+
+	fileACL, err := parseACL(common.preset.objectACL(acl, flagGiven(flags, "acl")))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	urls, err := readURLList(sources[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	template := prefixTemplate{
+		now:    time.Now(),
+		gitSHA: func() (string, error) { return gitHead(context.Background()) },
+	}
+
+	keys, err := urlKeys(urls, template, strings.TrimPrefix(keyTemplate, "/"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := newSignalContext()
+	defer stop()
+
+	store, err := newBackend(ctx, &common, backendOptions{ACL: fileACL})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	client, err := common.network.httpClient(fetchHeaderTimeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fetcher := &urlFetcher{
+		client: client,
+		next:   &contentTypeUploader{defaultType: "application/octet-stream", next: store},
+	}
+
+	objects := make(map[string]remoteObject, len(keys))
+	for key := range keys {
+		objects[key] = remoteObject{Key: key}
+	}
+
+	pool := newUploadPool(ctx, concurrency, false, createFetchFunc(ctx, fetcher, keys))
+	walkErr := walkRemote(objects, pool.WalkDirFunc())
+	poolErr := pool.Wait()
+	if ctx.Err() != nil {
+		log.Fatalf("Interrupted: %d URL(s) fetched before cancellation.", pool.Completed())
+	}
+
+	if poolErr != nil {
+		log.Fatal("Fetch failed: ", poolErr)
+	}
+
+	if walkErr != nil {
+		log.Fatal("Fetch failed: ", walkErr)
+	}
+}
+
+// readURLList reads the list of URLs to fetch from a file, or from standard input for `-`.
+func readURLList(source string) ([]*url.URL, error) {
+	var r io.Reader = os.Stdin
+	if source != "-" {
+		file, err := os.Open(source)
+		if err != nil {
+			return nil, fmt.Errorf("could not read URL list: %v", err)
+		}
+		defer file.Close()
+
+		r = file
+	}
+
+	return parseURLList(r)
+}
+
+// parseURLList parses a list of HTTP(S) URLs, one per line. Empty lines, comments starting with
+// `#`, and duplicates are dropped.
+func parseURLList(r io.Reader) ([]*url.URL, error) {
+	var urls []*url.URL
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		u, err := url.Parse(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL %q: %v", line, err)
+		}
+
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid URL %q: only http:// and https:// URLs can be fetched", line)
+		}
+
+		if !seen[u.String()] {
+			seen[u.String()] = true
+			urls = append(urls, u)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read URL list: %v", err)
+	}
+
+	return urls, nil
+}
+
+// urlKeys returns the URLs to fetch by the key given to each by the key template. URLs of
+// directories, whose path ends in `/`, are stored as their `index.html`. It fails if two URLs
+// would be uploaded under the same key.
+func urlKeys(urls []*url.URL, template prefixTemplate, keyTemplate string) (map[string]*url.URL, error) {
+	keys := map[string]*url.URL{}
+	for _, u := range urls {
+		path := strings.TrimPrefix(u.Path, "/")
+		if path == "" || strings.HasSuffix(path, "/") {
+			path += "index.html"
+		}
+
+		key, err := template.expandKey(keyTemplate, map[string]string{
+			"host": u.Host,
+			"path": path,
+			"name": path[strings.LastIndex(path, "/")+1:],
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if key == "" || strings.HasSuffix(key, "/") {
+			return nil, fmt.Errorf("invalid key %q for %s: keys can't be empty or end in '/'", key, u)
+		}
+
+		if other, ok := keys[key]; ok {
+			return nil, fmt.Errorf("%s and %s would both be uploaded as %s", other, u, key)
+		}
+
+		keys[key] = u
+	}
+
+	return keys, nil
+}
+
+// urlFetcher streams the responses to GET requests into a storage backend.
+type urlFetcher struct {
+	client *http.Client
+	next   uploader
+}
+
+// Fetch uploads the contents of a URL under a key, and returns the number of bytes uploaded. The
+// object gets the Content-Type of the response, if any.
+func (f *urlFetcher) Fetch(ctx context.Context, key string, source *url.URL) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	counter := &countingReader{r: resp.Body, progress: &progress{}}
+	object := &uploadObject{Path: key, Body: counter, ContentType: resp.Header.Get("Content-Type")}
+	if err := f.next.Upload(ctx, object); err != nil {
+		return 0, err
+	}
+
+	return counter.n, nil
+}
+
+// createFetchFunc creates a walk callback that fetches the URL of each key.
+func createFetchFunc(ctx context.Context, fetcher *urlFetcher, keys map[string]*url.URL) fs.WalkDirFunc {
+	return func(key string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		size, err := fetcher.Fetch(ctx, key, keys[key])
+		if err != nil {
+			return fmt.Errorf("failed to fetch %s: %v", keys[key], err)
+		}
+
+		log.Printf("Fetched %s to %s (%s)\n", keys[key], key, formatBytes(size))
+
+		return nil
+	}
+}
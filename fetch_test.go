@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_parseURLList(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		list    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			desc: "comments, empty lines, and duplicates",
+			list: "# fonts\nhttps://fonts.example.com/inter.woff2\n\n  https://cdn.example.com/lib.js  \nhttps://fonts.example.com/inter.woff2\n",
+			want: []string{"https://fonts.example.com/inter.woff2", "https://cdn.example.com/lib.js"},
+		},
+		{desc: "other scheme", list: "ftp://files.example.com/lib.js\n", wantErr: true},
+		{desc: "no host", list: "https:///lib.js\n", wantErr: true},
+		{desc: "relative", list: "lib.js\n", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			urls, err := parseURLList(strings.NewReader(tC.list))
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			var got []string
+			for _, u := range urls {
+				got = append(got, u.String())
+			}
+
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("Expected %v; got %v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_urlKeys(t *testing.T) {
+	template := prefixTemplate{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+
+	testCases := []struct {
+		desc        string
+		urls        []string
+		keyTemplate string
+		want        map[string]string
+		wantErr     bool
+	}{
+		{
+			desc:        "default",
+			urls:        []string{"https://cdn.example.com/lib/app.js?v=2", "https://example.com/docs/"},
+			keyTemplate: defaultFetchKey,
+			want:        map[string]string{"cdn.example.com/lib/app.js": "https://cdn.example.com/lib/app.js?v=2", "example.com/docs/index.html": "https://example.com/docs/"},
+		},
+		{
+			desc:        "template",
+			urls:        []string{"https://cdn.example.com/lib/app.js"},
+			keyTemplate: "vendor/{date}/{name}",
+			want:        map[string]string{"vendor/2024-05-01/app.js": "https://cdn.example.com/lib/app.js"},
+		},
+		{
+			desc:        "directory",
+			urls:        []string{"https://cdn.example.com/lib/app.js"},
+			keyTemplate: "vendor/",
+			want:        map[string]string{"vendor/app.js": "https://cdn.example.com/lib/app.js"},
+		},
+		{
+			desc:        "same key",
+			urls:        []string{"https://a.example.com/app.js", "https://b.example.com/app.js"},
+			keyTemplate: "vendor/{name}",
+			wantErr:     true,
+		},
+		{
+			desc:        "unknown variable",
+			urls:        []string{"https://cdn.example.com/app.js"},
+			keyTemplate: "{scheme}/{path}",
+			wantErr:     true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var urls []*url.URL
+			for _, raw := range tC.urls {
+				u, err := url.Parse(raw)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				urls = append(urls, u)
+			}
+
+			keys, err := urlKeys(urls, template, tC.keyTemplate)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if tC.wantErr {
+				return
+			}
+
+			got := map[string]string{}
+			for key, u := range keys {
+				got[key] = u.String()
+			}
+
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("Expected %v; got %v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_urlFetcher_Fetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/lib.js" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/javascript")
+		w.Write([]byte("console.log(1);\n"))
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		desc            string
+		path            string
+		wantBody        string
+		wantContentType string
+		wantErr         bool
+	}{
+		{desc: "found", path: "/lib.js", wantBody: "console.log(1);\n", wantContentType: "text/javascript"},
+		{desc: "not found", path: "/missing.js", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			source, err := url.Parse(server.URL + tC.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := &recordingUploader{}
+			fetcher := &urlFetcher{client: server.Client(), next: client}
+
+			size, err := fetcher.Fetch(context.Background(), "vendor/lib.js", source)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if tC.wantErr {
+				if len(client.objects) != 0 {
+					t.Errorf("Expected nothing to be uploaded; got %d object(s)", len(client.objects))
+				}
+
+				return
+			}
+
+			if size != int64(len(tC.wantBody)) || client.bodies[0] != tC.wantBody {
+				t.Errorf("Expected body %q; got %q (%d bytes counted)", tC.wantBody, client.bodies[0], size)
+			}
+
+			if object := client.objects[0]; object.Path != "vendor/lib.js" || object.ContentType != tC.wantContentType {
+				t.Errorf("Expected vendor/lib.js as %s; got %s as %s", tC.wantContentType, object.Path, object.ContentType)
+			}
+		})
+	}
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	syncplan "github.com/Zeroed-Books/s3-copy/pkg/sync"
+)
+
+func init() {
+	registerBackend("file", newFileBackend)
+}
+
+// fileBackend writes files to a local or mounted directory, such as an NFS or SMB share that a web
+// server serves from, or a directory to preview a deploy in. A directory can't store content types,
+// headers, ACLs, or metadata, so they are dropped.
+type fileBackend struct {
+	root   string
+	prefix string
+
+	// uploaded records the content type and metadata of the files written by this run, so that
+	// they can be verified along with their contents.
+	uploaded *fileProperties
+}
+
+// fileProperties are the properties of uploaded files that aren't stored in the directory.
+type fileProperties struct {
+	mu      sync.Mutex
+	objects map[string]objectHead
+}
+
+func newFileProperties() *fileProperties {
+	return &fileProperties{objects: map[string]objectHead{}}
+}
+
+// record stores the content type and metadata of an object written to the given key.
+func (p *fileProperties) record(key string, object *uploadObject) {
+	head := objectHead{ContentType: object.ContentType, Metadata: map[string]string{}}
+	for header, value := range object.Headers {
+		if name, ok := strings.CutPrefix(header, "X-Amz-Meta-"); ok {
+			head.Metadata[strings.ToLower(name)] = value
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.objects[key] = head
+}
+
+// lookup returns the recorded properties of the object at the given key, if any.
+func (p *fileProperties) lookup(key string) objectHead {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.objects[key]
+}
+
+// newFileBackend creates the backend for a directory given as `file://<dir>`, or
+// `file:///<dir>` for an absolute path. Options without an equivalent for files are rejected.
+func newFileBackend(ctx context.Context, common *commonFlags, bucket, prefix string, options backendOptions) (backend, error) {
+	if err := checkFileOptions("the file backend", options); err != nil {
+		return nil, err
+	}
+
+	// `file:///srv/www` has an empty bucket, with the rest of the path in the prefix.
+	root := bucket
+	if root == "" {
+		root = "/"
+	}
+
+	return &fileBackend{
+		root:     root,
+		prefix:   prefix,
+		uploaded: &fileProperties{objects: map[string]objectHead{}},
+	}, nil
+}
+
+// checkFileOptions rejects the options that a backend storing plain files, such as a directory or
+// an SFTP server, can't honour. ACLs and metadata are dropped instead, since they rarely matter
+// for whether the files are served.
+func checkFileOptions(name string, options backendOptions) error {
+	if len(options.Tags) > 0 {
+		return fmt.Errorf("object tags aren't supported by %s", name)
+	}
+
+	if options.Encryption.mode != "" || options.Encryption.customerKey != nil {
+		return fmt.Errorf("encryption isn't supported by %s", name)
+	}
+
+	if options.Checksum != (uploadChecksum{}) {
+		return fmt.Errorf("checksums aren't supported by %s", name)
+	}
+
+	if options.ObjectLock.enabled() {
+		return fmt.Errorf("Object Lock isn't supported by %s", name)
+	}
+
+	return nil
+}
+
+// filePath returns the local path of the object at the given path, relative to the prefix.
+func (f *fileBackend) filePath(path string) (string, error) {
+	key := f.prefix + path
+	if strings.HasSuffix(key, "/") || !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("can't store %s as a file", key)
+	}
+
+	return filepath.Join(f.root, filepath.FromSlash(key)), nil
+}
+
+func (f *fileBackend) Upload(ctx context.Context, object *uploadObject) error {
+	if _, ok := object.Headers[redirectHeader]; ok {
+		return fmt.Errorf("can't store the redirect %s as a file", object.Path)
+	}
+
+	name, err := f.filePath(object.Path)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(name, object.Body); err != nil {
+		return fmt.Errorf("failed to write %s: %v", object.Path, err)
+	}
+
+	f.uploaded.record(f.prefix+object.Path, object)
+
+	return nil
+}
+
+// writeFileAtomic writes a file through a temporary file in the same directory, so that readers
+// never see a partially written file.
+func writeFileAtomic(name string, body io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := io.Copy(temp, body); err != nil {
+		temp.Close()
+		return err
+	}
+
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(temp.Name(), 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), name)
+}
+
+// List returns every file beneath the prefix. Their ETags are the hex-encoded MD5 digests of their
+// contents, like those of S3 objects uploaded in a single part, so that unchanged files can be
+// recognized.
+func (f *fileBackend) List(ctx context.Context) (map[string]remoteObject, error) {
+	objects := map[string]remoteObject{}
+	dir := filepath.Join(f.root, filepath.FromSlash(f.prefix))
+	err := filepath.WalkDir(dir, func(name string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && name == dir {
+			return fs.SkipAll
+		}
+
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		etag, err := fileETag(name)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+		objects[key] = remoteObject{
+			Key:          key,
+			Size:         info.Size(),
+			ETag:         etag,
+			LastModified: info.ModTime(),
+		}
+
+		return ctx.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %v", err)
+	}
+
+	return objects, nil
+}
+
+// fileETag returns the hex-encoded MD5 digest of a file.
+func fileETag(name string) (string, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	return syncplan.LocalETag(file, 0)
+}
+
+// Head returns the size and ETag of the file at the given path, along with the content type and
+// metadata it was written with by this run.
+func (f *fileBackend) Head(ctx context.Context, path string) (objectHead, error) {
+	name, err := f.filePath(path)
+	if err != nil {
+		return objectHead{}, err
+	}
+
+	info, err := os.Stat(name)
+	if err != nil {
+		return objectHead{}, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	etag, err := fileETag(name)
+	if err != nil {
+		return objectHead{}, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	head := f.uploaded.lookup(f.prefix + path)
+
+	head.Size = info.Size()
+	head.ETag = etag
+
+	return head, nil
+}
+
+// Delete removes the files at the given paths, along with any directories left empty.
+func (f *fileBackend) Delete(ctx context.Context, paths []string) error {
+	base := filepath.Join(f.root, filepath.FromSlash(f.prefix))
+	for _, path := range paths {
+		name, err := f.filePath(path)
+		if err != nil {
+			return err
+		}
+
+		if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to delete %s: %v", path, err)
+		}
+
+		// Removing a directory fails once one that isn't empty is reached.
+		for dir := filepath.Dir(name); dir != base && strings.HasPrefix(dir, base); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+func (f *fileBackend) Sub(dir string) backend {
+	sub := *f
+	sub.prefix += dir
+
+	return &sub
+}
+
+func (f *fileBackend) URL() string {
+	dir, err := filepath.Abs(filepath.Join(f.root, filepath.FromSlash(f.prefix)))
+	if err != nil {
+		dir = filepath.Join(f.root, filepath.FromSlash(f.prefix))
+	}
+
+	return "file://" + filepath.ToSlash(dir) + "/"
+}
+
+func (f *fileBackend) ReadState(ctx context.Context, path string) ([]byte, error) {
+	body, _, err := f.ReadStateETag(ctx, path)
+	return body, err
+}
+
+// ReadStateETag returns the contents of the state file at the given path along with its MD5
+// digest, for use in conditional requests.
+func (f *fileBackend) ReadStateETag(ctx context.Context, path string) ([]byte, string, error) {
+	name, err := f.filePath(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	body, err := os.ReadFile(name)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	etag, err := syncplan.LocalETag(bytes.NewReader(body), 0)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return body, etag, nil
+}
+
+func (f *fileBackend) WriteState(ctx context.Context, path string, body []byte) error {
+	name, err := f.filePath(path)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(name, bytes.NewReader(body)); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// CreateState writes a state file unless it already exists, in which case the error wraps
+// `fs.ErrExist`.
+func (f *fileBackend) CreateState(ctx context.Context, path string, body []byte) (string, error) {
+	name, err := f.filePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", path, err)
+	}
+
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", path, err)
+	}
+
+	if _, err := file.Write(body); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to create %s: %v", path, err)
+	}
+
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", path, err)
+	}
+
+	return syncplan.LocalETag(bytes.NewReader(body), 0)
+}
+
+// DeleteState removes the state file at the given path if its contents didn't change since they
+// were read. If they did, the error wraps `fs.ErrExist`.
+func (f *fileBackend) DeleteState(ctx context.Context, path, etag string) error {
+	_, current, err := f.ReadStateETag(ctx, path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if current != etag {
+		return fmt.Errorf("failed to delete %s: %w", path, fs.ErrExist)
+	}
+
+	name, err := f.filePath(path)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete %s: %v", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestFileBackend(t *testing.T, bucket, prefix string) *fileBackend {
+	t.Helper()
+
+	store, err := newFileBackend(context.Background(), &commonFlags{}, bucket, prefix, backendOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store.(*fileBackend)
+}
+
+func Test_fileBackend(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	store := newTestFileBackend(t, root, "site/")
+
+	err := store.Upload(ctx, &uploadObject{
+		Path:        "assets/app.js",
+		Body:        strings.NewReader("hello"),
+		ContentType: "text/javascript",
+		Headers:     map[string]string{"Cache-Control": "no-cache", "X-Amz-Meta-Owner": "web"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := os.ReadFile(filepath.Join(root, "site", "assets", "app.js"))
+	if err != nil || string(contents) != "hello" {
+		t.Fatalf("Expected the file to be written; got %q, %v", contents, err)
+	}
+
+	objects, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := remoteObject{Key: "assets/app.js", Size: 5, ETag: "5d41402abc4b2a76b9719d911017c592"}
+	if got := objects["assets/app.js"]; len(objects) != 1 || got.Key != want.Key || got.Size != want.Size || got.ETag != want.ETag {
+		t.Errorf("Expected %+v to be listed; got %+v", want, objects)
+	}
+
+	head, err := store.Head(ctx, "assets/app.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if head.Size != 5 || head.ETag != want.ETag || head.ContentType != "text/javascript" || head.Metadata["owner"] != "web" {
+		t.Errorf("Unexpected properties: %+v", head)
+	}
+
+	if err := store.Delete(ctx, []string{"assets/app.js", "missing.txt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "site", "assets")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected the empty directory to be removed; got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "site")); err != nil {
+		t.Errorf("Expected the prefix directory to be kept; got %v", err)
+	}
+}
+
+func Test_fileBackend_List_missing(t *testing.T) {
+	store := newTestFileBackend(t, filepath.Join(t.TempDir(), "missing"), "")
+
+	objects, err := store.List(context.Background())
+	if err != nil || len(objects) != 0 {
+		t.Errorf("Expected no objects for a missing directory; got %v, %v", objects, err)
+	}
+}
+
+func Test_fileBackend_Upload_unsupported(t *testing.T) {
+	store := newTestFileBackend(t, t.TempDir(), "")
+
+	testCases := []struct {
+		desc   string
+		object *uploadObject
+	}{
+		{
+			desc:   "directory key",
+			object: &uploadObject{Path: "about/", Body: strings.NewReader("")},
+		},
+		{
+			desc:   "redirect",
+			object: &uploadObject{Path: "old.html", Body: strings.NewReader(""), Headers: map[string]string{redirectHeader: "/new"}},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if err := store.Upload(context.Background(), tC.object); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func Test_fileBackend_state(t *testing.T) {
+	ctx := context.Background()
+	store := newTestFileBackend(t, t.TempDir(), "")
+
+	etag, err := store.CreateState(ctx, lockPath, []byte("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.CreateState(ctx, lockPath, []byte("second")); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Expected fs.ErrExist for an existing state file; got %v", err)
+	}
+
+	if err := store.DeleteState(ctx, lockPath, "other"); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Expected fs.ErrExist for a changed state file; got %v", err)
+	}
+
+	if err := store.DeleteState(ctx, lockPath, etag); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.ReadState(ctx, lockPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist after deleting; got %v", err)
+	}
+
+	if err := store.WriteState(ctx, pendingDeletesPath, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	if body, err := store.ReadState(ctx, pendingDeletesPath); err != nil || string(body) != "{}" {
+		t.Errorf("Expected the state to be read back; got %q, %v", body, err)
+	}
+}
+
+func Test_newFileBackend(t *testing.T) {
+	_, bucket, prefix := parseBucketURL("file:///srv/www", "")
+	store := newTestFileBackend(t, bucket, prefix)
+
+	if got, want := store.URL(), "file:///srv/www/"; got != want {
+		t.Errorf("Expected URL %s; got %s", want, got)
+	}
+
+	if _, err := newFileBackend(context.Background(), &commonFlags{}, "out", "", backendOptions{Tags: map[string]string{"team": "web"}}); err == nil {
+		t.Error("Expected an error for object tags")
+	}
+}
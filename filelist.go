@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A treeWalker calls `walk` for each of the files to upload, the way `filepath.WalkDir` would.
+type treeWalker func(walk fs.WalkDirFunc) error
+
+// readFileList reads the list of paths given to `-files-from`, which is either a file or `-` for
+// standard input. Paths are separated by newlines, or by NUL characters if `nul` is set, as
+// produced by `find -print0`.
+func readFileList(source string, nul bool) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if source != "-" {
+		file, err := os.Open(source)
+		if err != nil {
+			return nil, fmt.Errorf("could not read file list: %v", err)
+		}
+		defer file.Close()
+
+		r = file
+	}
+
+	return parseFileList(r, nul)
+}
+
+// parseFileList splits a list of paths, dropping empty entries and duplicates. Paths are cleaned
+// so that `./index.html` and `index.html` refer to the same file, and must stay within the working
+// directory. They are returned slash-separated, as they are used for keys.
+func parseFileList(r io.Reader, nul bool) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	if nul {
+		scanner.Split(scanNul)
+	}
+
+	var paths []string
+	seen := map[string]bool{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !nul {
+			line = strings.TrimSuffix(line, "\r")
+		}
+
+		if line == "" {
+			continue
+		}
+
+		path := filepath.Clean(line)
+		if !filepath.IsLocal(path) {
+			return nil, fmt.Errorf("invalid path %q in file list: paths must be within the working directory", line)
+		}
+
+		path = filepath.ToSlash(path)
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read file list: %v", err)
+	}
+
+	return paths, nil
+}
+
+// scanNul is a split function for `bufio.Scanner` that splits on NUL characters.
+func scanNul(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
+
+// fileListWalker returns a tree walker that visits only the listed files. Listed directories are
+// skipped rather than walked, since lists such as the output of `find` already include the files
+// beneath them. Missing files are skipped too, since lists such as the output of `git diff` also
+// include deleted files. Listed symbolic links are skipped or fail the walk if the policy says so,
+// and are otherwise treated as what they point to.
+func fileListWalker(paths []string, symlinks symlinkPolicy) treeWalker {
+	return func(walk fs.WalkDirFunc) error {
+		for _, path := range paths {
+			info, err := os.Lstat(path)
+			if err == nil && info.Mode()&fs.ModeSymlink != 0 {
+				switch symlinks {
+				case symlinkSkip:
+					log.Printf("Skipping symbolic link %s\n", path)
+					continue
+				case symlinkError:
+					_, err = symlinks.resolve(path)
+				default:
+					info, err = os.Stat(path)
+				}
+			}
+
+			if errors.Is(err, fs.ErrNotExist) {
+				log.Printf("Skipping %s: no such file\n", path)
+				continue
+			}
+
+			if err != nil {
+				err = walk(path, nil, err)
+			} else if info.IsDir() {
+				continue
+			} else {
+				err = walk(path, fs.FileInfoToDirEntry(info), nil)
+			}
+
+			if errors.Is(err, fs.SkipAll) {
+				return nil
+			}
+
+			if err != nil && !errors.Is(err, fs.SkipDir) {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// expandGlobs expands the file names and glob patterns given as arguments, such as
+// `build/*.tar.gz`, into the paths of the files to upload, for pipelines that upload a few
+// artifacts without walking a directory. Patterns are expanded by `filepath.Glob` rather than a
+// shell, so they can be quoted. Every pattern must match at least one path within the working
+// directory. Directories are left out, as they are uploaded with -source. Paths are returned
+// slash-separated and without duplicates, in the order of the patterns.
+func expandGlobs(patterns []string) ([]string, error) {
+	var paths []string
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+
+		files := 0
+		for _, match := range matches {
+			path := filepath.Clean(match)
+			if !filepath.IsLocal(path) {
+				return nil, fmt.Errorf("invalid path %q: paths must be within the working directory", match)
+			}
+
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				continue
+			}
+
+			files++
+			path = filepath.ToSlash(path)
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+
+		if files == 0 && len(matches) > 0 {
+			return nil, fmt.Errorf("no files match %q, only directories; use -source to upload a directory", pattern)
+		}
+
+		if files == 0 {
+			return nil, fmt.Errorf("no files match %q", pattern)
+		}
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_parseFileList(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		input   string
+		nul     bool
+		want    []string
+		wantErr bool
+	}{
+		{desc: "newlines", input: "index.html\nassets/app.js\n", want: []string{"index.html", "assets/app.js"}},
+		{desc: "CRLF", input: "index.html\r\nabout.html\r\n", want: []string{"index.html", "about.html"}},
+		{desc: "empty lines and duplicates", input: "index.html\n\n./index.html\n", want: []string{"index.html"}},
+		{desc: "NUL separated", input: "my file.txt\x00line\nbreak.txt\x00", nul: true, want: []string{"my file.txt", "line\nbreak.txt"}},
+		{desc: "no trailing separator", input: "a.txt\x00b.txt", nul: true, want: []string{"a.txt", "b.txt"}},
+		{desc: "empty list", input: ""},
+		{desc: "outside working directory", input: "../secret.txt\n", wantErr: true},
+		{desc: "absolute path", input: "/etc/passwd\n", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := parseFileList(strings.NewReader(tC.input), tC.nul)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("Expected %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_fileListWalker(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	for _, name := range []string{"index.html", "assets/app.js"} {
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(name, []byte("contents"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var visited []string
+	walk := fileListWalker([]string{"assets", "assets/app.js", "deleted.html", "index.html"}, symlinkFiles)
+	err := walk(func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			t.Errorf("Expected directories to be skipped; got %s", path)
+		}
+
+		visited = append(visited, path)
+
+		if path == "index.html" {
+			return fs.SkipAll
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if want := []string{"assets/app.js", "index.html"}; !reflect.DeepEqual(visited, want) {
+		t.Errorf("Expected %v; got %v", want, visited)
+	}
+}
+
+func Test_expandGlobs(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	for _, name := range []string{"build/app.tar.gz", "build/app.zip", "build/docs.tar.gz", "build/nested/lib.tar.gz", "CHANGELOG.md"} {
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(name, []byte("contents"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		desc     string
+		patterns []string
+		want     []string
+		wantErr  bool
+	}{
+		{desc: "single file", patterns: []string{"CHANGELOG.md"}, want: []string{"CHANGELOG.md"}},
+		{desc: "glob", patterns: []string{"build/*.tar.gz"}, want: []string{"build/app.tar.gz", "build/docs.tar.gz"}},
+		{desc: "duplicates", patterns: []string{"./build/app.zip", "build/app.*"}, want: []string{"build/app.zip", "build/app.tar.gz"}},
+		{desc: "directories left out", patterns: []string{"build/*"}, want: []string{"build/app.tar.gz", "build/app.zip", "build/docs.tar.gz"}},
+		{desc: "only directories", patterns: []string{"build/nest*"}, wantErr: true},
+		{desc: "no match", patterns: []string{"dist/*.tar.gz"}, wantErr: true},
+		{desc: "invalid pattern", patterns: []string{"build/[.zip"}, wantErr: true},
+		{desc: "outside working directory", patterns: []string{"../*"}, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := expandGlobs(tC.patterns)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("Expected %v; got %v", tC.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// pathFilter decides which files take part in a run based on glob patterns.
+//
+// Patterns without a `/` are matched against a file's base name at any depth, so `*.map` matches
+// `js/app.js.map`. Other patterns are matched against the full slash-separated path, where a `**`
+// segment matches any number of directories, e.g. `node_modules/**`.
+type pathFilter struct {
+	// include, when not empty, limits the run to files matching at least one pattern.
+	include []string
+	// exclude removes files matching any pattern, even if they are included.
+	exclude []string
+	// hidden removes dotfiles and the files beneath dot-directories.
+	hidden bool
+}
+
+// newPathFilter creates a filter from the given patterns, validating their syntax.
+func newPathFilter(include, exclude []string) (pathFilter, error) {
+	for _, pattern := range append(append([]string{}, include...), exclude...) {
+		for _, segment := range strings.Split(pattern, "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				return pathFilter{}, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+			}
+		}
+	}
+
+	return pathFilter{include: include, exclude: exclude}, nil
+}
+
+// Match reports whether the file at the given path should take part in the run.
+func (f pathFilter) Match(name string) bool {
+	name = filepath.ToSlash(name)
+
+	if f.hidden && isHidden(name) {
+		return false
+	}
+
+	if len(f.include) > 0 && !matchAny(f.include, name) {
+		return false
+	}
+
+	if matchAny(f.exclude, name) {
+		return false
+	}
+
+	// Files beneath a directory that SkipDir prunes are excluded with it, so that their objects
+	// are never deleted as stale by a walk that didn't reach them.
+	for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if f.excludesDir(dir) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SkipDir reports whether every file beneath the given directory is excluded, so that the walk
+// doesn't need to descend into it.
+func (f pathFilter) SkipDir(name string) bool {
+	name = filepath.ToSlash(name)
+
+	if f.hidden && isHidden(name) {
+		return true
+	}
+
+	return f.excludesDir(name)
+}
+
+// excludesDir reports whether an exclude pattern matches the directory itself, ignoring a
+// trailing `/**`, e.g. `node_modules/**` or `build`.
+func (f pathFilter) excludesDir(name string) bool {
+	for _, pattern := range f.exclude {
+		if ok, _ := matchGlob(strings.TrimSuffix(pattern, "/**"), name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := matchGlob(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchGlob reports whether the slash-separated path `name` matches the given pattern.
+func matchGlob(pattern, name string) (bool, error) {
+	if !strings.Contains(pattern, "/") {
+		return path.Match(pattern, path.Base(name))
+	}
+
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if ok, err := matchSegments(pattern[1:], name[i:]); ok || err != nil {
+					return ok, err
+				}
+			}
+
+			return false, nil
+		}
+
+		if len(name) == 0 {
+			return false, nil
+		}
+
+		ok, err := path.Match(pattern[0], name[0])
+		if !ok || err != nil {
+			return false, err
+		}
+
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0, nil
+}
+
+// createFilterFunc wraps a walk callback so that only files accepted by the filter are passed
+// through. Excluded directories are skipped entirely.
+func createFilterFunc(filter pathFilter, walk fs.WalkDirFunc) fs.WalkDirFunc {
+	return func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Errors about excluded files, such as symbolic links that aren't allowed, don't
+			// matter.
+			if entry != nil && !entry.IsDir() && !filter.Match(path) {
+				return nil
+			}
+
+			return walk(path, entry, err)
+		}
+
+		if entry.IsDir() {
+			if filter.SkipDir(path) {
+				return fs.SkipDir
+			}
+
+			return walk(path, entry, nil)
+		}
+
+		if !filter.Match(path) {
+			return nil
+		}
+
+		return walk(path, entry, nil)
+	}
+}
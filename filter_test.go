@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+func Test_matchGlob(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		pattern string
+		name    string
+		want    bool
+	}{
+		{desc: "base name at root", pattern: "*.map", name: "app.js.map", want: true},
+		{desc: "base name nested", pattern: "*.map", name: "js/app.js.map", want: true},
+		{desc: "base name mismatch", pattern: "*.map", name: "js/app.js", want: false},
+		{desc: "full path", pattern: "js/*.js", name: "js/app.js", want: true},
+		{desc: "full path too deep", pattern: "js/*.js", name: "js/vendor/lib.js", want: false},
+		{desc: "double star contents", pattern: "node_modules/**", name: "node_modules/a/b.js", want: true},
+		{desc: "double star prefix", pattern: "**/*.html", name: "index.html", want: true},
+		{desc: "double star middle", pattern: "assets/**/*.png", name: "assets/img/icons/x.png", want: true},
+		{desc: "double star mismatch", pattern: "assets/**/*.png", name: "other/x.png", want: false},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := matchGlob(tC.pattern, tC.name)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got != tC.want {
+				t.Errorf("Expected match %v; got %v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_newPathFilter_invalid(t *testing.T) {
+	if _, err := newPathFilter(nil, []string{"assets/[a-/**"}); err == nil {
+		t.Error("Expected an error for a malformed pattern")
+	}
+}
+
+func Test_createFilterFunc(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		include  []string
+		exclude  []string
+		path     string
+		dir      bool
+		wantWalk bool
+		wantErr  error
+	}{
+		{desc: "no patterns", path: "index.html", wantWalk: true},
+		{desc: "excluded file", exclude: []string{"*.map"}, path: "app.js.map", wantWalk: false},
+		{desc: "included file", include: []string{"*.html"}, path: "index.html", wantWalk: true},
+		{desc: "not included file", include: []string{"*.html"}, path: "app.js", wantWalk: false},
+		{desc: "exclude wins", include: []string{"*.js"}, exclude: []string{"vendor/**"}, path: "vendor/a.js", wantWalk: false},
+		{desc: "excluded directory", exclude: []string{"node_modules/**"}, path: "node_modules", dir: true, wantErr: fs.SkipDir},
+		{desc: "included directory", include: []string{"*.html"}, path: "docs", dir: true, wantWalk: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			filter, err := newPathFilter(tC.include, tC.exclude)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			walked := false
+			walk := createFilterFunc(filter, func(path string, entry fs.DirEntry, err error) error {
+				walked = true
+				return nil
+			})
+
+			var mode fs.FileMode
+			if tC.dir {
+				mode = fs.ModeDir
+			}
+
+			if err := walk(tC.path, mockFileInfo{name: tC.path, mode: mode}, nil); err != tC.wantErr {
+				t.Errorf("Expected error %v; got %v", tC.wantErr, err)
+			}
+
+			if walked != tC.wantWalk {
+				t.Errorf("Expected walk %v; got %v", tC.wantWalk, walked)
+			}
+		})
+	}
+}
+
+func Test_createFilterFunc_excludedError(t *testing.T) {
+	filter, err := newPathFilter(nil, []string{"*.map"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	walk := createFilterFunc(filter, func(path string, entry fs.DirEntry, err error) error {
+		return err
+	})
+
+	linkErr := errors.New("symbolic link")
+	if err := walk("app.js.map", mockFileInfo{name: "app.js.map", mode: fs.ModeSymlink}, linkErr); err != nil {
+		t.Errorf("Expected the error of an excluded file to be ignored; got %v", err)
+	}
+
+	if err := walk("app.js", mockFileInfo{name: "app.js", mode: fs.ModeSymlink}, linkErr); err != linkErr {
+		t.Errorf("Expected the error of an included file to be reported; got %v", err)
+	}
+}
+
+func Test_pathFilter_hidden(t *testing.T) {
+	filter := pathFilter{hidden: true}
+
+	if filter.Match(".well-known/security.txt") || filter.Match("docs/.env") {
+		t.Error("Expected hidden files to be excluded")
+	}
+
+	if !filter.Match("index.html") {
+		t.Error("Expected other files to be included")
+	}
+
+	if !filter.SkipDir(".git") || filter.SkipDir(".") {
+		t.Error("Expected only dot-directories to be skipped")
+	}
+}
+
+func Test_pathFilter_excludedDirectory(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		exclude string
+		dir     string
+		file    string
+	}{
+		{desc: "directory at the root", exclude: "build", dir: "build", file: "build/app.js"},
+		{desc: "nested directory", exclude: "build", dir: "src/build", file: "src/build/app.js"},
+		{desc: "directory glob", exclude: "node_modules/**", dir: "packages/x/node_modules", file: "packages/x/node_modules/lib.js"},
+		{desc: "deeply nested file", exclude: "node_modules/**", dir: "node_modules", file: "node_modules/a/b/lib.js"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			filter, err := newPathFilter(nil, []string{tC.exclude})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !filter.SkipDir(tC.dir) {
+				t.Errorf("Expected %s to be skipped", tC.dir)
+			}
+
+			if filter.Match(tC.file) {
+				t.Errorf("Expected %s to be excluded with its directory", tC.file)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// stringList is a flag value that may be provided multiple times, accumulating every value.
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// parseKeyValues parses a list of `key=value` pairs into a map.
+func parseKeyValues(pairs []string) (map[string]string, error) {
+	values := map[string]string{}
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid pair %q: expected <key>=<value>", pair)
+		}
+
+		values[parts[0]] = parts[1]
+	}
+
+	return values, nil
+}
+
+// splitPatterns flattens repeated flag values that may each hold a comma-separated list, such as
+// `*.js,*.css`, dropping empty entries.
+func splitPatterns(values []string) []string {
+	var patterns []string
+	for _, value := range values {
+		for _, pattern := range strings.Split(value, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern != "" {
+				patterns = append(patterns, pattern)
+			}
+		}
+	}
+
+	return patterns
+}
+
+// flagGiven reports whether the named flag was given on the command line.
+func flagGiven(flags *flag.FlagSet, name string) bool {
+	given := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			given = true
+		}
+	})
+
+	return given
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseKeyValues(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		pairs   []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			desc:  "pairs",
+			pairs: []string{"team=web", "expr=a=b", "empty="},
+			want:  map[string]string{"team": "web", "expr": "a=b", "empty": ""},
+		},
+		{
+			desc:    "missing separator",
+			pairs:   []string{"team"},
+			wantErr: true,
+		},
+		{
+			desc:    "missing key",
+			pairs:   []string{"=web"},
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := parseKeyValues(tC.pairs)
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if len(got) != len(tC.want) {
+				t.Fatalf("Expected %v; got %v", tC.want, got)
+			}
+
+			for key, value := range tC.want {
+				if got[key] != value {
+					t.Errorf("Expected %s=%q; got %q", key, value, got[key])
+				}
+			}
+		})
+	}
+}
+
+func Test_splitPatterns(t *testing.T) {
+	got := splitPatterns([]string{"*.js, *.css", "", "*.svg,"})
+	want := []string{"*.js", "*.css", "*.svg"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected patterns %v; got %v", want, got)
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+)
+
+func init() {
+	registerBackend("gs", newGCSBackend)
+}
+
+// gcsPredefinedACLs maps canned S3 ACLs to the predefined ACLs of Google Cloud Storage.
+var gcsPredefinedACLs = map[types.ObjectCannedACL]string{
+	types.ObjectCannedACLAuthenticatedRead:      "authenticatedRead",
+	types.ObjectCannedACLBucketOwnerFullControl: "bucketOwnerFullControl",
+	types.ObjectCannedACLBucketOwnerRead:        "bucketOwnerRead",
+	types.ObjectCannedACLPrivate:                "private",
+	types.ObjectCannedACLPublicRead:             "publicRead",
+}
+
+// gcsBackend stores files in a Google Cloud Storage bucket. Credentials are found through
+// Application Default Credentials: the service account key file named by the
+// GOOGLE_APPLICATION_CREDENTIALS environment variable, the credentials of `gcloud auth
+// application-default login`, or the service account of the machine the command runs on.
+type gcsBackend struct {
+	bucket *storage.BucketHandle
+	name   string
+	prefix string
+
+	// acl is the predefined ACL applied to every object. If empty, the bucket's default applies.
+	acl         string
+	metadata    map[string]string
+	kmsKeyName  string
+	customerKey []byte
+	chunkSize   int
+}
+
+// newGCSBackend creates the backend for a Google Cloud Storage bucket. Options without an
+// equivalent in Cloud Storage are rejected.
+func newGCSBackend(ctx context.Context, common *commonFlags, bucket, prefix string, options backendOptions) (backend, error) {
+	store, err := newGCSStore(bucket, prefix, options)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not create Cloud Storage client: %v", err)
+	}
+
+	store.bucket = client.Bucket(bucket)
+
+	return store, nil
+}
+
+// newGCSStore validates the options for a Cloud Storage bucket and converts them to their Cloud
+// Storage equivalents.
+func newGCSStore(bucket, prefix string, options backendOptions) (*gcsBackend, error) {
+	store := &gcsBackend{
+		name:      bucket,
+		prefix:    prefix,
+		metadata:  options.Metadata,
+		chunkSize: int(options.Multipart.PartSize),
+	}
+
+	if options.ACL != "" {
+		acl, ok := gcsPredefinedACLs[options.ACL]
+		if !ok {
+			return nil, fmt.Errorf("the %s ACL isn't supported by Cloud Storage", options.ACL)
+		}
+
+		store.acl = acl
+	}
+
+	if len(options.Tags) > 0 {
+		return nil, errors.New("object tags aren't supported by Cloud Storage")
+	}
+
+	if options.CreateBucket != nil {
+		return nil, errors.New("creating buckets isn't supported for Cloud Storage")
+	}
+
+	if options.Checksum != (uploadChecksum{}) {
+		return nil, errors.New("checksums aren't supported by Cloud Storage, which checks every upload itself")
+	}
+
+	if options.ObjectLock.enabled() {
+		return nil, errors.New("Object Lock isn't supported by Cloud Storage; use a retention policy on the bucket instead")
+	}
+
+	switch encryption := options.Encryption; {
+	case encryption.customerKey != nil:
+		store.customerKey = encryption.customerKey
+	case encryption.mode == types.ServerSideEncryptionAwsKms && encryption.kmsKeyID != "":
+		store.kmsKeyName = encryption.kmsKeyID
+	case encryption.mode != "" && encryption.mode != types.ServerSideEncryptionAes256:
+		return nil, fmt.Errorf("the %s encryption isn't supported by Cloud Storage; use 'aws:kms' with the name of a Cloud KMS key", encryption.mode)
+	}
+
+	return store, nil
+}
+
+// object returns the handle of the object at the given path, relative to the prefix.
+func (g *gcsBackend) object(path string) *storage.ObjectHandle {
+	object := g.bucket.Object(g.prefix + path)
+	if g.customerKey != nil {
+		object = object.Key(g.customerKey)
+	}
+
+	return object
+}
+
+func (g *gcsBackend) Upload(ctx context.Context, object *uploadObject) error {
+	// Cancelling the context discards a partial upload.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := g.object(object.Path).NewWriter(ctx)
+	w.ContentType = object.ContentType
+	w.Metadata = g.metadata
+	w.PredefinedACL = g.acl
+	w.KMSKeyName = g.kmsKeyName
+	if g.chunkSize > 0 {
+		w.ChunkSize = g.chunkSize
+	}
+
+	if err := applyGCSHeaders(&w.ObjectAttrs, object.Headers); err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, object.Body); err != nil {
+		return fmt.Errorf("failed to upload to Cloud Storage: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to upload to Cloud Storage: %w", err)
+	}
+
+	return nil
+}
+
+// applyGCSHeaders sets the object attributes corresponding to the given HTTP headers.
+func applyGCSHeaders(attrs *storage.ObjectAttrs, headers map[string]string) error {
+	for name, value := range headers {
+		if key, ok := strings.CutPrefix(name, "X-Amz-Meta-"); ok {
+			// The metadata map may be shared between uploads, so it is copied before being
+			// modified.
+			metadata := make(map[string]string, len(attrs.Metadata)+1)
+			for k, v := range attrs.Metadata {
+				metadata[k] = v
+			}
+
+			metadata[strings.ToLower(key)] = value
+			attrs.Metadata = metadata
+
+			continue
+		}
+
+		if strings.HasPrefix(name, tagHeaderPrefix) {
+			return errors.New("object tags aren't supported by Cloud Storage")
+		}
+
+		switch name {
+		case "Cache-Control":
+			attrs.CacheControl = value
+		case "Content-Disposition":
+			attrs.ContentDisposition = value
+		case "Content-Encoding":
+			attrs.ContentEncoding = value
+		case "Content-Language":
+			attrs.ContentLanguage = value
+		case "Content-Type":
+			attrs.ContentType = value
+		case "X-Amz-Acl":
+			acl, ok := gcsPredefinedACLs[types.ObjectCannedACL(value)]
+			if !ok {
+				return fmt.Errorf("the %s ACL isn't supported by Cloud Storage", value)
+			}
+
+			attrs.PredefinedACL = acl
+		default:
+			return fmt.Errorf("unsupported header for Cloud Storage: %s", name)
+		}
+	}
+
+	return nil
+}
+
+// List returns every object beneath the prefix. Their ETags are the hex-encoded MD5 digests of
+// their contents, like those of S3 objects uploaded in a single part, so that unchanged files can
+// be recognized. Composite objects have no MD5 digest and are always considered changed.
+func (g *gcsBackend) List(ctx context.Context) (map[string]remoteObject, error) {
+	objects := map[string]remoteObject{}
+	it := g.bucket.Objects(ctx, &storage.Query{Prefix: g.prefix})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to list Cloud Storage objects: %v", err)
+		}
+
+		key := strings.TrimPrefix(attrs.Name, g.prefix)
+		objects[key] = remoteObject{
+			Key:          key,
+			Size:         attrs.Size,
+			ETag:         hex.EncodeToString(attrs.MD5),
+			LastModified: attrs.Updated,
+			StorageClass: attrs.StorageClass,
+		}
+	}
+
+	return objects, nil
+}
+
+func (g *gcsBackend) Head(ctx context.Context, path string) (objectHead, error) {
+	attrs, err := g.object(path).Attrs(ctx)
+	if err != nil {
+		return objectHead{}, fmt.Errorf("failed to read Cloud Storage object: %w", err)
+	}
+
+	return objectHead{
+		Size:        attrs.Size,
+		ETag:        hex.EncodeToString(attrs.MD5),
+		ContentType: attrs.ContentType,
+		Metadata:    attrs.Metadata,
+	}, nil
+}
+
+func (g *gcsBackend) Delete(ctx context.Context, paths []string) error {
+	for _, path := range paths {
+		err := g.bucket.Object(g.prefix + path).Delete(ctx)
+		if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+			return fmt.Errorf("failed to delete %s: %v", path, err)
+		}
+	}
+
+	return nil
+}
+
+func (g *gcsBackend) Sub(dir string) backend {
+	sub := *g
+	sub.prefix += dir
+
+	return &sub
+}
+
+func (g *gcsBackend) URL() string {
+	return fmt.Sprintf("https://storage.googleapis.com/%s/%s", g.name, g.prefix)
+}
+
+func (g *gcsBackend) ReadState(ctx context.Context, path string) ([]byte, error) {
+	body, _, err := g.ReadStateETag(ctx, path)
+	return body, err
+}
+
+// ReadStateETag returns the contents of the state object at the given path along with its
+// generation, which Cloud Storage uses for conditional requests instead of ETags.
+func (g *gcsBackend) ReadStateETag(ctx context.Context, path string) ([]byte, string, error) {
+	r, err := g.bucket.Object(g.prefix + path).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, "", fmt.Errorf("failed to read %s: %w", path, fs.ErrNotExist)
+	}
+
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	defer r.Close()
+
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	return body, strconv.FormatInt(r.Attrs.Generation, 10), nil
+}
+
+func (g *gcsBackend) WriteState(ctx context.Context, path string, body []byte) error {
+	_, err := g.writeState(ctx, g.bucket.Object(g.prefix+path), body)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+
+	return nil
+}
+
+func (g *gcsBackend) CreateState(ctx context.Context, path string, body []byte) (string, error) {
+	object := g.bucket.Object(g.prefix + path).If(storage.Conditions{DoesNotExist: true})
+	generation, err := g.writeState(ctx, object, body)
+	if isGCSPreconditionFailed(err) {
+		return "", fmt.Errorf("failed to create %s: %w", path, fs.ErrExist)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", path, err)
+	}
+
+	return generation, nil
+}
+
+func (g *gcsBackend) DeleteState(ctx context.Context, path, etag string) error {
+	generation, err := strconv.ParseInt(etag, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid generation of %s: %q", path, etag)
+	}
+
+	err = g.bucket.Object(g.prefix + path).If(storage.Conditions{GenerationMatch: generation}).Delete(ctx)
+	if isGCSPreconditionFailed(err) {
+		return fmt.Errorf("failed to delete %s: %w", path, fs.ErrExist)
+	}
+
+	if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("failed to delete %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// writeState stores a private JSON state object and returns its generation.
+func (g *gcsBackend) writeState(ctx context.Context, object *storage.ObjectHandle, body []byte) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := object.NewWriter(ctx)
+	w.ContentType = "application/json"
+	if _, err := w.Write(body); err != nil {
+		return "", err
+	}
+
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	return strconv.FormatInt(w.Attrs().Generation, 10), nil
+}
+
+// isGCSPreconditionFailed reports whether a conditional request failed because its condition
+// wasn't met.
+func isGCSPreconditionFailed(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed
+}
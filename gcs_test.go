@@ -0,0 +1,121 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func Test_newGCSStore(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		options backendOptions
+		want    *gcsBackend
+		wantErr bool
+	}{
+		{
+			desc:    "defaults",
+			options: backendOptions{Multipart: multipartSettings{PartSize: 8 * mebibyte}},
+			want:    &gcsBackend{name: "my-bucket", prefix: "site/", chunkSize: 8 * mebibyte},
+		},
+		{
+			desc:    "acl",
+			options: backendOptions{ACL: types.ObjectCannedACLPublicRead},
+			want:    &gcsBackend{name: "my-bucket", prefix: "site/", acl: "publicRead"},
+		},
+		{
+			desc:    "unsupported acl",
+			options: backendOptions{ACL: types.ObjectCannedACLAwsExecRead},
+			wantErr: true,
+		},
+		{
+			desc:    "kms key",
+			options: backendOptions{Encryption: serverSideEncryption{mode: types.ServerSideEncryptionAwsKms, kmsKeyID: "projects/p/locations/l/keyRings/r/cryptoKeys/k"}},
+			want:    &gcsBackend{name: "my-bucket", prefix: "site/", kmsKeyName: "projects/p/locations/l/keyRings/r/cryptoKeys/k"},
+		},
+		{
+			desc:    "customer key",
+			options: backendOptions{Encryption: serverSideEncryption{customerKey: []byte("key")}},
+			want:    &gcsBackend{name: "my-bucket", prefix: "site/", customerKey: []byte("key")},
+		},
+		{
+			desc:    "unsupported encryption",
+			options: backendOptions{Encryption: serverSideEncryption{mode: types.ServerSideEncryptionAwsKmsDsse}},
+			wantErr: true,
+		},
+		{
+			desc:    "tags",
+			options: backendOptions{Tags: map[string]string{"team": "web"}},
+			wantErr: true,
+		},
+		{
+			desc:    "checksum",
+			options: backendOptions{Checksum: uploadChecksum{md5: true}},
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := newGCSStore("my-bucket", "site/", tC.options)
+			if tC.wantErr {
+				if err == nil {
+					t.Fatal("Expected an error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("Expected %+v; got %+v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_applyGCSHeaders(t *testing.T) {
+	shared := map[string]string{"app-version": "1.0"}
+	attrs := &storage.ObjectAttrs{Metadata: shared}
+
+	err := applyGCSHeaders(attrs, map[string]string{
+		"Cache-Control":    "no-cache",
+		"Content-Encoding": "gzip",
+		"X-Amz-Acl":        "private",
+		"X-Amz-Meta-Owner": "web",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attrs.CacheControl != "no-cache" || attrs.ContentEncoding != "gzip" || attrs.PredefinedACL != "private" {
+		t.Errorf("Expected the headers to be applied; got %+v", attrs)
+	}
+
+	if want := map[string]string{"app-version": "1.0", "owner": "web"}; !reflect.DeepEqual(attrs.Metadata, want) {
+		t.Errorf("Expected metadata %v; got %v", want, attrs.Metadata)
+	}
+
+	if len(shared) != 1 {
+		t.Errorf("Expected the shared metadata to be left unchanged; got %v", shared)
+	}
+
+	if err := applyGCSHeaders(&storage.ObjectAttrs{}, map[string]string{redirectHeader: "/new"}); err == nil {
+		t.Error("Expected an error for an unsupported header")
+	}
+}
+
+func Test_gcsBackend_Sub(t *testing.T) {
+	base := &gcsBackend{name: "my-bucket", prefix: "site/"}
+
+	if got, want := base.Sub("deploys/v2/").URL(), "https://storage.googleapis.com/my-bucket/site/deploys/v2/"; got != want {
+		t.Errorf("Expected URL %s; got %s", want, got)
+	}
+
+	if base.prefix != "site/" {
+		t.Errorf("Expected the base prefix to be unchanged; got %s", base.prefix)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// gitChanges are the files in the working directory that changed since a commit.
+type gitChanges struct {
+	// Changed are the files that were added or modified, including untracked files.
+	Changed []string
+	// Deleted are the files that were removed.
+	Deleted []string
+}
+
+// changedSinceCommit asks git for the files beneath the working directory that changed between a
+// commit and the working tree, with paths relative to the working directory. Files that are
+// untracked but not ignored count as added.
+func changedSinceCommit(ctx context.Context, commit string) (gitChanges, error) {
+	if commit == "" || strings.HasPrefix(commit, "-") {
+		return gitChanges{}, fmt.Errorf("invalid commit %q", commit)
+	}
+
+	diff, err := runGit(ctx, "diff", "--name-status", "--no-renames", "--relative", "-z", commit, "--")
+	if err != nil {
+		return gitChanges{}, err
+	}
+
+	changes, err := parseNameStatus(diff)
+	if err != nil {
+		return gitChanges{}, err
+	}
+
+	untracked, err := runGit(ctx, "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return gitChanges{}, err
+	}
+
+	for _, path := range strings.Split(string(untracked), "\x00") {
+		if path != "" {
+			changes.Changed = append(changes.Changed, filepath.FromSlash(path))
+		}
+	}
+
+	sort.Strings(changes.Changed)
+
+	return changes, nil
+}
+
+// gitHead returns the commit checked out in the working directory.
+func gitHead(ctx context.Context) (string, error) {
+	out, err := runGit(ctx, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// runGit runs a git command in the working directory and returns its output.
+func runGit(ctx context.Context, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return out, nil
+}
+
+// parseNameStatus parses the output of `git diff --name-status -z` without rename detection,
+// which alternates between a status letter and a path.
+func parseNameStatus(out []byte) (gitChanges, error) {
+	fields := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	if len(fields) == 1 && fields[0] == "" {
+		return gitChanges{}, nil
+	}
+
+	if len(fields)%2 != 0 {
+		return gitChanges{}, fmt.Errorf("unexpected output from git diff: %q", out)
+	}
+
+	var changes gitChanges
+	for i := 0; i < len(fields); i += 2 {
+		status, path := fields[i], filepath.FromSlash(fields[i+1])
+		if status == "D" {
+			changes.Deleted = append(changes.Deleted, path)
+		} else {
+			changes.Changed = append(changes.Changed, path)
+		}
+	}
+
+	return changes, nil
+}
+
+// deletedKeys returns the keys of the objects to delete for removed files that pass the filter,
+// including their Brotli variants and website aliases.
+func deletedKeys(paths []string, filter pathFilter, variants *brotliVariants, aliases *websiteAliases) []string {
+	var keys []string
+	for _, path := range paths {
+		if !filter.Match(path) {
+			continue
+		}
+
+		key := filepath.ToSlash(path)
+		keys = append(keys, key)
+		if variants.Match(key) {
+			keys = append(keys, key+brotliExtension)
+		}
+
+		keys = append(keys, aliases.Keys(key)...)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_parseNameStatus(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		input   string
+		want    gitChanges
+		wantErr bool
+	}{
+		{desc: "no changes", input: ""},
+		{
+			desc:  "added, modified, and deleted",
+			input: "A\x00new.html\x00M\x00index.html\x00D\x00old.html\x00",
+			want:  gitChanges{Changed: []string{"new.html", "index.html"}, Deleted: []string{"old.html"}},
+		},
+		{
+			desc:  "type change",
+			input: "T\x00assets/logo.svg\x00",
+			want:  gitChanges{Changed: []string{filepath.FromSlash("assets/logo.svg")}},
+		},
+		{desc: "truncated output", input: "M\x00index.html\x00D\x00", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := parseNameStatus([]byte(tC.input))
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("Expected %+v; got %+v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_deletedKeys(t *testing.T) {
+	filter, _ := newPathFilter(nil, []string{"*.map"})
+	variants, _ := newBrotliVariants([]string{"*.js"})
+
+	aliases := newWebsiteAliases(true, false)
+
+	got := deletedKeys([]string{filepath.FromSlash("js/app.js"), "app.js.map", filepath.FromSlash("about/index.html")}, filter, variants, aliases)
+	want := []string{"about", "about/", "about/index.html", "js/app.js", "js/app.js.br"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q; got %q", want, got)
+	}
+}
+
+func Test_changedSinceCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	t.Chdir(t.TempDir())
+
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, out)
+		}
+	}
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git("init", "-q")
+	write("index.html", "v1")
+	write("old.html", "old")
+	write("assets/app.js", "v1")
+	write(".gitignore", "*.log\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+
+	write("index.html", "v2")
+	write("new.html", "new")
+	write("debug.log", "ignored")
+	if err := os.Remove("old.html"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := changedSinceCommit(context.Background(), "--output=x"); err == nil {
+		t.Error("Expected an error for a commit that looks like a flag")
+	}
+
+	got, err := changedSinceCommit(context.Background(), "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := gitChanges{Changed: []string{"index.html", "new.html"}, Deleted: []string{"old.html"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v; got %+v", want, got)
+	}
+
+	t.Chdir("assets")
+	write("app.js", "v2")
+
+	got, err = changedSinceCommit(context.Background(), "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = gitChanges{Changed: []string{"app.js"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v from a subdirectory; got %+v", want, got)
+	}
+}
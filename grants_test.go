@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_formatGrantees(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		grantees []string
+		want     string
+		wantErr  bool
+	}{
+		{desc: "canonical user", grantees: []string{"id=79a59df9"}, want: `id="79a59df9"`},
+		{
+			desc:     "several grantees",
+			grantees: []string{"uri=http://acs.amazonaws.com/groups/global/AllUsers", `emailAddress="ops@example.com"`},
+			want:     `uri="http://acs.amazonaws.com/groups/global/AllUsers", emailAddress="ops@example.com"`,
+		},
+		{desc: "unknown type", grantees: []string{"arn=arn:aws:iam::123456789012:root"}, wantErr: true},
+		{desc: "missing value", grantees: []string{"id="}, wantErr: true},
+		{desc: "missing type", grantees: []string{"79a59df9"}, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := formatGrantees(tC.grantees)
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if got != tC.want {
+				t.Errorf("Expected %s; got %s", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_objectGrants_headerRules(t *testing.T) {
+	grants := objectGrants{read: stringList{"id=reader"}, fullControl: stringList{"id=owner"}}
+
+	got, err := grants.headerRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []headerRule{
+		{pattern: "**", header: "X-Amz-Grant-Read", value: `id="reader"`},
+		{pattern: "**", header: "X-Amz-Grant-Full-Control", value: `id="owner"`},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected rules %v; got %v", want, got)
+	}
+
+	if grants.Empty() || !(objectGrants{}).Empty() {
+		t.Error("Expected only the grants without grantees to be empty")
+	}
+}
+
+func Test_usesACLs(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		rules []headerRule
+		want  bool
+	}{
+		{desc: "no rules"},
+		{desc: "other headers", rules: []headerRule{{pattern: "**", header: "Cache-Control", value: "no-cache"}}},
+		{desc: "omitted ACL", rules: []headerRule{{pattern: "private/**", header: "X-Amz-Acl", value: ""}}},
+		{desc: "ACL", rules: []headerRule{{pattern: "private/**", header: "X-Amz-Acl", value: "private"}}, want: true},
+		{desc: "grant", rules: []headerRule{{pattern: "**", header: "X-Amz-Grant-Read", value: `id="reader"`}}, want: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := usesACLs(tC.rules); got != tC.want {
+				t.Errorf("Expected %v; got %v", tC.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	syncplan "github.com/Zeroed-Books/s3-copy/pkg/sync"
+)
+
+// hashCacheBucket is the bbolt bucket holding the cached hashes, by path.
+var hashCacheBucket = []byte("files")
+
+// cachedHash holds the hashes of a file, along with the size and modification time it had when it
+// was hashed.
+type cachedHash struct {
+	Size int64 `json:"size"`
+	// ModTime is the modification time in nanoseconds since the Unix epoch.
+	ModTime int64  `json:"mtime"`
+	SHA256  string `json:"sha256"`
+	// ETags are the ETags S3 would assign to the file, by the part size they were computed for.
+	// The single-request ETag has a part size of zero.
+	ETags map[string]string `json:"etags"`
+}
+
+// hashCache stores the hashes of local files in a bbolt database, so that repeated syncs don't
+// hash unchanged files again. Entries are only used while the size and modification time of
+// their file are the same, since any change to a file is expected to change either.
+type hashCache struct {
+	db *bbolt.DB
+}
+
+// openHashCache opens the hash cache at the given path, creating it if it doesn't exist. Only one
+// run can use a cache at a time.
+func openHashCache(path string) (*hashCache, error) {
+	db, err := bbolt.Open(path, 0o644, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("could not open hash cache %s: %v", path, err)
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(hashCacheBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not initialize hash cache %s: %v", path, err)
+	}
+
+	return &hashCache{db: db}, nil
+}
+
+// lookup returns the cached hashes of the file, if they are still valid for its current size and
+// modification time.
+func (c *hashCache) lookup(path string, info fs.FileInfo) (cachedHash, bool) {
+	var entry cachedHash
+	found := false
+	c.db.View(func(tx *bbolt.Tx) error {
+		value := tx.Bucket(hashCacheBucket).Get([]byte(path))
+		found = value != nil && json.Unmarshal(value, &entry) == nil
+		return nil
+	})
+
+	if !found || entry.Size != info.Size() || entry.ModTime != info.ModTime().UnixNano() {
+		return cachedHash{}, false
+	}
+
+	return entry, true
+}
+
+// ETag returns the ETag S3 would assign to the file for the given part size, from the cache if
+// possible. Otherwise the file is hashed, and its hashes are stored in the cache.
+func (c *hashCache) ETag(fsys fs.FS, path string, info fs.FileInfo, partSize int64) (string, error) {
+	key := strconv.FormatInt(partSize, 10)
+
+	entry, ok := c.lookup(path, info)
+	if etag, cached := entry.ETags[key]; ok && cached {
+		return etag, nil
+	}
+
+	if !ok {
+		entry = cachedHash{Size: info.Size(), ModTime: info.ModTime().UnixNano(), ETags: map[string]string{}}
+	}
+
+	file, err := fsys.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("could not open %s for reading: %v", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	etag, err := syncplan.LocalETag(io.TeeReader(file, hash), partSize)
+	if err != nil {
+		return "", fmt.Errorf("could not hash %s: %v", path, err)
+	}
+
+	entry.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	entry.ETags[key] = etag
+
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+
+	// Batching the writes of concurrent comparisons avoids syncing the database for every file.
+	err = c.db.Batch(func(tx *bbolt.Tx) error {
+		return tx.Bucket(hashCacheBucket).Put([]byte(path), value)
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not update hash cache: %v", err)
+	}
+
+	return etag, nil
+}
+
+// Close closes the database of the cache. It is safe to call on a nil cache.
+func (c *hashCache) Close() error {
+	if c == nil {
+		return nil
+	}
+
+	return c.db.Close()
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func Test_hashCache_ETag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hashes.db")
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		desc     string
+		body     string
+		modTime  time.Time
+		partSize int64
+		want     string
+	}{
+		{desc: "hashed", body: "some body", modTime: modified, want: "328c30fae61cd119cd177c061d1ac11f"},
+		// The contents changed without changing the size or modification time, which shows that
+		// the cached ETag is used.
+		{desc: "cached", body: "some BODY", modTime: modified, want: "328c30fae61cd119cd177c061d1ac11f"},
+		{desc: "modified", body: "some BODY", modTime: modified.Add(time.Second), want: "c59865630731a51c1369749d83383ea2"},
+		{desc: "other part size", body: "some BODY", modTime: modified.Add(time.Second), partSize: 5 * mebibyte, want: "08ba244adbad5635606e1175fc0a0e81-1"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			// The cache is reopened for every case, as by separate runs.
+			cache, err := openHashCache(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cache.Close()
+
+			fsys := fstest.MapFS{"foo.txt": {Data: []byte(tC.body), ModTime: tC.modTime}}
+			info, _ := fs.Stat(fsys, "foo.txt")
+
+			got, err := cache.ETag(fsys, "foo.txt", info, tC.partSize)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got != tC.want {
+				t.Errorf("Expected ETag %s; got %s", tC.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// hashLength is the number of hex digits of the content hash that are added to renamed keys.
+const hashLength = 8
+
+// hashRenames maps the slash-separated paths of files that are uploaded under a key containing a
+// hash of their contents to that key, for pipelines whose bundlers don't fingerprint assets.
+// Fingerprinted files can be cached forever, since any change to them results in a new key. With
+// -normalize-keys, it also maps files whose keys are normalized to their normalized key.
+type hashRenames map[string]string
+
+// newHashRenames hashes the files matching any of the given glob patterns to determine their
+// keys. Each pattern may be a comma-separated list. If no patterns are given, nil is returned and
+// no files are renamed.
+func newHashRenames(fsys fs.FS, walkFiles treeWalker, filter pathFilter, patterns []string) (hashRenames, error) {
+	split := splitPatterns(patterns)
+	if len(split) == 0 {
+		return nil, nil
+	}
+
+	if _, err := newPathFilter(split, nil); err != nil {
+		return nil, fmt.Errorf("invalid hash-names pattern: %v", err)
+	}
+
+	renames := hashRenames{}
+	err := walkFiles(createFilterFunc(filter, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("could not walk %s: %v", name, err)
+		}
+
+		name = filepath.ToSlash(name)
+		if entry.IsDir() || !matchAny(split, name) {
+			return nil
+		}
+
+		digest, _, err := digestFile(fsys, name, false)
+		if err != nil {
+			return err
+		}
+
+		renames[name] = hashedName(name, digest[:hashLength])
+
+		return nil
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	return renames, nil
+}
+
+// hashedName adds a hash before the extension of a file name, e.g. `app.js` becomes
+// `app.3fa9c1d2.js`. Files without an extension get the hash appended.
+func hashedName(name, hash string) string {
+	ext := path.Ext(name)
+	if ext == "" || ext == path.Base(name) {
+		return name + "." + hash
+	}
+
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// Key returns the key the file at the given path is uploaded under.
+func (r hashRenames) Key(name string) string {
+	if key, ok := r[filepath.ToSlash(name)]; ok {
+		return key
+	}
+
+	return name
+}
+
+// Remote returns a copy of the remote objects in which renamed files, and their Brotli variants,
+// appear under their local paths, so that they're only uploaded again when their contents change.
+func (r hashRenames) Remote(remote map[string]remoteObject) map[string]remoteObject {
+	if len(r) == 0 {
+		return remote
+	}
+
+	view := make(map[string]remoteObject, len(remote))
+	for key, object := range remote {
+		view[key] = object
+	}
+
+	for name, key := range r {
+		for _, ext := range []string{"", brotliExtension} {
+			if object, ok := remote[key+ext]; ok {
+				view[name+ext] = object
+			} else {
+				delete(view, name+ext)
+			}
+		}
+	}
+
+	return view
+}
+
+// renameSeenKeys replaces the paths of renamed files in `seen` with their keys, so that objects
+// uploaded under a file's plain name, or under the hash of a previous version of it, are
+// considered stale when deleting objects that no longer exist locally.
+func renameSeenKeys(seen map[string]bool, renames hashRenames) {
+	for name, key := range renames {
+		if seen[name] {
+			delete(seen, name)
+			seen[key] = true
+		}
+	}
+}
+
+// Encode returns the renames as a JSON object mapping paths to keys.
+func (r hashRenames) Encode() ([]byte, error) {
+	body, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(body, '\n'), nil
+}
+
+// renameUploader uploads files under their content-hashed or normalized keys.
+type renameUploader struct {
+	renames hashRenames
+	next    uploader
+}
+
+func (u *renameUploader) Upload(ctx context.Context, object *uploadObject) error {
+	object.Path = u.renames.Key(object.Path)
+
+	return u.next.Upload(ctx, object)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_newHashRenames(t *testing.T) {
+	fsys := fstest.MapFS{
+		"assets/app.js":  {Data: []byte("alert(1)")},
+		"assets/app.map": {Data: []byte("{}")},
+		"vendor/lib.js":  {Data: []byte("alert(1)")},
+		"index.html":     {Data: []byte("hello")},
+	}
+	walk := func(fn fs.WalkDirFunc) error {
+		return fs.WalkDir(fsys, ".", fn)
+	}
+	filter, _ := newPathFilter(nil, []string{"vendor/**"})
+
+	renames, err := newHashRenames(fsys, walk, filter, []string{"*.js,*.css"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := hashRenames{"assets/app.js": "assets/app.6e11c72f.js"}
+	if !reflect.DeepEqual(renames, want) {
+		t.Errorf("Expected renames %v; got %v", want, renames)
+	}
+
+	if renames, err := newHashRenames(fsys, walk, filter, nil); renames != nil || err != nil {
+		t.Errorf("Expected no renames without patterns; got %v, %v", renames, err)
+	}
+
+	if _, err := newHashRenames(fsys, walk, filter, []string{"[a-"}); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+}
+
+func Test_hashedName(t *testing.T) {
+	testCases := []struct {
+		desc string
+		name string
+		want string
+	}{
+		{
+			desc: "extension",
+			name: "assets/app.min.js",
+			want: "assets/app.min.3fa9c1d2.js",
+		},
+		{
+			desc: "no extension",
+			name: "LICENSE",
+			want: "LICENSE.3fa9c1d2",
+		},
+		{
+			desc: "dot file",
+			name: "assets/.env",
+			want: "assets/.env.3fa9c1d2",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := hashedName(tC.name, "3fa9c1d2"); got != tC.want {
+				t.Errorf("Expected %s; got %s", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_hashRenames_Remote(t *testing.T) {
+	renames := hashRenames{
+		"app.js":    "app.11111111.js",
+		"style.css": "style.22222222.css",
+	}
+	remote := map[string]remoteObject{
+		"app.11111111.js":    {Key: "app.11111111.js", ETag: `"new"`},
+		"app.11111111.js.br": {Key: "app.11111111.js.br", ETag: `"new-br"`},
+		"style.css":          {Key: "style.css", ETag: `"plain"`},
+		"index.html":         {Key: "index.html"},
+	}
+
+	view := renames.Remote(remote)
+
+	if view["app.js"].ETag != `"new"` || view["app.js.br"].ETag != `"new-br"` {
+		t.Errorf("Expected the renamed objects under the local paths; got %v", view)
+	}
+
+	if _, ok := view["style.css"]; ok {
+		t.Error("Expected an object under the plain name of a renamed file to be ignored")
+	}
+
+	if _, ok := view["index.html"]; !ok {
+		t.Error("Expected other objects to be kept")
+	}
+
+	if _, ok := remote["app.js"]; ok {
+		t.Error("Expected the remote objects to be left unchanged")
+	}
+}
+
+func Test_renameSeenKeys(t *testing.T) {
+	seen := map[string]bool{"app.js": true, "index.html": true}
+
+	renameSeenKeys(seen, hashRenames{"app.js": "app.11111111.js", "gone.js": "gone.22222222.js"})
+
+	want := map[string]bool{"app.11111111.js": true, "index.html": true}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("Expected %v; got %v", want, seen)
+	}
+}
+
+func Test_renameUploader(t *testing.T) {
+	next := &recordingUploader{}
+	u := &renameUploader{renames: hashRenames{"app.js": "app.11111111.js"}, next: next}
+
+	for _, path := range []string{"app.js", "index.html"} {
+		if err := u.Upload(context.Background(), &uploadObject{Path: path, Body: strings.NewReader("")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if next.objects[0].Path != "app.11111111.js" || next.objects[1].Path != "index.html" {
+		t.Errorf("Expected only app.js to be renamed; got %s and %s", next.objects[0].Path, next.objects[1].Path)
+	}
+}
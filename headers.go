@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// defaultFingerprintPattern matches file names containing a content hash of at least 8 hex
+// digits, as most bundlers produce them, e.g. `app.3fa9c1d2.js` or `chunk-3fa9c1d2.js`. The hash
+// must contain a letter, so that dates such as `report-20241016.html` aren't taken for one. As
+// there are no lookaheads, each alternative allows a different number of digits before the first
+// letter.
+const defaultFingerprintPattern = `[.-](?:[a-f][0-9a-f]{7,}|[0-9][a-f][0-9a-f]{6,}|[0-9]{2}[a-f][0-9a-f]{5,}|[0-9]{3}[a-f][0-9a-f]{4,}|[0-9]{4}[a-f][0-9a-f]{3,}|[0-9]{5}[a-f][0-9a-f]{2,}|[0-9]{6}[a-f][0-9a-f]+|[0-9]{7,}[a-f][0-9a-f]*)\.[^/]+$`
+
+// The Cache-Control headers applied by `-auto-cache`. Fingerprinted files never change, so they
+// can be cached forever, while every other file has to be revalidated on each request.
+const (
+	immutableCacheControl = "public, max-age=31536000, immutable"
+	mutableCacheControl   = "no-cache"
+)
+
+// headerRule sets an HTTP header on every uploaded file whose path matches a glob pattern, or a
+// regular expression if one is set.
+type headerRule struct {
+	pattern string
+	regexp  *regexp.Regexp
+	header  string
+	value   string
+}
+
+// Match reports whether the rule applies to the file at the given slash-separated path.
+func (r headerRule) Match(name string) bool {
+	if r.regexp != nil {
+		return r.regexp.MatchString(name)
+	}
+
+	ok, _ := matchGlob(r.pattern, name)
+
+	return ok
+}
+
+// parseHeaderRule parses a rule of the form `<pattern>=<value>` for the given header.
+func parseHeaderRule(header, rule string) (headerRule, error) {
+	parts := strings.SplitN(rule, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return headerRule{}, fmt.Errorf("invalid %s rule %q: expected <pattern>=<value>", header, rule)
+	}
+
+	if _, err := newPathFilter([]string{parts[0]}, nil); err != nil {
+		return headerRule{}, fmt.Errorf("invalid %s rule %q: %v", header, rule, err)
+	}
+
+	return headerRule{
+		pattern: parts[0],
+		header:  http.CanonicalHeaderKey(header),
+		value:   parts[1],
+	}, nil
+}
+
+// autoCacheRules returns the Cache-Control rules of `-auto-cache`: files whose path matches the
+// fingerprint pattern, or the default one if it's empty, are cached forever, and every other file
+// is revalidated.
+func autoCacheRules(fingerprintPattern string) ([]headerRule, error) {
+	if fingerprintPattern == "" {
+		fingerprintPattern = defaultFingerprintPattern
+	}
+
+	fingerprint, err := regexp.Compile(fingerprintPattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fingerprint pattern: %v", err)
+	}
+
+	return []headerRule{
+		{regexp: fingerprint, header: "Cache-Control", value: immutableCacheControl},
+		{pattern: "**", header: "Cache-Control", value: mutableCacheControl},
+	}, nil
+}
+
+// headerUploader applies header rules to each object before passing it on to another uploader.
+// For each header, the first rule matching an object's path wins.
+type headerUploader struct {
+	rules []headerRule
+	next  uploader
+}
+
+func (u *headerUploader) Upload(ctx context.Context, object *uploadObject) error {
+	for _, rule := range u.rules {
+		if _, ok := object.Headers[rule.header]; ok {
+			continue
+		}
+
+		if !rule.Match(filepath.ToSlash(object.Path)) {
+			continue
+		}
+
+		if object.Headers == nil {
+			object.Headers = map[string]string{}
+		}
+
+		object.Headers[rule.header] = rule.value
+	}
+
+	return u.next.Upload(ctx, object)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func Test_parseHeaderRule(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		rule    string
+		want    headerRule
+		wantErr bool
+	}{
+		{
+			desc: "simple value",
+			rule: "*.html=no-cache",
+			want: headerRule{pattern: "*.html", header: "Cache-Control", value: "no-cache"},
+		},
+		{
+			desc: "value containing equals",
+			rule: "assets/**=public,max-age=31536000,immutable",
+			want: headerRule{pattern: "assets/**", header: "Cache-Control", value: "public,max-age=31536000,immutable"},
+		},
+		{
+			desc:    "missing value",
+			rule:    "*.html",
+			wantErr: true,
+		},
+		{
+			desc:    "missing pattern",
+			rule:    "=no-cache",
+			wantErr: true,
+		},
+		{
+			desc:    "invalid pattern",
+			rule:    "[a-=no-cache",
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := parseHeaderRule("cache-control", tC.rule)
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if got != tC.want {
+				t.Errorf("Expected rule %+v; got %+v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_headerUploader(t *testing.T) {
+	rules := []headerRule{
+		{pattern: "*.html", header: "Cache-Control", value: "no-cache"},
+		{pattern: "assets/**", header: "Cache-Control", value: "immutable"},
+		{pattern: "**", header: "Cache-Control", value: "max-age=60"},
+	}
+
+	testCases := []struct {
+		desc string
+		path string
+		want string
+	}{
+		{desc: "first rule", path: "index.html", want: "no-cache"},
+		{desc: "first match wins", path: "assets/page.html", want: "no-cache"},
+		{desc: "second rule", path: "assets/app.js", want: "immutable"},
+		{desc: "fallback rule", path: "robots.txt", want: "max-age=60"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := mockUploader{}
+			headerClient := headerUploader{rules: rules, next: &client}
+
+			if err := headerClient.Upload(context.Background(), &uploadObject{Path: tC.path}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got := client.uploadedObject.Headers["Cache-Control"]; got != tC.want {
+				t.Errorf("Expected Cache-Control %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_autoCacheRules(t *testing.T) {
+	rules, err := autoCacheRules(defaultFingerprintPattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules = append([]headerRule{{pattern: "sw.js", header: "Cache-Control", value: "max-age=0"}}, rules...)
+
+	testCases := []struct {
+		desc string
+		path string
+		want string
+	}{
+		{desc: "hashed with dot", path: "assets/app.3fa9c1d2.js", want: immutableCacheControl},
+		{desc: "hashed with dash", path: "assets/chunk-3fa9c1d2e4.js", want: immutableCacheControl},
+		{desc: "hashed brotli variant", path: "assets/app.3fa9c1d2.js.br", want: immutableCacheControl},
+		{desc: "hash starting with digits", path: "assets/app.1234567a.js", want: immutableCacheControl},
+		{desc: "short hash", path: "assets/app.3fa9c1.js", want: mutableCacheControl},
+		{desc: "dated name", path: "reports/report-20241016.html", want: mutableCacheControl},
+		{desc: "timestamped name", path: "backup.20241016123045.tar.gz", want: mutableCacheControl},
+		{desc: "hash in directory", path: "3fa9c1d2.v1/app.js", want: mutableCacheControl},
+		{desc: "page", path: "index.html", want: mutableCacheControl},
+		{desc: "explicit rule", path: "sw.js", want: "max-age=0"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := mockUploader{}
+			headerClient := headerUploader{rules: rules, next: &client}
+
+			if err := headerClient.Upload(context.Background(), &uploadObject{Path: tC.path}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got := client.uploadedObject.Headers["Cache-Control"]; got != tC.want {
+				t.Errorf("Expected Cache-Control %q; got %q", tC.want, got)
+			}
+		})
+	}
+
+	if _, err := autoCacheRules("[a-"); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+
+	if rules, err := autoCacheRules(""); err != nil || rules[0].regexp.String() != defaultFingerprintPattern {
+		t.Errorf("Expected an empty pattern to use the default; got %v (error %v)", rules, err)
+	}
+}
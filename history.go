@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// historyDir is the state directory holding a record of every deploy.
+const historyDir = stateDir + "history/"
+
+// historyTimeFormat names history records by the time of the deploy, so that they sort in order.
+const historyTimeFormat = "20060102T150405Z"
+
+// deployRecord describes a deploy, for auditing what was shipped and when.
+type deployRecord struct {
+	Time          time.Time `json:"time"`
+	AppVersion    string    `json:"app_version,omitempty"`
+	GitCommit     string    `json:"git_commit,omitempty"`
+	DeployVersion string    `json:"deploy_version,omitempty"`
+	// Files are the files that were deployed, whether or not they had to be uploaded.
+	Files []deployedFile `json:"files"`
+	// Deleted are the keys of the stale objects that were deleted.
+	Deleted []string `json:"deleted,omitempty"`
+}
+
+// deployedFile is a file that was part of a deploy.
+type deployedFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// newDeployRecord describes a deploy of the given files, hashing each of them.
+func newDeployRecord(fsys fs.FS, paths []string, now time.Time) (*deployRecord, error) {
+	record := &deployRecord{Time: now.UTC(), Files: make([]deployedFile, 0, len(paths))}
+	for _, path := range paths {
+		file, err := hashFile(fsys, path)
+		if err != nil {
+			return nil, err
+		}
+
+		record.Files = append(record.Files, file)
+	}
+
+	sort.Slice(record.Files, func(i, j int) bool {
+		return record.Files[i].Path < record.Files[j].Path
+	})
+
+	return record, nil
+}
+
+func hashFile(fsys fs.FS, path string) (deployedFile, error) {
+	file, err := fsys.Open(filepath.ToSlash(path))
+	if err != nil {
+		return deployedFile{}, fmt.Errorf("could not hash %s: %v", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return deployedFile{}, fmt.Errorf("could not hash %s: %v", path, err)
+	}
+
+	return deployedFile{
+		Path:   filepath.ToSlash(path),
+		Size:   size,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// Name returns the name the record is stored under.
+func (r *deployRecord) Name() string {
+	return r.Time.UTC().Format(historyTimeFormat)
+}
+
+// Save stores the record in the deploy history.
+func (r *deployRecord) Save(ctx context.Context, store stateStore) error {
+	body, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return store.WriteState(ctx, historyDir+r.Name()+".json", body)
+}
+
+// runHistory implements the `history` command, which lists the recorded deploys, or shows the
+// record of a single deploy.
+func runHistory(cmd command, args []string) {
+	var common commonFlags
+	var limit int
+
+	flags := newFlagSet(cmd, "[flags] [deploy]")
+	common.register(flags)
+	flags.IntVar(&limit, "limit", 20, "Number of most recent deploys to list (0 for all)")
+	flags.Parse(args)
+
+	if _, err := common.applyConfig(flags); err != nil {
+		log.Fatal(err)
+	}
+
+	if flags.NArg() > 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := newSignalContext()
+	defer stop()
+
+	client, err := common.newClient(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store := newS3Uploader(client, common.bucket, "")
+	store.Prefix = normalizePrefix(common.prefix)
+
+	if name := flags.Arg(0); name != "" {
+		body, err := store.ReadState(ctx, historyDir+strings.TrimSuffix(name, ".json")+".json")
+		if err != nil {
+			log.Fatal("Could not read deploy: ", err)
+		}
+
+		os.Stdout.Write(body)
+		fmt.Println()
+		return
+	}
+
+	records, err := loadHistory(ctx, client, &store, limit)
+	if err != nil {
+		log.Fatal("Could not read the deploy history: ", err)
+	}
+
+	if err := printHistory(os.Stdout, records); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// loadHistory reads the most recent deploy records, newest first. A limit of 0 reads every record.
+func loadHistory(ctx context.Context, client *s3.Client, store *s3Uploader, limit int) ([]*deployRecord, error) {
+	objects, _, err := listDirectory(ctx, client, store.bucket, store.Prefix+historyDir, false)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(objects))
+	for _, object := range objects {
+		names = append(names, object.Key)
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	if limit > 0 && len(names) > limit {
+		names = names[:limit]
+	}
+
+	records := make([]*deployRecord, 0, len(names))
+	for _, name := range names {
+		body, err := store.ReadState(ctx, historyDir+name)
+		if err != nil {
+			return nil, err
+		}
+
+		var record deployRecord
+		if err := json.Unmarshal(body, &record); err != nil {
+			return nil, fmt.Errorf("could not parse %s: %v", name, err)
+		}
+
+		records = append(records, &record)
+	}
+
+	return records, nil
+}
+
+// printHistory writes a table of deploy records.
+func printHistory(w io.Writer, records []*deployRecord) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "DEPLOY\tTIME\tFILES\tDELETED\tAPP VERSION\tCOMMIT\tVERSION\n")
+	for _, record := range records {
+		commit := record.GitCommit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+
+		fmt.Fprintf(
+			tw,
+			"%s\t%s\t%d\t%d\t%s\t%s\t%s\n",
+			record.Name(),
+			record.Time.Local().Format("2006-01-02 15:04:05"),
+			len(record.Files),
+			len(record.Deleted),
+			valueOrDash(record.AppVersion),
+			valueOrDash(commit),
+			valueOrDash(record.DeployVersion),
+		)
+	}
+
+	return tw.Flush()
+}
+
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
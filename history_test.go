@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func Test_newDeployRecord(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":    {Data: []byte("hello")},
+		"assets/app.js": {Data: []byte("")},
+	}
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	record, err := newDeployRecord(fsys, []string{"index.html", "assets/app.js"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []deployedFile{
+		{Path: "assets/app.js", Size: 0, SHA256: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{Path: "index.html", Size: 5, SHA256: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+	}
+	if !reflect.DeepEqual(record.Files, want) {
+		t.Errorf("Expected files %+v; got %+v", want, record.Files)
+	}
+
+	if name := record.Name(); name != "20240501T123000Z" {
+		t.Errorf("Expected name 20240501T123000Z; got %s", name)
+	}
+
+	if _, err := newDeployRecord(fsys, []string{"missing.txt"}, now); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func Test_deployRecord_Save(t *testing.T) {
+	store := &mockStateStore{}
+	record := &deployRecord{
+		Time:       time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+		AppVersion: "1.4.0",
+		Files:      []deployedFile{{Path: "index.html", Size: 5, SHA256: "abc"}},
+		Deleted:    []string{"old.js"},
+	}
+
+	if err := record.Save(context.Background(), store); err != nil {
+		t.Fatal(err)
+	}
+
+	body, ok := store.objects[historyDir+"20240501T123000Z.json"]
+	if !ok {
+		t.Fatalf("Expected the record to be saved in the history; got %v", store.objects)
+	}
+
+	var got deployRecord
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(&got, record) {
+		t.Errorf("Expected %+v; got %+v", record, got)
+	}
+}
+
+func Test_printHistory(t *testing.T) {
+	records := []*deployRecord{
+		{
+			Time:          time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC),
+			AppVersion:    "1.4.0",
+			GitCommit:     "3f9c2e1a7b8d4c6e9f0a1b2c3d4e5f6a7b8c9d0e",
+			DeployVersion: "v42",
+			Files:         make([]deployedFile, 3),
+			Deleted:       []string{"old.js"},
+		},
+		{Time: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC), Files: make([]deployedFile, 2)},
+	}
+
+	var out bytes.Buffer
+	if err := printHistory(&out, records); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected a header and 2 rows; got %q", out.String())
+	}
+
+	if fields := strings.Fields(lines[0]); fields[0] != "DEPLOY" {
+		t.Errorf("Expected a header row; got %q", lines[0])
+	}
+
+	fields := strings.Fields(lines[1])
+	want := []string{"20240502T090000Z", "3", "1", "1.4.0", "3f9c2e1a7b8d", "v42"}
+	got := []string{fields[0], fields[3], fields[4], fields[5], fields[6], fields[7]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected columns %q; got %q", want, got)
+	}
+
+	if fields := strings.Fields(lines[2]); fields[len(fields)-1] != "-" {
+		t.Errorf("Expected missing values to be shown as '-'; got %q", lines[2])
+	}
+}
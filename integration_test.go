@@ -0,0 +1,201 @@
+//go:build integration
+
+// The integration tests run the CLI against a local MinIO server, which is started in Docker if
+// none is running at S3COPY_DEV_ENDPOINT or http://localhost:9000:
+//
+//	go test -tags integration -run Integration .
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// integrationBinary is the CLI built for the integration tests.
+var integrationBinary string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "s3-copy-integration")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	integrationBinary = filepath.Join(dir, "s3-copy")
+	build := exec.Command("go", "build", "-o", integrationBinary, ".")
+	build.Stderr = os.Stderr
+	if err := build.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, "could not build s3-copy:", err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// integrationBucket creates a new bucket on the dev server for a single test, and returns its name
+// along with a client for it.
+func integrationBucket(t *testing.T) (string, *s3.Client) {
+	t.Helper()
+
+	common := commonFlags{dev: true, bucket: fmt.Sprintf("s3-copy-test-%d", time.Now().UnixNano())}
+	if err := common.applyDev(); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := common.newClient(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return common.bucket, client
+}
+
+// runCLI runs the CLI in the given working directory, failing the test if it exits with an error.
+func runCLI(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command(integrationBinary, args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("s3-copy %s failed: %v\n%s", strings.Join(args, " "), err, output)
+	}
+
+	return string(output)
+}
+
+// writeTree creates the given files, keyed by their slash-separated paths, beneath a directory.
+func writeTree(t *testing.T, dir string, files map[string][]byte) {
+	t.Helper()
+
+	for path, body := range files {
+		name := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(name, body, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// bucketObjects returns the objects in a bucket, keyed by their key.
+func bucketObjects(t *testing.T, client *s3.Client, bucket string) map[string]remoteObject {
+	t.Helper()
+
+	objects, err := listObjects(context.Background(), client, bucket, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return objects
+}
+
+func Test_Integration_upload(t *testing.T) {
+	bucket, client := integrationBucket(t)
+	dir := t.TempDir()
+	writeTree(t, dir, map[string][]byte{
+		"index.html":    []byte("<h1>Hello</h1>"),
+		"assets/app.js": []byte("console.log('hello')"),
+	})
+
+	runCLI(t, dir, "upload", "-dev", "-bucket", bucket, "-acl", "none", "-verify")
+
+	objects := bucketObjects(t, client, bucket)
+	if len(objects) != 2 || objects["index.html"].Size != 14 {
+		t.Fatalf("Unexpected objects: %+v", objects)
+	}
+
+	head, err := client.HeadObject(context.Background(), &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String("index.html")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := aws.ToString(head.ContentType); !strings.HasPrefix(got, "text/html") {
+		t.Errorf("Expected an HTML content type; got %s", got)
+	}
+}
+
+func Test_Integration_sync(t *testing.T) {
+	bucket, client := integrationBucket(t)
+	dir := t.TempDir()
+	writeTree(t, dir, map[string][]byte{
+		"index.html": []byte("v1"),
+		"about.html": []byte("about"),
+		"old.html":   []byte("old"),
+	})
+
+	runCLI(t, dir, "sync", "-dev", "-bucket", bucket, "-acl", "none")
+	before := bucketObjects(t, client, bucket)
+
+	writeTree(t, dir, map[string][]byte{"index.html": []byte("v2")})
+	if err := os.Remove(filepath.Join(dir, "old.html")); err != nil {
+		t.Fatal(err)
+	}
+
+	runCLI(t, dir, "sync", "-dev", "-bucket", bucket, "-acl", "none", "-delete")
+	after := bucketObjects(t, client, bucket)
+
+	if _, ok := after["old.html"]; ok || len(after) != 2 {
+		t.Errorf("Expected the removed file's object to be deleted; got %+v", after)
+	}
+
+	if after["index.html"].ETag == before["index.html"].ETag {
+		t.Error("Expected the changed file to be uploaded")
+	}
+
+	if !after["about.html"].LastModified.Equal(before["about.html"].LastModified) {
+		t.Error("Expected the unchanged file to be skipped")
+	}
+}
+
+func Test_Integration_multipart(t *testing.T) {
+	bucket, client := integrationBucket(t)
+	dir := t.TempDir()
+
+	body := make([]byte, 12*mebibyte)
+	if _, err := rand.Read(body); err != nil {
+		t.Fatal(err)
+	}
+
+	writeTree(t, dir, map[string][]byte{"video.bin": body})
+
+	runCLI(t, dir, "sync", "-dev", "-bucket", bucket, "-acl", "none", "-part-size", "5", "-verify")
+
+	object := bucketObjects(t, client, bucket)["video.bin"]
+	if !strings.HasSuffix(object.ETag, "-3") {
+		t.Errorf("Expected a multipart ETag with 3 parts; got %s", object.ETag)
+	}
+
+	// A second sync recognizes the multipart object as unchanged.
+	runCLI(t, dir, "sync", "-dev", "-bucket", bucket, "-acl", "none")
+	if got := bucketObjects(t, client, bucket)["video.bin"]; !got.LastModified.Equal(object.LastModified) {
+		t.Error("Expected the unchanged multipart object to be skipped")
+	}
+
+	downloaded := t.TempDir()
+	runCLI(t, dir, "download", "-dev", "-bucket", bucket, "-dest", downloaded)
+
+	got, err := os.ReadFile(filepath.Join(downloaded, "video.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, body) {
+		t.Error("Expected the downloaded file to match the uploaded one")
+	}
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/parquet-go/parquet-go"
+)
+
+// inventoryManifestName is the name of the manifest S3 Inventory writes for every report.
+const inventoryManifestName = "manifest.json"
+
+// inventoryClient reads S3 Inventory reports.
+type inventoryClient interface {
+	s3.ListObjectsV2APIClient
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// inventoryManifest is the manifest of an S3 Inventory report, listing its data files.
+type inventoryManifest struct {
+	SourceBucket string `json:"sourceBucket"`
+	FileFormat   string `json:"fileFormat"`
+	// FileSchema lists the columns of the data files, e.g. "Bucket, Key, Size, ETag".
+	FileSchema string `json:"fileSchema"`
+	// CreationTimestamp is when the report was started, in milliseconds since the Unix epoch.
+	CreationTimestamp string `json:"creationTimestamp"`
+	Files             []struct {
+		Key string `json:"key"`
+	} `json:"files"`
+}
+
+// Created returns when the report was started, or the zero time if the manifest doesn't say.
+func (m inventoryManifest) Created() time.Time {
+	millis, err := strconv.ParseInt(m.CreationTimestamp, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.UnixMilli(millis)
+}
+
+// columns returns the index of every column of CSV data files, by name.
+func (m inventoryManifest) columns() (map[string]int, error) {
+	columns := map[string]int{}
+	for i, name := range strings.Split(m.FileSchema, ",") {
+		columns[strings.TrimSpace(name)] = i
+	}
+
+	return columns, checkInventoryColumns(columns)
+}
+
+// checkInventoryColumns returns an error if the data files lack a field that sync needs.
+func checkInventoryColumns(columns map[string]int) error {
+	for _, required := range []string{"Key", "Size", "ETag"} {
+		if _, ok := columns[required]; !ok {
+			return fmt.Errorf("the inventory has no %s field; sync needs the Size and ETag fields", required)
+		}
+	}
+
+	return nil
+}
+
+// parseInventoryURL splits the location of an inventory given as `s3://<bucket>/<key>` into its
+// bucket and key.
+func parseInventoryURL(location string) (string, string, error) {
+	rest, ok := strings.CutPrefix(location, "s3://")
+	if !ok {
+		return "", "", fmt.Errorf("invalid inventory %q: expected 's3://<bucket>/<key>'", location)
+	}
+
+	bucket, key, _ := strings.Cut(rest, "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("invalid inventory %q: missing bucket", location)
+	}
+
+	return bucket, key, nil
+}
+
+// latestInventoryManifest returns the key of the most recent manifest beneath a prefix, such as
+// the prefix of an inventory configuration. Reports are written under a directory named after
+// their date, so the latest manifest has the largest key.
+func latestInventoryManifest(ctx context.Context, client inventoryClient, bucket, prefix string) (string, error) {
+	var latest string
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return "", fmt.Errorf("could not list inventory reports: %v", err)
+		}
+
+		for _, object := range page.Contents {
+			key := aws.ToString(object.Key)
+			if strings.HasSuffix(key, "/"+inventoryManifestName) && key > latest {
+				latest = key
+			}
+		}
+	}
+
+	if latest == "" {
+		return "", fmt.Errorf("no inventory report under s3://%s/%s", bucket, prefix)
+	}
+
+	return latest, nil
+}
+
+// readInventory reads the objects beneath the prefix of a bucket from an S3 Inventory report in
+// CSV or Parquet format, keyed by their path relative to the prefix like a listing. The location is either
+// the manifest of the report, or a prefix under which the latest report is used.
+func readInventory(ctx context.Context, client inventoryClient, location, bucket, prefix string) (map[string]remoteObject, inventoryManifest, error) {
+	var manifest inventoryManifest
+
+	inventoryBucket, key, err := parseInventoryURL(location)
+	if err != nil {
+		return nil, manifest, err
+	}
+
+	if !strings.HasSuffix(key, inventoryManifestName) {
+		key, err = latestInventoryManifest(ctx, client, inventoryBucket, key)
+		if err != nil {
+			return nil, manifest, err
+		}
+	}
+
+	body, err := getObjectBody(ctx, client, inventoryBucket, key)
+	if err != nil {
+		return nil, manifest, fmt.Errorf("could not read inventory manifest: %v", err)
+	}
+
+	err = json.NewDecoder(body).Decode(&manifest)
+	body.Close()
+	if err != nil {
+		return nil, manifest, fmt.Errorf("invalid inventory manifest %s: %v", key, err)
+	}
+
+	if manifest.FileFormat != "CSV" && manifest.FileFormat != "Parquet" {
+		return nil, manifest, fmt.Errorf("unsupported inventory format %s; configure CSV or Parquet", manifest.FileFormat)
+	}
+
+	if manifest.SourceBucket != bucket {
+		return nil, manifest, fmt.Errorf("the inventory is of bucket %s, not %s", manifest.SourceBucket, bucket)
+	}
+
+	readFile := readParquetInventoryFile
+	if manifest.FileFormat == "CSV" {
+		columns, err := manifest.columns()
+		if err != nil {
+			return nil, manifest, err
+		}
+
+		readFile = func(ctx context.Context, client inventoryClient, bucket, key, prefix string, objects map[string]remoteObject) error {
+			return readInventoryFile(ctx, client, bucket, key, columns, prefix, objects)
+		}
+	}
+
+	objects := map[string]remoteObject{}
+	for _, file := range manifest.Files {
+		if err := readFile(ctx, client, inventoryBucket, file.Key, prefix, objects); err != nil {
+			return nil, manifest, err
+		}
+	}
+
+	return objects, manifest, nil
+}
+
+// getObjectBody returns the body of an object.
+func getObjectBody(ctx context.Context, client inventoryClient, bucket, key string) (io.ReadCloser, error) {
+	output, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, err
+	}
+
+	return output.Body, nil
+}
+
+// readInventoryFile adds the current objects beneath the prefix listed in a gzipped CSV data
+// file of an inventory report to `objects`.
+func readInventoryFile(ctx context.Context, client inventoryClient, bucket, key string, columns map[string]int, prefix string, objects map[string]remoteObject) error {
+	body, err := getObjectBody(ctx, client, bucket, key)
+	if err != nil {
+		return fmt.Errorf("could not read inventory file %s: %v", key, err)
+	}
+	defer body.Close()
+
+	unzipped, err := gzip.NewReader(body)
+	if err != nil {
+		return fmt.Errorf("could not read inventory file %s: %v", key, err)
+	}
+
+	reader := csv.NewReader(unzipped)
+	reader.FieldsPerRecord = -1
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("invalid inventory file %s: %v", key, err)
+		}
+
+		object, ok, err := inventoryObject(record, columns, prefix)
+		if err != nil {
+			return fmt.Errorf("invalid inventory file %s: %v", key, err)
+		}
+
+		if ok {
+			objects[object.Key] = object
+		}
+	}
+}
+
+// inventoryObject parses a record of an inventory data file. Objects outside the prefix, delete
+// markers, and noncurrent versions are skipped.
+func inventoryObject(record []string, columns map[string]int, prefix string) (remoteObject, bool, error) {
+	field := func(name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+
+		return record[i]
+	}
+
+	if field("IsLatest") == "false" || field("IsDeleteMarker") == "true" {
+		return remoteObject{}, false, nil
+	}
+
+	// Keys are URL-encoded in inventories.
+	key, err := url.QueryUnescape(field("Key"))
+	if err != nil {
+		return remoteObject{}, false, fmt.Errorf("invalid key %q: %v", field("Key"), err)
+	}
+
+	path, ok := strings.CutPrefix(key, prefix)
+	if !ok || path == "" {
+		return remoteObject{}, false, nil
+	}
+
+	size, err := strconv.ParseInt(field("Size"), 10, 64)
+	if err != nil {
+		return remoteObject{}, false, fmt.Errorf("invalid size of %s: %v", key, err)
+	}
+
+	modified, _ := time.Parse(time.RFC3339, field("LastModifiedDate"))
+
+	return remoteObject{
+		Key:          path,
+		Size:         size,
+		ETag:         field("ETag"),
+		LastModified: modified,
+		StorageClass: field("StorageClass"),
+	}, true, nil
+}
+
+// parquetInventoryColumns are the columns of Parquet data files of an inventory report, by the
+// names of the fields in CSV data files.
+var parquetInventoryColumns = map[string]string{
+	"Key":              "key",
+	"Size":             "size",
+	"ETag":             "e_tag",
+	"LastModifiedDate": "last_modified_date",
+	"StorageClass":     "storage_class",
+	"IsLatest":         "is_latest",
+	"IsDeleteMarker":   "is_delete_marker",
+}
+
+// readParquetInventoryFile adds the current objects beneath the prefix listed in a Parquet data
+// file of an inventory report to `objects`. The file is read into memory, as the metadata needed
+// to read it is at its end.
+func readParquetInventoryFile(ctx context.Context, client inventoryClient, bucket, key, prefix string, objects map[string]remoteObject) error {
+	body, err := getObjectBody(ctx, client, bucket, key)
+	if err != nil {
+		return fmt.Errorf("could not read inventory file %s: %v", key, err)
+	}
+
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return fmt.Errorf("could not read inventory file %s: %v", key, err)
+	}
+
+	file, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("invalid inventory file %s: %v", key, err)
+	}
+
+	columns := map[string]int{}
+	for field, name := range parquetInventoryColumns {
+		if column, ok := file.Schema().Lookup(name); ok {
+			columns[field] = column.ColumnIndex
+		}
+	}
+
+	if err := checkInventoryColumns(columns); err != nil {
+		return err
+	}
+
+	reader := parquet.NewReader(file)
+	defer reader.Close()
+
+	rows := make([]parquet.Row, 128)
+	for {
+		n, readErr := reader.ReadRows(rows)
+		for _, row := range rows[:n] {
+			object, ok, err := parquetInventoryObject(row, columns, prefix)
+			if err != nil {
+				return fmt.Errorf("invalid inventory file %s: %v", key, err)
+			}
+
+			if ok {
+				objects[object.Key] = object
+			}
+		}
+
+		if errors.Is(readErr, io.EOF) {
+			return nil
+		}
+
+		if readErr != nil {
+			return fmt.Errorf("invalid inventory file %s: %v", key, readErr)
+		}
+	}
+}
+
+// parquetInventoryObject parses a row of a Parquet data file the way [inventoryObject] parses a
+// CSV record. Unlike in CSV data files, keys aren't URL-encoded.
+func parquetInventoryObject(row parquet.Row, columns map[string]int, prefix string) (remoteObject, bool, error) {
+	field := func(name string) parquet.Value {
+		i, ok := columns[name]
+		if !ok {
+			return parquet.Value{}
+		}
+
+		for _, value := range row {
+			if value.Column() == i {
+				return value
+			}
+		}
+
+		return parquet.Value{}
+	}
+
+	if latest := field("IsLatest"); !latest.IsNull() && !latest.Boolean() {
+		return remoteObject{}, false, nil
+	}
+
+	if marker := field("IsDeleteMarker"); !marker.IsNull() && marker.Boolean() {
+		return remoteObject{}, false, nil
+	}
+
+	key := string(field("Key").ByteArray())
+	path, ok := strings.CutPrefix(key, prefix)
+	if !ok || path == "" {
+		return remoteObject{}, false, nil
+	}
+
+	size := field("Size")
+	if size.IsNull() {
+		return remoteObject{}, false, fmt.Errorf("missing size of %s", key)
+	}
+
+	var modified time.Time
+	if millis := field("LastModifiedDate"); !millis.IsNull() {
+		modified = time.UnixMilli(millis.Int64()).UTC()
+	}
+
+	return remoteObject{
+		Key:          path,
+		Size:         size.Int64(),
+		ETag:         string(field("ETag").ByteArray()),
+		LastModified: modified,
+		StorageClass: string(field("StorageClass").ByteArray()),
+	}, true, nil
+}
+
+// readRemoteInventory reads the objects beneath the prefix of the bucket given with the common
+// flags from an S3 Inventory report, which only exist for S3 buckets. Inventories are written at
+// most daily, so objects changed since are compared as of the report.
+func readRemoteInventory(ctx context.Context, common *commonFlags, location, bucket, prefix string) (map[string]remoteObject, error) {
+	if scheme, _, _ := parseBucketURL(common.bucket, ""); scheme != "s3" {
+		return nil, fmt.Errorf("inventories are only available for S3 buckets, not %s:// buckets", scheme)
+	}
+
+	client, err := common.newClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	objects, manifest, err := readInventory(ctx, client, location, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	if created := manifest.Created(); !created.IsZero() {
+		log.Printf("Read %d object(s) from the inventory of %s\n", len(objects), created.UTC().Format(time.RFC3339))
+	}
+
+	return objects, nil
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/parquet-go/parquet-go"
+)
+
+// mockInventoryClient serves the objects of an inventory bucket from memory.
+type mockInventoryClient map[string][]byte
+
+func (m mockInventoryClient) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	output := &s3.ListObjectsV2Output{}
+	for key := range m {
+		output.Contents = append(output.Contents, types.Object{Key: aws.String(key)})
+	}
+
+	return output, nil
+}
+
+func (m mockInventoryClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	body, ok := m[aws.ToString(params.Key)]
+	if !ok {
+		return nil, errors.New("NoSuchKey")
+	}
+
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(body))}, nil
+}
+
+// gzipped compresses a data file of an inventory report.
+func gzipped(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	writer.Close()
+
+	return buf.Bytes()
+}
+
+func Test_readInventory(t *testing.T) {
+	manifest := `{
+		"sourceBucket": "my-site",
+		"fileFormat": "CSV",
+		"fileSchema": "Bucket, Key, Size, LastModifiedDate, ETag, StorageClass, IsLatest, IsDeleteMarker",
+		"creationTimestamp": "1714564800000",
+		"files": [{"key": "inventory/my-site/daily/data/1.csv.gz"}]
+	}`
+	data := `"my-site","site/index.html","9","2024-05-01T10:00:00.000Z","328c30fae61cd119cd177c061d1ac11f","STANDARD","true","false"
+"my-site","site/about+us.html","3","2024-05-01T10:00:00.000Z","abc","STANDARD","true","false"
+"my-site","site/old.html","3","2024-04-01T10:00:00.000Z","def","STANDARD","false","false"
+"my-site","site/gone.html","","2024-04-01T10:00:00.000Z","","","true","true"
+"my-site","other/index.html","5","2024-05-01T10:00:00.000Z","ghi","STANDARD","true","false"
+`
+
+	testCases := []struct {
+		desc     string
+		location string
+		objects  mockInventoryClient
+		wantErr  bool
+	}{
+		{
+			desc:     "manifest",
+			location: "s3://inventories/inventory/my-site/daily/2024-05-01T00-00Z/manifest.json",
+			objects: mockInventoryClient{
+				"inventory/my-site/daily/2024-05-01T00-00Z/manifest.json": []byte(manifest),
+				"inventory/my-site/daily/data/1.csv.gz":                   gzipped(t, data),
+			},
+		},
+		{
+			desc:     "latest report",
+			location: "s3://inventories/inventory/my-site/daily/",
+			objects: mockInventoryClient{
+				"inventory/my-site/daily/2024-04-30T00-00Z/manifest.json": []byte(`{"sourceBucket": "my-site", "fileFormat": "Parquet"}`),
+				"inventory/my-site/daily/2024-05-01T00-00Z/manifest.json": []byte(manifest),
+				"inventory/my-site/daily/data/1.csv.gz":                   gzipped(t, data),
+			},
+		},
+		{
+			desc:     "other bucket",
+			location: "s3://inventories/manifest.json",
+			objects:  mockInventoryClient{"manifest.json": []byte(`{"sourceBucket": "other", "fileFormat": "CSV"}`)},
+			wantErr:  true,
+		},
+		{
+			desc:     "no ETags",
+			location: "s3://inventories/manifest.json",
+			objects:  mockInventoryClient{"manifest.json": []byte(`{"sourceBucket": "my-site", "fileFormat": "CSV", "fileSchema": "Bucket, Key, Size"}`)},
+			wantErr:  true,
+		},
+		{desc: "not an S3 URL", location: "inventories/manifest.json", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			objects, _, err := readInventory(context.Background(), tC.objects, tC.location, "my-site", "site/")
+			if tC.wantErr {
+				if err == nil {
+					t.Fatal("Expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var keys []string
+			for _, key := range []string{"index.html", "about us.html", "old.html", "gone.html"} {
+				if _, ok := objects[key]; ok {
+					keys = append(keys, key)
+				}
+			}
+
+			if want := []string{"index.html", "about us.html"}; !reflect.DeepEqual(keys, want) || len(objects) != 2 {
+				t.Errorf("Expected objects %v; got %v", want, objects)
+			}
+
+			if got := objects["index.html"]; got.Size != 9 || got.ETag != "328c30fae61cd119cd177c061d1ac11f" {
+				t.Errorf("Expected the size and ETag of index.html; got %+v", got)
+			}
+		})
+	}
+}
+
+func Test_readInventory_unsupportedFormat(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		format  string
+		wantErr string
+	}{
+		{desc: "ORC", format: "ORC", wantErr: "unsupported inventory format ORC; configure CSV or Parquet"},
+		{desc: "unknown", format: "JSON", wantErr: "unsupported inventory format JSON; configure CSV or Parquet"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := mockInventoryClient{"manifest.json": []byte(`{"sourceBucket": "my-site", "fileFormat": "` + tC.format + `"}`)}
+
+			_, _, err := readInventory(context.Background(), client, "s3://inventories/manifest.json", "my-site", "site/")
+			if err == nil || err.Error() != tC.wantErr {
+				t.Errorf("Expected error %q; got %v", tC.wantErr, err)
+			}
+		})
+	}
+}
+
+// parquetInventoryRow is a row of a Parquet data file of an inventory report.
+type parquetInventoryRow struct {
+	Bucket           string  `parquet:"bucket"`
+	Key              string  `parquet:"key"`
+	IsLatest         *bool   `parquet:"is_latest,optional"`
+	IsDeleteMarker   *bool   `parquet:"is_delete_marker,optional"`
+	Size             *int64  `parquet:"size,optional"`
+	LastModifiedDate *int64  `parquet:"last_modified_date,optional"`
+	ETag             *string `parquet:"e_tag,optional"`
+	StorageClass     *string `parquet:"storage_class,optional"`
+}
+
+// parquetInventory writes a Parquet data file of an inventory report.
+func parquetInventory(t *testing.T, rows []parquetInventoryRow) []byte {
+	var buf bytes.Buffer
+	if err := parquet.Write(&buf, rows); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func Test_readInventory_parquet(t *testing.T) {
+	manifest := `{
+		"sourceBucket": "my-site",
+		"fileFormat": "Parquet",
+		"fileSchema": "message s3.inventory { required binary bucket (STRING); required binary key (STRING); optional boolean is_latest; optional boolean is_delete_marker; optional int64 size; optional int64 last_modified_date (TIMESTAMP(MILLIS,true)); optional binary e_tag (STRING); optional binary storage_class (STRING);}",
+		"files": [{"key": "data/1.parquet"}]
+	}`
+	modified := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	row := func(key string, size int64, latest, deleted bool) parquetInventoryRow {
+		return parquetInventoryRow{
+			Bucket:           "my-site",
+			Key:              key,
+			IsLatest:         &latest,
+			IsDeleteMarker:   &deleted,
+			Size:             &size,
+			LastModifiedDate: aws.Int64(modified.UnixMilli()),
+			ETag:             aws.String("328c30fae61cd119cd177c061d1ac11f"),
+			StorageClass:     aws.String("STANDARD"),
+		}
+	}
+
+	testCases := []struct {
+		desc    string
+		rows    []parquetInventoryRow
+		want    map[string]remoteObject
+		wantErr bool
+	}{
+		{
+			desc: "current objects",
+			rows: []parquetInventoryRow{
+				row("site/index.html", 9, true, false),
+				row("site/about+us.html", 3, true, false),
+				row("site/old.html", 3, false, false),
+				row("site/gone.html", 0, true, true),
+				row("other/index.html", 5, true, false),
+			},
+			want: map[string]remoteObject{
+				"index.html":    {Key: "index.html", Size: 9, ETag: "328c30fae61cd119cd177c061d1ac11f", LastModified: modified, StorageClass: "STANDARD"},
+				"about+us.html": {Key: "about+us.html", Size: 3, ETag: "328c30fae61cd119cd177c061d1ac11f", LastModified: modified, StorageClass: "STANDARD"},
+			},
+		},
+		{
+			desc: "unversioned bucket",
+			rows: []parquetInventoryRow{{Bucket: "my-site", Key: "site/index.html", Size: aws.Int64(9), ETag: aws.String("abc")}},
+			want: map[string]remoteObject{"index.html": {Key: "index.html", Size: 9, ETag: "abc"}},
+		},
+		{
+			desc:    "missing size",
+			rows:    []parquetInventoryRow{{Bucket: "my-site", Key: "site/index.html", ETag: aws.String("abc")}},
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := mockInventoryClient{"manifest.json": []byte(manifest), "data/1.parquet": parquetInventory(t, tC.rows)}
+
+			objects, _, err := readInventory(context.Background(), client, "s3://inventories/manifest.json", "my-site", "site/")
+			if tC.wantErr {
+				if err == nil {
+					t.Fatal("Expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(objects, tC.want) {
+				t.Errorf("Expected objects %+v; got %+v", tC.want, objects)
+			}
+		})
+	}
+}
+
+func Test_readInventory_parquetWithoutETags(t *testing.T) {
+	type row struct {
+		Key  string `parquet:"key"`
+		Size int64  `parquet:"size"`
+	}
+
+	var buf bytes.Buffer
+	if err := parquet.Write(&buf, []row{{Key: "site/index.html", Size: 9}}); err != nil {
+		t.Fatal(err)
+	}
+
+	client := mockInventoryClient{
+		"manifest.json":  []byte(`{"sourceBucket": "my-site", "fileFormat": "Parquet", "files": [{"key": "data/1.parquet"}]}`),
+		"data/1.parquet": buf.Bytes(),
+	}
+
+	_, _, err := readInventory(context.Background(), client, "s3://inventories/manifest.json", "my-site", "site/")
+	if want := "the inventory has no ETag field; sync needs the Size and ETag fields"; err == nil || err.Error() != want {
+		t.Errorf("Expected error %q; got %v", want, err)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// unsafeKeyCharacters are the characters that S3 recommends avoiding in keys, as they need to be
+// escaped in URLs, or are mangled by other tools. They are replaced by `_` when normalizing keys.
+const unsafeKeyCharacters = "{}^%`[]\"<>#|"
+
+// normalizeKey returns the normalized key of a file: slash-separated even if its name contains
+// backslashes, as names of files extracted from archives built on Windows do, without a leading
+// `./`, in Unicode NFC form, so that names written on macOS get the same key as elsewhere, and with
+// the characters that are unsafe in keys replaced. Names with control characters or that aren't
+// valid UTF-8 can't be normalized.
+func normalizeKey(name string) (string, error) {
+	if !utf8.ValidString(name) {
+		return "", fmt.Errorf("invalid key %q: not valid UTF-8", name)
+	}
+
+	key := strings.ReplaceAll(name, `\`, "/")
+	for strings.HasPrefix(key, "./") {
+		key = strings.TrimLeft(key[2:], "/")
+	}
+
+	var b strings.Builder
+	for _, r := range norm.NFC.String(key) {
+		switch {
+		case unicode.IsControl(r):
+			return "", fmt.Errorf("invalid key %q: contains the control character %U", name, r)
+		case strings.ContainsRune(unsafeKeyCharacters, r):
+			b.WriteRune('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String(), nil
+}
+
+// renameRule renames the keys matching a regular expression, like `-rename-rule`.
+type renameRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// parseRenameRules parses rename rules given as `<regexp>=<replacement>`, where the replacement
+// may refer to the groups of the expression as `$1` or `${name}`.
+func parseRenameRules(values []string) ([]renameRule, error) {
+	var rules []renameRule
+	for _, value := range values {
+		expr, replacement, ok := strings.Cut(value, "=")
+		if !ok || expr == "" {
+			return nil, fmt.Errorf("invalid rename rule %q: expected '<regexp>=<replacement>'", value)
+		}
+
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rename rule %q: %v", value, err)
+		}
+
+		rules = append(rules, renameRule{pattern: pattern, replacement: replacement})
+	}
+
+	return rules, nil
+}
+
+// keyTransforms turn the paths of files into keys that differ from the local layout. They are
+// applied in the order of the fields.
+type keyTransforms struct {
+	// sources map the files of the directories given with -source to their prefixes.
+	sources sourceRoots
+	// keyTemplate is the key of the files given as arguments, expanded by `template`, e.g.
+	// `releases/{name}`.
+	keyTemplate string
+	template    prefixTemplate
+	// normalize normalizes keys with normalizeKey, logging every key that changes.
+	normalize bool
+	// stripPrefix is removed from the keys of the files beneath it, e.g. `dist/`.
+	stripPrefix string
+	// lowercase converts keys to lower case.
+	lowercase bool
+	// rules rename keys matching their expression, in order.
+	rules []renameRule
+}
+
+// empty reports whether the transforms leave every key as it is.
+func (t keyTransforms) empty() bool {
+	return len(t.sources) == 0 && t.keyTemplate == "" && !t.normalize && t.stripPrefix == "" && !t.lowercase && len(t.rules) == 0
+}
+
+// Key returns the key of the file at the given path.
+func (t keyTransforms) Key(name string) (string, error) {
+	key := t.sources.Key(name)
+	if t.keyTemplate != "" {
+		expanded, err := t.template.ExpandKey(t.keyTemplate, key)
+		if err != nil {
+			return "", err
+		}
+
+		key = expanded
+	}
+
+	if t.normalize {
+		normalized, err := normalizeKey(key)
+		if err != nil {
+			return "", err
+		}
+
+		if normalized != key {
+			log.Printf("Renaming %s to %s\n", name, normalized)
+		}
+
+		key = normalized
+	}
+
+	if t.stripPrefix != "" {
+		key = strings.TrimPrefix(key, t.stripPrefix)
+	}
+
+	if t.lowercase {
+		key = strings.ToLower(key)
+	}
+
+	for _, rule := range t.rules {
+		key = rule.pattern.ReplaceAllString(key, rule.replacement)
+	}
+
+	if key == "" {
+		return "", fmt.Errorf("invalid key for %s: the key transforms leave it empty", name)
+	}
+
+	return key, nil
+}
+
+// newKeyRenames adds the files whose keys are changed by the transforms to the hash renames,
+// which may be nil. Files renamed for their hash have their hashed name transformed. It fails if
+// two files would be uploaded under the same key.
+func newKeyRenames(walkFiles treeWalker, filter pathFilter, hashed hashRenames, transforms keyTransforms) (hashRenames, error) {
+	renames := hashRenames{}
+	for name, key := range hashed {
+		renames[name] = key
+	}
+
+	names := map[string]string{}
+	err := walkFiles(createFilterFunc(filter, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("could not walk %s: %v", name, err)
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		key, err := transforms.Key(renames.Key(name))
+		if err != nil {
+			return err
+		}
+
+		if other, ok := names[key]; ok {
+			return fmt.Errorf("%s and %s would both be uploaded as %s", other, name, key)
+		}
+
+		names[key] = name
+		if key != renames.Key(name) {
+			renames[name] = key
+		}
+
+		return nil
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	return renames, nil
+}
+
+// prefixVariable matches the variables of a prefix or key template, such as `{version}`.
+var prefixVariable = regexp.MustCompile(`\{[a-z_]+\}`)
+
+// prefixTemplate expands the variables in key prefixes: `{version}` is the version given to
+// -app-version, `{git_sha}` the commit checked out in the working directory, and `{date}` the
+// current date in UTC, e.g. `2024-05-01`.
+type prefixTemplate struct {
+	version string
+	now     time.Time
+	// gitSHA returns the commit checked out in the working directory. It's only called if a
+	// prefix uses it.
+	gitSHA func() (string, error)
+}
+
+// Expand returns the prefix with its variables replaced by their values.
+func (t prefixTemplate) Expand(prefix string) (string, error) {
+	expanded, err := expandVariables(prefix, t.value)
+	if err != nil {
+		return "", fmt.Errorf("invalid prefix %q: %v", prefix, err)
+	}
+
+	return expanded, nil
+}
+
+// ExpandKey returns the key given by a -key template for the file at the given path. Besides the
+// variables of prefixes, the template may use `{name}` for the name of the file and `{path}` for
+// its path. A template ending in `/` puts files under their name beneath it.
+func (t prefixTemplate) ExpandKey(template, name string) (string, error) {
+	return t.expandKey(template, map[string]string{"name": name[strings.LastIndex(name, "/")+1:], "path": name})
+}
+
+// expandKey returns the key given by a key template, which may use the given variables besides
+// those of prefixes. A template ending in `/` puts the object under `{name}` beneath it.
+func (t prefixTemplate) expandKey(template string, variables map[string]string) (string, error) {
+	if strings.HasSuffix(template, "/") {
+		template += "{name}"
+	}
+
+	expanded, err := expandVariables(template, func(variable string) (string, error) {
+		if value, ok := variables[variable]; ok {
+			return value, nil
+		}
+
+		return t.value(variable)
+	})
+	if err != nil {
+		return "", fmt.Errorf("invalid key %q: %v", template, err)
+	}
+
+	return expanded, nil
+}
+
+// expandVariables replaces the variables in a template by the values returned for their names,
+// failing with the first error returned.
+func expandVariables(template string, value func(name string) (string, error)) (string, error) {
+	var expandErr error
+	expanded := prefixVariable.ReplaceAllStringFunc(template, func(variable string) string {
+		v, err := value(strings.Trim(variable, "{}"))
+		if err != nil && expandErr == nil {
+			expandErr = err
+		}
+
+		return v
+	})
+	if expandErr != nil {
+		return "", expandErr
+	}
+
+	return expanded, nil
+}
+
+// value returns the value of the variable with the given name.
+func (t prefixTemplate) value(name string) (string, error) {
+	switch name {
+	case "version":
+		if t.version == "" {
+			return "", errors.New("{version} requires -app-version")
+		}
+
+		return t.version, nil
+	case "git_sha":
+		sha, err := t.gitSHA()
+		if err != nil {
+			return "", fmt.Errorf("could not determine {git_sha}: %v", err)
+		}
+
+		return sha, nil
+	case "date":
+		return t.now.UTC().Format(time.DateOnly), nil
+	}
+
+	return "", fmt.Errorf("unknown variable {%s}: expected {version}, {git_sha}, or {date}", name)
+}
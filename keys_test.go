@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_normalizeKey(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{desc: "unchanged", name: "assets/app.js", want: "assets/app.js"},
+		{desc: "backslashes", name: `assets\img\logo.png`, want: "assets/img/logo.png"},
+		{desc: "leading dot", name: "./index.html", want: "index.html"},
+		{desc: "decomposed", name: "cafe\u0301.html", want: "caf\u00e9.html"},
+		{desc: "unsafe characters", name: "docs/a#b [1].html", want: "docs/a_b _1_.html"},
+		{desc: "control character", name: "bad\tname.txt", wantErr: true},
+		{desc: "invalid UTF-8", name: "bad\xffname.txt", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := normalizeKey(tC.name)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if got != tC.want {
+				t.Errorf("Expected key %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_newKeyRenames(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		names   []string
+		hashed  hashRenames
+		want    hashRenames
+		wantErr bool
+	}{
+		{
+			desc:  "normalized keys",
+			names: []string{"index.html", `img\logo.png`},
+			want:  hashRenames{`img\logo.png`: "img/logo.png"},
+		},
+		{
+			desc:   "hashed names",
+			names:  []string{"app#1.js", "index.html"},
+			hashed: hashRenames{"app#1.js": "app#1.3fa9c1d2.js", "index.html": "index.0a1b2c3d.html"},
+			want:   hashRenames{"app#1.js": "app_1.3fa9c1d2.js", "index.html": "index.0a1b2c3d.html"},
+		},
+		{
+			desc:    "conflicting keys",
+			names:   []string{"a#b.txt", "a_b.txt"},
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			walkFiles := func(walk fs.WalkDirFunc) error {
+				for _, name := range tC.names {
+					if err := walk(name, mockFileInfo{name: name}, nil); err != nil {
+						return err
+					}
+				}
+
+				return nil
+			}
+
+			got, err := newKeyRenames(walkFiles, pathFilter{}, tC.hashed, keyTransforms{normalize: true})
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if !tC.wantErr && !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("Expected renames %v; got %v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_parseRenameRules(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		values  []string
+		wantErr bool
+	}{
+		{desc: "valid", values: []string{"^assets/(.*)$=static/$1", `\.htm$=.html`}},
+		{desc: "empty replacement", values: []string{"^drafts/="}},
+		{desc: "missing replacement", values: []string{"^assets/"}, wantErr: true},
+		{desc: "invalid expression", values: []string{"(assets=static"}, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			rules, err := parseRenameRules(tC.values)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if !tC.wantErr && len(rules) != len(tC.values) {
+				t.Errorf("Expected %d rule(s); got %d", len(tC.values), len(rules))
+			}
+		})
+	}
+}
+
+func Test_keyTransforms_Key(t *testing.T) {
+	rules, err := parseRenameRules([]string{"^assets/(.*)$=static/$1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	testCases := []struct {
+		desc       string
+		transforms keyTransforms
+		name       string
+		want       string
+		wantErr    bool
+	}{
+		{desc: "none", name: "dist/Index.html", want: "dist/Index.html"},
+		{desc: "source", transforms: keyTransforms{sources: sourceRoots{{dir: "docs/build", prefix: "docs/"}}}, name: "docs/build/index.html", want: "docs/index.html"},
+		{desc: "strip prefix", transforms: keyTransforms{stripPrefix: "dist/"}, name: "dist/index.html", want: "index.html"},
+		{desc: "outside prefix", transforms: keyTransforms{stripPrefix: "dist/"}, name: "robots.txt", want: "robots.txt"},
+		{desc: "lower case", transforms: keyTransforms{lowercase: true}, name: "Docs/README.md", want: "docs/readme.md"},
+		{desc: "rename rule", transforms: keyTransforms{rules: rules}, name: "assets/app.js", want: "static/app.js"},
+		{
+			desc:       "combined",
+			transforms: keyTransforms{normalize: true, stripPrefix: "dist/", lowercase: true, rules: rules},
+			name:       `dist\Assets\Logo.PNG`,
+			want:       "static/logo.png",
+		},
+		{desc: "empty key", transforms: keyTransforms{stripPrefix: "dist/"}, name: "dist/", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := tC.transforms.Key(tC.name)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if got != tC.want {
+				t.Errorf("Expected key %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_prefixTemplate_Expand(t *testing.T) {
+	template := prefixTemplate{
+		version: "1.4.2",
+		now:     time.Date(2024, 5, 1, 23, 30, 0, 0, time.FixedZone("UTC-2", -2*60*60)),
+		gitSHA:  func() (string, error) { return "3fa9c1d2", nil },
+	}
+
+	testCases := []struct {
+		desc     string
+		template prefixTemplate
+		prefix   string
+		want     string
+		wantErr  bool
+	}{
+		{desc: "no variables", template: template, prefix: "site/", want: "site/"},
+		{desc: "variables", template: template, prefix: "builds/{version}/{git_sha}/", want: "builds/1.4.2/3fa9c1d2/"},
+		{desc: "date in UTC", template: template, prefix: "nightly/{date}", want: "nightly/2024-05-02"},
+		{desc: "unknown variable", template: template, prefix: "{branch}/", wantErr: true},
+		{desc: "missing version", template: prefixTemplate{}, prefix: "{version}/", wantErr: true},
+		{
+			desc:     "not a git repository",
+			template: prefixTemplate{gitSHA: func() (string, error) { return "", errors.New("not a git repository") }},
+			prefix:   "{git_sha}/",
+			wantErr:  true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := tC.template.Expand(tC.prefix)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if got != tC.want {
+				t.Errorf("Expected prefix %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_prefixTemplate_ExpandKey(t *testing.T) {
+	template := prefixTemplate{version: "1.4.2", now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+
+	testCases := []struct {
+		desc     string
+		template string
+		name     string
+		want     string
+		wantErr  bool
+	}{
+		{desc: "name", template: "releases/{version}/{name}", name: "build/app.tar.gz", want: "releases/1.4.2/app.tar.gz"},
+		{desc: "path", template: "nightly/{date}/{path}", name: "build/app.tar.gz", want: "nightly/2024-05-01/build/app.tar.gz"},
+		{desc: "directory", template: "releases/", name: "build/app.tar.gz", want: "releases/app.tar.gz"},
+		{desc: "fixed key", template: "latest.tar.gz", name: "build/app.tar.gz", want: "latest.tar.gz"},
+		{desc: "file in working directory", template: "{name}", name: "app.tar.gz", want: "app.tar.gz"},
+		{desc: "unknown variable", template: "{branch}/{name}", name: "app.tar.gz", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := template.ExpandKey(tC.template, tC.name)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if got != tC.want {
+				t.Errorf("Expected key %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
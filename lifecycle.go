@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// tagHeaderPrefix is followed by the key of the object tag a header rule sets. Unlike the names
+// of other headers, tag keys aren't canonicalized, since they are case-sensitive.
+const tagHeaderPrefix = "X-Amz-Tag-"
+
+// defaultExpiryTag is the tag whose values are the number of days after which the `lifecycle`
+// command has objects expire, e.g. `ttl=7d`.
+const defaultExpiryTag = "ttl"
+
+// lifecycleRulePrefix starts the IDs of the lifecycle rules installed by the `lifecycle` command,
+// so that they can be told apart from those configured otherwise.
+const lifecycleRulePrefix = "s3-copy:"
+
+// parseTagRule parses a rule of the form `<pattern>=<key>=<value>`, which tags the files matching
+// the pattern.
+func parseTagRule(rule string) (headerRule, error) {
+	parsed, err := parseHeaderRule("tag", rule)
+	if err != nil {
+		return headerRule{}, err
+	}
+
+	key, value, ok := strings.Cut(parsed.value, "=")
+	if !ok || key == "" {
+		return headerRule{}, fmt.Errorf("invalid tag rule %q: expected <pattern>=<key>=<value>", rule)
+	}
+
+	if _, err := encodeTags(map[string]string{key: value}); err != nil {
+		return headerRule{}, fmt.Errorf("invalid tag rule %q: %v", rule, err)
+	}
+
+	parsed.header = tagHeaderPrefix + key
+	parsed.value = value
+
+	return parsed, nil
+}
+
+// expiry is a lifecycle expiration of the objects with a tag.
+type expiry struct {
+	tag  types.Tag
+	days int32
+}
+
+// expiries returns the expirations of the objects that the rules give the expiry tag, whose
+// values must be a number of days, e.g. `7d`. They are ordered by the number of days.
+func expiries(rules []headerRule, key string) ([]expiry, error) {
+	var result []expiry
+	for _, rule := range rules {
+		if rule.header != tagHeaderPrefix+key || slices.ContainsFunc(result, func(e expiry) bool {
+			return aws.ToString(e.tag.Value) == rule.value
+		}) {
+			continue
+		}
+
+		days, err := strconv.ParseInt(strings.TrimSuffix(rule.value, "d"), 10, 32)
+		if !strings.HasSuffix(rule.value, "d") || err != nil || days <= 0 {
+			return nil, fmt.Errorf("invalid expiry %s=%s: expected a number of days, e.g. '7d'", key, rule.value)
+		}
+
+		result = append(result, expiry{
+			tag:  types.Tag{Key: aws.String(key), Value: aws.String(rule.value)},
+			days: int32(days),
+		})
+	}
+
+	slices.SortStableFunc(result, func(a, b expiry) int {
+		return int(a.days - b.days)
+	})
+
+	return result, nil
+}
+
+// lifecycleRules returns the bucket's lifecycle rules with those of the expirations for the
+// objects under the prefix. The rules previously installed for the prefix are replaced, and any
+// other rule is kept.
+func lifecycleRules(existing []types.LifecycleRule, prefix string, expirations []expiry) []types.LifecycleRule {
+	managed := lifecycleRulePrefix + prefix + ":"
+
+	var rules []types.LifecycleRule
+	for _, rule := range existing {
+		if !strings.HasPrefix(aws.ToString(rule.ID), managed) {
+			rules = append(rules, rule)
+		}
+	}
+
+	for _, e := range expirations {
+		filter := &types.LifecycleRuleFilter{Tag: &e.tag}
+		if prefix != "" {
+			filter = &types.LifecycleRuleFilter{And: &types.LifecycleRuleAndOperator{
+				Prefix: aws.String(prefix),
+				Tags:   []types.Tag{e.tag},
+			}}
+		}
+
+		rules = append(rules, types.LifecycleRule{
+			ID:         aws.String(managed + aws.ToString(e.tag.Key) + "=" + aws.ToString(e.tag.Value)),
+			Status:     types.ExpirationStatusEnabled,
+			Filter:     filter,
+			Expiration: &types.LifecycleExpiration{Days: aws.Int32(e.days)},
+		})
+	}
+
+	return rules
+}
+
+// lifecycleConfigurer reads and replaces the lifecycle configuration of a bucket.
+type lifecycleConfigurer interface {
+	GetBucketLifecycleConfiguration(ctx context.Context, params *s3.GetBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error)
+	PutBucketLifecycleConfiguration(ctx context.Context, params *s3.PutBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error)
+	DeleteBucketLifecycle(ctx context.Context, params *s3.DeleteBucketLifecycleInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketLifecycleOutput, error)
+}
+
+// installLifecycle adds the lifecycle rules of the expirations to the bucket. Since S3 replaces
+// the whole configuration, the existing one is read first.
+func installLifecycle(ctx context.Context, client lifecycleConfigurer, bucket, prefix string, expirations []expiry) error {
+	var existing []types.LifecycleRule
+	output, err := client.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(bucket)})
+
+	var apiErr smithy.APIError
+	switch {
+	case err == nil:
+		existing = output.Rules
+	case errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchLifecycleConfiguration":
+	default:
+		return fmt.Errorf("could not read the lifecycle configuration of bucket %s: %v", bucket, err)
+	}
+
+	rules := lifecycleRules(existing, prefix, expirations)
+
+	// S3 rejects configurations without rules, so removing the last one deletes the configuration.
+	if len(rules) == 0 {
+		if len(existing) == 0 {
+			return nil
+		}
+
+		if _, err := client.DeleteBucketLifecycle(ctx, &s3.DeleteBucketLifecycleInput{Bucket: aws.String(bucket)}); err != nil {
+			return fmt.Errorf("could not delete the lifecycle configuration of bucket %s: %v", bucket, err)
+		}
+
+		return nil
+	}
+
+	_, err = client.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(bucket),
+		LifecycleConfiguration: &types.BucketLifecycleConfiguration{Rules: rules},
+	})
+	if err != nil {
+		return fmt.Errorf("could not update the lifecycle configuration of bucket %s: %v", bucket, err)
+	}
+
+	return nil
+}
+
+// printExpiries writes the expirations of the objects under a prefix, one per line.
+func printExpiries(w io.Writer, bucket, prefix string, expirations []expiry) {
+	for _, e := range expirations {
+		fmt.Fprintf(w, "Expire %s/%s* tagged %s=%s after %d day(s)\n", bucket, prefix, aws.ToString(e.tag.Key), aws.ToString(e.tag.Value), e.days)
+	}
+}
+
+// runLifecycle implements the `lifecycle` command, which installs the lifecycle rules expiring the
+// objects tagged by tag rules, e.g. the files of preview deploys tagged `ttl=7d`.
+func runLifecycle(cmd command, args []string) {
+	var common commonFlags
+	var dryRunMode bool
+	var expiryTag string
+	var tagRules stringList
+
+	flags := newFlagSet(cmd, "[flags]")
+	common.register(flags)
+	flags.BoolVar(&dryRunMode, "dry-run", false, "Print the lifecycle rules that would be installed without changing the bucket")
+	flags.StringVar(&expiryTag, "expiry-tag", defaultExpiryTag, "Tag whose values are the number of days after which objects expire, e.g. '7d'")
+	flags.Var(&tagRules, "tag-rule", "Object tag of files matching a pattern, as '<pattern>=<key>=<value>', as given to 'upload' (repeatable)")
+	flags.Parse(args)
+
+	settings, err := common.applyConfig(flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var rules []headerRule
+	for _, rule := range tagRules {
+		parsed, err := parseTagRule(rule)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		rules = append(rules, parsed)
+	}
+
+	configRules, err := settings.headerRules()
+	if err != nil {
+		log.Fatal("Invalid config file: ", err)
+	}
+
+	rules = append(rules, configRules...)
+
+	expirations, err := expiries(rules, expiryTag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	prefix := normalizePrefix(common.prefix)
+	if dryRunMode {
+		printExpiries(os.Stdout, common.bucket, prefix, expirations)
+		return
+	}
+
+	ctx, stop := newSignalContext()
+	defer stop()
+
+	client, err := common.newClient(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := installLifecycle(ctx, client, common.bucket, prefix, expirations); err != nil {
+		log.Fatal(err)
+	}
+
+	printExpiries(os.Stdout, common.bucket, prefix, expirations)
+	log.Printf("Installed %d lifecycle rule(s) for %s/%s\n", len(expirations), common.bucket, prefix)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// mockLifecycleConfigurer holds a lifecycle configuration in memory.
+type mockLifecycleConfigurer struct {
+	rules   []types.LifecycleRule
+	getErr  error
+	deleted bool
+}
+
+func (m *mockLifecycleConfigurer) GetBucketLifecycleConfiguration(ctx context.Context, params *s3.GetBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+
+	return &s3.GetBucketLifecycleConfigurationOutput{Rules: m.rules}, nil
+}
+
+func (m *mockLifecycleConfigurer) PutBucketLifecycleConfiguration(ctx context.Context, params *s3.PutBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	m.rules = params.LifecycleConfiguration.Rules
+
+	return &s3.PutBucketLifecycleConfigurationOutput{}, nil
+}
+
+func (m *mockLifecycleConfigurer) DeleteBucketLifecycle(ctx context.Context, params *s3.DeleteBucketLifecycleInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketLifecycleOutput, error) {
+	m.rules, m.deleted = nil, true
+
+	return &s3.DeleteBucketLifecycleOutput{}, nil
+}
+
+func Test_parseTagRule(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		rule    string
+		want    headerRule
+		wantErr bool
+	}{
+		{desc: "tag", rule: "previews/**=ttl=7d", want: headerRule{pattern: "previews/**", header: "X-Amz-Tag-ttl", value: "7d"}},
+		{desc: "empty value", rule: "*.log=Archive=", want: headerRule{pattern: "*.log", header: "X-Amz-Tag-Archive", value: ""}},
+		{desc: "missing value", rule: "previews/**=ttl", wantErr: true},
+		{desc: "missing key", rule: "previews/**==7d", wantErr: true},
+		{desc: "invalid pattern", rule: "[a-=ttl=7d", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := parseTagRule(tC.rule)
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if got != tC.want {
+				t.Errorf("Expected rule %+v; got %+v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_expiries(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		rules    []headerRule
+		wantDays []int32
+		wantErr  bool
+	}{
+		{desc: "no rules"},
+		{
+			desc: "ordered by days",
+			rules: []headerRule{
+				{pattern: "archive/**", header: "X-Amz-Tag-ttl", value: "30d"},
+				{pattern: "previews/**", header: "X-Amz-Tag-ttl", value: "7d"},
+				{pattern: "drafts/**", header: "X-Amz-Tag-ttl", value: "7d"},
+				{pattern: "**", header: "X-Amz-Tag-team", value: "web"},
+				{pattern: "**", header: "Cache-Control", value: "no-cache"},
+			},
+			wantDays: []int32{7, 30},
+		},
+		{desc: "not days", rules: []headerRule{{pattern: "**", header: "X-Amz-Tag-ttl", value: "1w"}}, wantErr: true},
+		{desc: "zero days", rules: []headerRule{{pattern: "**", header: "X-Amz-Tag-ttl", value: "0d"}}, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := expiries(tC.rules, defaultExpiryTag)
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			var days []int32
+			for _, e := range got {
+				days = append(days, e.days)
+			}
+
+			if !reflect.DeepEqual(days, tC.wantDays) {
+				t.Errorf("Expected expiries after %v days; got %v", tC.wantDays, days)
+			}
+		})
+	}
+}
+
+func Test_installLifecycle(t *testing.T) {
+	other := types.LifecycleRule{ID: aws.String("abort-uploads"), Status: types.ExpirationStatusEnabled}
+	stale := types.LifecycleRule{ID: aws.String("s3-copy:site/:ttl=1d"), Status: types.ExpirationStatusEnabled}
+	otherPrefix := types.LifecycleRule{ID: aws.String("s3-copy:docs/:ttl=1d"), Status: types.ExpirationStatusEnabled}
+	week := expiry{tag: types.Tag{Key: aws.String("ttl"), Value: aws.String("7d")}, days: 7}
+
+	testCases := []struct {
+		desc        string
+		existing    []types.LifecycleRule
+		getErr      error
+		prefix      string
+		expirations []expiry
+		wantIDs     []string
+		wantDeleted bool
+		wantErr     bool
+	}{
+		{
+			desc:        "no configuration",
+			getErr:      &smithy.GenericAPIError{Code: "NoSuchLifecycleConfiguration"},
+			prefix:      "site/",
+			expirations: []expiry{week},
+			wantIDs:     []string{"s3-copy:site/:ttl=7d"},
+		},
+		{
+			desc:        "replaces rules of the prefix",
+			existing:    []types.LifecycleRule{other, stale, otherPrefix},
+			prefix:      "site/",
+			expirations: []expiry{week},
+			wantIDs:     []string{"abort-uploads", "s3-copy:docs/:ttl=1d", "s3-copy:site/:ttl=7d"},
+		},
+		{
+			desc:        "removes last rule",
+			existing:    []types.LifecycleRule{stale},
+			prefix:      "site/",
+			wantDeleted: true,
+		},
+		{
+			desc:        "unreadable configuration",
+			getErr:      errors.New("access denied"),
+			expirations: []expiry{week},
+			wantErr:     true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockLifecycleConfigurer{rules: tC.existing, getErr: tC.getErr}
+
+			err := installLifecycle(context.Background(), client, "my-site", tC.prefix, tC.expirations)
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			var ids []string
+			for _, rule := range client.rules {
+				ids = append(ids, aws.ToString(rule.ID))
+			}
+
+			if !tC.wantErr && !reflect.DeepEqual(ids, tC.wantIDs) {
+				t.Errorf("Expected rules %v; got %v", tC.wantIDs, ids)
+			}
+
+			if client.deleted != tC.wantDeleted {
+				t.Errorf("Expected the configuration to be deleted: %v; got %v", tC.wantDeleted, client.deleted)
+			}
+		})
+	}
+}
+
+func Test_lifecycleRules_filter(t *testing.T) {
+	tag := types.Tag{Key: aws.String("ttl"), Value: aws.String("7d")}
+	expirations := []expiry{{tag: tag, days: 7}}
+
+	root := lifecycleRules(nil, "", expirations)
+	if len(root) != 1 || root[0].Filter.Tag == nil || root[0].Filter.And != nil {
+		t.Errorf("Expected a rule filtering by tag only; got %+v", root)
+	}
+
+	prefixed := lifecycleRules(nil, "site/", expirations)
+	if len(prefixed) != 1 || prefixed[0].Filter.And == nil || aws.ToString(prefixed[0].Filter.And.Prefix) != "site/" {
+		t.Errorf("Expected a rule filtering by prefix and tag; got %+v", prefixed)
+	}
+
+	if got := aws.ToInt32(prefixed[0].Expiration.Days); got != 7 {
+		t.Errorf("Expected expiry after 7 days; got %d", got)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"time"
+)
+
+// lockPath is the state object that is held while a deploy is running.
+const lockPath = stateDir + "lock.json"
+
+// defaultLockTimeout is how long a lock is valid for. A run that crashes can't release its lock,
+// so it may be taken over once it expires.
+const defaultLockTimeout = time.Hour
+
+// lockAttempts bounds how often acquiring the lock is retried after it changed in the meantime,
+// e.g. because it was released or taken over by another run.
+const lockAttempts = 3
+
+// lockStore creates and deletes state objects with conditional requests, so that only one run at
+// a time can hold a lock.
+type lockStore interface {
+	CreateState(ctx context.Context, path string, body []byte) (string, error)
+	ReadStateETag(ctx context.Context, path string) ([]byte, string, error)
+	DeleteState(ctx context.Context, path, etag string) error
+}
+
+// lockInfo is the contents of the lock object, identifying the run holding it.
+type lockInfo struct {
+	Owner      string    `json:"owner"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// lockHeldError is returned when another run holds the lock.
+type lockHeldError struct {
+	holder lockInfo
+}
+
+func (e *lockHeldError) Error() string {
+	return fmt.Sprintf(
+		"the deploy lock is held by %s since %s, until %s",
+		e.holder.Owner,
+		e.holder.AcquiredAt.Local().Format(time.RFC3339),
+		e.holder.ExpiresAt.Local().Format(time.RFC3339),
+	)
+}
+
+// deployLock is a lock held by this run.
+type deployLock struct {
+	store lockStore
+	etag  string
+}
+
+// acquireDeployLock takes the deploy lock for the given owner, or fails if another run holds it.
+// An expired lock is taken over.
+func acquireDeployLock(ctx context.Context, store lockStore, owner string, now time.Time, timeout time.Duration) (*deployLock, error) {
+	body, err := json.MarshalIndent(lockInfo{
+		Owner:      owner,
+		AcquiredAt: now.UTC(),
+		ExpiresAt:  now.Add(timeout).UTC(),
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; attempt < lockAttempts; attempt++ {
+		etag, err := store.CreateState(ctx, lockPath, body)
+		if err == nil {
+			return &deployLock{store: store, etag: etag}, nil
+		}
+
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("could not acquire the deploy lock: %v", err)
+		}
+
+		existing, existingETag, err := store.ReadStateETag(ctx, lockPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			// The lock was released in the meantime.
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("could not read the deploy lock: %v", err)
+		}
+
+		var holder lockInfo
+		if err := json.Unmarshal(existing, &holder); err != nil {
+			return nil, fmt.Errorf("could not parse the deploy lock: %v", err)
+		}
+
+		if now.Before(holder.ExpiresAt) {
+			return nil, &lockHeldError{holder: holder}
+		}
+
+		log.Printf("Taking over the deploy lock of %s, which expired at %s\n", holder.Owner, holder.ExpiresAt.Local().Format(time.RFC3339))
+
+		// If the lock changed since it was read, another run took it over first, which the next
+		// attempt finds out.
+		if err := store.DeleteState(ctx, lockPath, existingETag); err != nil && !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("could not take over the deploy lock: %v", err)
+		}
+	}
+
+	return nil, errors.New("could not acquire the deploy lock: it kept changing while acquiring it")
+}
+
+// Release gives up the lock, unless it was taken over by another run. It is safe to call on a nil
+// lock.
+func (l *deployLock) Release(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	err := l.store.DeleteState(ctx, lockPath, l.etag)
+	if errors.Is(err, fs.ErrExist) {
+		return errors.New("the deploy lock was taken over by another run after it expired")
+	}
+
+	return err
+}
+
+// Fatal releases the lock and exits like `log.Fatal`, so that a failed run doesn't keep other runs
+// waiting until the lock expires. It is safe to call on a nil lock.
+func (l *deployLock) Fatal(v ...any) {
+	l.releaseBeforeExit()
+	log.Fatal(v...)
+}
+
+// Fatalf releases the lock and exits like `log.Fatalf`. It is safe to call on a nil lock.
+func (l *deployLock) Fatalf(format string, v ...any) {
+	l.releaseBeforeExit()
+	log.Fatalf(format, v...)
+}
+
+func (l *deployLock) releaseBeforeExit() {
+	ctx, cancel := context.WithTimeout(context.Background(), abortTimeout)
+	defer cancel()
+
+	if err := l.Release(ctx); err != nil {
+		log.Print("Could not release the deploy lock: ", err)
+	}
+}
+
+// lockOwner identifies this run in the lock object.
+func lockOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown host"
+	}
+
+	return fmt.Sprintf("%s (pid %d)", host, os.Getpid())
+}
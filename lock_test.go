@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+	"time"
+)
+
+// mockLockStore keeps state objects in memory, honouring the conditions of conditional requests.
+type mockLockStore struct {
+	objects map[string][]byte
+	etags   map[string]string
+	version int
+}
+
+func (s *mockLockStore) CreateState(ctx context.Context, path string, body []byte) (string, error) {
+	if _, ok := s.objects[path]; ok {
+		return "", fmt.Errorf("failed to create %s: %w", path, fs.ErrExist)
+	}
+
+	if s.objects == nil {
+		s.objects = map[string][]byte{}
+		s.etags = map[string]string{}
+	}
+
+	s.version++
+	s.objects[path] = body
+	s.etags[path] = fmt.Sprintf(`"%d"`, s.version)
+
+	return s.etags[path], nil
+}
+
+func (s *mockLockStore) ReadStateETag(ctx context.Context, path string) ([]byte, string, error) {
+	body, ok := s.objects[path]
+	if !ok {
+		return nil, "", fmt.Errorf("failed to read %s: %w", path, fs.ErrNotExist)
+	}
+
+	return body, s.etags[path], nil
+}
+
+func (s *mockLockStore) DeleteState(ctx context.Context, path, etag string) error {
+	if current, ok := s.etags[path]; ok && current != etag {
+		return fmt.Errorf("failed to delete %s: %w", path, fs.ErrExist)
+	}
+
+	delete(s.objects, path)
+	delete(s.etags, path)
+
+	return nil
+}
+
+func Test_acquireDeployLock(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := &mockLockStore{}
+
+	lock, err := acquireDeployLock(context.Background(), store, "ci-1", now, time.Hour)
+	if err != nil {
+		t.Fatalf("Expected the lock to be acquired; got %v", err)
+	}
+
+	var held *lockHeldError
+	_, err = acquireDeployLock(context.Background(), store, "ci-2", now.Add(time.Minute), time.Hour)
+	if !errors.As(err, &held) || held.holder.Owner != "ci-1" {
+		t.Fatalf("Expected the lock to be held by ci-1; got %v", err)
+	}
+
+	if err := lock.Release(context.Background()); err != nil {
+		t.Fatalf("Expected the lock to be released; got %v", err)
+	}
+
+	if _, err := acquireDeployLock(context.Background(), store, "ci-2", now.Add(time.Minute), time.Hour); err != nil {
+		t.Errorf("Expected the released lock to be acquired; got %v", err)
+	}
+}
+
+func Test_acquireDeployLock_expired(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := &mockLockStore{}
+
+	crashed, err := acquireDeployLock(context.Background(), store, "ci-1", now, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := acquireDeployLock(context.Background(), store, "ci-2", now.Add(2*time.Hour), time.Hour)
+	if err != nil {
+		t.Fatalf("Expected the expired lock to be taken over; got %v", err)
+	}
+
+	var holder lockInfo
+	if err := json.Unmarshal(store.objects[lockPath], &holder); err != nil {
+		t.Fatal(err)
+	}
+
+	if holder.Owner != "ci-2" {
+		t.Errorf("Expected the lock to be held by ci-2; got %s", holder.Owner)
+	}
+
+	if err := crashed.Release(context.Background()); err == nil {
+		t.Error("Expected releasing a lock that was taken over to fail")
+	}
+
+	if _, ok := store.objects[lockPath]; !ok {
+		t.Error("Expected the lock of ci-2 to be kept")
+	}
+
+	if err := lock.Release(context.Background()); err != nil {
+		t.Errorf("Expected the lock to be released; got %v", err)
+	}
+}
+
+func Test_deployLock_Release_nil(t *testing.T) {
+	var lock *deployLock
+	if err := lock.Release(context.Background()); err != nil {
+		t.Errorf("Expected releasing no lock to succeed; got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// runList implements the `ls` command, which lists the objects under a prefix.
+func runList(cmd command, args []string) {
+	var common commonFlags
+	var recursive bool
+
+	flags := newFlagSet(cmd, "[flags]")
+	common.register(flags)
+	flags.BoolVar(&recursive, "recursive", false, "List every object under the prefix instead of grouping keys by '/'")
+	flags.Parse(args)
+
+	if _, err := common.applyConfig(flags); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := newSignalContext()
+	defer stop()
+
+	client, err := common.newClient(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	objects, prefixes, err := listDirectory(ctx, client, common.bucket, normalizePrefix(common.prefix), recursive)
+	if err != nil {
+		log.Fatal("Could not list objects: ", err)
+	}
+
+	if err := printListing(os.Stdout, objects, prefixes); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// listDirectory lists the objects under a prefix, in key order, with keys relative to the prefix.
+// Unless the listing is recursive, keys are grouped by `/` the way a directory listing would be,
+// and the common prefixes of the grouped keys are returned separately.
+func listDirectory(ctx context.Context, client *s3.Client, bucket, prefix string, recursive bool) ([]remoteObject, []string, error) {
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(bucket)}
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
+
+	if !recursive {
+		input.Delimiter = aws.String("/")
+	}
+
+	var objects []remoteObject
+	var prefixes []string
+
+	paginator := s3.NewListObjectsV2Paginator(client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list S3 objects: %v", err)
+		}
+
+		for _, common := range page.CommonPrefixes {
+			prefixes = append(prefixes, strings.TrimPrefix(aws.ToString(common.Prefix), prefix))
+		}
+
+		for _, object := range page.Contents {
+			key := strings.TrimPrefix(aws.ToString(object.Key), prefix)
+			objects = append(objects, remoteObject{
+				Key:          key,
+				Size:         aws.ToInt64(object.Size),
+				ETag:         strings.Trim(aws.ToString(object.ETag), `"`),
+				LastModified: aws.ToTime(object.LastModified),
+				StorageClass: string(object.StorageClass),
+			})
+		}
+	}
+
+	return objects, prefixes, nil
+}
+
+// printListing writes a table of the listed prefixes and objects, followed by their total size.
+// Prefixes are shown first, marked with `PRE` in place of a size.
+func printListing(w io.Writer, objects []remoteObject, prefixes []string) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	for _, prefix := range prefixes {
+		fmt.Fprintf(table, "\t%10s\t\t%s\n", "PRE", prefix)
+	}
+
+	var total int64
+	for _, object := range objects {
+		total += object.Size
+
+		storageClass := object.StorageClass
+		if storageClass == "" {
+			storageClass = "STANDARD"
+		}
+
+		fmt.Fprintf(
+			table,
+			"%s\t%10s\t%s\t%s\n",
+			object.LastModified.Local().Format("2006-01-02 15:04:05"),
+			formatBytes(object.Size),
+			storageClass,
+			object.Key,
+		)
+	}
+
+	if err := table.Flush(); err != nil {
+		return fmt.Errorf("could not write listing: %v", err)
+	}
+
+	_, err := fmt.Fprintf(w, "\nTotal: %d object(s), %s\n", len(objects), formatBytes(total))
+
+	return err
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_printListing(t *testing.T) {
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	date := modTime.Local().Format("2006-01-02 15:04:05")
+
+	testCases := []struct {
+		desc     string
+		objects  []remoteObject
+		prefixes []string
+		want     []string
+	}{
+		{
+			desc: "objects",
+			objects: []remoteObject{
+				{Key: "index.html", Size: 512, LastModified: modTime, StorageClass: "STANDARD"},
+				{Key: "video.mp4", Size: 3 * 1024 * 1024, LastModified: modTime, StorageClass: "GLACIER"},
+			},
+			want: []string{
+				date + "       512 B  STANDARD  index.html",
+				date + "     3.0 MiB  GLACIER   video.mp4",
+				"",
+				"Total: 2 object(s), 3.0 MiB",
+			},
+		},
+		{
+			desc:     "prefixes before objects",
+			objects:  []remoteObject{{Key: "index.html", Size: 10, LastModified: modTime}},
+			prefixes: []string{"assets/"},
+			want: []string{
+				"                            PRE            assets/",
+				date + "        10 B  STANDARD  index.html",
+				"",
+				"Total: 1 object(s), 10 B",
+			},
+		},
+		{
+			desc: "empty",
+			want: []string{"", "Total: 0 object(s), 0 B"},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := printListing(&out, tC.objects, tC.prefixes); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			got := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			if strings.Join(got, "\n") != strings.Join(tC.want, "\n") {
+				t.Errorf("Unexpected listing:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tC.want, "\n"))
+			}
+		})
+	}
+}
@@ -1,13 +1,11 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"io"
 	"io/fs"
-	"io/ioutil"
 	"os"
-	"strings"
-	"testing"
 	"time"
 )
 
@@ -85,7 +83,7 @@ type mockUploader struct {
 	uploadedObject *uploadObject
 }
 
-func (u *mockUploader) Upload(object *uploadObject) error {
+func (u *mockUploader) Upload(ctx context.Context, object *uploadObject) error {
 	if u.uploadErr != nil {
 		return u.uploadErr
 	}
@@ -95,160 +93,20 @@ func (u *mockUploader) Upload(object *uploadObject) error {
 	return nil
 }
 
-func Test_createUploadFunc(t *testing.T) {
-	testCases := []struct {
-		desc    string
-		fsys    mockFS
-		client  mockUploader
-		path    string
-		entry   fs.DirEntry
-		walkErr error
-		want    *uploadObject
-		wantErr bool
-	}{
-		{
-			desc:    "walk error no uploads",
-			client:  mockUploader{},
-			path:    "foo.txt",
-			walkErr: errors.New("some error"),
-			want:    nil,
-			wantErr: true,
-		},
-		{
-			desc:   "skip directory",
-			client: mockUploader{},
-			path:   "foo/bar",
-			entry: mockFileInfo{
-				name:    "foo/bar",
-				size:    12,
-				mode:    fs.ModeDir,
-				modTime: time.Time{},
-			},
-			want:    nil,
-			wantErr: false,
-		},
-		{
-			desc: "error opening file",
-			fsys: mockFS{
-				files: map[string]mockFile{
-					"foo.txt": {err: errors.New("can't be opened")},
-				},
-			},
-			client: mockUploader{},
-			path:   "foo.txt",
-			entry: mockFileInfo{
-				name:    "foo.txt",
-				size:    12,
-				mode:    0,
-				modTime: time.Time{},
-			},
-			want:    nil,
-			wantErr: true,
-		},
-		{
-			desc: "upload error",
-			fsys: mockFS{
-				files: map[string]mockFile{
-					"foo.txt": {body: strings.NewReader("some body")},
-				},
-			},
-			client: mockUploader{
-				uploadErr: errors.New("failed to upload"),
-			},
-			path: "foo.txt",
-			entry: mockFileInfo{
-				name:    "foo.txt",
-				size:    12,
-				mode:    0,
-				modTime: time.Time{},
-			},
-			want:    nil,
-			wantErr: true,
-		},
-		{
-			desc: "successful upload",
-			fsys: mockFS{
-				files: map[string]mockFile{
-					"foo.txt": {body: strings.NewReader("some body")},
-				},
-			},
-			client: mockUploader{},
-			path:   "foo.txt",
-			entry: mockFileInfo{
-				name:    "foo.txt",
-				size:    12,
-				mode:    0,
-				modTime: time.Time{},
-			},
-			want: &uploadObject{
-				Body:        strings.NewReader("some body"),
-				Path:        "foo.txt",
-				ContentType: "text/plain; charset=utf-8",
-			},
-		},
-		{
-			desc: "successful javascript upload",
-			fsys: mockFS{
-				files: map[string]mockFile{
-					"app/index.js": {body: strings.NewReader("let foo = 'bar';")},
-				},
-			},
-			client: mockUploader{},
-			path:   "app/index.js",
-			entry: mockFileInfo{
-				name:    "app/index.js",
-				size:    12,
-				mode:    0,
-				modTime: time.Time{},
-			},
-			want: &uploadObject{
-				Body:        strings.NewReader("let foo = 'bar';"),
-				Path:        "app/index.js",
-				ContentType: "application/javascript",
-			},
-		},
-	}
-	for _, tC := range testCases {
-		t.Run(tC.desc, func(t *testing.T) {
-			uploadFunc := createUploadFunc(&tC.fsys, &tC.client)
-
-			err := uploadFunc(tC.path, tC.entry, tC.walkErr)
-			if (err == nil) == tC.wantErr {
-				t.Errorf("Expected error presence %v; got error %v", tC.wantErr, err)
-			}
-
-			if (tC.client.uploadedObject == nil) != (tC.want == nil) {
-				t.Fatalf("Wanted uploaded object %v; got %v", tC.want, tC.client.uploadedObject)
-			}
-
-			if tC.want == nil {
-				return
-			}
-
-			if tC.client.uploadedObject.Path != tC.want.Path {
-				t.Fatalf("Expected upload to path %q; got %q", tC.want.Path, tC.client.uploadedObject.Path)
-			}
-
-			if tC.client.uploadedObject.ContentType != tC.want.ContentType {
-				t.Fatalf("Expected content type %q; got %q", tC.want.ContentType, tC.client.uploadedObject.ContentType)
-			}
-
-			wantBody, err := ioutil.ReadAll(tC.want.Body)
-			if err != nil {
-				t.Fatalf("Could not read wanted body: %v", err)
-			}
-
-			gotBody, err := ioutil.ReadAll(tC.client.uploadedObject.Body)
-			if err != nil {
-				t.Fatalf("Could not read uploaded body: %v", err)
-			}
-
-			wantBodyStr := string(wantBody)
-			gotBodyStr := string(gotBody)
-
-			if string(wantBodyStr) != string(gotBodyStr) {
-				t.Errorf("Expected body %q; got %q", wantBodyStr, gotBodyStr)
-			}
-		})
+// recordingUploader keeps every object passed to it, reading their bodies.
+type recordingUploader struct {
+	objects []*uploadObject
+	bodies  []string
+}
+
+func (u *recordingUploader) Upload(ctx context.Context, object *uploadObject) error {
+	body, err := io.ReadAll(object.Body)
+	if err != nil {
+		return err
 	}
+
+	u.objects = append(u.objects, object)
+	u.bodies = append(u.bodies, string(body))
+
+	return nil
 }
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// manifest lists the files published by a run, so that downstream jobs such as smoke tests or
+// server-side renderers know exactly which objects exist and where they are served from.
+type manifest struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	Bucket      string    `json:"bucket"`
+	Prefix      string    `json:"prefix,omitempty"`
+	// Files maps the slash-separated local path of every file to the object it was published as.
+	Files map[string]manifestEntry `json:"files"`
+}
+
+// manifestEntry describes the object a file was published as. The size and ETag are those of the
+// object, which differ from the local file's if it was compressed; the hash is of the local file.
+type manifestEntry struct {
+	Key    string `json:"key"`
+	URL    string `json:"url"`
+	ETag   string `json:"etag"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	// Integrity is the Subresource Integrity digest of scripts and stylesheets, for the
+	// `integrity` attribute of the tags loading them.
+	Integrity string `json:"integrity,omitempty"`
+}
+
+// sriExtensions are the extensions of the files that get a Subresource Integrity digest, as
+// browsers only check the integrity of scripts and stylesheets.
+var sriExtensions = []string{".js", ".mjs", ".css"}
+
+// newManifest describes the given files, looking up their objects beneath `prefix` in `remote`,
+// which must be listed after the upload, under the keys given by `renames`. `baseURL` is the URL the objects beneath the prefix are
+// served from. If `sri` is set, scripts and stylesheets also get a Subresource Integrity digest.
+func newManifest(fsys fs.FS, paths []string, remote map[string]remoteObject, renames hashRenames, bucket, prefix, baseURL string, sri bool, now time.Time) (*manifest, error) {
+	m := &manifest{
+		GeneratedAt: now.UTC(),
+		Bucket:      bucket,
+		Prefix:      prefix,
+		Files:       make(map[string]manifestEntry, len(paths)),
+	}
+
+	base := strings.TrimSuffix(baseURL, "/") + "/"
+	for _, name := range paths {
+		file := filepath.ToSlash(name)
+		key := renames.Key(file)
+		object, ok := remote[key]
+		if !ok {
+			return nil, fmt.Errorf("no object found for %s", key)
+		}
+
+		digest, integrity, err := digestFile(fsys, file, sri && slices.Contains(sriExtensions, path.Ext(file)))
+		if err != nil {
+			return nil, err
+		}
+
+		m.Files[file] = manifestEntry{
+			Key:       prefix + key,
+			URL:       base + (&url.URL{Path: key}).EscapedPath(),
+			ETag:      object.ETag,
+			Size:      object.Size,
+			SHA256:    digest,
+			Integrity: integrity,
+		}
+	}
+
+	return m, nil
+}
+
+// digestFile returns the hex-encoded SHA-256 hash of a file and, if requested, its Subresource
+// Integrity digest, reading the file only once.
+func digestFile(fsys fs.FS, path string, sri bool) (string, string, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return "", "", fmt.Errorf("could not hash %s: %v", path, err)
+	}
+	defer file.Close()
+
+	sha256Hash := sha256.New()
+	sha384Hash := sha512.New384()
+
+	var w io.Writer = sha256Hash
+	if sri {
+		w = io.MultiWriter(sha256Hash, sha384Hash)
+	}
+
+	if _, err := io.Copy(w, file); err != nil {
+		return "", "", fmt.Errorf("could not hash %s: %v", path, err)
+	}
+
+	var integrity string
+	if sri {
+		integrity = "sha384-" + base64.StdEncoding.EncodeToString(sha384Hash.Sum(nil))
+	}
+
+	return hex.EncodeToString(sha256Hash.Sum(nil)), integrity, nil
+}
+
+// Encode returns the manifest as indented JSON. The files are sorted by path.
+func (m *manifest) Encode() ([]byte, error) {
+	body, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(body, '\n'), nil
+}
+
+// writeManifest writes the manifest to the given file, or to standard output if the path is `-`.
+func writeManifest(path string, body []byte) error {
+	if path == "-" {
+		_, err := os.Stdout.Write(body)
+		return err
+	}
+
+	if err := os.WriteFile(path, body, 0o644); err != nil {
+		return fmt.Errorf("could not write manifest: %v", err)
+	}
+
+	return nil
+}
+
+// uploadManifest stores the manifest in the bucket under the given key, relative to the prefix.
+func uploadManifest(ctx context.Context, client uploader, key string, body []byte) error {
+	err := client.Upload(ctx, &uploadObject{
+		Path:        key,
+		Body:        bytes.NewReader(body),
+		ContentType: "application/json",
+		Headers:     map[string]string{"Cache-Control": "no-cache"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload manifest: %v", err)
+	}
+
+	return nil
+}
+
+// publishedPaths returns the sorted paths of the files that were published.
+func publishedPaths(seen map[string]bool) []string {
+	paths := make([]string, 0, len(seen))
+	for path := range seen {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	return paths
+}
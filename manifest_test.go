@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func Test_newManifest(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":           {Data: []byte("hello")},
+		"assets/app bundle.js": {Data: []byte("")},
+	}
+	remote := map[string]remoteObject{
+		"index.html":           {Key: "index.html", Size: 25, ETag: `"abc"`},
+		"assets/app bundle.js": {Key: "assets/app bundle.js", Size: 0, ETag: `"def"`},
+	}
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	m, err := newManifest(fsys, []string{"index.html", "assets/app bundle.js"}, remote, nil, "my-bucket", "site/", "https://example.com", false, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]manifestEntry{
+		"index.html": {
+			Key:    "site/index.html",
+			URL:    "https://example.com/index.html",
+			ETag:   `"abc"`,
+			Size:   25,
+			SHA256: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		},
+		"assets/app bundle.js": {
+			Key:    "site/assets/app bundle.js",
+			URL:    "https://example.com/assets/app%20bundle.js",
+			ETag:   `"def"`,
+			Size:   0,
+			SHA256: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		},
+	}
+	if !reflect.DeepEqual(m.Files, want) {
+		t.Errorf("Expected files %+v; got %+v", want, m.Files)
+	}
+
+	if m.Bucket != "my-bucket" || m.Prefix != "site/" || !m.GeneratedAt.Equal(now) {
+		t.Errorf("Unexpected manifest header: %+v", m)
+	}
+
+	if _, err := newManifest(fsys, []string{"index.html"}, map[string]remoteObject{}, nil, "my-bucket", "", "https://example.com", false, now); err == nil {
+		t.Error("Expected an error for a file without an object")
+	}
+}
+
+func Test_manifest_Encode(t *testing.T) {
+	m := &manifest{
+		GeneratedAt: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+		Bucket:      "my-bucket",
+		Files:       map[string]manifestEntry{"index.html": {Key: "index.html", ETag: `"abc"`}},
+	}
+
+	body, err := m.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded manifest
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(&decoded, m) {
+		t.Errorf("Expected %+v after a round trip; got %+v", m, decoded)
+	}
+}
+
+func Test_uploadManifest(t *testing.T) {
+	next := &recordingUploader{}
+	if err := uploadManifest(context.Background(), next, "manifest.json", []byte("{}\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	object := next.objects[0]
+	if object.Path != "manifest.json" || object.ContentType != "application/json" || next.bodies[0] != "{}\n" {
+		t.Errorf("Expected the manifest to be uploaded as JSON; got %s (%s) with %q", object.Path, object.ContentType, next.bodies[0])
+	}
+}
+
+func Test_publishedPaths(t *testing.T) {
+	got := publishedPaths(map[string]bool{"b.txt": true, "a.txt": true})
+	if want := []string{"a.txt", "b.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v; got %v", want, got)
+	}
+}
+
+func Test_newManifest_sri(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app.js":     {Data: []byte("alert(1)")},
+		"index.html": {Data: []byte("hello")},
+	}
+	remote := map[string]remoteObject{
+		"app.js":     {Key: "app.js"},
+		"index.html": {Key: "index.html"},
+	}
+
+	m, err := newManifest(fsys, []string{"app.js", "index.html"}, remote, nil, "my-bucket", "", "https://example.com", true, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := m.Files["app.js"].Integrity, "sha384-HT2E9NfWiuQ/w1PRai+hTyqW16NIoCGA/m8VQDUopfAtcz6YQjtsMmQd5uRbVDpW"; got != want {
+		t.Errorf("Expected integrity %s; got %s", want, got)
+	}
+
+	if got, want := m.Files["app.js"].SHA256, "6e11c72f7cf6bc383152dd16ddd5903aba6bb1c99d6b6639a4bb0b838185fa92"; got != want {
+		t.Errorf("Expected hash %s; got %s", want, got)
+	}
+
+	if got := m.Files["index.html"].Integrity; got != "" {
+		t.Errorf("Expected no integrity for a page; got %s", got)
+	}
+}
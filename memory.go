@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// fitMemoryBudget lowers the number of parts uploaded in parallel per file, and then the number of
+// files uploaded in parallel, until the part buffers of every upload in flight fit in a budget of
+// the given number of MiB. Part sizes are left as they are, since they determine the ETags that
+// incremental uploads compare. It returns the file concurrency and the multipart settings to use.
+func fitMemoryBudget(budgetMiB, concurrency int, multipart multipartSettings) (int, multipartSettings, error) {
+	budget := int64(budgetMiB) * mebibyte
+	partSize := multipart.partSize()
+	if budget < partSize {
+		return 0, multipart, fmt.Errorf("invalid memory budget %d MiB: must be at least the part size of %d MiB", budgetMiB, partSize/mebibyte)
+	}
+
+	parts := int64(budget / partSize)
+	if int64(multipart.Concurrency) > parts {
+		multipart.Concurrency = int(parts)
+	}
+
+	if files := parts / int64(multipart.Concurrency); int64(concurrency) > files {
+		concurrency = int(files)
+	}
+
+	return concurrency, multipart, nil
+}
+
+// partBufferPool reuses the buffers that parts are read into, so that uploading large files
+// doesn't allocate a new buffer for every part.
+type partBufferPool struct {
+	// size is the capacity of the pooled buffers. Larger parts get a buffer of their own.
+	size int64
+	pool sync.Pool
+}
+
+// newPartBufferPool creates a pool of buffers of the given size.
+func newPartBufferPool(size int64) *partBufferPool {
+	p := &partBufferPool{size: size}
+	p.pool.New = func() any {
+		buf := make([]byte, size)
+		return &buf
+	}
+
+	return p
+}
+
+// Get returns a buffer of length n. It is safe to call on a nil pool, which allocates a new
+// buffer every time.
+func (p *partBufferPool) Get(n int64) []byte {
+	if p == nil || n > p.size {
+		return make([]byte, n)
+	}
+
+	return (*p.pool.Get().(*[]byte))[:n]
+}
+
+// Put returns a buffer obtained from Get to the pool once it's no longer used.
+func (p *partBufferPool) Put(buf []byte) {
+	if p == nil || int64(cap(buf)) != p.size {
+		return
+	}
+
+	buf = buf[:cap(buf)]
+	p.pool.Put(&buf)
+}
@@ -0,0 +1,91 @@
+package main
+
+import "testing"
+
+func Test_fitMemoryBudget(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		budgetMiB       int
+		concurrency     int
+		multipart       multipartSettings
+		wantConcurrency int
+		wantParts       int
+		wantErr         bool
+	}{
+		{
+			desc:            "within budget",
+			budgetMiB:       200,
+			concurrency:     4,
+			multipart:       multipartSettings{PartSize: 10 * mebibyte, Concurrency: 5},
+			wantConcurrency: 4,
+			wantParts:       5,
+		},
+		{
+			desc:            "fewer files",
+			budgetMiB:       100,
+			concurrency:     4,
+			multipart:       multipartSettings{PartSize: 10 * mebibyte, Concurrency: 5},
+			wantConcurrency: 2,
+			wantParts:       5,
+		},
+		{
+			desc:            "fewer parts",
+			budgetMiB:       30,
+			concurrency:     4,
+			multipart:       multipartSettings{PartSize: 10 * mebibyte, Concurrency: 5},
+			wantConcurrency: 1,
+			wantParts:       3,
+		},
+		{
+			desc:        "budget below part size",
+			budgetMiB:   8,
+			concurrency: 4,
+			multipart:   multipartSettings{PartSize: 10 * mebibyte, Concurrency: 5},
+			wantErr:     true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			concurrency, multipart, err := fitMemoryBudget(tC.budgetMiB, tC.concurrency, tC.multipart)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if tC.wantErr {
+				return
+			}
+
+			if concurrency != tC.wantConcurrency || multipart.Concurrency != tC.wantParts {
+				t.Errorf("Expected %d file(s) with %d part(s) each; got %d with %d", tC.wantConcurrency, tC.wantParts, concurrency, multipart.Concurrency)
+			}
+
+			if multipart.PartSize != tC.multipart.PartSize {
+				t.Errorf("Expected the part size to be kept; got %d", multipart.PartSize)
+			}
+		})
+	}
+}
+
+func Test_partBufferPool(t *testing.T) {
+	pool := newPartBufferPool(16)
+
+	buf := pool.Get(10)
+	if len(buf) != 10 || cap(buf) != 16 {
+		t.Errorf("Expected a buffer of length 10 and capacity 16; got %d and %d", len(buf), cap(buf))
+	}
+
+	pool.Put(buf)
+	if buf := pool.Get(16); len(buf) != 16 {
+		t.Errorf("Expected a buffer of length 16; got %d", len(buf))
+	}
+
+	if buf := pool.Get(20); len(buf) != 20 {
+		t.Errorf("Expected a larger part to get a buffer of its own; got length %d", len(buf))
+	}
+
+	var unpooled *partBufferPool
+	if buf := unpooled.Get(5); len(buf) != 5 {
+		t.Errorf("Expected a nil pool to allocate a buffer; got length %d", len(buf))
+	}
+	unpooled.Put(buf)
+}
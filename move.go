@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// movedFileKey is the context key of the movedFile that the objects uploaded for a file are
+// recorded in.
+type movedFileKey struct{}
+
+// movedFile collects the verification of the objects uploaded for a local file, which may be
+// several, e.g. its website aliases or compressed variants.
+type movedFile struct {
+	mu       sync.Mutex
+	objects  int
+	problems []string
+}
+
+// moveUploader removes local files once every object uploaded for them was read back and matched
+// what was sent, for -move. The objects are verified by a moveVerifier further down the chain.
+type moveUploader struct {
+	next uploader
+	// remove removes a local file by its slash-separated path relative to the working directory.
+	remove func(path string) error
+}
+
+func (u *moveUploader) Upload(ctx context.Context, object *uploadObject) error {
+	path := object.Path
+
+	file := &movedFile{}
+	if err := u.next.Upload(context.WithValue(ctx, movedFileKey{}, file), object); err != nil {
+		return err
+	}
+
+	file.mu.Lock()
+	defer file.mu.Unlock()
+
+	if len(file.problems) > 0 {
+		return fmt.Errorf("verification failed for %s, which was kept: %s", path, strings.Join(file.problems, "; "))
+	}
+
+	// Files whose upload was skipped, e.g. by a dry run, are kept.
+	if file.objects == 0 {
+		return nil
+	}
+
+	if err := u.remove(path); err != nil {
+		return fmt.Errorf("could not remove %s after uploading it: %v", path, err)
+	}
+
+	return nil
+}
+
+// removeLocalFile removes a file by its slash-separated path relative to the working directory.
+func removeLocalFile(path string) error {
+	return os.Remove(filepath.FromSlash(path))
+}
+
+// moveVerifier reads back every object right after uploading it, and records whether it matches
+// what was sent for the file being moved.
+type moveVerifier struct {
+	client objectHeader
+	// metadata is the user metadata sent with every object, before per-file headers.
+	metadata map[string]string
+	// multipart are the settings large files are uploaded with, which determine their ETag.
+	multipart multipartSettings
+	// checkETag is unset for objects whose ETag isn't the MD5 digest of their contents.
+	checkETag bool
+	next      uploader
+}
+
+func (u *moveVerifier) Upload(ctx context.Context, object *uploadObject) error {
+	file, ok := ctx.Value(movedFileKey{}).(*movedFile)
+	if !ok {
+		return u.next.Upload(ctx, object)
+	}
+
+	expected, err := newExpectedObject(object, u.metadata, u.multipart)
+	if err != nil {
+		return err
+	}
+
+	if err := u.next.Upload(ctx, object); err != nil {
+		return err
+	}
+
+	var problems []string
+	if head, err := u.client.Head(ctx, expected.Path); err != nil {
+		problems = []string{err.Error()}
+	} else {
+		problems = expected.mismatches(head, u.checkETag)
+	}
+
+	file.mu.Lock()
+	defer file.mu.Unlock()
+
+	file.objects++
+	for _, problem := range problems {
+		file.problems = append(file.problems, fmt.Sprintf("%s: %s", expected.Path, problem))
+	}
+
+	return nil
+}
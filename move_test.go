@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_moveUploader(t *testing.T) {
+	// "some body" has the MD5 digest 328c30fae61cd119cd177c061d1ac11f.
+	stored := objectHead{Size: 9, ETag: "328c30fae61cd119cd177c061d1ac11f", ContentType: "text/plain"}
+
+	testCases := []struct {
+		desc        string
+		stored      map[string]objectHead
+		uploadErr   error
+		wantErr     bool
+		wantRemoved []string
+	}{
+		{desc: "verified", stored: map[string]objectHead{"renamed.txt": stored}, wantRemoved: []string{"logs/foo.txt"}},
+		{desc: "missing object", stored: map[string]objectHead{}, wantErr: true},
+		{desc: "truncated object", stored: map[string]objectHead{"renamed.txt": {Size: 4, ETag: stored.ETag, ContentType: "text/plain"}}, wantErr: true},
+		{desc: "failed upload", stored: map[string]objectHead{"renamed.txt": stored}, uploadErr: errors.New("denied"), wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var removed []string
+			var next uploader = &recordingUploader{}
+			if tC.uploadErr != nil {
+				next = &mockUploader{uploadErr: tC.uploadErr}
+			}
+
+			// The file is removed by its local path, while the object is verified by its key.
+			u := &moveUploader{
+				next: &renameUploader{
+					renames: hashRenames{"logs/foo.txt": "renamed.txt"},
+					next:    &moveVerifier{client: &mockHeader{objects: tC.stored}, checkETag: true, next: next},
+				},
+				remove: func(path string) error {
+					removed = append(removed, path)
+					return nil
+				},
+			}
+
+			err := u.Upload(context.Background(), &uploadObject{Path: "logs/foo.txt", Body: strings.NewReader("some body"), ContentType: "text/plain"})
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if !reflect.DeepEqual(removed, tC.wantRemoved) {
+				t.Errorf("Expected removed files %v; got %v", tC.wantRemoved, removed)
+			}
+		})
+	}
+}
+
+func Test_moveUploader_notVerified(t *testing.T) {
+	// Files are only removed once an object was verified for them.
+	u := &moveUploader{
+		next: &recordingUploader{},
+		remove: func(path string) error {
+			t.Errorf("Expected %s to be kept", path)
+			return nil
+		},
+	}
+
+	if err := u.Upload(context.Background(), &uploadObject{Path: "foo.txt", Body: strings.NewReader("x")}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func Test_removeLocalFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	if err := os.MkdirAll("spool", 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join("spool", "a.log"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := removeLocalFile("spool/a.log"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join("spool", "a.log")); !os.IsNotExist(err) {
+		t.Errorf("Expected the file to be removed; got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+)
+
+const (
+	// mebibyte is the unit of the multipart size flags.
+	mebibyte = 1024 * 1024
+	// maxSinglePartSize is the largest object S3 accepts in a single PutObject request.
+	maxSinglePartSize = 5 * 1024 * mebibyte
+)
+
+// multipartSettings tune how large files are split into parts. Zero values keep the defaults of
+// the SDK's upload manager.
+type multipartSettings struct {
+	// PartSize is the size of each part, in bytes.
+	PartSize int64
+	// Concurrency is the number of parts of a single file uploaded in parallel.
+	Concurrency int
+	// Threshold is the size up to which files are uploaded in a single request, in bytes. It is
+	// never smaller than the part size.
+	Threshold int64
+}
+
+// newMultipartSettings validates the multipart flags, which give sizes in MiB.
+func newMultipartSettings(partSizeMiB, concurrency, thresholdMiB int) (multipartSettings, error) {
+	settings := multipartSettings{
+		PartSize:    int64(partSizeMiB) * mebibyte,
+		Concurrency: concurrency,
+		Threshold:   int64(thresholdMiB) * mebibyte,
+	}
+
+	if settings.PartSize < manager.MinUploadPartSize || settings.PartSize > maxSinglePartSize {
+		return multipartSettings{}, fmt.Errorf("invalid part size %d MiB: must be between 5 and 5120 MiB", partSizeMiB)
+	}
+
+	if concurrency < 1 {
+		return multipartSettings{}, fmt.Errorf("invalid upload concurrency %d: must be at least 1", concurrency)
+	}
+
+	if thresholdMiB != 0 && (settings.Threshold < settings.PartSize || settings.Threshold > maxSinglePartSize) {
+		return multipartSettings{}, fmt.Errorf("invalid multipart threshold %d MiB: must be between the part size and 5120 MiB", thresholdMiB)
+	}
+
+	return settings, nil
+}
+
+// options returns the upload manager options for uploading the given body. Bodies below the
+// threshold are uploaded in a single part by making it large enough to hold the whole body, which
+// requires their size to be known.
+func (m multipartSettings) options(body io.Reader) func(*manager.Uploader) {
+	return func(u *manager.Uploader) {
+		if m.PartSize > 0 {
+			u.PartSize = m.PartSize
+		}
+
+		if m.Concurrency > 0 {
+			u.Concurrency = m.Concurrency
+		}
+
+		if m.Threshold <= u.PartSize {
+			return
+		}
+
+		if size, ok := bodySize(body); ok && size <= m.Threshold && size > u.PartSize {
+			u.PartSize = size
+		}
+	}
+}
+
+// partSize returns the configured part size, or the SDK's default.
+func (m multipartSettings) partSize() int64 {
+	if m.PartSize > 0 {
+		return m.PartSize
+	}
+
+	return manager.DefaultUploadPartSize
+}
+
+// bodySize returns the number of bytes left in a seekable body, without changing its position.
+func bodySize(body io.Reader) (int64, bool) {
+	seeker, ok := body.(io.Seeker)
+	if !ok {
+		return 0, false
+	}
+
+	current, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, false
+	}
+
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, false
+	}
+
+	if _, err := seeker.Seek(current, io.SeekStart); err != nil {
+		return 0, false
+	}
+
+	return end - current, true
+}
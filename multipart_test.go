@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+)
+
+func Test_newMultipartSettings(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		partSizeMiB  int
+		concurrency  int
+		thresholdMiB int
+		want         multipartSettings
+		wantErr      bool
+	}{
+		{
+			desc:        "defaults",
+			partSizeMiB: 5,
+			concurrency: 5,
+			want:        multipartSettings{PartSize: 5 * mebibyte, Concurrency: 5},
+		},
+		{
+			desc:         "tuned",
+			partSizeMiB:  64,
+			concurrency:  2,
+			thresholdMiB: 256,
+			want:         multipartSettings{PartSize: 64 * mebibyte, Concurrency: 2, Threshold: 256 * mebibyte},
+		},
+		{desc: "part size too small", partSizeMiB: 4, concurrency: 5, wantErr: true},
+		{desc: "part size too large", partSizeMiB: 5121, concurrency: 5, wantErr: true},
+		{desc: "no concurrency", partSizeMiB: 5, concurrency: 0, wantErr: true},
+		{desc: "threshold below part size", partSizeMiB: 64, concurrency: 5, thresholdMiB: 32, wantErr: true},
+		{desc: "threshold above single request limit", partSizeMiB: 64, concurrency: 5, thresholdMiB: 6000, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := newMultipartSettings(tC.partSizeMiB, tC.concurrency, tC.thresholdMiB)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if got != tC.want {
+				t.Errorf("Expected %+v; got %+v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_multipartSettings_options(t *testing.T) {
+	settings := multipartSettings{PartSize: 8 * mebibyte, Concurrency: 3, Threshold: 32 * mebibyte}
+
+	testCases := []struct {
+		desc         string
+		settings     multipartSettings
+		body         io.Reader
+		wantPartSize int64
+		wantConc     int
+	}{
+		{
+			desc:         "SDK defaults",
+			body:         bytes.NewReader(make([]byte, 10)),
+			wantPartSize: manager.DefaultUploadPartSize,
+			wantConc:     manager.DefaultUploadConcurrency,
+		},
+		{
+			desc:         "small body",
+			settings:     settings,
+			body:         bytes.NewReader(make([]byte, 10)),
+			wantPartSize: 8 * mebibyte,
+			wantConc:     3,
+		},
+		{
+			desc:         "body below threshold",
+			settings:     settings,
+			body:         bytes.NewReader(make([]byte, 20*mebibyte)),
+			wantPartSize: 20 * mebibyte,
+			wantConc:     3,
+		},
+		{
+			desc:         "body above threshold",
+			settings:     settings,
+			body:         bytes.NewReader(make([]byte, 40*mebibyte)),
+			wantPartSize: 8 * mebibyte,
+			wantConc:     3,
+		},
+		{
+			desc:         "unseekable body",
+			settings:     settings,
+			body:         io.MultiReader(strings.NewReader("x")),
+			wantPartSize: 8 * mebibyte,
+			wantConc:     3,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			u := &manager.Uploader{PartSize: manager.DefaultUploadPartSize, Concurrency: manager.DefaultUploadConcurrency}
+			tC.settings.options(tC.body)(u)
+
+			if u.PartSize != tC.wantPartSize {
+				t.Errorf("Expected part size %d; got %d", tC.wantPartSize, u.PartSize)
+			}
+
+			if u.Concurrency != tC.wantConc {
+				t.Errorf("Expected concurrency %d; got %d", tC.wantConc, u.Concurrency)
+			}
+		})
+	}
+}
+
+func Test_bodySize(t *testing.T) {
+	body := strings.NewReader("some body")
+	if _, err := body.Seek(5, io.SeekStart); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	size, ok := bodySize(body)
+	if !ok || size != 4 {
+		t.Errorf("Expected 4 remaining bytes; got %d (%v)", size, ok)
+	}
+
+	rest, _ := io.ReadAll(body)
+	if string(rest) != "body" {
+		t.Errorf("Expected the position to be kept; read %q", rest)
+	}
+
+	if _, ok := bodySize(io.MultiReader(body)); ok {
+		t.Error("Expected no size for an unseekable body")
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// tlsVersions maps the values of `-tls-min-version` to TLS versions. Older versions aren't offered,
+// as Go clients don't use them by default.
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// networkSettings configure the HTTP connections to S3 and STS, e.g. for corporate networks that
+// only allow traffic through a proxy, or for endpoints with self-signed certificates. Without
+// them, the proxy from HTTPS_PROXY and the CA bundle from AWS_CA_BUNDLE are used, if set.
+type networkSettings struct {
+	proxy         string
+	caBundle      string
+	clientCert    string
+	clientKey     string
+	tlsMinVersion string
+}
+
+// configOptions returns the options to load the AWS configuration with to apply the settings.
+func (n networkSettings) configOptions() ([]func(*config.LoadOptions) error, error) {
+	var options []func(*config.LoadOptions) error
+
+	transportOptions, err := n.transportOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(transportOptions) > 0 {
+		options = append(options, config.WithHTTPClient(awshttp.NewBuildableClient().WithTransportOptions(transportOptions...)))
+	}
+
+	// Like AWS_CA_BUNDLE, which it takes precedence over, the bundle replaces the system's
+	// certificate authorities.
+	if n.caBundle != "" {
+		bundle, err := os.ReadFile(n.caBundle)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the CA bundle: %v", err)
+		}
+
+		options = append(options, config.WithCustomCABundle(bytes.NewReader(bundle)))
+	}
+
+	return options, nil
+}
+
+// httpClient returns a client for requests outside of the AWS SDK, such as those of `fetch`, that
+// applies the settings. Unlike the SDK, it ignores AWS_CA_BUNDLE. Servers that don't start to
+// respond within `headerTimeout` fail the request.
+func (n networkSettings) httpClient(headerTimeout time.Duration) (*http.Client, error) {
+	transportOptions, err := n.transportOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = headerTimeout
+	for _, option := range transportOptions {
+		option(transport)
+	}
+
+	if n.caBundle != "" {
+		bundle, err := os.ReadFile(n.caBundle)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the CA bundle: %v", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("could not read the CA bundle: no certificates in %s", n.caBundle)
+		}
+
+		tlsConfig(transport).RootCAs = pool
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// transportOptions returns the changes to make to an HTTP transport to apply the proxy, client
+// certificate, and TLS version settings.
+func (n networkSettings) transportOptions() ([]func(*http.Transport), error) {
+	var transportOptions []func(*http.Transport)
+	if n.proxy != "" {
+		proxyURL, err := url.Parse(n.proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy %q: expected e.g. 'http://proxy.example.com:3128'", n.proxy)
+		}
+
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q: expected 'http', 'https', or 'socks5'", proxyURL.Scheme)
+		}
+
+		transportOptions = append(transportOptions, func(tr *http.Transport) {
+			tr.Proxy = http.ProxyURL(proxyURL)
+		})
+	}
+
+	if (n.clientCert == "") != (n.clientKey == "") {
+		return nil, errors.New("the '-client-cert' and '-client-key' flags must be given together")
+	}
+
+	if n.clientCert != "" {
+		cert, err := tls.LoadX509KeyPair(n.clientCert, n.clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not load the client certificate: %v", err)
+		}
+
+		transportOptions = append(transportOptions, func(tr *http.Transport) {
+			tlsConfig(tr).Certificates = []tls.Certificate{cert}
+		})
+	}
+
+	if n.tlsMinVersion != "" {
+		version, ok := tlsVersions[n.tlsMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version %q: expected '1.2' or '1.3'", n.tlsMinVersion)
+		}
+
+		transportOptions = append(transportOptions, func(tr *http.Transport) {
+			tlsConfig(tr).MinVersion = version
+		})
+	}
+
+	return transportOptions, nil
+}
+
+// tlsConfig returns the TLS configuration of a transport, creating it if there is none.
+func tlsConfig(tr *http.Transport) *tls.Config {
+	if tr.TLSClientConfig == nil {
+		tr.TLSClientConfig = &tls.Config{}
+	}
+
+	return tr.TLSClientConfig
+}
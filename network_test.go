@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// listResponse is an empty ListObjectsV2 response.
+const listResponse = `<ListBucketResult><Name>my-site</Name><KeyCount>0</KeyCount><IsTruncated>false</IsTruncated></ListBucketResult>`
+
+// writeClientCertificate writes a self-signed client certificate and its key to PEM files.
+func writeClientCertificate(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+
+	return certFile, keyFile
+}
+
+// writeCABundle writes the certificate of a test server to a PEM file.
+func writeCABundle(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+
+	name := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(name, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600)
+
+	return name
+}
+
+func Test_networkSettings_configOptions(t *testing.T) {
+	certFile, keyFile := writeClientCertificate(t)
+
+	testCases := []struct {
+		desc     string
+		settings networkSettings
+		want     int
+		wantErr  bool
+	}{
+		{desc: "none"},
+		{desc: "proxy", settings: networkSettings{proxy: "http://proxy.example.com:3128"}, want: 1},
+		{desc: "everything", settings: networkSettings{proxy: "socks5://localhost:1080", caBundle: certFile, clientCert: certFile, clientKey: keyFile, tlsMinVersion: "1.3"}, want: 2},
+		{desc: "proxy without host", settings: networkSettings{proxy: "proxy.example.com"}, wantErr: true},
+		{desc: "unsupported proxy scheme", settings: networkSettings{proxy: "ftp://proxy.example.com"}, wantErr: true},
+		{desc: "client certificate without key", settings: networkSettings{clientCert: certFile}, wantErr: true},
+		{desc: "invalid client certificate", settings: networkSettings{clientCert: keyFile, clientKey: keyFile}, wantErr: true},
+		{desc: "unknown TLS version", settings: networkSettings{tlsMinVersion: "1.1"}, wantErr: true},
+		{desc: "missing CA bundle", settings: networkSettings{caBundle: filepath.Join(t.TempDir(), "missing.pem")}, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := tC.settings.configOptions()
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if len(got) != tC.want {
+				t.Errorf("Expected %d options; got %d", tC.want, len(got))
+			}
+		})
+	}
+}
+
+func Test_networkSettings_httpClient(t *testing.T) {
+	certFile, keyFile := writeClientCertificate(t)
+
+	testCases := []struct {
+		desc       string
+		settings   networkSettings
+		wantProxy  string
+		wantCerts  int
+		wantMinTLS uint16
+		wantErr    bool
+	}{
+		{desc: "none"},
+		{desc: "proxy", settings: networkSettings{proxy: "http://proxy.example.com:3128"}, wantProxy: "http://proxy.example.com:3128"},
+		{desc: "client certificate", settings: networkSettings{clientCert: certFile, clientKey: keyFile, tlsMinVersion: "1.3"}, wantCerts: 1, wantMinTLS: tls.VersionTLS13},
+		{desc: "unsupported proxy scheme", settings: networkSettings{proxy: "ftp://proxy.example.com"}, wantErr: true},
+		{desc: "missing CA bundle", settings: networkSettings{caBundle: filepath.Join(t.TempDir(), "missing.pem")}, wantErr: true},
+		{desc: "CA bundle without certificates", settings: networkSettings{caBundle: keyFile}, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client, err := tC.settings.httpClient(time.Second)
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			transport := client.Transport.(*http.Transport)
+			if transport.ResponseHeaderTimeout != time.Second {
+				t.Errorf("Expected a response header timeout of 1s; got %v", transport.ResponseHeaderTimeout)
+			}
+
+			if tC.wantProxy != "" {
+				req, _ := http.NewRequest(http.MethodGet, "https://example.com/app.js", nil)
+				if proxy, err := transport.Proxy(req); err != nil || proxy == nil || proxy.String() != tC.wantProxy {
+					t.Errorf("Expected proxy %q; got %v (error %v)", tC.wantProxy, proxy, err)
+				}
+			}
+
+			var certs int
+			var minTLS uint16
+			if transport.TLSClientConfig != nil {
+				certs, minTLS = len(transport.TLSClientConfig.Certificates), transport.TLSClientConfig.MinVersion
+			}
+
+			if certs != tC.wantCerts || minTLS != tC.wantMinTLS {
+				t.Errorf("Expected %d client certificate(s) and TLS version %x; got %d and %x", tC.wantCerts, tC.wantMinTLS, certs, minTLS)
+			}
+		})
+	}
+}
+
+func Test_networkSettings_httpClient_caBundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	client, err := networkSettings{caBundle: writeCABundle(t, server)}.httpClient(50 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected the server to be trusted; got %v", err)
+	}
+	resp.Body.Close()
+
+	if resp, err := client.Get(server.URL + "/slow"); err == nil {
+		resp.Body.Close()
+		t.Error("Expected a server that doesn't respond in time to fail the request")
+	}
+}
+
+func Test_commonFlags_newClient_network(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_CA_BUNDLE", "")
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(listResponse))
+	})
+
+	tlsServer := httptest.NewUnstartedServer(handler)
+	tlsServer.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+
+	var proxiedHost string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedHost = r.URL.Host
+		w.Write([]byte(listResponse))
+	}))
+	defer proxy.Close()
+
+	caBundle := writeCABundle(t, tlsServer)
+	certFile, keyFile := writeClientCertificate(t)
+
+	testCases := []struct {
+		desc     string
+		endpoint string
+		network  networkSettings
+		wantErr  bool
+	}{
+		{
+			desc:     "mutual TLS with a self-signed certificate",
+			endpoint: tlsServer.URL,
+			network:  networkSettings{caBundle: caBundle, clientCert: certFile, clientKey: keyFile, tlsMinVersion: "1.2"},
+		},
+		{
+			desc:     "untrusted certificate",
+			endpoint: tlsServer.URL,
+			network:  networkSettings{clientCert: certFile, clientKey: keyFile},
+			wantErr:  true,
+		},
+		{
+			desc:     "missing client certificate",
+			endpoint: tlsServer.URL,
+			network:  networkSettings{caBundle: caBundle},
+			wantErr:  true,
+		},
+		{
+			desc:     "proxy",
+			endpoint: "http://minio.internal:9000",
+			network:  networkSettings{proxy: proxy.URL},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			proxiedHost = ""
+			common := commonFlags{region: "us-east-1", endpoint: tC.endpoint, pathStyle: true, network: tC.network}
+
+			client, err := common.newClient(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = client.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{Bucket: aws.String("my-site")}, func(o *s3.Options) {
+				o.RetryMaxAttempts = 1
+			})
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if tC.network.proxy != "" && proxiedHost != "minio.internal:9000" {
+				t.Errorf("Expected the request to go through the proxy; got host %q", proxiedHost)
+			}
+		})
+	}
+}
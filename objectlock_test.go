@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func Test_newObjectLock(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		desc      string
+		mode      string
+		retain    string
+		legalHold bool
+		want      objectLock
+		wantErr   bool
+	}{
+		{desc: "not given"},
+		{desc: "legal hold", legalHold: true, want: objectLock{legalHold: true}},
+		{
+			desc:   "days",
+			mode:   "compliance",
+			retain: "90d",
+			want:   objectLock{mode: types.ObjectLockModeCompliance, retainUntil: time.Date(2027, 1, 14, 12, 0, 0, 0, time.UTC)},
+		},
+		{
+			desc:   "duration",
+			mode:   "GOVERNANCE",
+			retain: "36h",
+			want:   objectLock{mode: types.ObjectLockModeGovernance, retainUntil: time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			desc:   "date",
+			mode:   "GOVERNANCE",
+			retain: "2030-01-01",
+			want:   objectLock{mode: types.ObjectLockModeGovernance, retainUntil: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{desc: "past date", mode: "GOVERNANCE", retain: "2020-01-01", wantErr: true},
+		{desc: "unknown mode", mode: "WORM", retain: "90d", wantErr: true},
+		{desc: "invalid period", mode: "GOVERNANCE", retain: "forever", wantErr: true},
+		{desc: "mode without period", mode: "GOVERNANCE", wantErr: true},
+		{desc: "period without mode", retain: "90d", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := newObjectLock(tC.mode, tC.retain, tC.legalHold, now)
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if got != tC.want {
+				t.Errorf("Expected %+v; got %+v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_objectLock_apply(t *testing.T) {
+	until := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		desc         string
+		lock         objectLock
+		checksum     types.ChecksumAlgorithm
+		wantMode     types.ObjectLockMode
+		wantHold     types.ObjectLockLegalHoldStatus
+		wantChecksum types.ChecksumAlgorithm
+	}{
+		{desc: "not enabled"},
+		{
+			desc:         "retention",
+			lock:         objectLock{mode: types.ObjectLockModeCompliance, retainUntil: until},
+			wantMode:     types.ObjectLockModeCompliance,
+			wantChecksum: types.ChecksumAlgorithmCrc32,
+		},
+		{
+			desc:         "legal hold with checksum",
+			lock:         objectLock{legalHold: true},
+			checksum:     types.ChecksumAlgorithmSha256,
+			wantHold:     types.ObjectLockLegalHoldStatusOn,
+			wantChecksum: types.ChecksumAlgorithmSha256,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			input := &s3.PutObjectInput{ChecksumAlgorithm: tC.checksum}
+			tC.lock.apply(input)
+
+			if input.ObjectLockMode != tC.wantMode {
+				t.Errorf("Expected mode %q; got %q", tC.wantMode, input.ObjectLockMode)
+			}
+
+			if tC.wantMode != "" && !aws.ToTime(input.ObjectLockRetainUntilDate).Equal(until) {
+				t.Errorf("Expected retention until %v; got %v", until, aws.ToTime(input.ObjectLockRetainUntilDate))
+			}
+
+			if input.ObjectLockLegalHoldStatus != tC.wantHold {
+				t.Errorf("Expected legal hold %q; got %q", tC.wantHold, input.ObjectLockLegalHoldStatus)
+			}
+
+			if input.ChecksumAlgorithm != tC.wantChecksum {
+				t.Errorf("Expected checksum %q; got %q", tC.wantChecksum, input.ChecksumAlgorithm)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// uploadOrder holds back the files that should be uploaded last, such as HTML pages, until every
+// other file has been uploaded. This way a new page never references assets that aren't in the
+// bucket yet.
+type uploadOrder struct {
+	patterns []string
+}
+
+// newUploadOrder creates the ordering rules for files matching any of the given glob patterns.
+// Each pattern may be a comma-separated list. If no patterns are given, nil is returned and files
+// are uploaded in the order they are walked.
+func newUploadOrder(patterns []string) (*uploadOrder, error) {
+	split := splitPatterns(patterns)
+	if len(split) == 0 {
+		return nil, nil
+	}
+
+	if _, err := newPathFilter(split, nil); err != nil {
+		return nil, fmt.Errorf("invalid upload-last pattern: %v", err)
+	}
+
+	return &uploadOrder{patterns: split}, nil
+}
+
+// Last reports whether the file at the given path should be uploaded last. It is safe to call on
+// nil ordering rules.
+func (o *uploadOrder) Last(name string) bool {
+	return o != nil && matchAny(o.patterns, filepath.ToSlash(name))
+}
+
+// Walker returns a tree walker that first visits every file that isn't uploaded last, then calls
+// `flush` to wait for those uploads to finish, and then visits the files held back, in the order
+// they were found. If `flush` fails, the held back files aren't visited.
+func (o *uploadOrder) Walker(walkFiles treeWalker, flush func() error) treeWalker {
+	if o == nil {
+		return walkFiles
+	}
+
+	return func(walk fs.WalkDirFunc) error {
+		type heldFile struct {
+			path  string
+			entry fs.DirEntry
+		}
+
+		var held []heldFile
+		err := walkFiles(func(path string, entry fs.DirEntry, err error) error {
+			if err == nil && !entry.IsDir() && o.Last(path) {
+				held = append(held, heldFile{path: path, entry: entry})
+				return nil
+			}
+
+			return walk(path, entry, err)
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(held) == 0 {
+			return nil
+		}
+
+		if err := flush(); err != nil {
+			return err
+		}
+
+		for _, file := range held {
+			err := walk(file.path, file.entry, nil)
+			if errors.Is(err, fs.SkipAll) {
+				return nil
+			}
+
+			if err != nil && !errors.Is(err, fs.SkipDir) {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io/fs"
+	"reflect"
+	"testing"
+)
+
+func Test_uploadOrder_Walker(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		patterns []string
+		flushErr error
+		want     []string
+		wantErr  bool
+	}{
+		{
+			desc: "no patterns",
+			want: []string{".", "about/index.html", "assets/app.js", "index.html", "style.css"},
+		},
+		{
+			desc:     "HTML last",
+			patterns: []string{"*.html"},
+			want:     []string{".", "assets/app.js", "style.css", "flush", "about/index.html", "index.html"},
+		},
+		{
+			desc:     "comma-separated patterns",
+			patterns: []string{"*.html,*.css"},
+			want:     []string{".", "assets/app.js", "flush", "about/index.html", "index.html", "style.css"},
+		},
+		{
+			desc:     "nothing held back",
+			patterns: []string{"*.xml"},
+			want:     []string{".", "about/index.html", "assets/app.js", "index.html", "style.css"},
+		},
+		{
+			desc:     "failed flush",
+			patterns: []string{"*.html"},
+			flushErr: errUploadAborted,
+			want:     []string{".", "assets/app.js", "style.css", "flush"},
+			wantErr:  true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			order, err := newUploadOrder(tC.patterns)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			walkFiles := func(walk fs.WalkDirFunc) error {
+				if err := walk(".", mockFileInfo{name: ".", mode: fs.ModeDir}, nil); err != nil {
+					return err
+				}
+
+				for _, path := range []string{"about/index.html", "assets/app.js", "index.html", "style.css"} {
+					if err := walk(path, mockFileInfo{name: path}, nil); err != nil {
+						return err
+					}
+				}
+
+				return nil
+			}
+			flush := func() error {
+				got = append(got, "flush")
+				return tC.flushErr
+			}
+
+			err = order.Walker(walkFiles, flush)(func(path string, entry fs.DirEntry, err error) error {
+				got = append(got, path)
+				return err
+			})
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("Expected %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_newUploadOrder_invalidPattern(t *testing.T) {
+	if _, err := newUploadOrder([]string{"[.html"}); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+}
+
+func Test_uploadOrder_Walker_skipAll(t *testing.T) {
+	order, _ := newUploadOrder([]string{"*.html"})
+	walkFiles := func(walk fs.WalkDirFunc) error {
+		for _, path := range []string{"a.html", "b.html"} {
+			if err := walk(path, mockFileInfo{name: path}, nil); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	var got []string
+	err := order.Walker(walkFiles, func() error { return nil })(func(path string, entry fs.DirEntry, err error) error {
+		got = append(got, path)
+		return fs.SkipAll
+	})
+	if err != nil {
+		t.Errorf("Expected no error; got %v", err)
+	}
+
+	if !reflect.DeepEqual(got, []string{"a.html"}) {
+		t.Errorf("Expected the walk to stop after a.html; got %q", got)
+	}
+}
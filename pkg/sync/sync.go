@@ -0,0 +1,257 @@
+// Package sync compares local files with the objects already in a bucket, so that only changed
+// files are uploaded. Files are compared by size first, and then by the ETag S3 would compute
+// for them, including the ETags of objects uploaded in multiple parts.
+//
+// A [Planner] sorts the files of a directory into those to upload, those to skip, and the
+// objects left without a local file:
+//
+//	planner := sync.Planner{FS: os.DirFS("public"), Remote: objects}
+//	plan, err := planner.Plan()
+package sync
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+)
+
+const (
+	// mebibyte is the unit part sizes are inferred in.
+	mebibyte = 1024 * 1024
+	// maxSinglePartSize is the largest object S3 accepts in a single PutObject request.
+	maxSinglePartSize = 5 * 1024 * mebibyte
+)
+
+// RemoteObject describes an object that already exists in the remote location.
+type RemoteObject struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+	StorageClass string
+}
+
+// An Encoder transforms the files it matches before they are uploaded, such as by compressing
+// them. Those files are compared with remote objects in their encoded form.
+type Encoder interface {
+	// Match reports whether the file at the path is encoded.
+	Match(path string) bool
+	// Encode returns the encoded contents of a file.
+	Encode(r io.Reader) (*bytes.Reader, error)
+}
+
+// Unchanged reports whether the local file at `path` has the same contents as an existing remote
+// object. The encoder may be nil if no files are encoded.
+func Unchanged(fsys fs.FS, path string, entry fs.DirEntry, existing RemoteObject, enc Encoder) (bool, error) {
+	info, err := entry.Info()
+	if err != nil {
+		return false, fmt.Errorf("could not stat %s: %v", path, err)
+	}
+
+	encoded := enc != nil && enc.Match(path)
+	if !encoded && info.Size() != existing.Size {
+		return false, nil
+	}
+
+	file, err := fsys.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("could not open %s for reading: %v", path, err)
+	}
+	defer file.Close()
+
+	var body io.Reader = file
+	if encoded {
+		encodedBody, err := enc.Encode(file)
+		if err != nil {
+			return false, fmt.Errorf("could not encode %s: %v", path, err)
+		}
+
+		if encodedBody.Size() != existing.Size {
+			return false, nil
+		}
+
+		body = encodedBody
+	}
+
+	// Objects uploaded in multiple parts have an ETag of the form `<digest>-<part count>`.
+	var partSize int64
+	if strings.Contains(existing.ETag, "-") {
+		partSize = ETagPartSize(existing)
+	}
+
+	etag, err := LocalETag(body, partSize)
+	if err != nil {
+		return false, fmt.Errorf("could not hash %s: %v", path, err)
+	}
+
+	return etag == existing.ETag, nil
+}
+
+// Plan lists what it takes to make the remote objects match a directory, by slash-separated path.
+type Plan struct {
+	// Upload are the files that are new or changed.
+	Upload []string
+	// Skip are the files whose contents the remote objects already have.
+	Skip []string
+	// Delete are the keys of the remote objects without a local file.
+	Delete []string
+}
+
+// Planner compares the files of a filesystem with the objects in the remote location.
+type Planner struct {
+	// FS contains the local files.
+	FS fs.FS
+	// Remote are the existing remote objects, keyed by their path relative to the directory.
+	Remote map[string]RemoteObject
+	// Encoder transforms files before they are uploaded. If nil, files are uploaded unchanged.
+	Encoder Encoder
+}
+
+// Unchanged reports whether the local file at `path` matches its remote object, e.g. to skip it
+// during a walk of its own. Files without a remote object are always changed.
+func (p *Planner) Unchanged(path string, entry fs.DirEntry) (bool, error) {
+	existing, ok := p.Remote[path]
+	if !ok {
+		return false, nil
+	}
+
+	return Unchanged(p.FS, path, entry, existing, p.Encoder)
+}
+
+// Plan walks the filesystem and sorts every file into the files to upload or skip, and lists the
+// remote objects without a local file. Each of the lists of the plan is sorted.
+func (p *Planner) Plan() (Plan, error) {
+	var plan Plan
+	seen := map[string]bool{}
+
+	err := fs.WalkDir(p.FS, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("could not walk %s: %v", path, err)
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		seen[path] = true
+
+		unchanged, err := p.Unchanged(path, entry)
+		if err != nil {
+			return err
+		}
+
+		if unchanged {
+			plan.Skip = append(plan.Skip, path)
+		} else {
+			plan.Upload = append(plan.Upload, path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return Plan{}, err
+	}
+
+	for key := range p.Remote {
+		if !seen[key] {
+			plan.Delete = append(plan.Delete, key)
+		}
+	}
+
+	sort.Strings(plan.Delete)
+
+	return plan, nil
+}
+
+// UploadPartSize returns the part size the S3 upload manager uses for a body of the given size
+// when configured with the given part size.
+func UploadPartSize(size, partSize int64) int64 {
+	if size/partSize >= int64(manager.MaxUploadParts) {
+		partSize = size/int64(manager.MaxUploadParts) + 1
+	}
+
+	return partSize
+}
+
+// ETagPartSize infers the part size a multipart object was uploaded with from the number of parts
+// in its ETag, since it may have been uploaded with a different part size. The SDK's default is
+// tried first, then power-of-two sizes in MiB, and finally the smallest whole number of MiB that
+// results in the same number of parts.
+func ETagPartSize(object RemoteObject) int64 {
+	defaultSize := UploadPartSize(object.Size, manager.DefaultUploadPartSize)
+
+	_, count, _ := strings.Cut(object.ETag, "-")
+	parts, err := strconv.ParseInt(count, 10, 64)
+	if err != nil || parts <= 0 || object.Size <= 0 {
+		return defaultSize
+	}
+
+	partCount := func(partSize int64) int64 {
+		return (object.Size + partSize - 1) / partSize
+	}
+
+	if partCount(defaultSize) == parts {
+		return defaultSize
+	}
+
+	for partSize := int64(8 * mebibyte); partSize <= maxSinglePartSize; partSize *= 2 {
+		if partCount(partSize) == parts {
+			return partSize
+		}
+	}
+
+	partSize := (object.Size + parts - 1) / parts
+	partSize = (partSize + mebibyte - 1) / mebibyte * mebibyte
+	if partSize < manager.MinUploadPartSize || partCount(partSize) != parts {
+		return defaultSize
+	}
+
+	return partSize
+}
+
+// LocalETag computes the ETag S3 would assign to the contents of `r`. A part size of zero
+// produces the single-request ETag, which is the hex-encoded MD5 of the body. Otherwise the
+// multipart ETag is computed: the MD5 of the concatenated part digests, followed by the number of
+// parts.
+func LocalETag(r io.Reader, partSize int64) (string, error) {
+	if partSize <= 0 {
+		hash := md5.New()
+		if _, err := io.Copy(hash, r); err != nil {
+			return "", err
+		}
+
+		return hex.EncodeToString(hash.Sum(nil)), nil
+	}
+
+	var digests []byte
+	var parts int
+	for {
+		hash := md5.New()
+		n, err := io.CopyN(hash, r, partSize)
+		if n > 0 {
+			digests = hash.Sum(digests)
+			parts++
+		}
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	sum := md5.Sum(digests)
+
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), parts), nil
+}
@@ -0,0 +1,137 @@
+package sync
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+)
+
+func TestLocalETag(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		body     string
+		partSize int64
+		want     string
+	}{
+		{
+			desc: "single part",
+			body: "some body",
+			want: "328c30fae61cd119cd177c061d1ac11f",
+		},
+		{
+			desc: "empty body",
+			body: "",
+			want: "d41d8cd98f00b204e9800998ecf8427e",
+		},
+		{
+			desc:     "multiple parts",
+			body:     "some body",
+			partSize: 5,
+			want:     "efd97d455fbdebb038654c32cd534581-2",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := LocalETag(strings.NewReader(tC.body), tC.partSize)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got != tC.want {
+				t.Errorf("Expected ETag %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
+
+func TestETagPartSize(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		object RemoteObject
+		want   int64
+	}{
+		{
+			desc:   "default part size",
+			object: RemoteObject{Size: 12 * mebibyte, ETag: "abc-3"},
+			want:   manager.DefaultUploadPartSize,
+		},
+		{
+			desc:   "power of two part size",
+			object: RemoteObject{Size: 100 * mebibyte, ETag: "abc-2"},
+			want:   64 * mebibyte,
+		},
+		{
+			desc:   "other part size",
+			object: RemoteObject{Size: 60 * mebibyte, ETag: "abc-6"},
+			want:   10 * mebibyte,
+		},
+		{
+			desc:   "malformed ETag",
+			object: RemoteObject{Size: 12 * mebibyte, ETag: "abc-x"},
+			want:   manager.DefaultUploadPartSize,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := ETagPartSize(tC.object); got != tC.want {
+				t.Errorf("Expected part size %d; got %d", tC.want, got)
+			}
+		})
+	}
+}
+
+// upperEncoder encodes Markdown files by upper-casing them.
+type upperEncoder struct{}
+
+func (upperEncoder) Match(path string) bool {
+	return strings.HasSuffix(path, ".md")
+}
+
+func (upperEncoder) Encode(r io.Reader) (*bytes.Reader, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(bytes.ToUpper(body)), nil
+}
+
+func TestPlanner_Plan(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":    {Data: []byte("some body")},
+		"about.html":    {Data: []byte("new body")},
+		"new.html":      {Data: []byte("new file")},
+		"docs/guide.md": {Data: []byte("guide")},
+	}
+
+	// The ETags of the unchanged files are the MD5 digests of their encoded contents.
+	planner := Planner{
+		FS: fsys,
+		Remote: map[string]RemoteObject{
+			"index.html":    {Key: "index.html", Size: 9, ETag: "328c30fae61cd119cd177c061d1ac11f"},
+			"about.html":    {Key: "about.html", Size: 8, ETag: "328c30fae61cd119cd177c061d1ac11f"},
+			"docs/guide.md": {Key: "docs/guide.md", Size: 5, ETag: "f274482b2446515d9a691ced6e29853f"},
+			"old.html":      {Key: "old.html", Size: 3, ETag: "abc"},
+		},
+		Encoder: upperEncoder{},
+	}
+
+	got, err := planner.Plan()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := Plan{
+		Upload: []string{"about.html", "new.html"},
+		Skip:   []string{"docs/guide.md", "index.html"},
+		Delete: []string{"old.html"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected plan %+v; got %+v", want, got)
+	}
+}
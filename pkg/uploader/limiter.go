@@ -0,0 +1,122 @@
+package uploader
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// DefaultCooldown is the default minimum time between two reductions of the concurrency limit, so
+// that a burst of throttled requests from uploads that were already in flight only counts once.
+const DefaultCooldown = 5 * time.Second
+
+// Limiter adapts the number of uploads in flight to throttling by the storage backend, like TCP
+// congestion control: the limit is halved whenever uploads are throttled, and raised by one again
+// after a full limit's worth of uploads succeed without being throttled.
+type Limiter struct {
+	// Cooldown is the minimum time between two reductions of the limit.
+	Cooldown time.Duration
+
+	// max is the limit uploads start with, and that it never exceeds.
+	max int
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+	// successes counts the uploads that succeeded since the limit last changed.
+	successes    int
+	lastDecrease time.Time
+}
+
+// NewLimiter creates a limiter that starts out allowing `max` uploads at a time.
+func NewLimiter(max int) *Limiter {
+	if max < 1 {
+		max = 1
+	}
+
+	l := &Limiter{max: max, limit: max, Cooldown: DefaultCooldown}
+	l.cond = sync.NewCond(&l.mu)
+
+	return l
+}
+
+// Acquire waits until fewer uploads than the limit are in flight, and reserves a slot for one
+// more. It returns false without reserving a slot if the context is cancelled first.
+func (l *Limiter) Acquire(ctx context.Context) bool {
+	stop := context.AfterFunc(ctx, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.cond.Broadcast()
+	})
+	defer stop()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for l.active >= l.limit {
+		if ctx.Err() != nil {
+			return false
+		}
+
+		l.cond.Wait()
+	}
+
+	if ctx.Err() != nil {
+		return false
+	}
+
+	l.active++
+
+	return true
+}
+
+// Release frees the slot of an upload that finished, recording whether it succeeded.
+func (l *Limiter) Release(succeeded bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.active--
+
+	if succeeded {
+		l.successes++
+		if l.successes >= l.limit && l.limit < l.max {
+			l.limit++
+			l.successes = 0
+		}
+	}
+
+	l.cond.Broadcast()
+}
+
+// Throttled halves the limit after the backend asked for uploads to slow down.
+func (l *Limiter) Throttled() {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastDecrease) < l.Cooldown {
+		return
+	}
+
+	l.lastDecrease = now
+	l.successes = 0
+
+	if l.limit > 1 {
+		l.limit /= 2
+		log.Printf("Throttled by the storage backend; reducing concurrency to %d\n", l.limit)
+	}
+}
+
+// Limit returns the current concurrency limit.
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.limit
+}
@@ -0,0 +1,91 @@
+package uploader
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	limiter := NewLimiter(8)
+	limiter.Cooldown = 0
+
+	limiter.Throttled()
+	if got := limiter.Limit(); got != 4 {
+		t.Fatalf("Expected the limit to be halved to 4; got %d", got)
+	}
+
+	limiter.Throttled()
+	limiter.Throttled()
+	limiter.Throttled()
+	if got := limiter.Limit(); got != 1 {
+		t.Fatalf("Expected the limit to bottom out at 1; got %d", got)
+	}
+
+	// Each increase requires a full limit's worth of successful uploads.
+	for _, want := range []int{2, 3, 4} {
+		for i := 0; i < want-1; i++ {
+			if !limiter.Acquire(context.Background()) {
+				t.Fatal("Expected a slot to be available")
+			}
+
+			limiter.Release(true)
+		}
+
+		if got := limiter.Limit(); got != want {
+			t.Errorf("Expected the limit to increase to %d; got %d", want, got)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		limiter.Acquire(context.Background())
+		limiter.Release(true)
+	}
+
+	if got := limiter.Limit(); got != 8 {
+		t.Errorf("Expected the limit not to exceed the maximum of 8; got %d", got)
+	}
+}
+
+func TestLimiter_cooldown(t *testing.T) {
+	limiter := NewLimiter(8)
+
+	limiter.Throttled()
+	limiter.Throttled()
+	if got := limiter.Limit(); got != 4 {
+		t.Errorf("Expected throttling within the cooldown to count once; got limit %d", got)
+	}
+}
+
+func TestLimiter_Acquire(t *testing.T) {
+	limiter := NewLimiter(1)
+	if !limiter.Acquire(context.Background()) {
+		t.Fatal("Expected a slot to be available")
+	}
+
+	acquired := make(chan bool)
+	go func() {
+		acquired <- limiter.Acquire(context.Background())
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Expected Acquire to wait while the limit is reached")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	limiter.Release(true)
+	if !<-acquired {
+		t.Error("Expected the slot to be acquired once released")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		acquired <- limiter.Acquire(ctx)
+	}()
+
+	cancel()
+	if <-acquired {
+		t.Error("Expected Acquire to give up when the context is cancelled")
+	}
+}
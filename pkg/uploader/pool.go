@@ -0,0 +1,216 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrAborted is returned to the directory walk once a worker has failed, so that no more files
+// are queued for upload.
+var ErrAborted = errors.New("upload aborted after a previous failure")
+
+// Failure is a file that could not be uploaded.
+type Failure struct {
+	Path string
+	Err  error
+}
+
+func (f Failure) Error() string {
+	return f.Err.Error()
+}
+
+func (f Failure) Unwrap() error {
+	return f.Err
+}
+
+// Errors aggregates the failures from every worker in an upload pool.
+type Errors []Failure
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, failure := range e {
+		messages[i] = failure.Error()
+	}
+
+	return fmt.Sprintf("%d upload(s) failed:\n\t%s", len(e), strings.Join(messages, "\n\t"))
+}
+
+// queuedFile is a single file queued for upload.
+type queuedFile struct {
+	path  string
+	entry fs.DirEntry
+}
+
+// Pool distributes files found during a directory walk across a fixed number of upload
+// workers.
+type Pool struct {
+	// ctx stops the pool from accepting or starting uploads once it is cancelled.
+	ctx context.Context
+	// upload is the callback each worker invokes for a queued file.
+	upload fs.WalkDirFunc
+	// jobs feeds queued files to the workers.
+	jobs chan queuedFile
+	// failed is closed as soon as any upload fails, unless continueOnError is set.
+	failed chan struct{}
+	// continueOnError keeps the pool uploading files after a failure.
+	continueOnError bool
+	// limiter caps the number of workers uploading at the same time.
+	limiter *Limiter
+
+	// completed counts the files that were processed successfully.
+	completed int64
+
+	wg sync.WaitGroup
+	// pending counts the queued files that haven't been processed yet.
+	pending  sync.WaitGroup
+	failOnce sync.Once
+	mu       sync.Mutex
+	errs     Errors
+}
+
+// NewPool starts a pool of `concurrency` workers, each of which uploads files using the
+// provided callback until the context is cancelled. Unless `continueOnError` is set, the pool
+// stops accepting files after the first failed upload.
+func NewPool(ctx context.Context, concurrency int, continueOnError bool, upload fs.WalkDirFunc) *Pool {
+	return NewLimitedPool(ctx, NewLimiter(concurrency), continueOnError, upload)
+}
+
+// NewLimitedPool starts a pool with a worker for each slot of the limiter. Workers wait for
+// the limiter before each upload, so that fewer files are uploaded at a time while the limit is
+// reduced.
+func NewLimitedPool(ctx context.Context, limiter *Limiter, continueOnError bool, upload fs.WalkDirFunc) *Pool {
+	p := &Pool{
+		ctx:             ctx,
+		upload:          upload,
+		jobs:            make(chan queuedFile),
+		failed:          make(chan struct{}),
+		continueOnError: continueOnError,
+		limiter:         limiter,
+	}
+
+	p.wg.Add(limiter.max)
+	for i := 0; i < limiter.max; i++ {
+		go p.work()
+	}
+
+	return p
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+
+	for job := range p.jobs {
+		p.process(job)
+		p.pending.Done()
+	}
+}
+
+func (p *Pool) process(job queuedFile) {
+	// Drain the remaining jobs without uploading them once the pool has failed or been cancelled.
+	select {
+	case <-p.failed:
+		return
+	case <-p.ctx.Done():
+		return
+	default:
+	}
+
+	if !p.limiter.Acquire(p.ctx) {
+		return
+	}
+
+	err := p.upload(job.path, job.entry, nil)
+	p.limiter.Release(err == nil)
+	if err != nil {
+		p.fail(job.path, err)
+		return
+	}
+
+	atomic.AddInt64(&p.completed, 1)
+}
+
+func (p *Pool) fail(path string, err error) {
+	p.mu.Lock()
+	p.errs = append(p.errs, Failure{Path: path, Err: err})
+	p.mu.Unlock()
+
+	if !p.continueOnError {
+		p.failOnce.Do(func() { close(p.failed) })
+	}
+}
+
+// WalkDirFunc returns a callback for `filepath.WalkDir` that queues files for upload by the pool.
+func (p *Pool) WalkDirFunc() fs.WalkDirFunc {
+	return func(path string, entry fs.DirEntry, err error) error {
+		// Walk errors and directories are handled inline since they don't require any network
+		// access and may need to stop the walk.
+		if err != nil || entry.IsDir() {
+			return p.upload(path, entry, err)
+		}
+
+		// Check for failure first so that a failed pool is never handed more work, even if a
+		// worker happens to be waiting for a job.
+		select {
+		case <-p.failed:
+			return ErrAborted
+		case <-p.ctx.Done():
+			return p.ctx.Err()
+		default:
+		}
+
+		p.pending.Add(1)
+		select {
+		case <-p.failed:
+			p.pending.Done()
+			return ErrAborted
+		case <-p.ctx.Done():
+			p.pending.Done()
+			return p.ctx.Err()
+		case p.jobs <- queuedFile{path: path, entry: entry}:
+			return nil
+		}
+	}
+}
+
+// Flush waits until every file queued so far has been processed, without closing the pool. It
+// returns an error if any upload failed, even when the pool continues on errors, or if the pool
+// was cancelled.
+func (p *Pool) Flush() error {
+	p.pending.Wait()
+
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.errs) > 0 {
+		return ErrAborted
+	}
+
+	return nil
+}
+
+// Completed returns the number of files that have been processed successfully so far.
+func (p *Pool) Completed() int {
+	return int(atomic.LoadInt64(&p.completed))
+}
+
+// Wait stops accepting new files, waits for in-flight uploads to complete, and returns the
+// errors from every failed upload.
+func (p *Pool) Wait() error {
+	close(p.jobs)
+	p.wg.Wait()
+
+	if len(p.errs) > 0 {
+		return p.errs
+	}
+
+	return nil
+}
@@ -0,0 +1,252 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingUploadFunc returns a concurrency-safe upload callback that records the paths it
+// receives, failing for any path present in `failures`.
+func recordingUploadFunc(failures map[string]error) (fs.WalkDirFunc, func() []string) {
+	var mu sync.Mutex
+	var uploaded []string
+
+	upload := func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		if failure, ok := failures[path]; ok {
+			return failure
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		uploaded = append(uploaded, path)
+
+		return nil
+	}
+
+	paths := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		sorted := append([]string{}, uploaded...)
+		sort.Strings(sorted)
+
+		return sorted
+	}
+
+	return upload, paths
+}
+
+func TestPool(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		concurrency int
+		paths       []string
+		failures    map[string]error
+		want        []string
+		wantErr     bool
+	}{
+		{
+			desc:        "uploads every file",
+			concurrency: 3,
+			paths:       []string{"a.txt", "b.txt", "c/d.txt", "e.txt"},
+			want:        []string{"a.txt", "b.txt", "c/d.txt", "e.txt"},
+		},
+		{
+			desc:        "invalid concurrency uses single worker",
+			concurrency: 0,
+			paths:       []string{"a.txt", "b.txt"},
+			want:        []string{"a.txt", "b.txt"},
+		},
+		{
+			desc:        "failure is reported",
+			concurrency: 1,
+			paths:       []string{"a.txt"},
+			failures:    map[string]error{"a.txt": errors.New("boom")},
+			want:        []string{},
+			wantErr:     true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			upload, uploaded := recordingUploadFunc(tC.failures)
+			pool := NewPool(context.Background(), tC.concurrency, false, upload)
+			walk := pool.WalkDirFunc()
+
+			for _, path := range tC.paths {
+				if err := walk(path, mockFileInfo{name: path}, nil); err != nil {
+					break
+				}
+			}
+
+			err := pool.Wait()
+			if (err == nil) == tC.wantErr {
+				t.Errorf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			got := uploaded()
+			if len(got) != len(tC.want) {
+				t.Fatalf("Expected uploads %v; got %v", tC.want, got)
+			}
+
+			for i := range got {
+				if got[i] != tC.want[i] {
+					t.Errorf("Expected uploads %v; got %v", tC.want, got)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestPool_stopsAfterFailure(t *testing.T) {
+	upload, _ := recordingUploadFunc(map[string]error{"a.txt": errors.New("boom")})
+	pool := NewPool(context.Background(), 1, false, upload)
+	walk := pool.WalkDirFunc()
+
+	if err := walk("a.txt", mockFileInfo{name: "a.txt"}, nil); err != nil {
+		t.Fatalf("Expected first file to be queued; got %v", err)
+	}
+
+	// The failed upload closes the pool asynchronously, so keep queuing until the pool refuses.
+	var err error
+	for i := 0; i < 1000 && err == nil; i++ {
+		err = walk("b.txt", mockFileInfo{name: "b.txt"}, nil)
+	}
+
+	if err != ErrAborted {
+		t.Errorf("Expected walk to be aborted; got %v", err)
+	}
+
+	var errs Errors
+	if !errors.As(pool.Wait(), &errs) || len(errs) != 1 {
+		t.Errorf("Expected a single upload error; got %v", errs)
+	}
+}
+
+func TestPool_walkError(t *testing.T) {
+	upload, _ := recordingUploadFunc(nil)
+	pool := NewPool(context.Background(), 2, false, upload)
+
+	walkErr := errors.New("permission denied")
+	if err := pool.WalkDirFunc()("foo", nil, walkErr); err != walkErr {
+		t.Errorf("Expected walk error %v; got %v", walkErr, err)
+	}
+
+	if err := pool.Wait(); err != nil {
+		t.Errorf("Expected no upload errors; got %v", err)
+	}
+}
+
+func TestPool_cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	upload, uploaded := recordingUploadFunc(nil)
+	pool := NewPool(ctx, 2, false, upload)
+	walk := pool.WalkDirFunc()
+
+	if err := walk("a.txt", mockFileInfo{name: "a.txt"}, nil); err != nil {
+		t.Fatalf("Expected first file to be queued; got %v", err)
+	}
+
+	cancel()
+
+	if err := walk("b.txt", mockFileInfo{name: "b.txt"}, nil); err != context.Canceled {
+		t.Errorf("Expected walk to be cancelled; got %v", err)
+	}
+
+	if err := pool.Wait(); err != nil {
+		t.Errorf("Expected no upload errors; got %v", err)
+	}
+
+	for _, path := range uploaded() {
+		if path == "b.txt" {
+			t.Error("Expected no uploads to be queued after cancellation")
+		}
+	}
+
+	if pool.Completed() != len(uploaded()) {
+		t.Errorf("Expected %d completed uploads; got %d", len(uploaded()), pool.Completed())
+	}
+}
+
+func TestPool_continueOnError(t *testing.T) {
+	upload, uploaded := recordingUploadFunc(map[string]error{
+		"a.txt": errors.New("boom"),
+		"c.txt": errors.New("bang"),
+	})
+	pool := NewPool(context.Background(), 1, true, upload)
+	walk := pool.WalkDirFunc()
+
+	for _, path := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		if err := walk(path, mockFileInfo{name: path}, nil); err != nil {
+			t.Fatalf("Expected %s to be queued; got %v", path, err)
+		}
+	}
+
+	var errs Errors
+	if !errors.As(pool.Wait(), &errs) || len(errs) != 2 {
+		t.Fatalf("Expected two upload errors; got %v", errs)
+	}
+
+	if errs[0].Path != "a.txt" || errs[1].Path != "c.txt" {
+		t.Errorf("Expected failures for a.txt and c.txt; got %s and %s", errs[0].Path, errs[1].Path)
+	}
+
+	if got := strings.Join(uploaded(), ","); got != "b.txt,d.txt" {
+		t.Errorf("Expected uploads of b.txt and d.txt; got %s", got)
+	}
+
+	if pool.Completed() != 2 {
+		t.Errorf("Expected 2 completed uploads; got %d", pool.Completed())
+	}
+}
+
+func TestPool_Flush(t *testing.T) {
+	release := make(chan struct{})
+	upload, uploaded := recordingUploadFunc(map[string]error{"c.txt": errors.New("boom")})
+	pool := NewPool(context.Background(), 2, true, func(path string, entry fs.DirEntry, err error) error {
+		<-release
+		return upload(path, entry, err)
+	})
+	walk := pool.WalkDirFunc()
+
+	for _, path := range []string{"a.txt", "b.txt"} {
+		if err := walk(path, mockFileInfo{name: path}, nil); err != nil {
+			t.Fatalf("Expected %s to be queued; got %v", path, err)
+		}
+	}
+
+	close(release)
+	if err := pool.Flush(); err != nil {
+		t.Fatalf("Expected no error; got %v", err)
+	}
+
+	if got := strings.Join(uploaded(), ","); got != "a.txt,b.txt" {
+		t.Errorf("Expected every queued file to be uploaded after a flush; got %s", got)
+	}
+
+	if err := walk("c.txt", mockFileInfo{name: "c.txt"}, nil); err != nil {
+		t.Fatalf("Expected c.txt to be queued; got %v", err)
+	}
+
+	if err := pool.Flush(); err != ErrAborted {
+		t.Errorf("Expected a flush after a failure to abort; got %v", err)
+	}
+
+	var errs Errors
+	if !errors.As(pool.Wait(), &errs) || len(errs) != 1 {
+		t.Errorf("Expected a single upload error; got %v", errs)
+	}
+}
@@ -0,0 +1,79 @@
+package uploader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// metadataHeaderPrefix is the prefix of the headers that set user metadata.
+const metadataHeaderPrefix = "X-Amz-Meta-"
+
+// S3 uploads files to an S3 bucket, splitting large files into multiple parts.
+type S3 struct {
+	base   *manager.Uploader
+	bucket string
+
+	// Prefix is prepended to the path of every object to form its key.
+	Prefix string
+	// ACL is the canned ACL applied to every object. If empty, no ACL is sent.
+	ACL types.ObjectCannedACL
+	// Metadata is the user metadata stored with every object.
+	Metadata map[string]string
+}
+
+// NewS3 creates an uploader for the bucket, which sends requests with the given client.
+func NewS3(client manager.UploadAPIClient, bucket string) *S3 {
+	return &S3{base: manager.NewUploader(client), bucket: bucket}
+}
+
+// Upload stores the object in the bucket. Of the object's headers, the standard content headers,
+// such as Cache-Control, and user metadata are supported.
+func (s *S3) Upload(ctx context.Context, object *Object) error {
+	input := &s3.PutObjectInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(s.Prefix + object.Path),
+		Body:     object.Body,
+		ACL:      s.ACL,
+		Metadata: map[string]string{},
+	}
+
+	if object.ContentType != "" {
+		input.ContentType = aws.String(object.ContentType)
+	}
+
+	for key, value := range s.Metadata {
+		input.Metadata[key] = value
+	}
+
+	for name, value := range object.Headers {
+		switch name = http.CanonicalHeaderKey(name); {
+		case name == "Cache-Control":
+			input.CacheControl = aws.String(value)
+		case name == "Content-Disposition":
+			input.ContentDisposition = aws.String(value)
+		case name == "Content-Encoding":
+			input.ContentEncoding = aws.String(value)
+		case name == "Content-Language":
+			input.ContentLanguage = aws.String(value)
+		case name == "Content-Type":
+			input.ContentType = aws.String(value)
+		case strings.HasPrefix(name, metadataHeaderPrefix):
+			input.Metadata[strings.ToLower(strings.TrimPrefix(name, metadataHeaderPrefix))] = value
+		default:
+			return fmt.Errorf("unsupported header %s", name)
+		}
+	}
+
+	if _, err := s.base.Upload(ctx, input); err != nil {
+		return fmt.Errorf("failed to upload to S3: %w", err)
+	}
+
+	return nil
+}
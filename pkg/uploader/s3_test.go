@@ -0,0 +1,109 @@
+package uploader
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// putRecorder records the single-part uploads sent to it. Small bodies never need the multipart
+// operations, which are left unimplemented.
+type putRecorder struct {
+	manager.UploadAPIClient
+	inputs []*s3.PutObjectInput
+}
+
+func (c *putRecorder) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	c.inputs = append(c.inputs, params)
+
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestS3_Upload(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		headers      map[string]string
+		wantCache    string
+		wantType     string
+		wantMetadata map[string]string
+		wantErr      bool
+	}{
+		{
+			desc:         "no headers",
+			wantType:     "text/html; charset=utf-8",
+			wantMetadata: map[string]string{"deploy": "42"},
+		},
+		{
+			desc:         "content headers",
+			headers:      map[string]string{"cache-control": "no-cache", "Content-Type": "text/plain"},
+			wantCache:    "no-cache",
+			wantType:     "text/plain",
+			wantMetadata: map[string]string{"deploy": "42"},
+		},
+		{
+			desc:         "metadata",
+			headers:      map[string]string{"X-Amz-Meta-Author": "docs"},
+			wantType:     "text/html; charset=utf-8",
+			wantMetadata: map[string]string{"deploy": "42", "author": "docs"},
+		},
+		{
+			desc:    "unsupported header",
+			headers: map[string]string{"X-Amz-Tagging": "ttl=7d"},
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &putRecorder{}
+			up := NewS3(client, "my-site")
+			up.Prefix = "site/"
+			up.ACL = types.ObjectCannedACLPublicRead
+			up.Metadata = map[string]string{"deploy": "42"}
+
+			err := up.Upload(context.Background(), &Object{
+				Path:        "index.html",
+				Body:        strings.NewReader("<html></html>"),
+				ContentType: "text/html; charset=utf-8",
+				Headers:     tC.headers,
+			})
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if tC.wantErr {
+				if len(client.inputs) > 0 {
+					t.Errorf("Expected nothing to be uploaded; got %d request(s)", len(client.inputs))
+				}
+
+				return
+			}
+
+			input := client.inputs[0]
+			if key := aws.ToString(input.Key); key != "site/index.html" {
+				t.Errorf("Expected key site/index.html; got %s", key)
+			}
+
+			if input.ACL != types.ObjectCannedACLPublicRead {
+				t.Errorf("Expected ACL %q; got %q", types.ObjectCannedACLPublicRead, input.ACL)
+			}
+
+			if got := aws.ToString(input.CacheControl); got != tC.wantCache {
+				t.Errorf("Expected Cache-Control %q; got %q", tC.wantCache, got)
+			}
+
+			if got := aws.ToString(input.ContentType); got != tC.wantType {
+				t.Errorf("Expected Content-Type %q; got %q", tC.wantType, got)
+			}
+
+			if !reflect.DeepEqual(input.Metadata, tC.wantMetadata) {
+				t.Errorf("Expected metadata %v; got %v", tC.wantMetadata, input.Metadata)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Package uploader walks a filesystem and uploads its files through a pool of workers, which is
+// how s3-copy deploys a directory. Programs embedding it provide an [Uploader] for their storage
+// backend, or use the [S3] uploader, and call [UploadDir]:
+//
+//	up := uploader.NewS3(s3.NewFromConfig(cfg), "my-site")
+//	up.Prefix = "site/"
+//	count, err := uploader.UploadDir(ctx, os.DirFS("public"), up, uploader.Options{Concurrency: 8})
+//
+// For finer control, [NewWalkFunc] and [Pool] can be combined with a walk of their own, e.g. to
+// skip unchanged files with the planner of package sync.
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"path/filepath"
+)
+
+// Object contains information about a file to upload.
+type Object struct {
+	Path        string
+	Body        io.Reader
+	ContentType string
+	// Headers contains additional HTTP headers to store with the object, keyed by their
+	// canonical name.
+	Headers map[string]string
+}
+
+// An Uploader allows for uploading a file to a remote location.
+type Uploader interface {
+	// Upload stores the provided information in the remote location.
+	Upload(context.Context, *Object) error
+}
+
+// NewWalkFunc creates a callback for `filepath.WalkDir` that uploads files from the given
+// filesystem using a specific upload client. Uploads are cancelled along with the context.
+func NewWalkFunc(ctx context.Context, fsys fs.FS, client Uploader) fs.WalkDirFunc {
+	return func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("could not walk %s: %v", path, err)
+		}
+
+		// S3 does not have the concept of directories. Objects are stored under keys, which may
+		// happen to look like directory-based file paths. Because of this, we don't have to handle
+		// directories.
+		if entry.IsDir() {
+			log.Printf("Found directory: %s\n", path)
+			return nil
+		}
+
+		extension := filepath.Ext(path)
+		contentType := mime.TypeByExtension(extension)
+
+		file, err := fsys.Open(path)
+		if err != nil {
+			return fmt.Errorf("could not open %s for reading: %v", path, err)
+		}
+		defer file.Close()
+
+		err = client.Upload(ctx, &Object{
+			Path:        path,
+			Body:        file,
+			ContentType: contentType,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to upload %s: %w", path, err)
+		}
+
+		return nil
+	}
+}
+
+// Options configure [UploadDir].
+type Options struct {
+	// Concurrency is the number of files uploaded in parallel. Values below one upload a single
+	// file at a time.
+	Concurrency int
+	// ContinueOnError keeps uploading the remaining files after an upload failed, so that the
+	// returned [Errors] list every failure.
+	ContinueOnError bool
+	// Filter selects the files to upload by their slash-separated path. If nil, every file is
+	// uploaded.
+	Filter func(path string) bool
+}
+
+// UploadDir uploads every file of the filesystem, returning the number of files uploaded. If any
+// upload fails, the error is an [Errors] listing the failures.
+func UploadDir(ctx context.Context, fsys fs.FS, client Uploader, options Options) (int, error) {
+	pool := NewPool(ctx, options.Concurrency, options.ContinueOnError, NewWalkFunc(ctx, fsys, client))
+
+	walk := pool.WalkDirFunc()
+	walkErr := fs.WalkDir(fsys, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() && options.Filter != nil && !options.Filter(path) {
+			return nil
+		}
+
+		return walk(path, entry, err)
+	})
+
+	poolErr := pool.Wait()
+	if err := ctx.Err(); err != nil {
+		return pool.Completed(), err
+	}
+
+	if poolErr != nil {
+		return pool.Completed(), poolErr
+	}
+
+	if walkErr != nil && !errors.Is(walkErr, ErrAborted) {
+		return pool.Completed(), walkErr
+	}
+
+	return pool.Completed(), nil
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"sync"
+)
+
+// planAction is what a run does with a file or remote object.
+type planAction string
+
+const (
+	// actionPut uploads a file.
+	actionPut planAction = "put"
+	// actionSkip leaves the object of an unchanged file as it is.
+	actionSkip planAction = "skip"
+	// actionDelete deletes a remote object.
+	actionDelete planAction = "delete"
+)
+
+// Reasons for the actions of a plan.
+const (
+	reasonNew          = "new"
+	reasonChanged      = "changed"
+	reasonNotCompared  = "not compared"
+	reasonVariant      = "missing Brotli variant"
+	reasonAlias        = "missing website alias"
+	reasonRedirect     = "redirect"
+	reasonUnchanged    = "unchanged"
+	reasonStale        = "stale"
+	reasonDeletedInGit = "deleted since commit"
+)
+
+// planStep is a single action of a plan, along with the reason it was chosen.
+type planStep struct {
+	Action planAction `json:"action"`
+	Path   string     `json:"path"`
+	Size   int64      `json:"size"`
+	Reason string     `json:"reason"`
+
+	// entry is the file of a step that puts or skips one.
+	entry fs.DirEntry
+}
+
+// runPlan lists every action of a run. It is built by walking the files before anything is
+// uploaded, so that it can be reviewed, exported, or checked against limits, and then applied.
+// Runs that don't need the whole plan up front stream it instead, applying each file as soon as
+// it was planned.
+type runPlan struct {
+	mu    sync.Mutex
+	steps []planStep
+	// actions are the actions of the files of the plan, by path.
+	actions map[string]planAction
+	// queue receives the files of the plan as they are planned while the plan is streamed.
+	queue chan planStep
+}
+
+// PutFunc returns a callback that plans the upload of each file, for the reason given by
+// `reason`. Walk errors are returned, so that they stop the walk.
+func (p *runPlan) PutFunc(reason func(path string) string) fs.WalkDirFunc {
+	return p.createStepFunc(actionPut, reason)
+}
+
+// SkipFunc returns a callback that plans each file to be skipped because it is unchanged.
+func (p *runPlan) SkipFunc() fs.WalkDirFunc {
+	return p.createStepFunc(actionSkip, func(string) string { return reasonUnchanged })
+}
+
+func (p *runPlan) createStepFunc(action planAction, reason func(path string) string) fs.WalkDirFunc {
+	return func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("could not walk %s: %v", path, err)
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("could not stat %s: %v", path, err)
+		}
+
+		p.add(planStep{Action: action, Path: path, Size: info.Size(), Reason: reason(path), entry: entry})
+
+		return nil
+	}
+}
+
+// Redirect plans the upload of a redirect object.
+func (p *runPlan) Redirect(r redirect) {
+	p.add(planStep{Action: actionPut, Path: r.Key(), Reason: reasonRedirect + " to " + r.To})
+}
+
+// Delete plans the deletion of the remote objects at the given keys.
+func (p *runPlan) Delete(keys []string, remote map[string]remoteObject, reason string) {
+	for _, key := range keys {
+		p.add(planStep{Action: actionDelete, Path: key, Size: remote[key].Size, Reason: reason})
+	}
+}
+
+func (p *runPlan) add(step planStep) {
+	p.mu.Lock()
+	p.steps = append(p.steps, step)
+	if step.entry != nil {
+		if p.actions == nil {
+			p.actions = map[string]planAction{}
+		}
+
+		p.actions[step.Path] = step.Action
+	}
+
+	queue := p.queue
+	p.mu.Unlock()
+
+	// Sending outside the lock lets other files be planned while the queue is full.
+	if queue != nil && step.entry != nil {
+		queue <- step
+	}
+}
+
+// change replaces the action of the step at the given index, and its reason.
+func (p *runPlan) change(i int, action planAction, reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.steps[i].Action = action
+	p.steps[i].Reason = reason
+	p.actions[p.steps[i].Path] = action
+}
+
+// Sort orders the files of the plan by path, since files planned in parallel are added in no
+// particular order. Redirects and deletions keep their order after the files.
+func (p *runPlan) Sort() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sort.SliceStable(p.steps, func(i, j int) bool {
+		a, b := p.steps[i], p.steps[j]
+		if (a.entry == nil) != (b.entry == nil) {
+			return a.entry != nil
+		}
+
+		return a.entry != nil && a.Path < b.Path
+	})
+}
+
+// Keys returns the keys of the steps with the given action, in the order of the plan.
+func (p *runPlan) Keys(action planAction) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var keys []string
+	for _, step := range p.steps {
+		if step.Action == action {
+			keys = append(keys, step.Path)
+		}
+	}
+
+	return keys
+}
+
+// Walker returns a tree walker over the files of the plan, in the order of the plan.
+func (p *runPlan) Walker() treeWalker {
+	return func(walk fs.WalkDirFunc) error {
+		for _, step := range p.steps {
+			if step.entry == nil {
+				continue
+			}
+
+			if err := walk(step.Path, step.entry, nil); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// Stream returns a tree walker that runs `planFiles` in the background, and visits each file as
+// soon as it was planned rather than once every file was, in the order they are planned. Files
+// reach the walk through a queue of `size` files, so that planning waits while the walk is busy
+// and memory stays bounded. Planning is cancelled if the walk fails.
+func (p *runPlan) Stream(ctx context.Context, size int, planFiles func(ctx context.Context) error) treeWalker {
+	return func(walk fs.WalkDirFunc) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		queue := make(chan planStep, size)
+		p.mu.Lock()
+		p.queue = queue
+		p.mu.Unlock()
+
+		planned := make(chan error, 1)
+		go func() {
+			err := planFiles(ctx)
+
+			p.mu.Lock()
+			p.queue = nil
+			p.mu.Unlock()
+
+			close(queue)
+			planned <- err
+		}()
+
+		// The queue is drained after the walk stopped, so that planning never blocks on it.
+		var walkErr error
+		stopped := false
+		for step := range queue {
+			if stopped {
+				continue
+			}
+
+			err := walk(step.Path, step.entry, nil)
+			if err == nil || errors.Is(err, fs.SkipDir) {
+				continue
+			}
+
+			stopped = true
+			cancel()
+			if !errors.Is(err, fs.SkipAll) {
+				walkErr = err
+			}
+		}
+
+		planErr := <-planned
+		if stopped {
+			return walkErr
+		}
+
+		return planErr
+	}
+}
+
+// ApplyFunc returns a callback for the plan's walker that passes the files to put to `put`, and
+// the skipped files to `skip`.
+func (p *runPlan) ApplyFunc(put, skip fs.WalkDirFunc) fs.WalkDirFunc {
+	return func(path string, entry fs.DirEntry, err error) error {
+		p.mu.Lock()
+		action := p.actions[path]
+		p.mu.Unlock()
+
+		if err == nil && action == actionSkip {
+			return skip(path, entry, nil)
+		}
+
+		return put(path, entry, err)
+	}
+}
+
+// Encode returns the plan as an indented JSON object listing its steps.
+func (p *runPlan) Encode() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	steps := p.steps
+	if steps == nil {
+		steps = []planStep{}
+	}
+
+	body, err := json.MarshalIndent(struct {
+		Steps []planStep `json:"steps"`
+	}{Steps: steps}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(body, '\n'), nil
+}
+
+// writePlan writes the plan to the given file, or to standard output if the path is `-`.
+func writePlan(path string, plan *runPlan) error {
+	body, err := plan.Encode()
+	if err != nil {
+		return fmt.Errorf("could not encode the plan: %v", err)
+	}
+
+	if path == "-" {
+		_, err := os.Stdout.Write(body)
+		return err
+	}
+
+	if err := os.WriteFile(path, body, 0o644); err != nil {
+		return fmt.Errorf("could not write the plan: %v", err)
+	}
+
+	return nil
+}
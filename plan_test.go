@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func Test_runPlan(t *testing.T) {
+	plan := &runPlan{}
+	put := plan.PutFunc(func(path string) string { return reasonNew })
+	skip := plan.SkipFunc()
+
+	for _, file := range []struct {
+		walk fs.WalkDirFunc
+		path string
+	}{
+		{walk: put, path: "js/app.js"},
+		{walk: skip, path: "index.html"},
+		{walk: put, path: "css"},
+		{walk: put, path: "about.html"},
+	} {
+		entry := mockFileInfo{name: file.path, size: 3}
+		if file.path == "css" {
+			entry.mode = fs.ModeDir
+		}
+
+		if err := file.walk(file.path, entry, nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	plan.Delete([]string{"old.html"}, map[string]remoteObject{"old.html": {Size: 7}}, reasonStale)
+	plan.Redirect(redirect{From: "/docs", To: "/guide/"})
+	plan.Sort()
+
+	want := []planStep{
+		{Action: actionPut, Path: "about.html", Size: 3, Reason: reasonNew},
+		{Action: actionSkip, Path: "index.html", Size: 3, Reason: reasonUnchanged},
+		{Action: actionPut, Path: "js/app.js", Size: 3, Reason: reasonNew},
+		{Action: actionDelete, Path: "old.html", Size: 7, Reason: reasonStale},
+		{Action: actionPut, Path: "docs", Reason: "redirect to /guide/"},
+	}
+
+	var got []planStep
+	for _, step := range plan.steps {
+		step.entry = nil
+		got = append(got, step)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected steps %+v; got %+v", want, got)
+	}
+
+	if keys := plan.Keys(actionDelete); !reflect.DeepEqual(keys, []string{"old.html"}) {
+		t.Errorf("Expected deletion of old.html; got %v", keys)
+	}
+
+	if err := put("broken", nil, errors.New("permission denied")); err == nil {
+		t.Error("Expected walk errors to stop the walk")
+	}
+}
+
+func Test_runPlan_ApplyFunc(t *testing.T) {
+	plan := &runPlan{}
+	plan.PutFunc(func(string) string { return reasonChanged })("a.txt", mockFileInfo{name: "a.txt"}, nil)
+	plan.SkipFunc()("b.txt", mockFileInfo{name: "b.txt"}, nil)
+	plan.Redirect(redirect{From: "/old", To: "/new"})
+
+	var puts, skips []string
+	record := func(paths *[]string) fs.WalkDirFunc {
+		return func(path string, entry fs.DirEntry, err error) error {
+			*paths = append(*paths, path)
+			return err
+		}
+	}
+
+	if err := plan.Walker()(plan.ApplyFunc(record(&puts), record(&skips))); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(puts, []string{"a.txt"}) {
+		t.Errorf("Expected a.txt to be put; got %v", puts)
+	}
+
+	if !reflect.DeepEqual(skips, []string{"b.txt"}) {
+		t.Errorf("Expected b.txt to be skipped; got %v", skips)
+	}
+}
+
+func Test_runPlan_Stream(t *testing.T) {
+	paths := []string{"a.txt", "b.txt", "c.txt", "d.txt"}
+
+	testCases := []struct {
+		desc      string
+		failPuts  bool
+		wantErr   bool
+		wantPuts  []string
+		wantSkips []string
+	}{
+		{desc: "every file", wantPuts: []string{"a.txt", "c.txt", "d.txt"}, wantSkips: []string{"b.txt"}},
+		{desc: "failed upload", failPuts: true, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			plan := &runPlan{}
+			put := plan.PutFunc(func(string) string { return reasonNew })
+			skip := plan.SkipFunc()
+
+			// Files are planned in parallel, like by the planner's pool.
+			planFiles := func(ctx context.Context) error {
+				pool := newUploadPool(ctx, 2, false, func(path string, entry fs.DirEntry, err error) error {
+					if path == "b.txt" {
+						return skip(path, entry, err)
+					}
+
+					return put(path, entry, err)
+				})
+
+				for _, path := range paths {
+					if err := pool.WalkDirFunc()(path, mockFileInfo{name: path}, nil); err != nil {
+						break
+					}
+				}
+
+				return pool.Wait()
+			}
+
+			var puts, skips []string
+			record := func(paths *[]string, fail bool) fs.WalkDirFunc {
+				return func(path string, entry fs.DirEntry, err error) error {
+					*paths = append(*paths, path)
+					if fail {
+						return errors.New("upload failed")
+					}
+
+					return err
+				}
+			}
+
+			err := plan.Stream(context.Background(), 1, planFiles)(plan.ApplyFunc(record(&puts, tC.failPuts), record(&skips, false)))
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			// Files are streamed in the order they were planned, so a failed upload stops the
+			// walk at the first file put.
+			if tC.wantErr {
+				if len(puts) != 1 {
+					t.Errorf("Expected no more files after the failure; got %v", puts)
+				}
+
+				return
+			}
+
+			sort.Strings(puts)
+			if !reflect.DeepEqual(puts, tC.wantPuts) {
+				t.Errorf("Expected puts %v; got %v", tC.wantPuts, puts)
+			}
+
+			if !reflect.DeepEqual(skips, tC.wantSkips) {
+				t.Errorf("Expected skips %v; got %v", tC.wantSkips, skips)
+			}
+		})
+	}
+}
+
+func Test_runPlan_Encode(t *testing.T) {
+	testCases := []struct {
+		desc string
+		plan *runPlan
+		want string
+	}{
+		{desc: "empty plan", plan: &runPlan{}, want: `{"steps":[]}`},
+		{
+			desc: "steps",
+			plan: &runPlan{steps: []planStep{{Action: actionDelete, Path: "old.html", Size: 7, Reason: reasonStale}}},
+			want: `{"steps":[{"action":"delete","path":"old.html","size":7,"reason":"stale"}]}`,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			body, err := tC.plan.Encode()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var got, want any
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatalf("Invalid JSON %s: %v", body, err)
+			}
+
+			json.Unmarshal([]byte(tC.want), &want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Expected plan %s; got %s", tC.want, body)
+			}
+		})
+	}
+}
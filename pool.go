@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+
+	uploads "github.com/Zeroed-Books/s3-copy/pkg/uploader"
+)
+
+// errUploadAborted is returned to the directory walk once a worker has failed, so that no more
+// files are queued for upload.
+var errUploadAborted = uploads.ErrAborted
+
+// uploadFailure is a file that could not be uploaded.
+type uploadFailure = uploads.Failure
+
+// uploadErrors aggregates the failures from every worker in an upload pool.
+type uploadErrors = uploads.Errors
+
+// uploadPool distributes files found during a directory walk across a fixed number of upload
+// workers.
+type uploadPool = uploads.Pool
+
+// newUploadPool starts a pool of `concurrency` workers, each of which uploads files using the
+// provided callback until the context is cancelled. Unless `continueOnError` is set, the pool
+// stops accepting files after the first failed upload.
+func newUploadPool(ctx context.Context, concurrency int, continueOnError bool, upload fs.WalkDirFunc) *uploadPool {
+	return uploads.NewPool(ctx, concurrency, continueOnError, upload)
+}
+
+// newLimitedUploadPool starts a pool with a worker for each slot of the limiter. Workers wait for
+// the limiter before each upload, so that fewer files are uploaded at a time while the limit is
+// reduced.
+func newLimitedUploadPool(ctx context.Context, limiter *concurrencyLimiter, continueOnError bool, upload fs.WalkDirFunc) *uploadPool {
+	return uploads.NewLimitedPool(ctx, limiter, continueOnError, upload)
+}
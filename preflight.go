@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	// preflightKey is the key, relative to the prefix, that the preflight upload is checked for.
+	// Nothing is stored under it.
+	preflightKey = ".s3-copy-preflight"
+	// preflightETag is the ETag the preflight upload is conditional on, which no object has.
+	preflightETag = `"s3-copy-preflight"`
+)
+
+// preflighter is implemented by backends that can check that uploads will succeed, so that a run
+// fails with an actionable error before any file is uploaded instead of halfway through.
+type preflighter interface {
+	Preflight(ctx context.Context) error
+}
+
+// preflight runs the checks of the backend, if it has any.
+func preflight(ctx context.Context, store backend) error {
+	p, ok := store.(preflighter)
+	if !ok {
+		return nil
+	}
+
+	return p.Preflight(ctx)
+}
+
+// Preflight checks that the bucket exists, is in the configured region, and that the credentials
+// may upload objects under the prefix with the configured ACL and tags.
+func (s *s3Uploader) Preflight(ctx context.Context) error {
+	if err := s.checkBucket(ctx); err != nil {
+		return err
+	}
+
+	return s.checkUpload(ctx)
+}
+
+// checkBucket checks that the bucket exists and is in the client's region. Credentials that may
+// upload objects but not read the bucket itself aren't an error.
+func (s *s3Uploader) checkBucket(ctx context.Context) error {
+	output, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(s.bucket)})
+
+	var status int
+	var region string
+	var respErr *awshttp.ResponseError
+	switch {
+	case err == nil:
+		region = aws.ToString(output.BucketRegion)
+	case errors.As(err, &respErr):
+		status = respErr.HTTPStatusCode()
+		region = respErr.Response.Header.Get("X-Amz-Bucket-Region")
+	default:
+		return fmt.Errorf("could not access bucket %s: %v", s.bucket, err)
+	}
+
+	// Only AWS reports the region reliably, and access points are reached in their own region.
+	options := s.client.Options()
+	if region != "" && region != options.Region && options.BaseEndpoint == nil && !isAccessPointARN(s.bucket) {
+		return fmt.Errorf("bucket %s is in region %s, not %s; use '-region %s'", s.bucket, region, options.Region, region)
+	}
+
+	switch status {
+	case 0, http.StatusForbidden:
+		return nil
+	case http.StatusNotFound:
+		return fmt.Errorf("bucket %s doesn't exist; check '-bucket' and '-env', or create the bucket first", s.bucket)
+	default:
+		return fmt.Errorf("could not access bucket %s: %v", s.bucket, err)
+	}
+}
+
+// checkUpload checks that the credentials may upload under the prefix, without storing anything:
+// the upload is conditional on an ETag no object has, and S3 only evaluates the condition once
+// the request is authorized. Services that ignore the condition store an empty object, which is
+// deleted again.
+func (s *s3Uploader) checkUpload(ctx context.Context) error {
+	key := s.Prefix + preflightKey
+	input := &s3.PutObjectInput{
+		Bucket:  aws.String(s.bucket),
+		Key:     aws.String(key),
+		Body:    bytes.NewReader(nil),
+		IfMatch: aws.String(preflightETag),
+		ACL:     s.fileACL,
+	}
+
+	if len(s.Tags) > 0 {
+		tagging, err := encodeTags(s.Tags)
+		if err != nil {
+			return err
+		}
+
+		input.Tagging = aws.String(tagging)
+	}
+
+	s.Encryption.apply(input)
+
+	_, err := s.client.PutObject(ctx, input)
+	if err == nil {
+		if _, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)}); err != nil {
+			log.Printf("Could not delete the preflight object %s: %v\n", key, err)
+		}
+
+		return nil
+	}
+
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return fmt.Errorf("could not check access to bucket %s: %v", s.bucket, err)
+	}
+
+	switch apiErr.ErrorCode() {
+	case "PreconditionFailed", "NoSuchKey":
+		return nil
+	case "AccessDenied":
+		return fmt.Errorf("the credentials may not upload to %s/%s (%v); they need the s3:PutObject permission, as well as s3:PutObjectAcl for ACLs and s3:PutObjectTagging for '-tag', or '-request-payer requester' for Requester Pays buckets", s.bucket, s.Prefix, err)
+	case "AccessControlListNotSupported":
+		return fmt.Errorf("bucket %s has ACLs disabled; use '-acl none'", s.bucket)
+	default:
+		return fmt.Errorf("could not check access to bucket %s: %v", s.bucket, err)
+	}
+}
+
+// Preflight checks every destination. With the report policy, destinations other than the
+// primary one that fail the checks are reported and not uploaded to.
+func (f *fanoutBackend) Preflight(ctx context.Context) error {
+	for i, d := range f.destinations {
+		err := preflight(ctx, d.store)
+		if err == nil {
+			continue
+		}
+
+		if i == 0 || !f.report {
+			return fmt.Errorf("%s: %v", d.name, err)
+		}
+
+		log.Printf("Destination %s failed the preflight checks and won't be uploaded to: %v\n", d.name, err)
+		d.status.failed.Add(1)
+	}
+
+	return nil
+}
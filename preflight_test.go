@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// scriptedResponse is the response of a scriptedS3 to the requests with a method.
+type scriptedResponse struct {
+	status int
+	region string
+	code   string
+}
+
+// scriptedS3 is an HTTP client responding to S3 requests by their method, and recording them
+// and their bodies.
+type scriptedS3 struct {
+	responses map[string]scriptedResponse
+	requests  []*http.Request
+	bodies    []string
+}
+
+func (s *scriptedS3) Do(req *http.Request) (*http.Response, error) {
+	s.requests = append(s.requests, req)
+
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+	}
+
+	s.bodies = append(s.bodies, string(body))
+
+	response, ok := s.responses[req.Method]
+	if !ok {
+		response = scriptedResponse{status: http.StatusOK}
+	}
+
+	header := http.Header{}
+	if response.region != "" {
+		header.Set("X-Amz-Bucket-Region", response.region)
+	}
+
+	var errorBody string
+	if response.code != "" && req.Method != http.MethodHead {
+		errorBody = "<Error><Code>" + response.code + "</Code><Message>" + response.code + "</Message></Error>"
+	}
+
+	return &http.Response{
+		StatusCode: response.status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(errorBody)),
+		Request:    req,
+	}, nil
+}
+
+// preflightingBackend is a backend whose preflight checks fail with the given error.
+type preflightingBackend struct {
+	backend
+	err error
+}
+
+func (b preflightingBackend) Preflight(ctx context.Context) error {
+	return b.err
+}
+
+func Test_s3Uploader_Preflight(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		endpoint   string
+		head       scriptedResponse
+		put        scriptedResponse
+		wantErr    bool
+		wantDelete bool
+	}{
+		{
+			desc: "allowed",
+			head: scriptedResponse{status: http.StatusOK, region: "eu-west-1"},
+			put:  scriptedResponse{status: http.StatusPreconditionFailed, code: "PreconditionFailed"},
+		},
+		{
+			desc: "allowed to upload only",
+			head: scriptedResponse{status: http.StatusForbidden, region: "eu-west-1"},
+			put:  scriptedResponse{status: http.StatusNotFound, code: "NoSuchKey"},
+		},
+		{
+			desc:       "condition ignored",
+			head:       scriptedResponse{status: http.StatusOK},
+			put:        scriptedResponse{status: http.StatusOK},
+			wantDelete: true,
+		},
+		{
+			desc:    "missing bucket",
+			head:    scriptedResponse{status: http.StatusNotFound},
+			wantErr: true,
+		},
+		{
+			desc:    "other region",
+			head:    scriptedResponse{status: http.StatusMovedPermanently, region: "us-east-1"},
+			wantErr: true,
+		},
+		{
+			desc:    "other region reported by the bucket",
+			head:    scriptedResponse{status: http.StatusOK, region: "us-east-1"},
+			wantErr: true,
+		},
+		{
+			desc:     "other region of custom endpoint",
+			endpoint: "https://minio.internal:9000",
+			head:     scriptedResponse{status: http.StatusOK, region: "us-east-1"},
+			put:      scriptedResponse{status: http.StatusPreconditionFailed, code: "PreconditionFailed"},
+		},
+		{
+			desc:    "upload denied",
+			head:    scriptedResponse{status: http.StatusOK, region: "eu-west-1"},
+			put:     scriptedResponse{status: http.StatusForbidden, code: "AccessDenied"},
+			wantErr: true,
+		},
+		{
+			desc:    "ACLs disabled",
+			head:    scriptedResponse{status: http.StatusOK, region: "eu-west-1"},
+			put:     scriptedResponse{status: http.StatusBadRequest, code: "AccessControlListNotSupported"},
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			server := &scriptedS3{responses: map[string]scriptedResponse{
+				http.MethodHead: tC.head,
+				http.MethodPut:  tC.put,
+			}}
+
+			client := s3.New(s3.Options{
+				Region:           "eu-west-1",
+				Credentials:      credentials.NewStaticCredentialsProvider("key", "secret", ""),
+				HTTPClient:       server,
+				RetryMaxAttempts: 1,
+			}, func(o *s3.Options) {
+				if tC.endpoint != "" {
+					o.BaseEndpoint = aws.String(tC.endpoint)
+					o.UsePathStyle = true
+				}
+			})
+
+			store := newS3Uploader(client, "my-site", "public-read")
+			store.Prefix = "docs/"
+
+			err := store.Preflight(context.Background())
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			var deleted bool
+			for _, req := range server.requests {
+				switch req.Method {
+				case http.MethodPut:
+					if got := req.Header.Get("If-Match"); got != preflightETag {
+						t.Errorf("Expected the upload to be conditional on %s; got %q", preflightETag, got)
+					}
+
+					if !strings.HasSuffix(req.URL.Path, "/docs/"+preflightKey) {
+						t.Errorf("Expected an upload beneath the prefix; got %s", req.URL.Path)
+					}
+				case http.MethodDelete:
+					deleted = true
+				}
+			}
+
+			if deleted != tC.wantDelete {
+				t.Errorf("Expected deletion %v; got %v", tC.wantDelete, deleted)
+			}
+		})
+	}
+}
+
+func Test_fanoutBackend_Preflight(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		policy  string
+		failing int
+		wantErr bool
+	}{
+		{desc: "every destination passes", policy: fanoutAll, failing: -1},
+		{desc: "replica fails", policy: fanoutAll, failing: 1, wantErr: true},
+		{desc: "replica fails with report policy", policy: fanoutReport, failing: 1},
+		{desc: "primary fails with report policy", policy: fanoutReport, failing: 0, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var stores []backend
+			for i := range 2 {
+				var err error
+				if i == tC.failing {
+					err = errors.New("access denied")
+				}
+
+				stores = append(stores, preflightingBackend{backend: newTestFileBackend(t, t.TempDir(), ""), err: err})
+			}
+
+			fanout, err := newFanoutBackend([]string{"primary", "replica"}, stores, tC.policy, 0, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = preflight(context.Background(), fanout)
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if !tC.wantErr && tC.failing > 0 && len(fanout.active()) != 1 {
+				t.Errorf("Expected the failing destination to be skipped; got %d active destinations", len(fanout.active()))
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// scanTotals walks the files the same way an upload would, returning the number and total size of
+// the files that pass the filter.
+func scanTotals(walkFiles treeWalker, filter pathFilter) (int, int64, error) {
+	var files int
+	var bytes int64
+
+	err := walkFiles(createFilterFunc(filter, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("could not walk %s: %v", path, err)
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("could not stat %s: %v", path, err)
+		}
+
+		files++
+		bytes += info.Size()
+
+		return nil
+	}))
+
+	return files, bytes, err
+}
+
+// progress tracks the files and bytes processed during a run. After each file, it logs the
+// aggregate progress along with the throughput and estimated time remaining, unless it is quiet.
+type progress struct {
+	totalFiles int
+	totalBytes int64
+	quiet      bool
+	start      time.Time
+	// now returns the current time, and may be replaced in tests.
+	now func() time.Time
+
+	doneFiles int64
+	doneBytes int64
+}
+
+func newProgress(totalFiles int, totalBytes int64, quiet bool) *progress {
+	return &progress{
+		totalFiles: totalFiles,
+		totalBytes: totalBytes,
+		quiet:      quiet,
+		start:      time.Now(),
+		now:        time.Now,
+	}
+}
+
+// SkipFunc wraps a callback for files skipped because they are unchanged, counting them as
+// processed. The wrapped callback isn't invoked when the progress is quiet.
+func (p *progress) SkipFunc(next fs.WalkDirFunc) fs.WalkDirFunc {
+	return func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return next(path, entry, err)
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("could not stat %s: %v", path, err)
+		}
+
+		atomic.AddInt64(&p.doneFiles, 1)
+		atomic.AddInt64(&p.doneBytes, info.Size())
+
+		if p.quiet {
+			return nil
+		}
+
+		return next(path, entry, nil)
+	}
+}
+
+// status describes the aggregate progress, e.g.
+// `[3/10] 1.5 MiB of 4.0 MiB, 512.0 KiB/s, ETA 5s`.
+func (p *progress) status() string {
+	doneFiles := atomic.LoadInt64(&p.doneFiles)
+	doneBytes := atomic.LoadInt64(&p.doneBytes)
+	elapsed := p.now().Sub(p.start)
+
+	var rate float64
+	if elapsed > 0 {
+		rate = float64(doneBytes) / elapsed.Seconds()
+	}
+
+	eta := "unknown"
+	if rate > 0 {
+		remaining := time.Duration(float64(p.totalBytes-doneBytes) / rate * float64(time.Second))
+		if remaining < 0 {
+			remaining = 0
+		}
+
+		eta = remaining.Round(time.Second).String()
+	}
+
+	return fmt.Sprintf(
+		"[%d/%d] %s of %s, %s/s, ETA %s",
+		doneFiles,
+		p.totalFiles,
+		formatBytes(doneBytes),
+		formatBytes(p.totalBytes),
+		formatBytes(int64(rate)),
+		eta,
+	)
+}
+
+// Summary logs the totals for the whole run.
+func (p *progress) Summary() {
+	elapsed := p.now().Sub(p.start)
+	doneBytes := atomic.LoadInt64(&p.doneBytes)
+
+	var rate float64
+	if elapsed > 0 {
+		rate = float64(doneBytes) / elapsed.Seconds()
+	}
+
+	log.Printf(
+		"Processed %d file(s) (%s) in %v (%s/s)\n",
+		atomic.LoadInt64(&p.doneFiles),
+		formatBytes(doneBytes),
+		elapsed.Round(time.Millisecond),
+		formatBytes(int64(rate)),
+	)
+}
+
+// progressUploader counts the bytes read from each object's body as it is uploaded, and reports
+// the progress once the upload completes.
+type progressUploader struct {
+	progress *progress
+	next     uploader
+}
+
+func (u *progressUploader) Upload(ctx context.Context, object *uploadObject) error {
+	counter := &countingReader{r: object.Body, progress: u.progress}
+	if seeker, ok := object.Body.(io.Seeker); ok {
+		object.Body = &countingReadSeeker{countingReader: counter, s: seeker}
+	} else {
+		object.Body = counter
+	}
+
+	if err := u.next.Upload(ctx, object); err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&u.progress.doneFiles, 1)
+
+	if !u.progress.quiet {
+		log.Printf("Uploaded %s (%s) %s\n", object.Path, formatBytes(counter.n), u.progress.status())
+	}
+
+	return nil
+}
+
+// countingReader adds the bytes read from a body to the progress of a run.
+type countingReader struct {
+	r        io.Reader
+	progress *progress
+	// n is the current offset into the body.
+	n int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	atomic.AddInt64(&c.progress.doneBytes, int64(n))
+
+	return n, err
+}
+
+// countingReadSeeker is a countingReader for seekable bodies. Seeking adjusts the progress, so
+// that bodies re-read when an upload is retried aren't counted twice.
+type countingReadSeeker struct {
+	*countingReader
+	s io.Seeker
+}
+
+func (c *countingReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	position, err := c.s.Seek(offset, whence)
+	if err != nil {
+		return position, err
+	}
+
+	atomic.AddInt64(&c.progress.doneBytes, position-c.n)
+	c.n = position
+
+	return position, nil
+}
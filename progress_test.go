@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_scanTotals(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"index.html":      "<html></html>",
+		"app/main.js":     "let foo = 'bar';",
+		"app/main.js.map": "{}",
+	}
+	for name, body := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Could not create directory: %v", err)
+		}
+
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatalf("Could not write file: %v", err)
+		}
+	}
+
+	filter, err := newPathFilter(nil, []string{"*.map"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	count, size, err := scanTotals(func(walk fs.WalkDirFunc) error {
+		return filepath.WalkDir(root, walk)
+	}, filter)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if count != 2 {
+		t.Errorf("Expected 2 files; got %d", count)
+	}
+
+	if want := int64(len(files["index.html"]) + len(files["app/main.js"])); size != want {
+		t.Errorf("Expected %d bytes; got %d", want, size)
+	}
+}
+
+func Test_progress_status(t *testing.T) {
+	prog := newProgress(4, 4096, false)
+	prog.now = func() time.Time { return prog.start.Add(2 * time.Second) }
+	prog.doneFiles = 1
+	prog.doneBytes = 1024
+
+	want := "[1/4] 1.0 KiB of 4.0 KiB, 512 B/s, ETA 6s"
+	if got := prog.status(); got != want {
+		t.Errorf("Expected status %q; got %q", want, got)
+	}
+}
+
+func Test_progressUploader(t *testing.T) {
+	prog := newProgress(1, 9, true)
+
+	// Each attempt reads the whole body before failing, like a real upload would, so the retry
+	// has to rewind the body.
+	client := &bodyReadingUploader{next: &flakyUploader{errs: []error{transientError{}}}}
+	retryClient := newRetryUploader(client, 1)
+	retryClient.baseDelay = time.Millisecond
+	retryClient.maxDelay = time.Millisecond
+	progressClient := &progressUploader{progress: prog, next: retryClient}
+
+	err := progressClient.Upload(context.Background(), &uploadObject{
+		Path: "foo.txt",
+		Body: strings.NewReader("some body"),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if prog.doneFiles != 1 {
+		t.Errorf("Expected 1 file done; got %d", prog.doneFiles)
+	}
+
+	if prog.doneBytes != 9 {
+		t.Errorf("Expected 9 bytes done after a retry; got %d", prog.doneBytes)
+	}
+}
+
+// bodyReadingUploader reads an object's body in full before passing it to the next uploader.
+type bodyReadingUploader struct {
+	next uploader
+}
+
+func (u *bodyReadingUploader) Upload(ctx context.Context, object *uploadObject) error {
+	if _, err := io.Copy(io.Discard, object.Body); err != nil {
+		return err
+	}
+
+	return u.next.Upload(ctx, object)
+}
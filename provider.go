@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// providerPreset configures the S3 client for an S3-compatible service, so that its endpoint and
+// quirks don't have to be worked out by hand.
+type providerPreset struct {
+	// endpoint returns the service's endpoint for the given account ID and region.
+	endpoint func(accountID, region string) string
+	// needsAccountID and needsRegion report whether `-account-id` and `-region` select the
+	// endpoint, and must therefore be given.
+	needsAccountID bool
+	needsRegion    bool
+	// signingRegion is the region requests are signed for, if the service expects a fixed one
+	// instead of the region of the endpoint.
+	signingRegion string
+	// pathStyle addresses buckets in the path of the URL instead of the host name.
+	pathStyle bool
+	// noACL is set for services that don't support object ACLs, which are then omitted unless
+	// `-acl` is given.
+	noACL bool
+	// noTags is set for services that don't support object tags.
+	noTags bool
+}
+
+// providerPresets are the supported S3-compatible services, by the name given to `-provider`.
+var providerPresets = map[string]providerPreset{
+	"b2": {
+		endpoint: func(_, region string) string {
+			return fmt.Sprintf("https://s3.%s.backblazeb2.com", region)
+		},
+		needsRegion: true,
+		noACL:       true,
+	},
+	"r2": {
+		endpoint: func(accountID, _ string) string {
+			return fmt.Sprintf("https://%s.r2.cloudflarestorage.com", accountID)
+		},
+		needsAccountID: true,
+		signingRegion:  "auto",
+		pathStyle:      true,
+		noACL:          true,
+		noTags:         true,
+	},
+	"spaces": {
+		endpoint: func(_, region string) string {
+			return fmt.Sprintf("https://%s.digitaloceanspaces.com", region)
+		},
+		needsRegion:   true,
+		signingRegion: "us-east-1",
+	},
+}
+
+// applyProvider configures the client for the service selected by `-provider`. An endpoint given
+// explicitly takes precedence over the preset's, e.g. for R2's jurisdiction-specific endpoints.
+func (c *commonFlags) applyProvider(regionGiven bool) error {
+	if c.provider == "" {
+		if c.accountID != "" {
+			return errors.New("the '-account-id' flag can only be used together with '-provider'")
+		}
+
+		return nil
+	}
+
+	preset, ok := providerPresets[c.provider]
+	if !ok {
+		names := make([]string, 0, len(providerPresets))
+		for name := range providerPresets {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		return fmt.Errorf("unknown provider %q; expected one of: %s", c.provider, strings.Join(names, ", "))
+	}
+
+	if c.endpoint == "" {
+		if preset.needsAccountID && c.accountID == "" {
+			return fmt.Errorf("the %s provider requires '-account-id'", c.provider)
+		}
+
+		if preset.needsRegion && !regionGiven {
+			return fmt.Errorf("the %s provider requires '-region'", c.provider)
+		}
+
+		c.endpoint = preset.endpoint(c.accountID, c.region)
+	}
+
+	if preset.signingRegion != "" {
+		c.region = preset.signingRegion
+	}
+
+	c.pathStyle = c.pathStyle || preset.pathStyle
+	c.preset = preset
+
+	return nil
+}
+
+// objectACL returns the ACL to apply to objects, omitting it for services that don't support ACLs
+// unless it was given explicitly.
+func (p providerPreset) objectACL(acl string, given bool) string {
+	if p.noACL && !given {
+		return aclNone
+	}
+
+	return acl
+}
+
+// checkTags reports an error if object tags are given for a service that doesn't support them.
+func (p providerPreset) checkTags(tags map[string]string, provider string) error {
+	if p.noTags && len(tags) > 0 {
+		return fmt.Errorf("object tags aren't supported by the %s provider", provider)
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_commonFlags_applyProvider(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		flags         commonFlags
+		regionGiven   bool
+		wantEndpoint  string
+		wantRegion    string
+		wantPathStyle bool
+		wantErr       bool
+	}{
+		{
+			desc:        "no provider",
+			flags:       commonFlags{region: "eu-west-1"},
+			regionGiven: true,
+			wantRegion:  "eu-west-1",
+		},
+		{
+			desc:          "r2",
+			flags:         commonFlags{provider: "r2", accountID: "abc123", region: "us-east-1"},
+			wantEndpoint:  "https://abc123.r2.cloudflarestorage.com",
+			wantRegion:    "auto",
+			wantPathStyle: true,
+		},
+		{
+			desc:          "r2 with explicit endpoint",
+			flags:         commonFlags{provider: "r2", endpoint: "https://abc123.eu.r2.cloudflarestorage.com", region: "us-east-1"},
+			wantEndpoint:  "https://abc123.eu.r2.cloudflarestorage.com",
+			wantRegion:    "auto",
+			wantPathStyle: true,
+		},
+		{
+			desc:         "b2",
+			flags:        commonFlags{provider: "b2", region: "us-west-004"},
+			regionGiven:  true,
+			wantEndpoint: "https://s3.us-west-004.backblazeb2.com",
+			wantRegion:   "us-west-004",
+		},
+		{
+			desc:         "spaces",
+			flags:        commonFlags{provider: "spaces", region: "nyc3"},
+			regionGiven:  true,
+			wantEndpoint: "https://nyc3.digitaloceanspaces.com",
+			wantRegion:   "us-east-1",
+		},
+		{
+			desc:    "r2 without account ID",
+			flags:   commonFlags{provider: "r2", region: "us-east-1"},
+			wantErr: true,
+		},
+		{
+			desc:    "spaces without region",
+			flags:   commonFlags{provider: "spaces", region: "us-east-1"},
+			wantErr: true,
+		},
+		{
+			desc:    "unknown provider",
+			flags:   commonFlags{provider: "wasabi"},
+			wantErr: true,
+		},
+		{
+			desc:    "account ID without provider",
+			flags:   commonFlags{accountID: "abc123"},
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			flags := tC.flags
+			err := flags.applyProvider(tC.regionGiven)
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if flags.endpoint != tC.wantEndpoint || flags.region != tC.wantRegion || flags.pathStyle != tC.wantPathStyle {
+				t.Errorf("Expected endpoint %q, region %q, and path style %v; got %q, %q, and %v", tC.wantEndpoint, tC.wantRegion, tC.wantPathStyle, flags.endpoint, flags.region, flags.pathStyle)
+			}
+		})
+	}
+}
+
+func Test_providerPreset_objectACL(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		provider string
+		acl      string
+		given    bool
+		want     string
+	}{
+		{desc: "default ACL", acl: "public-read", want: "public-read"},
+		{desc: "default ACL without ACL support", provider: "r2", acl: "public-read", want: aclNone},
+		{desc: "explicit ACL without ACL support", provider: "b2", acl: "private", given: true, want: "private"},
+		{desc: "default ACL with ACL support", provider: "spaces", acl: "public-read", want: "public-read"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := providerPresets[tC.provider].objectACL(tC.acl, tC.given); got != tC.want {
+				t.Errorf("Expected %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_providerPreset_checkTags(t *testing.T) {
+	tags := map[string]string{"team": "web"}
+
+	if err := providerPresets["r2"].checkTags(tags, "r2"); err == nil {
+		t.Error("Expected an error for tags on R2")
+	}
+
+	if err := providerPresets["b2"].checkTags(tags, "b2"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxPurgeURLs is the number of changed URLs above which the whole CDN cache is purged instead,
+// since purging URLs one batch at a time would take longer than refilling the cache.
+const maxPurgeURLs = 250
+
+// purgeTimeout bounds how long a single purge request may take.
+const purgeTimeout = 30 * time.Second
+
+// cdnConfig configures purging the CDN in front of the bucket after a deploy, so that visitors
+// get the new files right away.
+type cdnConfig struct {
+	// BaseURL is the URL the objects beneath the prefix are served from, e.g.
+	// `https://example.com/`.
+	BaseURL    string            `yaml:"base-url"`
+	Cloudflare *cloudflareConfig `yaml:"cloudflare"`
+	Fastly     *fastlyConfig     `yaml:"fastly"`
+}
+
+type cloudflareConfig struct {
+	ZoneID string `yaml:"zone-id"`
+	// APIToken defaults to the CLOUDFLARE_API_TOKEN environment variable.
+	APIToken string `yaml:"api-token"`
+}
+
+type fastlyConfig struct {
+	ServiceID string `yaml:"service-id"`
+	// APIToken defaults to the FASTLY_API_TOKEN environment variable.
+	APIToken string `yaml:"api-token"`
+}
+
+// A purger removes URLs from a CDN's cache.
+type purger interface {
+	// Name identifies the CDN in log messages.
+	Name() string
+	Purge(ctx context.Context, urls []string) error
+	PurgeEverything(ctx context.Context) error
+}
+
+// purgers creates a purger for each CDN in the config, validating its settings.
+func (c *cdnConfig) purgers(client *http.Client) ([]purger, error) {
+	if c == nil || (c.Cloudflare == nil && c.Fastly == nil) {
+		return nil, nil
+	}
+
+	base, err := url.Parse(c.BaseURL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid cdn base-url %q: expected an absolute http or https URL", c.BaseURL)
+	}
+
+	var purgers []purger
+	if cf := c.Cloudflare; cf != nil {
+		token := cf.APIToken
+		if token == "" {
+			token = os.Getenv("CLOUDFLARE_API_TOKEN")
+		}
+
+		if cf.ZoneID == "" || token == "" {
+			return nil, errors.New("cloudflare: zone-id and api-token (or CLOUDFLARE_API_TOKEN) are required")
+		}
+
+		purgers = append(purgers, &cloudflarePurger{
+			client:   client,
+			endpoint: "https://api.cloudflare.com/client/v4",
+			zoneID:   cf.ZoneID,
+			token:    token,
+		})
+	}
+
+	if f := c.Fastly; f != nil {
+		token := f.APIToken
+		if token == "" {
+			token = os.Getenv("FASTLY_API_TOKEN")
+		}
+
+		if f.ServiceID == "" || token == "" {
+			return nil, errors.New("fastly: service-id and api-token (or FASTLY_API_TOKEN) are required")
+		}
+
+		purgers = append(purgers, &fastlyPurger{
+			client:    client,
+			endpoint:  "https://api.fastly.com",
+			serviceID: f.ServiceID,
+			token:     token,
+		})
+	}
+
+	return purgers, nil
+}
+
+// purgeURLs returns the URLs to purge for the given changed keys. Pages named `index.html` are
+// also purged by their directory URL, which is how they are usually requested.
+func purgeURLs(baseURL string, keys []string) []string {
+	base := strings.TrimSuffix(baseURL, "/") + "/"
+
+	seen := map[string]bool{}
+	var urls []string
+	add := func(key string) {
+		u := base + (&url.URL{Path: key}).EscapedPath()
+		if !seen[u] {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+
+	for _, key := range keys {
+		add(key)
+		if path.Base(key) == "index.html" {
+			dir := path.Dir(key)
+			if dir == "." {
+				add("")
+			} else {
+				add(dir + "/")
+			}
+		}
+	}
+
+	sort.Strings(urls)
+
+	return urls
+}
+
+// purgeChanges purges the URLs of the changed keys from every CDN, or everything if there are too
+// many of them.
+func purgeChanges(ctx context.Context, purgers []purger, baseURL string, keys []string, everything bool) error {
+	urls := purgeURLs(baseURL, keys)
+	if len(urls) == 0 && !everything {
+		return nil
+	}
+
+	for _, p := range purgers {
+		var err error
+		if everything || len(urls) > maxPurgeURLs {
+			err = p.PurgeEverything(ctx)
+		} else {
+			err = p.Purge(ctx, urls)
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %v", p.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// cloudflareBatchSize is the number of URLs Cloudflare accepts in a single purge request on every
+// plan.
+const cloudflareBatchSize = 30
+
+// cloudflarePurger purges URLs through the Cloudflare API.
+type cloudflarePurger struct {
+	client   *http.Client
+	endpoint string
+	zoneID   string
+	token    string
+}
+
+func (p *cloudflarePurger) Name() string {
+	return "Cloudflare"
+}
+
+func (p *cloudflarePurger) Purge(ctx context.Context, urls []string) error {
+	for start := 0; start < len(urls); start += cloudflareBatchSize {
+		end := min(start+cloudflareBatchSize, len(urls))
+		if err := p.purge(ctx, map[string]any{"files": urls[start:end]}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *cloudflarePurger) PurgeEverything(ctx context.Context) error {
+	return p.purge(ctx, map[string]any{"purge_everything": true})
+}
+
+func (p *cloudflarePurger) purge(ctx context.Context, request map[string]any) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/zones/%s/purge_cache", p.endpoint, url.PathEscape(p.zoneID)), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	return doPurgeRequest(ctx, p.client, req)
+}
+
+// fastlyPurger purges URLs through the Fastly API.
+type fastlyPurger struct {
+	client    *http.Client
+	endpoint  string
+	serviceID string
+	token     string
+}
+
+func (p *fastlyPurger) Name() string {
+	return "Fastly"
+}
+
+func (p *fastlyPurger) Purge(ctx context.Context, urls []string) error {
+	for _, u := range urls {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequest(http.MethodPost, p.endpoint+"/purge/"+parsed.Host+parsed.EscapedPath(), nil)
+		if err != nil {
+			return err
+		}
+
+		req.Header.Set("Fastly-Key", p.token)
+		if err := doPurgeRequest(ctx, p.client, req); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *fastlyPurger) PurgeEverything(ctx context.Context) error {
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/service/%s/purge_all", p.endpoint, url.PathEscape(p.serviceID)), nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Fastly-Key", p.token)
+
+	return doPurgeRequest(ctx, p.client, req)
+}
+
+// doPurgeRequest sends a purge request, failing unless it succeeded.
+func doPurgeRequest(ctx context.Context, client *http.Client, req *http.Request) error {
+	ctx, cancel := context.WithTimeout(ctx, purgeTimeout)
+	defer cancel()
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("purge request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("purge request failed with %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	return nil
+}
+
+// changeRecorder records the paths of the files that were uploaded, so that only those are purged
+// from the CDN.
+type changeRecorder struct {
+	next uploader
+
+	mu    sync.Mutex
+	paths []string
+}
+
+func (r *changeRecorder) Upload(ctx context.Context, object *uploadObject) error {
+	if err := r.next.Upload(ctx, object); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.paths = append(r.paths, filepath.ToSlash(object.Path))
+
+	return nil
+}
+
+// Paths returns the slash-separated paths of the files uploaded so far.
+func (r *changeRecorder) Paths() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string{}, r.paths...)
+}
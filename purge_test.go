@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func Test_purgeURLs(t *testing.T) {
+	got := purgeURLs("https://example.com", []string{"index.html", "docs/index.html", "assets/app.js", "my file.txt", "assets/app.js"})
+	want := []string{
+		"https://example.com/",
+		"https://example.com/assets/app.js",
+		"https://example.com/docs/",
+		"https://example.com/docs/index.html",
+		"https://example.com/index.html",
+		"https://example.com/my%20file.txt",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q; got %q", want, got)
+	}
+}
+
+func Test_cdnConfig_purgers(t *testing.T) {
+	t.Setenv("CLOUDFLARE_API_TOKEN", "")
+	t.Setenv("FASTLY_API_TOKEN", "fastly-token")
+
+	testCases := []struct {
+		desc      string
+		config    *cdnConfig
+		wantNames []string
+		wantErr   bool
+	}{
+		{desc: "no config"},
+		{desc: "no CDNs", config: &cdnConfig{BaseURL: "https://example.com/"}},
+		{
+			desc:      "Cloudflare and Fastly",
+			config:    &cdnConfig{BaseURL: "https://example.com/", Cloudflare: &cloudflareConfig{ZoneID: "zone", APIToken: "token"}, Fastly: &fastlyConfig{ServiceID: "service"}},
+			wantNames: []string{"Cloudflare", "Fastly"},
+		},
+		{
+			desc:    "missing token",
+			config:  &cdnConfig{BaseURL: "https://example.com/", Cloudflare: &cloudflareConfig{ZoneID: "zone"}},
+			wantErr: true,
+		},
+		{
+			desc:    "missing base URL",
+			config:  &cdnConfig{Fastly: &fastlyConfig{ServiceID: "service"}},
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			purgers, err := tC.config.purgers(http.DefaultClient)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			var names []string
+			for _, p := range purgers {
+				names = append(names, p.Name())
+			}
+
+			if !reflect.DeepEqual(names, tC.wantNames) {
+				t.Errorf("Expected purgers %q; got %q", tC.wantNames, names)
+			}
+		})
+	}
+}
+
+// purgeRequest is a request received by a fake CDN API.
+type purgeRequest struct {
+	method string
+	path   string
+	header http.Header
+	body   string
+}
+
+func newPurgeServer(t *testing.T, status int) (*httptest.Server, func() []purgeRequest) {
+	var mu sync.Mutex
+	var requests []purgeRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		requests = append(requests, purgeRequest{method: r.Method, path: r.URL.EscapedPath(), header: r.Header, body: string(body)})
+		mu.Unlock()
+
+		w.WriteHeader(status)
+		io.WriteString(w, `{"success": false}`)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []purgeRequest {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]purgeRequest{}, requests...)
+	}
+}
+
+func Test_cloudflarePurger(t *testing.T) {
+	server, requests := newPurgeServer(t, http.StatusOK)
+	p := &cloudflarePurger{client: server.Client(), endpoint: server.URL, zoneID: "zone", token: "token"}
+
+	urls := make([]string, cloudflareBatchSize+1)
+	for i := range urls {
+		urls[i] = "https://example.com/" + strings.Repeat("a", i+1)
+	}
+
+	if err := p.Purge(context.Background(), urls); err != nil {
+		t.Fatal(err)
+	}
+
+	got := requests()
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 batches; got %d requests", len(got))
+	}
+
+	if got[0].path != "/zones/zone/purge_cache" || got[0].header.Get("Authorization") != "Bearer token" {
+		t.Errorf("Unexpected request %s with Authorization %q", got[0].path, got[0].header.Get("Authorization"))
+	}
+
+	var batch struct {
+		Files []string `json:"files"`
+	}
+	if err := json.Unmarshal([]byte(got[1].body), &batch); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(batch.Files, urls[cloudflareBatchSize:]) {
+		t.Errorf("Expected the second batch to hold the remaining URL; got %q", batch.Files)
+	}
+
+	if err := p.PurgeEverything(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if body := requests()[2].body; body != `{"purge_everything":true}` {
+		t.Errorf("Expected a request to purge everything; got %s", body)
+	}
+}
+
+func Test_fastlyPurger(t *testing.T) {
+	server, requests := newPurgeServer(t, http.StatusOK)
+	p := &fastlyPurger{client: server.Client(), endpoint: server.URL, serviceID: "service", token: "token"}
+
+	if err := p.Purge(context.Background(), []string{"https://example.com/docs/", "https://example.com/my%20file.txt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.PurgeEverything(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for _, r := range requests() {
+		if r.method != http.MethodPost || r.header.Get("Fastly-Key") != "token" {
+			t.Errorf("Unexpected %s request with Fastly-Key %q", r.method, r.header.Get("Fastly-Key"))
+		}
+
+		paths = append(paths, r.path)
+	}
+
+	want := []string{"/purge/example.com/docs/", "/purge/example.com/my%20file.txt", "/service/service/purge_all"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("Expected requests to %q; got %q", want, paths)
+	}
+}
+
+func Test_doPurgeRequest_error(t *testing.T) {
+	server, _ := newPurgeServer(t, http.StatusForbidden)
+	p := &fastlyPurger{client: server.Client(), endpoint: server.URL, serviceID: "service", token: "token"}
+
+	err := p.PurgeEverything(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Expected a 403 error; got %v", err)
+	}
+}
+
+// mockPurger records the purges it was asked for.
+type mockPurger struct {
+	urls       []string
+	everything bool
+	err        error
+}
+
+func (p *mockPurger) Name() string {
+	return "mock"
+}
+
+func (p *mockPurger) Purge(ctx context.Context, urls []string) error {
+	p.urls = append(p.urls, urls...)
+	return p.err
+}
+
+func (p *mockPurger) PurgeEverything(ctx context.Context) error {
+	p.everything = true
+	return p.err
+}
+
+func Test_purgeChanges(t *testing.T) {
+	many := make([]string, maxPurgeURLs+1)
+	for i := range many {
+		many[i] = strings.Repeat("a", i+1) + ".js"
+	}
+
+	testCases := []struct {
+		desc           string
+		keys           []string
+		everything     bool
+		err            error
+		wantURLs       []string
+		wantEverything bool
+		wantErr        bool
+	}{
+		{desc: "no changes"},
+		{desc: "changed keys", keys: []string{"app.js"}, wantURLs: []string{"https://example.com/app.js"}},
+		{desc: "too many changes", keys: many, wantEverything: true},
+		{desc: "everything", everything: true, wantEverything: true},
+		{desc: "failure", keys: []string{"app.js"}, err: errors.New("boom"), wantURLs: []string{"https://example.com/app.js"}, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			p := &mockPurger{err: tC.err}
+
+			err := purgeChanges(context.Background(), []purger{p}, "https://example.com/", tC.keys, tC.everything)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if !reflect.DeepEqual(p.urls, tC.wantURLs) || p.everything != tC.wantEverything {
+				t.Errorf("Expected URLs %q and everything %v; got %q and %v", tC.wantURLs, tC.wantEverything, p.urls, p.everything)
+			}
+		})
+	}
+}
+
+func Test_changeRecorder(t *testing.T) {
+	recorder := &changeRecorder{next: &mockUploader{}}
+	if err := recorder.Upload(context.Background(), &uploadObject{Path: "index.html"}); err != nil {
+		t.Fatal(err)
+	}
+
+	failing := &changeRecorder{next: &mockUploader{uploadErr: errors.New("boom")}}
+	if err := failing.Upload(context.Background(), &uploadObject{Path: "index.html"}); err == nil {
+		t.Fatal("Expected the upload to fail")
+	}
+
+	if got := recorder.Paths(); !reflect.DeepEqual(got, []string{"index.html"}) {
+		t.Errorf("Expected index.html to be recorded; got %q", got)
+	}
+
+	if got := failing.Paths(); len(got) != 0 {
+		t.Errorf("Expected failed uploads not to be recorded; got %q", got)
+	}
+}
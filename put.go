@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+)
+
+// runPut implements the `put` command, which uploads standard input or a single file to a key,
+// e.g. to store a database dump streamed from `pg_dump` without writing it to a temporary file.
+func runPut(cmd command, args []string) {
+	var common commonFlags
+	var acl, checksumName, contentType, encryptionPassphraseFile, key, sseMode, sseCustomerKeyFile, sseKMSKeyID string
+	var maxRetries, partSize, partConcurrency int
+	var metadataPairs, tagPairs stringList
+
+	flags := newFlagSet(cmd, "[flags] <file or ->")
+	common.register(flags)
+	flags.StringVar(&acl, "acl", aclNone, "Canned ACL to apply to the object, or 'none' to omit the ACL")
+	flags.StringVar(&checksumName, "checksum", "", "Checksum to send with the upload so that S3 rejects a corrupted transfer: 'md5', 'crc32', 'crc32c', 'crc64nvme', 'sha1', or 'sha256'")
+	flags.StringVar(&contentType, "content-type", "", "Content-Type of the object (defaults to the type of the key's extension, or the type detected from the contents)")
+	flags.StringVar(&encryptionPassphraseFile, "encryption-passphrase-file", "", "File containing a passphrase to encrypt the object with on the client before uploading it (see 'download -encryption-passphrase-file')")
+	flags.StringVar(&key, "key", "", "Key to upload to, relative to the prefix, e.g. 'backups/db.sql.gz'")
+	flags.IntVar(&maxRetries, "max-retries", 3, "Number of times to retry an upload of a file that failed with a transient error; standard input can't be retried")
+	flags.Var(&metadataPairs, "metadata", "User metadata to store with the object, as '<key>=<value>' (repeatable)")
+	flags.IntVar(&partSize, "part-size", int(manager.DefaultUploadPartSize/mebibyte), "Size in MiB of the parts the upload is split into; a stream can have at most 10,000 parts")
+	flags.StringVar(&sseMode, "sse", "", "Server-side encryption to request: 'AES256', 'aws:kms', or 'aws:kms:dsse'")
+	flags.StringVar(&sseCustomerKeyFile, "sse-c-key-file", "", "File containing a 256-bit key for server-side encryption with a customer-provided key (SSE-C)")
+	flags.StringVar(&sseKMSKeyID, "sse-kms-key-id", "", "KMS key to encrypt with when using 'aws:kms' or 'aws:kms:dsse' encryption")
+	flags.Var(&tagPairs, "tag", "S3 object tag to apply to the object, as '<key>=<value>' (repeatable)")
+	flags.IntVar(&partConcurrency, "upload-concurrency", manager.DefaultUploadConcurrency, "Number of parts to upload in parallel")
+	sources := parseInterspersed(flags, args)
+
+	if _, err := common.applyConfig(flags); err != nil {
+		log.Fatal(err)
+	}
+
+	if len(sources) != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	key = strings.TrimPrefix(key, "/")
+	if key == "" || strings.HasSuffix(key, "/") {
+		log.Fatal("The '-key' flag must give the key to upload to, e.g. 'backups/db.sql.gz'.")
+	}
+
+	fileACL, err := parseACL(common.preset.objectACL(acl, flagGiven(flags, "acl")))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	metadata, err := parseKeyValues(metadataPairs)
+	if err != nil {
+		log.Fatal("Invalid metadata: ", err)
+	}
+
+	if err := validateMetadata(metadata); err != nil {
+		log.Fatal(err)
+	}
+
+	tags, err := parseKeyValues(tagPairs)
+	if err != nil {
+		log.Fatal("Invalid tag: ", err)
+	}
+
+	if _, err := encodeTags(tags); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := common.preset.checkTags(tags, common.provider); err != nil {
+		log.Fatal(err)
+	}
+
+	encryption, err := newServerSideEncryption(sseMode, sseKMSKeyID, sseCustomerKeyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	passphraseEncryption, err := newClientEncryption(encryptionPassphraseFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	checksum, err := parseChecksum(checksumName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	multipart, err := newMultipartSettings(partSize, partConcurrency, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	body, err := openPutSource(sources[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer body.Close()
+
+	ctx, stop := newSignalContext()
+	defer stop()
+
+	store, err := newBackend(ctx, &common, backendOptions{
+		ACL:        fileACL,
+		Metadata:   metadata,
+		Tags:       tags,
+		Encryption: encryption,
+		Checksum:   checksum,
+		Multipart:  multipart,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var objectUploader uploader = newRetryUploader(store, maxRetries)
+	if passphraseEncryption != nil {
+		objectUploader = &encryptUploader{encryption: passphraseEncryption, next: objectUploader}
+	}
+
+	objectUploader = &contentTypeUploader{defaultType: "application/octet-stream", next: objectUploader}
+
+	size, err := putObject(ctx, objectUploader, key, body, contentType)
+	if err != nil {
+		log.Fatal("Upload failed: ", err)
+	}
+
+	log.Printf("Uploaded %s (%s)\n", key, formatBytes(size))
+}
+
+// openPutSource opens the file to upload, or standard input for `-`. Standard input is hidden
+// behind a plain reader, since a pipe can't seek even though *os.File implements io.Seeker, and
+// uploaders treat seekable bodies as having a known size.
+func openPutSource(name string) (io.ReadCloser, error) {
+	if name == "-" {
+		return io.NopCloser(struct{ io.Reader }{os.Stdin}), nil
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %v", name, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("could not open %s: %v", name, err)
+	}
+
+	if !info.Mode().IsRegular() {
+		file.Close()
+		return nil, fmt.Errorf("can't upload %s: not a regular file; use '-' and redirect it to standard input instead", name)
+	}
+
+	return file, nil
+}
+
+// putObject uploads a body of unknown length to a key, and returns the number of bytes uploaded.
+// The content type, if not given, is that of the key's extension; if the extension isn't
+// recognized, the uploader is left to determine it.
+func putObject(ctx context.Context, client uploader, key string, body io.Reader, contentType string) (int64, error) {
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(key))
+	}
+
+	counter := &countingReader{r: body, progress: &progress{}}
+	object := &uploadObject{Path: key, Body: counter, ContentType: contentType}
+	if seeker, ok := body.(io.Seeker); ok {
+		object.Body = &countingReadSeeker{countingReader: counter, s: seeker}
+	}
+
+	if err := client.Upload(ctx, object); err != nil {
+		return 0, err
+	}
+
+	return counter.n, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_putObject(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		key             string
+		contentType     string
+		uploadErr       error
+		wantContentType string
+		wantErr         bool
+	}{
+		{desc: "type of extension", key: "exports/data.json", wantContentType: "application/json"},
+		{desc: "unknown extension", key: "backups/db.dump", wantContentType: ""},
+		{desc: "given type", key: "backups/db.sql.gz", contentType: "application/gzip", wantContentType: "application/gzip"},
+		{desc: "failed upload", key: "backups/db.dump", uploadErr: errors.New("access denied"), wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockUploader{uploadErr: tC.uploadErr}
+			_, err := putObject(context.Background(), client, tC.key, strings.NewReader("SELECT 1;\n"), tC.contentType)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if tC.wantErr {
+				return
+			}
+
+			if client.uploadedObject.Path != tC.key {
+				t.Errorf("Expected key %q; got %q", tC.key, client.uploadedObject.Path)
+			}
+
+			if client.uploadedObject.ContentType != tC.wantContentType {
+				t.Errorf("Expected content type %q; got %q", tC.wantContentType, client.uploadedObject.ContentType)
+			}
+		})
+	}
+}
+
+func Test_putObject_size(t *testing.T) {
+	client := &recordingUploader{}
+
+	size, err := putObject(context.Background(), client, "backups/db.dump", strings.NewReader("SELECT 1;\n"), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if size != 10 {
+		t.Errorf("Expected 10 bytes; got %d", size)
+	}
+
+	if len(client.bodies) != 1 || client.bodies[0] != "SELECT 1;\n" {
+		t.Errorf("Expected the body to be uploaded; got %q", client.bodies)
+	}
+}
+
+func Test_openPutSource(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "dump.sql")
+	if err := os.WriteFile(name, []byte("SELECT 1;\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		desc     string
+		name     string
+		wantSeek bool
+		wantErr  bool
+	}{
+		{desc: "standard input", name: "-", wantSeek: false},
+		{desc: "file", name: name, wantSeek: true},
+		{desc: "directory", name: dir, wantErr: true},
+		{desc: "missing file", name: filepath.Join(dir, "missing.sql"), wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			body, err := openPutSource(tC.name)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if tC.wantErr {
+				return
+			}
+			defer body.Close()
+
+			if _, ok := body.(io.Seeker); ok != tC.wantSeek {
+				t.Errorf("Expected seekable: %v; got %v", tC.wantSeek, ok)
+			}
+		})
+	}
+}
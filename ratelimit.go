@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/aws/smithy-go/middleware"
+)
+
+// requestLimiter spaces requests evenly so that no more than a given number are sent per second,
+// for providers and proxies that throttle on the number of requests rather than on bandwidth.
+type requestLimiter struct {
+	// interval is the time between two requests.
+	interval time.Duration
+
+	mu sync.Mutex
+	// next is the earliest time the next request may be sent at.
+	next time.Time
+}
+
+// maxRequestInterval caps the time between two requests, which very low rates would otherwise
+// stretch beyond the range of a duration.
+const maxRequestInterval = time.Hour
+
+func newRequestLimiter(perSecond float64) *requestLimiter {
+	interval := maxRequestInterval
+	if seconds := 1 / perSecond; seconds < interval.Seconds() {
+		interval = time.Duration(seconds * float64(time.Second))
+	}
+
+	return &requestLimiter{interval: interval}
+}
+
+// Wait blocks until the next request may be sent, or the context is cancelled. It is safe to call
+// on a nil limiter, which never blocks.
+func (l *requestLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	at := l.next
+	if now := time.Now(); at.Before(now) {
+		at = now
+	}
+
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := time.Until(at)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// applyRequestRate validates `-rps` and creates the limiter shared by every client of the run.
+func (c *commonFlags) applyRequestRate() error {
+	if c.requestRate < 0 || math.IsNaN(c.requestRate) || math.IsInf(c.requestRate, 0) {
+		return fmt.Errorf("invalid request rate %v; expected a positive number of requests per second", c.requestRate)
+	}
+
+	if c.requestRate > 0 && c.requests == nil {
+		c.requests = newRequestLimiter(c.requestRate)
+	}
+
+	return nil
+}
+
+// withRequestLimit waits for the limiter before sending each request. It runs after the SDK's
+// retries, so that every attempt counts, including the requests of the transfer manager and
+// paginators.
+func withRequestLimit(limiter *requestLimiter) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("RequestLimit", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+			if err := limiter.Wait(ctx); err != nil {
+				return middleware.FinalizeOutput{}, middleware.Metadata{}, err
+			}
+
+			return next.HandleFinalize(ctx, in)
+		}), middleware.After)
+	}
+}
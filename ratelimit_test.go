@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func Test_commonFlags_applyRequestRate(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		rate        float64
+		wantErr     bool
+		wantLimiter bool
+	}{
+		{desc: "not given"},
+		{desc: "positive", rate: 10, wantLimiter: true},
+		{desc: "fractional", rate: 0.5, wantLimiter: true},
+		{desc: "negative", rate: -1, wantErr: true},
+		{desc: "not a number", rate: math.NaN(), wantErr: true},
+		{desc: "infinite", rate: math.Inf(1), wantErr: true},
+		{desc: "tiny", rate: 1e-12, wantLimiter: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			flags := commonFlags{requestRate: tC.rate}
+
+			err := flags.applyRequestRate()
+			if (err == nil) == tC.wantErr {
+				t.Errorf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if (flags.requests != nil) != tC.wantLimiter {
+				t.Errorf("Expected a limiter: %v; got %v", tC.wantLimiter, flags.requests)
+			}
+		})
+	}
+}
+
+func Test_requestLimiter(t *testing.T) {
+	limiter := newRequestLimiter(100)
+
+	start := time.Now()
+	for range 4 {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// The first request is sent right away, and each following one 10ms after the previous one.
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Expected 4 requests to take at least 30ms; took %v", elapsed)
+	}
+}
+
+func Test_newRequestLimiter(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		perSecond float64
+		want      time.Duration
+	}{
+		{desc: "many", perSecond: 100, want: 10 * time.Millisecond},
+		{desc: "fractional", perSecond: 0.5, want: 2 * time.Second},
+		{desc: "one per hour", perSecond: 1.0 / 3600, want: time.Hour},
+		{desc: "tiny", perSecond: 1e-12, want: maxRequestInterval},
+		{desc: "smallest", perSecond: math.SmallestNonzeroFloat64, want: maxRequestInterval},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := newRequestLimiter(tC.perSecond).interval; got != tC.want {
+				t.Errorf("Expected an interval of %v; got %v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_requestLimiter_cancelled(t *testing.T) {
+	limiter := newRequestLimiter(0.01)
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the wait to end with the context; got %v", err)
+	}
+}
+
+func Test_requestLimiter_nil(t *testing.T) {
+	var limiter *requestLimiter
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Errorf("Expected a nil limiter to never block; got %v", err)
+	}
+}
+
+func Test_commonFlags_newClient_requestRate(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_CA_BUNDLE", "")
+
+	common := commonFlags{region: "eu-west-1", bucket: "my-site", requestRate: 50}
+	if err := common.applyRequestRate(); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := common.newClient(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := &hostRecorder{}
+	start := time.Now()
+	for range 3 {
+		_, err = client.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{Bucket: aws.String("my-site")}, func(o *s3.Options) {
+			o.HTTPClient = recorder
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(recorder.hosts) != 3 {
+		t.Fatalf("Expected 3 requests; got %d", len(recorder.hosts))
+	}
+
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Expected 3 requests at 50 per second to take at least 40ms; took %v", elapsed)
+	}
+}
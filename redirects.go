@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultRedirectsPath is the redirects file that is read, if it exists, when `-redirects` isn't
+// given. It uses the same name and syntax as Netlify's.
+const defaultRedirectsPath = "_redirects"
+
+// redirectHeader stores the target of a redirect with an object, which S3 website hosting answers
+// with a 301 redirect.
+const redirectHeader = "X-Amz-Website-Redirect-Location"
+
+// redirect is a page that moved.
+type redirect struct {
+	// From is the path of the page that moved, e.g. `/old-page`.
+	From string `yaml:"from"`
+	// To is where the page moved to: a path starting with `/`, or an absolute URL.
+	To string `yaml:"to"`
+}
+
+// Key returns the key of the object holding the redirect. Paths ending in `/` are requested as
+// their index document.
+func (r redirect) Key() string {
+	key := strings.TrimPrefix(r.From, "/")
+	if key == "" || strings.HasSuffix(key, "/") {
+		key += indexDocument
+	}
+
+	return key
+}
+
+// validate checks that the redirect can be expressed as an object.
+func (r redirect) validate() error {
+	if !strings.HasPrefix(r.From, "/") {
+		return fmt.Errorf("invalid redirect from %q: the path must start with '/'", r.From)
+	}
+
+	if strings.ContainsAny(r.From, "*?#") || strings.Contains(r.From, "/:") {
+		return fmt.Errorf("unsupported redirect from %q: S3 doesn't support splats, placeholders, or query parameters", r.From)
+	}
+
+	if !strings.HasPrefix(r.To, "/") && !strings.HasPrefix(r.To, "http://") && !strings.HasPrefix(r.To, "https://") {
+		return fmt.Errorf("invalid redirect to %q: the target must start with '/', 'http://', or 'https://'", r.To)
+	}
+
+	return nil
+}
+
+// loadRedirects reads the redirects file at the given path. A missing file results in no
+// redirects, unless the file is required.
+func loadRedirects(path string, required bool) ([]redirect, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not read redirects file: %v", err)
+	}
+	defer file.Close()
+
+	redirects, err := parseRedirects(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse redirects file %s: %v", path, err)
+	}
+
+	return redirects, nil
+}
+
+// parseRedirects parses redirects in Netlify's `_redirects` syntax, with one `<from> <to>
+// [status]` rule per line and lines starting with `#` being comments. Only permanent and temporary redirects are
+// supported, since S3 can't rewrite or proxy requests, and every redirect is permanent.
+func parseRedirects(r io.Reader) ([]redirect, error) {
+	var redirects []redirect
+
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: expected '<from> <to> [status]'", lineNumber)
+		}
+
+		if len(fields) == 3 {
+			status, err := strconv.Atoi(strings.TrimSuffix(fields[2], "!"))
+			if err != nil || status < 301 || status > 308 || status == 304 || status == 305 || status == 306 {
+				return nil, fmt.Errorf("line %d: unsupported status %q; only redirects are supported", lineNumber, fields[2])
+			}
+		}
+
+		r := redirect{From: fields[0], To: fields[1]}
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+
+		redirects = append(redirects, r)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return redirects, nil
+}
+
+// uploadRedirect creates an empty object with the redirect's target.
+func uploadRedirect(ctx context.Context, client uploader, r redirect) error {
+	err := client.Upload(ctx, &uploadObject{
+		Path:        r.Key(),
+		Body:        bytes.NewReader(nil),
+		ContentType: "text/html; charset=utf-8",
+		Headers:     map[string]string{redirectHeader: r.To},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create redirect from %s: %v", r.From, err)
+	}
+
+	return nil
+}
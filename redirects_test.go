@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_parseRedirects(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		input   string
+		want    []redirect
+		wantErr bool
+	}{
+		{
+			desc: "rules and comments",
+			input: `# Moved pages
+/old-page /new-page
+/blog/   https://blog.example.com/   301
+
+/docs/v1/intro  /docs/v2/intro#start  302!
+`,
+			want: []redirect{
+				{From: "/old-page", To: "/new-page"},
+				{From: "/blog/", To: "https://blog.example.com/"},
+				{From: "/docs/v1/intro", To: "/docs/v2/intro#start"},
+			},
+		},
+		{desc: "empty file", input: ""},
+		{desc: "missing target", input: "/old-page\n", wantErr: true},
+		{desc: "rewrite", input: "/app/* /index.html 200\n", wantErr: true},
+		{desc: "splat", input: "/news/* /blog/:splat 301\n", wantErr: true},
+		{desc: "placeholder", input: "/news/:year /blog/:year\n", wantErr: true},
+		{desc: "relative path", input: "old-page /new-page\n", wantErr: true},
+		{desc: "relative target", input: "/old-page new-page\n", wantErr: true},
+		{desc: "conditions", input: "/ /fr/ 302 Language=fr\n", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := parseRedirects(strings.NewReader(tC.input))
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("Expected %+v; got %+v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_redirect_Key(t *testing.T) {
+	testCases := []struct {
+		from string
+		want string
+	}{
+		{from: "/old-page", want: "old-page"},
+		{from: "/blog/", want: "blog/index.html"},
+		{from: "/", want: "index.html"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.from, func(t *testing.T) {
+			if got := (redirect{From: tC.from}).Key(); got != tC.want {
+				t.Errorf("Expected %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_loadRedirects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "_redirects")
+
+	if redirects, err := loadRedirects(path, false); err != nil || redirects != nil {
+		t.Errorf("Expected a missing optional file to result in no redirects; got %v, %v", redirects, err)
+	}
+
+	if _, err := loadRedirects(path, true); err == nil {
+		t.Error("Expected an error for a missing required file")
+	}
+
+	os.WriteFile(path, []byte("/old /new\n"), 0o644)
+	redirects, err := loadRedirects(path, false)
+	if err != nil || len(redirects) != 1 {
+		t.Errorf("Expected a single redirect; got %v, %v", redirects, err)
+	}
+}
+
+func Test_uploadRedirect(t *testing.T) {
+	next := &recordingUploader{}
+	if err := uploadRedirect(context.Background(), next, redirect{From: "/blog/", To: "https://blog.example.com/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	object := next.objects[0]
+	if object.Path != "blog/index.html" || next.bodies[0] != "" {
+		t.Errorf("Expected an empty object at blog/index.html; got %s with %q", object.Path, next.bodies[0])
+	}
+
+	if object.Headers[redirectHeader] != "https://blog.example.com/" {
+		t.Errorf("Expected the redirect target in the headers; got %v", object.Headers)
+	}
+
+	failing := &mockUploader{uploadErr: errors.New("boom")}
+	if err := uploadRedirect(context.Background(), failing, redirect{From: "/old", To: "/new"}); err == nil {
+		t.Error("Expected the upload error to be returned")
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// runVerifyReplica implements the `verify-replica` command, which compares the objects under a
+// prefix with those of a replica, e.g. a bucket kept in sync by cross-region replication. The
+// command exits with status 1 when they differ, so that the replication can be monitored.
+func runVerifyReplica(cmd command, args []string) {
+	var common, replica commonFlags
+	var grace time.Duration
+	var checksums, jsonOutput bool
+	var include, exclude stringList
+
+	flags := newFlagSet(cmd, "[flags]")
+	common.register(flags)
+	flags.BoolVar(&checksums, "checksums", false, "Compare the stored checksums of objects whose ETags differ, e.g. because the buckets encrypt them with different KMS keys")
+	flags.Var(&exclude, "exclude", "Glob pattern of objects to skip (repeatable)")
+	flags.DurationVar(&grace, "grace", 0, "Ignore objects modified in the source within this long, whose replication may still be pending, e.g. '15m'")
+	flags.Var(&include, "include", "Glob pattern of objects to compare; if given, other objects are skipped (repeatable)")
+	flags.BoolVar(&jsonOutput, "json", false, "Print the differences as JSON")
+	flags.StringVar(&replica.bucket, "replica-bucket", "", "Bucket holding the replica (defaults to the source bucket)")
+	flags.StringVar(&replica.endpoint, "replica-endpoint", "", "AWS endpoint of the replica (defaults to the source endpoint)")
+	flags.StringVar(&replica.prefix, "replica-prefix", "", "Key prefix of the replica (defaults to the source prefix)")
+	flags.StringVar(&replica.profile, "replica-profile", "", "Named profile to use for the replica (defaults to the source profile)")
+	flags.StringVar(&replica.region, "replica-region", "", "AWS region of the replica (defaults to the source region)")
+	flags.Parse(args)
+
+	if _, err := common.applyConfig(flags); err != nil {
+		log.Fatal(err)
+	}
+
+	if grace < 0 {
+		log.Fatal("The '-grace' flag can't be negative.")
+	}
+
+	// Replica settings that weren't given are the same as the source's.
+	for _, setting := range []struct {
+		target *string
+		source string
+	}{
+		{target: &replica.bucket, source: common.bucket},
+		{target: &replica.credentialProcess, source: common.credentialProcess},
+		{target: &replica.endpoint, source: common.endpoint},
+		{target: &replica.prefix, source: common.prefix},
+		{target: &replica.profile, source: common.profile},
+		{target: &replica.region, source: common.region},
+	} {
+		if *setting.target == "" {
+			*setting.target = setting.source
+		}
+	}
+
+	if replica.endpoint == common.endpoint {
+		replica.dev = common.dev
+		replica.pathStyle = common.pathStyle
+		replica.endpoints = common.endpoints
+		// Transfer Acceleration is enabled per bucket.
+		replica.endpoints.accelerate = replica.bucket == common.bucket && common.endpoints.accelerate
+	}
+
+	replica.role = common.role
+	replica.requestPayer = common.requestPayer
+	replica.requests = common.requests
+	replica.network = common.network
+
+	sourcePrefix := normalizePrefix(common.prefix)
+	replicaPrefix := normalizePrefix(replica.prefix)
+	if replica.bucket == common.bucket && replicaPrefix == sourcePrefix {
+		log.Fatal("The source and replica are the same; use '-replica-bucket' or '-replica-prefix' to choose the replica.")
+	}
+
+	filter, err := newPathFilter(include, exclude)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := newSignalContext()
+	defer stop()
+
+	sourceClient, err := common.newClient(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	replicaClient, err := replica.newClient(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	source, err := listObjects(ctx, sourceClient, common.bucket, sourcePrefix)
+	if err != nil {
+		log.Fatal("Could not list source objects: ", err)
+	}
+
+	replicated, err := listObjects(ctx, replicaClient, replica.bucket, replicaPrefix)
+	if err != nil {
+		log.Fatal("Could not list replica objects: ", err)
+	}
+
+	diff := compareReplica(source, replicated, filter, time.Now().Add(-grace))
+
+	if checksums {
+		diff, err = diff.resolveChecksums(
+			ctx,
+			&s3ChecksumReader{client: sourceClient, bucket: common.bucket, prefix: sourcePrefix},
+			&s3ChecksumReader{client: replicaClient, bucket: replica.bucket, prefix: replicaPrefix},
+		)
+		if err != nil {
+			log.Fatal("Could not compare checksums: ", err)
+		}
+	}
+
+	if jsonOutput {
+		err = diff.WriteJSON(os.Stdout)
+	} else {
+		err = diff.WriteText(os.Stdout)
+	}
+
+	if err != nil {
+		log.Fatal("Could not write diff: ", err)
+	}
+
+	if !diff.Empty() {
+		os.Exit(1)
+	}
+}
+
+// replicaDiff lists the differences between the objects of a source and its replica.
+type replicaDiff struct {
+	// Missing are the objects that don't exist in the replica.
+	Missing []string `json:"missing"`
+	// Extra are the objects that only exist in the replica.
+	Extra []string `json:"extra"`
+	// Changed are the objects whose size or contents differ between the source and the replica.
+	Changed []string `json:"changed"`
+	// Pending are the objects that differ but were modified in the source too recently for their
+	// replication to have finished. They aren't counted as drift.
+	Pending []string `json:"pending"`
+
+	// sizeMatches are the changed objects whose size is the same, which may still have the same
+	// contents if their ETags aren't MD5 hashes.
+	sizeMatches map[string]bool
+}
+
+// compareReplica compares the source objects with the replicated ones by their size and ETag.
+// Objects that differ but were modified in the source after `settled` are listed as pending.
+func compareReplica(source, replica map[string]remoteObject, filter pathFilter, settled time.Time) replicaDiff {
+	diff := replicaDiff{Missing: []string{}, Extra: []string{}, Changed: []string{}, Pending: []string{}, sizeMatches: map[string]bool{}}
+
+	for key, object := range source {
+		if !filter.Match(key) {
+			continue
+		}
+
+		replicated, ok := replica[key]
+		if ok && replicated.Size == object.Size && replicated.ETag == object.ETag {
+			continue
+		}
+
+		switch {
+		case object.LastModified.After(settled):
+			diff.Pending = append(diff.Pending, key)
+		case !ok:
+			diff.Missing = append(diff.Missing, key)
+		default:
+			diff.Changed = append(diff.Changed, key)
+			diff.sizeMatches[key] = replicated.Size == object.Size
+		}
+	}
+
+	for key := range replica {
+		if _, ok := source[key]; !ok && filter.Match(key) {
+			diff.Extra = append(diff.Extra, key)
+		}
+	}
+
+	sort.Strings(diff.Missing)
+	sort.Strings(diff.Extra)
+	sort.Strings(diff.Changed)
+	sort.Strings(diff.Pending)
+
+	return diff
+}
+
+// checksumReader reads the checksum stored with an object.
+type checksumReader interface {
+	// Checksum returns the checksum of the object with the given key, prefixed with its
+	// algorithm, or an empty string if the object has none.
+	Checksum(ctx context.Context, key string) (string, error)
+}
+
+// resolveChecksums compares the stored checksums of the changed objects whose size matches, and
+// no longer lists those whose checksums are the same. Objects without a checksum stay listed.
+func (d replicaDiff) resolveChecksums(ctx context.Context, source, replica checksumReader) (replicaDiff, error) {
+	var changed []string
+	for _, key := range d.Changed {
+		if !d.sizeMatches[key] {
+			changed = append(changed, key)
+			continue
+		}
+
+		sourceChecksum, err := source.Checksum(ctx, key)
+		if err != nil {
+			return replicaDiff{}, err
+		}
+
+		replicaChecksum, err := replica.Checksum(ctx, key)
+		if err != nil {
+			return replicaDiff{}, err
+		}
+
+		if sourceChecksum == "" || sourceChecksum != replicaChecksum {
+			changed = append(changed, key)
+		}
+	}
+
+	d.Changed = append([]string{}, changed...)
+
+	return d, nil
+}
+
+// Empty reports whether the replica has drifted from the source, not counting pending objects.
+func (d replicaDiff) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Extra) == 0 && len(d.Changed) == 0
+}
+
+// WriteText writes the differences in a human-readable format, marking objects missing from the
+// replica with `-`, objects only in the replica with `+`, changed objects with `~`, and pending
+// objects with `?`.
+func (d replicaDiff) WriteText(w io.Writer) error {
+	for _, group := range []struct {
+		marker string
+		keys   []string
+	}{
+		{marker: "-", keys: d.Missing},
+		{marker: "+", keys: d.Extra},
+		{marker: "~", keys: d.Changed},
+		{marker: "?", keys: d.Pending},
+	} {
+		for _, key := range group.keys {
+			if _, err := fmt.Fprintf(w, "%s %s\n", group.marker, key); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := fmt.Fprintf(
+		w,
+		"\n%d missing, %d extra, %d changed, %d pending\n",
+		len(d.Missing),
+		len(d.Extra),
+		len(d.Changed),
+		len(d.Pending),
+	)
+
+	return err
+}
+
+// WriteJSON writes the differences as a JSON object.
+func (d replicaDiff) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(d)
+}
+
+// s3ChecksumReader reads the checksums S3 stores for objects uploaded with one, e.g. with
+// `-checksum`. Unlike ETags, they are the same for every copy of an object regardless of its
+// encryption.
+type s3ChecksumReader struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func (r *s3ChecksumReader) Checksum(ctx context.Context, key string) (string, error) {
+	output, err := r.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(r.bucket),
+		Key:          aws.String(r.prefix + key),
+		ChecksumMode: types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read S3 object %s: %v", key, err)
+	}
+
+	return storedChecksum(output), nil
+}
+
+// storedChecksum returns the checksum of a HeadObject response, prefixed with its algorithm.
+func storedChecksum(output *s3.HeadObjectOutput) string {
+	for _, checksum := range []struct {
+		algorithm string
+		value     *string
+	}{
+		{algorithm: "CRC64NVME", value: output.ChecksumCRC64NVME},
+		{algorithm: "CRC32", value: output.ChecksumCRC32},
+		{algorithm: "CRC32C", value: output.ChecksumCRC32C},
+		{algorithm: "SHA1", value: output.ChecksumSHA1},
+		{algorithm: "SHA256", value: output.ChecksumSHA256},
+	} {
+		if value := aws.ToString(checksum.value); value != "" {
+			return checksum.algorithm + ":" + value
+		}
+	}
+
+	return ""
+}
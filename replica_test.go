@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func Test_compareReplica(t *testing.T) {
+	settled := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	old, recent := settled.Add(-time.Hour), settled.Add(time.Minute)
+
+	source := map[string]remoteObject{
+		"index.html":     {Key: "index.html", Size: 9, ETag: "aaa", LastModified: old},
+		"app.js":         {Key: "app.js", Size: 7, ETag: "bbb", LastModified: old},
+		"resized.png":    {Key: "resized.png", Size: 100, ETag: "ccc", LastModified: old},
+		"new.css":        {Key: "new.css", Size: 3, ETag: "ddd", LastModified: old},
+		"just-added.css": {Key: "just-added.css", Size: 3, ETag: "eee", LastModified: recent},
+		"drafts/a.html":  {Key: "drafts/a.html", Size: 3, ETag: "fff", LastModified: old},
+	}
+	replica := map[string]remoteObject{
+		"index.html":    {Key: "index.html", Size: 9, ETag: "aaa"},
+		"app.js":        {Key: "app.js", Size: 7, ETag: "other"},
+		"resized.png":   {Key: "resized.png", Size: 80, ETag: "ccc"},
+		"old.html":      {Key: "old.html", Size: 3},
+		"drafts/b.html": {Key: "drafts/b.html", Size: 3},
+	}
+
+	testCases := []struct {
+		desc    string
+		exclude []string
+		want    replicaDiff
+	}{
+		{
+			desc: "all objects",
+			want: replicaDiff{
+				Missing: []string{"drafts/a.html", "new.css"},
+				Extra:   []string{"drafts/b.html", "old.html"},
+				Changed: []string{"app.js", "resized.png"},
+				Pending: []string{"just-added.css"},
+			},
+		},
+		{
+			desc:    "excluded objects",
+			exclude: []string{"drafts/**"},
+			want: replicaDiff{
+				Missing: []string{"new.css"},
+				Extra:   []string{"old.html"},
+				Changed: []string{"app.js", "resized.png"},
+				Pending: []string{"just-added.css"},
+			},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			filter, err := newPathFilter(nil, tC.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := compareReplica(source, replica, filter, settled)
+			if !reflect.DeepEqual(got.Missing, tC.want.Missing) || !reflect.DeepEqual(got.Extra, tC.want.Extra) || !reflect.DeepEqual(got.Changed, tC.want.Changed) || !reflect.DeepEqual(got.Pending, tC.want.Pending) {
+				t.Errorf("Expected %+v; got %+v", tC.want, got)
+			}
+
+			if !got.sizeMatches["app.js"] || got.sizeMatches["resized.png"] {
+				t.Errorf("Unexpected size matches: %v", got.sizeMatches)
+			}
+		})
+	}
+}
+
+// mockChecksumReader returns the checksums of a map, keyed by object key.
+type mockChecksumReader struct {
+	checksums map[string]string
+	err       error
+	read      []string
+}
+
+func (r *mockChecksumReader) Checksum(ctx context.Context, key string) (string, error) {
+	r.read = append(r.read, key)
+	return r.checksums[key], r.err
+}
+
+func Test_replicaDiff_resolveChecksums(t *testing.T) {
+	diff := replicaDiff{
+		Changed:     []string{"app.js", "index.html", "resized.png", "unchecked.txt"},
+		sizeMatches: map[string]bool{"app.js": true, "index.html": true, "unchecked.txt": true},
+	}
+
+	testCases := []struct {
+		desc    string
+		source  mockChecksumReader
+		replica mockChecksumReader
+		want    []string
+		wantErr bool
+	}{
+		{
+			desc:    "matching checksums",
+			source:  mockChecksumReader{checksums: map[string]string{"app.js": "CRC32:abc", "index.html": "CRC32:def"}},
+			replica: mockChecksumReader{checksums: map[string]string{"app.js": "CRC32:abc", "index.html": "CRC32:xyz"}},
+			want:    []string{"index.html", "resized.png", "unchecked.txt"},
+		},
+		{
+			desc: "no checksums",
+			want: []string{"app.js", "index.html", "resized.png", "unchecked.txt"},
+		},
+		{
+			desc:    "error",
+			source:  mockChecksumReader{err: errors.New("access denied")},
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := diff.resolveChecksums(context.Background(), &tC.source, &tC.replica)
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(got.Changed, tC.want) {
+				t.Errorf("Expected %v to be changed; got %v", tC.want, got.Changed)
+			}
+
+			for _, key := range tC.source.read {
+				if key == "resized.png" {
+					t.Error("Expected objects of different sizes not to be read")
+				}
+			}
+		})
+	}
+}
+
+func Test_replicaDiff_WriteText(t *testing.T) {
+	diff := replicaDiff{
+		Missing: []string{"new.css"},
+		Extra:   []string{},
+		Changed: []string{"index.html"},
+		Pending: []string{"about.html"},
+	}
+
+	var buf bytes.Buffer
+	if err := diff.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "- new.css\n~ index.html\n? about.html\n\n1 missing, 0 extra, 1 changed, 1 pending\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Expected %q; got %q", want, got)
+	}
+
+	if diff.Empty() {
+		t.Error("Expected the diff not to be empty")
+	}
+
+	if !(replicaDiff{Pending: []string{"about.html"}}).Empty() {
+		t.Error("Expected pending objects not to count as drift")
+	}
+}
+
+func Test_storedChecksum(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		output s3.HeadObjectOutput
+		want   string
+	}{
+		{desc: "none", want: ""},
+		{desc: "crc32", output: s3.HeadObjectOutput{ChecksumCRC32: aws.String("abc=")}, want: "CRC32:abc="},
+		{desc: "sha256", output: s3.HeadObjectOutput{ChecksumSHA256: aws.String("def=")}, want: "SHA256:def="},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := storedChecksum(&tC.output); got != tC.want {
+				t.Errorf("Expected %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// failureReport is the machine-readable summary of a run that continued past failed uploads.
+type failureReport struct {
+	Completed int                  `json:"completed"`
+	Failed    []failureReportEntry `json:"failed"`
+}
+
+// failureReportEntry describes a single file that could not be uploaded.
+type failureReportEntry struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// writeFailureReport writes a JSON report of the completed and failed uploads to `w`.
+func writeFailureReport(w io.Writer, completed int, failures uploadErrors) error {
+	report := failureReport{
+		Completed: completed,
+		Failed:    make([]failureReportEntry, len(failures)),
+	}
+
+	for i, failure := range failures {
+		report.Failed[i] = failureReportEntry{Path: failure.Path, Error: failure.Error()}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(report)
+}
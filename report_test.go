@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func Test_writeFailureReport(t *testing.T) {
+	var out bytes.Buffer
+	failures := uploadErrors{
+		{Path: "a.txt", Err: errors.New("failed to upload a.txt: access denied")},
+	}
+
+	if err := writeFailureReport(&out, 3, failures); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := `{
+  "completed": 3,
+  "failed": [
+    {
+      "path": "a.txt",
+      "error": "failed to upload a.txt: access denied"
+    }
+  ]
+}
+`
+	if out.String() != want {
+		t.Errorf("Expected report:\n%s\ngot:\n%s", want, out.String())
+	}
+}
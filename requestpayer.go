@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// requesterPays is the only value of `-request-payer`, acknowledging that the requester pays for
+// the requests and data transfer of Requester Pays buckets.
+const requesterPays = "requester"
+
+// applyRequestPayer validates `-request-payer`.
+func (c *commonFlags) applyRequestPayer() error {
+	if c.requestPayer != "" && c.requestPayer != requesterPays {
+		return fmt.Errorf("invalid request payer '%s'; expected '%s'", c.requestPayer, requesterPays)
+	}
+
+	return nil
+}
+
+// withRequestPayer adds the x-amz-request-payer header to every request, before it's signed.
+// Requester Pays buckets deny requests from other accounts without it. Setting the header on each
+// operation's input instead would miss the requests the transfer manager and paginators make.
+func withRequestPayer(payer string) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Build.Add(middleware.BuildMiddlewareFunc("RequestPayer", func(ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler) (middleware.BuildOutput, middleware.Metadata, error) {
+			if req, ok := in.Request.(*smithyhttp.Request); ok {
+				req.Header.Set("X-Amz-Request-Payer", payer)
+			}
+
+			return next.HandleBuild(ctx, in)
+		}), middleware.After)
+	}
+}
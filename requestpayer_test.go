@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// payerRecorder is a hostRecorder that also records the request payer of the requests and whether
+// it was signed.
+type payerRecorder struct {
+	hostRecorder
+	payers []string
+	signed []bool
+}
+
+func (r *payerRecorder) Do(req *http.Request) (*http.Response, error) {
+	r.payers = append(r.payers, req.Header.Get("X-Amz-Request-Payer"))
+	r.signed = append(r.signed, strings.Contains(req.Header.Get("Authorization"), "x-amz-request-payer"))
+
+	return r.hostRecorder.Do(req)
+}
+
+func Test_commonFlags_applyRequestPayer(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		payer   string
+		wantErr bool
+	}{
+		{desc: "not given"},
+		{desc: "requester", payer: "requester"},
+		{desc: "bucket owner", payer: "BucketOwner", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			flags := commonFlags{requestPayer: tC.payer}
+
+			err := flags.applyRequestPayer()
+			if (err == nil) == tC.wantErr {
+				t.Errorf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_commonFlags_newClient_requestPayer(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_CA_BUNDLE", "")
+
+	testCases := []struct {
+		desc      string
+		payer     string
+		wantPayer string
+	}{
+		{desc: "not given"},
+		{desc: "requester", payer: "requester", wantPayer: "requester"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			recorder := &payerRecorder{}
+			common := commonFlags{region: "eu-west-1", bucket: "my-site", requestPayer: tC.payer}
+
+			client, err := common.newClient(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = client.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{Bucket: aws.String("my-site")}, func(o *s3.Options) {
+				o.HTTPClient = recorder
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(recorder.payers) != 1 || recorder.payers[0] != tC.wantPayer {
+				t.Errorf("Expected a request with payer %q; got %q", tC.wantPayer, recorder.payers)
+			}
+
+			if wantSigned := tC.wantPayer != ""; len(recorder.signed) != 1 || recorder.signed[0] != wantSigned {
+				t.Errorf("Expected the payer header to be signed: %v; got %v", wantSigned, recorder.signed)
+			}
+		})
+	}
+}
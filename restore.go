@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// archivedClasses are the storage classes whose objects may have to be restored before they can
+// be read. Objects in Intelligent-Tiering only do once they were moved to an archive tier.
+var archivedClasses = []types.ObjectStorageClass{
+	types.ObjectStorageClassGlacier,
+	types.ObjectStorageClassDeepArchive,
+	types.ObjectStorageClassIntelligentTiering,
+}
+
+// objectRestorer restores archived objects and reports their restore status.
+type objectRestorer interface {
+	RestoreObject(ctx context.Context, params *s3.RestoreObjectInput, optFns ...func(*s3.Options)) (*s3.RestoreObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+}
+
+// restoreResult is the outcome of requesting the restore of an object.
+type restoreResult int
+
+const (
+	// restoreRequested means that S3 accepted the request, or extended a completed restore.
+	restoreRequested restoreResult = iota
+	// restoreInProgress means that a previous request is still being processed.
+	restoreInProgress
+	// restoreNotArchived means that the object is in an Intelligent-Tiering access tier and can
+	// already be read.
+	restoreNotArchived
+)
+
+// restorer requests temporary copies of archived objects beneath a prefix.
+type restorer struct {
+	client objectRestorer
+	bucket string
+	prefix string
+	// days is how long restored copies of objects in S3 Glacier storage classes are kept.
+	days int32
+	// tier trades the speed of the restore for its cost.
+	tier types.Tier
+
+	mu       sync.Mutex
+	results  map[restoreResult]int
+	requests []string
+}
+
+// parseTier parses the value of the `-tier` flag, ignoring case.
+func parseTier(value string) (types.Tier, error) {
+	for _, tier := range types.Tier("").Values() {
+		if strings.EqualFold(value, string(tier)) {
+			return tier, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown restore tier %q; expected one of: Standard, Bulk, Expedited", value)
+}
+
+// Restore requests the restore of the object at the given key, relative to the prefix.
+// Intelligent-Tiering objects are moved back to an access tier instead of being copied, so no
+// number of days is given for them.
+func (r *restorer) Restore(ctx context.Context, key string, class types.ObjectStorageClass) (restoreResult, error) {
+	request := &types.RestoreRequest{GlacierJobParameters: &types.GlacierJobParameters{Tier: r.tier}}
+	if class != types.ObjectStorageClassIntelligentTiering {
+		request.Days = aws.Int32(r.days)
+	}
+
+	_, err := r.client.RestoreObject(ctx, &s3.RestoreObjectInput{
+		Bucket:         aws.String(r.bucket),
+		Key:            aws.String(r.prefix + key),
+		RestoreRequest: request,
+	})
+
+	var apiErr smithy.APIError
+	switch {
+	case err == nil:
+		return restoreRequested, nil
+	case errors.As(err, &apiErr) && apiErr.ErrorCode() == "RestoreAlreadyInProgress":
+		return restoreInProgress, nil
+	case errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidObjectState" && class == types.ObjectStorageClassIntelligentTiering:
+		return restoreNotArchived, nil
+	default:
+		return 0, err
+	}
+}
+
+// Restored reports whether the object at the given key, relative to the prefix, can be read.
+func (r *restorer) Restored(ctx context.Context, key string) (bool, error) {
+	output, err := r.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(r.prefix + key),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if output.Restore != nil {
+		return strings.Contains(*output.Restore, `ongoing-request="false"`), nil
+	}
+
+	// Intelligent-Tiering objects have no restore status once they're back in an access tier.
+	return output.StorageClass == types.StorageClassIntelligentTiering && output.ArchiveStatus == "", nil
+}
+
+// RestoreFunc returns a callback that requests the restore of each object, recording the keys of
+// the objects that are being restored.
+func (r *restorer) RestoreFunc(ctx context.Context) fs.WalkDirFunc {
+	return func(key string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("could not list %s: %v", key, err)
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		class := types.ObjectStorageClass(entry.(remoteEntry).object.StorageClass)
+		result, err := r.Restore(ctx, key, class)
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %v", key, err)
+		}
+
+		switch result {
+		case restoreRequested:
+			log.Printf("Requested restore of %s (%s)\n", key, class)
+		case restoreInProgress:
+			log.Printf("Restore of %s is already in progress\n", key)
+		}
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if r.results == nil {
+			r.results = map[restoreResult]int{}
+		}
+
+		r.results[result]++
+		if result != restoreNotArchived {
+			r.requests = append(r.requests, key)
+		}
+
+		return nil
+	}
+}
+
+// Wait polls the objects being restored every interval until all of them can be read, or the
+// context is cancelled.
+func (r *restorer) Wait(ctx context.Context, interval time.Duration) error {
+	pending := slices.Clone(r.requests)
+	sort.Strings(pending)
+
+	for {
+		var remaining []string
+		for _, key := range pending {
+			restored, err := r.Restored(ctx, key)
+			if err != nil {
+				return fmt.Errorf("could not check the restore of %s: %v", key, err)
+			}
+
+			if restored {
+				log.Printf("Restored %s\n", key)
+			} else {
+				remaining = append(remaining, key)
+			}
+		}
+
+		if len(remaining) == 0 {
+			return nil
+		}
+
+		pending = remaining
+		log.Printf("Waiting for %d object(s) to be restored\n", len(pending))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// archivedObjects returns the objects in the archived storage classes.
+func archivedObjects(objects map[string]remoteObject) map[string]remoteObject {
+	archived := map[string]remoteObject{}
+	for key, object := range objects {
+		if slices.Contains(archivedClasses, types.ObjectStorageClass(object.StorageClass)) {
+			archived[key] = object
+		}
+	}
+
+	return archived
+}
+
+// runRestore implements the `restore` command, which requests temporary copies of the archived
+// objects under a prefix, e.g. of old builds kept in S3 Glacier Deep Archive.
+func runRestore(cmd command, args []string) {
+	var common commonFlags
+	var tierName string
+	var concurrency, days int
+	var dryRunMode, wait bool
+	var pollInterval time.Duration
+	var include, exclude stringList
+
+	flags := newFlagSet(cmd, "[flags]")
+	common.register(flags)
+	flags.IntVar(&concurrency, "concurrency", 4, "Number of restore requests to send in parallel")
+	flags.IntVar(&days, "days", 7, "Number of days to keep the restored copies of objects in S3 Glacier storage classes")
+	flags.BoolVar(&dryRunMode, "dry-run", false, "Print the objects that would be restored without restoring them")
+	flags.Var(&exclude, "exclude", "Glob pattern of objects to skip (repeatable)")
+	flags.Var(&include, "include", "Glob pattern of objects to restore; if given, other objects are skipped (repeatable)")
+	flags.DurationVar(&pollInterval, "poll-interval", 5*time.Minute, "Time between checks of whether the objects were restored, with -wait")
+	flags.StringVar(&tierName, "tier", string(types.TierStandard), "Restore tier, trading speed for cost: 'Expedited' (minutes), 'Standard' (hours), or 'Bulk' (up to two days)")
+	flags.BoolVar(&wait, "wait", false, "Wait until every object was restored and can be downloaded")
+	flags.Parse(args)
+
+	if _, err := common.applyConfig(flags); err != nil {
+		log.Fatal(err)
+	}
+
+	if days < 1 {
+		log.Fatal("The '-days' flag must be at least 1.")
+	}
+
+	if flagGiven(flags, "poll-interval") && !wait {
+		log.Fatal("The '-poll-interval' flag can only be used together with '-wait'.")
+	}
+
+	tier, err := parseTier(tierName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	filter, err := newPathFilter(include, exclude)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := newSignalContext()
+	defer stop()
+
+	client, err := common.newClient(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	prefix := normalizePrefix(common.prefix)
+	objects, err := listObjects(ctx, client, common.bucket, prefix)
+	if err != nil {
+		log.Fatal("Could not list objects: ", err)
+	}
+
+	archived := archivedObjects(objects)
+	if len(archived) == 0 {
+		log.Printf("No archived objects under %s/%s\n", common.bucket, prefix)
+		return
+	}
+
+	store := &restorer{client: client, bucket: common.bucket, prefix: prefix, days: int32(days), tier: tier}
+
+	restoreFunc := store.RestoreFunc(ctx)
+	if dryRunMode {
+		restoreFunc = func(key string, entry fs.DirEntry, err error) error {
+			if err == nil && !entry.IsDir() {
+				fmt.Printf("%s (%s)\n", key, entry.(remoteEntry).object.StorageClass)
+			}
+
+			return err
+		}
+	}
+
+	pool := newUploadPool(ctx, concurrency, false, restoreFunc)
+	walkErr := walkRemote(archived, createFilterFunc(filter, pool.WalkDirFunc()))
+	poolErr := pool.Wait()
+	if ctx.Err() != nil {
+		log.Fatalf("Interrupted: %d restore(s) requested before cancellation.", pool.Completed())
+	}
+
+	if poolErr != nil {
+		log.Fatal("Restore failed: ", poolErr)
+	}
+
+	if walkErr != nil {
+		log.Fatal("Restore failed: ", walkErr)
+	}
+
+	if dryRunMode {
+		return
+	}
+
+	log.Printf(
+		"Requested %d restore(s); %d already in progress, %d not archived\n",
+		store.results[restoreRequested], store.results[restoreInProgress], store.results[restoreNotArchived],
+	)
+
+	if !wait || len(store.requests) == 0 {
+		return
+	}
+
+	if err := store.Wait(ctx, pollInterval); err != nil {
+		log.Fatal("Could not wait for the restore: ", err)
+	}
+
+	log.Printf("Restored %d object(s) under %s/%s\n", len(store.requests), common.bucket, prefix)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// mockObjectRestorer fails restore requests with the given error, and reports the restore status
+// of objects from a script of HeadObject responses, by key.
+type mockObjectRestorer struct {
+	restoreErr error
+	heads      map[string][]*s3.HeadObjectOutput
+	requests   []*s3.RestoreObjectInput
+}
+
+func (m *mockObjectRestorer) RestoreObject(ctx context.Context, params *s3.RestoreObjectInput, optFns ...func(*s3.Options)) (*s3.RestoreObjectOutput, error) {
+	m.requests = append(m.requests, params)
+	if m.restoreErr != nil {
+		return nil, m.restoreErr
+	}
+
+	return &s3.RestoreObjectOutput{}, nil
+}
+
+func (m *mockObjectRestorer) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	key := aws.ToString(params.Key)
+	responses := m.heads[key]
+	if len(responses) == 0 {
+		return nil, errors.New("unexpected HeadObject of " + key)
+	}
+
+	m.heads[key] = responses[1:]
+
+	return responses[0], nil
+}
+
+func Test_parseTier(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		value   string
+		want    types.Tier
+		wantErr bool
+	}{
+		{desc: "standard", value: "Standard", want: types.TierStandard},
+		{desc: "lower case", value: "bulk", want: types.TierBulk},
+		{desc: "unknown", value: "Instant", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := parseTier(tC.value)
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if got != tC.want {
+				t.Errorf("Expected tier %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_restorer_Restore(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		class    types.ObjectStorageClass
+		err      error
+		want     restoreResult
+		wantDays int32
+		wantErr  bool
+	}{
+		{desc: "glacier", class: types.ObjectStorageClassGlacier, want: restoreRequested, wantDays: 3},
+		{desc: "intelligent-tiering", class: types.ObjectStorageClassIntelligentTiering, want: restoreRequested},
+		{
+			desc:     "in progress",
+			class:    types.ObjectStorageClassDeepArchive,
+			err:      &smithy.GenericAPIError{Code: "RestoreAlreadyInProgress"},
+			want:     restoreInProgress,
+			wantDays: 3,
+		},
+		{
+			desc:  "not archived",
+			class: types.ObjectStorageClassIntelligentTiering,
+			err:   &smithy.GenericAPIError{Code: "InvalidObjectState"},
+			want:  restoreNotArchived,
+		},
+		{
+			desc:     "denied",
+			class:    types.ObjectStorageClassGlacier,
+			err:      &smithy.GenericAPIError{Code: "AccessDenied"},
+			wantDays: 3,
+			wantErr:  true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockObjectRestorer{restoreErr: tC.err}
+			store := &restorer{client: client, bucket: "my-site", prefix: "builds/", days: 3, tier: types.TierBulk}
+
+			got, err := store.Restore(context.Background(), "app.zip", tC.class)
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if got != tC.want {
+				t.Errorf("Expected result %v; got %v", tC.want, got)
+			}
+
+			request := client.requests[0]
+			if key := aws.ToString(request.Key); key != "builds/app.zip" {
+				t.Errorf("Expected a request for builds/app.zip; got %s", key)
+			}
+
+			if days := aws.ToInt32(request.RestoreRequest.Days); days != tC.wantDays {
+				t.Errorf("Expected %d days; got %d", tC.wantDays, days)
+			}
+
+			if tier := request.RestoreRequest.GlacierJobParameters.Tier; tier != types.TierBulk {
+				t.Errorf("Expected tier %q; got %q", types.TierBulk, tier)
+			}
+		})
+	}
+}
+
+func Test_restorer_Wait(t *testing.T) {
+	ongoing := &s3.HeadObjectOutput{Restore: aws.String(`ongoing-request="true"`)}
+	done := &s3.HeadObjectOutput{Restore: aws.String(`ongoing-request="false", expiry-date="Fri, 23 Dec 2026 00:00:00 GMT"`)}
+	tiered := &s3.HeadObjectOutput{StorageClass: types.StorageClassIntelligentTiering}
+
+	client := &mockObjectRestorer{heads: map[string][]*s3.HeadObjectOutput{
+		"a.zip": {ongoing, ongoing, done},
+		"b.zip": {done},
+		"c.zip": {tiered},
+	}}
+	store := &restorer{client: client, bucket: "my-site", requests: []string{"c.zip", "a.zip", "b.zip"}}
+
+	if err := store.Wait(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, remaining := range client.heads {
+		if len(remaining) > 0 {
+			t.Errorf("Expected %s to be polled until restored; %d response(s) left", key, len(remaining))
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	client.heads = map[string][]*s3.HeadObjectOutput{"a.zip": {ongoing}}
+	store.requests = []string{"a.zip"}
+	if err := store.Wait(ctx, time.Hour); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the wait to be cancelled; got %v", err)
+	}
+}
+
+func Test_archivedObjects(t *testing.T) {
+	objects := map[string]remoteObject{
+		"index.html":   {Key: "index.html", StorageClass: "STANDARD"},
+		"old/app.zip":  {Key: "old/app.zip", StorageClass: "DEEP_ARCHIVE"},
+		"old/logs.tar": {Key: "old/logs.tar", StorageClass: "GLACIER"},
+		"old/docs.pdf": {Key: "old/docs.pdf", StorageClass: "GLACIER_IR"},
+		"media/a.mp4":  {Key: "media/a.mp4", StorageClass: "INTELLIGENT_TIERING"},
+	}
+
+	var got []string
+	for key := range archivedObjects(objects) {
+		got = append(got, key)
+	}
+
+	sort.Strings(got)
+
+	want := []string{"media/a.mp4", "old/app.zip", "old/logs.tar"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected archived objects %v; got %v", want, got)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	syncplan "github.com/Zeroed-Books/s3-copy/pkg/sync"
+)
+
+// multipartJournal remembers the multipart uploads a run started, so that a run resuming it can
+// continue them instead of uploading every part again.
+type multipartJournal interface {
+	// UploadID returns the ID of the multipart upload of an object of the given size that an
+	// interrupted run started, or an empty string if there is none.
+	UploadID(bucket, key string, size int64) string
+	// Started records the ID of a multipart upload as soon as it was created.
+	Started(bucket, key string, size int64, uploadID string) error
+}
+
+// multipartAPI uploads objects in parts, and lists the parts uploaded so far.
+type multipartAPI interface {
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	ListParts(ctx context.Context, params *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+}
+
+// uploadedPart is a part of a multipart upload that is already stored.
+type uploadedPart struct {
+	size      int64
+	completed types.CompletedPart
+}
+
+// resumableUpload uploads large bodies in parts like the SDK's upload manager, but keeps the
+// parts of failed uploads, so that a later run can continue the upload from the parts that were
+// stored.
+type resumableUpload struct {
+	client  multipartAPI
+	journal multipartJournal
+	// partSize is the size of each part, unless the body has too many parts of that size.
+	partSize int64
+	// concurrency is the number of parts uploaded in parallel.
+	concurrency int
+	// buffers provides the buffers parts are read into. If nil, a buffer is allocated per part.
+	buffers *partBufferPool
+	// verifyParts compares the parts stored by an interrupted run with the body by their MD5
+	// digests. Without it, which is the case when ETags aren't MD5 digests, the upload starts
+	// over.
+	verifyParts bool
+}
+
+// inputSkipFields are the fields of a PutObject input that describe the whole body, and so don't
+// apply to any single request of a multipart upload.
+var inputSkipFields = []string{
+	"Body",
+	"ContentLength",
+	"ContentMD5",
+	"ChecksumCRC32",
+	"ChecksumCRC32C",
+	"ChecksumCRC64NVME",
+	"ChecksumSHA1",
+	"ChecksumSHA256",
+}
+
+// copyInputFields sets the fields of `dst` to those of `src` with the same name and type, the way
+// the upload manager turns a PutObject input into the inputs of a multipart upload. Both must be
+// pointers to structs.
+func copyInputFields(dst, src any) {
+	to := reflect.ValueOf(dst).Elem()
+	from := reflect.ValueOf(src).Elem()
+	for i := range to.NumField() {
+		field := to.Type().Field(i)
+		if !field.IsExported() || slices.Contains(inputSkipFields, field.Name) {
+			continue
+		}
+
+		value := from.FieldByName(field.Name)
+		if value.IsValid() && value.Type() == field.Type {
+			to.Field(i).Set(value)
+		}
+	}
+}
+
+// Upload uploads the body of the given size in parts, continuing the multipart upload of an
+// interrupted run if the journal has one. The multipart upload is kept if the upload fails.
+func (r resumableUpload) Upload(ctx context.Context, input *s3.PutObjectInput, body io.ReadSeeker, size int64) error {
+	bucket, key := aws.ToString(input.Bucket), aws.ToString(input.Key)
+
+	// Parts are checked by S3 as they arrive, as the upload manager does by default.
+	if input.ChecksumAlgorithm == "" {
+		input.ChecksumAlgorithm = types.ChecksumAlgorithmCrc32
+	}
+
+	uploaded := map[int32]uploadedPart{}
+	uploadID := r.journal.UploadID(bucket, key, size)
+	if uploadID != "" && r.verifyParts {
+		parts, err := r.listParts(ctx, input, uploadID)
+		if err != nil {
+			log.Printf("Could not resume the upload of %s, starting over: %v\n", key, err)
+			uploadID = ""
+		}
+
+		uploaded = parts
+	} else {
+		uploadID = ""
+	}
+
+	if uploadID == "" {
+		var params s3.CreateMultipartUploadInput
+		copyInputFields(&params, input)
+
+		output, err := r.client.CreateMultipartUpload(ctx, &params)
+		if err != nil {
+			return err
+		}
+
+		uploadID = aws.ToString(output.UploadId)
+		if err := r.journal.Started(bucket, key, size, uploadID); err != nil {
+			return err
+		}
+	} else if len(uploaded) > 0 {
+		log.Printf("Resuming the upload of %s from %d stored part(s)\n", key, len(uploaded))
+	}
+
+	partSize := syncplan.UploadPartSize(size, r.partSize)
+	count := int32((size + partSize - 1) / partSize)
+	completed := make([]types.CompletedPart, count)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var uploadErr error
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return uploadErr != nil
+	}
+
+	slots := make(chan struct{}, max(r.concurrency, 1))
+	for number := int32(1); number <= count && !failed(); number++ {
+		// A slot is taken before reading the part, so that at most `concurrency` parts are
+		// buffered at a time.
+		slots <- struct{}{}
+		buf := r.buffers.Get(min(partSize, size-int64(number-1)*partSize))
+		if _, err := io.ReadFull(body, buf); err != nil {
+			r.buffers.Put(buf)
+			<-slots
+			mu.Lock()
+			uploadErr = fmt.Errorf("could not read part %d: %v", number, err)
+			mu.Unlock()
+			break
+		}
+
+		if part, ok := uploaded[number]; ok && part.size == int64(len(buf)) && aws.ToString(part.completed.ETag) == partETag(buf) {
+			completed[number-1] = part.completed
+			r.buffers.Put(buf)
+			<-slots
+			continue
+		}
+
+		wg.Add(1)
+		go func(number int32, buf []byte) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			defer r.buffers.Put(buf)
+
+			var params s3.UploadPartInput
+			copyInputFields(&params, input)
+			params.UploadId = aws.String(uploadID)
+			params.PartNumber = aws.Int32(number)
+			params.Body = bytes.NewReader(buf)
+
+			output, err := r.client.UploadPart(ctx, &params)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				if uploadErr == nil {
+					uploadErr = fmt.Errorf("failed to upload part %d: %w", number, err)
+				}
+
+				return
+			}
+
+			completed[number-1] = types.CompletedPart{
+				PartNumber:        aws.Int32(number),
+				ETag:              output.ETag,
+				ChecksumCRC32:     output.ChecksumCRC32,
+				ChecksumCRC32C:    output.ChecksumCRC32C,
+				ChecksumCRC64NVME: output.ChecksumCRC64NVME,
+				ChecksumSHA1:      output.ChecksumSHA1,
+				ChecksumSHA256:    output.ChecksumSHA256,
+			}
+		}(number, buf)
+	}
+
+	wg.Wait()
+	if uploadErr != nil {
+		return fmt.Errorf("%w; the parts uploaded so far are kept for -resume", uploadErr)
+	}
+
+	var params s3.CompleteMultipartUploadInput
+	copyInputFields(&params, input)
+	params.UploadId = aws.String(uploadID)
+	params.MultipartUpload = &types.CompletedMultipartUpload{Parts: completed}
+
+	_, err := r.client.CompleteMultipartUpload(ctx, &params)
+
+	return err
+}
+
+// listParts returns the parts of a multipart upload that are already stored, by number.
+func (r resumableUpload) listParts(ctx context.Context, input *s3.PutObjectInput, uploadID string) (map[int32]uploadedPart, error) {
+	var params s3.ListPartsInput
+	copyInputFields(&params, input)
+	params.UploadId = aws.String(uploadID)
+
+	parts := map[int32]uploadedPart{}
+	paginator := s3.NewListPartsPaginator(r.client, &params)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, part := range page.Parts {
+			parts[aws.ToInt32(part.PartNumber)] = uploadedPart{
+				size: aws.ToInt64(part.Size),
+				completed: types.CompletedPart{
+					PartNumber:        part.PartNumber,
+					ETag:              part.ETag,
+					ChecksumCRC32:     part.ChecksumCRC32,
+					ChecksumCRC32C:    part.ChecksumCRC32C,
+					ChecksumCRC64NVME: part.ChecksumCRC64NVME,
+					ChecksumSHA1:      part.ChecksumSHA1,
+					ChecksumSHA256:    part.ChecksumSHA256,
+				},
+			}
+		}
+	}
+
+	return parts, nil
+}
+
+// partETag returns the ETag S3 gives a part with the given contents, including its quotes.
+func partETag(part []byte) string {
+	sum := md5.Sum(part)
+
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// testPartSize is the smallest part size S3 allows.
+const testPartSize = 5 * mebibyte
+
+// mockMultipartAPI stores the parts of multipart uploads in memory.
+type mockMultipartAPI struct {
+	mu sync.Mutex
+	// parts are the stored parts of the upload, by number.
+	parts map[int32][]byte
+	// failPart makes the upload of the part with this number fail.
+	failPart int32
+
+	created   []*s3.CreateMultipartUploadInput
+	uploaded  []int32
+	completed *s3.CompleteMultipartUploadInput
+}
+
+func (m *mockMultipartAPI) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	m.created = append(m.created, params)
+	m.parts = map[int32][]byte{}
+
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("new-upload")}, nil
+}
+
+func (m *mockMultipartAPI) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	number := aws.ToInt32(params.PartNumber)
+	if number == m.failPart {
+		return nil, errors.New("connection reset")
+	}
+
+	body, _ := io.ReadAll(params.Body)
+	m.parts[number] = body
+	m.uploaded = append(m.uploaded, number)
+
+	return &s3.UploadPartOutput{ETag: aws.String(partETag(body)), ChecksumCRC32: aws.String("crc" + strconv.Itoa(int(number)))}, nil
+}
+
+func (m *mockMultipartAPI) ListParts(ctx context.Context, params *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error) {
+	output := &s3.ListPartsOutput{}
+	for number, body := range m.parts {
+		output.Parts = append(output.Parts, types.Part{
+			PartNumber: aws.Int32(number),
+			Size:       aws.Int64(int64(len(body))),
+			ETag:       aws.String(partETag(body)),
+		})
+	}
+
+	return output, nil
+}
+
+func (m *mockMultipartAPI) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	m.completed = params
+
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+// mockJournal records multipart uploads in memory.
+type mockJournal map[string]string
+
+func (j mockJournal) UploadID(bucket, key string, size int64) string {
+	return j[bucket+"/"+key+"/"+strconv.FormatInt(size, 10)]
+}
+
+func (j mockJournal) Started(bucket, key string, size int64, uploadID string) error {
+	j[bucket+"/"+key+"/"+strconv.FormatInt(size, 10)] = uploadID
+	return nil
+}
+
+func Test_resumableUpload_Upload(t *testing.T) {
+	// The body has three parts, the last of one byte.
+	body := bytes.Repeat([]byte("a"), int(2*testPartSize+1))
+
+	testCases := []struct {
+		desc         string
+		stored       map[int32][]byte
+		journal      mockJournal
+		verifyParts  bool
+		wantCreated  bool
+		wantUploaded []int32
+	}{
+		{
+			desc:         "new upload",
+			journal:      mockJournal{},
+			verifyParts:  true,
+			wantCreated:  true,
+			wantUploaded: []int32{1, 2, 3},
+		},
+		{
+			desc:         "resumed upload",
+			stored:       map[int32][]byte{1: body[:testPartSize], 2: bytes.Repeat([]byte("b"), int(testPartSize))},
+			journal:      mockJournal{"my-bucket/big.bin/" + strconv.Itoa(len(body)): "old-upload"},
+			verifyParts:  true,
+			wantUploaded: []int32{2, 3},
+		},
+		{
+			desc:         "resumed upload without MD5 ETags",
+			stored:       map[int32][]byte{1: body[:testPartSize]},
+			journal:      mockJournal{"my-bucket/big.bin/" + strconv.Itoa(len(body)): "old-upload"},
+			wantCreated:  true,
+			wantUploaded: []int32{1, 2, 3},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockMultipartAPI{parts: tC.stored}
+			upload := resumableUpload{client: client, journal: tC.journal, partSize: testPartSize, concurrency: 2, verifyParts: tC.verifyParts}
+
+			input := &s3.PutObjectInput{Bucket: aws.String("my-bucket"), Key: aws.String("big.bin"), ContentType: aws.String("application/octet-stream")}
+			if err := upload.Upload(context.Background(), input, bytes.NewReader(body), int64(len(body))); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if created := len(client.created) > 0; created != tC.wantCreated {
+				t.Errorf("Expected a new upload to be created: %v; got %v", tC.wantCreated, created)
+			}
+
+			if tC.wantCreated && aws.ToString(client.created[0].ContentType) != "application/octet-stream" {
+				t.Errorf("Expected the content type to be copied to the new upload; got %v", client.created[0].ContentType)
+			}
+
+			sort.Slice(client.uploaded, func(i, j int) bool { return client.uploaded[i] < client.uploaded[j] })
+			if !reflect.DeepEqual(client.uploaded, tC.wantUploaded) {
+				t.Errorf("Expected parts %v to be uploaded; got %v", tC.wantUploaded, client.uploaded)
+			}
+
+			if got := bytes.Join([][]byte{client.parts[1], client.parts[2], client.parts[3]}, nil); !bytes.Equal(got, body) {
+				t.Error("Expected the stored parts to make up the body")
+			}
+
+			parts := client.completed.MultipartUpload.Parts
+			if len(parts) != 3 || aws.ToString(parts[2].ETag) != partETag(body[2*testPartSize:]) {
+				t.Errorf("Expected the upload to be completed with 3 parts; got %+v", parts)
+			}
+		})
+	}
+}
+
+func Test_resumableUpload_Upload_failure(t *testing.T) {
+	body := bytes.Repeat([]byte("a"), int(2*testPartSize))
+	client := &mockMultipartAPI{failPart: 2}
+	journal := mockJournal{}
+	upload := resumableUpload{client: client, journal: journal, partSize: testPartSize, concurrency: 1, verifyParts: true}
+
+	input := &s3.PutObjectInput{Bucket: aws.String("my-bucket"), Key: aws.String("big.bin")}
+	if err := upload.Upload(context.Background(), input, bytes.NewReader(body), int64(len(body))); err == nil {
+		t.Fatal("Expected the upload to fail")
+	}
+
+	if client.completed != nil {
+		t.Error("Expected the upload not to be completed")
+	}
+
+	if id := journal.UploadID("my-bucket", "big.bin", int64(len(body))); id != "new-upload" {
+		t.Errorf("Expected the upload ID to be recorded; got %q", id)
+	}
+
+	if _, ok := client.parts[1]; !ok {
+		t.Error("Expected the uploaded part to be kept")
+	}
+}
+
+func Test_copyInputFields(t *testing.T) {
+	input := &s3.PutObjectInput{
+		Bucket:               aws.String("my-bucket"),
+		Key:                  aws.String("big.bin"),
+		ContentMD5:           aws.String("md5"),
+		SSECustomerAlgorithm: aws.String("AES256"),
+		ACL:                  types.ObjectCannedACLPublicRead,
+	}
+
+	var part s3.UploadPartInput
+	copyInputFields(&part, input)
+
+	if aws.ToString(part.SSECustomerAlgorithm) != "AES256" || aws.ToString(part.Key) != "big.bin" {
+		t.Errorf("Expected the key and encryption to be copied; got %+v", part)
+	}
+
+	if part.ContentMD5 != nil {
+		t.Errorf("Expected the digest of the whole body not to be copied; got %v", *part.ContentMD5)
+	}
+
+	var create s3.CreateMultipartUploadInput
+	copyInputFields(&create, input)
+
+	if create.ACL != types.ObjectCannedACLPublicRead {
+		t.Errorf("Expected the ACL to be copied; got %q", create.ACL)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+)
+
+const (
+	// defaultRetryBaseDelay is the delay before the first retry of an upload.
+	defaultRetryBaseDelay = time.Second
+	// defaultRetryMaxDelay caps the delay between retries of an upload.
+	defaultRetryMaxDelay = 30 * time.Second
+)
+
+// retryUploader retries uploads that fail with a transient error, such as a 503 SlowDown
+// response or a reset connection, using exponential backoff with full jitter. Permanent errors,
+// such as access being denied or the bucket not existing, are returned immediately.
+//
+// The SDK already retries individual requests a few times; this covers failures that outlast
+// those attempts by retrying the whole object after a longer delay.
+type retryUploader struct {
+	next uploader
+	// maxRetries is the number of times a failed upload is retried.
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+	// limiter, if set, is told about throttled uploads so that fewer are attempted at a time.
+	limiter *concurrencyLimiter
+}
+
+func newRetryUploader(next uploader, maxRetries int) *retryUploader {
+	return &retryUploader{
+		next:       next,
+		maxRetries: maxRetries,
+		baseDelay:  defaultRetryBaseDelay,
+		maxDelay:   defaultRetryMaxDelay,
+	}
+}
+
+func (u *retryUploader) Upload(ctx context.Context, object *uploadObject) error {
+	for attempt := 0; ; attempt++ {
+		err := u.next.Upload(ctx, object)
+		if err != nil && isThrottle(err) {
+			u.limiter.Throttled()
+		}
+
+		if err == nil || attempt >= u.maxRetries || !isRetryable(err) {
+			return err
+		}
+
+		// The body has to be re-read from the start, which is only possible if it is seekable.
+		seeker, ok := object.Body.(io.Seeker)
+		if !ok {
+			return err
+		}
+
+		if _, seekErr := seeker.Seek(0, io.SeekStart); seekErr != nil {
+			return err
+		}
+
+		delay := u.backoff(attempt)
+		log.Printf("Retrying %s in %v after error: %v\n", object.Path, delay.Round(time.Millisecond), err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backoff returns a random delay between zero and an exponentially increasing cap for the given
+// attempt.
+func (u *retryUploader) backoff(attempt int) time.Duration {
+	limit := u.maxDelay
+	if attempt < 32 && u.baseDelay<<attempt < limit {
+		limit = u.baseDelay << attempt
+	}
+
+	return time.Duration(rand.Int63n(int64(limit) + 1))
+}
+
+// isRetryable reports whether an error is transient, using the same classification as the SDK's
+// own retryer: throttling and timeout error codes, 5xx status codes, and connection errors.
+func isRetryable(err error) bool {
+	return retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// transientError is classified as retryable by the SDK.
+type transientError struct{}
+
+func (transientError) Error() string        { return "service unavailable" }
+func (transientError) RetryableError() bool { return true }
+
+// flakyUploader fails with the given errors, in order, before succeeding.
+type flakyUploader struct {
+	errs     []error
+	attempts int
+}
+
+func (u *flakyUploader) Upload(ctx context.Context, object *uploadObject) error {
+	u.attempts++
+	if len(u.errs) == 0 {
+		return nil
+	}
+
+	err := u.errs[0]
+	u.errs = u.errs[1:]
+
+	return err
+}
+
+func Test_retryUploader(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		errs         []error
+		maxRetries   int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{
+			desc:         "success",
+			maxRetries:   3,
+			wantAttempts: 1,
+		},
+		{
+			desc:         "transient failure recovers",
+			errs:         []error{transientError{}, transientError{}},
+			maxRetries:   3,
+			wantAttempts: 3,
+		},
+		{
+			desc:         "retries exhausted",
+			errs:         []error{transientError{}, transientError{}, transientError{}},
+			maxRetries:   2,
+			wantAttempts: 3,
+			wantErr:      true,
+		},
+		{
+			desc:         "permanent failure",
+			errs:         []error{errors.New("access denied")},
+			maxRetries:   3,
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &flakyUploader{errs: tC.errs}
+			retryClient := newRetryUploader(client, tC.maxRetries)
+			retryClient.baseDelay = time.Millisecond
+			retryClient.maxDelay = time.Millisecond
+
+			err := retryClient.Upload(context.Background(), &uploadObject{
+				Path: "foo.txt",
+				Body: strings.NewReader("some body"),
+			})
+			if (err == nil) == tC.wantErr {
+				t.Errorf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if client.attempts != tC.wantAttempts {
+				t.Errorf("Expected %d attempts; got %d", tC.wantAttempts, client.attempts)
+			}
+		})
+	}
+}
+
+func Test_retryUploader_unseekableBody(t *testing.T) {
+	client := &flakyUploader{errs: []error{transientError{}}}
+	retryClient := newRetryUploader(client, 3)
+
+	err := retryClient.Upload(context.Background(), &uploadObject{
+		Path: "foo.txt",
+		Body: &mockFile{body: strings.NewReader("some body")},
+	})
+	if err == nil {
+		t.Error("Expected an error for an unseekable body")
+	}
+
+	if client.attempts != 1 {
+		t.Errorf("Expected 1 attempt; got %d", client.attempts)
+	}
+}
+
+func Test_retryUploader_backoff(t *testing.T) {
+	retryClient := newRetryUploader(nil, 3)
+
+	for attempt := 0; attempt < 100; attempt++ {
+		if delay := retryClient.backoff(attempt); delay < 0 || delay > defaultRetryMaxDelay {
+			t.Fatalf("Expected delay for attempt %d within [0, %v]; got %v", attempt, defaultRetryMaxDelay, delay)
+		}
+	}
+}
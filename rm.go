@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// runRemove implements the `rm` command, which deletes the objects under a prefix, e.g. to clean
+// up old deployments.
+func runRemove(cmd command, args []string) {
+	var common commonFlags
+	var dryRunMode, force, recursive bool
+	var include, exclude stringList
+
+	flags := newFlagSet(cmd, "[flags]")
+	common.register(flags)
+	flags.BoolVar(&dryRunMode, "dry-run", false, "Print the objects that would be deleted without deleting them")
+	flags.Var(&exclude, "exclude", "Glob pattern of objects to keep (repeatable)")
+	flags.BoolVar(&force, "force", false, "Delete without asking for confirmation")
+	flags.Var(&include, "include", "Glob pattern of objects to delete; if given, other objects are kept (repeatable)")
+	flags.BoolVar(&recursive, "recursive", false, "Also delete objects nested under '/' below the prefix")
+	flags.Parse(args)
+
+	if _, err := common.applyConfig(flags); err != nil {
+		log.Fatal(err)
+	}
+
+	if common.prefix == "" && !recursive {
+		log.Fatal("Refusing to delete objects at the root of the bucket without '-recursive'; use '-prefix' to choose the objects to delete.")
+	}
+
+	filter, err := newPathFilter(include, exclude)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := newSignalContext()
+	defer stop()
+
+	client, err := common.newClient(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	prefix := normalizePrefix(common.prefix)
+	listed, _, err := listDirectory(ctx, client, common.bucket, prefix, recursive)
+	if err != nil {
+		log.Fatal("Could not list objects: ", err)
+	}
+
+	objects := filterObjects(listed, filter)
+	if len(objects) == 0 {
+		log.Printf("No objects to delete under %s/%s\n", common.bucket, prefix)
+		return
+	}
+
+	if dryRunMode {
+		preview := newDryRun(os.Stdout)
+		preview.Delete(objects)
+		preview.Summary()
+		return
+	}
+
+	if !force {
+		var total int64
+		for _, object := range objects {
+			total += object.Size
+		}
+
+		prompt := fmt.Sprintf("Delete %d object(s) (%s) under %s/%s?", len(objects), formatBytes(total), common.bucket, prefix)
+		if !confirm(os.Stdin, os.Stderr, prompt) {
+			log.Fatal("Aborted; no objects were deleted.")
+		}
+	}
+
+	keys := make([]string, len(objects))
+	for i, object := range objects {
+		keys[i] = object.Key
+	}
+
+	if err := deleteObjects(ctx, client, common.bucket, prefix, keys); err != nil {
+		log.Fatal("Delete failed: ", err)
+	}
+}
+
+// filterObjects returns the objects whose keys match the filter.
+func filterObjects(objects []remoteObject, filter pathFilter) []remoteObject {
+	var matched []remoteObject
+	for _, object := range objects {
+		if filter.Match(object.Key) {
+			matched = append(matched, object)
+		}
+	}
+
+	return matched
+}
+
+// confirm asks a yes/no question and reports whether it was answered with yes. Anything else,
+// including the end of the input, counts as no.
+func confirm(in io.Reader, out io.Writer, prompt string) bool {
+	fmt.Fprintf(out, "%s [y/N] ", prompt)
+
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Fprintln(out)
+		return false
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_filterObjects(t *testing.T) {
+	objects := []remoteObject{
+		{Key: "index.html"},
+		{Key: "assets/app.js"},
+		{Key: "assets/app.js.map"},
+	}
+
+	testCases := []struct {
+		desc    string
+		include []string
+		exclude []string
+		want    []string
+	}{
+		{desc: "no patterns", want: []string{"index.html", "assets/app.js", "assets/app.js.map"}},
+		{desc: "include", include: []string{"assets/**"}, want: []string{"assets/app.js", "assets/app.js.map"}},
+		{desc: "exclude", exclude: []string{"*.map"}, want: []string{"index.html", "assets/app.js"}},
+		{desc: "nothing matches", include: []string{"*.css"}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			filter, err := newPathFilter(tC.include, tC.exclude)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var got []string
+			for _, object := range filterObjects(objects, filter) {
+				got = append(got, object.Key)
+			}
+
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("Expected %v; got %v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_confirm(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		input string
+		want  bool
+	}{
+		{desc: "yes", input: "y\n", want: true},
+		{desc: "full word", input: "Yes\n", want: true},
+		{desc: "no newline", input: "y", want: true},
+		{desc: "no", input: "n\n"},
+		{desc: "empty answer", input: "\n"},
+		{desc: "end of input", input: ""},
+		{desc: "other answer", input: "sure\n"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var out bytes.Buffer
+			if got := confirm(strings.NewReader(tC.input), &out, "Delete?"); got != tC.want {
+				t.Errorf("Expected %v; got %v", tC.want, got)
+			}
+
+			if !strings.HasPrefix(out.String(), "Delete? [y/N] ") {
+				t.Errorf("Expected prompt to be written; got %q", out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+const (
+	// defaultSessionName identifies the sessions of assumed roles in CloudTrail, unless
+	// `-session-name` is given.
+	defaultSessionName = "s3-copy"
+	// maxSessionTags is the number of session tags STS accepts.
+	maxSessionTags = 50
+)
+
+// roleSettings configure the IAM role assumed with STS before accessing a bucket, e.g. to deploy
+// into a customer's account from a CI identity that may only assume roles.
+type roleSettings struct {
+	arn         string
+	externalID  string
+	sessionName string
+	// tagPairs are the session tags as given, as '<key>=<value>', and tags the parsed ones.
+	tagPairs stringList
+	tags     map[string]string
+
+	// tokenFile and githubOIDC assume the role with an OIDC token instead of the credentials of
+	// the default chain, from a file or from GitHub Actions. tokens retrieves the token.
+	tokenFile  string
+	githubOIDC bool
+	tokens     stscreds.IdentityTokenRetriever
+}
+
+// applyRole validates the role settings, which are only used together with `-role-arn`.
+func (c *commonFlags) applyRole() error {
+	if c.role.arn == "" {
+		for _, setting := range []struct {
+			name  string
+			given bool
+		}{
+			{name: "external-id", given: c.role.externalID != ""},
+			{name: "session-name", given: c.role.sessionName != ""},
+			{name: "session-tag", given: len(c.role.tagPairs) > 0},
+			{name: "web-identity-token-file", given: c.role.tokenFile != ""},
+			{name: "github-oidc", given: c.role.githubOIDC},
+		} {
+			if setting.given {
+				return fmt.Errorf("the '-%s' flag can only be used together with '-role-arn'", setting.name)
+			}
+		}
+
+		return nil
+	}
+
+	if c.dev {
+		return errors.New("the '-dev' and '-role-arn' flags can't be used together")
+	}
+
+	if !strings.HasPrefix(c.role.arn, "arn:") {
+		return fmt.Errorf("invalid role ARN %q: expected e.g. 'arn:aws:iam::123456789012:role/deploy'", c.role.arn)
+	}
+
+	tags, err := parseKeyValues(c.role.tagPairs)
+	if err != nil {
+		return fmt.Errorf("invalid session tag: %v", err)
+	}
+
+	if len(tags) > maxSessionTags {
+		return fmt.Errorf("%d session tags were given; STS accepts at most %d", len(tags), maxSessionTags)
+	}
+
+	c.role.tags = tags
+
+	switch {
+	case c.role.tokenFile != "" && c.role.githubOIDC:
+		return errors.New("the '-web-identity-token-file' and '-github-oidc' flags can't be used together")
+	case c.role.tokenFile != "":
+		c.role.tokens = stscreds.IdentityTokenFile(c.role.tokenFile)
+	case c.role.githubOIDC:
+		c.role.tokens, err = newGitHubTokenRetriever(http.DefaultClient)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Roles assumed with a web identity get their session tags from the token, and have no
+	// external ID.
+	if c.role.tokens != nil && (c.role.externalID != "" || len(tags) > 0) {
+		return errors.New("the '-external-id' and '-session-tag' flags can't be used together with an OIDC token")
+	}
+
+	return nil
+}
+
+// assumeRoleOptions configures the STS AssumeRole request.
+func (r roleSettings) assumeRoleOptions(o *stscreds.AssumeRoleOptions) {
+	o.RoleSessionName = r.sessionName
+	if o.RoleSessionName == "" {
+		o.RoleSessionName = defaultSessionName
+	}
+
+	if r.externalID != "" {
+		o.ExternalID = aws.String(r.externalID)
+	}
+
+	keys := make([]string, 0, len(r.tags))
+	for key := range r.tags {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		o.Tags = append(o.Tags, types.Tag{Key: aws.String(key), Value: aws.String(r.tags[key])})
+	}
+}
+
+// webIdentityOptions configures the STS AssumeRoleWithWebIdentity request.
+func (r roleSettings) webIdentityOptions(o *stscreds.WebIdentityRoleOptions) {
+	o.RoleSessionName = r.sessionName
+	if o.RoleSessionName == "" {
+		o.RoleSessionName = defaultSessionName
+	}
+}
+
+// assumeRole replaces the credentials of the AWS configuration with those of the role, which are
+// requested using the original credentials, or the OIDC token if there is one, and refreshed
+// before they expire.
+func (r roleSettings) assumeRole(awsConfig *aws.Config) {
+	client := sts.NewFromConfig(*awsConfig)
+
+	var provider aws.CredentialsProvider
+	if r.tokens != nil {
+		provider = stscreds.NewWebIdentityRoleProvider(client, r.arn, r.tokens, r.webIdentityOptions)
+	} else {
+		provider = stscreds.NewAssumeRoleProvider(client, r.arn, r.assumeRoleOptions)
+	}
+
+	awsConfig.Credentials = aws.NewCredentialsCache(provider, refreshEarly)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+func Test_commonFlags_applyRole(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		flags    commonFlags
+		wantTags map[string]string
+		wantErr  bool
+	}{
+		{desc: "no role"},
+		{
+			desc:     "role with session tags",
+			flags:    commonFlags{role: roleSettings{arn: "arn:aws:iam::123456789012:role/deploy", tagPairs: stringList{"customer=acme", "pipeline=web"}}},
+			wantTags: map[string]string{"customer": "acme", "pipeline": "web"},
+		},
+		{
+			desc:    "external ID without role",
+			flags:   commonFlags{role: roleSettings{externalID: "customer-42"}},
+			wantErr: true,
+		},
+		{
+			desc:    "session tag without role",
+			flags:   commonFlags{role: roleSettings{tagPairs: stringList{"customer=acme"}}},
+			wantErr: true,
+		},
+		{
+			desc:    "invalid ARN",
+			flags:   commonFlags{role: roleSettings{arn: "deploy"}},
+			wantErr: true,
+		},
+		{
+			desc:    "invalid session tag",
+			flags:   commonFlags{role: roleSettings{arn: "arn:aws:iam::123456789012:role/deploy", tagPairs: stringList{"customer"}}},
+			wantErr: true,
+		},
+		{
+			desc:    "dev",
+			flags:   commonFlags{dev: true, role: roleSettings{arn: "arn:aws:iam::123456789012:role/deploy"}},
+			wantErr: true,
+		},
+		{
+			desc:  "web identity token file",
+			flags: commonFlags{role: roleSettings{arn: "arn:aws:iam::123456789012:role/deploy", tokenFile: "/var/run/secrets/token"}},
+		},
+		{
+			desc:    "web identity token file without role",
+			flags:   commonFlags{role: roleSettings{tokenFile: "/var/run/secrets/token"}},
+			wantErr: true,
+		},
+		{
+			desc:    "web identity token file with external ID",
+			flags:   commonFlags{role: roleSettings{arn: "arn:aws:iam::123456789012:role/deploy", tokenFile: "/var/run/secrets/token", externalID: "customer-42"}},
+			wantErr: true,
+		},
+		{
+			desc:    "GitHub OIDC outside of GitHub Actions",
+			flags:   commonFlags{role: roleSettings{arn: "arn:aws:iam::123456789012:role/deploy", githubOIDC: true}},
+			wantErr: true,
+		},
+		{
+			desc:    "web identity token file with GitHub OIDC",
+			flags:   commonFlags{role: roleSettings{arn: "arn:aws:iam::123456789012:role/deploy", tokenFile: "/var/run/secrets/token", githubOIDC: true}},
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Setenv("ACTIONS_ID_TOKEN_REQUEST_URL", "")
+			t.Setenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN", "")
+
+			flags := tC.flags
+			err := flags.applyRole()
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if err == nil && len(tC.wantTags) > 0 && !reflect.DeepEqual(flags.role.tags, tC.wantTags) {
+				t.Errorf("Expected tags %v; got %v", tC.wantTags, flags.role.tags)
+			}
+
+			if err == nil && (flags.role.tokens != nil) != (flags.role.tokenFile != "") {
+				t.Errorf("Expected a token retriever only for web identities; got %v", flags.role.tokens)
+			}
+		})
+	}
+}
+
+func Test_roleSettings_assumeRoleOptions(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		role            roleSettings
+		wantSessionName string
+		wantExternalID  *string
+		wantTags        []types.Tag
+	}{
+		{
+			desc:            "defaults",
+			role:            roleSettings{arn: "arn:aws:iam::123456789012:role/deploy"},
+			wantSessionName: defaultSessionName,
+		},
+		{
+			desc: "external ID and tags",
+			role: roleSettings{
+				arn:         "arn:aws:iam::123456789012:role/deploy",
+				externalID:  "customer-42",
+				sessionName: "ci-1234",
+				tags:        map[string]string{"pipeline": "web", "customer": "acme"},
+			},
+			wantSessionName: "ci-1234",
+			wantExternalID:  aws.String("customer-42"),
+			wantTags: []types.Tag{
+				{Key: aws.String("customer"), Value: aws.String("acme")},
+				{Key: aws.String("pipeline"), Value: aws.String("web")},
+			},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var got stscreds.AssumeRoleOptions
+			tC.role.assumeRoleOptions(&got)
+
+			if got.RoleSessionName != tC.wantSessionName || !reflect.DeepEqual(got.ExternalID, tC.wantExternalID) || !reflect.DeepEqual(got.Tags, tC.wantTags) {
+				t.Errorf("Unexpected options: %+v", got)
+			}
+		})
+	}
+}
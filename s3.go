@@ -0,0 +1,759 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"maps"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// aclNone is the ACL flag value that disables sending an ACL, for buckets where ACLs are disabled
+// through S3 Object Ownership.
+const aclNone = "none"
+
+// parseACL validates a canned ACL name. The special value "none" results in an empty ACL.
+func parseACL(value string) (types.ObjectCannedACL, error) {
+	if value == aclNone {
+		return "", nil
+	}
+
+	var known []string
+	for _, acl := range types.ObjectCannedACL("").Values() {
+		if value == string(acl) {
+			return acl, nil
+		}
+
+		known = append(known, string(acl))
+	}
+
+	return "", fmt.Errorf("unknown ACL %q; expected 'none' or one of: %s", value, strings.Join(known, ", "))
+}
+
+// normalizeEndpoint turns an endpoint given as a bare host name, such as
+// `nyc3.digitaloceanspaces.com`, into an HTTPS URL.
+func normalizeEndpoint(endpoint string) string {
+	if endpoint == "" || strings.Contains(endpoint, "://") {
+		return endpoint
+	}
+
+	return "https://" + endpoint
+}
+
+// normalizePrefix turns a key prefix such as `/site`, `./site`, or `site\` into the form used for
+// keys, `site/`. An empty prefix is left empty.
+func normalizePrefix(prefix string) string {
+	prefix = strings.Trim(strings.ReplaceAll(prefix, `\`, "/"), "/")
+	for prefix == "." || strings.HasPrefix(prefix, "./") {
+		prefix = strings.TrimLeft(prefix[1:], "/")
+	}
+
+	if prefix == "" {
+		return ""
+	}
+
+	return prefix + "/"
+}
+
+// s3Uploader implements file uploading to an S3-compatible storage backend.
+type s3Uploader struct {
+	// client is used for requests other than uploads, such as listing objects
+	client *s3.Client
+	// base is the client used to perform the uploads
+	base *manager.Uploader
+	// bucket is the storage bucket to upload files to
+	bucket string
+	// fileACL is the default ACL to apply to files. If empty, no ACL is sent.
+	fileACL types.ObjectCannedACL
+	// bucketURL is the URL the bucket serves objects from.
+	bucketURL string
+
+	// Prefix is prepended to the path of every object to form its key. Listing is limited to
+	// keys with the prefix, which is removed from the keys of the listed objects.
+	Prefix string
+	// Metadata is the user metadata stored with every object.
+	Metadata map[string]string
+	// Tags are the S3 object tags applied to every object.
+	Tags map[string]string
+	// Encryption configures server-side encryption of every object.
+	Encryption serverSideEncryption
+	// ObjectLock protects every object from being deleted or overwritten.
+	ObjectLock objectLock
+	// Checksum is sent with every object so that S3 rejects corrupted uploads.
+	Checksum uploadChecksum
+	// Multipart tunes how large files are split into parts.
+	Multipart multipartSettings
+	// ListConcurrency is the number of top-level directories beneath the prefix listed in
+	// parallel. Listing is sequential if it's less than 2.
+	ListConcurrency int
+	// buffers are reused for the parts of resumable uploads.
+	buffers *partBufferPool
+	// Journal records the multipart uploads of large files, which are then kept if they fail so
+	// that a resumed run can continue them. If nil, failed multipart uploads are aborted.
+	Journal multipartJournal
+}
+
+func newS3Uploader(client *s3.Client, bucket string, fileACL types.ObjectCannedACL) s3Uploader {
+	return s3Uploader{
+		client: client,
+		// Failed multipart uploads are aborted by the uploader itself, since the upload manager
+		// would try to abort them using a context that may already be cancelled.
+		base: manager.NewUploader(client, func(u *manager.Uploader) {
+			u.LeavePartsOnError = true
+		}),
+		bucket:   bucket,
+		fileACL:  fileACL,
+		Metadata: map[string]string{},
+		Tags:     map[string]string{},
+	}
+}
+
+func init() {
+	registerBackend("s3", newS3Backend)
+}
+
+// newS3Backend creates the backend for an S3 bucket, or a bucket of an S3-compatible service if
+// an endpoint is given.
+func newS3Backend(ctx context.Context, common *commonFlags, bucket, prefix string, options backendOptions) (backend, error) {
+	client, err := common.newClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.CreateBucket != nil {
+		if err := createBucket(ctx, client, bucket, *options.CreateBucket, options.ACL); err != nil {
+			return nil, err
+		}
+	}
+
+	store := newS3Uploader(client, bucket, options.ACL)
+	store.bucketURL = bucketURL(common.endpoint, common.region, bucket, common.pathStyle)
+	store.Prefix = prefix
+	if options.Metadata != nil {
+		store.Metadata = options.Metadata
+	}
+	if options.Tags != nil {
+		store.Tags = options.Tags
+	}
+	store.Encryption = options.Encryption
+	store.ObjectLock = options.ObjectLock
+	store.Checksum = options.Checksum
+	store.Multipart = options.Multipart
+	store.buffers = newPartBufferPool(options.Multipart.partSize())
+	store.Journal = options.Journal
+	store.ListConcurrency = options.ListConcurrency
+
+	return &store, nil
+}
+
+// bucketURL returns the URL a bucket serves objects from. Buckets on AWS are addressed by host
+// name unless path-style addressing is forced, and those on custom endpoints by path.
+func bucketURL(endpoint, region, bucket string, pathStyle bool) string {
+	if ap, err := parseAccessPointARN(bucket); err == nil {
+		return ap.url()
+	}
+
+	if endpoint == "" && pathStyle {
+		return fmt.Sprintf("https://s3.%s.amazonaws.com/%s/", region, bucket)
+	}
+
+	if endpoint == "" {
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/", bucket, region)
+	}
+
+	return fmt.Sprintf("%s/%s/", strings.TrimSuffix(normalizeEndpoint(endpoint), "/"), bucket)
+}
+
+// Sub returns an uploader for the objects in a directory beneath the prefix.
+func (s *s3Uploader) Sub(dir string) backend {
+	sub := *s
+	sub.Prefix += dir
+
+	return &sub
+}
+
+// URL returns the URL the bucket serves the objects beneath the prefix from.
+func (s *s3Uploader) URL() string {
+	return s.bucketURL + s.Prefix
+}
+
+func (s *s3Uploader) Upload(ctx context.Context, object *uploadObject) error {
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.Prefix + object.Path),
+		Body:        object.Body,
+		ContentType: aws.String(object.ContentType),
+		Metadata:    s.Metadata,
+		ACL:         s.fileACL,
+	}
+
+	if len(s.Tags) > 0 {
+		tagging, err := encodeTags(s.Tags)
+		if err != nil {
+			return err
+		}
+
+		input.Tagging = aws.String(tagging)
+	}
+
+	if err := applyHeaders(input, object.Headers); err != nil {
+		return err
+	}
+
+	s.Encryption.apply(input)
+
+	if err := s.Checksum.apply(input); err != nil {
+		return fmt.Errorf("could not checksum %s: %v", object.Path, err)
+	}
+
+	s.ObjectLock.apply(input)
+
+	if upload, size, ok := s.resumableUpload(input); ok {
+		if err := upload.Upload(ctx, input, input.Body.(io.ReadSeeker), size); err != nil {
+			return fmt.Errorf("failed to upload to S3: %w", err)
+		}
+
+		return nil
+	}
+
+	_, err := s.base.Upload(ctx, input, s.Multipart.options(input.Body))
+	if err != nil {
+		var multipartErr manager.MultiUploadFailure
+		if errors.As(err, &multipartErr) {
+			s.abortMultipartUpload(ctx, s.Prefix+object.Path, multipartErr.UploadID())
+		}
+
+		return fmt.Errorf("failed to upload to S3: %w", err)
+	}
+
+	return nil
+}
+
+// resumableUpload returns the uploader for a body that is uploaded in parts that are kept for
+// resuming, along with the size of the body. This is the case for bodies of a known size that are
+// too large for a single part, when a journal is set. Bodies with an MD5 digest of their own are
+// always uploaded by the upload manager, which uploads them in a single part.
+func (s *s3Uploader) resumableUpload(input *s3.PutObjectInput) (resumableUpload, int64, bool) {
+	if s.Journal == nil || input.ContentMD5 != nil {
+		return resumableUpload{}, 0, false
+	}
+
+	if _, ok := input.Body.(io.ReadSeeker); !ok {
+		return resumableUpload{}, 0, false
+	}
+
+	size, ok := bodySize(input.Body)
+	if !ok || size <= max(s.Multipart.Threshold, s.Multipart.partSize()) {
+		return resumableUpload{}, 0, false
+	}
+
+	upload := resumableUpload{
+		client:      s.client,
+		journal:     s.Journal,
+		partSize:    s.Multipart.partSize(),
+		concurrency: s.Multipart.Concurrency,
+		buffers:     s.buffers,
+		verifyParts: s.Encryption.hasMD5ETag(),
+	}
+	if upload.concurrency == 0 {
+		upload.concurrency = manager.DefaultUploadConcurrency
+	}
+
+	return upload, size, true
+}
+
+// abortTimeout bounds how long aborting a failed multipart upload may take.
+const abortTimeout = 30 * time.Second
+
+// abortMultipartUpload discards the parts of a failed multipart upload so that they don't accrue
+// storage charges. This is attempted even if the upload failed because the context was cancelled.
+func (s *s3Uploader) abortMultipartUpload(ctx context.Context, key, uploadID string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abortTimeout)
+	defer cancel()
+
+	_, err := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil {
+		log.Printf("Could not abort multipart upload of %s (upload ID %s): %v\n", key, uploadID, err)
+	}
+}
+
+const (
+	// maxObjectTags is the largest number of tags S3 allows on an object.
+	maxObjectTags = 10
+	// maxTagKeyLength is the longest tag key S3 allows, in characters.
+	maxTagKeyLength = 128
+	// maxTagValueLength is the longest tag value S3 allows, in characters.
+	maxTagValueLength = 256
+)
+
+// encodeTags validates a set of object tags against the S3 limits and encodes them as a URL query
+// string, as expected by the `x-amz-tagging` header.
+func encodeTags(tags map[string]string) (string, error) {
+	if len(tags) > maxObjectTags {
+		return "", fmt.Errorf("too many tags: S3 allows at most %d per object", maxObjectTags)
+	}
+
+	values := url.Values{}
+	for key, value := range tags {
+		if key == "" || utf8.RuneCountInString(key) > maxTagKeyLength {
+			return "", fmt.Errorf("invalid tag key %q: must be between 1 and %d characters", key, maxTagKeyLength)
+		}
+
+		if utf8.RuneCountInString(value) > maxTagValueLength {
+			return "", fmt.Errorf("invalid value for tag %q: must be at most %d characters", key, maxTagValueLength)
+		}
+
+		values.Set(key, value)
+	}
+
+	return values.Encode(), nil
+}
+
+// maxMetadataSize is the largest total size, in bytes, of the user metadata keys and values S3
+// allows on an object.
+const maxMetadataSize = 2048
+
+// validateMetadata checks that user metadata can be sent as `x-amz-meta-*` headers and fits
+// within the S3 size limit. Keys must be valid HTTP header names, and values must be printable
+// ASCII since they are sent unencoded.
+func validateMetadata(metadata map[string]string) error {
+	var size int
+	for key, value := range metadata {
+		if key == "" || strings.IndexFunc(key, func(r rune) bool { return !isTokenRune(r) }) != -1 {
+			return fmt.Errorf("invalid metadata key %q: must only contain letters, digits, and the characters !#$%%&'*+-.^_`|~", key)
+		}
+
+		if strings.IndexFunc(value, func(r rune) bool { return r < ' ' || r > '~' }) != -1 {
+			return fmt.Errorf("invalid value for metadata key %q: must only contain printable ASCII characters", key)
+		}
+
+		size += len(key) + len(value)
+	}
+
+	if size > maxMetadataSize {
+		return fmt.Errorf("metadata is %d bytes; S3 allows at most %d", size, maxMetadataSize)
+	}
+
+	return nil
+}
+
+// isTokenRune reports whether r may appear in an HTTP header name.
+func isTokenRune(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	default:
+		return strings.ContainsRune("!#$%&'*+-.^_`|~", r)
+	}
+}
+
+// applyHeaders sets the fields of an upload corresponding to the given HTTP headers. Besides
+// standard headers, `X-Amz-Acl` sets the canned ACL, where an empty value omits the ACL,
+// `X-Amz-Grant-*` headers grant permissions instead of the ACL, unless one is set too,
+// `X-Amz-Meta-*` headers add user metadata, and `X-Amz-Tag-*` headers add or replace object tags.
+func applyHeaders(input *s3.PutObjectInput, headers map[string]string) error {
+	var granted bool
+	var tags map[string]string
+	for name, value := range headers {
+		if key, ok := strings.CutPrefix(name, tagHeaderPrefix); ok {
+			if tags == nil {
+				tags = map[string]string{}
+			}
+
+			tags[key] = value
+
+			continue
+		}
+
+		if key, ok := strings.CutPrefix(name, "X-Amz-Meta-"); ok {
+			// The metadata map may be shared between uploads, so it is copied before being
+			// modified.
+			metadata := make(map[string]string, len(input.Metadata)+1)
+			for k, v := range input.Metadata {
+				metadata[k] = v
+			}
+
+			metadata[strings.ToLower(key)] = value
+			input.Metadata = metadata
+
+			continue
+		}
+
+		switch name {
+		case "Cache-Control":
+			input.CacheControl = aws.String(value)
+		case "Content-Disposition":
+			input.ContentDisposition = aws.String(value)
+		case "Content-Encoding":
+			input.ContentEncoding = aws.String(value)
+		case "Content-Language":
+			input.ContentLanguage = aws.String(value)
+		case "Content-Type":
+			input.ContentType = aws.String(value)
+		case "X-Amz-Acl":
+			input.ACL = types.ObjectCannedACL(value)
+		case "X-Amz-Grant-Read":
+			input.GrantRead, granted = aws.String(value), true
+		case "X-Amz-Grant-Read-Acp":
+			input.GrantReadACP, granted = aws.String(value), true
+		case "X-Amz-Grant-Write-Acp":
+			input.GrantWriteACP, granted = aws.String(value), true
+		case "X-Amz-Grant-Full-Control":
+			input.GrantFullControl, granted = aws.String(value), true
+		case redirectHeader:
+			input.WebsiteRedirectLocation = aws.String(value)
+		case "If-Match":
+			input.IfMatch = aws.String(value)
+		case "If-None-Match":
+			input.IfNoneMatch = aws.String(value)
+		default:
+			return fmt.Errorf("unsupported header: %s", name)
+		}
+	}
+
+	if tags != nil {
+		if err := addTags(input, tags); err != nil {
+			return err
+		}
+	}
+
+	// S3 rejects uploads with both a canned ACL and grants. A canned ACL set for the object, e.g.
+	// by a rule, replaces the grants, which replace the default ACL.
+	if !granted {
+		return nil
+	}
+
+	if acl := headers["X-Amz-Acl"]; acl != "" {
+		input.GrantRead, input.GrantReadACP, input.GrantWriteACP, input.GrantFullControl = nil, nil, nil, nil
+	} else {
+		input.ACL = ""
+	}
+
+	return nil
+}
+
+// addTags adds tags to those of an upload, replacing any with the same key.
+func addTags(input *s3.PutObjectInput, tags map[string]string) error {
+	existing, err := url.ParseQuery(aws.ToString(input.Tagging))
+	if err != nil {
+		return fmt.Errorf("invalid tags %q: %v", aws.ToString(input.Tagging), err)
+	}
+
+	for key, values := range existing {
+		if _, ok := tags[key]; !ok && len(values) > 0 {
+			tags[key] = values[0]
+		}
+	}
+
+	tagging, err := encodeTags(tags)
+	if err != nil {
+		return err
+	}
+
+	input.Tagging = aws.String(tagging)
+
+	return nil
+}
+
+// List returns every object in the bucket under the prefix, following pagination. The objects
+// are keyed by their path relative to the prefix.
+func (s *s3Uploader) List(ctx context.Context) (map[string]remoteObject, error) {
+	return listObjectsSharded(ctx, s.client, s.bucket, s.Prefix, s.ListConcurrency)
+}
+
+// listObjects returns every object in a bucket under a prefix, following pagination. The objects
+// are keyed by their path relative to the prefix.
+func listObjects(ctx context.Context, client s3.ListObjectsV2APIClient, bucket, prefix string) (map[string]remoteObject, error) {
+	objects := map[string]remoteObject{}
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(bucket)}
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
+
+	if _, err := listPages(ctx, client, input, prefix, objects); err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// listObjectsSharded returns the same objects as listObjects, but lists the directories directly
+// beneath the prefix in parallel, up to `concurrency` at a time. Listing is sequential within a
+// directory, so this helps most with keys spread over many top-level directories.
+func listObjectsSharded(ctx context.Context, client s3.ListObjectsV2APIClient, bucket, prefix string, concurrency int) (map[string]remoteObject, error) {
+	if concurrency <= 1 {
+		return listObjects(ctx, client, bucket, prefix)
+	}
+
+	// The first level is listed with a delimiter, which returns its directories as common
+	// prefixes instead of the objects within them.
+	objects := map[string]remoteObject{}
+	shards, err := listPages(ctx, client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	}, prefix, objects)
+	if err != nil {
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var listErr error
+	slots := make(chan struct{}, concurrency)
+	for _, shard := range shards {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(shard string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			found := map[string]remoteObject{}
+			_, err := listPages(ctx, client, &s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(shard)}, prefix, found)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				if listErr == nil {
+					listErr = err
+				}
+
+				return
+			}
+
+			maps.Copy(objects, found)
+		}(shard)
+	}
+
+	wg.Wait()
+	if listErr != nil {
+		return nil, listErr
+	}
+
+	return objects, nil
+}
+
+// listPages adds the objects listed by every page of a listing to `objects`, keyed by their path
+// relative to the prefix, and returns the common prefixes of a listing with a delimiter.
+func listPages(ctx context.Context, client s3.ListObjectsV2APIClient, input *s3.ListObjectsV2Input, prefix string, objects map[string]remoteObject) ([]string, error) {
+	var commonPrefixes []string
+	paginator := s3.NewListObjectsV2Paginator(client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list S3 objects: %v", err)
+		}
+
+		for _, object := range page.Contents {
+			key := strings.TrimPrefix(aws.ToString(object.Key), prefix)
+			objects[key] = remoteObject{
+				Key:          key,
+				Size:         aws.ToInt64(object.Size),
+				ETag:         strings.Trim(aws.ToString(object.ETag), `"`),
+				LastModified: aws.ToTime(object.LastModified),
+				StorageClass: string(object.StorageClass),
+			}
+		}
+
+		for _, common := range page.CommonPrefixes {
+			commonPrefixes = append(commonPrefixes, aws.ToString(common.Prefix))
+		}
+	}
+
+	return commonPrefixes, nil
+}
+
+// Head returns the properties of the object at the given path, relative to the prefix.
+func (s *s3Uploader) Head(ctx context.Context, path string) (objectHead, error) {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.Prefix + path),
+	}
+
+	s.Encryption.applyHead(input)
+
+	output, err := s.client.HeadObject(ctx, input)
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return objectHead{}, fmt.Errorf("failed to read S3 object: %w", fs.ErrNotExist)
+	}
+
+	if err != nil {
+		return objectHead{}, fmt.Errorf("failed to read S3 object: %w", err)
+	}
+
+	return objectHead{
+		Size:         aws.ToInt64(output.ContentLength),
+		ETag:         strings.Trim(aws.ToString(output.ETag), `"`),
+		ContentType:  aws.ToString(output.ContentType),
+		Metadata:     output.Metadata,
+		LastModified: aws.ToTime(output.LastModified),
+	}, nil
+}
+
+// ReadState returns the contents of the state object at the given path, relative to the prefix.
+// If the object doesn't exist, the error wraps `fs.ErrNotExist`.
+func (s *s3Uploader) ReadState(ctx context.Context, path string) ([]byte, error) {
+	body, _, err := s.ReadStateETag(ctx, path)
+	return body, err
+}
+
+// ReadStateETag returns the contents of the state object at the given path along with its ETag,
+// for use in conditional requests.
+func (s *s3Uploader) ReadStateETag(ctx context.Context, path string) ([]byte, string, error) {
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.Prefix + path),
+	})
+
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, "", fmt.Errorf("failed to read %s: %w", path, fs.ErrNotExist)
+	}
+
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	defer output.Body.Close()
+
+	body, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	return body, aws.ToString(output.ETag), nil
+}
+
+// WriteState stores a JSON state object at the given path, relative to the prefix. State objects
+// are private and don't get the metadata, tags, or encryption settings of uploaded files.
+func (s *s3Uploader) WriteState(ctx context.Context, path string, body []byte) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.Prefix + path),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// CreateState stores a JSON state object at the given path, relative to the prefix, unless it
+// already exists, and returns its ETag. If the object exists, the error wraps `fs.ErrExist`.
+func (s *s3Uploader) CreateState(ctx context.Context, path string, body []byte) (string, error) {
+	output, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.Prefix + path),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+		IfNoneMatch: aws.String("*"),
+	})
+	if isPreconditionFailed(err) {
+		return "", fmt.Errorf("failed to create %s: %w", path, fs.ErrExist)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", path, err)
+	}
+
+	return aws.ToString(output.ETag), nil
+}
+
+// DeleteState removes the state object at the given path, relative to the prefix, if its ETag
+// still matches. If it was changed in the meantime, the error wraps `fs.ErrExist`.
+func (s *s3Uploader) DeleteState(ctx context.Context, path, etag string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket:  aws.String(s.bucket),
+		Key:     aws.String(s.Prefix + path),
+		IfMatch: aws.String(etag),
+	})
+	if isPreconditionFailed(err) {
+		return fmt.Errorf("failed to delete %s: %w", path, fs.ErrExist)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// isPreconditionFailed reports whether a conditional request failed because the object didn't
+// match the condition, or because a concurrent request for the same object won the race.
+func isPreconditionFailed(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	switch apiErr.ErrorCode() {
+	case "PreconditionFailed", "ConditionalRequestConflict":
+		return true
+	default:
+		return false
+	}
+}
+
+// maxDeleteBatch is the largest number of keys S3 accepts in a single DeleteObjects request.
+const maxDeleteBatch = 1000
+
+// Delete removes the objects with the given keys, relative to the prefix, from the bucket.
+func (s *s3Uploader) Delete(ctx context.Context, keys []string) error {
+	return deleteObjects(ctx, s.client, s.bucket, s.Prefix, keys)
+}
+
+// deleteObjects removes the objects with the given keys, relative to the prefix, from the bucket
+// in batches of up to `maxDeleteBatch` keys.
+func deleteObjects(ctx context.Context, client *s3.Client, bucket, prefix string, keys []string) error {
+	for start := 0; start < len(keys); start += maxDeleteBatch {
+		end := start + maxDeleteBatch
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		objects := make([]types.ObjectIdentifier, 0, end-start)
+		for _, key := range keys[start:end] {
+			objects = append(objects, types.ObjectIdentifier{Key: aws.String(prefix + key)})
+		}
+
+		output, err := client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete S3 objects: %v", err)
+		}
+
+		if len(output.Errors) > 0 {
+			failure := output.Errors[0]
+			return fmt.Errorf("failed to delete %s: %s", aws.ToString(failure.Key), aws.ToString(failure.Message))
+		}
+
+		for _, key := range keys[start:end] {
+			log.Printf("Deleted %s\n", prefix+key)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func Test_applyHeaders(t *testing.T) {
+	input := &s3.PutObjectInput{}
+	err := applyHeaders(input, map[string]string{
+		"Cache-Control":                   "no-cache",
+		"Content-Language":                "en",
+		"X-Amz-Website-Redirect-Location": "/new-page",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if aws.ToString(input.WebsiteRedirectLocation) != "/new-page" {
+		t.Errorf("Expected redirect location %q; got %q", "/new-page", aws.ToString(input.WebsiteRedirectLocation))
+	}
+
+	if aws.ToString(input.CacheControl) != "no-cache" {
+		t.Errorf("Expected Cache-Control %q; got %q", "no-cache", aws.ToString(input.CacheControl))
+	}
+
+	if aws.ToString(input.ContentLanguage) != "en" {
+		t.Errorf("Expected Content-Language %q; got %q", "en", aws.ToString(input.ContentLanguage))
+	}
+
+	shared := map[string]string{"app-version": "1.0"}
+	input = &s3.PutObjectInput{ACL: types.ObjectCannedACLPublicRead, Metadata: shared}
+	err = applyHeaders(input, map[string]string{
+		"Content-Type":     "text/plain",
+		"X-Amz-Acl":        "",
+		"X-Amz-Meta-Build": "42",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if aws.ToString(input.ContentType) != "text/plain" {
+		t.Errorf("Expected Content-Type %q; got %q", "text/plain", aws.ToString(input.ContentType))
+	}
+
+	if input.ACL != "" {
+		t.Errorf("Expected the ACL to be omitted; got %q", input.ACL)
+	}
+
+	if input.Metadata["build"] != "42" || input.Metadata["app-version"] != "1.0" {
+		t.Errorf("Expected metadata to be merged; got %v", input.Metadata)
+	}
+
+	if _, ok := shared["build"]; ok {
+		t.Error("Expected the shared metadata map to be left unchanged")
+	}
+
+	if err := applyHeaders(input, map[string]string{"X-Unknown": "foo"}); err == nil {
+		t.Error("Expected an error for an unsupported header")
+	}
+}
+
+func Test_applyHeaders_grants(t *testing.T) {
+	grantee := `id="79a59df9"`
+
+	testCases := []struct {
+		desc      string
+		headers   map[string]string
+		wantACL   types.ObjectCannedACL
+		wantGrant string
+	}{
+		{desc: "default ACL", headers: map[string]string{}, wantACL: types.ObjectCannedACLPublicRead},
+		{desc: "grants replace default ACL", headers: map[string]string{"X-Amz-Grant-Read": grantee}, wantGrant: grantee},
+		{desc: "ACL replaces grants", headers: map[string]string{"X-Amz-Grant-Read": grantee, "X-Amz-Acl": "private"}, wantACL: types.ObjectCannedACLPrivate},
+		{desc: "grants without ACL", headers: map[string]string{"X-Amz-Grant-Read": grantee, "X-Amz-Acl": ""}, wantGrant: grantee},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			input := &s3.PutObjectInput{ACL: types.ObjectCannedACLPublicRead}
+			if err := applyHeaders(input, tC.headers); err != nil {
+				t.Fatal(err)
+			}
+
+			if input.ACL != tC.wantACL {
+				t.Errorf("Expected ACL %q; got %q", tC.wantACL, input.ACL)
+			}
+
+			if got := aws.ToString(input.GrantRead); got != tC.wantGrant {
+				t.Errorf("Expected read grant %q; got %q", tC.wantGrant, got)
+			}
+		})
+	}
+}
+
+func Test_applyHeaders_tags(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		tagging string
+		headers map[string]string
+		want    string
+		wantErr bool
+	}{
+		{desc: "no tags", headers: map[string]string{"X-Amz-Tag-ttl": "7d"}, want: "ttl=7d"},
+		{desc: "added to tags", tagging: "team=web", headers: map[string]string{"X-Amz-Tag-ttl": "7d"}, want: "team=web&ttl=7d"},
+		{desc: "replaced tag", tagging: "team=web&ttl=30d", headers: map[string]string{"X-Amz-Tag-ttl": "7d"}, want: "team=web&ttl=7d"},
+		{desc: "too many tags", tagging: "a=1&b=2&c=3&d=4&e=5&f=6&g=7&h=8&i=9&j=10", headers: map[string]string{"X-Amz-Tag-ttl": "7d"}, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			input := &s3.PutObjectInput{}
+			if tC.tagging != "" {
+				input.Tagging = aws.String(tC.tagging)
+			}
+
+			err := applyHeaders(input, tC.headers)
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if got := aws.ToString(input.Tagging); err == nil && got != tC.want {
+				t.Errorf("Expected tagging %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_parseACL(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		value   string
+		want    types.ObjectCannedACL
+		wantErr bool
+	}{
+		{desc: "canned ACL", value: "public-read", want: "public-read"},
+		{desc: "private", value: "private", want: "private"},
+		{desc: "none", value: "none", want: ""},
+		{desc: "unknown", value: "world-writable", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := parseACL(tC.value)
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if got != tC.want {
+				t.Errorf("Expected ACL %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_normalizeEndpoint(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		endpoint string
+		want     string
+	}{
+		{desc: "empty", endpoint: "", want: ""},
+		{desc: "bare host", endpoint: "nyc3.digitaloceanspaces.com", want: "https://nyc3.digitaloceanspaces.com"},
+		{desc: "full URL", endpoint: "http://localhost:9000", want: "http://localhost:9000"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := normalizeEndpoint(tC.endpoint); got != tC.want {
+				t.Errorf("Expected endpoint %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_encodeTags(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		tags    map[string]string
+		want    string
+		wantErr bool
+	}{
+		{
+			desc: "no tags",
+			tags: map[string]string{},
+			want: "",
+		},
+		{
+			desc: "sorted and escaped",
+			tags: map[string]string{"team": "web", "env": "pre prod"},
+			want: "env=pre+prod&team=web",
+		},
+		{
+			desc:    "empty key",
+			tags:    map[string]string{"": "web"},
+			wantErr: true,
+		},
+		{
+			desc:    "value too long",
+			tags:    map[string]string{"team": strings.Repeat("a", 257)},
+			wantErr: true,
+		},
+		{
+			desc: "too many tags",
+			tags: map[string]string{
+				"a": "", "b": "", "c": "", "d": "", "e": "", "f": "", "g": "", "h": "", "i": "", "j": "", "k": "",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := encodeTags(tC.tags)
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if got != tC.want {
+				t.Errorf("Expected tagging %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_validateMetadata(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		metadata map[string]string
+		wantErr  bool
+	}{
+		{desc: "valid", metadata: map[string]string{"app-version": "1.2.3", "built_by": "ci job #4"}},
+		{desc: "empty key", metadata: map[string]string{"": "foo"}, wantErr: true},
+		{desc: "space in key", metadata: map[string]string{"app version": "1.2.3"}, wantErr: true},
+		{desc: "colon in key", metadata: map[string]string{"app:version": "1.2.3"}, wantErr: true},
+		{desc: "newline in value", metadata: map[string]string{"note": "a\nb"}, wantErr: true},
+		{desc: "non-ASCII value", metadata: map[string]string{"author": "Zoë"}, wantErr: true},
+		{desc: "too large", metadata: map[string]string{"notes": strings.Repeat("a", 2044)}, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := validateMetadata(tC.metadata)
+			if (err == nil) == tC.wantErr {
+				t.Errorf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_normalizePrefix(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		prefix string
+		want   string
+	}{
+		{desc: "empty", prefix: "", want: ""},
+		{desc: "root", prefix: "/", want: ""},
+		{desc: "bare", prefix: "site", want: "site/"},
+		{desc: "slashes", prefix: "/site/v1/", want: "site/v1/"},
+		{desc: "backslashes", prefix: `site\v1\`, want: "site/v1/"},
+		{desc: "relative", prefix: "./site", want: "site/"},
+		{desc: "working directory", prefix: ".", want: ""},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := normalizePrefix(tC.prefix); got != tC.want {
+				t.Errorf("Expected prefix %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_bucketURL(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		endpoint  string
+		pathStyle bool
+		want      string
+	}{
+		{
+			desc: "aws",
+			want: "https://my-bucket.s3.eu-west-1.amazonaws.com/",
+		},
+		{
+			desc:      "aws with path-style addressing",
+			pathStyle: true,
+			want:      "https://s3.eu-west-1.amazonaws.com/my-bucket/",
+		},
+		{
+			desc:     "bare host endpoint",
+			endpoint: "nyc3.digitaloceanspaces.com",
+			want:     "https://nyc3.digitaloceanspaces.com/my-bucket/",
+		},
+		{
+			desc:     "url endpoint",
+			endpoint: "http://localhost:9000/",
+			want:     "http://localhost:9000/my-bucket/",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := bucketURL(tC.endpoint, "eu-west-1", "my-bucket", tC.pathStyle); got != tC.want {
+				t.Errorf("Expected %s; got %s", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_s3Uploader_Sub(t *testing.T) {
+	base := &s3Uploader{bucket: "my-bucket", bucketURL: "https://my-bucket.s3.us-east-1.amazonaws.com/", Prefix: "site/"}
+
+	sub := base.Sub("deploys/v2/")
+
+	if got, want := sub.URL(), "https://my-bucket.s3.us-east-1.amazonaws.com/site/deploys/v2/"; got != want {
+		t.Errorf("Expected URL %s; got %s", want, got)
+	}
+
+	if base.Prefix != "site/" {
+		t.Errorf("Expected the base prefix to be unchanged; got %s", base.Prefix)
+	}
+}
+
+// mockLister lists a fixed set of keys, recording the prefixes listed.
+type mockLister struct {
+	keys []string
+
+	mu       sync.Mutex
+	prefixes []string
+}
+
+func (m *mockLister) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	prefix := aws.ToString(params.Prefix)
+
+	m.mu.Lock()
+	m.prefixes = append(m.prefixes, prefix)
+	m.mu.Unlock()
+
+	output := &s3.ListObjectsV2Output{}
+	seen := map[string]bool{}
+	for _, key := range m.keys {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+
+		if dir, _, nested := strings.Cut(rest, "/"); nested && params.Delimiter != nil {
+			if !seen[dir] {
+				seen[dir] = true
+				output.CommonPrefixes = append(output.CommonPrefixes, types.CommonPrefix{Prefix: aws.String(prefix + dir + "/")})
+			}
+
+			continue
+		}
+
+		output.Contents = append(output.Contents, types.Object{Key: aws.String(key), Size: aws.Int64(1)})
+	}
+
+	return output, nil
+}
+
+func Test_listObjectsSharded(t *testing.T) {
+	keys := []string{"site/index.html", "site/css/app.css", "site/js/app.js", "site/js/vendor/lib.js", "other/index.html"}
+
+	testCases := []struct {
+		desc         string
+		concurrency  int
+		wantPrefixes []string
+	}{
+		{desc: "sequential", concurrency: 1, wantPrefixes: []string{"site/"}},
+		{desc: "sharded", concurrency: 2, wantPrefixes: []string{"site/", "site/css/", "site/js/"}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &mockLister{keys: keys}
+			objects, err := listObjectsSharded(context.Background(), client, "my-bucket", "site/", tC.concurrency)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var got []string
+			for key := range objects {
+				got = append(got, key)
+			}
+
+			sort.Strings(got)
+			if want := []string{"css/app.css", "index.html", "js/app.js", "js/vendor/lib.js"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("Expected objects %v; got %v", want, got)
+			}
+
+			sort.Strings(client.prefixes)
+			if !reflect.DeepEqual(client.prefixes, tC.wantPrefixes) {
+				t.Errorf("Expected listings of %v; got %v", tC.wantPrefixes, client.prefixes)
+			}
+		})
+	}
+}
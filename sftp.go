@@ -0,0 +1,498 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	syncplan "github.com/Zeroed-Books/s3-copy/pkg/sync"
+)
+
+func init() {
+	registerBackend("sftp", newSFTPBackend)
+}
+
+// sftpBackend writes files to a server over SFTP, for hosting that can't be deployed to any other
+// way. Like a local directory, the server can't store content types, headers, ACLs, or metadata,
+// so they are dropped.
+type sftpBackend struct {
+	client *sftp.Client
+	host   string
+	// root is "/" for absolute paths, or empty for paths relative to the login directory.
+	root   string
+	prefix string
+
+	// uploaded records the content type and metadata of the files written by this run, so that
+	// they can be verified along with their contents.
+	uploaded *fileProperties
+}
+
+// newSFTPBackend connects to the server of a bucket given as `sftp://[user@]host[:port]/<dir>`.
+// The directory is absolute, unless it starts with `~/`, in which case it is relative to the login
+// directory.
+func newSFTPBackend(ctx context.Context, common *commonFlags, bucket, prefix string, options backendOptions) (backend, error) {
+	if err := checkFileOptions("SFTP", options); err != nil {
+		return nil, err
+	}
+
+	address, config, err := sshClientConfig(bucket, common.sshKey, common.sshKnownHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %s: %v", address, err)
+	}
+
+	sshConn, channels, requests, err := ssh.NewClientConn(conn, address, config)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("could not connect to %s: %v", address, err)
+	}
+
+	client, err := sftp.NewClient(ssh.NewClient(sshConn, channels, requests))
+	if err != nil {
+		sshConn.Close()
+		return nil, fmt.Errorf("could not start SFTP session with %s: %v", address, err)
+	}
+
+	return newSFTPStore(client, bucket, prefix), nil
+}
+
+// newSFTPStore creates the backend for the given directory of an SFTP session.
+func newSFTPStore(client *sftp.Client, host, prefix string) *sftpBackend {
+	root := "/"
+	if rest, ok := strings.CutPrefix(prefix, "~/"); ok {
+		root, prefix = "", rest
+	}
+
+	return &sftpBackend{
+		client:   client,
+		host:     host,
+		root:     root,
+		prefix:   prefix,
+		uploaded: newFileProperties(),
+	}
+}
+
+// sshClientConfig returns the address of the server named by `[user@]host[:port]` and the
+// configuration to connect to it with. The user defaults to the current one, and the port to 22.
+// Connections are authenticated with the given private key file, or else by ssh-agent, and the
+// server's host key must be listed in the known_hosts file.
+func sshClientConfig(server, keyFile, knownHostsFile string) (string, *ssh.ClientConfig, error) {
+	username, host, ok := strings.Cut(server, "@")
+	if !ok {
+		host = server
+
+		current, err := user.Current()
+		if err != nil {
+			return "", nil, fmt.Errorf("could not determine the SSH user: %v", err)
+		}
+
+		username = current.Username
+	}
+
+	if host == "" {
+		return "", nil, errors.New("missing SFTP server; expected sftp://[user@]host[:port]/<dir>")
+	}
+
+	address := host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		address = net.JoinHostPort(host, "22")
+	}
+
+	auth, err := sshAuthMethod(keyFile)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if knownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", nil, fmt.Errorf("could not find known_hosts file: %v", err)
+		}
+
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return "", nil, fmt.Errorf("could not read known_hosts file: %v", err)
+	}
+
+	return address, &ssh.ClientConfig{
+		User:            username,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: hostKeyCallback,
+	}, nil
+}
+
+// sshAuthMethod authenticates with the private key in the given file, or with the keys of the
+// running ssh-agent if it's empty.
+func sshAuthMethod(keyFile string) (ssh.AuthMethod, error) {
+	if keyFile != "" {
+		key, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read SSH key: %v", err)
+		}
+
+		signer, err := ssh.ParsePrivateKey(key)
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			return nil, fmt.Errorf("the SSH key %s is encrypted; add it to ssh-agent and omit -ssh-key instead", keyFile)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("could not parse SSH key: %v", err)
+		}
+
+		return ssh.PublicKeys(signer), nil
+	}
+
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, errors.New("no SSH credentials; use -ssh-key or start ssh-agent")
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to ssh-agent: %v", err)
+	}
+
+	return ssh.PublicKeysCallback(agent.NewClient(conn).Signers), nil
+}
+
+// remotePath returns the path on the server of the object at the given path, relative to the
+// prefix.
+func (s *sftpBackend) remotePath(p string) (string, error) {
+	key := s.prefix + p
+	if strings.HasSuffix(key, "/") || !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("can't store %s as a file", key)
+	}
+
+	return s.root + key, nil
+}
+
+// dir returns the directory on the server that holds the objects beneath the prefix.
+func (s *sftpBackend) dir() string {
+	if s.prefix == "" && s.root == "" {
+		return "."
+	}
+
+	if s.prefix == "" {
+		return s.root
+	}
+
+	return s.root + strings.TrimSuffix(s.prefix, "/")
+}
+
+func (s *sftpBackend) Upload(ctx context.Context, object *uploadObject) error {
+	if _, ok := object.Headers[redirectHeader]; ok {
+		return fmt.Errorf("can't store the redirect %s as a file", object.Path)
+	}
+
+	name, err := s.remotePath(object.Path)
+	if err != nil {
+		return err
+	}
+
+	if err := s.writeFileAtomic(name, object.Body); err != nil {
+		return fmt.Errorf("failed to write %s: %v", object.Path, err)
+	}
+
+	s.uploaded.record(s.prefix+object.Path, object)
+
+	return nil
+}
+
+// writeFileAtomic writes a file through a temporary file in the same directory, so that the web
+// server never serves a partially written file.
+func (s *sftpBackend) writeFileAtomic(name string, body io.Reader) error {
+	if err := s.client.MkdirAll(path.Dir(name)); err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+
+	temp := path.Join(path.Dir(name), "."+path.Base(name)+".tmp"+hex.EncodeToString(suffix))
+	file, err := s.client.OpenFile(temp, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return err
+	}
+	defer s.client.Remove(temp)
+
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := s.client.Chmod(temp, 0o644); err != nil {
+		return err
+	}
+
+	return s.rename(temp, name)
+}
+
+// rename replaces the file at `newname` with the one at `oldname`. Plain SFTP renames fail if the
+// target exists, so the OpenSSH extension is used if the server supports it. Otherwise the target
+// is removed first, which leaves a brief window in which it's missing.
+func (s *sftpBackend) rename(oldname, newname string) error {
+	if _, ok := s.client.HasExtension("posix-rename@openssh.com"); ok {
+		return s.client.PosixRename(oldname, newname)
+	}
+
+	if err := s.client.Remove(newname); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return s.client.Rename(oldname, newname)
+}
+
+// List returns every file beneath the prefix. SFTP servers don't compute digests, so every file is
+// read to compute the hex-encoded MD5 digest of its contents, like the ETags of S3 objects uploaded
+// in a single part, so that unchanged files can be recognized.
+func (s *sftpBackend) List(ctx context.Context) (map[string]remoteObject, error) {
+	objects := map[string]remoteObject{}
+	dir := s.dir()
+	walker := s.client.Walk(dir)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			if errors.Is(err, fs.ErrNotExist) && walker.Path() == dir {
+				break
+			}
+
+			return nil, fmt.Errorf("failed to list files: %v", err)
+		}
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		info := walker.Stat()
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		etag, err := s.fileETag(walker.Path())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files: %v", err)
+		}
+
+		key := strings.TrimPrefix(walker.Path(), strings.TrimSuffix(dir, "/")+"/")
+		objects[key] = remoteObject{
+			Key:          key,
+			Size:         info.Size(),
+			ETag:         etag,
+			LastModified: info.ModTime(),
+		}
+	}
+
+	return objects, nil
+}
+
+// fileETag returns the hex-encoded MD5 digest of a file on the server.
+func (s *sftpBackend) fileETag(name string) (string, error) {
+	file, err := s.client.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	return syncplan.LocalETag(file, 0)
+}
+
+// Head returns the size and ETag of the file at the given path, along with the content type and
+// metadata it was written with by this run.
+func (s *sftpBackend) Head(ctx context.Context, p string) (objectHead, error) {
+	name, err := s.remotePath(p)
+	if err != nil {
+		return objectHead{}, err
+	}
+
+	info, err := s.client.Stat(name)
+	if err != nil {
+		return objectHead{}, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	etag, err := s.fileETag(name)
+	if err != nil {
+		return objectHead{}, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	head := s.uploaded.lookup(s.prefix + p)
+	head.Size = info.Size()
+	head.ETag = etag
+
+	return head, nil
+}
+
+// Delete removes the files at the given paths, along with any directories left empty.
+func (s *sftpBackend) Delete(ctx context.Context, paths []string) error {
+	base := s.dir()
+	for _, p := range paths {
+		name, err := s.remotePath(p)
+		if err != nil {
+			return err
+		}
+
+		if err := s.client.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to delete %s: %v", p, err)
+		}
+
+		// Removing a directory fails once one that isn't empty is reached.
+		for dir := path.Dir(name); dir != base && dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if s.client.RemoveDirectory(dir) != nil {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *sftpBackend) Sub(dir string) backend {
+	sub := *s
+	sub.prefix += dir
+
+	return &sub
+}
+
+func (s *sftpBackend) URL() string {
+	if s.root == "" {
+		return "sftp://" + s.host + "/~/" + s.prefix
+	}
+
+	return "sftp://" + s.host + "/" + s.prefix
+}
+
+func (s *sftpBackend) ReadState(ctx context.Context, p string) ([]byte, error) {
+	body, _, err := s.ReadStateETag(ctx, p)
+	return body, err
+}
+
+// ReadStateETag returns the contents of the state file at the given path along with its MD5
+// digest, for use in conditional requests.
+func (s *sftpBackend) ReadStateETag(ctx context.Context, p string) ([]byte, string, error) {
+	name, err := s.remotePath(p)
+	if err != nil {
+		return nil, "", err
+	}
+
+	file, err := s.client.Open(name)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s: %w", p, err)
+	}
+	defer file.Close()
+
+	body, err := io.ReadAll(file)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s: %v", p, err)
+	}
+
+	etag, err := syncplan.LocalETag(bytes.NewReader(body), 0)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return body, etag, nil
+}
+
+func (s *sftpBackend) WriteState(ctx context.Context, p string, body []byte) error {
+	name, err := s.remotePath(p)
+	if err != nil {
+		return err
+	}
+
+	if err := s.writeFileAtomic(name, bytes.NewReader(body)); err != nil {
+		return fmt.Errorf("failed to write %s: %v", p, err)
+	}
+
+	return nil
+}
+
+// CreateState writes a state file unless it already exists, in which case the error wraps
+// `fs.ErrExist`. SFTP servers report most failures the same way, so the file is checked for
+// after a failed attempt.
+func (s *sftpBackend) CreateState(ctx context.Context, p string, body []byte) (string, error) {
+	name, err := s.remotePath(p)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.client.MkdirAll(path.Dir(name)); err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", p, err)
+	}
+
+	file, err := s.client.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		if _, statErr := s.client.Stat(name); statErr == nil {
+			return "", fmt.Errorf("failed to create %s: %w", p, fs.ErrExist)
+		}
+
+		return "", fmt.Errorf("failed to create %s: %v", p, err)
+	}
+
+	if _, err := file.Write(body); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to create %s: %v", p, err)
+	}
+
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", p, err)
+	}
+
+	return syncplan.LocalETag(bytes.NewReader(body), 0)
+}
+
+// DeleteState removes the state file at the given path if its contents didn't change since they
+// were read. If they did, the error wraps `fs.ErrExist`.
+func (s *sftpBackend) DeleteState(ctx context.Context, p, etag string) error {
+	_, current, err := s.ReadStateETag(ctx, p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if current != etag {
+		return fmt.Errorf("failed to delete %s: %w", p, fs.ErrExist)
+	}
+
+	name, err := s.remotePath(p)
+	if err != nil {
+		return err
+	}
+
+	if err := s.client.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete %s: %v", p, err)
+	}
+
+	return nil
+}
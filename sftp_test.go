@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// newTestSFTPStore returns a backend for the given directory of an in-memory SFTP server.
+func newTestSFTPStore(t *testing.T, prefix string) *sftpBackend {
+	t.Helper()
+
+	serverConn, clientConn := net.Pipe()
+	server := sftp.NewRequestServer(serverConn, sftp.InMemHandler())
+	go server.Serve()
+
+	client, err := sftp.NewClientPipe(clientConn, clientConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+
+	return newSFTPStore(client, "deploy@example.com", prefix)
+}
+
+func Test_sftpBackend(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSFTPStore(t, "srv/www/")
+
+	for _, body := range []string{"old", "hello"} {
+		err := store.Upload(ctx, &uploadObject{
+			Path:        "assets/app.js",
+			Body:        strings.NewReader(body),
+			ContentType: "text/javascript",
+			Headers:     map[string]string{"X-Amz-Meta-Owner": "web"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	objects, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := remoteObject{Key: "assets/app.js", Size: 5, ETag: "5d41402abc4b2a76b9719d911017c592"}
+	if got := objects["assets/app.js"]; len(objects) != 1 || got.Key != want.Key || got.Size != want.Size || got.ETag != want.ETag {
+		t.Errorf("Expected %+v to be listed; got %+v", want, objects)
+	}
+
+	head, err := store.Head(ctx, "assets/app.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if head.Size != 5 || head.ETag != want.ETag || head.ContentType != "text/javascript" || head.Metadata["owner"] != "web" {
+		t.Errorf("Unexpected properties: %+v", head)
+	}
+
+	if err := store.Delete(ctx, []string{"assets/app.js", "missing.txt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.client.Stat("/srv/www/assets"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected the empty directory to be removed; got %v", err)
+	}
+
+	if _, err := store.client.Stat("/srv/www"); err != nil {
+		t.Errorf("Expected the prefix directory to be kept; got %v", err)
+	}
+}
+
+func Test_sftpBackend_List_missing(t *testing.T) {
+	store := newTestSFTPStore(t, "missing/")
+
+	objects, err := store.List(context.Background())
+	if err != nil || len(objects) != 0 {
+		t.Errorf("Expected no objects for a missing directory; got %v, %v", objects, err)
+	}
+}
+
+func Test_sftpBackend_state(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSFTPStore(t, "site/")
+
+	etag, err := store.CreateState(ctx, lockPath, []byte("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.CreateState(ctx, lockPath, []byte("second")); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Expected fs.ErrExist for an existing state file; got %v", err)
+	}
+
+	if err := store.DeleteState(ctx, lockPath, "other"); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Expected fs.ErrExist for a changed state file; got %v", err)
+	}
+
+	if err := store.DeleteState(ctx, lockPath, etag); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.ReadState(ctx, lockPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist after deleting; got %v", err)
+	}
+}
+
+func Test_sftpBackend_URL(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		prefix string
+		want   string
+	}{
+		{
+			desc:   "absolute",
+			prefix: "var/www/",
+			want:   "sftp://deploy@example.com/var/www/",
+		},
+		{
+			desc:   "login directory",
+			prefix: "~/public_html/",
+			want:   "sftp://deploy@example.com/~/public_html/",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			store := newSFTPStore(nil, "deploy@example.com", tC.prefix)
+			if got := store.URL(); got != tC.want {
+				t.Errorf("Expected %s; got %s", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_sshClientConfig(t *testing.T) {
+	dir := t.TempDir()
+	knownHosts := filepath.Join(dir, "known_hosts")
+	if err := os.WriteFile(knownHosts, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(privateKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(key, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		desc        string
+		server      string
+		wantAddress string
+		wantUser    string
+	}{
+		{
+			desc:        "default port",
+			server:      "deploy@example.com",
+			wantAddress: "example.com:22",
+			wantUser:    "deploy",
+		},
+		{
+			desc:        "custom port",
+			server:      "web@example.com:2222",
+			wantAddress: "example.com:2222",
+			wantUser:    "web",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			address, config, err := sshClientConfig(tC.server, key, knownHosts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if address != tC.wantAddress || config.User != tC.wantUser {
+				t.Errorf("Expected %s@%s; got %s@%s", tC.wantUser, tC.wantAddress, config.User, address)
+			}
+		})
+	}
+}
+
+func Test_sshAuthMethod_noCredentials(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	if _, err := sshAuthMethod(""); err == nil {
+		t.Error("Expected an error without a key or agent")
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// sourceRoot is a directory given with -source, whose files are uploaded under a prefix of their
+// own instead of their path relative to the working directory.
+type sourceRoot struct {
+	// dir is the slash-separated path of the directory, relative to the working directory.
+	dir string
+	// prefix is added to the paths of the files relative to the directory, e.g. `docs/`.
+	prefix string
+}
+
+// sourceRoots are the directories a run uploads from, in the order they were given.
+type sourceRoots []sourceRoot
+
+// parseSourceRoots parses the directories given as `<dir>` or `<dir>=<prefix>`. Directories must
+// be within the working directory, and may not contain one another, since the files within both
+// would be uploaded twice.
+func parseSourceRoots(values []string) (sourceRoots, error) {
+	var roots sourceRoots
+	for _, value := range values {
+		dir, prefix, _ := strings.Cut(value, "=")
+		dir = filepath.Clean(dir)
+		if dir != "." && !filepath.IsLocal(dir) {
+			return nil, fmt.Errorf("invalid source %q: the directory must be within the working directory", value)
+		}
+
+		root := sourceRoot{dir: filepath.ToSlash(dir), prefix: normalizePrefix(prefix)}
+		for _, other := range roots {
+			if root.contains(other.dir) || other.contains(root.dir) {
+				return nil, fmt.Errorf("invalid source %q: it overlaps with the source %s", value, other.dir)
+			}
+		}
+
+		roots = append(roots, root)
+	}
+
+	return roots, nil
+}
+
+// contains reports whether the file or directory at the given path is within the directory.
+func (r sourceRoot) contains(name string) bool {
+	return r.dir == "." || name == r.dir || strings.HasPrefix(name, r.dir+"/")
+}
+
+// Walker returns a tree walker that walks the directories in turn.
+func (s sourceRoots) Walker(concurrency int, symlinks symlinkPolicy) treeWalker {
+	return func(walk fs.WalkDirFunc) error {
+		stopped := false
+		for _, root := range s {
+			// Each walker stops quietly when `walk` returns fs.SkipAll, which must stop the
+			// remaining directories from being walked too.
+			err := parallelWalker(root.dir, concurrency, symlinks)(func(path string, entry fs.DirEntry, err error) error {
+				err = walk(path, entry, err)
+				stopped = errors.Is(err, fs.SkipAll)
+				return err
+			})
+			if err != nil || stopped {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// Key returns the key of the file at the given path: its path relative to the directory
+// containing it, beneath the prefix of that directory.
+func (s sourceRoots) Key(name string) string {
+	for _, root := range s {
+		if root.contains(name) {
+			if root.dir == "." {
+				return root.prefix + name
+			}
+
+			return root.prefix + strings.TrimPrefix(name, root.dir+"/")
+		}
+	}
+
+	return name
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_parseSourceRoots(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		values  []string
+		want    sourceRoots
+		wantErr bool
+	}{
+		{desc: "none", values: nil, want: nil},
+		{
+			desc:   "directories with prefixes",
+			values: []string{"dist", "./docs/build/=/docs", "public=assets/"},
+			want:   sourceRoots{{dir: "dist"}, {dir: "docs/build", prefix: "docs/"}, {dir: "public", prefix: "assets/"}},
+		},
+		{desc: "outside working directory", values: []string{"../shared"}, wantErr: true},
+		{desc: "nested", values: []string{"docs", "docs/build=docs"}, wantErr: true},
+		{desc: "working directory and another", values: []string{".", "dist=app"}, wantErr: true},
+		{desc: "same directory twice", values: []string{"dist", "dist=v2"}, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := parseSourceRoots(tC.values)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("Expected %+v; got %+v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_sourceRoots_Key(t *testing.T) {
+	roots := sourceRoots{{dir: "dist"}, {dir: "docs/build", prefix: "docs/"}}
+
+	testCases := []struct {
+		desc  string
+		roots sourceRoots
+		name  string
+		want  string
+	}{
+		{desc: "without prefix", roots: roots, name: "dist/index.html", want: "index.html"},
+		{desc: "with prefix", roots: roots, name: "docs/build/guide/index.html", want: "docs/guide/index.html"},
+		{desc: "similar name", roots: roots, name: "distribution/index.html", want: "distribution/index.html"},
+		{desc: "working directory", roots: sourceRoots{{dir: ".", prefix: "site/"}}, name: "index.html", want: "site/index.html"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := tC.roots.Key(tC.name); got != tC.want {
+				t.Errorf("Expected key %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_sourceRoots_Walker(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	for _, name := range []string{"dist/index.html", "public/robots.txt", "public/zz.txt", "src/app.ts"} {
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(name, []byte("contents"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	roots := sourceRoots{{dir: "public"}, {dir: "dist"}}
+
+	testCases := []struct {
+		desc   string
+		stopAt string
+		want   []string
+	}{
+		{desc: "every source", want: []string{"public/robots.txt", "public/zz.txt", "dist/index.html"}},
+		{desc: "stopped walk", stopAt: "public/robots.txt", want: []string{"public/robots.txt"}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var got []string
+			err := roots.Walker(4, symlinkFiles)(func(path string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+
+				if entry.IsDir() {
+					return nil
+				}
+
+				got = append(got, path)
+				if path == tC.stopAt {
+					return fs.SkipAll
+				}
+
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("Expected %v; got %v", tC.want, got)
+			}
+		})
+	}
+}
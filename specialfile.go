@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// isHidden reports whether the file at the given path is a dotfile or beneath a dot-directory.
+func isHidden(name string) bool {
+	for _, segment := range strings.Split(filepath.ToSlash(name), "/") {
+		if strings.HasPrefix(segment, ".") && segment != "." && segment != ".." {
+			return true
+		}
+	}
+
+	return false
+}
+
+// specialFileKind describes the type of files that can't be uploaded, such as sockets, or returns
+// an empty string for regular files and directories. Reading a named pipe or a device would block
+// or never end, rather than fail.
+func specialFileKind(mode fs.FileMode) string {
+	switch {
+	case mode&fs.ModeNamedPipe != 0:
+		return "named pipe"
+	case mode&fs.ModeSocket != 0:
+		return "socket"
+	case mode&fs.ModeCharDevice != 0:
+		return "character device"
+	case mode&fs.ModeDevice != 0:
+		return "device"
+	case mode&fs.ModeIrregular != 0:
+		return "irregular file"
+	}
+
+	return ""
+}
+
+// fileSkipper leaves hidden and special files out of a walk. Special files fail the walk unless
+// they are skipped, instead of being opened. Every skipped file is reported once, even if the tree
+// is walked several times.
+type fileSkipper struct {
+	hidden  bool
+	special bool
+
+	mu       sync.Mutex
+	reported map[string]bool
+}
+
+// newFileSkipper creates a skipper that leaves out hidden files if `hidden` is set, and special
+// files if `special` is set.
+func newFileSkipper(hidden, special bool) *fileSkipper {
+	return &fileSkipper{hidden: hidden, special: special, reported: map[string]bool{}}
+}
+
+// Walker wraps a tree walker so that skipped files aren't passed to `walk`. Skipped directories
+// aren't walked at all.
+func (s *fileSkipper) Walker(walkFiles treeWalker) treeWalker {
+	return func(walk fs.WalkDirFunc) error {
+		return walkFiles(func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return walk(path, entry, err)
+			}
+
+			if s.hidden && isHidden(path) {
+				s.report(path, "hidden")
+				if entry.IsDir() {
+					return fs.SkipDir
+				}
+
+				return nil
+			}
+
+			if kind := specialFileKind(entry.Type()); kind != "" {
+				if !s.special {
+					return walk(path, entry, fmt.Errorf("can't upload a %s; use -skip-special to leave it out", kind))
+				}
+
+				s.report(path, kind)
+				return nil
+			}
+
+			return walk(path, entry, nil)
+		})
+	}
+}
+
+// report logs that the file at the given path was skipped, unless it was reported before.
+func (s *fileSkipper) report(path, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.reported[path] {
+		return
+	}
+
+	s.reported[path] = true
+	log.Printf("Skipping %s: %s\n", path, reason)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+)
+
+func Test_isHidden(t *testing.T) {
+	testCases := []struct {
+		desc string
+		path string
+		want bool
+	}{
+		{desc: "regular file", path: "index.html", want: false},
+		{desc: "dotfile", path: ".env", want: true},
+		{desc: "nested dotfile", path: "config/.htaccess", want: true},
+		{desc: "dot-directory", path: ".git/config", want: true},
+		{desc: "dot in name", path: "app.min.js", want: false},
+		{desc: "working directory", path: ".", want: false},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := isHidden(tC.path); got != tC.want {
+				t.Errorf("Expected %v; got %v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_fileSkipper_Walker(t *testing.T) {
+	entries := []mockFileInfo{
+		{name: "."},
+		{name: ".git", mode: fs.ModeDir},
+		{name: ".git/config"},
+		{name: ".env"},
+		{name: "app.sock", mode: fs.ModeSocket},
+		{name: "index.html"},
+	}
+
+	// walkFiles walks the entries, skipping the files beneath skipped directories like
+	// `filepath.WalkDir` would.
+	walkFiles := func(walk fs.WalkDirFunc) error {
+		skipped := ""
+		for _, entry := range entries {
+			if skipped != "" && len(entry.name) > len(skipped) && entry.name[:len(skipped)+1] == skipped+"/" {
+				continue
+			}
+
+			err := walk(entry.name, entry, nil)
+			if errors.Is(err, fs.SkipDir) && entry.IsDir() {
+				skipped = entry.name
+			} else if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	testCases := []struct {
+		desc    string
+		hidden  bool
+		special bool
+		want    []string
+		wantErr bool
+	}{
+		{
+			desc:    "special files fail",
+			wantErr: true,
+		},
+		{
+			desc:    "skip special files",
+			special: true,
+			want:    []string{".", ".git", ".git/config", ".env", "index.html"},
+		},
+		{
+			desc:    "skip hidden and special files",
+			hidden:  true,
+			special: true,
+			want:    []string{".", "index.html"},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var got []string
+			err := newFileSkipper(tC.hidden, tC.special).Walker(walkFiles)(func(path string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+
+				got = append(got, path)
+
+				return nil
+			})
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if !tC.wantErr && !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("Expected %v; got %v", tC.want, got)
+			}
+		})
+	}
+}
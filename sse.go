@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// sseCustomerKeySize is the size, in bytes, of the AES-256 keys used for SSE-C.
+const sseCustomerKeySize = 32
+
+// serverSideEncryption describes how S3 should encrypt uploaded objects at rest. The zero value
+// leaves the choice to the bucket's default encryption.
+type serverSideEncryption struct {
+	// mode is the encryption S3 manages itself, either with S3-owned keys or with a KMS key.
+	mode types.ServerSideEncryption
+	// kmsKeyID is the KMS key to encrypt with, if not the AWS managed key for S3.
+	kmsKeyID string
+	// customerKey is a key provided with every request when using SSE-C.
+	customerKey []byte
+}
+
+// newServerSideEncryption validates the encryption flags. `mode` is one of `AES256`, `aws:kms`, or
+// `aws:kms:dsse`, and `customerKeyFile` is the path to an SSE-C key, which may not be combined
+// with a mode.
+func newServerSideEncryption(mode, kmsKeyID, customerKeyFile string) (serverSideEncryption, error) {
+	var sse serverSideEncryption
+
+	switch types.ServerSideEncryption(mode) {
+	case "":
+	case types.ServerSideEncryptionAes256, types.ServerSideEncryptionAwsKms, types.ServerSideEncryptionAwsKmsDsse:
+		sse.mode = types.ServerSideEncryption(mode)
+	default:
+		return serverSideEncryption{}, fmt.Errorf("unknown server-side encryption %q; expected one of: AES256, aws:kms, aws:kms:dsse", mode)
+	}
+
+	if kmsKeyID != "" {
+		if sse.mode != types.ServerSideEncryptionAwsKms && sse.mode != types.ServerSideEncryptionAwsKmsDsse {
+			return serverSideEncryption{}, fmt.Errorf("a KMS key ID can only be used with 'aws:kms' or 'aws:kms:dsse' encryption")
+		}
+
+		sse.kmsKeyID = kmsKeyID
+	}
+
+	if customerKeyFile != "" {
+		if sse.mode != "" {
+			return serverSideEncryption{}, fmt.Errorf("a customer-provided key can't be combined with %q encryption", sse.mode)
+		}
+
+		contents, err := os.ReadFile(customerKeyFile)
+		if err != nil {
+			return serverSideEncryption{}, fmt.Errorf("could not read customer-provided key: %v", err)
+		}
+
+		key, err := parseCustomerKey(contents)
+		if err != nil {
+			return serverSideEncryption{}, err
+		}
+
+		sse.customerKey = key
+	}
+
+	return sse, nil
+}
+
+// parseCustomerKey accepts an SSE-C key either as raw bytes or base64 encoded.
+func parseCustomerKey(contents []byte) ([]byte, error) {
+	if len(contents) == sseCustomerKeySize {
+		return contents, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(contents)))
+	if err != nil || len(key) != sseCustomerKeySize {
+		return nil, fmt.Errorf("invalid customer-provided key: expected %d raw or base64 encoded bytes", sseCustomerKeySize)
+	}
+
+	return key, nil
+}
+
+// apply sets the encryption fields of an upload request.
+func (e serverSideEncryption) apply(input *s3.PutObjectInput) {
+	if e.mode != "" {
+		input.ServerSideEncryption = e.mode
+	}
+
+	if e.kmsKeyID != "" {
+		input.SSEKMSKeyId = aws.String(e.kmsKeyID)
+	}
+
+	if e.customerKey != nil {
+		sum := md5.Sum(e.customerKey)
+		input.SSECustomerAlgorithm = aws.String(string(types.ServerSideEncryptionAes256))
+		input.SSECustomerKey = aws.String(base64.StdEncoding.EncodeToString(e.customerKey))
+		input.SSECustomerKeyMD5 = aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+	}
+}
+
+// applyHead sets the headers needed to read an object encrypted with a customer-provided key.
+func (e serverSideEncryption) applyHead(input *s3.HeadObjectInput) {
+	if e.customerKey != nil {
+		sum := md5.Sum(e.customerKey)
+		input.SSECustomerAlgorithm = aws.String(string(types.ServerSideEncryptionAes256))
+		input.SSECustomerKey = aws.String(base64.StdEncoding.EncodeToString(e.customerKey))
+		input.SSECustomerKeyMD5 = aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+	}
+}
+
+// hasMD5ETag reports whether objects encrypted this way have the MD5 digest of their contents as
+// their ETag, which isn't the case for KMS or customer-provided keys.
+func (e serverSideEncryption) hasMD5ETag() bool {
+	return e.customerKey == nil && e.mode != types.ServerSideEncryptionAwsKms && e.mode != types.ServerSideEncryptionAwsKmsDsse
+}
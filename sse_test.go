@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func Test_newServerSideEncryption(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, sseCustomerKeySize)
+	dir := t.TempDir()
+	rawKeyFile := filepath.Join(dir, "raw.key")
+	encodedKeyFile := filepath.Join(dir, "encoded.key")
+	shortKeyFile := filepath.Join(dir, "short.key")
+	os.WriteFile(rawKeyFile, key, 0o600)
+	os.WriteFile(encodedKeyFile, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0o600)
+	os.WriteFile(shortKeyFile, []byte("too short"), 0o600)
+
+	testCases := []struct {
+		desc     string
+		mode     string
+		kmsKeyID string
+		keyFile  string
+		wantMode types.ServerSideEncryption
+		wantKey  []byte
+		wantErr  bool
+	}{
+		{desc: "none"},
+		{desc: "S3 managed keys", mode: "AES256", wantMode: types.ServerSideEncryptionAes256},
+		{desc: "KMS with key ID", mode: "aws:kms", kmsKeyID: "alias/site", wantMode: types.ServerSideEncryptionAwsKms},
+		{desc: "unknown mode", mode: "aws:fsx", wantErr: true},
+		{desc: "KMS key ID without KMS", mode: "AES256", kmsKeyID: "alias/site", wantErr: true},
+		{desc: "raw customer key", keyFile: rawKeyFile, wantKey: key},
+		{desc: "base64 customer key", keyFile: encodedKeyFile, wantKey: key},
+		{desc: "invalid customer key", keyFile: shortKeyFile, wantErr: true},
+		{desc: "missing customer key", keyFile: filepath.Join(dir, "missing.key"), wantErr: true},
+		{desc: "customer key with mode", mode: "AES256", keyFile: rawKeyFile, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := newServerSideEncryption(tC.mode, tC.kmsKeyID, tC.keyFile)
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if got.mode != tC.wantMode {
+				t.Errorf("Expected mode %q; got %q", tC.wantMode, got.mode)
+			}
+
+			if !bytes.Equal(got.customerKey, tC.wantKey) {
+				t.Errorf("Expected customer key %x; got %x", tC.wantKey, got.customerKey)
+			}
+		})
+	}
+}
+
+func Test_serverSideEncryption_apply(t *testing.T) {
+	input := &s3.PutObjectInput{}
+	serverSideEncryption{mode: types.ServerSideEncryptionAwsKms, kmsKeyID: "alias/site"}.apply(input)
+
+	if input.ServerSideEncryption != types.ServerSideEncryptionAwsKms {
+		t.Errorf("Expected encryption %q; got %q", types.ServerSideEncryptionAwsKms, input.ServerSideEncryption)
+	}
+
+	if aws.ToString(input.SSEKMSKeyId) != "alias/site" {
+		t.Errorf("Expected KMS key ID %q; got %q", "alias/site", aws.ToString(input.SSEKMSKeyId))
+	}
+
+	input = &s3.PutObjectInput{}
+	serverSideEncryption{customerKey: bytes.Repeat([]byte{0x42}, sseCustomerKeySize)}.apply(input)
+
+	wantKey := "QkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkI="
+	if aws.ToString(input.SSECustomerKey) != wantKey {
+		t.Errorf("Expected customer key %q; got %q", wantKey, aws.ToString(input.SSECustomerKey))
+	}
+
+	if aws.ToString(input.SSECustomerAlgorithm) != "AES256" {
+		t.Errorf("Expected customer algorithm %q; got %q", "AES256", aws.ToString(input.SSECustomerAlgorithm))
+	}
+
+	if input.SSECustomerKeyMD5 == nil {
+		t.Error("Expected the customer key MD5 to be set")
+	}
+}
+
+func Test_serverSideEncryption_hasMD5ETag(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		encryption serverSideEncryption
+		want       bool
+	}{
+		{desc: "no encryption", want: true},
+		{desc: "S3-managed keys", encryption: serverSideEncryption{mode: types.ServerSideEncryptionAes256}, want: true},
+		{desc: "KMS", encryption: serverSideEncryption{mode: types.ServerSideEncryptionAwsKms}},
+		{desc: "KMS dual-layer", encryption: serverSideEncryption{mode: types.ServerSideEncryptionAwsKmsDsse}},
+		{desc: "customer key", encryption: serverSideEncryption{customerKey: make([]byte, sseCustomerKeySize)}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := tC.encryption.hasMD5ETag(); got != tC.want {
+				t.Errorf("Expected %v; got %v", tC.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+)
+
+// stateDir is the directory, beneath the prefix, where s3-copy keeps the objects it uses to
+// remember things between runs.
+const stateDir = ".s3-copy/"
+
+// pendingDeletesPath is the state object recording when objects were first found to be stale.
+const pendingDeletesPath = stateDir + "pending-deletes.json"
+
+// isStateKey reports whether the given key, relative to the prefix, is a state object.
+func isStateKey(key string) bool {
+	return strings.HasPrefix(key, stateDir)
+}
+
+// stateStore reads and writes state objects.
+type stateStore interface {
+	ReadState(ctx context.Context, path string) ([]byte, error)
+	WriteState(ctx context.Context, path string, body []byte) error
+}
+
+// pendingDeletes maps the keys of stale objects to when they were first found to be stale.
+type pendingDeletes map[string]time.Time
+
+// loadPendingDeletes reads the pending deletes recorded by previous runs. If there are none, an
+// empty record is returned.
+func loadPendingDeletes(ctx context.Context, store stateStore) (pendingDeletes, error) {
+	body, err := store.ReadState(ctx, pendingDeletesPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return pendingDeletes{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var record struct {
+		Since pendingDeletes `json:"since"`
+	}
+	if err := json.Unmarshal(body, &record); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", pendingDeletesPath, err)
+	}
+
+	if record.Since == nil {
+		record.Since = pendingDeletes{}
+	}
+
+	return record.Since, nil
+}
+
+// Save records the pending deletes for the next run.
+func (p pendingDeletes) Save(ctx context.Context, store stateStore) error {
+	body, err := json.MarshalIndent(struct {
+		Since pendingDeletes `json:"since"`
+	}{p}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return store.WriteState(ctx, pendingDeletesPath, body)
+}
+
+// Schedule splits the currently stale keys into those that have been stale for at least the grace
+// period, which are due for deletion, and the record of those that must wait until a later run.
+// Keys that are no longer stale, because the file came back, are forgotten.
+func (p pendingDeletes) Schedule(stale []string, now time.Time, grace time.Duration) ([]string, pendingDeletes) {
+	var due []string
+	waiting := pendingDeletes{}
+	for _, key := range stale {
+		since, ok := p[key]
+		if !ok {
+			since = now
+		}
+
+		if now.Sub(since) >= grace {
+			due = append(due, key)
+		} else {
+			waiting[key] = since
+		}
+	}
+
+	sort.Strings(due)
+
+	return due, waiting
+}
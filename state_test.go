@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// mockStateStore keeps state objects in memory.
+type mockStateStore struct {
+	objects map[string][]byte
+	readErr error
+}
+
+func (s *mockStateStore) ReadState(ctx context.Context, path string) ([]byte, error) {
+	if s.readErr != nil {
+		return nil, s.readErr
+	}
+
+	body, ok := s.objects[path]
+	if !ok {
+		return nil, fmt.Errorf("failed to read %s: %w", path, fs.ErrNotExist)
+	}
+
+	return body, nil
+}
+
+func (s *mockStateStore) WriteState(ctx context.Context, path string, body []byte) error {
+	if s.objects == nil {
+		s.objects = map[string][]byte{}
+	}
+
+	s.objects[path] = body
+
+	return nil
+}
+
+func Test_pendingDeletes_Schedule(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	previous := pendingDeletes{
+		"old.js":      now.Add(-25 * time.Hour),
+		"recent.js":   now.Add(-time.Hour),
+		"restored.js": now.Add(-48 * time.Hour),
+	}
+
+	due, waiting := previous.Schedule([]string{"recent.js", "old.js", "new.js"}, now, 24*time.Hour)
+
+	if want := []string{"old.js"}; !reflect.DeepEqual(due, want) {
+		t.Errorf("Expected due keys %q; got %q", want, due)
+	}
+
+	want := pendingDeletes{
+		"recent.js": now.Add(-time.Hour),
+		"new.js":    now,
+	}
+	if !reflect.DeepEqual(waiting, want) {
+		t.Errorf("Expected waiting keys %v; got %v", want, waiting)
+	}
+}
+
+func Test_loadPendingDeletes(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		store   *mockStateStore
+		want    pendingDeletes
+		wantErr bool
+	}{
+		{desc: "no record", store: &mockStateStore{}, want: pendingDeletes{}},
+		{
+			desc:  "record",
+			store: &mockStateStore{objects: map[string][]byte{pendingDeletesPath: []byte(`{"since": {"old.js": "2024-05-01T12:00:00Z"}}`)}},
+			want:  pendingDeletes{"old.js": time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)},
+		},
+		{
+			desc:  "empty record",
+			store: &mockStateStore{objects: map[string][]byte{pendingDeletesPath: []byte(`{}`)}},
+			want:  pendingDeletes{},
+		},
+		{
+			desc:    "invalid record",
+			store:   &mockStateStore{objects: map[string][]byte{pendingDeletesPath: []byte(`[`)}},
+			wantErr: true,
+		},
+		{desc: "read error", store: &mockStateStore{readErr: fmt.Errorf("access denied")}, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := loadPendingDeletes(context.Background(), tC.store)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("Expected %v; got %v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_pendingDeletes_Save(t *testing.T) {
+	store := &mockStateStore{}
+	pending := pendingDeletes{"old.js": time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+
+	if err := pending.Save(context.Background(), store); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := loadPendingDeletes(context.Background(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, pending) {
+		t.Errorf("Expected %v after a round trip; got %v", pending, got)
+	}
+}
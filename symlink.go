@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// symlinkPolicy determines what happens to the symbolic links found while walking the tree.
+type symlinkPolicy int
+
+const (
+	// symlinkFiles uploads links to files as the files they point to, and fails on links to
+	// directories, which are only uploaded when following them.
+	symlinkFiles symlinkPolicy = iota
+	// symlinkFollow uploads links to files as the files they point to, and walks links to
+	// directories as if they were the directories they point to.
+	symlinkFollow
+	// symlinkSkip leaves out every link.
+	symlinkSkip
+	// symlinkError fails on every link.
+	symlinkError
+)
+
+// newSymlinkPolicy returns the policy chosen by the symlink flags, of which at most one may be
+// set.
+func newSymlinkPolicy(follow, skip, fail bool) (symlinkPolicy, error) {
+	policy := symlinkFiles
+	chosen := 0
+	for _, flag := range []struct {
+		set    bool
+		policy symlinkPolicy
+	}{{follow, symlinkFollow}, {skip, symlinkSkip}, {fail, symlinkError}} {
+		if flag.set {
+			policy = flag.policy
+			chosen++
+		}
+	}
+
+	if chosen > 1 {
+		return symlinkFiles, errors.New("conflicting symlink flags: use only one of '-follow-symlinks', '-skip-symlinks', and '-error-on-symlinks'")
+	}
+
+	return policy, nil
+}
+
+// isSymlink reports whether a directory entry is a symbolic link.
+func isSymlink(entry fs.DirEntry) bool {
+	return entry.Type()&fs.ModeSymlink != 0
+}
+
+// resolve returns the entry to walk in place of the symbolic link at the given path: the file or
+// directory it points to, described under the name of the link. It returns nil if the link is
+// skipped, and an error if the policy doesn't allow the link or it is broken. Links to a directory
+// containing them are skipped even when following links, since walking them would never end.
+func (p symlinkPolicy) resolve(path string) (fs.DirEntry, error) {
+	switch p {
+	case symlinkSkip:
+		log.Printf("Skipping symbolic link %s\n", path)
+		return nil, nil
+	case symlinkError:
+		return nil, errors.New("symbolic links aren't allowed with -error-on-symlinks")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("broken symbolic link: %v", err)
+	}
+
+	if !info.IsDir() {
+		return fs.FileInfoToDirEntry(info), nil
+	}
+
+	if p != symlinkFollow {
+		return nil, errors.New("symbolic link to a directory; use -follow-symlinks to upload its files or -skip-symlinks to leave it out")
+	}
+
+	if ancestor, ok := symlinkCycle(path, info); ok {
+		log.Printf("Skipping symbolic link %s: it points to %s, which contains it\n", path, ancestor)
+		return nil, nil
+	}
+
+	return fs.FileInfoToDirEntry(info), nil
+}
+
+// symlinkCycle returns the directory containing the link at the given path that the link points
+// to, if any. Directories are compared by the file they resolve to, so that cycles through several
+// links are found too.
+func symlinkCycle(path string, target fs.FileInfo) (string, bool) {
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if info, err := os.Stat(dir); err == nil && os.SameFile(info, target) {
+			return dir, true
+		}
+
+		if filepath.Dir(dir) == dir {
+			return "", false
+		}
+	}
+}
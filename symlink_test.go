@@ -0,0 +1,163 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_newSymlinkPolicy(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		follow  bool
+		skip    bool
+		fail    bool
+		want    symlinkPolicy
+		wantErr bool
+	}{
+		{desc: "default", want: symlinkFiles},
+		{desc: "follow", follow: true, want: symlinkFollow},
+		{desc: "skip", skip: true, want: symlinkSkip},
+		{desc: "error", fail: true, want: symlinkError},
+		{desc: "conflicting", follow: true, skip: true, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := newSymlinkPolicy(tC.follow, tC.skip, tC.fail)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if got != tC.want {
+				t.Errorf("Expected policy %d; got %d", tC.want, got)
+			}
+		})
+	}
+}
+
+// makeSymlinkTree creates a tree with a link to a file, a link to a directory, and a link back to
+// the directory containing it in the working directory.
+func makeSymlinkTree(t *testing.T) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+
+	for _, name := range []string{"index.html", "shared/logo.png"} {
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(name, []byte("contents"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	links := map[string]string{
+		"home.html":    "index.html",
+		"assets":       "shared",
+		"shared/again": "..",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test_parallelWalker_symlinks(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		symlinks symlinkPolicy
+		want     []string
+		wantErr  bool
+	}{
+		{
+			desc:     "links to files",
+			symlinks: symlinkFiles,
+			wantErr:  true,
+		},
+		{
+			desc:     "follow",
+			symlinks: symlinkFollow,
+			want:     []string{"assets/logo.png", "home.html", "index.html", "shared/logo.png"},
+		},
+		{
+			desc:     "skip",
+			symlinks: symlinkSkip,
+			want:     []string{"index.html", "shared/logo.png"},
+		},
+		{
+			desc:     "error",
+			symlinks: symlinkError,
+			wantErr:  true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			makeSymlinkTree(t)
+
+			var got []string
+			err := parallelWalker("./", 4, tC.symlinks)(func(path string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+
+				if entry.IsDir() {
+					return nil
+				}
+
+				if info, err := entry.Info(); err != nil || !info.Mode().IsRegular() {
+					t.Errorf("Expected %s to be described by the file it points to; got %v", path, info)
+				}
+
+				got = append(got, path)
+
+				return nil
+			})
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if !tC.wantErr && !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("Expected %v; got %v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_fileListWalker_symlinks(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		symlinks symlinkPolicy
+		want     []string
+		wantErr  bool
+	}{
+		{desc: "links to files", symlinks: symlinkFiles, want: []string{"home.html", "index.html"}},
+		{desc: "skip", symlinks: symlinkSkip, want: []string{"index.html"}},
+		{desc: "error", symlinks: symlinkError, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			makeSymlinkTree(t)
+
+			var got []string
+			err := fileListWalker([]string{"assets", "home.html", "index.html"}, tC.symlinks)(func(path string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+
+				got = append(got, path)
+
+				return nil
+			})
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Expected error: %v; got %v", tC.wantErr, err)
+			}
+
+			if !tC.wantErr && !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("Expected %v; got %v", tC.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strings"
+
+	syncplan "github.com/Zeroed-Books/s3-copy/pkg/sync"
+)
+
+// remoteObject describes an object that already exists in the remote location.
+type remoteObject = syncplan.RemoteObject
+
+// createSyncFunc wraps an upload callback so that files matching an existing remote object, as
+// decided by the comparison, are passed to `skip` instead.
+func createSyncFunc(remote map[string]remoteObject, compare fileComparison, upload, skip fs.WalkDirFunc) fs.WalkDirFunc {
+	return func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return upload(path, entry, err)
+		}
+
+		if existing, ok := remote[path]; ok {
+			unchanged, err := compare(path, entry, existing)
+			if err != nil {
+				return err
+			}
+
+			if unchanged {
+				return skip(path, entry, nil)
+			}
+		}
+
+		return upload(path, entry, nil)
+	}
+}
+
+// isUnchanged reports whether the local file at `path` has the same contents as an existing
+// remote object. Files are compared by size first, and then by the ETag S3 would compute for
+// them. Files matched by the compressor are compared in their compressed form, as that is what
+// would be uploaded. If a hash cache is given, the ETags of other files are looked up in it
+// instead of hashing files that didn't change since the last run.
+func isUnchanged(fsys fs.FS, path string, entry fs.DirEntry, existing remoteObject, comp *compressor, hashes *hashCache) (bool, error) {
+	if hashes == nil || comp.Match(path) {
+		return syncplan.Unchanged(fsys, path, entry, existing, comp)
+	}
+
+	info, err := entry.Info()
+	if err != nil {
+		return false, fmt.Errorf("could not stat %s: %v", path, err)
+	}
+
+	if info.Size() != existing.Size {
+		return false, nil
+	}
+
+	// Objects uploaded in multiple parts have an ETag of the form `<digest>-<part count>`.
+	var partSize int64
+	if strings.Contains(existing.ETag, "-") {
+		partSize = syncplan.ETagPartSize(existing)
+	}
+
+	etag, err := hashes.ETag(fsys, path, info, partSize)
+	if err != nil {
+		return false, err
+	}
+
+	return etag == existing.ETag, nil
+}
+
+// logSkipped is a walk callback that logs files skipped because they are unchanged.
+func logSkipped(path string, entry fs.DirEntry, err error) error {
+	log.Printf("Skipped unchanged %s\n", path)
+	return nil
+}
+
+// errObjectSkipped is returned by uploaders that leave an existing object as it is, e.g. because
+// it already matches the file, so that the file is reported as skipped rather than uploaded.
+var errObjectSkipped = errors.New("object skipped")
+
+// createSkippedFunc wraps an upload callback so that files the uploaders skipped are passed to
+// `skip` instead of failing the walk.
+func createSkippedFunc(upload, skip fs.WalkDirFunc) fs.WalkDirFunc {
+	return func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return upload(path, entry, err)
+		}
+
+		if err := upload(path, entry, nil); !errors.Is(err, errObjectSkipped) {
+			return err
+		}
+
+		return skip(path, entry, nil)
+	}
+}
+
+// uploadEach uploads the objects created for a single file, such as a page and its aliases, and
+// only reports the file as skipped if every one of them was.
+func uploadEach(ctx context.Context, client uploader, objects ...*uploadObject) error {
+	skipped := 0
+	for _, object := range objects {
+		err := client.Upload(ctx, object)
+		if errors.Is(err, errObjectSkipped) {
+			skipped++
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if skipped == len(objects) {
+		return errObjectSkipped
+	}
+
+	return nil
+}
+
+// createRecordFunc wraps a walk callback so that the path of every file passed through it is
+// recorded in `seen`. The returned callback must only be used by a single walk.
+func createRecordFunc(seen map[string]bool, walk fs.WalkDirFunc) fs.WalkDirFunc {
+	return func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			seen[path] = true
+		}
+
+		return walk(path, entry, err)
+	}
+}
+
+// staleKeys returns the sorted keys of remote objects that have no corresponding local file.
+// Objects excluded by the filter and the state objects of s3-copy itself are never considered
+// stale, so that they are left untouched.
+func staleKeys(remote map[string]remoteObject, seen map[string]bool, filter pathFilter) []string {
+	var keys []string
+	for key := range remote {
+		if !seen[key] && filter.Match(key) && !isStateKey(key) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	syncplan "github.com/Zeroed-Books/s3-copy/pkg/sync"
+)
+
+func Test_createSyncFunc(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		remote     map[string]remoteObject
+		size       int64
+		wantUpload bool
+	}{
+		{
+			desc:       "new file",
+			remote:     map[string]remoteObject{},
+			size:       9,
+			wantUpload: true,
+		},
+		{
+			desc: "size differs",
+			remote: map[string]remoteObject{
+				"foo.txt": {Key: "foo.txt", Size: 3, ETag: "328c30fae61cd119cd177c061d1ac11f"},
+			},
+			size:       9,
+			wantUpload: true,
+		},
+		{
+			desc: "contents differ",
+			remote: map[string]remoteObject{
+				"foo.txt": {Key: "foo.txt", Size: 9, ETag: "d41d8cd98f00b204e9800998ecf8427e"},
+			},
+			size:       9,
+			wantUpload: true,
+		},
+		{
+			desc: "unchanged",
+			remote: map[string]remoteObject{
+				"foo.txt": {Key: "foo.txt", Size: 9, ETag: "328c30fae61cd119cd177c061d1ac11f"},
+			},
+			size:       9,
+			wantUpload: false,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			fsys := &mockFS{
+				files: map[string]mockFile{
+					"foo.txt": {body: strings.NewReader("some body")},
+				},
+			}
+
+			uploaded := false
+			upload := func(path string, entry fs.DirEntry, err error) error {
+				uploaded = true
+				return nil
+			}
+
+			syncFunc := createSyncFunc(tC.remote, newFileComparison(context.Background(), compareETag, fsys, nil, nil, nil), upload, logSkipped)
+			err := syncFunc("foo.txt", mockFileInfo{name: "foo.txt", size: tC.size}, nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if uploaded != tC.wantUpload {
+				t.Errorf("Expected upload %v; got %v", tC.wantUpload, uploaded)
+			}
+		})
+	}
+}
+
+func Test_staleKeys(t *testing.T) {
+	remote := map[string]remoteObject{
+		"index.html":       {Key: "index.html"},
+		"old.js":           {Key: "old.js"},
+		"app/main.js":      {Key: "app/main.js"},
+		"app/old.css":      {Key: "app/old.css"},
+		"uploads/a.png":    {Key: "uploads/a.png"},
+		pendingDeletesPath: {Key: pendingDeletesPath},
+	}
+
+	seen := map[string]bool{}
+	walk := createRecordFunc(seen, func(path string, entry fs.DirEntry, err error) error {
+		return nil
+	})
+
+	for _, path := range []string{"index.html", "app/main.js", "new.js"} {
+		if err := walk(path, mockFileInfo{name: path}, nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if err := walk("app", mockFileInfo{name: "app", mode: fs.ModeDir}, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	filter, err := newPathFilter(nil, []string{"uploads/**"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got := staleKeys(remote, seen, filter)
+	want := []string{"app/old.css", "old.js"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected stale keys %v; got %v", want, got)
+	}
+}
+
+func Test_staleKeys_excludedDirectory(t *testing.T) {
+	remote := map[string]remoteObject{
+		"index.html":                       {Key: "index.html"},
+		"old.html":                         {Key: "old.html"},
+		"build/app.js":                     {Key: "build/app.js"},
+		"packages/x/node_modules/lib.js":   {Key: "packages/x/node_modules/lib.js"},
+		"packages/x/node_modules/a/b.js":   {Key: "packages/x/node_modules/a/b.js"},
+		"packages/x/src/node_modules.html": {Key: "packages/x/src/node_modules.html"},
+	}
+	fsys := fstest.MapFS{
+		"index.html":                       {Data: []byte("index")},
+		"build/app.js":                     {Data: []byte("app")},
+		"packages/x/node_modules/lib.js":   {Data: []byte("lib")},
+		"packages/x/node_modules/a/b.js":   {Data: []byte("b")},
+		"packages/x/src/node_modules.html": {Data: []byte("page")},
+	}
+
+	filter, err := newPathFilter(nil, []string{"node_modules/**", "build"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	seen := map[string]bool{}
+	walk := createFilterFunc(filter, createRecordFunc(seen, func(path string, entry fs.DirEntry, err error) error {
+		return err
+	}))
+
+	if err := fs.WalkDir(fsys, ".", walk); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The objects of the pruned directories must be kept, as they were never walked.
+	got := staleKeys(remote, seen, filter)
+	want := []string{"old.html"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected stale keys %v; got %v", want, got)
+	}
+}
+
+func Test_createSyncFunc_compressed(t *testing.T) {
+	comp, _ := newCompressor([]string{"*.txt"})
+	compressed, _ := compress(strings.NewReader("some body"))
+	etag, _ := syncplan.LocalETag(compressed, 0)
+	remote := map[string]remoteObject{
+		"foo.txt": {Key: "foo.txt", Size: compressed.Size(), ETag: etag},
+	}
+
+	fsys := &mockFS{
+		files: map[string]mockFile{
+			"foo.txt": {body: strings.NewReader("some body")},
+		},
+	}
+
+	uploaded := false
+	upload := func(path string, entry fs.DirEntry, err error) error {
+		uploaded = true
+		return nil
+	}
+
+	syncFunc := createSyncFunc(remote, newFileComparison(context.Background(), compareETag, fsys, comp, nil, nil), upload, logSkipped)
+	if err := syncFunc("foo.txt", mockFileInfo{name: "foo.txt", size: 9}, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if uploaded {
+		t.Error("Expected the unchanged compressed file to be skipped")
+	}
+}
+
+func Test_uploadEach(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		skipped  map[string]bool
+		wantSkip bool
+	}{
+		{desc: "none skipped"},
+		{desc: "some skipped", skipped: map[string]bool{"about/index.html": true}},
+		{desc: "all skipped", skipped: map[string]bool{"about/index.html": true, "about/": true}, wantSkip: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			client := &skippingUploader{skipped: tC.skipped}
+			err := uploadEach(context.Background(), client, &uploadObject{Path: "about/index.html"}, &uploadObject{Path: "about/"})
+			if skipped := errors.Is(err, errObjectSkipped); skipped != tC.wantSkip {
+				t.Errorf("Expected skipped %v; got error %v", tC.wantSkip, err)
+			}
+
+			if client.attempts != 2 {
+				t.Errorf("Expected every object to be uploaded; got %d attempt(s)", client.attempts)
+			}
+		})
+	}
+}
+
+// skippingUploader skips the given objects and accepts every other one.
+type skippingUploader struct {
+	skipped  map[string]bool
+	attempts int
+}
+
+func (u *skippingUploader) Upload(ctx context.Context, object *uploadObject) error {
+	u.attempts++
+	if u.skipped[object.Path] {
+		return errObjectSkipped
+	}
+
+	return nil
+}
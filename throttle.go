@@ -0,0 +1,21 @@
+package main
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+
+	uploads "github.com/Zeroed-Books/s3-copy/pkg/uploader"
+)
+
+// concurrencyLimiter adapts the number of uploads in flight to throttling by the storage backend.
+type concurrencyLimiter = uploads.Limiter
+
+func newConcurrencyLimiter(max int) *concurrencyLimiter {
+	return uploads.NewLimiter(max)
+}
+
+// isThrottle reports whether an error is the backend asking for requests to slow down, such as a
+// 503 SlowDown response from S3.
+func isThrottle(err error) bool {
+	return retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err) == aws.TrueTernary
+}
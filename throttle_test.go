@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+)
+
+func Test_isThrottle(t *testing.T) {
+	testCases := []struct {
+		desc string
+		err  error
+		want bool
+	}{
+		{desc: "SlowDown", err: &smithy.GenericAPIError{Code: "SlowDown"}, want: true},
+		{desc: "access denied", err: &smithy.GenericAPIError{Code: "AccessDenied"}},
+		{desc: "other error", err: errors.New("connection reset")},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := isThrottle(tC.err); got != tC.want {
+				t.Errorf("Expected %v; got %v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_retryUploader_throttled(t *testing.T) {
+	limiter := newConcurrencyLimiter(4)
+	client := &flakyUploader{errs: []error{&smithy.GenericAPIError{Code: "SlowDown"}}}
+	retryClient := newRetryUploader(client, 3)
+	retryClient.baseDelay = time.Millisecond
+	retryClient.limiter = limiter
+
+	err := retryClient.Upload(context.Background(), &uploadObject{Path: "foo.txt", Body: strings.NewReader("body")})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got := limiter.Limit(); got != 2 {
+		t.Errorf("Expected the throttled upload to halve the limit to 2; got %d", got)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// errRunTimedOut is the cause of the cancellation of a run that exceeded its -timeout.
+var errRunTimedOut = errors.New("the run timed out")
+
+// newTimeoutContext returns a context that is cancelled once the run took longer than `timeout`,
+// the same way it would be on an interrupt. A timeout of zero never cancels it.
+func newTimeoutContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeoutCause(ctx, timeout, errRunTimedOut)
+}
+
+// interruption describes why the context of a run was cancelled, to start the message the run
+// fails with.
+func interruption(ctx context.Context) string {
+	if errors.Is(context.Cause(ctx), errRunTimedOut) {
+		return "Timed out"
+	}
+
+	return "Interrupted"
+}
+
+// timeoutUploader fails uploads that take longer than a timeout, including their retries, so that
+// a hung connection can't stall the run.
+type timeoutUploader struct {
+	timeout time.Duration
+	next    uploader
+}
+
+func (u *timeoutUploader) Upload(ctx context.Context, object *uploadObject) error {
+	fileCtx, cancel := context.WithTimeout(ctx, u.timeout)
+	defer cancel()
+
+	err := u.next.Upload(fileCtx, object)
+	if err != nil && ctx.Err() == nil && errors.Is(fileCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %v: %w", u.timeout, err)
+	}
+
+	return err
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// hangingUploader never completes an upload before its context is cancelled.
+type hangingUploader struct{}
+
+func (u *hangingUploader) Upload(ctx context.Context, object *uploadObject) error {
+	<-ctx.Done()
+
+	return ctx.Err()
+}
+
+func Test_timeoutUploader(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		next    uploader
+		wantErr string
+	}{
+		{desc: "completed", next: &mockUploader{}},
+		{desc: "failed", next: &mockUploader{uploadErr: errors.New("denied")}, wantErr: "denied"},
+		{desc: "hung", next: &hangingUploader{}, wantErr: "timed out after 10ms: context deadline exceeded"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			u := &timeoutUploader{timeout: 10 * time.Millisecond, next: tC.next}
+
+			err := u.Upload(context.Background(), &uploadObject{Path: "foo.txt", Body: strings.NewReader("some body")})
+			if gotErr := err != nil; gotErr != (tC.wantErr != "") || (gotErr && err.Error() != tC.wantErr) {
+				t.Errorf("Expected error %q; got %v", tC.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_timeoutUploader_interrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	u := &timeoutUploader{timeout: time.Hour, next: &hangingUploader{}}
+	if err := u.Upload(ctx, &uploadObject{Path: "foo.txt", Body: strings.NewReader("some body")}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the interruption to be returned as is; got %v", err)
+	}
+}
+
+func Test_interruption(t *testing.T) {
+	interrupted, cancel := newTimeoutContext(context.Background(), 0)
+	cancel()
+
+	timedOut, cancel := newTimeoutContext(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-timedOut.Done()
+
+	testCases := []struct {
+		desc string
+		ctx  context.Context
+		want string
+	}{
+		{desc: "interrupted", ctx: interrupted, want: "Interrupted"},
+		{desc: "timed out", ctx: timedOut, want: "Timed out"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := interruption(tC.ctx); got != tC.want {
+				t.Errorf("Expected %q; got %q", tC.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,1039 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runUpload implements the `upload` and `sync` commands, which upload the files in the working
+// directory. The `sync` command only uploads files that changed.
+func runUpload(cmd command, args []string) {
+	var opts uploadFlags
+
+	flags := newFlagSet(cmd, "[flags] [file or glob...]")
+	opts.register(flags, cmd)
+	patterns := parseInterspersed(flags, args)
+
+	settings, err := opts.common.applyConfig(flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := opts.validate(flags, patterns); err != nil {
+		log.Fatal(err)
+	}
+
+	common, grants := &opts.common, &opts.grants
+
+	roots, err := parseSourceRoots(opts.sourceDirs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	symlinks, err := newSymlinkPolicy(opts.followSymlinks, opts.skipSymlinks, opts.errorOnSymlinks)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	walkFiles := parallelWalker("./", opts.walkConcurrency, symlinks)
+	if len(roots) > 0 {
+		walkFiles = roots.Walker(opts.walkConcurrency, symlinks)
+	}
+
+	if opts.filesFrom != "" {
+		paths, err := readFileList(opts.filesFrom, opts.nulSeparated)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		walkFiles = fileListWalker(paths, symlinks)
+	}
+
+	var changes gitChanges
+	if opts.sinceCommit != "" {
+		changes, err = changedSinceCommit(context.Background(), opts.sinceCommit)
+		if err != nil {
+			log.Fatal("Could not list changed files: ", err)
+		}
+
+		walkFiles = fileListWalker(changes.Changed, symlinks)
+	}
+
+	if len(patterns) > 0 {
+		paths, err := expandGlobs(patterns)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		walkFiles = fileListWalker(paths, symlinks)
+	}
+
+	var fsys fs.FS = os.DirFS("./")
+	var sequential bool
+	if opts.fromArchive != "" {
+		bundle, err := openArchiveFS(opts.fromArchive)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer bundle.Close()
+
+		fsys = bundle
+		walkFiles = bundle.Walker()
+
+		// Reading the files of a compressed tarball out of order means decompressing it again.
+		if bundle.sequential && opts.concurrency > 1 {
+			log.Printf("Uploading the files of %s one at a time, as it can only be read in order\n", opts.fromArchive)
+			opts.concurrency = 1
+		}
+
+		sequential = bundle.sequential
+	}
+
+	walkFiles = newFileSkipper(opts.skipHidden, opts.skipSpecial).Walker(walkFiles)
+
+	rules, err := parseRenameRules(opts.renameRules)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	prefixes := prefixTemplate{
+		version: opts.appVersion,
+		now:     time.Now(),
+		// Keys may use the commit too, which is only looked up once.
+		gitSHA: sync.OnceValues(func() (string, error) { return gitHead(context.Background()) }),
+	}
+
+	transforms := keyTransforms{sources: roots, keyTemplate: strings.TrimPrefix(opts.keyTemplate, "/"), template: prefixes, normalize: opts.normalizeKeys, stripPrefix: normalizePrefix(opts.stripPrefix), lowercase: opts.lowercaseKeys, rules: rules}
+
+	if opts.archive != "" {
+		opts.archiveKey, err = prefixes.expandKey(strings.TrimPrefix(opts.archiveKey, "/"), nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var destinations []commonFlags
+	for _, name := range opts.alsoEnv {
+		destination, err := settings.destinationFlags(name, common)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		destinations = append(destinations, destination)
+	}
+
+	common.prefix, err = prefixes.Expand(common.prefix)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for i := range destinations {
+		destinations[i].prefix, err = prefixes.Expand(destinations[i].prefix)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	fileACL, err := parseACL(common.preset.objectACL(opts.acl, flagGiven(flags, "acl")))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Grants replace the default ACL, as S3 doesn't accept both.
+	if !grants.Empty() {
+		fileACL = ""
+	}
+
+	redirects, err := loadRedirects(opts.redirectsPath, flagGiven(flags, "redirects"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, r := range settings.Redirects {
+		if err := r.validate(); err != nil {
+			log.Fatal("Invalid config file: ", err)
+		}
+	}
+
+	redirects = append(redirects, settings.Redirects...)
+
+	// The config, redirects, manifest, plan, checkpoint, and hash cache files may live in the tree
+	// being uploaded, but shouldn't be uploaded with it.
+	ownFiles := []string{settings.path, opts.redirectsPath, opts.manifestPath, opts.planPath, opts.renameManifest, opts.hashCachePath}
+	if opts.resume {
+		ownFiles = append(ownFiles, opts.checkpointPath)
+	}
+
+	for _, path := range ownFiles {
+		if path != "" && path != "-" && filepath.IsLocal(path) {
+			opts.exclude = append(opts.exclude, filepath.ToSlash(filepath.Clean(path)))
+		}
+	}
+
+	filter, err := newPathFilter(opts.include, opts.exclude)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	filter.hidden = opts.skipHidden
+
+	metadata, err := parseKeyValues(opts.metadataPairs)
+	if err != nil {
+		log.Fatal("Invalid metadata: ", err)
+	}
+
+	if opts.appVersion != "" {
+		metadata["x-amz-meta-app-version"] = opts.appVersion
+	}
+
+	if err := validateMetadata(metadata); err != nil {
+		log.Fatal(err)
+	}
+
+	tags, err := parseKeyValues(opts.tagPairs)
+	if err != nil {
+		log.Fatal("Invalid tag: ", err)
+	}
+
+	if _, err := encodeTags(tags); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := common.preset.checkTags(tags, common.provider); err != nil {
+		log.Fatal(err)
+	}
+
+	encryption, err := newServerSideEncryption(opts.sseMode, opts.sseKMSKeyID, opts.sseCustomerKeyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	passphraseEncryption, err := newClientEncryption(opts.encryptionPassphraseFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	retention, err := newObjectLock(opts.objectLockMode, opts.objectLockRetain, opts.legalHold, time.Now())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	checksum, err := parseChecksum(opts.checksumName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	multipart, err := newMultipartSettings(opts.partSize, opts.partConcurrency, opts.multipartThreshold)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if opts.maxMemory > 0 {
+		fitted, fittedMultipart, err := fitMemoryBudget(opts.maxMemory, opts.concurrency, multipart)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if fitted != opts.concurrency || fittedMultipart.Concurrency != multipart.Concurrency {
+			log.Printf("Uploading %d file(s) with %d part(s) each in parallel to stay within %d MiB\n", fitted, fittedMultipart.Concurrency, opts.maxMemory)
+		}
+
+		opts.concurrency, multipart = fitted, fittedMultipart
+	}
+
+	comp, err := newCompressor(opts.gzipPatterns)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	variants, err := newBrotliVariants(opts.brotliPatterns)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	order, err := newUploadOrder(opts.uploadLast)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	aliases := newWebsiteAliases(opts.website, opts.stripHTML)
+
+	if err := registerMimeTypes(settings.MimeTypes); err != nil {
+		log.Fatal(err)
+	}
+
+	if opts.mimeMap != "" {
+		types, err := loadMimeMap(opts.mimeMap)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := registerMimeTypes(types); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var headerRules []headerRule
+	for _, rule := range opts.cacheControl {
+		parsed, err := parseHeaderRule("Cache-Control", rule)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		headerRules = append(headerRules, parsed)
+	}
+
+	for _, rule := range opts.aclRules {
+		parsed, err := parseHeaderRule("X-Amz-Acl", rule)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ruleACL, err := parseACL(parsed.value)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		parsed.value = string(ruleACL)
+		headerRules = append(headerRules, parsed)
+	}
+
+	for _, rule := range opts.tagRules {
+		parsed, err := parseTagRule(rule)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		headerRules = append(headerRules, parsed)
+	}
+
+	purgers, err := settings.CDN.purgers(http.DefaultClient)
+	if err != nil {
+		log.Fatal("Invalid config file: ", err)
+	}
+
+	configRules, err := settings.headerRules()
+	if err != nil {
+		log.Fatal("Invalid config file: ", err)
+	}
+
+	headerRules = append(headerRules, configRules...)
+
+	ruleTags := map[string]string{}
+	for _, rule := range headerRules {
+		if key, ok := strings.CutPrefix(rule.header, tagHeaderPrefix); ok {
+			ruleTags[key] = rule.value
+		}
+	}
+
+	if err := common.preset.checkTags(ruleTags, common.provider); err != nil {
+		log.Fatal(err)
+	}
+
+	if opts.autoCache {
+		// The automatic rules come last, so that explicit rules take precedence.
+		rules, err := autoCacheRules(opts.fingerprintPattern)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		headerRules = append(headerRules, rules...)
+	}
+
+	grantRules, err := grants.headerRules()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	headerRules = append(headerRules, grantRules...)
+
+	renames, err := newHashRenames(fsys, walkFiles, filter, opts.hashNames)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if !transforms.empty() {
+		renames, err = newKeyRenames(walkFiles, filter, renames, transforms)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	ctx, stop := newSignalContext()
+	defer stop()
+
+	ctx, cancel := newTimeoutContext(ctx, opts.runTimeout)
+	defer cancel()
+
+	options := backendOptions{
+		ACL:             fileACL,
+		Metadata:        metadata,
+		Tags:            tags,
+		Encryption:      encryption,
+		ObjectLock:      retention,
+		Checksum:        checksum,
+		Multipart:       multipart,
+		ListConcurrency: opts.listConcurrency,
+	}
+
+	scheme, bucket, keyPrefix := parseBucketURL(common.bucket, common.prefix)
+	if opts.dedupPrefix != "" {
+		// Blobs beneath the uploaded prefix would be deleted as stale.
+		opts.dedupPrefix = normalizePrefix(opts.dedupPrefix)
+		if opts.dedupPrefix == "" || (opts.deleteStale && strings.HasPrefix(opts.dedupPrefix, keyPrefix)) {
+			log.Fatal("The '-dedup-prefix' flag must give a prefix outside of the one uploaded to with '-delete', e.g. '.blobs/'.")
+		}
+	}
+
+	if opts.deployVersion != "" {
+		keyPrefix += deployPrefix(opts.deployVersion)
+	}
+
+	// The checkpoint is read before connecting, since it also records the multipart uploads of
+	// large files, which are resumed by the backend.
+	var resumeState *checkpoint
+	if opts.resume {
+		resumeState, err = readCheckpoint(opts.checkpointPath, scheme+"://"+bucket+"/"+keyPrefix)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if !opts.dryRunMode {
+			options.Journal = resumeState
+		}
+	}
+
+	if opts.createBucket && !opts.dryRunMode {
+		options.CreateBucket = &bucketSettings{versioning: opts.bucketVersioning, public: opts.publicBucket, acls: usesACLs(headerRules), objectLock: retention.enabled()}
+	}
+
+	baseStore, err := newBackend(ctx, common, options)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	limiter := newConcurrencyLimiter(opts.concurrency)
+
+	// Blobs are stored beneath their own prefix of the bucket, shared between uploads, so neither
+	// resuming nor creating the bucket applies to them.
+	var blobStore backend
+	if opts.dedupPrefix != "" {
+		blobCommon := *common
+		blobCommon.bucket, blobCommon.prefix = bucket, opts.dedupPrefix
+
+		blobOptions := options
+		blobOptions.Journal, blobOptions.CreateBucket = nil, nil
+
+		blobStore, err = newBackend(ctx, &blobCommon, blobOptions)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var fanout *fanoutBackend
+	if len(destinations) > 0 {
+		names := []string{baseStore.URL()}
+		stores := []backend{baseStore}
+		for i := range destinations {
+			replica, err := newBackend(ctx, &destinations[i], options)
+			if err != nil {
+				log.Fatalf("%s: %v", opts.alsoEnv[i], err)
+			}
+
+			names = append(names, replica.URL())
+			stores = append(stores, replica)
+		}
+
+		fanout, err = newFanoutBackend(names, stores, opts.fanoutPolicy, opts.maxRetries, limiter)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		baseStore = fanout
+	}
+
+	if !opts.dryRunMode && !opts.skipPreflight {
+		if err := preflight(ctx, baseStore); err != nil {
+			log.Fatal("Preflight check failed: ", err)
+		}
+	}
+
+	store := baseStore
+	if opts.deployVersion != "" {
+		store = baseStore.Sub(deployPrefix(opts.deployVersion))
+	}
+
+	var lock *deployLock
+	if opts.lockDeploy && !opts.dryRunMode {
+		lock, err = acquireDeployLock(ctx, baseStore, lockOwner(), time.Now(), opts.lockTimeout)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	retryClient := newRetryUploader(store, opts.maxRetries)
+	retryClient.limiter = limiter
+
+	if opts.archive != "" {
+		files, err := archiveFiles(walkFiles, filter, renames)
+		if err != nil {
+			lock.Fatal("Could not find the files to archive: ", err)
+		}
+
+		var archiveUploader uploader = retryClient
+		if passphraseEncryption != nil {
+			archiveUploader = &encryptUploader{encryption: passphraseEncryption, next: archiveUploader}
+		}
+
+		size, err := uploadArchive(ctx, &headerUploader{rules: headerRules, next: archiveUploader}, opts.archiveKey, opts.archive, fsys, files, opts.archiveManifest, time.Now())
+		if ctx.Err() != nil {
+			lock.Fatal(interruption(ctx), ": the archive was not uploaded.")
+		}
+
+		if err != nil {
+			lock.Fatal("Upload failed: ", err)
+		}
+
+		log.Printf("Uploaded %d file(s) as %s (%s)\n", len(files), opts.archiveKey, formatBytes(size))
+
+		if err := lock.Release(context.WithoutCancel(ctx)); err != nil {
+			log.Print("Could not release the deploy lock: ", err)
+		}
+
+		return
+	}
+
+	skipFunc := fs.WalkDirFunc(logSkipped)
+
+	var prog *progress
+	if !opts.dryRunMode {
+		files, bytes, err := scanTotals(walkFiles, filter)
+		if err != nil {
+			lock.Fatal("Could not scan files: ", err)
+		}
+
+		prog = newProgress(files, bytes, opts.quiet)
+		skipFunc = prog.SkipFunc(skipFunc)
+	}
+
+	chain := opts.newUploadChain(retryClient, store, limiter, uploadDecorators{
+		metadata:      metadata,
+		multipart:     multipart,
+		encryption:    encryption,
+		passphrase:    passphraseEncryption,
+		aliases:       aliases,
+		comp:          comp,
+		variants:      variants,
+		headerRules:   headerRules,
+		renames:       renames,
+		started:       prefixes.now,
+		blobs:         blobStore,
+		progress:      prog,
+		recordChanges: len(purgers) > 0,
+	})
+	objectUploader, verifier, uploaded := chain.uploader, chain.verifier, chain.changes
+
+	// Files whose objects were all left as they are, e.g. by -conditional, are reported as skipped.
+	uploadFunc := createSkippedFunc(createUploadFunc(ctx, fsys, objectUploader), skipFunc)
+
+	var preview *dryRun
+	if opts.dryRunMode {
+		preview = newDryRun(os.Stdout)
+		uploadFunc = preview.UploadFunc()
+		skipFunc = preview.SkipFunc()
+	}
+
+	plan := &runPlan{}
+	planFunc := plan.PutFunc(func(string) string { return reasonNotCompared })
+
+	var remote map[string]remoteObject
+	var hashes *hashCache
+	if opts.syncMode {
+		if opts.inventoryPath != "" {
+			remote, err = readRemoteInventory(ctx, common, opts.inventoryPath, bucket, keyPrefix)
+			if err != nil {
+				lock.Fatal("Could not read the inventory: ", err)
+			}
+		} else {
+			remote, err = store.List(ctx)
+			if err != nil {
+				lock.Fatal("Could not list existing objects: ", err)
+			}
+		}
+
+		// Renamed files are compared with the objects under their hashed keys.
+		current := renames.Remote(remote)
+
+		putFunc := plan.PutFunc(func(path string) string {
+			if _, ok := current[path]; ok {
+				return reasonChanged
+			}
+
+			return reasonNew
+		})
+
+		syncSkipFunc := plan.SkipFunc()
+		if variants != nil {
+			syncSkipFunc = variants.SkipFunc(current, plan.PutFunc(func(string) string { return reasonVariant }), syncSkipFunc)
+		}
+
+		if aliases != nil {
+			syncSkipFunc = aliases.SkipFunc(current, plan.PutFunc(func(string) string { return reasonAlias }), syncSkipFunc)
+		}
+
+		if opts.hashCachePath != "" {
+			hashes, err = openHashCache(opts.hashCachePath)
+			if err != nil {
+				lock.Fatal(err)
+			}
+		}
+
+		planFunc = createSyncFunc(current, newFileComparison(ctx, opts.compare, fsys, comp, hashes, store), putFunc, syncSkipFunc)
+	}
+
+	// Files are compared with the remote objects in parallel, since that may mean hashing them.
+	seen := map[string]bool{}
+	planFiles := func(ctx context.Context) error {
+		planner := newUploadPool(ctx, opts.concurrency, false, planFunc)
+		walkErr := walkFiles(createFilterFunc(filter, createRecordFunc(seen, planner.WalkDirFunc())))
+		planErr := planner.Wait()
+		if err := hashes.Close(); err != nil {
+			log.Print(err)
+		}
+
+		if planErr != nil {
+			return planErr
+		}
+
+		return walkErr
+	}
+
+	// Unless the whole plan is needed before the first upload, files are uploaded as soon as they
+	// were compared, so that hashing them overlaps with uploading others. The files of a compressed
+	// tarball are all compared first, so that it isn't read at two places at once.
+	streaming := opts.planPath == "" && !opts.dryRunMode && !opts.resume && opts.maxDelete < 0 && !sequential
+
+	applyWalker := plan.Stream(ctx, opts.concurrency, planFiles)
+	if !streaming {
+		err := planFiles(ctx)
+		if ctx.Err() != nil {
+			lock.Fatal(interruption(ctx), " while planning; no files were uploaded.")
+		}
+
+		if err != nil {
+			lock.Fatal("Planning failed: ", err)
+		}
+
+		// The files of a compressed tarball are uploaded in the order they're stored in.
+		if !sequential {
+			plan.Sort()
+		}
+
+		applyWalker = plan.Walker()
+	}
+
+	if opts.resume {
+		skipped, err := resumeState.SkipCompleted(fsys, plan)
+		if err != nil {
+			lock.Fatal("Could not resume: ", err)
+		}
+
+		if skipped > 0 {
+			log.Printf("Resuming: skipping %d file(s) uploaded by an interrupted run\n", skipped)
+		}
+
+		if !opts.dryRunMode {
+			if err := resumeState.Start(); err != nil {
+				lock.Fatal(err)
+			}
+
+			uploadFunc = resumeState.RecordFunc(fsys, uploadFunc)
+		}
+	}
+
+	var plannedRedirects []redirect
+	var stale []string
+	var pending pendingDeletes
+
+	// finishPlan plans the redirects and deletions, which depend on every file that was found.
+	finishPlan := func() {
+		// Files take precedence over redirects from the same path.
+		for _, r := range redirects {
+			if seen[r.Key()] {
+				log.Printf("Skipping redirect from %s: %s exists\n", r.From, r.Key())
+				continue
+			}
+
+			plan.Redirect(r)
+			plannedRedirects = append(plannedRedirects, r)
+		}
+
+		if opts.deleteStale {
+			reason := reasonStale
+			if opts.sinceCommit != "" {
+				stale = deletedKeys(changes.Deleted, filter, variants, aliases)
+				reason = reasonDeletedInGit
+			} else {
+				kept := maps.Clone(seen)
+				renameSeenKeys(kept, renames)
+				addVariantKeys(kept, variants)
+				addAliasKeys(kept, aliases)
+				for _, r := range plannedRedirects {
+					kept[r.Key()] = true
+				}
+				if opts.manifestKey != "" {
+					kept[opts.manifestKey] = true
+				}
+				stale = staleKeys(remote, kept, filter)
+			}
+
+			if opts.deleteAfter > 0 {
+				previous, err := loadPendingDeletes(ctx, store)
+				if err != nil {
+					lock.Fatal("Could not read pending deletes: ", err)
+				}
+
+				stale, pending = previous.Schedule(stale, time.Now(), opts.deleteAfter)
+				if len(pending) > 0 {
+					log.Printf("Keeping %d stale object(s) until they have been stale for %s\n", len(pending), opts.deleteAfter)
+				}
+			}
+
+			if opts.maxDelete >= 0 && len(stale) > opts.maxDelete {
+				lock.Fatalf("Refusing to delete %d objects; the limit is %d.", len(stale), opts.maxDelete)
+			}
+
+			plan.Delete(stale, remote, reason)
+		}
+	}
+
+	if !streaming {
+		finishPlan()
+	}
+
+	if opts.planPath != "" {
+		if err := writePlan(opts.planPath, plan); err != nil {
+			lock.Fatal(err)
+		}
+	}
+
+	pool := newLimitedUploadPool(ctx, limiter, opts.continueOnError, plan.ApplyFunc(uploadFunc, skipFunc))
+	walkErr := order.Walker(applyWalker, pool.Flush)(pool.WalkDirFunc())
+	poolErr := pool.Wait()
+	if ctx.Err() != nil {
+		lock.Fatalf("%s: %d file(s) completed before cancellation; no objects were deleted.", interruption(ctx), pool.Completed())
+	}
+
+	var failures uploadErrors
+	if opts.continueOnError && errors.As(poolErr, &failures) {
+		if err := writeFailureReport(os.Stdout, pool.Completed(), failures); err != nil {
+			log.Print("Could not write failure report: ", err)
+		}
+
+		lock.Fatalf("%d upload(s) failed; no objects were deleted.", len(failures))
+	}
+
+	if err := poolErr; err != nil {
+		lock.Fatal("Upload failed: ", err)
+	}
+
+	if walkErr != nil {
+		lock.Fatal("Upload failed: ", walkErr)
+	}
+
+	if streaming {
+		finishPlan()
+	}
+
+	for _, r := range plannedRedirects {
+		if preview != nil {
+			preview.Redirect(r)
+		} else if err := uploadRedirect(ctx, retryClient, r); err != nil {
+			lock.Fatal(err)
+		}
+	}
+
+	if prog != nil {
+		prog.Summary()
+	}
+
+	if verifier != nil {
+		if failed := verifier.Verify(ctx, store, opts.concurrency, encryption.hasMD5ETag()); failed > 0 {
+			lock.Fatalf("%d object(s) failed verification; no objects were deleted.", failed)
+		}
+	}
+
+	files := publishedPaths(seen)
+
+	if (opts.manifestPath != "" || opts.manifestKey != "") && preview == nil {
+		published, err := store.List(ctx)
+		if err != nil {
+			lock.Fatal("Could not list uploaded objects: ", err)
+		}
+
+		baseURL := store.URL()
+		if settings.CDN != nil && settings.CDN.BaseURL != "" {
+			baseURL = settings.CDN.BaseURL
+		}
+
+		m, err := newManifest(fsys, files, published, renames, bucket, keyPrefix, baseURL, opts.sri, time.Now())
+		if err != nil {
+			lock.Fatal("Could not create the manifest: ", err)
+		}
+
+		body, err := m.Encode()
+		if err != nil {
+			lock.Fatal("Could not create the manifest: ", err)
+		}
+
+		if opts.manifestPath != "" {
+			if err := writeManifest(opts.manifestPath, body); err != nil {
+				lock.Fatal(err)
+			}
+		}
+
+		if opts.manifestKey != "" {
+			if err := uploadManifest(ctx, retryClient, opts.manifestKey, body); err != nil {
+				lock.Fatal(err)
+			}
+		}
+	}
+
+	if opts.renameManifest != "" && preview == nil {
+		body, err := renames.Encode()
+		if err != nil {
+			lock.Fatal("Could not create the rename manifest: ", err)
+		}
+
+		if err := writeManifest(opts.renameManifest, body); err != nil {
+			lock.Fatal(err)
+		}
+	}
+
+	var record *deployRecord
+	if opts.recordHistory && preview == nil {
+		record, err = newDeployRecord(fsys, files, time.Now())
+		if err != nil {
+			lock.Fatal("Could not record the deploy: ", err)
+		}
+
+		record.AppVersion = opts.appVersion
+		record.DeployVersion = opts.deployVersion
+		if commit, err := gitHead(ctx); err == nil {
+			record.GitCommit = commit
+		}
+	}
+
+	var deleted []string
+	if opts.deleteStale {
+		if preview != nil {
+			objects := make([]remoteObject, len(stale))
+			for i, key := range stale {
+				objects[i] = remote[key]
+				objects[i].Key = key
+			}
+
+			preview.Delete(objects)
+		} else if err := store.Delete(ctx, stale); err != nil {
+			lock.Fatal("Delete failed: ", err)
+		}
+
+		if preview == nil {
+			deleted = stale
+		}
+
+		if record != nil {
+			record.Deleted = stale
+		}
+
+		if pending != nil && preview == nil {
+			if err := pending.Save(ctx, store); err != nil {
+				lock.Fatal("Could not record pending deletes: ", err)
+			}
+		}
+	}
+
+	if opts.deployVersion != "" && preview == nil {
+		if err := writeDeployPointer(ctx, baseStore, opts.deployVersion, time.Now()); err != nil {
+			lock.Fatal("Could not update the current deploy: ", err)
+		}
+
+		log.Printf("Deployed %s as the current version\n", opts.deployVersion)
+	}
+
+	if record != nil {
+		if err := record.Save(ctx, baseStore); err != nil {
+			lock.Fatal("Could not record the deploy: ", err)
+		}
+
+		log.Printf("Recorded the deploy as %s\n", record.Name())
+	}
+
+	if uploaded != nil && preview == nil {
+		// A new deploy version changes every URL at once.
+		changed := append(uploaded.Paths(), deleted...)
+		if err := purgeChanges(ctx, purgers, settings.CDN.BaseURL, changed, opts.deployVersion != ""); err != nil {
+			lock.Fatal("CDN purge failed: ", err)
+		}
+	}
+
+	if preview != nil {
+		preview.Summary()
+	} else if err := resumeState.Remove(); err != nil {
+		log.Print(err)
+	}
+
+	if opts.watch {
+		watcher := &treeWatcher{
+			filter:   filter,
+			upload:   createSkippedFunc(createUploadFunc(ctx, fsys, objectUploader), logSkipped),
+			seen:     seen,
+			variants: variants,
+			delay:    watchDebounce,
+		}
+
+		// Removed files are only deleted right away if there's no grace period for stale objects.
+		if opts.deleteStale && opts.deleteAfter == 0 {
+			watcher.delete = store.Delete
+		}
+
+		if err := watcher.Run(ctx); err != nil {
+			lock.Fatal(err)
+		}
+	}
+
+	if fanout != nil {
+		if failed := fanout.Summary(); failed > 0 {
+			lock.Fatalf("%d destination(s) had failures.", failed)
+		}
+	}
+
+	if err := lock.Release(context.WithoutCancel(ctx)); err != nil {
+		log.Print("Could not release the deploy lock: ", err)
+	}
+}
+
+// uploadDecorators are the settings, parsed from the flags and the config file, that files are
+// processed with on their way to the bucket.
+type uploadDecorators struct {
+	metadata    map[string]string
+	multipart   multipartSettings
+	encryption  serverSideEncryption
+	passphrase  *clientEncryption
+	aliases     *websiteAliases
+	comp        *compressor
+	variants    *brotliVariants
+	headerRules []headerRule
+	renames     hashRenames
+	// started is when the run started; -keep-newer never overwrites objects modified since.
+	started time.Time
+	// blobs stores the contents of files for -dedup-prefix, if given.
+	blobs backend
+	// progress reports on every uploaded file, unless it's nil.
+	progress *progress
+	// recordChanges records the paths of uploaded files, for purging them from the CDN.
+	recordChanges bool
+}
+
+// uploadChain is the uploader files are uploaded through, and the decorators in it that the run
+// reports on once the files were uploaded.
+type uploadChain struct {
+	uploader uploader
+	// verifier and changes are nil unless -verify is given or the CDN is purged.
+	verifier *verifyUploader
+	changes  *changeRecorder
+}
+
+// newUploadChain wraps the client files are uploaded with in the decorators selected by the flags,
+// from the innermost to the outermost: a file is renamed before its headers are set, and
+// compressed before it's encrypted.
+func (f *uploadFlags) newUploadChain(client *retryUploader, store backend, limiter *concurrencyLimiter, d uploadDecorators) uploadChain {
+	var chain uploadChain
+	var objectUploader uploader = client
+
+	if f.verify && !f.dryRunMode {
+		chain.verifier = &verifyUploader{metadata: d.metadata, multipart: d.multipart, next: objectUploader}
+		objectUploader = chain.verifier
+	}
+
+	if f.move && !f.dryRunMode {
+		objectUploader = &moveVerifier{client: store, metadata: d.metadata, multipart: d.multipart, checkETag: d.encryption.hasMD5ETag(), next: objectUploader}
+	}
+
+	if (f.conditional || f.keepNewer) && !f.dryRunMode {
+		guard := &conditionalUploader{client: store, checkETag: d.encryption.hasMD5ETag(), next: objectUploader}
+		if f.keepNewer {
+			guard.keepNewer = d.started
+		}
+
+		objectUploader = guard
+	}
+
+	if d.passphrase != nil {
+		// Files are encrypted after being compressed, since encrypted files don't compress.
+		objectUploader = &encryptUploader{encryption: d.passphrase, next: objectUploader}
+	}
+
+	if d.blobs != nil {
+		blobUploader := newRetryUploader(d.blobs, f.maxRetries)
+		blobUploader.limiter = limiter
+		objectUploader = &dedupUploader{client: d.blobs, blobs: blobUploader, prefix: f.dedupPrefix, next: objectUploader}
+	}
+
+	if d.aliases != nil {
+		objectUploader = &websiteUploader{aliases: d.aliases, next: objectUploader}
+	}
+
+	if d.comp != nil {
+		objectUploader = &gzipUploader{compressor: d.comp, next: objectUploader}
+	}
+
+	if d.variants != nil {
+		objectUploader = &brotliUploader{variants: d.variants, next: objectUploader}
+	}
+
+	if d.progress != nil {
+		objectUploader = &progressUploader{progress: d.progress, next: objectUploader}
+	}
+
+	objectUploader = &headerUploader{rules: d.headerRules, next: objectUploader}
+	objectUploader = &contentTypeUploader{defaultType: f.defaultContentType, next: objectUploader}
+
+	if f.preserve {
+		objectUploader = &attributesUploader{next: objectUploader}
+	}
+
+	if f.compare == compareChecksum {
+		objectUploader = &checksumUploader{next: objectUploader}
+	}
+
+	if d.recordChanges {
+		chain.changes = &changeRecorder{next: objectUploader}
+		objectUploader = chain.changes
+	}
+
+	if d.renames != nil {
+		objectUploader = &renameUploader{renames: d.renames, next: objectUploader}
+	}
+
+	if f.move {
+		objectUploader = &moveUploader{next: objectUploader, remove: removeLocalFile}
+	}
+
+	if f.perFileTimeout > 0 {
+		objectUploader = &timeoutUploader{timeout: f.perFileTimeout, next: objectUploader}
+	}
+
+	chain.uploader = objectUploader
+
+	return chain
+}
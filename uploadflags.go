@@ -0,0 +1,412 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+)
+
+// uploadFlags are the flags of the `upload` and `sync` commands.
+type uploadFlags struct {
+	common commonFlags
+	grants objectGrants
+
+	acl                      string
+	appVersion               string
+	archiveKey               string
+	archiveManifest          string
+	archiveName              string
+	checkpointPath           string
+	checksumName             string
+	compareName              string
+	dedupPrefix              string
+	defaultContentType       string
+	deployVersion            string
+	encryptionPassphraseFile string
+	fanoutPolicy             string
+	filesFrom                string
+	fingerprintPattern       string
+	fromArchive              string
+	hashCachePath            string
+	inventoryPath            string
+	keyTemplate              string
+	manifestKey              string
+	manifestPath             string
+	mimeMap                  string
+	objectLockMode           string
+	objectLockRetain         string
+	planPath                 string
+	redirectsPath            string
+	renameManifest           string
+	sinceCommit              string
+	sseCustomerKeyFile       string
+	sseKMSKeyID              string
+	sseMode                  string
+	stripPrefix              string
+
+	deleteAfter    time.Duration
+	lockTimeout    time.Duration
+	perFileTimeout time.Duration
+	runTimeout     time.Duration
+
+	concurrency        int
+	listConcurrency    int
+	maxDelete          int
+	maxMemory          int
+	maxRetries         int
+	multipartThreshold int
+	partConcurrency    int
+	partSize           int
+	walkConcurrency    int
+
+	autoCache        bool
+	bucketVersioning bool
+	conditional      bool
+	continueOnError  bool
+	createBucket     bool
+	deleteStale      bool
+	dryRunMode       bool
+	errorOnSymlinks  bool
+	followSymlinks   bool
+	keepNewer        bool
+	legalHold        bool
+	lockDeploy       bool
+	lowercaseKeys    bool
+	move             bool
+	normalizeKeys    bool
+	nulSeparated     bool
+	preserve         bool
+	publicBucket     bool
+	quiet            bool
+	recordHistory    bool
+	resume           bool
+	skipHidden       bool
+	skipPreflight    bool
+	skipSpecial      bool
+	skipSymlinks     bool
+	sri              bool
+	stripHTML        bool
+	syncMode         bool
+	verify           bool
+	watch            bool
+	website          bool
+
+	aclRules       stringList
+	alsoEnv        stringList
+	brotliPatterns stringList
+	cacheControl   stringList
+	exclude        stringList
+	gzipPatterns   stringList
+	hashNames      stringList
+	include        stringList
+	metadataPairs  stringList
+	renameRules    stringList
+	sourceDirs     stringList
+	tagPairs       stringList
+	tagRules       stringList
+	uploadLast     stringList
+
+	// compare and archive are parsed from -compare and -archive by validate.
+	compare compareMode
+	archive archiveFormat
+}
+
+// register adds the flags to a command's flag set. The `sync` command always compares files
+// with the existing objects, so it has no `-sync` flag.
+func (f *uploadFlags) register(flags *flag.FlagSet, cmd command) {
+	f.common.register(flags)
+	f.grants.register(flags)
+	flags.BoolVar(&f.nulSeparated, "0", false, "Paths given to -files-from are separated by NUL characters instead of newlines")
+	flags.StringVar(&f.acl, "acl", "public-read", "Canned ACL to apply to uploaded files, or 'none' to omit the ACL")
+	flags.Var(&f.aclRules, "acl-rule", "Canned ACL for files matching a pattern, as '<pattern>=<acl>', e.g. 'private/**=private' (repeatable)")
+	flags.Var(&f.alsoEnv, "also-env", "Named environment from the config file to also upload to, in parallel with the main destination (repeatable)")
+	flags.StringVar(&f.appVersion, "app-version", "", "Application version to tag files with.")
+	flags.StringVar(&f.archiveName, "archive", "", "Upload the files as a single archive instead of one object each: 'tar.gz' or 'zip' (requires -archive-key)")
+	flags.StringVar(&f.archiveKey, "archive-key", "", "Key to upload the archive created by -archive under, relative to the prefix, e.g. 'builds/{git_sha}.tar.gz'")
+	flags.StringVar(&f.archiveManifest, "archive-manifest", "", "Name under which to add a JSON manifest of the size and SHA-256 hash of every file to the archive created by -archive, e.g. 'MANIFEST.json'")
+	flags.BoolVar(&f.autoCache, "auto-cache", false, "Cache fingerprinted files, whose names match -fingerprint-pattern, forever and have every other file revalidated, unless a Cache-Control rule matches")
+	flags.Var(&f.brotliPatterns, "brotli", "Glob patterns of files to also upload as a Brotli-compressed '.br' variant, e.g. '*.js,*.css' (repeatable)")
+	flags.BoolVar(&f.bucketVersioning, "bucket-versioning", false, "Enable versioning on the bucket created by -create-bucket")
+	flags.Var(&f.cacheControl, "cache-control", "Cache-Control header for files matching a pattern, as '<pattern>=<value>' (repeatable)")
+	flags.StringVar(&f.checkpointPath, "checkpoint", defaultCheckpointPath, "File recording the files uploaded so far, with their hashes, for -resume")
+	flags.StringVar(&f.checksumName, "checksum", "", "Checksum to send with uploads so that S3 rejects corrupted transfers: 'md5', 'crc32', 'crc32c', 'crc64nvme', 'sha1', or 'sha256'")
+	flags.StringVar(&f.compareName, "compare", string(compareETag), "How -sync decides that a file is unchanged: 'etag' compares the size and the MD5-based ETag, 'size' only the size, 'mtime' the size and whether the file was modified after its object, 'checksum' the SHA-256 digest stored with the object")
+	flags.IntVar(&f.concurrency, "concurrency", 4, "Number of files to upload in parallel")
+	flags.BoolVar(&f.conditional, "conditional", false, "Read every object before uploading it, skip objects that already match, and fail instead of overwriting an object another run changed in the meantime")
+	flags.BoolVar(&f.continueOnError, "continue-on-error", false, "Keep uploading after a failure and print a JSON report of failed files at the end")
+	flags.BoolVar(&f.createBucket, "create-bucket", false, "Create the bucket if it doesn't exist, e.g. for preview environments")
+	flags.StringVar(&f.dedupPrefix, "dedup-prefix", "", "Store the contents of every file once, under its SHA-256 digest beneath this prefix of the bucket, and upload objects redirecting to them in place of the files, e.g. for preview deploys sharing most of their files")
+	flags.StringVar(&f.defaultContentType, "default-content-type", "", "Content-Type for files whose type can't be determined from their extension or contents")
+	flags.BoolVar(&f.deleteStale, "delete", false, "Delete objects that no longer exist locally (requires -sync)")
+	flags.DurationVar(&f.deleteAfter, "delete-after", 0, "Only delete objects once they have been stale for this long, as recorded across runs, e.g. '24h' (requires -sync and -delete)")
+	flags.StringVar(&f.deployVersion, "deploy-version", "", "Upload under 'deploys/<version>/' beneath the prefix and make it the current deploy once every upload succeeded")
+	flags.BoolVar(&f.dryRunMode, "dry-run", false, "Print the changes that would be made without modifying the bucket")
+	flags.StringVar(&f.encryptionPassphraseFile, "encryption-passphrase-file", "", "File containing a passphrase to encrypt files with on the client before uploading them, for buckets whose provider shouldn't be able to read them (see 'download -encryption-passphrase-file')")
+	flags.BoolVar(&f.errorOnSymlinks, "error-on-symlinks", false, "Fail on any symbolic link in the tree instead of uploading what it points to")
+	flags.Var(&f.exclude, "exclude", "Glob pattern of files to skip (repeatable)")
+	flags.StringVar(&f.fanoutPolicy, "fanout-policy", fanoutAll, "What to do when uploading to one of the -also-env destinations fails: 'all' fails the run, 'report' stops uploading to that destination and reports it at the end")
+	flags.StringVar(&f.filesFrom, "files-from", "", "Upload only the files listed in this file, or '-' to read the list from standard input")
+	flags.StringVar(&f.fingerprintPattern, "fingerprint-pattern", "", "Regular expression matching the paths of files whose names contain a content hash, for -auto-cache; by default, names with at least 8 hex digits, including a letter, before the extension")
+	flags.BoolVar(&f.followSymlinks, "follow-symlinks", false, "Upload the files beneath symbolic links to directories, which otherwise fail the upload, except for links back to a directory containing them")
+	flags.StringVar(&f.fromArchive, "from-archive", "", "Upload the entries of a '.zip', '.tar.gz', '.tgz', or '.tar' archive instead of the files in the working directory, reading the files of compressed tarballs one at a time")
+	flags.Var(&f.gzipPatterns, "gzip", "Glob patterns of files to gzip before uploading, e.g. '*.js,*.css' (repeatable)")
+	flags.StringVar(&f.hashCachePath, "hash-cache", "", "Database caching the hashes of local files by size and modification time, so that -sync doesn't hash unchanged files again")
+	flags.Var(&f.hashNames, "hash-names", "Glob patterns of files to upload under a key containing a hash of their contents, e.g. 'app.js' as 'app.3fa9c1d2.js' (repeatable)")
+	flags.Var(&f.include, "include", "Glob pattern of files to upload; if given, other files are skipped (repeatable)")
+	flags.StringVar(&f.inventoryPath, "inventory", "", "S3 Inventory report in CSV or Parquet format to read the existing objects from with -sync instead of listing them, as the s3:// URL of its manifest.json or of a prefix to use the latest report under")
+	flags.StringVar(&f.keyTemplate, "key", "", "Key to upload the files given as arguments under, relative to the prefix, with '{name}' for the name of each file and '{path}' for its path, e.g. 'releases/{version}/{name}'")
+	flags.BoolVar(&f.keepNewer, "keep-newer", false, "Never overwrite an object modified after the run started, e.g. by a concurrent deploy (implies -conditional)")
+	flags.BoolVar(&f.legalHold, "legal-hold", false, "Place a legal hold on uploaded files, protecting them until it's removed, in buckets with Object Lock enabled")
+	flags.IntVar(&f.listConcurrency, "list-concurrency", 1, "Number of top-level directories under the prefix to list in parallel when comparing with existing objects, for buckets with many objects")
+	flags.BoolVar(&f.lockDeploy, "lock", false, "Hold a lock object in the bucket while uploading, so that concurrent runs for the same prefix fail instead of interleaving")
+	flags.DurationVar(&f.lockTimeout, "lock-timeout", defaultLockTimeout, "Time after which the lock of a run that didn't release it, e.g. because it crashed, may be taken over")
+	flags.BoolVar(&f.lowercaseKeys, "lowercase-keys", false, "Upload files under lower-case keys, e.g. 'Docs/README.md' as 'docs/readme.md'")
+	flags.StringVar(&f.manifestPath, "manifest", "", "Write a JSON manifest mapping every file to its key, URL, ETag, size, and hash to this file, or '-' for standard output")
+	flags.StringVar(&f.manifestKey, "manifest-key", "", "Also upload the manifest under this key, relative to the prefix")
+	flags.IntVar(&f.maxDelete, "max-delete", -1, "Abort if more than this many objects would be deleted (-1 for no limit)")
+	flags.IntVar(&f.maxMemory, "max-memory", 0, "Memory budget in MiB for the parts of large files in flight; lowers -upload-concurrency and then -concurrency to fit (0 for no limit)")
+	flags.IntVar(&f.maxRetries, "max-retries", 3, "Number of times to retry an upload that failed with a transient error")
+	flags.Var(&f.metadataPairs, "metadata", "User metadata to store with uploaded files, as '<key>=<value>' (repeatable)")
+	flags.StringVar(&f.mimeMap, "mime-map", "", "JSON file mapping file extensions to content types, overriding the system defaults")
+	flags.BoolVar(&f.move, "move", false, "Remove every local file once its objects were uploaded and read back matching what was sent, e.g. to ship logs off a spool directory")
+	flags.IntVar(&f.multipartThreshold, "multipart-threshold", 0, "Size in MiB up to which files are uploaded in a single request (defaults to the part size)")
+	flags.BoolVar(&f.normalizeKeys, "normalize-keys", false, "Upload files under normalized keys: backslashes in names become slashes, names are converted to Unicode NFC, and characters unsafe in URLs are replaced by '_'")
+	flags.StringVar(&f.objectLockMode, "object-lock-mode", "", "Object Lock retention mode of uploaded files, in buckets with Object Lock enabled: 'GOVERNANCE' or 'COMPLIANCE' (requires -object-lock-retain)")
+	flags.StringVar(&f.objectLockRetain, "object-lock-retain", "", "Period for which uploaded files can't be deleted or overwritten, e.g. '90d', or the date until which, e.g. '2030-01-01' (requires -object-lock-mode)")
+	flags.IntVar(&f.partSize, "part-size", int(manager.DefaultUploadPartSize/mebibyte), "Size in MiB of the parts large files are uploaded in")
+	flags.DurationVar(&f.perFileTimeout, "per-file-timeout", 0, "Fail the upload of a file, including its retries, if it takes longer than this, e.g. '5m', so that a hung connection can't stall the run")
+	flags.StringVar(&f.planPath, "plan", "", "Write the actions of the run, with the reason for each, as JSON to this file before applying them, or '-' for standard output")
+	flags.BoolVar(&f.preserve, "preserve", false, "Store the modification time and permissions of every file in its metadata, for 'download -preserve' to restore")
+	flags.BoolVar(&f.publicBucket, "public-bucket", false, "Allow public access to the bucket created by -create-bucket, e.g. for files uploaded with '-acl public-read'")
+	flags.BoolVar(&f.quiet, "quiet", false, "Only report the totals for the run instead of the progress of each file")
+	flags.BoolVar(&f.recordHistory, "record-history", false, "Record the deploy, with a hash of every file, in the bucket's deploy history (see the 'history' command)")
+	flags.StringVar(&f.redirectsPath, "redirects", defaultRedirectsPath, "Netlify-style file of redirects to create as objects for S3 website hosting, read if it exists")
+	flags.StringVar(&f.renameManifest, "rename-manifest", "", "Write a JSON object mapping the files renamed by -hash-names or the key transforms to their keys to this file, or '-' for standard output")
+	flags.Var(&f.renameRules, "rename-rule", "Regular expression and replacement renaming the keys that match, as '<regexp>=<replacement>', e.g. '^assets/(.*)$=static/$1' (repeatable)")
+	flags.BoolVar(&f.resume, "resume", false, "Record progress in the -checkpoint file, and skip the files and parts of large files an interrupted run with -resume already uploaded")
+	flags.StringVar(&f.sinceCommit, "since-commit", "", "Upload only the files that changed in git since this commit and, with -delete, delete the objects of removed files")
+	flags.BoolVar(&f.skipHidden, "skip-hidden", false, "Leave out dotfiles and the files beneath dot-directories, such as '.git', and never delete their objects")
+	flags.BoolVar(&f.skipPreflight, "skip-preflight", false, "Don't check that the bucket exists, is in the right region, and may be uploaded to before uploading")
+	flags.BoolVar(&f.skipSpecial, "skip-special", false, "Leave out sockets, named pipes, and device files, which otherwise fail the upload")
+	flags.BoolVar(&f.skipSymlinks, "skip-symlinks", false, "Leave out symbolic links to files and directories")
+	flags.Var(&f.sourceDirs, "source", "Directory to upload instead of the working directory, as '<dir>' or '<dir>=<prefix>' to upload its files under a prefix of their own (repeatable)")
+	flags.BoolVar(&f.sri, "sri", false, "Add Subresource Integrity (sha384) digests of scripts and stylesheets to the manifest (requires -manifest or -manifest-key)")
+	flags.StringVar(&f.sseMode, "sse", "", "Server-side encryption to request: 'AES256', 'aws:kms', or 'aws:kms:dsse'")
+	flags.StringVar(&f.sseCustomerKeyFile, "sse-c-key-file", "", "File containing a 256-bit key for server-side encryption with a customer-provided key (SSE-C)")
+	flags.StringVar(&f.sseKMSKeyID, "sse-kms-key-id", "", "KMS key to encrypt with when using 'aws:kms' or 'aws:kms:dsse' encryption")
+	flags.BoolVar(&f.stripHTML, "strip-html", false, "Also upload every '.html' file without its extension, e.g. 'about.html' as 'about' (requires -website)")
+	flags.StringVar(&f.stripPrefix, "strip-prefix", "", "Directory to remove from the start of the keys of the files beneath it, e.g. 'dist/' to upload 'dist/index.html' as 'index.html'")
+	if cmd.name == "sync" {
+		f.syncMode = true
+	} else {
+		flags.BoolVar(&f.syncMode, "sync", false, "Only upload files that differ from the objects already in the bucket")
+	}
+
+	flags.Var(&f.tagPairs, "tag", "S3 object tag to apply to uploaded files, as '<key>=<value>' (repeatable)")
+	flags.Var(&f.tagRules, "tag-rule", "S3 object tag for files matching a pattern, as '<pattern>=<key>=<value>', e.g. 'previews/**=ttl=7d' (repeatable)")
+	flags.DurationVar(&f.runTimeout, "timeout", 0, "Fail the run if it takes longer than this, e.g. '30m', stopping it like an interrupt")
+	flags.IntVar(&f.partConcurrency, "upload-concurrency", manager.DefaultUploadConcurrency, "Number of parts of a large file to upload in parallel")
+	flags.Var(&f.uploadLast, "upload-last", "Glob patterns of files to upload only after every other file was uploaded successfully, e.g. '*.html' (repeatable)")
+	flags.BoolVar(&f.verify, "verify", false, "Read back every uploaded object and fail if its size, checksum, content type, or metadata don't match what was sent")
+	flags.IntVar(&f.walkConcurrency, "walk-concurrency", 8, "Number of directories to read in parallel while finding the files to upload, which speeds up large trees on network file systems")
+	flags.BoolVar(&f.watch, "watch", false, "Keep running after the upload, uploading files as they change and, with -delete, deleting removed ones")
+	flags.BoolVar(&f.website, "website", false, "Also upload every 'index.html' under its directory's key, e.g. 'about/index.html' as 'about/' and 'about', for clean URLs")
+}
+
+// validate rejects invalid flags and combinations of flags that can't be used together, given the
+// files or globs passed as arguments. It parses the values the checks depend on, and must be
+// called once the config file was applied.
+func (f *uploadFlags) validate(flags *flag.FlagSet, patterns []string) error {
+	if f.deleteStale && !f.syncMode && f.sinceCommit == "" {
+		return errors.New("The '-delete' flag can only be used together with '-sync' or '-since-commit'.")
+	}
+
+	if f.inventoryPath != "" && !f.syncMode {
+		return errors.New("The '-inventory' flag can only be used together with '-sync'.")
+	}
+
+	if f.listConcurrency < 1 {
+		return errors.New("The '-list-concurrency' flag must be at least 1.")
+	}
+
+	if f.walkConcurrency < 1 {
+		return errors.New("The '-walk-concurrency' flag must be at least 1.")
+	}
+
+	if f.maxMemory < 0 {
+		return errors.New("The '-max-memory' flag must not be negative.")
+	}
+
+	if f.perFileTimeout < 0 || f.runTimeout < 0 {
+		return errors.New("The '-per-file-timeout' and '-timeout' flags must not be negative.")
+	}
+
+	if f.hashCachePath != "" && !f.syncMode {
+		return errors.New("The '-hash-cache' flag can only be used together with '-sync'.")
+	}
+
+	compare, err := parseCompareMode(f.compareName)
+	if err != nil {
+		return err
+	}
+
+	f.compare = compare
+	if flagGiven(flags, "compare") && !f.syncMode {
+		return errors.New("The '-compare' flag can only be used together with '-sync'.")
+	}
+
+	if f.hashCachePath != "" && f.compare != compareETag {
+		return errors.New("The '-hash-cache' flag can only be used together with '-compare etag'.")
+	}
+
+	if f.deleteAfter < 0 {
+		return errors.New("The '-delete-after' flag can't be negative.")
+	}
+
+	if f.deleteAfter > 0 && (!f.deleteStale || !f.syncMode) {
+		return errors.New("The '-delete-after' flag can only be used together with '-sync' and '-delete'.")
+	}
+
+	if f.deleteStale && f.filesFrom != "" {
+		return errors.New("The '-delete' flag can't be used together with '-files-from'.")
+	}
+
+	if f.filesFrom != "" && f.sinceCommit != "" {
+		return errors.New("The '-files-from' and '-since-commit' flags can't be used together.")
+	}
+
+	if len(f.sourceDirs) > 0 && (f.filesFrom != "" || f.sinceCommit != "") {
+		return errors.New("The '-source' flag can't be used together with '-files-from' or '-since-commit'.")
+	}
+
+	if len(patterns) > 0 && (f.filesFrom != "" || f.sinceCommit != "" || len(f.sourceDirs) > 0) {
+		return errors.New("Files to upload can't be given as arguments together with '-files-from', '-since-commit', or '-source'.")
+	}
+
+	if len(patterns) > 0 && f.deleteStale {
+		return errors.New("The '-delete' flag can't be used together with files given as arguments.")
+	}
+
+	if len(patterns) > 0 && f.watch {
+		return errors.New("The '-watch' flag can't be used together with files given as arguments.")
+	}
+
+	if f.fromArchive != "" && (len(f.sourceDirs) > 0 || f.filesFrom != "" || f.sinceCommit != "" || len(patterns) > 0 || f.watch || f.hashCachePath != "") {
+		return errors.New("The '-from-archive' flag can't be used together with '-source', '-files-from', '-since-commit', '-watch', '-hash-cache', or files given as arguments.")
+	}
+
+	if f.keyTemplate != "" && len(patterns) == 0 {
+		return errors.New("The '-key' flag can only be used together with files given as arguments.")
+	}
+
+	if f.deployVersion != "" {
+		if err := validateDeployVersion(f.deployVersion); err != nil {
+			return err
+		}
+	}
+
+	f.manifestKey = strings.TrimPrefix(f.manifestKey, "/")
+	if f.sri && f.manifestPath == "" && f.manifestKey == "" {
+		return errors.New("The '-sri' flag can only be used together with '-manifest' or '-manifest-key'.")
+	}
+
+	if f.stripHTML && !f.website {
+		return errors.New("The '-strip-html' flag can only be used together with '-website'.")
+	}
+
+	if flagGiven(flags, "checkpoint") && !f.resume {
+		return errors.New("The '-checkpoint' flag can only be used together with '-resume'.")
+	}
+
+	if f.watch && f.dryRunMode {
+		return errors.New("The '-watch' flag can't be used together with '-dry-run'.")
+	}
+
+	if f.watch && len(f.hashNames) > 0 {
+		return errors.New("The '-watch' flag can't be used together with '-hash-names'.")
+	}
+
+	if f.watch && f.runTimeout > 0 {
+		return errors.New("The '-watch' flag can't be used together with '-timeout'.")
+	}
+
+	if f.watch && f.transformsKeys() {
+		return errors.New("The '-watch' flag can't be used together with '-source', '-key', '-normalize-keys', '-strip-prefix', '-lowercase-keys', or '-rename-rule'.")
+	}
+
+	archive, err := parseArchiveFormat(f.archiveName)
+	if err != nil {
+		return err
+	}
+
+	f.archive = archive
+	if f.archive == "" && (f.archiveKey != "" || f.archiveManifest != "") {
+		return errors.New("The '-archive-key' and '-archive-manifest' flags can only be used together with '-archive'.")
+	}
+
+	if f.archive != "" {
+		if f.archiveKey == "" || strings.HasSuffix(f.archiveKey, "/") {
+			return errors.New("The '-archive-key' flag must give the key to upload the archive to, e.g. 'builds/site.tar.gz'.")
+		}
+
+		if f.syncMode || f.deleteStale || f.watch || f.resume || f.dryRunMode || f.planPath != "" || f.deployVersion != "" {
+			return errors.New("The '-archive' flag can't be used together with '-sync', '-delete', '-watch', '-resume', '-dry-run', '-plan', or '-deploy-version'.")
+		}
+
+		if f.website || len(f.gzipPatterns) > 0 || len(f.brotliPatterns) > 0 || f.manifestPath != "" || f.manifestKey != "" {
+			return errors.New("The '-archive' flag can't be used together with '-website', '-gzip', '-brotli', '-manifest', or '-manifest-key'.")
+		}
+	}
+
+	if f.encryptionPassphraseFile != "" && f.syncMode {
+		return errors.New("The '-encryption-passphrase-file' flag can't be used together with '-sync', since encrypted objects can't be compared with the local files.")
+	}
+
+	if f.dedupPrefix != "" && (f.archive != "" || f.encryptionPassphraseFile != "") {
+		return errors.New("The '-dedup-prefix' flag can't be used together with '-archive' or '-encryption-passphrase-file'.")
+	}
+
+	if f.move && (f.deleteStale || f.archive != "" || f.fromArchive != "" || f.fanoutPolicy != fanoutAll) {
+		return errors.New("The '-move' flag can't be used together with '-delete', '-archive', '-from-archive', or '-fanout-policy report'.")
+	}
+
+	if f.renameManifest != "" && len(f.hashNames) == 0 && !f.transformsKeys() {
+		return errors.New("The '-rename-manifest' flag can only be used together with '-hash-names' or the key transform flags.")
+	}
+
+	if (f.bucketVersioning || f.publicBucket) && !f.createBucket {
+		return errors.New("The '-bucket-versioning' and '-public-bucket' flags can only be used together with '-create-bucket'.")
+	}
+
+	if flagGiven(flags, "fanout-policy") && len(f.alsoEnv) == 0 {
+		return errors.New("The '-fanout-policy' flag can only be used together with '-also-env'.")
+	}
+
+	if !f.grants.Empty() && flagGiven(flags, "acl") {
+		return errors.New("The '-acl' flag can't be used together with the '-grant-*' flags; use '-acl-rule' to set a canned ACL for some files instead.")
+	}
+
+	if flagGiven(flags, "fingerprint-pattern") && !f.autoCache {
+		return errors.New("The '-fingerprint-pattern' flag can only be used together with '-auto-cache'.")
+	}
+
+	scheme, _, _ := parseBucketURL(f.common.bucket, "")
+	if (f.conditional || f.keepNewer) && (scheme != defaultBackend || len(f.alsoEnv) > 0) {
+		return errors.New("The '-conditional' and '-keep-newer' flags can only be used with S3 buckets, and not together with '-also-env'.")
+	}
+
+	if f.dedupPrefix != "" && (scheme != defaultBackend || len(f.alsoEnv) > 0) {
+		return errors.New("The '-dedup-prefix' flag can only be used with S3 buckets, and not together with '-also-env'.")
+	}
+
+	return nil
+}
+
+// transformsKeys reports whether any of the flags is given that uploads files under keys other
+// than their paths, and which make up the keyTransforms of the run.
+func (f *uploadFlags) transformsKeys() bool {
+	return len(f.sourceDirs) > 0 || strings.TrimPrefix(f.keyTemplate, "/") != "" || f.normalizeKeys || normalizePrefix(f.stripPrefix) != "" || f.lowercaseKeys || len(f.renameRules) > 0
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_uploadFlags_validate(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		cmd         string
+		args        []string
+		wantErr     string
+		wantCompare compareMode
+	}{
+		{desc: "defaults", args: []string{"-bucket", "my-site"}, wantCompare: compareETag},
+		{
+			desc:    "delete without sync",
+			args:    []string{"-delete"},
+			wantErr: "The '-delete' flag can only be used together with '-sync' or '-since-commit'.",
+		},
+		{desc: "delete with the sync command", cmd: "sync", args: []string{"-delete"}, wantCompare: compareETag},
+		{desc: "comparison", cmd: "sync", args: []string{"-compare", "Checksum"}, wantCompare: compareChecksum},
+		{
+			desc:    "comparison without sync",
+			args:    []string{"-compare", "size"},
+			wantErr: "The '-compare' flag can only be used together with '-sync'.",
+		},
+		{
+			desc:    "unknown comparison",
+			cmd:     "sync",
+			args:    []string{"-compare", "crc"},
+			wantErr: "unknown comparison \"crc\"; expected 'etag', 'size', 'mtime', or 'checksum'",
+		},
+		{
+			desc:    "key without files",
+			args:    []string{"-key", "releases/{name}"},
+			wantErr: "The '-key' flag can only be used together with files given as arguments.",
+		},
+		{desc: "key with files", args: []string{"build/*.tar.gz", "-key", "releases/{name}"}, wantCompare: compareETag},
+		{
+			desc:    "watch with key transforms",
+			args:    []string{"-watch", "-strip-prefix", "dist/"},
+			wantErr: "The '-watch' flag can't be used together with '-source', '-key', '-normalize-keys', '-strip-prefix', '-lowercase-keys', or '-rename-rule'.",
+		},
+		{
+			desc:    "archive without key",
+			args:    []string{"-archive", "zip"},
+			wantErr: "The '-archive-key' flag must give the key to upload the archive to, e.g. 'builds/site.tar.gz'.",
+		},
+		{
+			desc:    "grants with an ACL",
+			args:    []string{"-acl", "private", "-grant-read", "id=0123"},
+			wantErr: "The '-acl' flag can't be used together with the '-grant-*' flags; use '-acl-rule' to set a canned ACL for some files instead.",
+		},
+		{
+			desc:    "conditional with another backend",
+			args:    []string{"-bucket", "sftp://example.com/srv", "-conditional"},
+			wantErr: "The '-conditional' and '-keep-newer' flags can only be used with S3 buckets, and not together with '-also-env'.",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			cmd := command{name: "upload"}
+			if tC.cmd != "" {
+				cmd.name = tC.cmd
+			}
+
+			var opts uploadFlags
+			flags := newFlagSet(cmd, "[flags] [file or glob...]")
+			opts.register(flags, cmd)
+			patterns := parseInterspersed(flags, tC.args)
+
+			err := opts.validate(flags, patterns)
+			if gotErr := err != nil; gotErr != (tC.wantErr != "") || (gotErr && err.Error() != tC.wantErr) {
+				t.Fatalf("Expected error %q; got %v", tC.wantErr, err)
+			}
+
+			if err == nil && opts.compare != tC.wantCompare {
+				t.Errorf("Expected comparison %q; got %q", tC.wantCompare, opts.compare)
+			}
+		})
+	}
+}
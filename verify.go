@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	syncplan "github.com/Zeroed-Books/s3-copy/pkg/sync"
+)
+
+// objectHead holds the properties of a stored object that are checked by verification.
+type objectHead struct {
+	Size         int64
+	ETag         string
+	ContentType  string
+	Metadata     map[string]string
+	LastModified time.Time
+}
+
+// An objectHeader allows for reading the properties of a stored object.
+type objectHeader interface {
+	// Head returns the properties of the object at the given path.
+	Head(ctx context.Context, path string) (objectHead, error)
+}
+
+// expectedObject records what was sent for an uploaded object, so that it can be compared with
+// what was stored.
+type expectedObject struct {
+	Path        string
+	ContentType string
+	Metadata    map[string]string
+	// hashed reports whether the size and ETags were computed. They can't be for bodies that
+	// can't be rewound after hashing.
+	hashed bool
+	size   int64
+	etag   string
+	// partETag is the multipart ETag, for bodies large enough to be uploaded in multiple parts.
+	partETag string
+}
+
+// verifyUploader records the size, digest, content type, and metadata of every object uploaded
+// through it, for a verification pass once the uploads are done.
+type verifyUploader struct {
+	// metadata is the user metadata sent with every object, before per-file headers.
+	metadata map[string]string
+	// multipart are the settings large files are uploaded with, which determine their ETag.
+	multipart multipartSettings
+	next      uploader
+
+	mu       sync.Mutex
+	expected []expectedObject
+}
+
+func (u *verifyUploader) Upload(ctx context.Context, object *uploadObject) error {
+	expected, err := newExpectedObject(object, u.metadata, u.multipart)
+	if err != nil {
+		return err
+	}
+
+	if err := u.next.Upload(ctx, object); err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.expected = append(u.expected, expected)
+
+	return nil
+}
+
+// newExpectedObject records what is about to be sent for an object, with the user metadata sent
+// with every object.
+func newExpectedObject(object *uploadObject, metadata map[string]string, multipart multipartSettings) (expectedObject, error) {
+	// The content type and metadata are resolved the same way the S3 uploader resolves them.
+	input := &s3.PutObjectInput{ContentType: aws.String(object.ContentType), Metadata: metadata}
+	if err := applyHeaders(input, object.Headers); err != nil {
+		return expectedObject{}, err
+	}
+
+	expected := expectedObject{
+		Path:        object.Path,
+		ContentType: aws.ToString(input.ContentType),
+		Metadata:    input.Metadata,
+	}
+
+	if seeker, ok := object.Body.(io.ReadSeeker); ok {
+		if err := expected.hash(seeker, multipart); err != nil {
+			return expectedObject{}, fmt.Errorf("could not hash %s: %v", object.Path, err)
+		}
+	}
+
+	return expected, nil
+}
+
+// hash computes the size and ETags of a body, rewinding it afterwards.
+func (e *expectedObject) hash(body io.ReadSeeker, multipart multipartSettings) error {
+	digest := md5.New()
+	size, err := io.Copy(digest, body)
+	if err != nil {
+		return err
+	}
+
+	e.size = size
+	e.etag = hex.EncodeToString(digest.Sum(nil))
+
+	if size > multipart.partSize() && size > multipart.Threshold {
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		e.partETag, err = syncplan.LocalETag(body, syncplan.UploadPartSize(size, multipart.partSize()))
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	e.hashed = true
+
+	return nil
+}
+
+// mismatches compares the stored object with what was sent, describing each difference. ETags
+// are only compared if `checkETag` is set, since objects encrypted with KMS or a customer key
+// don't have an MD5 ETag.
+func (e expectedObject) mismatches(head objectHead, checkETag bool) []string {
+	var problems []string
+	if e.hashed && head.Size != e.size {
+		problems = append(problems, fmt.Sprintf("size is %d bytes, expected %d", head.Size, e.size))
+	}
+
+	if e.hashed && checkETag && head.Size == e.size {
+		want := e.etag
+		if strings.Contains(head.ETag, "-") {
+			want = e.partETag
+		}
+
+		if head.ETag != want {
+			problems = append(problems, fmt.Sprintf("ETag is %q, expected %q", head.ETag, want))
+		}
+	}
+
+	if head.ContentType != e.ContentType {
+		problems = append(problems, fmt.Sprintf("content type is %q, expected %q", head.ContentType, e.ContentType))
+	}
+
+	// S3 doesn't preserve the case of metadata keys.
+	if stored, sent := lowerKeys(head.Metadata), lowerKeys(e.Metadata); !maps.Equal(stored, sent) {
+		problems = append(problems, fmt.Sprintf("metadata is %v, expected %v", head.Metadata, e.Metadata))
+	}
+
+	return problems
+}
+
+// lowerKeys returns a copy of the map with lowercased keys.
+func lowerKeys(values map[string]string) map[string]string {
+	lowered := make(map[string]string, len(values))
+	for key, value := range values {
+		lowered[strings.ToLower(key)] = value
+	}
+
+	return lowered
+}
+
+// Verify reads back every uploaded object, using up to `concurrency` requests at a time, and
+// returns the number of objects that don't match what was sent. Each mismatch is logged.
+func (u *verifyUploader) Verify(ctx context.Context, client objectHeader, concurrency int, checkETag bool) int {
+	u.mu.Lock()
+	expected := append([]expectedObject{}, u.expected...)
+	u.mu.Unlock()
+
+	sort.Slice(expected, func(i, j int) bool { return expected[i].Path < expected[j].Path })
+
+	problems := make([][]string, len(expected))
+	semaphore := make(chan struct{}, max(concurrency, 1))
+
+	var wg sync.WaitGroup
+	for i, object := range expected {
+		wg.Add(1)
+		semaphore <- struct{}{}
+
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			head, err := client.Head(ctx, object.Path)
+			if err != nil {
+				problems[i] = []string{err.Error()}
+				return
+			}
+
+			problems[i] = object.mismatches(head, checkETag)
+		}()
+	}
+
+	wg.Wait()
+
+	var failed int
+	for i, object := range expected {
+		if len(problems[i]) > 0 {
+			failed++
+			log.Printf("Verification failed for %s: %s\n", object.Path, strings.Join(problems[i], "; "))
+		}
+	}
+
+	return failed
+}
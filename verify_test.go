@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+// mockHeader returns stored objects from a map.
+type mockHeader struct {
+	objects map[string]objectHead
+}
+
+func (h *mockHeader) Head(ctx context.Context, path string) (objectHead, error) {
+	head, ok := h.objects[path]
+	if !ok {
+		return objectHead{}, fmt.Errorf("not found: %w", fs.ErrNotExist)
+	}
+
+	return head, nil
+}
+
+func Test_verifyUploader(t *testing.T) {
+	// "some body" has the MD5 digest 328c30fae61cd119cd177c061d1ac11f.
+	stored := objectHead{
+		Size:        9,
+		ETag:        "328c30fae61cd119cd177c061d1ac11f",
+		ContentType: "text/plain",
+		Metadata:    map[string]string{"app-version": "1.0", "owner": "web"},
+	}
+
+	testCases := []struct {
+		desc       string
+		stored     map[string]objectHead
+		checkETag  bool
+		wantFailed int
+	}{
+		{desc: "matching object", stored: map[string]objectHead{"foo.txt": stored}, checkETag: true},
+		{
+			desc:       "truncated object",
+			stored:     map[string]objectHead{"foo.txt": {Size: 4, ETag: stored.ETag, ContentType: stored.ContentType, Metadata: stored.Metadata}},
+			checkETag:  true,
+			wantFailed: 1,
+		},
+		{
+			desc:       "corrupted object",
+			stored:     map[string]objectHead{"foo.txt": {Size: 9, ETag: "d41d8cd98f00b204e9800998ecf8427e", ContentType: stored.ContentType, Metadata: stored.Metadata}},
+			checkETag:  true,
+			wantFailed: 1,
+		},
+		{
+			desc:   "ETag not checked for encrypted object",
+			stored: map[string]objectHead{"foo.txt": {Size: 9, ETag: "d41d8cd98f00b204e9800998ecf8427e", ContentType: stored.ContentType, Metadata: stored.Metadata}},
+		},
+		{
+			desc:       "wrong content type",
+			stored:     map[string]objectHead{"foo.txt": {Size: 9, ETag: stored.ETag, ContentType: "binary/octet-stream", Metadata: stored.Metadata}},
+			checkETag:  true,
+			wantFailed: 1,
+		},
+		{
+			desc:       "missing metadata",
+			stored:     map[string]objectHead{"foo.txt": {Size: 9, ETag: stored.ETag, ContentType: stored.ContentType, Metadata: map[string]string{"app-version": "1.0"}}},
+			checkETag:  true,
+			wantFailed: 1,
+		},
+		{desc: "missing object", stored: map[string]objectHead{}, checkETag: true, wantFailed: 1},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			next := &recordingUploader{}
+			verifier := &verifyUploader{metadata: map[string]string{"app-version": "1.0"}, next: next}
+
+			err := verifier.Upload(context.Background(), &uploadObject{
+				Path:        "foo.txt",
+				Body:        strings.NewReader("some body"),
+				ContentType: "text/plain",
+				Headers:     map[string]string{"X-Amz-Meta-Owner": "web"},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(next.bodies) != 1 || next.bodies[0] != "some body" {
+				t.Fatalf("Expected the full body to be uploaded after hashing; got %q", next.bodies)
+			}
+
+			failed := verifier.Verify(context.Background(), &mockHeader{objects: tC.stored}, 2, tC.checkETag)
+			if failed != tC.wantFailed {
+				t.Errorf("Expected %d failed object(s); got %d", tC.wantFailed, failed)
+			}
+		})
+	}
+}
+
+func Test_verifyUploader_failedUpload(t *testing.T) {
+	verifier := &verifyUploader{next: &mockUploader{uploadErr: errors.New("denied")}}
+
+	err := verifier.Upload(context.Background(), &uploadObject{Path: "foo.txt", Body: strings.NewReader("x")})
+	if err == nil {
+		t.Fatal("Expected the upload error to be returned")
+	}
+
+	if len(verifier.expected) != 0 {
+		t.Errorf("Expected failed uploads not to be verified; got %v", verifier.expected)
+	}
+}
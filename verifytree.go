@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// runVerify implements the `verify` command, which checks that every file in the working
+// directory was uploaded intact. Unlike `diff`, objects without a local file are ignored, so that
+// a deploy can be checked against a bucket holding other files too. The command exits with status
+// 1 when a file is missing or differs from its object.
+func runVerify(cmd command, args []string) {
+	var common commonFlags
+	var compareName string
+	var jsonOutput bool
+	var brotliPatterns, gzipPatterns, include, exclude stringList
+
+	flags := newFlagSet(cmd, "[flags]")
+	common.register(flags)
+	flags.Var(&brotliPatterns, "brotli", "Glob patterns of files uploaded with a Brotli-compressed '.br' variant, e.g. '*.js,*.css' (repeatable)")
+	flags.StringVar(&compareName, "compare", string(compareETag), "How files are compared with their objects: 'etag' compares the size and the MD5-based ETag, 'size' only the size, 'mtime' the size and whether the file was modified after its object, 'checksum' the SHA-256 digest stored with the object")
+	flags.Var(&exclude, "exclude", "Glob pattern of files to skip (repeatable)")
+	flags.Var(&gzipPatterns, "gzip", "Glob patterns of files uploaded gzip-compressed, e.g. '*.html,*.css' (repeatable)")
+	flags.Var(&include, "include", "Glob pattern of files to verify; if given, other files are skipped (repeatable)")
+	flags.BoolVar(&jsonOutput, "json", false, "Print the result as JSON")
+	flags.Parse(args)
+
+	settings, err := common.applyConfig(flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if settings.path != "" && filepath.IsLocal(settings.path) {
+		exclude = append(exclude, filepath.ToSlash(filepath.Clean(settings.path)))
+	}
+
+	compare, err := parseCompareMode(compareName)
+	if err != nil {
+		log.Fatal("The '-compare' flag is invalid: ", err)
+	}
+
+	filter, err := newPathFilter(include, exclude)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	comp, err := newCompressor(gzipPatterns)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	variants, err := newBrotliVariants(brotliPatterns)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := newSignalContext()
+	defer stop()
+
+	store, err := newBackend(ctx, &common, backendOptions{})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	remote, err := store.List(ctx)
+	if err != nil {
+		log.Fatal("Could not list objects: ", err)
+	}
+
+	fsys := os.DirFS("./")
+	result, err := verifyTree(fsys, remote, filter, variants, newFileComparison(ctx, compare, fsys, comp, nil, store))
+	if err != nil {
+		log.Fatal("Verification failed: ", err)
+	}
+
+	if jsonOutput {
+		err = result.WriteJSON(os.Stdout)
+	} else {
+		err = result.WriteText(os.Stdout)
+	}
+
+	if err != nil {
+		log.Fatal("Could not write the result: ", err)
+	}
+
+	if !result.OK() {
+		os.Exit(1)
+	}
+}
+
+// treeVerification is the result of checking local files against the objects in a bucket.
+type treeVerification struct {
+	// Verified is the number of files that match their object.
+	Verified int `json:"verified"`
+	// Missing are the files that don't exist in the bucket.
+	Missing []string `json:"missing"`
+	// Changed are the files whose contents differ from their object.
+	Changed []string `json:"changed"`
+}
+
+// verifyTree compares every file in `fsys` with its remote object. Brotli variants of the files
+// they match must exist, but aren't compared, as files are compressed differently over time.
+func verifyTree(fsys fs.FS, remote map[string]remoteObject, filter pathFilter, variants *brotliVariants, compare fileComparison) (treeVerification, error) {
+	result := treeVerification{Missing: []string{}, Changed: []string{}}
+
+	err := fs.WalkDir(fsys, ".", createFilterFunc(filter, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("could not walk %s: %v", path, err)
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		if variants.Match(path) {
+			if _, ok := remote[path+brotliExtension]; !ok {
+				result.Missing = append(result.Missing, path+brotliExtension)
+			}
+		}
+
+		existing, ok := remote[path]
+		if !ok {
+			result.Missing = append(result.Missing, path)
+			return nil
+		}
+
+		unchanged, err := compare(path, entry, existing)
+		if err != nil {
+			return err
+		}
+
+		if unchanged {
+			result.Verified++
+		} else {
+			result.Changed = append(result.Changed, path)
+		}
+
+		return nil
+	}))
+	if err != nil {
+		return treeVerification{}, err
+	}
+
+	sort.Strings(result.Missing)
+
+	return result, nil
+}
+
+// OK reports whether every file matches its object.
+func (v treeVerification) OK() bool {
+	return len(v.Missing) == 0 && len(v.Changed) == 0
+}
+
+// WriteText writes the result in a human-readable format, marking files missing from the bucket
+// with `-` and changed files with `~`.
+func (v treeVerification) WriteText(w io.Writer) error {
+	for _, group := range []struct {
+		marker string
+		paths  []string
+	}{
+		{marker: "-", paths: v.Missing},
+		{marker: "~", paths: v.Changed},
+	} {
+		for _, path := range group.paths {
+			if _, err := fmt.Fprintf(w, "%s %s\n", group.marker, path); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "\n%d verified, %d missing, %d changed\n", v.Verified, len(v.Missing), len(v.Changed))
+
+	return err
+}
+
+// WriteJSON writes the result as a JSON object.
+func (v treeVerification) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(v)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_verifyTree(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":    {Data: []byte("some body")},
+		"app.js":        {Data: []byte("changed")},
+		"new.css":       {Data: []byte("body {}")},
+		"drafts/a.html": {Data: []byte("draft")},
+	}
+	remote := map[string]remoteObject{
+		"index.html": {Key: "index.html", Size: 9, ETag: "328c30fae61cd119cd177c061d1ac11f"},
+		"app.js":     {Key: "app.js", Size: 7, ETag: "d41d8cd98f00b204e9800998ecf8427e"},
+		"app.js.br":  {Key: "app.js.br", Size: 5},
+		"old.html":   {Key: "old.html", Size: 3},
+	}
+
+	testCases := []struct {
+		desc    string
+		mode    compareMode
+		exclude []string
+		brotli  []string
+		stored  map[string]objectHead
+		want    treeVerification
+	}{
+		{
+			desc: "all files",
+			mode: compareETag,
+			want: treeVerification{Verified: 1, Missing: []string{"drafts/a.html", "new.css"}, Changed: []string{"app.js"}},
+		},
+		{
+			desc:    "excluded files",
+			mode:    compareETag,
+			exclude: []string{"drafts/**"},
+			want:    treeVerification{Verified: 1, Missing: []string{"new.css"}, Changed: []string{"app.js"}},
+		},
+		{
+			desc:   "brotli variants",
+			mode:   compareETag,
+			brotli: []string{"*.js,*.css"},
+			want:   treeVerification{Verified: 1, Missing: []string{"drafts/a.html", "new.css", "new.css.br"}, Changed: []string{"app.js"}},
+		},
+		{
+			desc: "sizes",
+			mode: compareSize,
+			want: treeVerification{Verified: 2, Missing: []string{"drafts/a.html", "new.css"}, Changed: []string{}},
+		},
+		{
+			desc: "checksums",
+			mode: compareChecksum,
+			stored: map[string]objectHead{
+				"index.html": {Metadata: map[string]string{"S3copy-Sha256": "5f483264496cf1440c6ef569cc4fb9785d3bed896efdadfc998e9cb1badcec81"}},
+				"app.js":     {},
+			},
+			want: treeVerification{Verified: 1, Missing: []string{"drafts/a.html", "new.css"}, Changed: []string{"app.js"}},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			filter, err := newPathFilter(nil, tC.exclude)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			variants, err := newBrotliVariants(tC.brotli)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			compare := newFileComparison(context.Background(), tC.mode, fsys, nil, nil, &mockHeader{objects: tC.stored})
+
+			got, err := verifyTree(fsys, remote, filter, variants, compare)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("Expected %+v; got %+v", tC.want, got)
+			}
+		})
+	}
+}
+
+func Test_treeVerification_Write(t *testing.T) {
+	result := treeVerification{Verified: 3, Missing: []string{"new.css"}, Changed: []string{"app.js"}}
+
+	testCases := []struct {
+		desc  string
+		write func(treeVerification, *bytes.Buffer) error
+		want  string
+	}{
+		{
+			desc: "text",
+			write: func(v treeVerification, w *bytes.Buffer) error {
+				return v.WriteText(w)
+			},
+			want: "- new.css\n~ app.js\n\n3 verified, 1 missing, 1 changed\n",
+		},
+		{
+			desc: "JSON",
+			write: func(v treeVerification, w *bytes.Buffer) error {
+				return v.WriteJSON(w)
+			},
+			want: "{\n  \"verified\": 3,\n  \"missing\": [\n    \"new.css\"\n  ],\n  \"changed\": [\n    \"app.js\"\n  ]\n}\n",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := tC.write(result, &out); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if out.String() != tC.want {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tC.want, out.String())
+			}
+		})
+	}
+}
+
+func Test_treeVerification_OK(t *testing.T) {
+	if !(treeVerification{Verified: 2}).OK() {
+		t.Error("Expected a result without missing or changed files to be OK")
+	}
+
+	if (treeVerification{Missing: []string{"a"}}).OK() {
+		t.Error("Expected a result with a missing file not to be OK")
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// dirListing is the contents of a directory, read ahead of the walk reaching it.
+type dirListing struct {
+	done    chan struct{}
+	entries []fs.DirEntry
+	err     error
+	// children are the listings of the subdirectories, by name. They are read as soon as their
+	// parent was.
+	children map[string]*dirListing
+	// cancel stops reading the subdirectories once the walk is done with the directory.
+	cancel context.CancelFunc
+}
+
+// readAhead starts reading the directory at the given path, and then every directory beneath it,
+// reading at most as many directories at a time as the semaphore has slots. Reading stops once the
+// context is cancelled.
+func readAhead(ctx context.Context, path string, slots chan struct{}) *dirListing {
+	ctx, cancel := context.WithCancel(ctx)
+	listing := &dirListing{done: make(chan struct{}), children: map[string]*dirListing{}, cancel: cancel}
+
+	go func() {
+		defer close(listing.done)
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			listing.err = ctx.Err()
+			return
+		}
+
+		listing.entries, listing.err = os.ReadDir(path)
+		<-slots
+
+		for _, entry := range listing.entries {
+			if entry.IsDir() {
+				listing.children[entry.Name()] = readAhead(ctx, filepath.Join(path, entry.Name()), slots)
+			}
+		}
+	}()
+
+	return listing
+}
+
+// parallelWalk is a walk of a tree by a parallel walker.
+type parallelWalk struct {
+	slots    chan struct{}
+	symlinks symlinkPolicy
+	walk     fs.WalkDirFunc
+}
+
+// parallelWalker returns a tree walker that walks every file beneath the root like
+// `filepath.WalkDir`, but reads up to `concurrency` directories in parallel. Paths are
+// slash-separated on every platform, as they are used for keys. On network file
+// systems, where reading a directory is slow, this keeps large trees from dominating the run time.
+// `walk` is still called for one file at a time, in the same order as `filepath.WalkDir`, and
+// directories it skips aren't read any further. Symbolic links are handled according to the
+// policy.
+func parallelWalker(root string, concurrency int, symlinks symlinkPolicy) treeWalker {
+	return func(walk fs.WalkDirFunc) error {
+		info, err := os.Lstat(root)
+		if err != nil {
+			err = walk(root, nil, err)
+		} else {
+			w := parallelWalk{slots: make(chan struct{}, max(concurrency, 1)), symlinks: symlinks, walk: walk}
+
+			var listing *dirListing
+			if info.IsDir() {
+				listing = readAhead(context.Background(), root, w.slots)
+			}
+
+			err = w.walkListing(root, fs.FileInfoToDirEntry(info), listing)
+		}
+
+		if errors.Is(err, fs.SkipDir) || errors.Is(err, fs.SkipAll) {
+			return nil
+		}
+
+		return err
+	}
+}
+
+// walkListing calls `walk` for the entry at the given path and, if it's a directory, for
+// everything beneath it, from the listing read ahead for it.
+func (w parallelWalk) walkListing(path string, entry fs.DirEntry, listing *dirListing) error {
+	if entry.IsDir() {
+		defer listing.cancel()
+	}
+
+	if err := w.walk(path, entry, nil); err != nil || !entry.IsDir() {
+		if errors.Is(err, fs.SkipDir) && entry.IsDir() {
+			err = nil
+		}
+
+		return err
+	}
+
+	<-listing.done
+
+	if listing.err != nil {
+		// As with `filepath.WalkDir`, the entries read before the error are still walked.
+		if err := w.walk(path, entry, listing.err); err != nil {
+			if errors.Is(err, fs.SkipDir) {
+				err = nil
+			}
+
+			return err
+		}
+	}
+
+	for _, child := range listing.entries {
+		err := w.walkChild(filepath.ToSlash(filepath.Join(path, child.Name())), child, listing.children[child.Name()])
+		if errors.Is(err, fs.SkipDir) {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// walkChild walks an entry of a directory. Symbolic links are resolved first, and the directories
+// they point to are only read once the walk reaches them.
+func (w parallelWalk) walkChild(path string, entry fs.DirEntry, listing *dirListing) error {
+	if !isSymlink(entry) {
+		return w.walkListing(path, entry, listing)
+	}
+
+	resolved, err := w.symlinks.resolve(path)
+	if err != nil {
+		return w.walk(path, entry, err)
+	}
+
+	if resolved == nil {
+		return nil
+	}
+
+	if resolved.IsDir() {
+		listing = readAhead(context.Background(), path, w.slots)
+	}
+
+	return w.walkListing(path, resolved, listing)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_parallelWalker(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	for _, name := range []string{"index.html", "about/index.html", "assets/js/app.js", "assets/css/site.css", "assets/logo.png", "node_modules/lib/index.js", "zz/last.txt"} {
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(name, []byte("contents"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		desc string
+		// skip returns the error to return for a path, if any.
+		skip func(path string) error
+	}{
+		{
+			desc: "every file",
+			skip: func(path string) error { return nil },
+		},
+		{
+			desc: "skipped directory",
+			skip: func(path string) error {
+				if path == "node_modules" {
+					return fs.SkipDir
+				}
+
+				return nil
+			},
+		},
+		{
+			desc: "skipped siblings",
+			skip: func(path string) error {
+				if path == "assets/css/site.css" {
+					return fs.SkipDir
+				}
+
+				return nil
+			},
+		},
+		{
+			desc: "stopped walk",
+			skip: func(path string) error {
+				if path == "assets/js" {
+					return fs.SkipAll
+				}
+
+				return nil
+			},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			record := func(visited *[]string) fs.WalkDirFunc {
+				return func(path string, entry fs.DirEntry, err error) error {
+					if err != nil {
+						return err
+					}
+
+					*visited = append(*visited, path)
+
+					return tC.skip(path)
+				}
+			}
+
+			var want []string
+			if err := filepath.WalkDir("./", record(&want)); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, concurrency := range []int{1, 4} {
+				var got []string
+				if err := parallelWalker("./", concurrency, symlinkFiles)(record(&got)); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("Expected %v with a concurrency of %d; got %v", want, concurrency, got)
+				}
+			}
+		})
+	}
+}
+
+func Test_parallelWalker_missingRoot(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	var walkErr error
+	err := parallelWalker("missing", 4, symlinkFiles)(func(path string, entry fs.DirEntry, err error) error {
+		walkErr = err
+		return err
+	})
+
+	if err == nil || walkErr == nil {
+		t.Errorf("Expected the missing root to be reported; got %v", err)
+	}
+}
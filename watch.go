@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long the watcher waits after the last change before uploading, so that a
+// burst of changes, such as a rebuild of the site, is uploaded in one go.
+const watchDebounce = 500 * time.Millisecond
+
+// treeWatcher keeps a bucket in sync with the working directory by uploading files as they are
+// created or modified, and optionally deleting the objects of removed files.
+type treeWatcher struct {
+	filter pathFilter
+	// upload is invoked for each changed file.
+	upload fs.WalkDirFunc
+	// delete removes objects from the bucket. If nil, removed files are left in the bucket.
+	delete func(ctx context.Context, keys []string) error
+	// seen holds the paths of the files that exist in the bucket, so that the objects beneath a
+	// removed directory can be found.
+	seen     map[string]bool
+	variants *brotliVariants
+	delay    time.Duration
+}
+
+// Run watches the working directory until the context is cancelled.
+func (w *treeWatcher) Run(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("could not start watching files: %v", err)
+	}
+	defer watcher.Close()
+
+	if err := w.watchTree(watcher, "."); err != nil {
+		return err
+	}
+
+	log.Println("Watching for changes; press Ctrl+C to stop.")
+
+	pending := map[string]bool{}
+	timer := time.NewTimer(w.delay)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watcher.Errors:
+			log.Printf("Error watching files: %v\n", err)
+		case event := <-watcher.Events:
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			name := filepath.Clean(event.Name)
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(name); err == nil && info.IsDir() {
+					if err := w.watchTree(watcher, name); err != nil {
+						log.Print(err)
+					}
+				}
+			}
+
+			pending[name] = true
+			timer.Reset(w.delay)
+		case <-timer.C:
+			paths := make([]string, 0, len(pending))
+			for name := range pending {
+				paths = append(paths, name)
+			}
+
+			pending = map[string]bool{}
+			w.flush(ctx, paths)
+		}
+	}
+}
+
+// watchTree adds watches for a directory and the directories beneath it that aren't excluded.
+func (w *treeWatcher) watchTree(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("could not watch %s: %v", path, err)
+		}
+
+		if !entry.IsDir() {
+			return nil
+		}
+
+		if path != "." && w.filter.SkipDir(path) {
+			return fs.SkipDir
+		}
+
+		if err := watcher.Add(path); err != nil {
+			return fmt.Errorf("could not watch %s: %v", path, err)
+		}
+
+		return nil
+	})
+}
+
+// flush uploads the changed files at the given paths, and deletes the objects of removed files
+// and directories. Failures are logged rather than returned, so that watching continues.
+func (w *treeWatcher) flush(ctx context.Context, paths []string) {
+	sort.Strings(paths)
+
+	var removed []string
+	for _, path := range paths {
+		info, err := os.Lstat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			removed = append(removed, w.removedKeys(path)...)
+			continue
+		}
+
+		if err != nil {
+			log.Printf("Could not stat %s: %v\n", path, err)
+			continue
+		}
+
+		walk := createFilterFunc(w.filter, createRecordFunc(w.seen, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return w.upload(path, entry, err)
+			}
+
+			if err := w.upload(path, entry, nil); err != nil {
+				return err
+			}
+
+			log.Printf("Uploaded %s\n", filepath.ToSlash(path))
+
+			return nil
+		}))
+
+		if info.IsDir() {
+			err = filepath.WalkDir(path, walk)
+		} else {
+			err = walk(path, fs.FileInfoToDirEntry(info), nil)
+		}
+
+		if err != nil {
+			log.Print(err)
+		}
+	}
+
+	if len(removed) == 0 || w.delete == nil {
+		return
+	}
+
+	if err := w.delete(ctx, removed); err != nil {
+		log.Printf("Delete failed: %v\n", err)
+		return
+	}
+
+	for _, key := range removed {
+		delete(w.seen, key)
+	}
+}
+
+// removedKeys returns the keys of the objects for a removed file or directory, including the
+// Brotli variants uploaded alongside them.
+func (w *treeWatcher) removedKeys(path string) []string {
+	path = filepath.ToSlash(path)
+
+	var keys []string
+	for key := range w.seen {
+		if key == path || strings.HasPrefix(key, path+"/") {
+			keys = append(keys, key)
+			if w.variants.Match(key) {
+				keys = append(keys, key+brotliExtension)
+			}
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
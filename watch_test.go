@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func Test_treeWatcher_flush(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	for _, name := range []string{"index.html", "assets/app.js", "drafts/post.html"} {
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(name, []byte("contents"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filter, err := newPathFilter(nil, []string{"drafts/**"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	variants, err := newBrotliVariants([]string{"*.js"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var uploaded, deleted []string
+	watcher := &treeWatcher{
+		filter: filter,
+		upload: func(path string, entry fs.DirEntry, err error) error {
+			if err == nil && !entry.IsDir() {
+				uploaded = append(uploaded, filepath.ToSlash(path))
+			}
+
+			return err
+		},
+		delete: func(ctx context.Context, keys []string) error {
+			deleted = append(deleted, keys...)
+			return nil
+		},
+		seen: map[string]bool{
+			"old.html":      true,
+			"lib/vendor.js": true,
+			"lib/site.css":  true,
+		},
+		variants: variants,
+	}
+
+	watcher.flush(context.Background(), []string{"index.html", "assets", "drafts/post.html", "old.html", "lib"})
+
+	sort.Strings(uploaded)
+	if want := []string{"assets/app.js", "index.html"}; !reflect.DeepEqual(uploaded, want) {
+		t.Errorf("Expected uploads %v; got %v", want, uploaded)
+	}
+
+	if want := []string{"lib/site.css", "lib/vendor.js", "lib/vendor.js.br", "old.html"}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("Expected deletions %v; got %v", want, deleted)
+	}
+
+	for _, key := range []string{"index.html", "assets/app.js"} {
+		if !watcher.seen[key] {
+			t.Errorf("Expected %s to be recorded as uploaded", key)
+		}
+	}
+
+	for _, key := range []string{"old.html", "lib/vendor.js"} {
+		if watcher.seen[key] {
+			t.Errorf("Expected %s to be forgotten after deletion", key)
+		}
+	}
+}
+
+func Test_treeWatcher_flush_withoutDelete(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	watcher := &treeWatcher{
+		upload: func(path string, entry fs.DirEntry, err error) error {
+			t.Errorf("Unexpected upload of %s", path)
+			return nil
+		},
+		seen: map[string]bool{"old.html": true},
+	}
+
+	watcher.flush(context.Background(), []string{"old.html"})
+
+	if !watcher.seen["old.html"] {
+		t.Error("Expected removed files to stay recorded when deletion is disabled")
+	}
+}
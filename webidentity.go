@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// githubOIDCAudience is the audience of the tokens requested from GitHub Actions, which is the one
+// AWS's GitHub identity provider setup expects.
+const githubOIDCAudience = "sts.amazonaws.com"
+
+// githubTokenRetriever requests an OIDC token for the running GitHub Actions job, which GitHub
+// only issues to workflows with the 'id-token: write' permission.
+type githubTokenRetriever struct {
+	client *http.Client
+	// requestURL and requestToken are given to the job in ACTIONS_ID_TOKEN_REQUEST_URL and
+	// ACTIONS_ID_TOKEN_REQUEST_TOKEN.
+	requestURL   string
+	requestToken string
+}
+
+// newGitHubTokenRetriever creates a token retriever for the GitHub Actions job it runs in.
+func newGitHubTokenRetriever(client *http.Client) (*githubTokenRetriever, error) {
+	r := &githubTokenRetriever{
+		client:       client,
+		requestURL:   os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL"),
+		requestToken: os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN"),
+	}
+
+	if r.requestURL == "" || r.requestToken == "" {
+		return nil, errors.New("the '-github-oidc' flag only works in GitHub Actions jobs with the 'id-token: write' permission, which provide ACTIONS_ID_TOKEN_REQUEST_URL and ACTIONS_ID_TOKEN_REQUEST_TOKEN")
+	}
+
+	return r, nil
+}
+
+// GetIdentityToken requests a new token, so that one is available whenever the credentials of the
+// role are refreshed.
+func (r *githubTokenRetriever) GetIdentityToken() ([]byte, error) {
+	requestURL, err := url.Parse(r.requestURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ACTIONS_ID_TOKEN_REQUEST_URL: %v", err)
+	}
+
+	query := requestURL.Query()
+	query.Set("audience", githubOIDCAudience)
+	requestURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, requestURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+r.requestToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not request a GitHub OIDC token: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("could not request a GitHub OIDC token: %s: %s", resp.Status, body)
+	}
+
+	var token struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("could not parse the GitHub OIDC token: %v", err)
+	}
+
+	if token.Value == "" {
+		return nil, errors.New("GitHub returned an empty OIDC token")
+	}
+
+	return []byte(token.Value), nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_githubTokenRetriever_GetIdentityToken(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		status    int
+		body      string
+		wantToken string
+		wantErr   bool
+	}{
+		{desc: "token", status: http.StatusOK, body: `{"value":"eyJhbGciOi"}`, wantToken: "eyJhbGciOi"},
+		{desc: "empty token", status: http.StatusOK, body: `{"value":""}`, wantErr: true},
+		{desc: "forbidden", status: http.StatusForbidden, body: `{"message":"Forbidden"}`, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var gotQuery, gotAuthorization string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotQuery = r.URL.RawQuery
+				gotAuthorization = r.Header.Get("Authorization")
+				w.WriteHeader(tC.status)
+				fmt.Fprint(w, tC.body)
+			}))
+			defer server.Close()
+
+			t.Setenv("ACTIONS_ID_TOKEN_REQUEST_URL", server.URL+"/token?api-version=2.0")
+			t.Setenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN", "request-token")
+
+			retriever, err := newGitHubTokenRetriever(server.Client())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := retriever.GetIdentityToken()
+			if (err == nil) == tC.wantErr {
+				t.Fatalf("Expected error presence %v; got error %v", tC.wantErr, err)
+			}
+
+			if string(token) != tC.wantToken {
+				t.Errorf("Expected token %q; got %q", tC.wantToken, token)
+			}
+
+			if gotQuery != "api-version=2.0&audience=sts.amazonaws.com" || gotAuthorization != "Bearer request-token" {
+				t.Errorf("Unexpected request: query %q, authorization %q", gotQuery, gotAuthorization)
+			}
+		})
+	}
+}
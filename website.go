@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// indexDocument is the name of the page served for a directory.
+const indexDocument = "index.html"
+
+// websiteAliases decides which additional keys pages are uploaded under, so that static website
+// hosting serves them at clean URLs. This matters in particular when a CDN uses the bucket's REST
+// endpoint as its origin, which doesn't resolve index documents by itself.
+type websiteAliases struct {
+	// stripHTML also uploads pages without their `.html` extension.
+	stripHTML bool
+}
+
+// newWebsiteAliases creates the alias rules for website mode. If website mode is disabled, nil is
+// returned and no aliases are created.
+func newWebsiteAliases(website, stripHTML bool) *websiteAliases {
+	if !website {
+		return nil
+	}
+
+	return &websiteAliases{stripHTML: stripHTML}
+}
+
+// Keys returns the aliases of the file at the given path: `about/index.html` is also uploaded as
+// `about/` and `about`, and if `.html` extensions are stripped, `about.html` is also uploaded as
+// `about`. It is safe to call on nil alias rules.
+func (w *websiteAliases) Keys(name string) []string {
+	if w == nil {
+		return nil
+	}
+
+	name = filepath.ToSlash(name)
+	if path.Base(name) == indexDocument {
+		dir := path.Dir(name)
+		if dir == "." {
+			return nil
+		}
+
+		return []string{dir + "/", dir}
+	}
+
+	if w.stripHTML && strings.HasSuffix(name, ".html") && len(path.Base(name)) > len(".html") {
+		return []string{strings.TrimSuffix(name, ".html")}
+	}
+
+	return nil
+}
+
+// SkipFunc wraps the callback for files skipped because they are unchanged, so that unchanged
+// files whose aliases are missing from the remote objects are passed to `upload` instead. This
+// creates aliases for files uploaded before website mode was enabled.
+func (w *websiteAliases) SkipFunc(remote map[string]remoteObject, upload, skip fs.WalkDirFunc) fs.WalkDirFunc {
+	return func(path string, entry fs.DirEntry, err error) error {
+		if err == nil {
+			for _, key := range w.Keys(path) {
+				if _, ok := remote[key]; !ok {
+					return upload(path, entry, nil)
+				}
+			}
+		}
+
+		return skip(path, entry, err)
+	}
+}
+
+// addAliasKeys records the aliases of the files in `seen`, so that they aren't considered stale
+// when deleting objects that no longer exist locally.
+func addAliasKeys(seen map[string]bool, aliases *websiteAliases) {
+	var keys []string
+	for key := range seen {
+		keys = append(keys, aliases.Keys(key)...)
+	}
+
+	for _, key := range keys {
+		seen[key] = true
+	}
+}
+
+// websiteUploader uploads a copy of every page under each of its aliases. The copies keep the
+// original's Content-Type and headers, so that they're served as HTML despite having no extension.
+type websiteUploader struct {
+	aliases *websiteAliases
+	next    uploader
+}
+
+func (u *websiteUploader) Upload(ctx context.Context, object *uploadObject) error {
+	keys := u.aliases.Keys(object.Path)
+	if len(keys) == 0 {
+		return u.next.Upload(ctx, object)
+	}
+
+	// The body is needed several times, so it's buffered in memory rather than read from the
+	// file again.
+	contents, err := io.ReadAll(object.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", object.Path, err)
+	}
+
+	object.Body = bytes.NewReader(contents)
+	objects := []*uploadObject{object}
+	for _, key := range keys {
+		objects = append(objects, &uploadObject{
+			Path:        key,
+			Body:        bytes.NewReader(contents),
+			ContentType: object.ContentType,
+			Headers:     object.Headers,
+		})
+	}
+
+	return uploadEach(ctx, u.next, objects...)
+}
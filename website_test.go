@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_websiteAliases_Keys(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		stripHTML bool
+		path      string
+		want      []string
+	}{
+		{desc: "index document", path: "about/index.html", want: []string{"about/", "about"}},
+		{desc: "nested index document", path: "docs/v2/index.html", want: []string{"docs/v2/", "docs/v2"}},
+		{desc: "root index document", path: "index.html"},
+		{desc: "page", path: "about.html"},
+		{desc: "stripped page", stripHTML: true, path: "docs/about.html", want: []string{"docs/about"}},
+		{desc: "stripped index document", stripHTML: true, path: "about/index.html", want: []string{"about/", "about"}},
+		{desc: "hidden file", stripHTML: true, path: ".html"},
+		{desc: "asset", stripHTML: true, path: "app.js"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got := newWebsiteAliases(true, tC.stripHTML).Keys(tC.path)
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("Expected %q; got %q", tC.want, got)
+			}
+		})
+	}
+
+	if got := newWebsiteAliases(false, true).Keys("about/index.html"); got != nil {
+		t.Errorf("Expected no aliases outside website mode; got %q", got)
+	}
+}
+
+func Test_websiteUploader(t *testing.T) {
+	next := &recordingUploader{}
+	u := &websiteUploader{aliases: newWebsiteAliases(true, false), next: next}
+
+	err := u.Upload(context.Background(), &uploadObject{
+		Path:        "about/index.html",
+		Body:        strings.NewReader("<h1>About</h1>"),
+		ContentType: "text/html; charset=utf-8",
+		Headers:     map[string]string{"Cache-Control": "no-cache"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var paths []string
+	for i, object := range next.objects {
+		paths = append(paths, object.Path)
+
+		if next.bodies[i] != "<h1>About</h1>" {
+			t.Errorf("Expected %s to have the original body; got %q", object.Path, next.bodies[i])
+		}
+
+		if object.ContentType != "text/html; charset=utf-8" || object.Headers["Cache-Control"] != "no-cache" {
+			t.Errorf("Expected %s to keep the original's Content-Type and headers; got %q, %v", object.Path, object.ContentType, object.Headers)
+		}
+	}
+
+	if want := []string{"about/index.html", "about/", "about"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("Expected uploads %q; got %q", want, paths)
+	}
+}
+
+func Test_websiteAliases_SkipFunc(t *testing.T) {
+	aliases := newWebsiteAliases(true, false)
+	remote := map[string]remoteObject{
+		"a/index.html": {Key: "a/index.html"},
+		"a/":           {Key: "a/"},
+		"a":            {Key: "a"},
+		"b/index.html": {Key: "b/index.html"},
+	}
+
+	var uploaded, skipped []string
+	upload := func(path string, entry fs.DirEntry, err error) error {
+		uploaded = append(uploaded, path)
+		return nil
+	}
+	skip := func(path string, entry fs.DirEntry, err error) error {
+		skipped = append(skipped, path)
+		return nil
+	}
+
+	skipFunc := aliases.SkipFunc(remote, upload, skip)
+	for _, path := range []string{"a/index.html", "b/index.html", "c.css"} {
+		skipFunc(path, mockFileInfo{name: path}, nil)
+	}
+
+	if strings.Join(uploaded, ",") != "b/index.html" {
+		t.Errorf("Expected only the page with missing aliases to be uploaded; got %v", uploaded)
+	}
+
+	if strings.Join(skipped, ",") != "a/index.html,c.css" {
+		t.Errorf("Expected the other files to be skipped; got %v", skipped)
+	}
+}
+
+func Test_addAliasKeys(t *testing.T) {
+	seen := map[string]bool{"about/index.html": true, "app.js": true}
+
+	addAliasKeys(seen, newWebsiteAliases(true, false))
+
+	want := map[string]bool{"about/index.html": true, "about/": true, "about": true, "app.js": true}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("Expected %v; got %v", want, seen)
+	}
+}